@@ -7,11 +7,15 @@ import (
 	"net/http"
 	"time"
 
+	"bot/campaignLink"
 	"bot/common"
+	"bot/familyLink"
+	"bot/giftLink"
 	"bot/payments"
 	"bot/payments/promo"
 	"bot/referralLink"
 	"bot/services"
+	"bot/subscription"
 	"bot/telegram_bot"
 )
 
@@ -42,6 +46,11 @@ func InitializeApp() {
 		// Обработчик для callback-ов ЮКассы
 		http.HandleFunc("/yukassa/callback", handleYukassaCallback)
 
+		// Обработчик общей подписки со всех серверов
+		if common.SUBSCRIPTION_ENABLED {
+			http.HandleFunc(subscription.PathPrefix, subscription.HandleSubscription)
+		}
+
 		log.Printf("HTTP_SERVER: Запуск HTTP сервера на порту 8081")
 		if err := http.ListenAndServe(":8081", nil); err != nil {
 			log.Printf("HTTP_SERVER: Ошибка запуска сервера: %v", err)
@@ -146,6 +155,16 @@ func StartBot(token string) {
 				// Здесь будет вызов проверки необработанных платежей
 			}()
 		}
+
+		// Запускаем периодическую сверку платежей с ЮКассой
+		if common.PAYMENT_RECONCILIATION_ENABLED {
+			services.StartPeriodicReconciliation(payments.GlobalPaymentManager)
+		}
+
+		// Запускаем автопополнение с привязанных карт
+		if common.AUTO_TOPUP_ENABLED {
+			services.StartAutoTopupService(payments.GlobalPaymentManager)
+		}
 	}
 
 	// Инициализируем систему промокодов (независимо от платежной системы)
@@ -157,6 +176,54 @@ func StartBot(token string) {
 		log.Printf("APP: Система промокодов успешно инициализирована")
 	}
 
+	// Создаем реестр серверов (локаций)
+	if err := common.CreateServerTables(); err != nil {
+		log.Printf("APP: Ошибка создания реестра серверов: %v", err)
+		log.Printf("APP: Все пользователи будут работать с основным сервером")
+	}
+
+	// Клиенты серверов Xray без панели хранятся в базе и синхронизируются с Xray
+	if err := common.CreateXrayTables(); err != nil {
+		log.Printf("APP: Ошибка создания таблицы клиентов Xray: %v", err)
+	} else {
+		services.StartXraySyncService()
+	}
+
+	// Учитываем трафик пользователей по окнам и отключаем превысивших лимит
+	if err := common.CreateTrafficQuotaTables(); err != nil {
+		log.Printf("APP: Ошибка создания таблиц учета трафика: %v", err)
+	} else {
+		services.StartTrafficQuotaService()
+	}
+
+	// Запускаем периодическую сверку базы с клиентами панелей
+	if common.PANEL_RECONCILE_ENABLED {
+		services.StartPanelReconcileService(bot.API)
+	}
+
+	// Запускаем проверки доступности серверов
+	if common.HEALTH_CHECK_ENABLED {
+		if err := common.CreateServerHealthTables(); err != nil {
+			log.Printf("APP: Ошибка создания таблицы состояния серверов: %v", err)
+		} else {
+			services.StartServerHealthService(bot.API)
+		}
+	}
+
+	// Создаем таблицу активаций пробного периода (конверсия по политикам)
+	if err := common.CreateTrialTables(); err != nil {
+		log.Printf("APP: Ошибка создания таблиц пробного периода: %v", err)
+	}
+
+	// Запускаем поиск связанных пробных аккаунтов по общим IP
+	if common.TRIAL_ABUSE_ENABLED {
+		if err := common.CreateTrialAbuseTables(); err != nil {
+			log.Printf("APP: Ошибка создания таблиц поиска связанных пробных аккаунтов: %v", err)
+		} else {
+			services.StartTrialAbuseService(bot.API)
+		}
+	}
+
 	// Инициализируем реферальную систему
 	log.Printf("APP: Инициализация реферальной системы")
 	if err := referralLink.InitReferralSystem(common.GetDB(), bot.API); err != nil {
@@ -164,6 +231,48 @@ func StartBot(token string) {
 		log.Printf("APP: Реферальная система будет недоступна")
 	} else {
 		log.Printf("APP: Реферальная система успешно инициализирована")
+
+		// Запускаем выплату бонусов, удержанных до подтверждения рефералов
+		if common.REFERRAL_SYSTEM_ENABLED && common.REFERRAL_HOLD_ENABLED && common.REFERRAL_HOLD_ACTIVE_DAYS > 0 {
+			services.StartReferralHoldService(referralLink.GlobalReferralManager)
+		}
+	}
+
+	// Инициализируем учет рекламных кампаний
+	log.Printf("APP: Инициализация рекламных кампаний")
+	if err := campaignLink.InitCampaignSystem(common.GetDB(), bot.API); err != nil {
+		log.Printf("APP: Ошибка инициализации рекламных кампаний: %v", err)
+		log.Printf("APP: Ссылки кампаний будут недоступны")
+	} else {
+		log.Printf("APP: Рекламные кампании успешно инициализированы")
+	}
+
+	// Инициализируем подарочные подписки
+	log.Printf("APP: Инициализация подарочных подписок")
+	if err := giftLink.InitGiftSystem(common.GetDB(), bot.API); err != nil {
+		log.Printf("APP: Ошибка инициализации подарочных подписок: %v", err)
+		log.Printf("APP: Подарки будут недоступны")
+	} else {
+		log.Printf("APP: Подарочные подписки успешно инициализированы")
+
+		// Запускаем возврат денег за неактивированные подарки
+		if common.GIFTS_ENABLED {
+			services.StartGiftExpiryService(giftLink.GlobalGiftManager)
+		}
+	}
+
+	// Инициализируем семейные тарифы
+	log.Printf("APP: Инициализация семейных тарифов")
+	if err := familyLink.InitFamilySystem(common.GetDB(), bot.API); err != nil {
+		log.Printf("APP: Ошибка инициализации семейных тарифов: %v", err)
+		log.Printf("APP: Семейные тарифы будут недоступны")
+	} else {
+		log.Printf("APP: Семейные тарифы успешно инициализированы")
+
+		// Запускаем оплату мест с баланса владельцев
+		if common.FAMILY_PLANS_ENABLED {
+			services.StartFamilyBillingService(familyLink.GlobalFamilyManager)
+		}
 	}
 
 	// Запускаем систему уведомлений о подписке
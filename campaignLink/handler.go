@@ -0,0 +1,268 @@
+package campaignLink
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// campaignHelp справка по команде /campaign
+const campaignHelp = "📣 <b>Рекламные кампании</b>\n\n" +
+	"<code>/campaign</code> - список кампаний\n" +
+	"<code>/campaign new название</code> - создать кампанию и получить ссылку\n" +
+	"<code>/campaign ID</code> - воронка кампании\n\n" +
+	"<b>Пример:</b>\n<code>/campaign new tg_channel_march</code>"
+
+// CampaignHandler обработчик команд и callback'ов рекламных кампаний
+type CampaignHandler struct {
+	service *CampaignService
+	bot     *tgbotapi.BotAPI
+}
+
+// NewCampaignHandler создает новый обработчик рекламных кампаний
+func NewCampaignHandler(service *CampaignService, bot *tgbotapi.BotAPI) *CampaignHandler {
+	return &CampaignHandler{
+		service: service,
+		bot:     bot,
+	}
+}
+
+// HandleCampaignCommand обрабатывает команду /campaign
+func (ch *CampaignHandler) HandleCampaignCommand(chatID int64, userID int64, args []string) {
+	if userID != common.ADMIN_ID {
+		ch.bot.Send(tgbotapi.NewMessage(chatID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	switch {
+	case len(args) == 0:
+		ch.sendCampaignList(chatID)
+	case strings.ToLower(args[0]) == "new":
+		if len(args) < 2 {
+			ch.sendHTML(chatID, campaignHelp)
+			return
+		}
+		ch.createCampaign(chatID, userID, strings.Join(args[1:], "_"))
+	case strings.ToLower(args[0]) == "help":
+		ch.sendHTML(chatID, campaignHelp)
+	default:
+		ch.sendFunnel(chatID, strings.ToLower(args[0]))
+	}
+}
+
+// HandleCallback обрабатывает callback'и рекламных кампаний
+func (ch *CampaignHandler) HandleCallback(chatID int64, userID int64, data string) {
+	if userID != common.ADMIN_ID {
+		ch.bot.Send(tgbotapi.NewMessage(chatID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	switch {
+	case data == "camp_list":
+		ch.sendCampaignList(chatID)
+	case strings.HasPrefix(data, "camp_report:"):
+		ch.sendFunnel(chatID, strings.TrimPrefix(data, "camp_report:"))
+	case strings.HasPrefix(data, "camp_csv:"):
+		ch.sendExport(chatID, strings.TrimPrefix(data, "camp_csv:"))
+	case strings.HasPrefix(data, "camp_off:"):
+		ch.deactivateCampaign(chatID, strings.TrimPrefix(data, "camp_off:"))
+	default:
+		log.Printf("CAMPAIGN_HANDLER: ❌ Неизвестный callback: %s", data)
+	}
+}
+
+// IsCampaignCallback проверяет, является ли callback callback'ом кампаний
+func (ch *CampaignHandler) IsCampaignCallback(data string) bool {
+	return data == "camp_list" || strings.HasPrefix(data, "camp_report:") ||
+		strings.HasPrefix(data, "camp_csv:") || strings.HasPrefix(data, "camp_off:")
+}
+
+// createCampaign создает кампанию и отправляет ее ссылку
+func (ch *CampaignHandler) createCampaign(chatID int64, userID int64, name string) {
+	campaign, err := ch.service.CreateCampaign(name, userID)
+	if err != nil {
+		log.Printf("CAMPAIGN_HANDLER: Ошибка создания кампании %s: %v", name, err)
+		ch.sendHTML(chatID, fmt.Sprintf("❌ %v\n\n%s", err, campaignHelp))
+		return
+	}
+
+	text := fmt.Sprintf("✅ <b>Кампания %s</b>\n\n"+
+		"🔗 <b>Ссылка:</b>\n<code>%s</code>\n\n"+
+		"Переходы по ссылке попадут в воронку кампании.",
+		campaign.Name, CampaignLink(campaign.ID))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = campaignKeyboard(campaign)
+
+	if _, err := ch.bot.Send(msg); err != nil {
+		log.Printf("CAMPAIGN_HANDLER: Ошибка отправки кампании: %v", err)
+	}
+}
+
+// sendCampaignList отправляет список кампаний
+func (ch *CampaignHandler) sendCampaignList(chatID int64) {
+	campaigns, err := ch.service.GetCampaigns(20)
+	if err != nil {
+		log.Printf("CAMPAIGN_HANDLER: Ошибка получения кампаний: %v", err)
+		ch.bot.Send(tgbotapi.NewMessage(chatID, "❌ Ошибка получения кампаний"))
+		return
+	}
+
+	if len(campaigns) == 0 {
+		ch.sendHTML(chatID, "📣 Кампаний пока нет.\n\n"+campaignHelp)
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, campaign := range campaigns {
+		status := "🟢"
+		if !campaign.IsActive {
+			status = "⚪"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("%s %s", status, campaign.Name), "camp_report:"+campaign.ID)))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "📣 <b>Рекламные кампании</b>\n\nВыберите кампанию для просмотра воронки:")
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	if _, err := ch.bot.Send(msg); err != nil {
+		log.Printf("CAMPAIGN_HANDLER: Ошибка отправки списка кампаний: %v", err)
+	}
+}
+
+// sendFunnel отправляет воронку кампании
+func (ch *CampaignHandler) sendFunnel(chatID int64, campaignID string) {
+	funnel, err := ch.service.GetFunnel(campaignID)
+	if err != nil {
+		log.Printf("CAMPAIGN_HANDLER: Ошибка получения воронки кампании %s: %v", campaignID, err)
+		ch.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, funnelText(funnel))
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = campaignKeyboard(&funnel.Campaign)
+
+	if _, err := ch.bot.Send(msg); err != nil {
+		log.Printf("CAMPAIGN_HANDLER: Ошибка отправки воронки кампании: %v", err)
+	}
+}
+
+// sendExport отправляет CSV-выгрузку пользователей кампании
+func (ch *CampaignHandler) sendExport(chatID int64, campaignID string) {
+	data, err := ch.service.ExportCampaignCSV(campaignID)
+	if err != nil {
+		log.Printf("CAMPAIGN_HANDLER: Ошибка выгрузки кампании %s: %v", campaignID, err)
+		ch.bot.Send(tgbotapi.NewMessage(chatID, "❌ Ошибка выгрузки кампании. Попробуйте позже."))
+		return
+	}
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("campaign_%s.csv", campaignID),
+		Bytes: data,
+	})
+	doc.Caption = fmt.Sprintf("📥 Пользователи кампании %s", campaignID)
+
+	if _, err := ch.bot.Send(doc); err != nil {
+		log.Printf("CAMPAIGN_HANDLER: Ошибка отправки выгрузки: %v", err)
+	}
+}
+
+// deactivateCampaign отключает кампанию
+func (ch *CampaignHandler) deactivateCampaign(chatID int64, campaignID string) {
+	if err := ch.service.DeactivateCampaign(campaignID); err != nil {
+		log.Printf("CAMPAIGN_HANDLER: Ошибка отключения кампании %s: %v", campaignID, err)
+		ch.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	ch.sendHTML(chatID, fmt.Sprintf("⛔ Кампания <b>%s</b> отключена\n\nНовые переходы по ее ссылке не учитываются.", campaignID))
+}
+
+// sendHTML отправляет сообщение с HTML-разметкой
+func (ch *CampaignHandler) sendHTML(chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	if _, err := ch.bot.Send(msg); err != nil {
+		log.Printf("CAMPAIGN_HANDLER: Ошибка отправки сообщения: %v", err)
+	}
+}
+
+// funnelText формирует текст воронки кампании
+func funnelText(funnel *CampaignFunnel) string {
+	status := "🟢 Активна"
+	if !funnel.Campaign.IsActive {
+		status = "⚪ Отключена"
+	}
+
+	text := fmt.Sprintf("📣 <b>Кампания %s</b>\n\n"+
+		"📌 <b>Статус:</b> %s\n"+
+		"📅 <b>Создана:</b> %s\n"+
+		"🔗 <code>%s</code>\n\n"+
+		"<b>Воронка:</b>\n"+
+		"👆 Переходов: %d (уникальных: %d)\n"+
+		"👥 Привлечено: %d%s\n"+
+		"🎁 Пробный период: %d%s\n",
+		funnel.Campaign.Name,
+		status,
+		funnel.Campaign.CreatedAt.Format("02.01.2006"),
+		CampaignLink(funnel.Campaign.ID),
+		funnel.Starts, funnel.UniqueStarts,
+		funnel.Users, conversionText(funnel.Users, funnel.UniqueStarts),
+		funnel.Trials, conversionText(funnel.Trials, funnel.Users))
+
+	if funnel.RevenueFailed {
+		return text + "💳 Оплаты: недоступны"
+	}
+
+	text += fmt.Sprintf("💳 Первая оплата: %d%s\n\n"+
+		"<b>Выручка:</b>\n"+
+		"💰 За 30 дней: %.2f₽\n"+
+		"💰 За 90 дней: %.2f₽\n"+
+		"💰 Всего: %.2f₽",
+		funnel.Payers, conversionText(funnel.Payers, funnel.Users),
+		funnel.Revenue30, funnel.Revenue90, funnel.RevenueTotal)
+
+	if funnel.Users > 0 {
+		text += fmt.Sprintf("\n📈 На пользователя (90 дней): %.2f₽", funnel.Revenue90/float64(funnel.Users))
+	}
+
+	return text
+}
+
+// conversionText возвращает конверсию шага воронки относительно предыдущего
+func conversionText(count, base int) string {
+	if base == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%.1f%%)", float64(count)/float64(base)*100)
+}
+
+// campaignKeyboard создает клавиатуру действий с кампанией
+func campaignKeyboard(campaign *Campaign) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📊 Воронка", "camp_report:"+campaign.ID),
+			tgbotapi.NewInlineKeyboardButtonData("📥 CSV", "camp_csv:"+campaign.ID),
+		),
+	}
+
+	if campaign.IsActive {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⛔ Отключить кампанию", "camp_off:"+campaign.ID),
+		))
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📣 Все кампании", "camp_list"),
+	))
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
@@ -0,0 +1,100 @@
+package campaignLink
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CampaignManager глобальный менеджер рекламных кампаний
+type CampaignManager struct {
+	service *CampaignService
+	handler *CampaignHandler
+}
+
+// GlobalCampaignManager глобальный экземпляр менеджера кампаний
+var GlobalCampaignManager *CampaignManager
+
+// InitCampaignSystem инициализирует учет рекламных кампаний
+func InitCampaignSystem(db *sql.DB, bot *tgbotapi.BotAPI) error {
+	log.Printf("CAMPAIGN_MANAGER: Инициализация рекламных кампаний")
+
+	if !common.CAMPAIGN_LINKS_ENABLED {
+		log.Printf("CAMPAIGN_MANAGER: Ссылки кампаний отключены в конфигурации")
+		return nil
+	}
+
+	if err := createCampaignTables(db); err != nil {
+		return err
+	}
+
+	service := NewCampaignService(db)
+
+	GlobalCampaignManager = &CampaignManager{
+		service: service,
+		handler: NewCampaignHandler(service, bot),
+	}
+
+	log.Printf("CAMPAIGN_MANAGER: Рекламные кампании успешно инициализированы")
+	return nil
+}
+
+// IsCampaignStart проверяет, является ли команда /start переходом по ссылке кампании
+func (cm *CampaignManager) IsCampaignStart(text string) bool {
+	return cm.ExtractCampaignID(text) != ""
+}
+
+// ExtractCampaignID извлекает ID кампании из команды /start c_<кампания>
+func (cm *CampaignManager) ExtractCampaignID(text string) string {
+	parts := strings.Fields(text)
+	if len(parts) >= 2 && parts[0] == "/start" && strings.HasPrefix(parts[1], CampaignStartPrefix) {
+		return strings.ToLower(strings.TrimPrefix(parts[1], CampaignStartPrefix))
+	}
+	return ""
+}
+
+// HandleStartCommand учитывает переход по ссылке кампании. Дальнейшая обработка /start не меняется.
+func (cm *CampaignManager) HandleStartCommand(user *common.User, text string) {
+	campaignID := cm.ExtractCampaignID(text)
+	if campaignID == "" {
+		return
+	}
+
+	attributed, err := cm.service.RecordStart(campaignID, user.TelegramID)
+	if err != nil {
+		log.Printf("CAMPAIGN_MANAGER: Переход пользователя %d по кампании %s не учтен: %v", user.TelegramID, campaignID, err)
+		return
+	}
+
+	if attributed {
+		log.Printf("CAMPAIGN_MANAGER: ✅ Пользователь %d привлечен кампанией %s", user.TelegramID, campaignID)
+	} else {
+		log.Printf("CAMPAIGN_MANAGER: Повторный переход пользователя %d по кампании %s", user.TelegramID, campaignID)
+	}
+}
+
+// IsCampaignCommand проверяет, является ли команда командой кампаний
+func (cm *CampaignManager) IsCampaignCommand(command string) bool {
+	return command == "campaign"
+}
+
+// HandleCommand обрабатывает команды кампаний
+func (cm *CampaignManager) HandleCommand(chatID int64, userID int64, command string, args []string) {
+	if command == "campaign" {
+		cm.handler.HandleCampaignCommand(chatID, userID, args)
+	}
+}
+
+// IsCampaignCallback проверяет, является ли callback callback'ом кампаний
+func (cm *CampaignManager) IsCampaignCallback(data string) bool {
+	return cm.handler.IsCampaignCallback(data)
+}
+
+// HandleCallback обрабатывает callback'и кампаний
+func (cm *CampaignManager) HandleCallback(chatID int64, userID int64, data string) {
+	cm.handler.HandleCallback(chatID, userID, data)
+}
@@ -0,0 +1,337 @@
+package campaignLink
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"bot/common"
+	paymentCommon "bot/payments/common"
+)
+
+// CampaignStartPrefix префикс параметра /start для ссылок кампаний
+const CampaignStartPrefix = "c_"
+
+// CampaignService сервис рекламных кампаний
+type CampaignService struct {
+	db *sql.DB
+}
+
+// NewCampaignService создает новый сервис рекламных кампаний
+func NewCampaignService(db *sql.DB) *CampaignService {
+	return &CampaignService{db: db}
+}
+
+// createCampaignTables создает таблицы кампаний, переходов и атрибуцию пользователей
+func createCampaignTables(db *sql.DB) error {
+	tablesSQL := `
+	CREATE TABLE IF NOT EXISTS marketing_campaigns (
+		id VARCHAR(64) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		created_by BIGINT NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		is_active BOOLEAN NOT NULL DEFAULT true
+	);
+	CREATE TABLE IF NOT EXISTS campaign_starts (
+		id SERIAL PRIMARY KEY,
+		campaign_id VARCHAR(64) NOT NULL REFERENCES marketing_campaigns(id),
+		telegram_id BIGINT NOT NULL,
+		attributed BOOLEAN NOT NULL DEFAULT false,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);`
+
+	// Первое касание хранится прямо у пользователя
+	alterSQL := `
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS campaign_id VARCHAR(64);
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS campaign_attributed_at TIMESTAMP WITH TIME ZONE;`
+
+	indexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_campaign_starts_campaign_id ON campaign_starts(campaign_id);
+	CREATE INDEX IF NOT EXISTS idx_users_campaign_id ON users(campaign_id) WHERE campaign_id IS NOT NULL;`
+
+	if _, err := db.Exec(tablesSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблиц кампаний: %v", err)
+	}
+
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("ошибка обновления таблицы users: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов кампаний: %v", err)
+	}
+
+	return nil
+}
+
+// campaignIDFromName формирует ID кампании из названия (строчные латинские буквы, цифры, _ и -)
+func campaignIDFromName(name string) (string, error) {
+	var id strings.Builder
+	for _, char := range strings.ToLower(name) {
+		if (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') || char == '_' || char == '-' {
+			id.WriteRune(char)
+		}
+	}
+
+	if id.Len() == 0 || id.Len() > 32 {
+		return "", fmt.Errorf("название кампании должно содержать от 1 до 32 латинских букв, цифр, _ или -")
+	}
+
+	return id.String(), nil
+}
+
+// CampaignLink возвращает ссылку на бота для кампании
+func CampaignLink(campaignID string) string {
+	return common.CAMPAIGN_LINK_BASE_URL + campaignID
+}
+
+// CreateCampaign создает кампанию. Если кампания с таким ID уже есть, возвращает ее.
+func (cs *CampaignService) CreateCampaign(name string, createdBy int64) (*Campaign, error) {
+	campaignID, err := campaignIDFromName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cs.db.Exec(`
+		INSERT INTO marketing_campaigns (id, name, created_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO NOTHING`, campaignID, name, createdBy)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания кампании: %v", err)
+	}
+
+	return cs.GetCampaign(campaignID)
+}
+
+// GetCampaign возвращает кампанию по ID
+func (cs *CampaignService) GetCampaign(campaignID string) (*Campaign, error) {
+	var campaign Campaign
+	err := cs.db.QueryRow(`
+		SELECT id, name, created_by, created_at, is_active
+		FROM marketing_campaigns WHERE id = $1`, campaignID).Scan(
+		&campaign.ID, &campaign.Name, &campaign.CreatedBy, &campaign.CreatedAt, &campaign.IsActive)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("кампания %s не найдена", campaignID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения кампании: %v", err)
+	}
+
+	return &campaign, nil
+}
+
+// GetCampaigns возвращает последние кампании
+func (cs *CampaignService) GetCampaigns(limit int) ([]Campaign, error) {
+	rows, err := cs.db.Query(`
+		SELECT id, name, created_by, created_at, is_active
+		FROM marketing_campaigns
+		ORDER BY created_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения кампаний: %v", err)
+	}
+	defer rows.Close()
+
+	var campaigns []Campaign
+	for rows.Next() {
+		var campaign Campaign
+		if err := rows.Scan(&campaign.ID, &campaign.Name, &campaign.CreatedBy, &campaign.CreatedAt, &campaign.IsActive); err != nil {
+			return nil, fmt.Errorf("ошибка чтения кампании: %v", err)
+		}
+		campaigns = append(campaigns, campaign)
+	}
+
+	return campaigns, rows.Err()
+}
+
+// DeactivateCampaign отключает кампанию: переходы по ее ссылке больше не учитываются
+func (cs *CampaignService) DeactivateCampaign(campaignID string) error {
+	result, err := cs.db.Exec("UPDATE marketing_campaigns SET is_active = false WHERE id = $1", campaignID)
+	if err != nil {
+		return fmt.Errorf("ошибка отключения кампании: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка получения количества обновленных строк: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("кампания %s не найдена", campaignID)
+	}
+
+	log.Printf("CAMPAIGN: Кампания %s отключена", campaignID)
+
+	return nil
+}
+
+// RecordStart учитывает переход пользователя по ссылке кампании.
+// Кампания закрепляется за пользователем только при первом касании: если у него еще нет кампании,
+// он не пришел по реферальной ссылке, не платил и не брал пробный период.
+func (cs *CampaignService) RecordStart(campaignID string, telegramID int64) (bool, error) {
+	campaign, err := cs.GetCampaign(campaignID)
+	if err != nil {
+		return false, err
+	}
+	if !campaign.IsActive {
+		return false, fmt.Errorf("кампания %s отключена", campaignID)
+	}
+
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users SET campaign_id = $2, campaign_attributed_at = NOW()
+		WHERE telegram_id = $1 AND campaign_id IS NULL AND referred_by IS NULL
+		  AND COALESCE(total_paid, 0) = 0 AND NOT COALESCE(has_used_trial, false)`, telegramID, campaignID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка атрибуции пользователя: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества обновленных строк: %v", err)
+	}
+	attributed := rowsAffected > 0
+
+	_, err = tx.Exec(`
+		INSERT INTO campaign_starts (campaign_id, telegram_id, attributed)
+		VALUES ($1, $2, $3)`, campaignID, telegramID, attributed)
+	if err != nil {
+		return false, fmt.Errorf("ошибка записи перехода: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("ошибка коммита транзакции: %v", err)
+	}
+
+	return attributed, nil
+}
+
+// GetFunnel формирует воронку кампании по привлеченным ею пользователям
+func (cs *CampaignService) GetFunnel(campaignID string) (*CampaignFunnel, error) {
+	campaign, err := cs.GetCampaign(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	funnel := &CampaignFunnel{Campaign: *campaign}
+
+	err = cs.db.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT telegram_id)
+		FROM campaign_starts WHERE campaign_id = $1`, campaignID).Scan(&funnel.Starts, &funnel.UniqueStarts)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета переходов кампании: %v", err)
+	}
+
+	err = cs.db.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE has_used_trial)
+		FROM users WHERE campaign_id = $1`, campaignID).Scan(&funnel.Users, &funnel.Trials)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета пользователей кампании: %v", err)
+	}
+
+	// Выручка - зачисленные пополнения после привлечения, с окнами 30 и 90 дней от даты привлечения
+	err = cs.db.QueryRow(`
+		SELECT COUNT(DISTINCT cr.user_id),
+		       COALESCE(SUM(cr.amount) FILTER (WHERE cr.created_at < u.campaign_attributed_at + INTERVAL '30 days'), 0),
+		       COALESCE(SUM(cr.amount) FILTER (WHERE cr.created_at < u.campaign_attributed_at + INTERVAL '90 days'), 0),
+		       COALESCE(SUM(cr.amount), 0)
+		FROM users u
+		JOIN payment_credits cr ON cr.user_id = u.telegram_id AND cr.kind = $2 AND cr.created_at >= u.campaign_attributed_at
+		WHERE u.campaign_id = $1`, campaignID, paymentCommon.CreditKindPayment).Scan(
+		&funnel.Payers, &funnel.Revenue30, &funnel.Revenue90, &funnel.RevenueTotal)
+	if err != nil {
+		// Таблица зачислений создается платежной системой и может отсутствовать
+		log.Printf("CAMPAIGN: Ошибка подсчета выручки кампании %s: %v", campaignID, err)
+		funnel.RevenueFailed = true
+	}
+
+	return funnel, nil
+}
+
+// GetCampaignUsers возвращает привлеченных кампанией пользователей с их оплатами
+func (cs *CampaignService) GetCampaignUsers(campaignID string) ([]CampaignUser, error) {
+	rows, err := cs.db.Query(`
+		SELECT u.telegram_id, COALESCE(u.username, ''), u.campaign_attributed_at, COALESCE(u.has_used_trial, false),
+		       MIN(cr.created_at),
+		       COALESCE(SUM(cr.amount) FILTER (WHERE cr.created_at < u.campaign_attributed_at + INTERVAL '30 days'), 0),
+		       COALESCE(SUM(cr.amount) FILTER (WHERE cr.created_at < u.campaign_attributed_at + INTERVAL '90 days'), 0),
+		       COALESCE(SUM(cr.amount), 0)
+		FROM users u
+		LEFT JOIN payment_credits cr ON cr.user_id = u.telegram_id AND cr.kind = $2 AND cr.created_at >= u.campaign_attributed_at
+		WHERE u.campaign_id = $1
+		GROUP BY u.telegram_id, u.username, u.campaign_attributed_at, u.has_used_trial
+		ORDER BY u.campaign_attributed_at`, campaignID, paymentCommon.CreditKindPayment)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения пользователей кампании: %v", err)
+	}
+	defer rows.Close()
+
+	var users []CampaignUser
+	for rows.Next() {
+		var user CampaignUser
+		var firstPayment sql.NullTime
+		if err := rows.Scan(&user.TelegramID, &user.Username, &user.AttributedAt, &user.HasUsedTrial,
+			&firstPayment, &user.Revenue30, &user.Revenue90, &user.RevenueTotal); err != nil {
+			return nil, fmt.Errorf("ошибка чтения пользователя кампании: %v", err)
+		}
+		if firstPayment.Valid {
+			user.FirstPaymentAt = &firstPayment.Time
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// ExportCampaignCSV выгружает привлеченных кампанией пользователей и их воронку в CSV
+func (cs *CampaignService) ExportCampaignCSV(campaignID string) ([]byte, error) {
+	users, err := cs.GetCampaignUsers(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	header := []string{"telegram_id", "username", "attributed_at", "trial", "first_payment_at", "revenue_30d", "revenue_90d", "revenue_total"}
+	if err := writer.Write(header); err != nil {
+		return nil, fmt.Errorf("ошибка записи CSV: %v", err)
+	}
+
+	for _, user := range users {
+		firstPayment := ""
+		if user.FirstPaymentAt != nil {
+			firstPayment = user.FirstPaymentAt.Format(time.RFC3339)
+		}
+
+		record := []string{
+			strconv.FormatInt(user.TelegramID, 10),
+			user.Username,
+			user.AttributedAt.Format(time.RFC3339),
+			strconv.FormatBool(user.HasUsedTrial),
+			firstPayment,
+			strconv.FormatFloat(user.Revenue30, 'f', 2, 64),
+			strconv.FormatFloat(user.Revenue90, 'f', 2, 64),
+			strconv.FormatFloat(user.RevenueTotal, 'f', 2, 64),
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, fmt.Errorf("ошибка записи CSV: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("ошибка записи CSV: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
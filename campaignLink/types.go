@@ -0,0 +1,38 @@
+package campaignLink
+
+import "time"
+
+// Campaign представляет рекламную кампанию со ссылкой t.me/bot?start=c_<id>
+type Campaign struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	IsActive  bool      `json:"is_active"`
+}
+
+// CampaignFunnel представляет воронку кампании: переходы → пробный период → первая оплата → выручка
+type CampaignFunnel struct {
+	Campaign      Campaign `json:"campaign"`
+	Starts        int      `json:"starts"`         // Всего переходов по ссылке
+	UniqueStarts  int      `json:"unique_starts"`  // Уникальных пользователей, перешедших по ссылке
+	Users         int      `json:"users"`          // Привлеченных пользователей (первое касание)
+	Trials        int      `json:"trials"`         // Из них взяли пробный период
+	Payers        int      `json:"payers"`         // Из них оплатили
+	Revenue30     float64  `json:"revenue_30"`     // Выручка за 30 дней после привлечения
+	Revenue90     float64  `json:"revenue_90"`     // Выручка за 90 дней после привлечения
+	RevenueTotal  float64  `json:"revenue_total"`  // Выручка за все время
+	RevenueFailed bool     `json:"revenue_failed"` // Выручку не удалось посчитать
+}
+
+// CampaignUser представляет привлеченного кампанией пользователя (для выгрузки)
+type CampaignUser struct {
+	TelegramID     int64      `json:"telegram_id"`
+	Username       string     `json:"username"`
+	AttributedAt   time.Time  `json:"attributed_at"`
+	HasUsedTrial   bool       `json:"has_used_trial"`
+	FirstPaymentAt *time.Time `json:"first_payment_at"`
+	Revenue30      float64    `json:"revenue_30"`
+	Revenue90      float64    `json:"revenue_90"`
+	RevenueTotal   float64    `json:"revenue_total"`
+}
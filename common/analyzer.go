@@ -6,6 +6,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -32,6 +33,36 @@ type LogAnalyzer struct {
 	LastReadPos int64 // Позиция последнего прочитанного байта
 }
 
+// ipStatsCacheTTL как долго переиспользуется разбор накопленного лога подключений
+const ipStatsCacheTTL = 5 * time.Minute
+
+// ipStatsCache последний разбор накопленного лога для проверок, которым не нужны свежайшие данные
+var ipStatsCache struct {
+	sync.Mutex
+	stats    map[string]*EmailIPStats
+	loadedAt time.Time
+}
+
+// GetCachedIPStats возвращает статистику IP по email из накопленного лога, разбирая файл не чаще раза в ipStatsCacheTTL.
+// Результат общий для всех вызывающих - изменять его нельзя.
+func GetCachedIPStats() (map[string]*EmailIPStats, error) {
+	ipStatsCache.Lock()
+	defer ipStatsCache.Unlock()
+
+	if ipStatsCache.stats != nil && time.Since(ipStatsCache.loadedAt) < ipStatsCacheTTL {
+		return ipStatsCache.stats, nil
+	}
+
+	stats, err := NewLogAnalyzer(IP_ACCUMULATED_PATH).AnalyzeLog()
+	if err != nil {
+		return nil, err
+	}
+
+	ipStatsCache.stats = stats
+	ipStatsCache.loadedAt = time.Now()
+	return stats, nil
+}
+
 // NewLogAnalyzer создает новый анализатор логов
 func NewLogAnalyzer(logPath string) *LogAnalyzer {
 	return &LogAnalyzer{
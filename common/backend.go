@@ -0,0 +1,126 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Типы панелей серверов (Server.Backend)
+const (
+	BackendXUI     = "3x-ui"
+	BackendMarzban = "marzban"
+	BackendXray    = "xray"
+)
+
+// BackendUsage трафик и срок клиента в панели
+type BackendUsage struct {
+	Upload     int64 // Байты
+	Download   int64 // Байты
+	Total      int64 // Лимит в байтах, 0 - без ограничения
+	ExpiryTime int64 // Unix миллисекунды, 0 - бессрочно
+	Enabled    bool
+}
+
+// BackendClient дополнительный клиент панели без своего пользователя бота (место семейного тарифа).
+// Клиент определяется email, ключ и подписка задаются вызывающим кодом.
+type BackendClient struct {
+	Email      string
+	UUID       string
+	SubID      string // Панель может заменить своим токеном подписки
+	ExpiryTime int64  // Unix миллисекунды
+	Enabled    bool
+	Removed    bool // Клиента нужно удалить из панели
+}
+
+// VPNBackend операции с клиентом пользователя в панели сервера.
+// Методы обновляют ClientID, SubID, Email, ExpiryTime и HasActiveConfig пользователя,
+// сохранение пользователя в базе остается за вызывающим кодом.
+type VPNBackend interface {
+	// CreateUser создает клиента (или перезаписывает существующего) на days дней с лимитом трафика (0 - без лимита)
+	CreateUser(user *User, days int, trafficGB int) error
+	// Extend продлевает клиента на days дней от текущего срока, истекшего - от текущего момента
+	Extend(user *User, days int) error
+	// Enable включает клиента
+	Enable(user *User) error
+	// Disable отключает клиента
+	Disable(user *User) error
+	// Suspend временно отключает клиента без изменения срока (превышен лимит трафика), включается через Enable
+	Suspend(user *User) error
+	// AddTraffic увеличивает лимит трафика клиента на trafficGB, клиент без лимита не меняется
+	AddTraffic(user *User, trafficGB int) error
+	// RotateKey выдает клиенту новый ключ и возвращает его; старые подключения перестают работать
+	RotateKey(user *User) (string, error)
+	// GetUsage возвращает трафик и срок клиента
+	GetUsage(user *User) (*BackendUsage, error)
+	// Delete удаляет клиента из панели
+	Delete(user *User) error
+	// SubscriptionURL возвращает ссылку на подписку панели
+	SubscriptionURL(user *User) string
+	// ApplyClients приводит дополнительных клиентов в панели к переданному состоянию
+	ApplyClients(clients []*BackendClient) error
+}
+
+// BackendType возвращает тип панели сервера
+func (s *Server) BackendType() string {
+	switch {
+	case strings.EqualFold(s.Backend, BackendMarzban):
+		return BackendMarzban
+	case strings.EqualFold(s.Backend, BackendXray):
+		return BackendXray
+	}
+	return BackendXUI
+}
+
+// NewBackend возвращает реализацию панели сервера
+func NewBackend(server *Server) VPNBackend {
+	switch server.BackendType() {
+	case BackendMarzban:
+		return NewMarzbanBackend(server)
+	case BackendXray:
+		return NewXrayBackend(server)
+	}
+	return NewXUIBackend(server)
+}
+
+// GetUserBackend возвращает панель сервера пользователя
+func GetUserBackend(telegramID int64) VPNBackend {
+	return NewBackend(GetUserServer(telegramID))
+}
+
+// GetUserBackendForNewClient возвращает панель, на которой создается или продлевается клиент.
+// Пользователь без активного конфига на недоступном сервере переназначается на исправный.
+func GetUserBackendForNewClient(telegramID int64) VPNBackend {
+	server := GetUserServer(telegramID)
+	if failover := failoverServerForNewClient(telegramID, server); failover != nil {
+		server = failover
+	}
+	return NewBackend(server)
+}
+
+// remainingDays возвращает оставшиеся дни действующего конфига пользователя с округлением вверх
+func remainingDays(user *User) int {
+	left := user.ExpiryTime - time.Now().UnixMilli()
+	if !user.HasActiveConfig || left <= 0 {
+		return 0
+	}
+	day := int64(24 * time.Hour / time.Millisecond)
+	return int((left + day - 1) / day)
+}
+
+// recreateClientOnBackend создает клиента на сервере с оставшимся сроком пользователя.
+// Используется при переносе между панелями разных типов, где клиента нельзя скопировать как есть.
+func recreateClientOnBackend(user *User, target *Server) error {
+	days := remainingDays(user)
+	if days == 0 {
+		return nil
+	}
+
+	if err := NewBackend(target).CreateUser(user, days, 0); err != nil {
+		return fmt.Errorf("ошибка создания клиента на сервере %s: %v", target.ID, err)
+	}
+	if err := UpdateUser(user); err != nil {
+		return fmt.Errorf("ошибка обновления пользователя: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Статусы пользователя Marzban
+const (
+	marzbanStatusActive   = "active"
+	marzbanStatusDisabled = "disabled"
+)
+
+// MarzbanBackend пользователи панели Marzban через REST API.
+// PanelURL - адрес панели со слешем на конце, PanelUser и PanelPass - администратор Marzban.
+type MarzbanBackend struct {
+	server *Server
+	token  string
+}
+
+// marzbanProxy настройки протокола пользователя Marzban
+type marzbanProxy struct {
+	ID   string `json:"id,omitempty"`
+	Flow string `json:"flow,omitempty"`
+}
+
+// marzbanUser пользователь в ответах API Marzban
+type marzbanUser struct {
+	Username        string                  `json:"username"`
+	Status          string                  `json:"status"`
+	Expire          int64                   `json:"expire"`     // Unix секунды, 0 - бессрочно
+	DataLimit       int64                   `json:"data_limit"` // Байты, 0 - без лимита
+	UsedTraffic     int64                   `json:"used_traffic"`
+	Proxies         map[string]marzbanProxy `json:"proxies"`
+	SubscriptionURL string                  `json:"subscription_url"`
+}
+
+// marzbanUserRequest тело создания и изменения пользователя. Пустые поля не меняются.
+type marzbanUserRequest struct {
+	Username  string                  `json:"username,omitempty"`
+	Status    string                  `json:"status,omitempty"`
+	Expire    *int64                  `json:"expire,omitempty"`
+	DataLimit *int64                  `json:"data_limit,omitempty"`
+	Proxies   map[string]marzbanProxy `json:"proxies,omitempty"`
+}
+
+// MarzbanAPIError неуспешный ответ API Marzban
+type MarzbanAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *MarzbanAPIError) Error() string {
+	return fmt.Sprintf("некорректный статус ответа Marzban: %d, body=%s", e.StatusCode, e.Body)
+}
+
+// isMarzbanStatus проверяет код ответа в ошибке API Marzban
+func isMarzbanStatus(err error, statusCode int) bool {
+	apiErr, ok := err.(*MarzbanAPIError)
+	return ok && apiErr.StatusCode == statusCode
+}
+
+// NewMarzbanBackend создает панель Marzban для сервера
+func NewMarzbanBackend(server *Server) *MarzbanBackend {
+	return &MarzbanBackend{server: server}
+}
+
+// marzbanUsername имя пользователя Marzban для Telegram ID
+func marzbanUsername(telegramID int64) string {
+	return fmt.Sprintf("tg_%d", telegramID)
+}
+
+// CreateUser создает пользователя на days дней, существующий пользователь перезаписывается
+func (b *MarzbanBackend) CreateUser(user *User, days int, trafficGB int) error {
+	expire := time.Now().Add(time.Duration(days) * 24 * time.Hour).Unix()
+	dataLimit := int64(trafficGB) * 1024 * 1024 * 1024
+
+	request := marzbanUserRequest{
+		Username:  marzbanUsername(user.TelegramID),
+		Status:    marzbanStatusActive,
+		Expire:    &expire,
+		DataLimit: &dataLimit,
+		Proxies:   map[string]marzbanProxy{"vless": {Flow: "xtls-rprx-vision"}},
+	}
+
+	var created marzbanUser
+	err := b.do("POST", "api/user", request, &created)
+	if isMarzbanStatus(err, http.StatusConflict) {
+		log.Printf("MARZBAN_BACKEND: Пользователь %s уже существует на сервере %s, обновляем", request.Username, b.server.ID)
+		request.Username = ""
+		request.Proxies = nil
+		err = b.do("PUT", "api/user/"+marzbanUsername(user.TelegramID), request, &created)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка создания пользователя Marzban: %v", err)
+	}
+
+	b.applyUser(user, &created)
+	user.ConfigCreatedAt = time.Now()
+	user.ConfigsCount++
+	return nil
+}
+
+// Extend продлевает пользователя от текущего срока (истекшего - от текущего момента) и снимает лимит трафика
+func (b *MarzbanBackend) Extend(user *User, days int) error {
+	current, err := b.getUser(user.TelegramID)
+	if isMarzbanStatus(err, http.StatusNotFound) {
+		return b.CreateUser(user, days, 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	base := time.Now().Unix()
+	if current.Expire > base {
+		base = current.Expire
+	}
+	expire := base + int64(days)*24*60*60
+	var noLimit int64
+
+	var updated marzbanUser
+	request := marzbanUserRequest{Status: marzbanStatusActive, Expire: &expire, DataLimit: &noLimit}
+	if err := b.do("PUT", "api/user/"+marzbanUsername(user.TelegramID), request, &updated); err != nil {
+		return fmt.Errorf("ошибка продления пользователя Marzban: %v", err)
+	}
+
+	b.applyUser(user, &updated)
+	user.ConfigsCount++
+	return nil
+}
+
+// Enable включает пользователя
+func (b *MarzbanBackend) Enable(user *User) error {
+	return b.setStatus(user, marzbanStatusActive)
+}
+
+// Disable отключает пользователя. Отсутствие пользователя в панели не ошибка.
+func (b *MarzbanBackend) Disable(user *User) error {
+	err := b.setStatus(user, marzbanStatusDisabled)
+	if isMarzbanStatus(err, http.StatusNotFound) {
+		log.Printf("MARZBAN_BACKEND: Пользователь %s не найден на сервере %s", marzbanUsername(user.TelegramID), b.server.ID)
+		return nil
+	}
+	return err
+}
+
+// Suspend отключает пользователя, срок в Marzban не меняется
+func (b *MarzbanBackend) Suspend(user *User) error {
+	return b.setStatus(user, marzbanStatusDisabled)
+}
+
+// AddTraffic увеличивает data_limit пользователя, пользователь без лимита не меняется
+func (b *MarzbanBackend) AddTraffic(user *User, trafficGB int) error {
+	current, err := b.getUser(user.TelegramID)
+	if err != nil {
+		return err
+	}
+	if current.DataLimit <= 0 {
+		return nil
+	}
+
+	dataLimit := current.DataLimit + int64(trafficGB)*1024*1024*1024
+	var updated marzbanUser
+	request := marzbanUserRequest{DataLimit: &dataLimit}
+	if err := b.do("PUT", "api/user/"+marzbanUsername(user.TelegramID), request, &updated); err != nil {
+		return fmt.Errorf("ошибка увеличения лимита трафика пользователя Marzban: %v", err)
+	}
+
+	b.applyUser(user, &updated)
+	return nil
+}
+
+// RotateKey выдает пользователю новый UUID vless
+func (b *MarzbanBackend) RotateKey(user *User) (string, error) {
+	current, err := b.getUser(user.TelegramID)
+	if err != nil {
+		return "", err
+	}
+
+	newID := uuid.New().String()
+	proxy := current.Proxies["vless"]
+	proxy.ID = newID
+
+	var updated marzbanUser
+	request := marzbanUserRequest{Proxies: map[string]marzbanProxy{"vless": proxy}}
+	if err := b.do("PUT", "api/user/"+marzbanUsername(user.TelegramID), request, &updated); err != nil {
+		return "", fmt.Errorf("ошибка смены ключа пользователя Marzban: %v", err)
+	}
+
+	b.applyUser(user, &updated)
+	return newID, nil
+}
+
+// GetUsage возвращает трафик пользователя. Marzban не разделяет входящий и исходящий трафик,
+// весь трафик возвращается в Download.
+func (b *MarzbanBackend) GetUsage(user *User) (*BackendUsage, error) {
+	current, err := b.getUser(user.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackendUsage{
+		Download:   current.UsedTraffic,
+		Total:      current.DataLimit,
+		ExpiryTime: current.Expire * 1000,
+		Enabled:    current.Status == marzbanStatusActive,
+	}, nil
+}
+
+// Delete удаляет пользователя из панели
+func (b *MarzbanBackend) Delete(user *User) error {
+	err := b.do("DELETE", "api/user/"+marzbanUsername(user.TelegramID), nil, nil)
+	if err != nil && !isMarzbanStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("ошибка удаления пользователя Marzban: %v", err)
+	}
+	return nil
+}
+
+// SubscriptionURL возвращает ссылку на подписку Marzban: SubURL сервера или /sub/ панели
+func (b *MarzbanBackend) SubscriptionURL(user *User) string {
+	if b.server.SubURL != "" {
+		return b.server.SubURL + user.SubID
+	}
+	return b.server.PanelURL + "sub/" + user.SubID
+}
+
+// ApplyClients создает, обновляет или удаляет дополнительных пользователей Marzban с именем, равным email клиента.
+// SubID клиента заменяется токеном подписки Marzban.
+func (b *MarzbanBackend) ApplyClients(clients []*BackendClient) error {
+	for _, client := range clients {
+		if err := b.applyClient(client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyClient приводит дополнительного пользователя Marzban к состоянию клиента
+func (b *MarzbanBackend) applyClient(client *BackendClient) error {
+	path := "api/user/" + client.Email
+	if client.Removed {
+		err := b.do("DELETE", path, nil, nil)
+		if err != nil && !isMarzbanStatus(err, http.StatusNotFound) {
+			return fmt.Errorf("ошибка удаления пользователя Marzban %s: %v", client.Email, err)
+		}
+		return nil
+	}
+
+	status := marzbanStatusActive
+	if !client.Enabled {
+		status = marzbanStatusDisabled
+	}
+	expire := client.ExpiryTime / 1000
+	var noLimit int64
+	request := marzbanUserRequest{
+		Status:    status,
+		Expire:    &expire,
+		DataLimit: &noLimit,
+		Proxies:   map[string]marzbanProxy{"vless": {ID: client.UUID, Flow: "xtls-rprx-vision"}},
+	}
+
+	var updated marzbanUser
+	created := false
+	err := b.do("PUT", path, request, &updated)
+	if isMarzbanStatus(err, http.StatusNotFound) {
+		request.Username = client.Email
+		err = b.do("POST", "api/user", request, &updated)
+		created = true
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения пользователя Marzban %s: %v", client.Email, err)
+	}
+
+	// Новый SubID у существующего клиента (место освобождено) - прежняя подписка Marzban отзывается
+	if !created && marzbanSubscriptionToken(updated.SubscriptionURL) != client.SubID {
+		if err := b.do("POST", path+"/revoke_sub", nil, &updated); err != nil {
+			return fmt.Errorf("ошибка отзыва подписки пользователя Marzban %s: %v", client.Email, err)
+		}
+	}
+
+	if token := marzbanSubscriptionToken(updated.SubscriptionURL); token != "" {
+		client.SubID = token
+	}
+	return nil
+}
+
+// ping проверяет доступность API панели авторизацией администратора
+func (b *MarzbanBackend) ping() error {
+	b.token = ""
+	return b.authorize()
+}
+
+// getUser возвращает пользователя Marzban
+func (b *MarzbanBackend) getUser(telegramID int64) (*marzbanUser, error) {
+	var user marzbanUser
+	if err := b.do("GET", "api/user/"+marzbanUsername(telegramID), nil, &user); err != nil {
+		if isMarzbanStatus(err, http.StatusNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ошибка получения пользователя Marzban: %v", err)
+	}
+	return &user, nil
+}
+
+// setStatus меняет статус пользователя
+func (b *MarzbanBackend) setStatus(user *User, status string) error {
+	var updated marzbanUser
+	if err := b.do("PUT", "api/user/"+marzbanUsername(user.TelegramID), marzbanUserRequest{Status: status}, &updated); err != nil {
+		if isMarzbanStatus(err, http.StatusNotFound) {
+			return err
+		}
+		return fmt.Errorf("ошибка изменения статуса пользователя Marzban: %v", err)
+	}
+
+	b.applyUser(user, &updated)
+	return nil
+}
+
+// applyUser переносит ключ, подписку и срок пользователя Marzban в пользователя бота
+func (b *MarzbanBackend) applyUser(user *User, marzban *marzbanUser) {
+	user.Email = marzban.Username
+	user.ClientID = marzban.Proxies["vless"].ID
+	user.ExpiryTime = marzban.Expire * 1000
+	user.HasActiveConfig = marzban.Status == marzbanStatusActive
+
+	if token := marzbanSubscriptionToken(marzban.SubscriptionURL); token != "" {
+		user.SubID = token
+	}
+}
+
+// marzbanSubscriptionToken возвращает токен подписки Marzban.
+// subscription_url бывает относительным (/sub/<token>) или полным - токен в последнем сегменте.
+func marzbanSubscriptionToken(subscriptionURL string) string {
+	subURL := strings.TrimRight(subscriptionURL, "/")
+	if subURL == "" {
+		return ""
+	}
+	return subURL[strings.LastIndex(subURL, "/")+1:]
+}
+
+// authorize получает токен администратора Marzban
+func (b *MarzbanBackend) authorize() error {
+	if b.token != "" {
+		return nil
+	}
+
+	form := url.Values{}
+	form.Set("username", b.server.PanelUser)
+	form.Set("password", b.server.PanelPass)
+
+	resp, err := httpClient.Post(b.server.PanelURL+"api/admin/token", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("ошибка авторизации в Marzban: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения ответа Marzban: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("авторизация в Marzban не удалась: %v", &MarzbanAPIError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil || tokenResp.AccessToken == "" {
+		return fmt.Errorf("токен Marzban не получен, body=%s", string(body))
+	}
+
+	b.token = tokenResp.AccessToken
+	return nil
+}
+
+// do выполняет запрос к API Marzban с токеном администратора
+func (b *MarzbanBackend) do(method, path string, body interface{}, out interface{}) error {
+	if err := b.authorize(); err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("ошибка сериализации запроса: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, b.server.PanelURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка выполнения запроса: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения ответа: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &MarzbanAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("ошибка десериализации ответа: %v, body=%s", err, string(respBody))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,567 @@
+package common
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakeXUIPanel панель 3x-ui с одним inbound'ом, хранящая клиентов в памяти
+type fakeXUIPanel struct {
+	mu      sync.Mutex
+	inbound Inbound
+}
+
+func newFakeXUIPanel(t *testing.T) *httptest.Server {
+	panel := &fakeXUIPanel{inbound: Inbound{ID: 1, Enable: true, Protocol: "vless", Port: 443, Settings: `{"clients":[]}`}}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		panel.mu.Lock()
+		defer panel.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("Set-Cookie", "3x-ui=fake_session; Path=/; HttpOnly")
+			json.NewEncoder(w).Encode(LoginResponse{Success: true})
+		case "/panel/api/inbounds/get/1":
+			// Трафик каждого клиента: 100 байт отдано, 200 получено
+			var settings Settings
+			json.Unmarshal([]byte(panel.inbound.Settings), &settings)
+			var stats []TrafficStats
+			for _, client := range settings.Clients {
+				stats = append(stats, TrafficStats{InboundID: 1, Email: client.Email, Up: 100, Down: 200})
+			}
+			inbound := panel.inbound
+			inbound.ClientStats = stats
+			json.NewEncoder(w).Encode(InboundInfo{Success: true, Obj: inbound})
+		case "/panel/api/inbounds/update/1":
+			var inbound Inbound
+			if err := json.NewDecoder(r.Body).Decode(&inbound); err != nil {
+				t.Errorf("Некорректное тело обновления inbound: %v", err)
+			}
+			panel.inbound.Settings = inbound.Settings
+			json.NewEncoder(w).Encode(APIResponse{Success: true})
+		default:
+			t.Errorf("Неожиданный запрос к панели 3x-ui: %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// newFakeMarzban панель Marzban с пользователями в памяти
+func newFakeMarzban(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	users := map[string]*marzbanUser{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/api/admin/token" {
+			if r.FormValue("username") != "admin" || r.FormValue("password") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "fake_token", "token_type": "bearer"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer fake_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var request marzbanUserRequest
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&request)
+		}
+
+		if r.URL.Path == "/api/user" && r.Method == "POST" {
+			if _, exists := users[request.Username]; exists {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			proxy := request.Proxies["vless"]
+			proxy.ID = "11111111-2222-3333-4444-555555555555"
+			user := &marzbanUser{
+				Username:        request.Username,
+				Status:          request.Status,
+				Expire:          *request.Expire,
+				DataLimit:       *request.DataLimit,
+				UsedTraffic:     300,
+				Proxies:         map[string]marzbanProxy{"vless": proxy},
+				SubscriptionURL: "/sub/token_" + request.Username,
+			}
+			users[user.Username] = user
+			json.NewEncoder(w).Encode(user)
+			return
+		}
+
+		username := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/user/"), "/revoke_sub")
+		user, exists := users[username]
+		if !strings.HasPrefix(r.URL.Path, "/api/user/") || !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+		case "POST":
+			if strings.HasSuffix(r.URL.Path, "/revoke_sub") {
+				user.SubscriptionURL = "/sub/revoked_" + username
+			}
+		case "PUT":
+			if request.Status != "" {
+				user.Status = request.Status
+			}
+			if request.Expire != nil {
+				user.Expire = *request.Expire
+			}
+			if request.DataLimit != nil {
+				user.DataLimit = *request.DataLimit
+			}
+			if request.Proxies != nil {
+				user.Proxies = request.Proxies
+			}
+		case "DELETE":
+			delete(users, username)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
+	}))
+}
+
+// checkBackendLifecycle проводит клиента через все операции панели
+func checkBackendLifecycle(t *testing.T, backend VPNBackend) {
+	t.Helper()
+	user := &User{TelegramID: 42}
+	const gb = 1024 * 1024 * 1024
+
+	if err := backend.CreateUser(user, 3, 10); err != nil {
+		t.Fatalf("CreateUser() вернул ошибку: %v", err)
+	}
+	if !user.HasActiveConfig || user.ClientID == "" || user.SubID == "" {
+		t.Fatalf("После CreateUser: HasActiveConfig=%v, ClientID=%q, SubID=%q", user.HasActiveConfig, user.ClientID, user.SubID)
+	}
+
+	usage, err := backend.GetUsage(user)
+	if err != nil {
+		t.Fatalf("GetUsage() вернул ошибку: %v", err)
+	}
+	if usage.Total != 10*gb || usage.Upload+usage.Download != 300 || !usage.Enabled {
+		t.Errorf("GetUsage() после создания = %+v", usage)
+	}
+	createdExpiry := usage.ExpiryTime
+	if left := time.Until(time.UnixMilli(createdExpiry)); left < 71*time.Hour || left > 73*time.Hour {
+		t.Errorf("Срок после CreateUser через %v, ожидалось 3 дня", left)
+	}
+
+	if err := backend.AddTraffic(user, 5); err != nil {
+		t.Fatalf("AddTraffic() вернул ошибку: %v", err)
+	}
+	if usage, err = backend.GetUsage(user); err != nil || usage.Total != 15*gb {
+		t.Errorf("После AddTraffic(5): usage=%+v, err=%v", usage, err)
+	}
+
+	if err := backend.Extend(user, 30); err != nil {
+		t.Fatalf("Extend() вернул ошибку: %v", err)
+	}
+	usage, err = backend.GetUsage(user)
+	if err != nil {
+		t.Fatalf("GetUsage() вернул ошибку: %v", err)
+	}
+	if added := time.Duration(usage.ExpiryTime-createdExpiry) * time.Millisecond; added < 29*24*time.Hour || added > 31*24*time.Hour {
+		t.Errorf("Extend(30) продлил срок на %v", added)
+	}
+	if user.ExpiryTime != usage.ExpiryTime {
+		t.Errorf("ExpiryTime пользователя %d, в панели %d", user.ExpiryTime, usage.ExpiryTime)
+	}
+
+	if err := backend.Suspend(user); err != nil {
+		t.Fatalf("Suspend() вернул ошибку: %v", err)
+	}
+	if usage, err = backend.GetUsage(user); err != nil || usage.Enabled || usage.ExpiryTime != user.ExpiryTime {
+		t.Errorf("После Suspend: usage=%+v, err=%v, срок пользователя %d", usage, err, user.ExpiryTime)
+	}
+	if err := backend.Enable(user); err != nil {
+		t.Fatalf("Enable() вернул ошибку: %v", err)
+	}
+
+	if err := backend.Disable(user); err != nil {
+		t.Fatalf("Disable() вернул ошибку: %v", err)
+	}
+	if usage, err = backend.GetUsage(user); err != nil || usage.Enabled {
+		t.Errorf("После Disable: usage=%+v, err=%v", usage, err)
+	}
+
+	if err := backend.Enable(user); err != nil {
+		t.Fatalf("Enable() вернул ошибку: %v", err)
+	}
+	if usage, err = backend.GetUsage(user); err != nil || !usage.Enabled {
+		t.Errorf("После Enable: usage=%+v, err=%v", usage, err)
+	}
+
+	oldKey := user.ClientID
+	newKey, err := backend.RotateKey(user)
+	if err != nil {
+		t.Fatalf("RotateKey() вернул ошибку: %v", err)
+	}
+	if newKey == "" || newKey == oldKey || user.ClientID != newKey {
+		t.Errorf("RotateKey(): старый %q, новый %q, у пользователя %q", oldKey, newKey, user.ClientID)
+	}
+
+	if url := backend.SubscriptionURL(user); !strings.HasSuffix(url, user.SubID) {
+		t.Errorf("SubscriptionURL() = %s, ожидался SubID %s в конце", url, user.SubID)
+	}
+
+	if err := backend.Delete(user); err != nil {
+		t.Fatalf("Delete() вернул ошибку: %v", err)
+	}
+	if _, err := backend.GetUsage(user); err == nil {
+		t.Error("GetUsage() после Delete должен вернуть ошибку")
+	}
+	if err := backend.Delete(user); err != nil {
+		t.Errorf("Повторный Delete() вернул ошибку: %v", err)
+	}
+	if err := backend.Disable(user); err != nil {
+		t.Errorf("Disable() удаленного клиента вернул ошибку: %v", err)
+	}
+}
+
+// TestXUIBackend проверяет операции с клиентом через фейковую панель 3x-ui
+func TestXUIBackend(t *testing.T) {
+	panel := newFakeXUIPanel(t)
+	defer panel.Close()
+
+	server := &Server{ID: "xui", PanelURL: panel.URL + "/", InboundIDs: []int{1}, SubURL: "https://xui.example.com/sub/"}
+	if _, ok := NewBackend(server).(*XUIBackend); !ok {
+		t.Fatalf("Сервер без Backend должен использовать панель 3x-ui")
+	}
+	checkBackendLifecycle(t, NewBackend(server))
+}
+
+// TestMarzbanBackend проверяет операции с пользователем через фейковый API Marzban
+func TestMarzbanBackend(t *testing.T) {
+	panel := newFakeMarzban(t)
+	defer panel.Close()
+
+	server := &Server{ID: "mz", Backend: "Marzban", PanelURL: panel.URL + "/", PanelUser: "admin", PanelPass: "secret"}
+	backend, ok := NewBackend(server).(*MarzbanBackend)
+	if !ok {
+		t.Fatalf("Сервер с Backend=marzban должен использовать панель Marzban")
+	}
+	checkBackendLifecycle(t, backend)
+
+	// Повторное создание перезаписывает существующего пользователя
+	user := &User{TelegramID: 7}
+	if err := backend.CreateUser(user, 1, 0); err != nil {
+		t.Fatalf("CreateUser() вернул ошибку: %v", err)
+	}
+	if err := backend.CreateUser(user, 5, 0); err != nil {
+		t.Fatalf("Повторный CreateUser() вернул ошибку: %v", err)
+	}
+	if user.Email != "tg_7" || user.SubID != "token_tg_7" {
+		t.Errorf("Пользователь Marzban: Email=%q, SubID=%q", user.Email, user.SubID)
+	}
+	if url := backend.SubscriptionURL(user); url != panel.URL+"/sub/token_tg_7" {
+		t.Errorf("SubscriptionURL() = %s", url)
+	}
+
+	wrongPass := NewMarzbanBackend(&Server{ID: "mz", PanelURL: panel.URL + "/", PanelUser: "admin", PanelPass: "wrong"})
+	if err := wrongPass.ping(); err == nil {
+		t.Error("ping() с неверным паролем должен вернуть ошибку")
+	}
+}
+
+// TestXUIBackendApplyClients проверяет дополнительных клиентов inbound'а 3x-ui
+func TestXUIBackendApplyClients(t *testing.T) {
+	panel := newFakeXUIPanel(t)
+	defer panel.Close()
+
+	server := &Server{ID: "xui", PanelURL: panel.URL + "/", InboundIDs: []int{1}}
+	backend := NewBackend(server)
+	expiry := time.Now().Add(24 * time.Hour).UnixMilli()
+
+	findClient := func(email string) *Client {
+		t.Helper()
+		sessionCookie, err := LoginServer(server)
+		if err != nil {
+			t.Fatalf("LoginServer() вернул ошибку: %v", err)
+		}
+		_, settings, err := getInboundSettings(sessionCookie)
+		if err != nil {
+			t.Fatalf("getInboundSettings() вернул ошибку: %v", err)
+		}
+		for i := range settings.Clients {
+			if settings.Clients[i].Email == email {
+				return &settings.Clients[i]
+			}
+		}
+		return nil
+	}
+
+	seat := &BackendClient{Email: "seat42-1", UUID: "aaaaaaaa-0000-0000-0000-000000000001", SubID: "sub1", ExpiryTime: expiry, Enabled: true}
+	other := &BackendClient{Email: "seat42-2", UUID: "aaaaaaaa-0000-0000-0000-000000000002", SubID: "sub2", ExpiryTime: expiry, Enabled: true}
+	if err := backend.ApplyClients([]*BackendClient{seat, other}); err != nil {
+		t.Fatalf("ApplyClients() вернул ошибку: %v", err)
+	}
+	if client := findClient("seat42-1"); client == nil || !client.Enable || client.ExpiryTime != expiry || client.SubID != "sub1" {
+		t.Fatalf("Клиент места после создания: %+v", client)
+	}
+
+	seat.Enabled = false
+	other.Removed = true
+	if err := backend.ApplyClients([]*BackendClient{seat, other}); err != nil {
+		t.Fatalf("ApplyClients() вернул ошибку: %v", err)
+	}
+	if client := findClient("seat42-1"); client == nil || client.Enable {
+		t.Errorf("Клиент приостановленного места: %+v", client)
+	}
+	if client := findClient("seat42-2"); client != nil {
+		t.Errorf("Клиент удаленного места остался в панели: %+v", client)
+	}
+}
+
+// TestMarzbanBackendApplyClients проверяет дополнительных пользователей Marzban
+func TestMarzbanBackendApplyClients(t *testing.T) {
+	panel := newFakeMarzban(t)
+	defer panel.Close()
+
+	backend := NewMarzbanBackend(&Server{ID: "mz_clients", PanelURL: panel.URL + "/", PanelUser: "admin", PanelPass: "secret"})
+	seat := &BackendClient{Email: "seat42-1", UUID: "aaaaaaaa-0000-0000-0000-000000000001", SubID: "sub1",
+		ExpiryTime: time.Now().Add(24 * time.Hour).UnixMilli(), Enabled: true}
+
+	if err := backend.ApplyClients([]*BackendClient{seat}); err != nil {
+		t.Fatalf("ApplyClients() вернул ошибку: %v", err)
+	}
+	if seat.SubID != "token_seat42-1" {
+		t.Errorf("SubID места %q, ожидался токен подписки Marzban", seat.SubID)
+	}
+
+	// Повторное применение без изменений не отзывает подписку
+	if err := backend.ApplyClients([]*BackendClient{seat}); err != nil || seat.SubID != "token_seat42-1" {
+		t.Errorf("Повторный ApplyClients(): SubID=%q, err=%v", seat.SubID, err)
+	}
+
+	// Новый SubID (место освобождено) отзывает прежнюю подписку
+	seat.SubID = "new_sub"
+	if err := backend.ApplyClients([]*BackendClient{seat}); err != nil || seat.SubID != "revoked_seat42-1" {
+		t.Errorf("ApplyClients() с новым SubID: SubID=%q, err=%v", seat.SubID, err)
+	}
+
+	seat.Removed = true
+	if err := backend.ApplyClients([]*BackendClient{seat}); err != nil {
+		t.Fatalf("ApplyClients() удаления вернул ошибку: %v", err)
+	}
+	if err := backend.do("GET", "api/user/seat42-1", nil, nil); !isMarzbanStatus(err, http.StatusNotFound) {
+		t.Errorf("Пользователь удаленного места остался в Marzban: %v", err)
+	}
+}
+
+// fakeXray gRPC API Xray-core с пользователями inbound'ов и счетчиками трафика в памяти
+type fakeXray struct {
+	mu      sync.Mutex
+	users   map[string]string // email -> "tag/uuid/flow"
+	traffic map[string]XrayTraffic
+}
+
+// handle разбирает вызовы HandlerService и StatsService так же, как Xray
+func (x *fakeXray) handle(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	var request []byte
+	if err := stream.RecvMsg(&request); err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var response []byte
+	switch method {
+	case xrayAlterInboundMethod:
+		// AlterInboundRequest{tag = 1, operation = TypedMessage{type = 1, value = 2}}
+		var tag, operationType string
+		var operation []byte
+		rangeFields(request, func(field protowire.Number, value []byte, _ uint64) error {
+			if field == 1 {
+				tag = string(value)
+			}
+			if field == 2 {
+				rangeFields(value, func(field protowire.Number, value []byte, _ uint64) error {
+					if field == 1 {
+						operationType = string(value)
+					} else {
+						operation = value
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+
+		switch operationType {
+		case xrayAddUserType:
+			var email, account string
+			rangeFields(operation, func(_ protowire.Number, user []byte, _ uint64) error {
+				return rangeFields(user, func(field protowire.Number, value []byte, _ uint64) error {
+					if field == 2 {
+						email = string(value)
+					}
+					if field == 3 {
+						// TypedMessage с xray.proxy.vless.Account{id = 1, flow = 2}
+						rangeFields(value, func(field protowire.Number, value []byte, _ uint64) error {
+							if field == 2 {
+								var id, flow string
+								rangeFields(value, func(field protowire.Number, value []byte, _ uint64) error {
+									switch field {
+									case 1:
+										id = string(value)
+									case 2:
+										flow = string(value)
+									}
+									return nil
+								})
+								account = id + "/" + flow
+							}
+							return nil
+						})
+					}
+					return nil
+				})
+			})
+			if _, exists := x.users[email]; exists {
+				return status.Errorf(codes.Unknown, "proxy/vless: User %s already exists.", email)
+			}
+			x.users[email] = tag + "/" + account
+		case xrayRemoveUserType:
+			var email string
+			rangeFields(operation, func(_ protowire.Number, value []byte, _ uint64) error {
+				email = string(value)
+				return nil
+			})
+			if _, exists := x.users[email]; !exists {
+				return status.Errorf(codes.Unknown, "proxy/vless: User %s not found.", email)
+			}
+			delete(x.users, email)
+		default:
+			return status.Errorf(codes.InvalidArgument, "unknown operation %s", operationType)
+		}
+	case xrayQueryStatsMethod:
+		reset := false
+		rangeFields(request, func(field protowire.Number, _ []byte, varint uint64) error {
+			reset = reset || (field == 2 && varint == 1)
+			return nil
+		})
+		for email, item := range x.traffic {
+			for direction, value := range map[string]int64{"uplink": item.Uplink, "downlink": item.Downlink} {
+				var stat []byte
+				stat = appendString(stat, 1, "user>>>"+email+">>>traffic>>>"+direction)
+				stat = protowire.AppendTag(stat, 2, protowire.VarintType)
+				stat = protowire.AppendVarint(stat, uint64(value))
+				response = protowire.AppendTag(response, 1, protowire.BytesType)
+				response = protowire.AppendBytes(response, stat)
+			}
+		}
+		if reset {
+			x.traffic = map[string]XrayTraffic{}
+		}
+	case xraySysStatsMethod:
+		response = protowire.AppendTag(response, 10, protowire.VarintType)
+		response = protowire.AppendVarint(response, 3600)
+	default:
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+	return stream.SendMsg(response)
+}
+
+// TestXrayAPI проверяет вызовы gRPC API Xray через фейковый сервер
+func TestXrayAPI(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Ошибка запуска слушателя: %v", err)
+	}
+	xray := &fakeXray{
+		users:   map[string]string{},
+		traffic: map[string]XrayTraffic{"42": {Uplink: 100, Downlink: 200}},
+	}
+	grpcServer := grpc.NewServer(grpc.ForceServerCodec(xrayCodec{}), grpc.UnknownServiceHandler(xray.handle))
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+	address := listener.Addr().String()
+
+	originalTimeout := XRAY_API_TIMEOUT
+	XRAY_API_TIMEOUT = 2
+	defer func() { XRAY_API_TIMEOUT = originalTimeout }()
+
+	if err := XrayAddUser(address, "vless-in", "42", "b831381d-6324-4d53-ad4f-8cda48b30811", "xtls-rprx-vision"); err != nil {
+		t.Fatalf("XrayAddUser() вернул ошибку: %v", err)
+	}
+	if got := xray.users["42"]; got != "vless-in/b831381d-6324-4d53-ad4f-8cda48b30811/xtls-rprx-vision" {
+		t.Errorf("Пользователь в Xray = %q", got)
+	}
+
+	err = XrayAddUser(address, "vless-in", "42", "b831381d-6324-4d53-ad4f-8cda48b30811", "")
+	if !IsXrayUserExists(err) {
+		t.Errorf("Повторный XrayAddUser() = %v, ожидалась ошибка 'already exists'", err)
+	}
+
+	traffic, err := XrayQueryUserTraffic(address, true)
+	if err != nil {
+		t.Fatalf("XrayQueryUserTraffic() вернул ошибку: %v", err)
+	}
+	if traffic["42"] != (XrayTraffic{Uplink: 100, Downlink: 200}) {
+		t.Errorf("Трафик пользователя = %+v", traffic["42"])
+	}
+	if traffic, _ := XrayQueryUserTraffic(address, false); len(traffic) != 0 {
+		t.Errorf("Счетчики после reset не обнулены: %+v", traffic)
+	}
+
+	if uptime, err := XrayUptime(address); err != nil || uptime != time.Hour {
+		t.Errorf("XrayUptime() = %v, %v", uptime, err)
+	}
+
+	if err := XrayRemoveUser(address, "vless-in", "42"); err != nil {
+		t.Fatalf("XrayRemoveUser() вернул ошибку: %v", err)
+	}
+	if err := XrayRemoveUser(address, "vless-in", "42"); !IsXrayUserNotFound(err) {
+		t.Errorf("Повторный XrayRemoveUser() = %v, ожидалась ошибка 'not found'", err)
+	}
+
+	// Синхронизация: активный клиент добавляется, истекший удаляется
+	server := &Server{ID: "se", PanelURL: address, InboundTag: "vless-in"}
+	active := &XrayClient{Email: "1", UUID: "u1", Enabled: true, ExpiryTime: time.Now().Add(time.Hour).UnixMilli()}
+	if added, err := syncXrayClient(server, active, false); err != nil || !added {
+		t.Errorf("syncXrayClient(активный) = %v, %v", added, err)
+	}
+	if added, err := syncXrayClient(server, active, false); err != nil || added {
+		t.Errorf("syncXrayClient(уже добавлен) = %v, %v", added, err)
+	}
+	active.ExpiryTime = time.Now().Add(-time.Hour).UnixMilli()
+	if _, err := syncXrayClient(server, active, false); err != nil || xray.users["1"] != "" {
+		t.Errorf("Истекший клиент не удален: err=%v, users=%v", err, xray.users)
+	}
+
+	// Без базы трафик не сохраняется: обнуленные в Xray счетчики накапливаются до следующего сбора
+	defer delete(xrayUnsavedTraffic, server.ID)
+	xray.traffic = map[string]XrayTraffic{"1": {Uplink: 10, Downlink: 20}}
+	if err := collectXrayTraffic(server); err == nil {
+		t.Fatalf("collectXrayTraffic() без базы должен вернуть ошибку")
+	}
+	xray.traffic = map[string]XrayTraffic{"1": {Uplink: 1, Downlink: 2}}
+	collectXrayTraffic(server)
+	if got := xrayUnsavedTraffic[server.ID]["1"]; got != (XrayTraffic{Uplink: 11, Downlink: 22}) || len(xray.traffic) != 0 {
+		t.Errorf("Несохраненный трафик = %+v, счетчики Xray = %+v", got, xray.traffic)
+	}
+}
@@ -0,0 +1,533 @@
+package common
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// XrayBackend пользователи Xray-core без панели через gRPC API (HandlerService и StatsService).
+// Xray не хранит добавленных через API пользователей после перезапуска, поэтому нужное
+// состояние клиентов хранится в таблице xray_clients и заново применяется SyncXrayServer.
+type XrayBackend struct {
+	server *Server
+}
+
+// XrayClient клиент Xray в базе бота
+type XrayClient struct {
+	ServerID     string
+	TelegramID   int64
+	Email        string
+	UUID         string
+	Flow         string
+	ExpiryTime   int64 // Unix миллисекунды
+	TrafficLimit int64 // Байты, 0 - без лимита
+	Enabled      bool
+	Upload       int64 // Байты, накопленные со счетчиков Xray
+	Download     int64
+}
+
+// IsActive проверяет, должен ли клиент быть добавлен в Xray
+func (c *XrayClient) IsActive() bool {
+	if !c.Enabled {
+		return false
+	}
+	if c.ExpiryTime > 0 && c.ExpiryTime <= time.Now().UnixMilli() {
+		return false
+	}
+	return c.TrafficLimit == 0 || c.Upload+c.Download < c.TrafficLimit
+}
+
+// NewXrayBackend создает backend Xray для сервера
+func NewXrayBackend(server *Server) *XrayBackend {
+	return &XrayBackend{server: server}
+}
+
+// CreateXrayTables создает таблицу клиентов серверов Xray
+func CreateXrayTables() error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS xray_clients (
+		server_id VARCHAR(64) NOT NULL,
+		telegram_id BIGINT NOT NULL,
+		email VARCHAR(100) NOT NULL,
+		uuid VARCHAR(64) NOT NULL,
+		flow VARCHAR(32) NOT NULL DEFAULT '',
+		expiry_time BIGINT NOT NULL DEFAULT 0,
+		traffic_limit BIGINT NOT NULL DEFAULT 0,
+		enabled BOOLEAN NOT NULL DEFAULT true,
+		upload BIGINT NOT NULL DEFAULT 0,
+		download BIGINT NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (server_id, telegram_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_xray_clients_email ON xray_clients(server_id, email);`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы xray_clients: %v", err)
+	}
+
+	return nil
+}
+
+// xrayClientColumns колонки таблицы xray_clients для выборки
+const xrayClientColumns = "server_id, telegram_id, email, uuid, flow, expiry_time, traffic_limit, enabled, upload, download"
+
+// scanXrayClient читает клиента Xray из строки результата
+func scanXrayClient(row serverScanner) (*XrayClient, error) {
+	var client XrayClient
+	err := row.Scan(&client.ServerID, &client.TelegramID, &client.Email, &client.UUID, &client.Flow,
+		&client.ExpiryTime, &client.TrafficLimit, &client.Enabled, &client.Upload, &client.Download)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// GetXrayClient возвращает клиента пользователя на сервере Xray (nil - клиента нет)
+func GetXrayClient(serverID string, telegramID int64) (*XrayClient, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	client, err := scanXrayClient(db.QueryRow("SELECT "+xrayClientColumns+" FROM xray_clients WHERE server_id = $1 AND telegram_id = $2",
+		serverID, telegramID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения клиента Xray: %v", err)
+	}
+	return client, nil
+}
+
+// getXrayClients возвращает всех клиентов сервера Xray
+func getXrayClients(serverID string) ([]*XrayClient, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query("SELECT "+xrayClientColumns+" FROM xray_clients WHERE server_id = $1", serverID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения клиентов Xray: %v", err)
+	}
+	defer rows.Close()
+
+	var clients []*XrayClient
+	for rows.Next() {
+		client, err := scanXrayClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения клиента Xray: %v", err)
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// saveXrayClient сохраняет нужное состояние клиента. Накопленный трафик не перезаписывается.
+func saveXrayClient(client *XrayClient) error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO xray_clients (server_id, telegram_id, email, uuid, flow, expiry_time, traffic_limit, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (server_id, telegram_id) DO UPDATE SET email = EXCLUDED.email, uuid = EXCLUDED.uuid,
+			flow = EXCLUDED.flow, expiry_time = EXCLUDED.expiry_time, traffic_limit = EXCLUDED.traffic_limit,
+			enabled = EXCLUDED.enabled, updated_at = NOW()`,
+		client.ServerID, client.TelegramID, client.Email, client.UUID, client.Flow,
+		client.ExpiryTime, client.TrafficLimit, client.Enabled)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения клиента Xray: %v", err)
+	}
+	return nil
+}
+
+// CreateUser создает клиента на days дней с лимитом трафика. Ключ существующего клиента сохраняется.
+func (b *XrayBackend) CreateUser(user *User, days int, trafficGB int) error {
+	client, err := GetXrayClient(b.server.ID, user.TelegramID)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		client = &XrayClient{
+			ServerID:   b.server.ID,
+			TelegramID: user.TelegramID,
+			Email:      strconv.FormatInt(user.TelegramID, 10),
+			UUID:       uuid.New().String(),
+			Flow:       "xtls-rprx-vision",
+		}
+	}
+
+	client.ExpiryTime = time.Now().Add(time.Duration(days) * 24 * time.Hour).UnixMilli()
+	client.TrafficLimit = int64(trafficGB) * 1024 * 1024 * 1024
+	client.Enabled = true
+
+	if err := b.store(user, client); err != nil {
+		return fmt.Errorf("ошибка создания клиента Xray: %v", err)
+	}
+	user.ConfigCreatedAt = time.Now()
+	user.ConfigsCount++
+	return nil
+}
+
+// Extend продлевает клиента от текущего срока (истекшего - от текущего момента) и снимает лимит трафика
+func (b *XrayBackend) Extend(user *User, days int) error {
+	client, err := GetXrayClient(b.server.ID, user.TelegramID)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return b.CreateUser(user, days, 0)
+	}
+
+	base := time.Now().UnixMilli()
+	if client.ExpiryTime > base {
+		base = client.ExpiryTime
+	}
+	client.ExpiryTime = base + int64(days)*24*60*60*1000
+	client.TrafficLimit = 0
+	client.Enabled = true
+
+	if err := b.store(user, client); err != nil {
+		return fmt.Errorf("ошибка продления клиента Xray: %v", err)
+	}
+	user.ConfigsCount++
+	return nil
+}
+
+// Enable включает клиента
+func (b *XrayBackend) Enable(user *User) error {
+	client, err := b.requireClient(user)
+	if err != nil {
+		return err
+	}
+	client.Enabled = true
+	return b.store(user, client)
+}
+
+// Disable отключает клиента и завершает его срок. Отсутствие клиента не ошибка.
+func (b *XrayBackend) Disable(user *User) error {
+	client, err := GetXrayClient(b.server.ID, user.TelegramID)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		log.Printf("XRAY_BACKEND: Клиент с TelegramID=%d не найден на сервере %s", user.TelegramID, b.server.ID)
+		return nil
+	}
+
+	client.Enabled = false
+	client.ExpiryTime = time.Now().UnixMilli()
+	return b.store(user, client)
+}
+
+// Suspend отключает клиента, сохраняя срок
+func (b *XrayBackend) Suspend(user *User) error {
+	client, err := b.requireClient(user)
+	if err != nil {
+		return err
+	}
+	client.Enabled = false
+	return b.store(user, client)
+}
+
+// AddTraffic увеличивает лимит трафика клиента, клиент без лимита не меняется
+func (b *XrayBackend) AddTraffic(user *User, trafficGB int) error {
+	client, err := b.requireClient(user)
+	if err != nil {
+		return err
+	}
+	if client.TrafficLimit <= 0 {
+		return nil
+	}
+	client.TrafficLimit += int64(trafficGB) * 1024 * 1024 * 1024
+	return b.store(user, client)
+}
+
+// RotateKey выдает клиенту новый UUID
+func (b *XrayBackend) RotateKey(user *User) (string, error) {
+	client, err := b.requireClient(user)
+	if err != nil {
+		return "", err
+	}
+
+	// Старый UUID удаляется из Xray вместе с пользователем в store
+	client.UUID = uuid.New().String()
+	if err := b.store(user, client); err != nil {
+		return "", err
+	}
+	return client.UUID, nil
+}
+
+// GetUsage собирает счетчики трафика с сервера и возвращает накопленный трафик клиента
+func (b *XrayBackend) GetUsage(user *User) (*BackendUsage, error) {
+	// Недоступный Xray не мешает показать уже накопленный трафик
+	if err := collectXrayTraffic(b.server); err != nil {
+		log.Printf("XRAY_BACKEND: %v", err)
+	}
+
+	client, err := b.requireClient(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackendUsage{
+		Upload:     client.Upload,
+		Download:   client.Download,
+		Total:      client.TrafficLimit,
+		ExpiryTime: client.ExpiryTime,
+		Enabled:    client.IsActive(),
+	}, nil
+}
+
+// Delete удаляет клиента из Xray и из базы
+func (b *XrayBackend) Delete(user *User) error {
+	client, err := GetXrayClient(b.server.ID, user.TelegramID)
+	if err != nil || client == nil {
+		return err
+	}
+
+	if err := XrayRemoveUser(b.server.PanelURL, b.server.InboundTag, client.Email); err != nil && !IsXrayUserNotFound(err) {
+		return err
+	}
+
+	if _, err := GetDatabasePG().Exec("DELETE FROM xray_clients WHERE server_id = $1 AND telegram_id = $2", b.server.ID, user.TelegramID); err != nil {
+		return fmt.Errorf("ошибка удаления клиента Xray: %v", err)
+	}
+	return nil
+}
+
+// SubscriptionURL возвращает общую подписку бота: у Xray без панели своей подписки нет
+func (b *XrayBackend) SubscriptionURL(user *User) string {
+	return SUBSCRIPTION_BASE_URL + user.SubID
+}
+
+// ApplyClients не поддерживается: клиенты Xray без панели хранятся по пользователям бота,
+// а общая подписка бота отдает только их. Удалять нечего - такие клиенты не создаются.
+func (b *XrayBackend) ApplyClients(clients []*BackendClient) error {
+	for _, client := range clients {
+		if !client.Removed {
+			return fmt.Errorf("сервер %s (Xray без панели) не поддерживает дополнительных клиентов", b.server.ID)
+		}
+	}
+	return nil
+}
+
+// requireClient возвращает клиента пользователя или ошибку, если его нет
+func (b *XrayBackend) requireClient(user *User) (*XrayClient, error) {
+	client, err := GetXrayClient(b.server.ID, user.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("клиент пользователя %d не найден на сервере %s", user.TelegramID, b.server.ID)
+	}
+	return client, nil
+}
+
+// store применяет клиента к Xray, сохраняет его в базе и переносит данные в пользователя
+func (b *XrayBackend) store(user *User, client *XrayClient) error {
+	// Сначала Xray: при недоступном сервере состояние в базе не меняется
+	if err := applyXrayClient(b.server, client, true); err != nil {
+		return err
+	}
+	if err := saveXrayClient(client); err != nil {
+		return err
+	}
+
+	user.ClientID = client.UUID
+	user.Email = client.Email
+	user.ExpiryTime = client.ExpiryTime
+	user.HasActiveConfig = client.IsActive()
+	if user.SubID == "" {
+		user.SubID = GenerateSubID()
+	}
+	return nil
+}
+
+// applyXrayClient добавляет активного клиента в Xray или удаляет неактивного.
+// С replace существующий пользователь пересоздается, чтобы обновить UUID и flow.
+func applyXrayClient(server *Server, client *XrayClient, replace bool) error {
+	_, err := syncXrayClient(server, client, replace)
+	return err
+}
+
+// syncXrayClient приводит пользователя в Xray к состоянию клиента.
+// Возвращает true, если активного клиента в Xray не было и он добавлен.
+func syncXrayClient(server *Server, client *XrayClient, replace bool) (bool, error) {
+	if !client.IsActive() || replace {
+		err := XrayRemoveUser(server.PanelURL, server.InboundTag, client.Email)
+		if err != nil && !IsXrayUserNotFound(err) {
+			return false, err
+		}
+		if !client.IsActive() {
+			return false, nil
+		}
+	}
+
+	err := XrayAddUser(server.PanelURL, server.InboundTag, client.Email, client.UUID, client.Flow)
+	if IsXrayUserExists(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Счетчики Xray обнуляются при чтении: трафик, который не удалось сохранить в базе,
+// хранится по серверам до следующего сбора, чтобы ошибка базы его не потеряла
+var (
+	xrayTrafficMu      sync.Mutex
+	xrayUnsavedTraffic = make(map[string]map[string]XrayTraffic)
+)
+
+// collectXrayTraffic переносит счетчики трафика пользователей Xray в базу и обнуляет их
+func collectXrayTraffic(server *Server) error {
+	xrayTrafficMu.Lock()
+	defer xrayTrafficMu.Unlock()
+
+	traffic, err := XrayQueryUserTraffic(server.PanelURL, true)
+	if err != nil {
+		return fmt.Errorf("сервер %s: %v", server.ID, err)
+	}
+
+	unsaved := xrayUnsavedTraffic[server.ID]
+	if unsaved == nil {
+		unsaved = make(map[string]XrayTraffic)
+	}
+	for email, item := range traffic {
+		if item.Uplink == 0 && item.Downlink == 0 {
+			continue
+		}
+		total := unsaved[email]
+		total.Uplink += item.Uplink
+		total.Downlink += item.Downlink
+		unsaved[email] = total
+	}
+	if len(unsaved) == 0 {
+		return nil
+	}
+	xrayUnsavedTraffic[server.ID] = unsaved
+
+	if err := saveXrayTraffic(server.ID, unsaved); err != nil {
+		return fmt.Errorf("сервер %s: %v", server.ID, err)
+	}
+	delete(xrayUnsavedTraffic, server.ID)
+	return nil
+}
+
+// saveXrayTraffic добавляет трафик пользователей сервера к счетчикам в базе одной транзакцией
+func saveXrayTraffic(serverID string, traffic map[string]XrayTraffic) error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	for email, item := range traffic {
+		_, err := tx.Exec(`
+			UPDATE xray_clients SET upload = upload + $1, download = download + $2
+			WHERE server_id = $3 AND email = $4`,
+			item.Uplink, item.Downlink, serverID, email)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения трафика %s: %v", email, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка сохранения трафика: %v", err)
+	}
+	return nil
+}
+
+// SyncXrayServer собирает трафик и приводит пользователей Xray к состоянию из базы:
+// восстанавливает клиентов после перезапуска Xray, удаляет истекших и превысивших лимит.
+func SyncXrayServer(server *Server) error {
+	if err := collectXrayTraffic(server); err != nil {
+		return err
+	}
+
+	clients, err := getXrayClients(server.ID)
+	if err != nil {
+		return err
+	}
+
+	restored, failed := 0, 0
+	for _, client := range clients {
+		added, err := syncXrayClient(server, client, false)
+		if err != nil {
+			log.Printf("XRAY_SYNC: Ошибка синхронизации клиента %s на сервере %s: %v", client.Email, server.ID, err)
+			failed++
+			continue
+		}
+		if added {
+			restored++
+		}
+	}
+
+	if restored > 0 || failed > 0 {
+		log.Printf("XRAY_SYNC: Сервер %s: клиентов %d, добавлено в Xray %d, ошибок %d", server.ID, len(clients), restored, failed)
+	}
+	return nil
+}
+
+// SyncXrayServers синхронизирует все серверы Xray из реестра
+func SyncXrayServers() error {
+	loads, err := GetServerLoads()
+	if err != nil {
+		return err
+	}
+
+	for _, load := range loads {
+		server := load.Server
+		if server.ID == DefaultServerID {
+			server = DefaultServer()
+		}
+		if server.BackendType() != BackendXray || IsServerDown(server.ID) {
+			continue
+		}
+		if err := SyncXrayServer(server); err != nil {
+			log.Printf("XRAY_SYNC: Ошибка синхронизации сервера %s: %v", server.ID, err)
+		}
+	}
+	return nil
+}
+
+// XrayInbound описывает inbound сервера Xray в формате 3x-ui для ссылок подписки
+func (s *Server) XrayInbound() *Inbound {
+	host, _, err := net.SplitHostPort(s.PanelURL)
+	if err != nil {
+		host = s.PanelURL
+	}
+	return &Inbound{
+		Tag:            s.InboundTag,
+		Enable:         true,
+		Listen:         host,
+		Port:           s.InboundPort,
+		Protocol:       "vless",
+		StreamSettings: s.StreamSettings,
+	}
+}
+
+// PanelClient возвращает клиента Xray в формате 3x-ui для ссылок подписки
+func (c *XrayClient) PanelClient() Client {
+	return Client{ID: c.UUID, Flow: c.Flow, Email: c.Email, ExpiryTime: c.ExpiryTime, Enable: c.Enabled}
+}
@@ -0,0 +1,341 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// XUIBackend клиенты в первом inbound'е панели 3x-ui сервера
+type XUIBackend struct {
+	server *Server
+}
+
+// NewXUIBackend создает панель 3x-ui для сервера
+func NewXUIBackend(server *Server) *XUIBackend {
+	return &XUIBackend{server: server}
+}
+
+// CreateUser создает клиента с лимитом трафика, существующий клиент перезаписывается
+func (b *XUIBackend) CreateUser(user *User, days int, trafficGB int) error {
+	sessionCookie, err := LoginServer(b.server)
+	if err != nil {
+		return fmt.Errorf("ошибка авторизации в панели: %v", err)
+	}
+	return AddTrialClientWithTraffic(sessionCookie, user, days, trafficGB)
+}
+
+// Extend продлевает клиента и сбрасывает состояние "исчерпано"
+func (b *XUIBackend) Extend(user *User, days int) error {
+	sessionCookie, err := LoginServer(b.server)
+	if err != nil {
+		return fmt.Errorf("ошибка авторизации в панели: %v", err)
+	}
+
+	if err := AddClient(sessionCookie, user, days); err != nil {
+		return fmt.Errorf("ошибка создания конфига: %v", err)
+	}
+
+	// Основная операция выполнена, ошибка сброса только логируется
+	if err := ForceResetDepletedStatus(sessionCookie, user.TelegramID); err != nil {
+		log.Printf("XUI_BACKEND: Не удалось сбросить состояние 'исчерпано' для пользователя %d: %v", user.TelegramID, err)
+	}
+	return nil
+}
+
+// Enable включает клиента и сбрасывает флаги "исчерпано"
+func (b *XUIBackend) Enable(user *User) error {
+	found, err := b.updateClient(user, func(client *Client) {
+		falseValue := false
+		client.Enable = true
+		client.Depleted = &falseValue
+		client.Exhausted = &falseValue
+		user.HasActiveConfig = true
+	})
+	if err == nil && !found {
+		return fmt.Errorf("клиент пользователя %d не найден в панели", user.TelegramID)
+	}
+	return err
+}
+
+// Disable отключает клиента и завершает его срок в панели. Отсутствие клиента в панели не ошибка.
+func (b *XUIBackend) Disable(user *User) error {
+	now := time.Now().UnixMilli()
+	found, err := b.updateClient(user, func(client *Client) {
+		client.Enable = false
+		client.ExpiryTime = now
+	})
+	if err == nil && !found {
+		log.Printf("XUI_BACKEND: Клиент с TelegramID=%d не найден в панели сервера %s", user.TelegramID, b.server.ID)
+	}
+	return err
+}
+
+// Suspend отключает клиента, сохраняя срок
+func (b *XUIBackend) Suspend(user *User) error {
+	found, err := b.updateClient(user, func(client *Client) {
+		client.Enable = false
+	})
+	if err == nil && !found {
+		return fmt.Errorf("клиент пользователя %d не найден в панели", user.TelegramID)
+	}
+	return err
+}
+
+// AddTraffic увеличивает лимит трафика клиента в панели (totalGB хранится в байтах), клиент без лимита не меняется
+func (b *XUIBackend) AddTraffic(user *User, trafficGB int) error {
+	found, err := b.updateClient(user, func(client *Client) {
+		if client.TotalGB > 0 {
+			client.TotalGB += trafficGB * 1024 * 1024 * 1024
+		}
+	})
+	if err == nil && !found {
+		return fmt.Errorf("клиент пользователя %d не найден в панели", user.TelegramID)
+	}
+	return err
+}
+
+// RotateKey выдает клиенту новый UUID
+func (b *XUIBackend) RotateKey(user *User) (string, error) {
+	newID := uuid.New().String()
+	found, err := b.updateClient(user, func(client *Client) {
+		client.ID = newID
+		user.ClientID = newID
+	})
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("клиент пользователя %d не найден в панели", user.TelegramID)
+	}
+	return newID, nil
+}
+
+// GetUsage возвращает трафик клиента из clientStats inbound'а
+func (b *XUIBackend) GetUsage(user *User) (*BackendUsage, error) {
+	sessionCookie, err := LoginServer(b.server)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка авторизации в панели: %v", err)
+	}
+
+	inbound, settings, err := getInboundSettings(sessionCookie)
+	if err != nil {
+		return nil, err
+	}
+
+	client := FindClientByTelegramID(settings.Clients, user.TelegramID)
+	if client == nil {
+		return nil, fmt.Errorf("клиент пользователя %d не найден в панели", user.TelegramID)
+	}
+
+	usage := &BackendUsage{Total: int64(client.TotalGB), ExpiryTime: client.ExpiryTime, Enabled: client.Enable}
+	if stats := FindClientStats(inbound, client.Email); stats != nil {
+		usage.Upload = stats.Up
+		usage.Download = stats.Down
+	}
+	return usage, nil
+}
+
+// Delete удаляет клиента из inbound'а
+func (b *XUIBackend) Delete(user *User) error {
+	sessionCookie, err := LoginServer(b.server)
+	if err != nil {
+		return fmt.Errorf("ошибка авторизации в панели: %v", err)
+	}
+
+	_, settings, err := getInboundSettings(sessionCookie)
+	if err != nil {
+		return err
+	}
+
+	client := FindClientByTelegramID(settings.Clients, user.TelegramID)
+	if client == nil {
+		return nil
+	}
+	return removePanelClient(sessionCookie, client.Email)
+}
+
+// SubscriptionURL возвращает ссылку на подписку панели сервера
+func (b *XUIBackend) SubscriptionURL(user *User) string {
+	return b.server.SubscriptionURL(user.SubID)
+}
+
+// ApplyClients приводит дополнительных клиентов inbound'а к переданному состоянию одним обновлением
+func (b *XUIBackend) ApplyClients(clients []*BackendClient) error {
+	sessionCookie, err := LoginServer(b.server)
+	if err != nil {
+		return fmt.Errorf("ошибка авторизации в панели: %v", err)
+	}
+
+	inbound, settings, err := getInboundSettings(sessionCookie)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, client := range clients {
+		if applyBackendClient(settings, client) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации settings: %v", err)
+	}
+	inbound.Settings = string(settingsJSON)
+
+	if err := updateInbound(sessionCookie, *inbound); err != nil {
+		return fmt.Errorf("ошибка обновления inbound: %v", err)
+	}
+	return nil
+}
+
+// applyBackendClient обновляет дополнительного клиента в settings. Возвращает true, если клиент изменился.
+func applyBackendClient(settings *Settings, backendClient *BackendClient) bool {
+	index := -1
+	for i, client := range settings.Clients {
+		if client.Email == backendClient.Email {
+			index = i
+			break
+		}
+	}
+
+	if backendClient.Removed {
+		if index == -1 {
+			return false
+		}
+		settings.Clients = append(settings.Clients[:index], settings.Clients[index+1:]...)
+		return true
+	}
+
+	expiryTime := backendClient.ExpiryTime
+	enable := backendClient.Enabled
+	if !enable {
+		expiryTime = time.Now().UnixMilli()
+	}
+
+	if index == -1 {
+		falseValue := false
+		settings.Clients = append(settings.Clients, Client{
+			ID:         backendClient.UUID,
+			Flow:       "xtls-rprx-vision",
+			Email:      backendClient.Email,
+			TotalGB:    0, // Без лимита трафика, как у основного конфига
+			ExpiryTime: expiryTime,
+			Enable:     enable,
+			TgID:       0,
+			SubID:      backendClient.SubID,
+			Reset:      0,
+			Depleted:   &falseValue,
+			Exhausted:  &falseValue,
+			CreatedAt:  time.Now().UnixMilli(),
+			UpdatedAt:  time.Now().UnixMilli(),
+		})
+		return true
+	}
+
+	client := &settings.Clients[index]
+	if client.ID == backendClient.UUID && client.SubID == backendClient.SubID && client.Enable == enable &&
+		(!enable || client.ExpiryTime == expiryTime) {
+		return false
+	}
+
+	falseValue := false
+	client.ID = backendClient.UUID
+	client.SubID = backendClient.SubID
+	client.Enable = enable
+	client.ExpiryTime = expiryTime
+	client.Depleted = &falseValue
+	client.Exhausted = &falseValue
+	client.UpdatedAt = time.Now().UnixMilli()
+	return true
+}
+
+// updateClient изменяет клиента пользователя в inbound'е. Возвращает false, если клиента нет.
+func (b *XUIBackend) updateClient(user *User, update func(client *Client)) (bool, error) {
+	sessionCookie, err := LoginServer(b.server)
+	if err != nil {
+		return false, fmt.Errorf("ошибка авторизации в панели: %v", err)
+	}
+
+	inbound, settings, err := getInboundSettings(sessionCookie)
+	if err != nil {
+		return false, err
+	}
+
+	index := findClientIndex(settings.Clients, user.TelegramID)
+	if index == -1 {
+		return false, nil
+	}
+
+	update(&settings.Clients[index])
+	settings.Clients[index].UpdatedAt = time.Now().UnixMilli()
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сериализации settings: %v", err)
+	}
+	inbound.Settings = string(settingsJSON)
+
+	if err := updateInbound(sessionCookie, *inbound); err != nil {
+		return false, fmt.Errorf("ошибка обновления inbound: %v", err)
+	}
+	return true, nil
+}
+
+// getInboundSettings возвращает inbound сервера сессии и его settings
+func getInboundSettings(sessionCookie string) (*Inbound, *Settings, error) {
+	inbound, err := GetInbound(sessionCookie)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка получения inbound: %v", err)
+	}
+
+	var settings Settings
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+		return nil, nil, fmt.Errorf("ошибка десериализации settings: %v", err)
+	}
+	return inbound, &settings, nil
+}
+
+// findClientIndex возвращает индекс клиента пользователя в списке или -1
+func findClientIndex(clients []Client, telegramID int64) int {
+	telegramIDStr := fmt.Sprintf("%d", telegramID)
+	for i, client := range clients {
+		if strings.HasPrefix(client.Email, telegramIDStr+"_") || strings.HasPrefix(client.Email, telegramIDStr+" ") || client.Email == telegramIDStr {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindClientStats находит статистику трафика клиента в clientStats inbound'а
+func FindClientStats(inbound *Inbound, email string) *TrafficStats {
+	if inbound.ClientStats == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(inbound.ClientStats)
+	if err != nil {
+		return nil
+	}
+
+	var stats []TrafficStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil
+	}
+
+	for i := range stats {
+		if strings.EqualFold(stats[i].Email, email) {
+			return &stats[i]
+		}
+	}
+	return nil
+}
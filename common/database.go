@@ -75,6 +75,12 @@ func AddBalance(telegramID int64, amount float64) error {
 	return AddBalancePG(telegramID, amount)
 }
 
+// DeductBalance списывает средства с баланса пользователя и возвращает новый баланс
+func DeductBalance(telegramID int64, amount float64) (float64, error) {
+	// Переадресация к PostgreSQL
+	return DeductBalancePG(telegramID, amount)
+}
+
 // UpdateTrialFlag обновляет флаг использования пробного периода
 func UpdateTrialFlag(telegramID int64) error {
 	// Переадресация к PostgreSQL
@@ -119,9 +125,13 @@ func RestoreMongoDB() error {
 
 // ProcessPayment обрабатывает платеж
 func ProcessPayment(user *User, days int) (string, error) {
+	return ProcessPaymentWithCost(user, days, float64(days*PRICE_PER_DAY))
+}
+
+// ProcessPaymentWithCost обрабатывает оплату тарифа с баланса по указанной стоимости (например, со скидкой)
+func ProcessPaymentWithCost(user *User, days int, cost float64) (string, error) {
 	log.Printf("PROCESS_PAYMENT: Начало обработки платежа для TelegramID=%d, days=%d", user.TelegramID, days)
 
-	cost := float64(days * PRICE_PER_DAY)
 	log.Printf("PROCESS_PAYMENT: Расчёт стоимости: TelegramID=%d, days=%d, balance=%.2f, cost=%.2f", user.TelegramID, days, user.Balance, cost)
 
 	// Проверяем баланс
@@ -130,26 +140,10 @@ func ProcessPayment(user *User, days int) (string, error) {
 		return "", fmt.Errorf("недостаточно средств на балансе. Нужно: %.2f₽, доступно: %.2f₽", cost, user.Balance)
 	}
 
-	// Создаем конфиг через панель 3x-ui
-	sessionCookie, err := Login()
-	if err != nil {
-		log.Printf("PROCESS_PAYMENT: Ошибка авторизации в панели для TelegramID=%d: %v", user.TelegramID, err)
-		return "", fmt.Errorf("ошибка авторизации в панели: %v", err)
-	}
-
-	err = AddClient(sessionCookie, user, days)
-	if err != nil {
+	// Создаем или продлеваем конфиг в панели сервера пользователя
+	if err := GetUserBackendForNewClient(user.TelegramID).Extend(user, days); err != nil {
 		log.Printf("PROCESS_PAYMENT: Ошибка создания конфига для TelegramID=%d: %v", user.TelegramID, err)
-		return "", fmt.Errorf("ошибка создания конфига: %v", err)
-	}
-
-	// Принудительно сбрасываем состояние "исчерпано" после создания/продления
-	log.Printf("PROCESS_PAYMENT: Принудительный сброс состояния 'исчерпано' для TelegramID=%d", user.TelegramID)
-	if err := ForceResetDepletedStatus(sessionCookie, user.TelegramID); err != nil {
-		log.Printf("PROCESS_PAYMENT: Предупреждение - не удалось сбросить состояние 'исчерпано' для TelegramID=%d: %v", user.TelegramID, err)
-		// Не возвращаем ошибку, так как основная операция уже выполнена
-	} else {
-		log.Printf("PROCESS_PAYMENT: Состояние 'исчерпано' успешно сброшено для TelegramID=%d", user.TelegramID)
+		return "", err
 	}
 
 	// Списываем деньги с баланса
@@ -162,7 +156,7 @@ func ProcessPayment(user *User, days int) (string, error) {
 		return "", fmt.Errorf("ошибка обновления пользователя: %v", err)
 	}
 
-	configURL := fmt.Sprintf("%s%s", CONFIG_BASE_URL, user.SubID)
+	configURL := UserSubscriptionURL(user)
 	log.Printf("PROCESS_PAYMENT: Конфиг успешно создан для TelegramID=%d, ConfigURL=%s", user.TelegramID, configURL)
 
 	// Проверяем, нужно ли отправить уведомление о подписке
@@ -263,23 +257,6 @@ func SetTrafficConfig(config *TrafficConfig) error {
 	return SetTrafficConfigPG(config)
 }
 
-// CheckAndDisableTrafficLimit проверяет трафик и отключает/включает клиентов
-func CheckAndDisableTrafficLimit() error {
-	log.Printf("CHECK_AND_DISABLE_TRAFFIC_LIMIT: Начало проверки трафика")
-
-	// Если лимит трафика не установлен, пропускаем проверку
-	if TRAFFIC_LIMIT_GB <= 0 {
-		log.Printf("CHECK_AND_DISABLE_TRAFFIC_LIMIT: Лимит трафика не установлен (TRAFFIC_LIMIT_GB=%d), пропускаем проверку", TRAFFIC_LIMIT_GB)
-		return nil
-	}
-
-	log.Printf("CHECK_AND_DISABLE_TRAFFIC_LIMIT: Функция проверки трафика временно отключена (GetClientTrafficStats не реализована)")
-	disabledCount := 0
-
-	log.Printf("CHECK_AND_DISABLE_TRAFFIC_LIMIT: Отключено клиентов по лимиту трафика: %d", disabledCount)
-	return nil
-}
-
 // updateUserTrafficStatus обновляет статус пользователя в БД при изменении статуса трафика
 func updateUserTrafficStatus(email string, isEnabled bool) {
 	// Извлекаем telegram_id из email
@@ -323,12 +300,28 @@ func updateUserTrafficStatus(email string, isEnabled bool) {
 	}
 }
 
-// ResetAllTraffic сбрасывает трафик всех клиентов
+// ResetAllTraffic сбрасывает трафик всех клиентов на панелях 3x-ui всех серверов
 func ResetAllTraffic() error {
 	log.Printf("RESET_ALL_TRAFFIC: Начало сброса трафика для всех клиентов")
 
+	failed, err := forEachXUIServer("RESET_ALL_TRAFFIC", resetServerTraffic)
+	if err != nil {
+		return err
+	}
+
+	// Обновляем статус пользователей в базе данных
+	updateAllUsersActiveStatus(true)
+
+	if len(failed) > 0 {
+		return fmt.Errorf("не удалось сбросить трафик на серверах: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// resetServerTraffic сбрасывает трафик и включает всех клиентов панели сервера
+func resetServerTraffic(server *Server) error {
 	// Авторизуемся в панели
-	sessionCookie, err := Login()
+	sessionCookie, err := LoginServer(server)
 	if err != nil {
 		log.Printf("RESET_ALL_TRAFFIC: Ошибка авторизации: %v", err)
 		return fmt.Errorf("ошибка авторизации в панели: %v", err)
@@ -387,10 +380,7 @@ func ResetAllTraffic() error {
 		return fmt.Errorf("ошибка обновления inbound: %v", err)
 	}
 
-	// Обновляем статус пользователей в базе данных
-	updateAllUsersActiveStatus(true)
-
-	log.Printf("RESET_ALL_TRAFFIC: Успешно сброшен трафик для %d клиентов, включено %d клиентов", resetCount, enabledCount)
+	log.Printf("RESET_ALL_TRAFFIC: Сервер %s: сброшен трафик для %d клиентов, включено %d клиентов", server.ID, resetCount, enabledCount)
 	return nil
 }
 
@@ -0,0 +1,28 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// DisableClientConfig отключает конфиг пользователя в панели и отмечает это в базе
+func DisableClientConfig(user *User) error {
+	log.Printf("DISABLE_CONFIG: Отключение конфига для TelegramID=%d", user.TelegramID)
+
+	// Отсутствие конфига в панели не ошибка - достаточно обновить базу
+	if err := GetUserBackend(user.TelegramID).Disable(user); err != nil {
+		log.Printf("DISABLE_CONFIG: Ошибка отключения конфига в панели: %v", err)
+		return err
+	}
+
+	user.ExpiryTime = time.Now().UnixMilli()
+	user.HasActiveConfig = false
+	if err := UpdateUser(user); err != nil {
+		log.Printf("DISABLE_CONFIG: Ошибка обновления пользователя %d: %v", user.TelegramID, err)
+		return fmt.Errorf("ошибка обновления пользователя: %v", err)
+	}
+
+	log.Printf("DISABLE_CONFIG: ✅ Конфиг пользователя TelegramID=%d отключен", user.TelegramID)
+	return nil
+}
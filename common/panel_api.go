@@ -21,12 +21,22 @@ var httpClient = &http.Client{
 	},
 }
 
-// Login выполняет авторизацию в панели 3x-ui
+// Login выполняет авторизацию в панели 3x-ui основного сервера
 func Login() (string, error) {
-	log.Printf("LOGIN: Начало авторизации в панели, URL=%s, Username=%s", PANEL_URL, PANEL_USER)
+	return LoginServer(DefaultServer())
+}
+
+// LoginServer выполняет авторизацию в панели 3x-ui указанного сервера.
+// Дальнейшие вызовы с полученной кукой работают с панелью и inbound этого сервера.
+func LoginServer(server *Server) (string, error) {
+	if sessionCookie, ok := cachedPanelSession(server); ok {
+		return sessionCookie, nil
+	}
+
+	log.Printf("LOGIN: Начало авторизации в панели, Server=%s, URL=%s, Username=%s", server.ID, server.PanelURL, server.PanelUser)
 	loginData := LoginRequest{
-		Username: PANEL_USER,
-		Password: PANEL_PASS,
+		Username: server.PanelUser,
+		Password: server.PanelPass,
 	}
 
 	jsonData, err := json.Marshal(loginData)
@@ -36,7 +46,7 @@ func Login() (string, error) {
 	}
 	log.Printf("LOGIN: Данные авторизации: %s", string(jsonData))
 
-	req, err := http.NewRequest("POST", PANEL_URL+"login", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", server.PanelURL+"login", bytes.NewBuffer(jsonData))
 	if err != nil {
 		log.Printf("LOGIN: Ошибка создания запроса: %v", err)
 		return "", fmt.Errorf("ошибка создания запроса: %v", err)
@@ -85,6 +95,7 @@ func Login() (string, error) {
 		if strings.Contains(cookie, "3x-ui=") {
 			sessionCookie := strings.Split(cookie, ";")[0]
 			log.Printf("LOGIN: Успешная авторизация, кука: %s", sessionCookie)
+			rememberPanelSession(sessionCookie, server)
 			return sessionCookie, nil
 		}
 	}
@@ -93,10 +104,16 @@ func Login() (string, error) {
 	return "", fmt.Errorf("кука сессии не найдена")
 }
 
-// GetInbound получает полный inbound object
+// GetInbound получает полный inbound object сервера, к которому относится кука
 func GetInbound(sessionCookie string) (*Inbound, error) {
-	log.Printf("GET_INBOUND: Получение inbound, ID=%d", INBOUND_ID)
-	req, err := http.NewRequest("GET", fmt.Sprintf("%spanel/api/inbounds/get/%d", PANEL_URL, INBOUND_ID), nil)
+	return GetInboundByID(sessionCookie, sessionServer(sessionCookie).PrimaryInboundID())
+}
+
+// GetInboundByID получает inbound с указанным ID на сервере, к которому относится кука
+func GetInboundByID(sessionCookie string, inboundID int) (*Inbound, error) {
+	server := sessionServer(sessionCookie)
+	log.Printf("GET_INBOUND: Получение inbound, Server=%s, ID=%d", server.ID, inboundID)
+	req, err := http.NewRequest("GET", fmt.Sprintf("%spanel/api/inbounds/get/%d", server.PanelURL, inboundID), nil)
 	if err != nil {
 		log.Printf("GET_INBOUND: Ошибка создания запроса: %v", err)
 		return nil, fmt.Errorf("ошибка создания запроса: %v", err)
@@ -121,12 +138,15 @@ func GetInbound(sessionCookie string) (*Inbound, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("GET_INBOUND: Некорректный статус ответа: %d", resp.StatusCode)
+		// Панель могла сбросить сессию (перезапуск) - следующий вход авторизуется заново
+		expirePanelSession(sessionCookie)
 		return nil, fmt.Errorf("некорректный статус ответа: %d, body=%s", resp.StatusCode, string(body))
 	}
 
 	var inboundInfo InboundInfo
 	if err := json.Unmarshal(body, &inboundInfo); err != nil {
 		log.Printf("GET_INBOUND: Ошибка десериализации ответа: %v, body=%s", err, string(body))
+		expirePanelSession(sessionCookie)
 		return nil, fmt.Errorf("ошибка десериализации ответа: %v, body=%s", err, string(body))
 	}
 
@@ -392,7 +412,7 @@ func AddClient(sessionCookie string, user *User, days int) error {
 	// Для клиентов, которые были удалены и пересозданы, дополнительно проверяем обновление
 	if actualExistingClient == nil {
 		log.Printf("ADD_CLIENT: Клиент был пересоздан вместо удаленного 3x-ui. Дополнительная проверка для TelegramID=%d", user.TelegramID)
-		if err := restartInbound(sessionCookie, INBOUND_ID); err != nil {
+		if err := restartInbound(sessionCookie, inbound.ID); err != nil {
 			log.Printf("ADD_CLIENT: Предупреждение - не удалось выполнить дополнительную проверку: %v", err)
 			// Не возвращаем ошибку, так как основная операция уже выполнена
 		}
@@ -419,7 +439,7 @@ func updateInbound(sessionCookie string, inbound Inbound) error {
 		return fmt.Errorf("ошибка сериализации данных: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", PANEL_URL+"panel/api/inbounds/update/"+fmt.Sprintf("%d", inbound.ID), bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", sessionServer(sessionCookie).PanelURL+"panel/api/inbounds/update/"+fmt.Sprintf("%d", inbound.ID), bytes.NewBuffer(jsonData))
 	if err != nil {
 		log.Printf("UPDATE_INBOUND: Ошибка создания запроса: %v", err)
 		return fmt.Errorf("ошибка создания запроса: %v", err)
@@ -445,6 +465,7 @@ func updateInbound(sessionCookie string, inbound Inbound) error {
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("UPDATE_INBOUND: Некорректный статус ответа: %d", resp.StatusCode)
+		expirePanelSession(sessionCookie)
 		return fmt.Errorf("некорректный статус ответа: %d, body=%s", resp.StatusCode, string(body))
 	}
 
@@ -494,7 +515,15 @@ func FindClientByTelegramID(clients []Client, telegramID int64) *Client {
 
 // AddTrialClient создает конфиг для пробного периода БЕЗ установки статуса "исчерпано"
 func AddTrialClient(sessionCookie string, user *User, days int) error {
-	log.Printf("ADD_TRIAL_CLIENT: Создание конфига для пробного периода TelegramID=%d, days=%d", user.TelegramID, days)
+	return AddTrialClientWithTraffic(sessionCookie, user, days, 0)
+}
+
+// AddTrialClientWithTraffic создает конфиг для пробного периода с лимитом трафика (0 - без лимита)
+func AddTrialClientWithTraffic(sessionCookie string, user *User, days int, trafficGB int) error {
+	log.Printf("ADD_TRIAL_CLIENT: Создание конфига для пробного периода TelegramID=%d, days=%d, trafficGB=%d", user.TelegramID, days, trafficGB)
+
+	// Лимит трафика в панели задается в байтах
+	totalBytes := trafficGB * 1024 * 1024 * 1024
 
 	inbound, err := GetInbound(sessionCookie)
 	if err != nil {
@@ -526,8 +555,8 @@ func AddTrialClient(sessionCookie string, user *User, days int) error {
 				// Обновляем данные клиента
 				settings.Clients[i].ExpiryTime = expiryTime
 				settings.Clients[i].Enable = true
-				settings.Clients[i].TotalGB = 0 // Убираем лимит трафика
-				settings.Clients[i].Reset = 0   // Убираем автопродление
+				settings.Clients[i].TotalGB = totalBytes // Лимит трафика пробного периода (0 = безлимит)
+				settings.Clients[i].Reset = 0            // Убираем автопродление
 				settings.Clients[i].UpdatedAt = time.Now().UnixMilli()
 
 				// Сбрасываем статус "исчерпано"
@@ -559,7 +588,7 @@ func AddTrialClient(sessionCookie string, user *User, days int) error {
 			ID:         clientUUID,
 			Flow:       "xtls-rprx-vision",
 			Email:      email,
-			TotalGB:    0, // Убираем лимит трафика (0 = безлимит)
+			TotalGB:    totalBytes, // Лимит трафика пробного периода (0 = безлимит)
 			ExpiryTime: expiryTime,
 			Enable:     true,
 			TgID:       0,
@@ -607,12 +636,26 @@ func AddTrialClient(sessionCookie string, user *User, days int) error {
 	return nil
 }
 
-// RemoveDuplicateClients удаляет дубликаты клиентов в панели 3x-ui
+// RemoveDuplicateClients удаляет дубликаты клиентов в панелях 3x-ui всех серверов
 func RemoveDuplicateClients() error {
 	log.Printf("REMOVE_DUPLICATES: Начало удаления дубликатов клиентов")
 
+	failed, err := forEachXUIServer("REMOVE_DUPLICATES", removeServerDuplicateClients)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("не удалось удалить дубликаты на серверах: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// removeServerDuplicateClients удаляет дубликаты клиентов в панели сервера
+func removeServerDuplicateClients(server *Server) error {
+	log.Printf("REMOVE_DUPLICATES: Удаление дубликатов на сервере %s", server.ID)
+
 	// Авторизуемся в панели
-	sessionCookie, err := Login()
+	sessionCookie, err := LoginServer(server)
 	if err != nil {
 		log.Printf("REMOVE_DUPLICATES: Ошибка авторизации: %v", err)
 		return fmt.Errorf("ошибка авторизации в панели: %v", err)
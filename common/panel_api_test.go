@@ -2,9 +2,12 @@ package common
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -507,3 +510,216 @@ func TestConfigVariables(t *testing.T) {
 		t.Errorf("PANEL_URL должен начинаться с http:// или https://, получен: %s", PANEL_URL)
 	}
 }
+
+// TestLoginServer_RoutesInbound проверяет, что кука сессии направляет запросы inbound в панель своего сервера
+func TestLoginServer_RoutesInbound(t *testing.T) {
+	newPanel := func(cookie string, inboundID int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/login" {
+				w.Header().Set("Set-Cookie", "3x-ui="+cookie+"; Path=/; HttpOnly")
+				json.NewEncoder(w).Encode(LoginResponse{Success: true})
+				return
+			}
+
+			expectedPath := fmt.Sprintf("/panel/api/inbounds/get/%d", inboundID)
+			if r.URL.Path != expectedPath || r.Header.Get("Cookie") != "3x-ui="+cookie {
+				t.Errorf("Неожиданный запрос к панели %s: %s, Cookie=%s", cookie, r.URL.Path, r.Header.Get("Cookie"))
+			}
+			json.NewEncoder(w).Encode(InboundInfo{Success: true, Obj: Inbound{ID: inboundID, Remark: cookie}})
+		}))
+	}
+
+	mainPanel := newPanel("main_session", 1)
+	defer mainPanel.Close()
+	nlPanel := newPanel("nl_session", 7)
+	defer nlPanel.Close()
+
+	originalPanelURL := PANEL_URL
+	originalInboundID := INBOUND_ID
+	PANEL_URL = mainPanel.URL + "/"
+	INBOUND_ID = 1
+	defer func() {
+		PANEL_URL = originalPanelURL
+		INBOUND_ID = originalInboundID
+	}()
+
+	nl := &Server{ID: "nl", PanelURL: nlPanel.URL + "/", InboundIDs: []int{7, 8}}
+
+	tests := []struct {
+		name      string
+		login     func() (string, error)
+		inboundID int
+		remark    string
+	}{
+		{"Основной сервер", Login, 1, "main_session"},
+		{"Дополнительный сервер", func() (string, error) { return LoginServer(nl) }, 7, "nl_session"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionCookie, err := tt.login()
+			if err != nil {
+				t.Fatalf("Ошибка авторизации: %v", err)
+			}
+
+			inbound, err := GetInbound(sessionCookie)
+			if err != nil {
+				t.Fatalf("GetInbound() вернул ошибку: %v", err)
+			}
+			if inbound.ID != tt.inboundID || inbound.Remark != tt.remark {
+				t.Errorf("Получен inbound %d (%s), ожидался %d (%s)", inbound.ID, inbound.Remark, tt.inboundID, tt.remark)
+			}
+		})
+	}
+}
+
+// TestLoginServer_SessionCache проверяет, что сессия панели сервера переиспользуется до отказа панели
+func TestLoginServer_SessionCache(t *testing.T) {
+	var mu sync.Mutex
+	logins := 0
+	panel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/login" {
+			mu.Lock()
+			logins++
+			w.Header().Set("Set-Cookie", fmt.Sprintf("3x-ui=cache_session_%d; Path=/; HttpOnly", logins))
+			mu.Unlock()
+			json.NewEncoder(w).Encode(LoginResponse{Success: true})
+			return
+		}
+		// Панель не принимает сессию - как после перезапуска
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer panel.Close()
+
+	server := &Server{ID: "cache_test", PanelURL: panel.URL + "/", InboundIDs: []int{3}}
+	first, err := LoginServer(server)
+	if err != nil {
+		t.Fatalf("Ошибка авторизации: %v", err)
+	}
+	second, err := LoginServer(server)
+	if err != nil || second != first || logins != 1 {
+		t.Fatalf("Повторный вход: кука %s (%v), авторизаций %d, ожидалась кука %s и одна авторизация", second, err, logins, first)
+	}
+
+	// Отклоненная панелью сессия устаревает, старая кука по-прежнему относится к серверу
+	if _, err := GetInbound(first); err == nil {
+		t.Fatal("Ожидалась ошибка получения inbound")
+	}
+	third, err := LoginServer(server)
+	if err != nil || third == first || logins != 2 {
+		t.Fatalf("Вход после отказа панели: кука %s (%v), авторизаций %d", third, err, logins)
+	}
+	if sessionServer(first).ID != server.ID || sessionServer(third).ID != server.ID {
+		t.Error("Кука сессии не связана с сервером")
+	}
+
+}
+
+// TestProbeServer проверяет доступность панели и портов inbound'ов через фейковую панель
+func TestProbeServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Ошибка запуска слушателя: %v", err)
+	}
+	defer listener.Close()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+
+	closedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Ошибка запуска слушателя: %v", err)
+	}
+	closedPort := closedListener.Addr().(*net.TCPAddr).Port
+	closedListener.Close()
+
+	panel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/login" {
+			w.Header().Set("Set-Cookie", "3x-ui=probe_session; Path=/; HttpOnly")
+			json.NewEncoder(w).Encode(LoginResponse{Success: true})
+			return
+		}
+
+		port := openPort
+		if r.URL.Path == "/panel/api/inbounds/get/2" {
+			port = closedPort
+		}
+		json.NewEncoder(w).Encode(InboundInfo{Success: true, Obj: Inbound{ID: 1, Enable: true, Listen: "127.0.0.1", Port: port}})
+	}))
+	defer panel.Close()
+
+	originalTimeout := HEALTH_CHECK_TIMEOUT
+	HEALTH_CHECK_TIMEOUT = 1
+	defer func() { HEALTH_CHECK_TIMEOUT = originalTimeout }()
+
+	healthy := ProbeServer(&Server{ID: "ok", PanelURL: panel.URL + "/", InboundIDs: []int{1}})
+	if !healthy.PanelOK || len(healthy.Errors) != 0 {
+		t.Errorf("Исправный сервер: PanelOK=%v, Errors=%v", healthy.PanelOK, healthy.Errors)
+	}
+
+	degraded := ProbeServer(&Server{ID: "port", PanelURL: panel.URL + "/", InboundIDs: []int{1, 2}})
+	if !degraded.PanelOK || len(degraded.Errors) != 1 {
+		t.Errorf("Закрытый порт inbound: PanelOK=%v, Errors=%v", degraded.PanelOK, degraded.Errors)
+	}
+
+	down := ProbeServer(&Server{ID: "down", PanelURL: fmt.Sprintf("http://127.0.0.1:%d/", closedPort), InboundIDs: []int{1}})
+	if down.PanelOK || len(down.Errors) != 1 {
+		t.Errorf("Недоступная панель: PanelOK=%v, Errors=%v", down.PanelOK, down.Errors)
+	}
+
+	// Задержка измеряется запросом к API, а не входом из кэша сессий
+	slowPanel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/login" {
+			w.Header().Set("Set-Cookie", "3x-ui=slow_session; Path=/; HttpOnly")
+			json.NewEncoder(w).Encode(LoginResponse{Success: true})
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(InboundInfo{Success: true, Obj: Inbound{ID: 1, Enable: true, Listen: "127.0.0.1", Port: openPort}})
+	}))
+	slow := &Server{ID: "slow", PanelURL: slowPanel.URL + "/", InboundIDs: []int{1}}
+	for i := 0; i < 2; i++ {
+		if probe := ProbeServer(slow); !probe.PanelOK || probe.Latency < 50*time.Millisecond {
+			t.Errorf("Проверка %d: PanelOK=%v, Latency=%v", i+1, probe.PanelOK, probe.Latency)
+		}
+	}
+
+	// Остановленная панель недоступна, даже пока сессия в кэше
+	slowPanel.Close()
+	if probe := ProbeServer(slow); probe.PanelOK {
+		t.Errorf("Остановленная панель с сессией в кэше: PanelOK=%v, Errors=%v", probe.PanelOK, probe.Errors)
+	}
+}
+
+// TestNextHealthStatus проверяет переходы состояния сервера
+func TestNextHealthStatus(t *testing.T) {
+	originalThreshold := HEALTH_FAILURE_THRESHOLD
+	originalLatency := HEALTH_LATENCY_DEGRADED_MS
+	HEALTH_FAILURE_THRESHOLD = 3
+	HEALTH_LATENCY_DEGRADED_MS = 1000
+	defer func() {
+		HEALTH_FAILURE_THRESHOLD = originalThreshold
+		HEALTH_LATENCY_DEGRADED_MS = originalLatency
+	}()
+
+	tests := []struct {
+		name     string
+		probe    HealthProbe
+		failures int
+		expected string
+	}{
+		{"Все доступно", HealthProbe{PanelOK: true, Latency: 200 * time.Millisecond}, 0, HealthStatusHealthy},
+		{"Высокая задержка", HealthProbe{PanelOK: true, Latency: 1500 * time.Millisecond}, 0, HealthStatusDegraded},
+		{"Недоступен inbound", HealthProbe{PanelOK: true, Errors: []string{"inbound 2"}}, 0, HealthStatusDegraded},
+		{"Первый сбой панели", HealthProbe{Errors: []string{"панель"}}, 1, HealthStatusDegraded},
+		{"Сбои панели подряд", HealthProbe{Errors: []string{"панель"}}, 3, HealthStatusDown},
+	}
+
+	for _, tt := range tests {
+		if got := nextHealthStatus(tt.probe, tt.failures); got != tt.expected {
+			t.Errorf("%s: получено %s, ожидалось %s", tt.name, got, tt.expected)
+		}
+	}
+}
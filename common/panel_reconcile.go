@@ -0,0 +1,451 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Виды расхождений между базой бота и клиентами панели
+const (
+	DriftOrphan    = "orphan"    // Клиент в панели без пользователя бота на этом сервере
+	DriftMissing   = "missing"   // У оплаченного пользователя нет клиента в панели
+	DriftExpiry    = "expiry"    // Срок клиента в панели не совпадает со сроком в базе
+	DriftUnpaid    = "unpaid"    // Клиент включен в панели, а подписка в базе закончилась
+	DriftDuplicate = "duplicate" // Несколько клиентов одного пользователя
+	DriftKeys      = "keys"      // UUID или subId клиента в базе отличаются от панели
+)
+
+// reconcileExpiryTolerance допустимое расхождение сроков (округления при продлении)
+const reconcileExpiryTolerance = int64(time.Minute / time.Millisecond)
+
+// PanelDrift расхождение между базой и панелью сервера
+type PanelDrift struct {
+	ServerID   string
+	Kind       string
+	TelegramID int64
+	Email      string
+	Details    string
+	Applied    bool
+	Error      string
+
+	dbClient *Client // Клиент, данные которого записываются в базу (DriftMissing, DriftKeys)
+}
+
+// PanelReconcileReport результат сверки базы с панелями
+type PanelReconcileReport struct {
+	StartedAt time.Time
+	Apply     bool
+	Servers   int
+	Clients   int
+	Users     int
+	Drifts    []PanelDrift
+	Errors    []string // Серверы, которые не удалось сверить
+}
+
+// reconcileUser пользователь бота, назначенный на сервер
+type reconcileUser struct {
+	TelegramID      int64
+	ClientID        string
+	SubID           string
+	Email           string
+	ExpiryTime      int64
+	HasActiveConfig bool
+	Balance         float64
+	QuotaBlocked    bool // Клиент отключен по лимиту трафика и не включается сверкой
+}
+
+// isPaid проверяет, оплачена ли подписка пользователя
+func (u *reconcileUser) isPaid(now int64) bool {
+	return u.HasActiveConfig && u.ExpiryTime > now
+}
+
+// telegramIDFromEmail извлекает Telegram ID из email клиента ("123", "123_...", "123 до ...").
+// Клиенты с другими email (места семейного тарифа, ручные) пользователям бота не принадлежат.
+func telegramIDFromEmail(email string) (int64, bool) {
+	prefix := email
+	if i := strings.IndexAny(email, "_ "); i >= 0 {
+		prefix = email[:i]
+	}
+	id, err := strconv.ParseInt(prefix, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// planPanelReconcile сравнивает клиентов inbound'а с пользователями сервера.
+// Возвращает расхождения и список клиентов inbound'а после исправления.
+func planPanelReconcile(serverID string, clients []Client, users []reconcileUser, now time.Time) ([]PanelDrift, []Client) {
+	nowMs := now.UnixMilli()
+	usersByID := make(map[int64]*reconcileUser, len(users))
+	for i := range users {
+		usersByID[users[i].TelegramID] = &users[i]
+	}
+
+	var drifts []PanelDrift
+	var result []Client
+
+	// Клиенты пользователей бота по Telegram ID, остальные переносятся как есть
+	byUser := make(map[int64][]Client)
+	var order []int64
+	for _, client := range clients {
+		telegramID, ok := telegramIDFromEmail(client.Email)
+		if !ok {
+			result = append(result, client)
+			continue
+		}
+		if _, seen := byUser[telegramID]; !seen {
+			order = append(order, telegramID)
+		}
+		byUser[telegramID] = append(byUser[telegramID], client)
+	}
+
+	for _, telegramID := range order {
+		userClients := byUser[telegramID]
+		user := usersByID[telegramID]
+
+		if user == nil {
+			for _, client := range userClients {
+				drifts = append(drifts, PanelDrift{ServerID: serverID, Kind: DriftOrphan, TelegramID: telegramID, Email: client.Email,
+					Details: "пользователь не найден на этом сервере, клиент удаляется"})
+			}
+			continue
+		}
+
+		// Оставляем клиента с ключом из базы, иначе последнего обновленного
+		keep := 0
+		for i := 1; i < len(userClients); i++ {
+			candidate, kept := userClients[i], userClients[keep]
+			if (candidate.ID == user.ClientID) != (kept.ID == user.ClientID) {
+				if candidate.ID == user.ClientID {
+					keep = i
+				}
+				continue
+			}
+			if candidate.UpdatedAt > kept.UpdatedAt {
+				keep = i
+			}
+		}
+		for i, client := range userClients {
+			if i != keep {
+				drifts = append(drifts, PanelDrift{ServerID: serverID, Kind: DriftDuplicate, TelegramID: telegramID, Email: client.Email,
+					Details: fmt.Sprintf("дубликат клиента %s удаляется", userClients[keep].Email)})
+			}
+		}
+
+		client := userClients[keep]
+		paid := user.isPaid(nowMs)
+
+		switch {
+		case paid && absInt64(client.ExpiryTime-user.ExpiryTime) > reconcileExpiryTolerance:
+			drifts = append(drifts, PanelDrift{ServerID: serverID, Kind: DriftExpiry, TelegramID: telegramID, Email: client.Email,
+				Details: fmt.Sprintf("в панели до %s, в базе до %s", formatReconcileTime(client.ExpiryTime), formatReconcileTime(user.ExpiryTime))})
+			client.ExpiryTime = user.ExpiryTime
+			client.Enable = !user.QuotaBlocked
+			client.UpdatedAt = nowMs
+		case paid && !client.Enable && !user.QuotaBlocked:
+			drifts = append(drifts, PanelDrift{ServerID: serverID, Kind: DriftExpiry, TelegramID: telegramID, Email: client.Email,
+				Details: fmt.Sprintf("клиент отключен, подписка в базе до %s", formatReconcileTime(user.ExpiryTime))})
+			client.Enable = true
+			client.UpdatedAt = nowMs
+		case !paid && client.Enable && (TARIFF_MODE_ENABLED || user.Balance < float64(PRICE_PER_DAY)):
+			// В режиме автосписания пользователь с балансом получит конфиг от автосписания
+			drifts = append(drifts, PanelDrift{ServerID: serverID, Kind: DriftUnpaid, TelegramID: telegramID, Email: client.Email,
+				Details: fmt.Sprintf("подписка в базе закончилась, баланс %.2f₽, клиент отключается", user.Balance)})
+			client.Enable = false
+			if client.ExpiryTime > nowMs {
+				client.ExpiryTime = nowMs
+			}
+			client.UpdatedAt = nowMs
+		}
+
+		if client.ID != user.ClientID || client.SubID != user.SubID {
+			// Ключ из панели уже стоит в приложении пользователя - исправляем базу
+			dbClient := client
+			drifts = append(drifts, PanelDrift{ServerID: serverID, Kind: DriftKeys, TelegramID: telegramID, Email: client.Email,
+				Details:  fmt.Sprintf("в базе %s/%s, в панели %s/%s", shortKey(user.ClientID), user.SubID, shortKey(client.ID), client.SubID),
+				dbClient: &dbClient})
+		}
+
+		result = append(result, client)
+	}
+
+	for i := range users {
+		user := &users[i]
+		if _, found := byUser[user.TelegramID]; found || !user.isPaid(nowMs) {
+			continue
+		}
+
+		client := Client{
+			ID:         user.ClientID,
+			Flow:       "xtls-rprx-vision",
+			Email:      user.Email,
+			ExpiryTime: user.ExpiryTime,
+			Enable:     !user.QuotaBlocked,
+			SubID:      user.SubID,
+			CreatedAt:  nowMs,
+			UpdatedAt:  nowMs,
+		}
+		if client.ID == "" {
+			client.ID = uuid.New().String()
+		}
+		if client.SubID == "" {
+			client.SubID = GenerateSubID()
+		}
+		if id, ok := telegramIDFromEmail(client.Email); !ok || id != user.TelegramID {
+			client.Email = strconv.FormatInt(user.TelegramID, 10)
+		}
+
+		drifts = append(drifts, PanelDrift{ServerID: serverID, Kind: DriftMissing, TelegramID: user.TelegramID, Email: client.Email,
+			Details:  fmt.Sprintf("подписка в базе до %s, клиент создается", formatReconcileTime(user.ExpiryTime)),
+			dbClient: &client})
+		result = append(result, client)
+	}
+
+	return drifts, result
+}
+
+// absInt64 возвращает модуль числа
+func absInt64(value int64) int64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// formatReconcileTime форматирует срок клиента для отчета
+func formatReconcileTime(expiryTime int64) string {
+	if expiryTime <= 0 {
+		return "∞"
+	}
+	return time.UnixMilli(expiryTime).Format("02.01.2006 15:04")
+}
+
+// shortKey сокращает UUID для отчета
+func shortKey(key string) string {
+	if len(key) > 8 {
+		return key[:8]
+	}
+	if key == "" {
+		return "-"
+	}
+	return key
+}
+
+// getReconcileUsers возвращает пользователей, назначенных на сервер
+func getReconcileUsers(serverID string) ([]reconcileUser, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query(`
+		SELECT u.telegram_id, COALESCE(u.client_id, ''), COALESCE(u.sub_id, ''), COALESCE(u.email, ''),
+			COALESCE(u.expiry_time, 0), u.has_active_config, u.balance, COALESCE(q.blocked, false)
+		FROM users u
+		LEFT JOIN traffic_quota_state q ON q.telegram_id = u.telegram_id
+		WHERE COALESCE(NULLIF(u.server_id, ''), $1) = $2`, DefaultServerID, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения пользователей сервера %s: %v", serverID, err)
+	}
+	defer rows.Close()
+
+	var users []reconcileUser
+	for rows.Next() {
+		var user reconcileUser
+		if err := rows.Scan(&user.TelegramID, &user.ClientID, &user.SubID, &user.Email,
+			&user.ExpiryTime, &user.HasActiveConfig, &user.Balance, &user.QuotaBlocked); err != nil {
+			return nil, fmt.Errorf("ошибка чтения пользователя: %v", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// reconcileServer сверяет пользователей сервера с клиентами его inbound'а и при apply исправляет расхождения
+func reconcileServer(server *Server, apply bool, report *PanelReconcileReport) error {
+	users, err := getReconcileUsers(server.ID)
+	if err != nil {
+		return err
+	}
+
+	sessionCookie, err := LoginServer(server)
+	if err != nil {
+		return fmt.Errorf("ошибка авторизации в панели: %v", err)
+	}
+	inbound, settings, err := getInboundSettings(sessionCookie)
+	if err != nil {
+		return err
+	}
+
+	drifts, clients := planPanelReconcile(server.ID, settings.Clients, users, time.Now())
+	report.Servers++
+	report.Clients += len(settings.Clients)
+	report.Users += len(users)
+
+	if !apply || len(drifts) == 0 {
+		report.Drifts = append(report.Drifts, drifts...)
+		return nil
+	}
+
+	// Все исправления панели применяются одним обновлением inbound'а
+	var panelErr error
+	panelChanged := false
+	for _, drift := range drifts {
+		if drift.Kind != DriftKeys {
+			panelChanged = true
+		}
+	}
+	if panelChanged {
+		settings.Clients = clients
+		settingsJSON, err := json.Marshal(settings)
+		if err != nil {
+			panelErr = fmt.Errorf("ошибка сериализации settings: %v", err)
+		} else {
+			inbound.Settings = string(settingsJSON)
+			panelErr = updateInbound(sessionCookie, *inbound)
+		}
+	}
+
+	for i := range drifts {
+		drift := &drifts[i]
+		if drift.Kind != DriftKeys && panelErr != nil {
+			drift.Error = panelErr.Error()
+		} else if drift.dbClient != nil {
+			if err := updateUserClientKeys(drift.TelegramID, drift.dbClient); err != nil {
+				drift.Error = err.Error()
+			}
+		}
+		drift.Applied = drift.Error == ""
+
+		if drift.Applied {
+			log.Printf("PANEL_RECONCILE: ✅ Сервер %s, %s, пользователь %d (%s): %s", drift.ServerID, drift.Kind, drift.TelegramID, drift.Email, drift.Details)
+		} else {
+			log.Printf("PANEL_RECONCILE: ❌ Сервер %s, %s, пользователь %d (%s): %s", drift.ServerID, drift.Kind, drift.TelegramID, drift.Email, drift.Error)
+		}
+	}
+
+	report.Drifts = append(report.Drifts, drifts...)
+	return nil
+}
+
+// updateUserClientKeys записывает ключ, subId и email клиента панели пользователю
+func updateUserClientKeys(telegramID int64, client *Client) error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec("UPDATE users SET client_id = $1, sub_id = $2, email = $3, updated_at = NOW() WHERE telegram_id = $4",
+		client.ID, client.SubID, client.Email, telegramID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления ключей пользователя %d: %v", telegramID, err)
+	}
+	return nil
+}
+
+// ReconcilePanels сверяет базу с клиентами панелей 3x-ui всех серверов.
+// Без apply только формирует отчет, с apply исправляет расхождения с логированием каждого изменения.
+// Серверы Marzban не сверяются, клиенты серверов Xray синхронизирует SyncXrayServer.
+func ReconcilePanels(apply bool) (*PanelReconcileReport, error) {
+	loads, err := GetServerLoads()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PanelReconcileReport{StartedAt: time.Now(), Apply: apply}
+	for _, load := range loads {
+		server := load.Server
+		if server.ID == DefaultServerID {
+			server = DefaultServer()
+		}
+		if server.BackendType() != BackendXUI {
+			continue
+		}
+		if IsServerDown(server.ID) {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: сервер недоступен", server.ID))
+			continue
+		}
+
+		if err := reconcileServer(server, apply, report); err != nil {
+			log.Printf("PANEL_RECONCILE: Ошибка сверки сервера %s: %v", server.ID, err)
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", server.ID, err))
+		}
+	}
+
+	log.Printf("PANEL_RECONCILE: Сверка завершена (apply=%v): серверов %d, клиентов %d, пользователей %d, расхождений %d",
+		apply, report.Servers, report.Clients, report.Users, len(report.Drifts))
+	return report, nil
+}
+
+// panelDriftTitles названия видов расхождений для отчета
+var panelDriftTitles = map[string]string{
+	DriftOrphan:    "👻 Лишние клиенты в панели",
+	DriftMissing:   "➕ Нет клиента у оплаченных пользователей",
+	DriftExpiry:    "⏱ Расхождение срока",
+	DriftUnpaid:    "💸 Включены без оплаты",
+	DriftDuplicate: "👥 Дубликаты",
+	DriftKeys:      "🔑 Ключи в базе отличаются от панели",
+}
+
+// panelDriftOrder порядок видов расхождений в отчете
+var panelDriftOrder = []string{DriftMissing, DriftUnpaid, DriftExpiry, DriftOrphan, DriftDuplicate, DriftKeys}
+
+// maxReportDrifts сколько расхождений каждого вида показывать в отчете
+const maxReportDrifts = 5
+
+// FormatPanelReconcileReport формирует отчет сверки для администратора
+func FormatPanelReconcileReport(report *PanelReconcileReport) string {
+	mode := "🔍 Сверка с панелями (без изменений)"
+	if report.Apply {
+		mode = "🛠 Сверка с панелями (исправление)"
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s\n\nСерверов: %d, клиентов в панелях: %d, пользователей: %d\n",
+		mode, report.Servers, report.Clients, report.Users)
+
+	if len(report.Drifts) == 0 {
+		text.WriteString("\n✅ Расхождений нет")
+	}
+
+	for _, kind := range panelDriftOrder {
+		var items []PanelDrift
+		for _, drift := range report.Drifts {
+			if drift.Kind == kind {
+				items = append(items, drift)
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&text, "\n%s: %d\n", panelDriftTitles[kind], len(items))
+		for i, drift := range items {
+			if i == maxReportDrifts {
+				fmt.Fprintf(&text, "  ... и еще %d\n", len(items)-maxReportDrifts)
+				break
+			}
+			status := ""
+			if report.Apply {
+				status = "✅ "
+				if !drift.Applied {
+					status = "❌ "
+				}
+			}
+			fmt.Fprintf(&text, "  %s[%s] %s: %s\n", status, drift.ServerID, drift.Email, drift.Details)
+		}
+	}
+
+	for _, serverErr := range report.Errors {
+		fmt.Fprintf(&text, "\n⚠️ %s", serverErr)
+	}
+
+	if !report.Apply && len(report.Drifts) > 0 {
+		text.WriteString("\n\nИсправить: /panel_reconcile apply")
+	}
+	return text.String()
+}
@@ -0,0 +1,132 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanPanelReconcile(t *testing.T) {
+	oldTariffMode, oldPrice := TARIFF_MODE_ENABLED, PRICE_PER_DAY
+	TARIFF_MODE_ENABLED, PRICE_PER_DAY = false, 10
+	defer func() { TARIFF_MODE_ENABLED, PRICE_PER_DAY = oldTariffMode, oldPrice }()
+
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	nowMs := now.UnixMilli()
+	paidUntil := now.Add(10 * 24 * time.Hour).UnixMilli()
+	expired := now.Add(-24 * time.Hour).UnixMilli()
+
+	clients := []Client{
+		// Место семейного тарифа - не трогаем
+		{ID: "seat", Email: "family_seat_1", Enable: true},
+		// Пользователя нет на сервере
+		{ID: "orphan", Email: "100", Enable: true, ExpiryTime: paidUntil},
+		// Дубликаты: остается клиент с ключом из базы
+		{ID: "dup-new", Email: "200_2", Enable: true, ExpiryTime: paidUntil, UpdatedAt: 2},
+		{ID: "dup-db", Email: "200", Enable: true, ExpiryTime: paidUntil, UpdatedAt: 1, SubID: "sub200"},
+		// Срок в панели отстает от базы
+		{ID: "exp", Email: "300", Enable: true, ExpiryTime: nowMs + 1000, SubID: "sub300"},
+		// Подписка закончилась, баланса не хватает
+		{ID: "unpaid", Email: "400", Enable: true, ExpiryTime: paidUntil, SubID: "sub400"},
+		// Подписка закончилась, но баланс покроет автосписание
+		{ID: "balance", Email: "500", Enable: true, ExpiryTime: paidUntil, SubID: "sub500"},
+		// В базе другой ключ
+		{ID: "panel-key", Email: "600", Enable: true, ExpiryTime: paidUntil, SubID: "sub600"},
+		// Отключен по лимиту трафика при оплаченной подписке
+		{ID: "quota", Email: "900", Enable: false, ExpiryTime: paidUntil, SubID: "sub900"},
+	}
+	users := []reconcileUser{
+		{TelegramID: 200, ClientID: "dup-db", SubID: "sub200", ExpiryTime: paidUntil, HasActiveConfig: true},
+		{TelegramID: 300, ClientID: "exp", SubID: "sub300", ExpiryTime: paidUntil, HasActiveConfig: true},
+		{TelegramID: 400, ClientID: "unpaid", SubID: "sub400", ExpiryTime: expired, HasActiveConfig: true, Balance: 5},
+		{TelegramID: 500, ClientID: "balance", SubID: "sub500", ExpiryTime: expired, HasActiveConfig: true, Balance: 50},
+		{TelegramID: 600, ClientID: "db-key", SubID: "sub600", ExpiryTime: paidUntil, HasActiveConfig: true},
+		{TelegramID: 700, Email: "700", ExpiryTime: paidUntil, HasActiveConfig: true},
+		{TelegramID: 800, ExpiryTime: expired},
+		{TelegramID: 900, ClientID: "quota", SubID: "sub900", ExpiryTime: paidUntil, HasActiveConfig: true, QuotaBlocked: true},
+	}
+
+	drifts, result := planPanelReconcile("nl", clients, users, now)
+
+	kinds := make(map[int64][]string)
+	for _, drift := range drifts {
+		kinds[drift.TelegramID] = append(kinds[drift.TelegramID], drift.Kind)
+	}
+	expected := map[int64][]string{
+		100: {DriftOrphan},
+		200: {DriftDuplicate},
+		300: {DriftExpiry},
+		400: {DriftUnpaid},
+		600: {DriftKeys},
+		700: {DriftMissing},
+	}
+	if len(kinds) != len(expected) {
+		t.Fatalf("Ожидались расхождения %v, получено %v", expected, kinds)
+	}
+	for telegramID, want := range expected {
+		got := kinds[telegramID]
+		if len(got) != len(want) || got[0] != want[0] {
+			t.Errorf("Пользователь %d: ожидалось %v, получено %v", telegramID, want, got)
+		}
+	}
+
+	byEmail := make(map[string]Client)
+	for _, client := range result {
+		byEmail[client.Email] = client
+	}
+	if len(result) != 8 {
+		t.Fatalf("Ожидалось 8 клиентов после исправления, получено %d", len(result))
+	}
+	if _, ok := byEmail["family_seat_1"]; !ok {
+		t.Error("Клиент места семейного тарифа не должен удаляться")
+	}
+	if _, ok := byEmail["100"]; ok {
+		t.Error("Клиент без пользователя должен удаляться")
+	}
+	if client, ok := byEmail["200"]; !ok || client.ID != "dup-db" {
+		t.Errorf("Из дубликатов должен остаться клиент с ключом из базы, получено %+v", client)
+	}
+	if client := byEmail["300"]; client.ExpiryTime != paidUntil {
+		t.Errorf("Срок клиента должен браться из базы: %d, получено %d", paidUntil, client.ExpiryTime)
+	}
+	if client := byEmail["400"]; client.Enable || client.ExpiryTime > nowMs {
+		t.Errorf("Неоплаченный клиент должен отключаться, получено %+v", client)
+	}
+	if client := byEmail["500"]; !client.Enable {
+		t.Error("Клиент с балансом для автосписания не должен отключаться")
+	}
+	if client := byEmail["600"]; client.ID != "panel-key" {
+		t.Errorf("Ключ клиента в панели не должен меняться, получено %s", client.ID)
+	}
+	if client := byEmail["900"]; client.Enable {
+		t.Error("Клиент, отключенный по лимиту трафика, не должен включаться сверкой")
+	}
+	if client, ok := byEmail["700"]; !ok || client.ID == "" || client.SubID == "" || !client.Enable {
+		t.Errorf("Отсутствующий клиент должен создаваться с ключом и подпиской, получено %+v", client)
+	}
+
+	for _, drift := range drifts {
+		if (drift.Kind == DriftKeys || drift.Kind == DriftMissing) && drift.dbClient == nil {
+			t.Errorf("Расхождение %s пользователя %d должно обновлять базу", drift.Kind, drift.TelegramID)
+		}
+	}
+}
+
+func TestTelegramIDFromEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		id    int64
+		ok    bool
+	}{
+		{"123", 123, true},
+		{"123_2", 123, true},
+		{"123 до 01.02.2026", 123, true},
+		{"family_seat_1", 0, false},
+		{"manual", 0, false},
+	}
+	for _, test := range tests {
+		id, ok := telegramIDFromEmail(test.email)
+		if ok != test.ok || (ok && id != test.id) {
+			t.Errorf("telegramIDFromEmail(%q) = %d, %v; ожидалось %d, %v", test.email, id, ok, test.id, test.ok)
+		}
+	}
+}
@@ -138,8 +138,13 @@ func syncUserWithPanel(user *User) {
 		return
 	}
 
+	// Синхронизация читает клиентов inbound'а и доступна только для панелей 3x-ui
+	if GetUserServer(user.TelegramID).BackendType() != BackendXUI {
+		return
+	}
+
 	// Авторизуемся в панели
-	sessionCookie, err := Login()
+	sessionCookie, err := LoginForUser(user.TelegramID)
 	if err != nil {
 		log.Printf("SYNC_PANEL: Ошибка авторизации для пользователя %d: %v", user.TelegramID, err)
 		return
@@ -390,20 +395,36 @@ func UpdateUserPG(user *User) error {
 	return nil
 }
 
-// AddBalance добавляет баланс пользователю
-func AddBalancePG(telegramID int64, amount float64) error {
-	query := `
+// addBalanceQuery пополняет баланс и сумму оплат пользователя
+const addBalanceQuery = `
 		UPDATE users SET 
 			balance = balance + $2,
 			total_paid = total_paid + $2,
 			updated_at = $3
 		WHERE telegram_id = $1`
 
-	_, err := db.Exec(query, telegramID, amount, time.Now())
+// AddBalance добавляет баланс пользователю
+func AddBalancePG(telegramID int64, amount float64) error {
+	_, err := db.Exec(addBalanceQuery, telegramID, amount, time.Now())
 	if err != nil {
 		return fmt.Errorf("ошибка добавления баланса: %v", err)
 	}
 
+	AfterBalanceTopup(telegramID, amount)
+	return nil
+}
+
+// AddBalanceTx добавляет баланс пользователю в транзакции.
+// После фиксации транзакции вызывающий код должен вызвать AfterBalanceTopup.
+func AddBalanceTx(tx *sql.Tx, telegramID int64, amount float64) error {
+	if _, err := tx.Exec(addBalanceQuery, telegramID, amount, time.Now()); err != nil {
+		return fmt.Errorf("ошибка добавления баланса: %v", err)
+	}
+	return nil
+}
+
+// AfterBalanceTopup уведомляет администратора о пополнении и пересчитывает период подписки
+func AfterBalanceTopup(telegramID int64, amount float64) {
 	// Отправляем уведомление администратору о пополнении баланса
 	user, err := GetUserByTelegramID(telegramID)
 	if err != nil {
@@ -419,8 +440,36 @@ func AddBalancePG(telegramID int64, amount float64) error {
 		log.Printf("POSTGRES: Запуск принудительного пересчета после пополнения баланса для пользователя %d на сумму %.2f₽", telegramID, amount)
 		ForceBalanceRecalculation(telegramID)
 	}()
+}
 
-	return nil
+// deductBalanceQuery списывает баланс и уменьшает сумму оплат пользователя
+const deductBalanceQuery = `
+		UPDATE users SET 
+			balance = balance - $2,
+			total_paid = GREATEST(total_paid - $2, 0),
+			updated_at = $3
+		WHERE telegram_id = $1
+		RETURNING balance`
+
+// DeductBalancePG списывает средства с баланса (например, при возврате платежа) и возвращает новый баланс
+func DeductBalancePG(telegramID int64, amount float64) (float64, error) {
+	var balance float64
+	err := db.QueryRow(deductBalanceQuery, telegramID, amount, time.Now()).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка списания баланса: %v", err)
+	}
+
+	return balance, nil
+}
+
+// DeductBalanceTx списывает средства с баланса в транзакции и возвращает новый баланс
+func DeductBalanceTx(tx *sql.Tx, telegramID int64, amount float64) (float64, error) {
+	var balance float64
+	err := tx.QueryRow(deductBalanceQuery, telegramID, amount, time.Now()).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка списания баланса: %v", err)
+	}
+	return balance, nil
 }
 
 // UpdateTrialFlag обновляет флаг использования пробного периода
@@ -0,0 +1,543 @@
+package common
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Состояния серверов по результатам проверок
+const (
+	HealthStatusHealthy  = "healthy"  // Панель и все inbound'ы доступны
+	HealthStatusDegraded = "degraded" // Часть inbound'ов недоступна, высокая задержка или единичный сбой панели
+	HealthStatusDown     = "down"     // Панель недоступна HEALTH_FAILURE_THRESHOLD проверок подряд
+)
+
+// ServerHealth накопленное состояние сервера
+type ServerHealth struct {
+	ServerID            string
+	Status              string
+	LatencyMs           int
+	ChecksTotal         int
+	ChecksOK            int
+	ConsecutiveFailures int
+	LastError           string
+	LastCheckAt         time.Time
+	StatusChangedAt     time.Time
+}
+
+// HealthProbe результат одной проверки сервера
+type HealthProbe struct {
+	Latency time.Duration // Время авторизации в панели
+	PanelOK bool
+	Errors  []string // Недоступные панель и inbound'ы
+}
+
+// Uptime возвращает долю успешных проверок в процентах
+func (h *ServerHealth) Uptime() float64 {
+	if h.ChecksTotal == 0 {
+		return 100
+	}
+	return float64(h.ChecksOK) * 100 / float64(h.ChecksTotal)
+}
+
+// CreateServerHealthTables создает таблицу состояния серверов
+func CreateServerHealthTables() error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS server_health (
+		server_id VARCHAR(64) PRIMARY KEY,
+		status VARCHAR(16) NOT NULL DEFAULT 'healthy',
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		checks_total INTEGER NOT NULL DEFAULT 0,
+		checks_ok INTEGER NOT NULL DEFAULT 0,
+		consecutive_failures INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		last_check_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		status_changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+	ALTER TABLE server_health ALTER COLUMN server_id TYPE VARCHAR(64);`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы server_health: %v", err)
+	}
+
+	return nil
+}
+
+// ProbeServer проверяет API панели и порты всех inbound'ов сервера
+func ProbeServer(server *Server) HealthProbe {
+	var probe HealthProbe
+
+	// У Marzban проверяется только API панели: inbound'ы настраиваются в ядре, а не в панели
+	if server.BackendType() == BackendMarzban {
+		start := time.Now()
+		err := NewMarzbanBackend(server).ping()
+		probe.Latency = time.Since(start)
+		if err != nil {
+			probe.Errors = append(probe.Errors, fmt.Sprintf("панель: %v", err))
+			return probe
+		}
+		probe.PanelOK = true
+		return probe
+	}
+
+	// У Xray без панели проверяется gRPC API и порт единственного inbound'а
+	if server.BackendType() == BackendXray {
+		start := time.Now()
+		_, err := XrayUptime(server.PanelURL)
+		probe.Latency = time.Since(start)
+		if err != nil {
+			probe.Errors = append(probe.Errors, fmt.Sprintf("API Xray: %v", err))
+			return probe
+		}
+		probe.PanelOK = true
+
+		inbound := server.XrayInbound()
+		address := net.JoinHostPort(inbound.Listen, strconv.Itoa(inbound.Port))
+		conn, err := net.DialTimeout("tcp", address, time.Duration(HEALTH_CHECK_TIMEOUT)*time.Second)
+		if err != nil {
+			probe.Errors = append(probe.Errors, fmt.Sprintf("inbound %s (%s): %v", inbound.Tag, address, err))
+			return probe
+		}
+		conn.Close()
+		return probe
+	}
+
+	sessionCookie, latency, err := probeXUIPanel(server)
+	probe.Latency = latency
+	if err != nil {
+		probe.Errors = append(probe.Errors, fmt.Sprintf("панель: %v", err))
+		return probe
+	}
+	probe.PanelOK = true
+
+	timeout := time.Duration(HEALTH_CHECK_TIMEOUT) * time.Second
+	for _, inboundID := range server.InboundIDs {
+		inbound, err := GetInboundByID(sessionCookie, inboundID)
+		if err != nil {
+			probe.Errors = append(probe.Errors, fmt.Sprintf("inbound %d: %v", inboundID, err))
+			continue
+		}
+		if !inbound.Enable {
+			probe.Errors = append(probe.Errors, fmt.Sprintf("inbound %d отключен в панели", inboundID))
+			continue
+		}
+
+		address := net.JoinHostPort(server.InboundAddress(inbound), strconv.Itoa(inbound.Port))
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			probe.Errors = append(probe.Errors, fmt.Sprintf("inbound %d (%s): %v", inboundID, address, err))
+			continue
+		}
+		conn.Close()
+	}
+
+	return probe
+}
+
+// probeXUIPanel проверяет API панели 3x-ui запросом основного inbound'а и возвращает его задержку.
+// Сессия панели кэшируется, поэтому вход не показывает доступность панели - время измеряется по запросу к API.
+// Устаревшая сессия сбрасывается при ошибке запроса, и проверка повторяется один раз с новым входом.
+func probeXUIPanel(server *Server) (string, time.Duration, error) {
+	var latency time.Duration
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var sessionCookie string
+		sessionCookie, err = LoginServer(server)
+		if err != nil {
+			return "", 0, err
+		}
+
+		start := time.Now()
+		_, err = GetInboundByID(sessionCookie, server.PrimaryInboundID())
+		latency = time.Since(start)
+		if err == nil {
+			return sessionCookie, latency, nil
+		}
+	}
+	return "", latency, err
+}
+
+// nextHealthStatus определяет состояние сервера по проверке и числу сбоев панели подряд
+func nextHealthStatus(probe HealthProbe, consecutiveFailures int) string {
+	if !probe.PanelOK {
+		if consecutiveFailures >= HEALTH_FAILURE_THRESHOLD {
+			return HealthStatusDown
+		}
+		return HealthStatusDegraded
+	}
+	if len(probe.Errors) > 0 || probe.Latency > time.Duration(HEALTH_LATENCY_DEGRADED_MS)*time.Millisecond {
+		return HealthStatusDegraded
+	}
+	return HealthStatusHealthy
+}
+
+// recordServerHealth сохраняет результат проверки и возвращает предыдущее и новое состояние
+func recordServerHealth(serverID string, probe HealthProbe) (*ServerHealth, *ServerHealth, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	previous, err := GetServerHealth(serverID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current := *previous
+	current.ChecksTotal++
+	current.LatencyMs = int(probe.Latency.Milliseconds())
+	current.LastError = strings.Join(probe.Errors, "; ")
+	current.LastCheckAt = time.Now()
+	if probe.PanelOK {
+		current.ConsecutiveFailures = 0
+	} else {
+		current.ConsecutiveFailures++
+	}
+	if probe.PanelOK && len(probe.Errors) == 0 {
+		current.ChecksOK++
+	}
+	current.Status = nextHealthStatus(probe, current.ConsecutiveFailures)
+	if current.Status != previous.Status {
+		current.StatusChangedAt = current.LastCheckAt
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO server_health (server_id, status, latency_ms, checks_total, checks_ok, consecutive_failures,
+			last_error, last_check_at, status_changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (server_id) DO UPDATE SET
+			status = EXCLUDED.status, latency_ms = EXCLUDED.latency_ms, checks_total = EXCLUDED.checks_total,
+			checks_ok = EXCLUDED.checks_ok, consecutive_failures = EXCLUDED.consecutive_failures,
+			last_error = EXCLUDED.last_error, last_check_at = EXCLUDED.last_check_at,
+			status_changed_at = EXCLUDED.status_changed_at`,
+		serverID, current.Status, current.LatencyMs, current.ChecksTotal, current.ChecksOK, current.ConsecutiveFailures,
+		current.LastError, current.LastCheckAt, current.StatusChangedAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка сохранения состояния сервера %s: %v", serverID, err)
+	}
+
+	return previous, &current, nil
+}
+
+// GetServerHealth возвращает состояние сервера. Непроверенный сервер считается исправным.
+func GetServerHealth(serverID string) (*ServerHealth, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	health := &ServerHealth{ServerID: serverID}
+	err := db.QueryRow(`
+		SELECT status, latency_ms, checks_total, checks_ok, consecutive_failures, last_error, last_check_at, status_changed_at
+		FROM server_health WHERE server_id = $1`, serverID).
+		Scan(&health.Status, &health.LatencyMs, &health.ChecksTotal, &health.ChecksOK, &health.ConsecutiveFailures,
+			&health.LastError, &health.LastCheckAt, &health.StatusChangedAt)
+	if err == sql.ErrNoRows {
+		health.Status = HealthStatusHealthy
+		return health, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения состояния сервера %s: %v", serverID, err)
+	}
+	return health, nil
+}
+
+// IsServerDown проверяет, признан ли сервер недоступным
+func IsServerDown(serverID string) bool {
+	if !HEALTH_CHECK_ENABLED {
+		return false
+	}
+
+	health, err := GetServerHealth(serverID)
+	if err != nil {
+		log.Printf("SERVER_HEALTH: %v", err)
+		return false
+	}
+	return health.Status == HealthStatusDown
+}
+
+// healthCheckServers возвращает проверяемые серверы: основной из конфигурации и включенные из реестра
+func healthCheckServers() []*Server {
+	servers := []*Server{DefaultServer()}
+
+	loads, err := GetServerLoads()
+	if err != nil {
+		log.Printf("SERVER_HEALTH: %v, проверяется только основной сервер", err)
+		return servers
+	}
+
+	for _, load := range loads {
+		if load.Server.ID != DefaultServerID && load.Server.Enabled {
+			servers = append(servers, load.Server)
+		}
+	}
+	return servers
+}
+
+// CheckServersHealth проверяет все серверы, уведомляет администратора о смене состояния
+// и при HEALTH_AUTO_MIGRATE переносит пользователей с недоступных серверов
+func CheckServersHealth(bot *tgbotapi.BotAPI) error {
+	var failed []string
+	for _, server := range healthCheckServers() {
+		probe := ProbeServer(server)
+
+		// Ошибка сохранения одного сервера не останавливает проверку остальных
+		previous, current, err := recordServerHealth(server.ID, probe)
+		if err != nil {
+			log.Printf("SERVER_HEALTH: %v", err)
+			failed = append(failed, server.ID)
+			continue
+		}
+
+		if current.Status == previous.Status {
+			continue
+		}
+
+		log.Printf("SERVER_HEALTH: Сервер %s: %s → %s (%s)", server.ID, previous.Status, current.Status, current.LastError)
+		sendServerHealthAlert(bot, server, previous, current)
+
+		if current.Status == HealthStatusDown && HEALTH_AUTO_MIGRATE {
+			moved, failed := MigrateServerUsers(bot, server)
+			log.Printf("SERVER_HEALTH: С сервера %s перенесено пользователей: %d, ошибок: %d", server.ID, moved, failed)
+			if bot != nil && (moved > 0 || failed > 0) {
+				bot.Send(tgbotapi.NewMessage(ADMIN_ID, fmt.Sprintf("🔀 С сервера %s перенесено пользователей: %d, ошибок: %d",
+					server.Location, moved, failed)))
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("не удалось сохранить состояние серверов: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// healthStatusIcon возвращает значок состояния сервера
+func healthStatusIcon(status string) string {
+	switch status {
+	case HealthStatusDown:
+		return "🔴"
+	case HealthStatusDegraded:
+		return "🟡"
+	}
+	return "🟢"
+}
+
+// sendServerHealthAlert уведомляет администратора о смене состояния сервера
+func sendServerHealthAlert(bot *tgbotapi.BotAPI, server *Server, previous, current *ServerHealth) {
+	if bot == nil {
+		return
+	}
+
+	text := fmt.Sprintf("%s Сервер %s (%s): %s → %s\n\n⏱ Задержка панели: %d мс\n📈 Доступность: %.1f%%",
+		healthStatusIcon(current.Status), server.Location, server.ID, previous.Status, current.Status,
+		current.LatencyMs, current.Uptime())
+	if current.LastError != "" {
+		text += "\n\n❗ " + current.LastError
+	}
+	if current.Status == HealthStatusDown && !HEALTH_AUTO_MIGRATE {
+		text += "\n\nНовые клиенты направляются на доступные серверы. Перенос пользователей выключен (HEALTH_AUTO_MIGRATE)."
+	}
+
+	if _, err := bot.Send(tgbotapi.NewMessage(ADMIN_ID, text)); err != nil {
+		log.Printf("SERVER_HEALTH: Ошибка отправки уведомления о сервере %s: %v", server.ID, err)
+	}
+}
+
+// PickHealthyServer выбирает наименее загруженный доступный сервер, кроме excludeID.
+// Возвращает nil, если свободных исправных серверов нет.
+func PickHealthyServer(excludeID string) *Server {
+	loads, err := GetServerLoads()
+	if err != nil {
+		log.Printf("SERVER_HEALTH: %v", err)
+		return nil
+	}
+
+	var best *ServerLoad
+	for i := range loads {
+		load := &loads[i]
+		if load.Server.ID == excludeID || !load.Server.Enabled || load.IsFull() {
+			continue
+		}
+
+		health, err := GetServerHealth(load.Server.ID)
+		if err != nil || health.Status != HealthStatusHealthy {
+			continue
+		}
+
+		if best == nil || load.Users < best.Users {
+			best = load
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+	if best.Server.ID == DefaultServerID {
+		return DefaultServer()
+	}
+	return best.Server
+}
+
+// failoverServerForNewClient назначает пользователю без активного конфига исправный сервер,
+// если его сервер недоступен. Возвращает nil, если сервер менять не нужно или некуда.
+func failoverServerForNewClient(telegramID int64, server *Server) *Server {
+	if !IsServerDown(server.ID) {
+		return nil
+	}
+
+	db := GetDatabasePG()
+	if db == nil {
+		return nil
+	}
+
+	var hasActiveConfig bool
+	var expiryTime int64
+	err := db.QueryRow("SELECT has_active_config, COALESCE(expiry_time, 0) FROM users WHERE telegram_id = $1", telegramID).
+		Scan(&hasActiveConfig, &expiryTime)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("SERVER_HEALTH: Ошибка получения пользователя %d: %v", telegramID, err)
+		return nil
+	}
+	if hasActiveConfig && expiryTime > time.Now().UnixMilli() {
+		// Действующий клиент уже на этом сервере - его переносит MigrateServerUsers
+		return nil
+	}
+
+	target := PickHealthyServer(server.ID)
+	if target == nil {
+		log.Printf("SERVER_HEALTH: Сервер %s недоступен, исправных серверов для пользователя %d нет", server.ID, telegramID)
+		return nil
+	}
+
+	if err := setUserServerID(telegramID, target.ID); err != nil {
+		log.Printf("SERVER_HEALTH: %v", err)
+		return nil
+	}
+
+	log.Printf("SERVER_HEALTH: Сервер %s недоступен, новый клиент %d направлен на %s", server.ID, telegramID, target.ID)
+	return target
+}
+
+// MigrateServerUsers переносит пользователей с активным конфигом с недоступного сервера на исправные.
+// Панель недоступна, поэтому клиент создается заново из данных базы с тем же ключом, subId и сроком.
+func MigrateServerUsers(bot *tgbotapi.BotAPI, server *Server) (int, int) {
+	db := GetDatabasePG()
+	if db == nil {
+		return 0, 0
+	}
+
+	rows, err := db.Query(`
+		SELECT telegram_id FROM users
+		WHERE COALESCE(NULLIF(server_id, ''), $1) = $2 AND has_active_config = true AND expiry_time > $3`,
+		DefaultServerID, server.ID, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("SERVER_HEALTH: Ошибка получения пользователей сервера %s: %v", server.ID, err)
+		return 0, 0
+	}
+	var telegramIDs []int64
+	for rows.Next() {
+		var telegramID int64
+		if err := rows.Scan(&telegramID); err != nil {
+			log.Printf("SERVER_HEALTH: Ошибка чтения пользователя сервера %s: %v", server.ID, err)
+			continue
+		}
+		telegramIDs = append(telegramIDs, telegramID)
+	}
+	rows.Close()
+
+	moved, failed := 0, 0
+	for _, telegramID := range telegramIDs {
+		// Ошибка одного пользователя не останавливает перенос остальных
+		user, err := GetUserByTelegramID(telegramID)
+		if err != nil {
+			log.Printf("SERVER_HEALTH: Ошибка получения пользователя %d для переноса с %s: %v", telegramID, server.ID, err)
+			failed++
+			continue
+		}
+
+		target := PickHealthyServer(server.ID)
+		if target == nil {
+			log.Printf("SERVER_HEALTH: Нет исправных серверов со свободными местами, перенос с %s остановлен", server.ID)
+			failed += len(telegramIDs) - moved - failed
+			break
+		}
+
+		if err := moveUserClient(user, target); err != nil {
+			log.Printf("SERVER_HEALTH: Ошибка переноса пользователя %d на %s: %v", telegramID, target.ID, err)
+			failed++
+			continue
+		}
+		moved++
+
+		if bot != nil {
+			bot.Send(tgbotapi.NewMessage(telegramID, fmt.Sprintf("⚠️ Сервер %s временно недоступен.\n\n"+
+				"Ваш конфиг перенесен на локацию %s, оставшийся срок сохранен. Обновите подписку в приложении.",
+				server.Location, target.Location)))
+		}
+	}
+
+	return moved, failed
+}
+
+// moveUserClient создает клиента пользователя на сервере по данным базы и назначает сервер пользователю
+func moveUserClient(user *User, target *Server) error {
+	if target.BackendType() != BackendXUI {
+		if err := recreateClientOnBackend(user, target); err != nil {
+			return err
+		}
+		return setUserServerID(user.TelegramID, target.ID)
+	}
+
+	sessionCookie, err := LoginServer(target)
+	if err != nil {
+		return fmt.Errorf("ошибка авторизации в панели %s: %v", target.ID, err)
+	}
+
+	email := user.Email
+	if email == "" {
+		email = strconv.FormatInt(user.TelegramID, 10)
+	}
+
+	client := Client{
+		ID:         user.ClientID,
+		Flow:       "xtls-rprx-vision",
+		Email:      email,
+		ExpiryTime: user.ExpiryTime,
+		Enable:     true,
+		TgID:       user.TelegramID,
+		SubID:      user.SubID,
+		UpdatedAt:  time.Now().UnixMilli(),
+	}
+	if err := upsertPanelClient(sessionCookie, client); err != nil {
+		return err
+	}
+
+	return setUserServerID(user.TelegramID, target.ID)
+}
+
+// serverHealthLine возвращает строку состояния сервера для отчета /servers
+func serverHealthLine(serverID string) string {
+	if !HEALTH_CHECK_ENABLED {
+		return ""
+	}
+
+	health, err := GetServerHealth(serverID)
+	if err != nil || health.ChecksTotal == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n   %s %.1f%%, %d мс, проверено %s",
+		healthStatusIcon(health.Status), health.Uptime(), health.LatencyMs, health.LastCheckAt.Format("02.01 15:04"))
+}
@@ -0,0 +1,628 @@
+package common
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultServerID ID основного сервера (PANEL_URL + INBOUND_ID).
+// Пользователи без назначенного сервера работают на нем.
+const DefaultServerID = "main"
+
+// Server сервер (локация) с панелью 3x-ui, Marzban или Xray без панели
+type Server struct {
+	ID         string // Идентификатор сервера (латиница, используется в callback'ах)
+	Location   string // Название локации для пользователя, например "🇳🇱 Нидерланды"
+	PanelURL   string // URL панели со слешем на конце
+	PanelUser  string
+	PanelPass  string
+	InboundIDs []int  // Inbound'ы панели; клиенты создаются в первом
+	SubURL     string // Базовый URL подписки панели (пусто - CONFIG_BASE_URL)
+	Capacity   int    // Максимум пользователей с активным конфигом (0 - без ограничения)
+	Enabled    bool   // Доступен ли сервер для выбора
+	Backend    string // Тип панели: "3x-ui" (по умолчанию), "marzban" или "xray"
+
+	// Только для Backend "xray": PanelURL - адрес gRPC API Xray "host:port",
+	// хост одновременно является адресом подключения клиентов
+	InboundTag     string // Тег inbound'а vless в конфиге Xray
+	InboundPort    int    // Порт inbound'а для клиентов
+	StreamSettings string // streamSettings inbound'а в формате 3x-ui (для ссылок подписки)
+}
+
+// ServerLoad сервер с количеством пользователей
+type ServerLoad struct {
+	Server *Server
+	Users  int // Пользователей с активным конфигом
+}
+
+// InboundAddress возвращает адрес подключения к inbound'у: listen inbound'а или хост панели сервера
+func (s *Server) InboundAddress(inbound *Inbound) string {
+	listen := strings.TrimSpace(inbound.Listen)
+	if listen != "" && listen != "0.0.0.0" && listen != "::" {
+		return listen
+	}
+
+	panelURL, err := url.Parse(s.PanelURL)
+	if err != nil {
+		return ""
+	}
+	return panelURL.Hostname()
+}
+
+// panelSessionTTL сколько кука сессии панели используется повторно без новой авторизации
+const panelSessionTTL = 10 * time.Minute
+
+// panelSession сессия панели сервера
+type panelSession struct {
+	server    *Server
+	cookie    string
+	previous  string // Кука до повторной авторизации: начатые с ней вызовы работают с тем же сервером
+	expiresAt time.Time
+}
+
+// panelSessions хранит одну сессию на сервер (по ID сервера),
+// чтобы функции панели по куке работали с сервером пользователя
+var (
+	panelSessions   = make(map[string]*panelSession)
+	panelSessionsMu sync.Mutex
+)
+
+// DefaultServer возвращает основной сервер из PANEL_URL, PANEL_USER, PANEL_PASS и INBOUND_ID
+func DefaultServer() *Server {
+	return &Server{
+		ID:         DefaultServerID,
+		Location:   DEFAULT_SERVER_LOCATION,
+		PanelURL:   PANEL_URL,
+		PanelUser:  PANEL_USER,
+		PanelPass:  PANEL_PASS,
+		InboundIDs: []int{INBOUND_ID},
+		SubURL:     CONFIG_BASE_URL,
+		Enabled:    true,
+		Backend:    DEFAULT_SERVER_BACKEND,
+	}
+}
+
+// PrimaryInboundID возвращает inbound, в котором создаются клиенты
+func (s *Server) PrimaryInboundID() int {
+	if len(s.InboundIDs) == 0 {
+		return INBOUND_ID
+	}
+	return s.InboundIDs[0]
+}
+
+// SubscriptionURL возвращает ссылку на подписку панели сервера
+func (s *Server) SubscriptionURL(subID string) string {
+	if s.SubURL == "" {
+		return CONFIG_BASE_URL + subID
+	}
+	return s.SubURL + subID
+}
+
+// cachedPanelSession возвращает действующую куку сервера, если параметры подключения к панели не менялись
+func cachedPanelSession(server *Server) (string, bool) {
+	panelSessionsMu.Lock()
+	defer panelSessionsMu.Unlock()
+
+	session := panelSessions[server.ID]
+	if session == nil || time.Now().After(session.expiresAt) {
+		return "", false
+	}
+	if session.server.PanelURL != server.PanelURL || session.server.PanelUser != server.PanelUser ||
+		session.server.PanelPass != server.PanelPass {
+		return "", false
+	}
+	return session.cookie, true
+}
+
+// rememberPanelSession сохраняет куку сессии как текущую сессию сервера
+func rememberPanelSession(sessionCookie string, server *Server) {
+	panelSessionsMu.Lock()
+	defer panelSessionsMu.Unlock()
+
+	session := panelSessions[server.ID]
+	if session == nil {
+		session = &panelSession{}
+		panelSessions[server.ID] = session
+	}
+	if session.cookie != sessionCookie {
+		session.previous = session.cookie
+	}
+	session.server = server
+	session.cookie = sessionCookie
+	session.expiresAt = time.Now().Add(panelSessionTTL)
+}
+
+// expirePanelSession помечает сессию устаревшей (панель ее не приняла) - следующий вход авторизуется заново
+func expirePanelSession(sessionCookie string) {
+	panelSessionsMu.Lock()
+	defer panelSessionsMu.Unlock()
+
+	for _, session := range panelSessions {
+		if session.cookie == sessionCookie {
+			session.expiresAt = time.Time{}
+		}
+	}
+}
+
+// sessionServer возвращает сервер, к которому относится кука (по умолчанию основной).
+// Сессий не больше двух на сервер, поэтому перебор быстрый.
+func sessionServer(sessionCookie string) *Server {
+	panelSessionsMu.Lock()
+	defer panelSessionsMu.Unlock()
+
+	for _, session := range panelSessions {
+		if session.cookie == sessionCookie || session.previous == sessionCookie {
+			return session.server
+		}
+	}
+	return DefaultServer()
+}
+
+// forEachXUIServer выполняет action для каждого доступного сервера с панелью 3x-ui.
+// Ошибка сервера не прерывает обход: возвращается список серверов, на которых action не выполнен.
+func forEachXUIServer(logPrefix string, action func(server *Server) error) ([]string, error) {
+	loads, err := GetServerLoads()
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []string
+	for _, load := range loads {
+		server := load.Server
+		if server.ID == DefaultServerID {
+			server = DefaultServer()
+		}
+		if server.BackendType() != BackendXUI {
+			continue
+		}
+		if IsServerDown(server.ID) {
+			log.Printf("%s: Сервер %s недоступен, пропускаем", logPrefix, server.ID)
+			failed = append(failed, server.ID)
+			continue
+		}
+
+		if err := action(server); err != nil {
+			log.Printf("%s: Ошибка на сервере %s: %v", logPrefix, server.ID, err)
+			failed = append(failed, server.ID)
+		}
+	}
+
+	return failed, nil
+}
+
+// CreateServerTables создает реестр серверов и колонку назначенного сервера у пользователей.
+// Основной сервер и серверы из SERVERS добавляются в реестр; параметры подключения
+// берутся из конфигурации, а доступность и вместимость меняет администратор командой /servers.
+func CreateServerTables() error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS servers (
+		id VARCHAR(64) PRIMARY KEY,
+		location VARCHAR(100) NOT NULL,
+		panel_url TEXT NOT NULL,
+		panel_user TEXT NOT NULL,
+		panel_pass TEXT NOT NULL,
+		inbound_ids TEXT NOT NULL,
+		sub_url TEXT NOT NULL DEFAULT '',
+		capacity INTEGER NOT NULL DEFAULT 0,
+		enabled BOOLEAN NOT NULL DEFAULT true,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+	ALTER TABLE servers ADD COLUMN IF NOT EXISTS backend VARCHAR(16) NOT NULL DEFAULT '3x-ui';
+	ALTER TABLE servers ADD COLUMN IF NOT EXISTS inbound_tag VARCHAR(64) NOT NULL DEFAULT '';
+	ALTER TABLE servers ADD COLUMN IF NOT EXISTS inbound_port INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE servers ADD COLUMN IF NOT EXISTS stream_settings TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS server_id VARCHAR(64) NOT NULL DEFAULT '';`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы servers: %v", err)
+	}
+
+	servers := append([]Server{*DefaultServer()}, SERVERS...)
+	for _, server := range servers {
+		_, err := db.Exec(`
+			INSERT INTO servers (id, location, panel_url, panel_user, panel_pass, inbound_ids, sub_url, capacity, enabled, backend,
+				inbound_tag, inbound_port, stream_settings)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ON CONFLICT (id) DO UPDATE SET location = EXCLUDED.location, panel_url = EXCLUDED.panel_url,
+				panel_user = EXCLUDED.panel_user, panel_pass = EXCLUDED.panel_pass,
+				inbound_ids = EXCLUDED.inbound_ids, sub_url = EXCLUDED.sub_url, backend = EXCLUDED.backend,
+				inbound_tag = EXCLUDED.inbound_tag, inbound_port = EXCLUDED.inbound_port, stream_settings = EXCLUDED.stream_settings`,
+			server.ID, server.Location, server.PanelURL, server.PanelUser, server.PanelPass,
+			formatInboundIDs(server.InboundIDs), server.SubURL, server.Capacity, server.Enabled, server.BackendType(),
+			server.InboundTag, server.InboundPort, server.StreamSettings)
+		if err != nil {
+			return fmt.Errorf("ошибка добавления сервера %s: %v", server.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// formatInboundIDs сохраняет список inbound'ов строкой "1,2"
+func formatInboundIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseInboundIDs разбирает список inbound'ов из строки "1,2"
+func parseInboundIDs(value string) []int {
+	var ids []int
+	for _, part := range strings.Split(value, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// serverColumns колонки таблицы servers для выборки
+const serverColumns = "id, location, panel_url, panel_user, panel_pass, inbound_ids, sub_url, capacity, enabled, backend, " +
+	"inbound_tag, inbound_port, stream_settings"
+
+// serverScanner общий интерфейс sql.Row и sql.Rows
+type serverScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanServer читает сервер из строки результата
+func scanServer(row serverScanner) (*Server, error) {
+	var server Server
+	var inboundIDs string
+	err := row.Scan(&server.ID, &server.Location, &server.PanelURL, &server.PanelUser, &server.PanelPass,
+		&inboundIDs, &server.SubURL, &server.Capacity, &server.Enabled, &server.Backend,
+		&server.InboundTag, &server.InboundPort, &server.StreamSettings)
+	if err != nil {
+		return nil, err
+	}
+	server.InboundIDs = parseInboundIDs(inboundIDs)
+	return &server, nil
+}
+
+// GetServer возвращает сервер из реестра
+func GetServer(serverID string) (*Server, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	server, err := scanServer(db.QueryRow("SELECT "+serverColumns+" FROM servers WHERE id = $1", serverID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("сервер %s не найден", serverID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения сервера %s: %v", serverID, err)
+	}
+	return server, nil
+}
+
+// GetServerLoads возвращает все серверы реестра с количеством пользователей
+func GetServerLoads() ([]ServerLoad, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query(`
+		SELECT s.id, s.location, s.panel_url, s.panel_user, s.panel_pass, s.inbound_ids, s.sub_url, s.capacity, s.enabled, s.backend,
+			s.inbound_tag, s.inbound_port, s.stream_settings,
+			(SELECT COUNT(*) FROM users u
+			 WHERE COALESCE(NULLIF(u.server_id, ''), $1) = s.id AND u.has_active_config = true)
+		FROM servers s
+		ORDER BY s.id = $1 DESC, s.location`, DefaultServerID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения серверов: %v", err)
+	}
+	defer rows.Close()
+
+	var loads []ServerLoad
+	for rows.Next() {
+		var server Server
+		var inboundIDs string
+		var users int
+		if err := rows.Scan(&server.ID, &server.Location, &server.PanelURL, &server.PanelUser, &server.PanelPass,
+			&inboundIDs, &server.SubURL, &server.Capacity, &server.Enabled, &server.Backend,
+			&server.InboundTag, &server.InboundPort, &server.StreamSettings, &users); err != nil {
+			return nil, fmt.Errorf("ошибка чтения сервера: %v", err)
+		}
+		server.InboundIDs = parseInboundIDs(inboundIDs)
+		loads = append(loads, ServerLoad{Server: &server, Users: users})
+	}
+
+	return loads, rows.Err()
+}
+
+// IsFull проверяет, заполнен ли сервер
+func (l ServerLoad) IsFull() bool {
+	return l.Server.Capacity > 0 && l.Users >= l.Server.Capacity
+}
+
+// GetUserServerID возвращает ID сервера пользователя (основной, если не назначен)
+func GetUserServerID(telegramID int64) string {
+	db := GetDatabasePG()
+	if db == nil {
+		return DefaultServerID
+	}
+
+	var serverID string
+	err := db.QueryRow("SELECT COALESCE(server_id, '') FROM users WHERE telegram_id = $1", telegramID).Scan(&serverID)
+	if err != nil || serverID == "" {
+		return DefaultServerID
+	}
+	return serverID
+}
+
+// GetUserServer возвращает сервер пользователя. Основной сервер всегда берется из конфигурации.
+func GetUserServer(telegramID int64) *Server {
+	serverID := GetUserServerID(telegramID)
+	if serverID == DefaultServerID {
+		return DefaultServer()
+	}
+
+	server, err := GetServer(serverID)
+	if err != nil {
+		log.Printf("SERVERS: %v, пользователь %d работает с основным сервером", err, telegramID)
+		return DefaultServer()
+	}
+	return server
+}
+
+// UserSubscriptionURL возвращает ссылку на подписку пользователя: общую подписку бота
+// со всех серверов или подписку панели его сервера
+func UserSubscriptionURL(user *User) string {
+	if SUBSCRIPTION_ENABLED {
+		return SUBSCRIPTION_BASE_URL + user.SubID
+	}
+	return NewBackend(GetUserServer(user.TelegramID)).SubscriptionURL(user)
+}
+
+// LoginForUser авторизуется в панели сервера пользователя
+func LoginForUser(telegramID int64) (string, error) {
+	return LoginServer(GetUserServer(telegramID))
+}
+
+// SetServerEnabled включает или отключает сервер для выбора пользователями
+func SetServerEnabled(serverID string, enabled bool) error {
+	return updateServer(serverID, "enabled = $1", enabled)
+}
+
+// SetServerCapacity меняет вместимость сервера (0 - без ограничения)
+func SetServerCapacity(serverID string, capacity int) error {
+	return updateServer(serverID, "capacity = $1", capacity)
+}
+
+// updateServer меняет настройку сервера в реестре
+func updateServer(serverID, set string, value interface{}) error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	result, err := db.Exec("UPDATE servers SET "+set+" WHERE id = $2", value, serverID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления сервера %s: %v", serverID, err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("сервер %s не найден", serverID)
+	}
+	return nil
+}
+
+// SwitchUserServer переносит клиента пользователя на другой сервер с тем же сроком действия,
+// ключом и subId, затем удаляет его со старого сервера
+func SwitchUserServer(user *User, serverID string) (*Server, error) {
+	loads, err := GetServerLoads()
+	if err != nil {
+		return nil, err
+	}
+
+	var target *ServerLoad
+	for i := range loads {
+		if loads[i].Server.ID == serverID {
+			target = &loads[i]
+			break
+		}
+	}
+	if target == nil || !target.Server.Enabled {
+		return nil, fmt.Errorf("локация недоступна")
+	}
+
+	current := GetUserServer(user.TelegramID)
+	if current.ID == serverID {
+		return nil, fmt.Errorf("эта локация уже выбрана")
+	}
+	if target.IsFull() {
+		return nil, fmt.Errorf("в локации %s нет свободных мест", target.Server.Location)
+	}
+	if IsServerDown(serverID) {
+		return nil, fmt.Errorf("локация %s временно недоступна", target.Server.Location)
+	}
+
+	// Основной сервер берем из конфигурации, как и при остальных операциях с панелью
+	targetServer := target.Server
+	if targetServer.ID == DefaultServerID {
+		targetServer = DefaultServer()
+	}
+
+	// Между панелями разных типов клиент пересоздается с оставшимся сроком
+	if current.BackendType() != BackendXUI || targetServer.BackendType() != BackendXUI {
+		return switchUserBackend(user, current, targetServer)
+	}
+
+	oldCookie, err := LoginServer(current)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка авторизации в панели %s: %v", current.ID, err)
+	}
+	oldInbound, err := GetInbound(oldCookie)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения inbound на сервере %s: %v", current.ID, err)
+	}
+	var oldSettings Settings
+	if err := json.Unmarshal([]byte(oldInbound.Settings), &oldSettings); err != nil {
+		return nil, fmt.Errorf("ошибка десериализации settings: %v", err)
+	}
+
+	client := FindClientByTelegramID(oldSettings.Clients, user.TelegramID)
+	if client != nil {
+		newCookie, err := LoginServer(targetServer)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка авторизации в панели %s: %v", targetServer.ID, err)
+		}
+
+		client.UpdatedAt = time.Now().UnixMilli()
+		if err := upsertPanelClient(newCookie, *client); err != nil {
+			return nil, fmt.Errorf("ошибка создания клиента на сервере %s: %v", targetServer.ID, err)
+		}
+
+		// Клиент уже работает на новом сервере - ошибка удаления со старого не прерывает перенос
+		if err := removePanelClient(oldCookie, client.Email); err != nil {
+			log.Printf("SERVERS: Ошибка удаления клиента %s с сервера %s: %v", client.Email, current.ID, err)
+		}
+	}
+
+	if err := setUserServerID(user.TelegramID, serverID); err != nil {
+		return nil, err
+	}
+
+	log.Printf("SERVERS: ✅ Пользователь %d перенесен с сервера %s на %s (клиент в панели: %v)",
+		user.TelegramID, current.ID, serverID, client != nil)
+	return targetServer, nil
+}
+
+// switchUserBackend переносит пользователя на сервер с панелью другого типа
+func switchUserBackend(user *User, current, target *Server) (*Server, error) {
+	if err := recreateClientOnBackend(user, target); err != nil {
+		return nil, err
+	}
+
+	// Клиент уже работает на новом сервере - ошибка удаления со старого не прерывает перенос
+	if err := NewBackend(current).Delete(user); err != nil {
+		log.Printf("SERVERS: Ошибка удаления клиента пользователя %d с сервера %s: %v", user.TelegramID, current.ID, err)
+	}
+
+	if err := setUserServerID(user.TelegramID, target.ID); err != nil {
+		return nil, err
+	}
+
+	log.Printf("SERVERS: ✅ Пользователь %d перенесен с сервера %s (%s) на %s (%s)",
+		user.TelegramID, current.ID, current.BackendType(), target.ID, target.BackendType())
+	return target, nil
+}
+
+// setUserServerID сохраняет сервер пользователя
+func setUserServerID(telegramID int64, serverID string) error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	if _, err := db.Exec("UPDATE users SET server_id = $1, updated_at = NOW() WHERE telegram_id = $2", serverID, telegramID); err != nil {
+		return fmt.Errorf("ошибка сохранения сервера пользователя: %v", err)
+	}
+	return nil
+}
+
+// upsertPanelClient добавляет клиента в inbound панели или заменяет клиента с тем же email
+func upsertPanelClient(sessionCookie string, client Client) error {
+	inbound, err := GetInbound(sessionCookie)
+	if err != nil {
+		return err
+	}
+
+	var settings Settings
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+		return fmt.Errorf("ошибка десериализации settings: %v", err)
+	}
+
+	replaced := false
+	for i := range settings.Clients {
+		if settings.Clients[i].Email == client.Email {
+			settings.Clients[i] = client
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		settings.Clients = append(settings.Clients, client)
+	}
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации settings: %v", err)
+	}
+	inbound.Settings = string(settingsJSON)
+
+	return updateInbound(sessionCookie, *inbound)
+}
+
+// removePanelClient удаляет клиента с указанным email из inbound панели
+func removePanelClient(sessionCookie string, email string) error {
+	inbound, err := GetInbound(sessionCookie)
+	if err != nil {
+		return err
+	}
+
+	var settings Settings
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+		return fmt.Errorf("ошибка десериализации settings: %v", err)
+	}
+
+	for i := range settings.Clients {
+		if settings.Clients[i].Email == email {
+			settings.Clients = append(settings.Clients[:i], settings.Clients[i+1:]...)
+
+			settingsJSON, err := json.Marshal(settings)
+			if err != nil {
+				return fmt.Errorf("ошибка сериализации settings: %v", err)
+			}
+			inbound.Settings = string(settingsJSON)
+			return updateInbound(sessionCookie, *inbound)
+		}
+	}
+
+	return nil
+}
+
+// GetServersReport формирует отчет по серверам для администратора
+func GetServersReport() string {
+	loads, err := GetServerLoads()
+	if err != nil {
+		log.Printf("SERVERS: %v", err)
+		return "❌ Ошибка получения серверов"
+	}
+
+	text := "🌍 Серверы:\n"
+	for _, load := range loads {
+		status := "✅"
+		if !load.Server.Enabled {
+			status = "⛔"
+		}
+		capacity := "∞"
+		if load.Server.Capacity > 0 {
+			capacity = strconv.Itoa(load.Server.Capacity)
+		}
+		panel := "inbound " + formatInboundIDs(load.Server.InboundIDs)
+		if load.Server.BackendType() != BackendXUI {
+			panel = load.Server.BackendType()
+		}
+		text += fmt.Sprintf("\n%s %s (%s) - %d/%s, %s",
+			status, load.Server.Location, load.Server.ID, load.Users, capacity, panel)
+		text += serverHealthLine(load.Server.ID)
+	}
+
+	return text
+}
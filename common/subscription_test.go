@@ -113,6 +113,33 @@ func TestTrialPeriodManager_CanUseTrial(t *testing.T) {
 	}
 }
 
+// TestTrialPolicy_Matches тестирует выбор политики пробного периода по источнику пользователя
+func TestTrialPolicy_Matches(t *testing.T) {
+	tests := []struct {
+		name           string
+		sources        []string
+		source         string
+		expectedResult bool
+	}{
+		{"AnySource", nil, TrialSourceOrganic, true},
+		{"ExactSource", []string{TrialSourceReferral}, TrialSourceReferral, true},
+		{"OtherSource", []string{TrialSourceReferral}, TrialSourceOrganic, false},
+		{"ExactCampaign", []string{"campaign:spring"}, "campaign:spring", true},
+		{"OtherCampaign", []string{"campaign:spring"}, "campaign:autumn", false},
+		{"AnyCampaign", []string{"campaign:*"}, "campaign:autumn", true},
+		{"AnyCampaign_Organic", []string{"campaign:*"}, TrialSourceOrganic, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := TrialPolicy{ID: "test", Sources: tt.sources}
+			if result := policy.Matches(tt.source); result != tt.expectedResult {
+				t.Errorf("Matches(%q) = %v, expected %v", tt.source, result, tt.expectedResult)
+			}
+		})
+	}
+}
+
 // TestGetDaysWord тестирует функцию правильного склонения слова "день"
 func TestGetDaysWord(t *testing.T) {
 	tests := []struct {
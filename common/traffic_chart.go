@@ -0,0 +1,169 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+)
+
+// Размеры графика трафика
+const (
+	chartWidth   = 800
+	chartHeight  = 400
+	chartMarginL = 70 // Слева подписи оси трафика
+	chartMarginR = 20
+	chartMarginT = 20
+	chartMarginB = 40 // Снизу подписи дней
+	chartScale   = 2  // Масштаб пикселя шрифта
+	chartGridY   = 4  // Горизонтальных линий сетки
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	chartAxis       = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	chartBar        = color.RGBA{0x3b, 0x82, 0xf6, 0xff}
+	chartBarToday   = color.RGBA{0x10, 0xb9, 0x81, 0xff}
+	chartText       = color.RGBA{0x30, 0x30, 0x30, 0xff}
+)
+
+// chartGlyphs шрифт 3x5 для подписей: каждая строка - три бита слева направо.
+// Внешние шрифты не подключаются, подписям нужны только цифры и единицы.
+var chartGlyphs = map[rune][5]uint8{
+	'0': {0b111, 0b101, 0b101, 0b101, 0b111},
+	'1': {0b010, 0b110, 0b010, 0b010, 0b111},
+	'2': {0b111, 0b001, 0b111, 0b100, 0b111},
+	'3': {0b111, 0b001, 0b111, 0b001, 0b111},
+	'4': {0b101, 0b101, 0b111, 0b001, 0b001},
+	'5': {0b111, 0b100, 0b111, 0b001, 0b111},
+	'6': {0b111, 0b100, 0b111, 0b101, 0b111},
+	'7': {0b111, 0b001, 0b010, 0b010, 0b010},
+	'8': {0b111, 0b101, 0b111, 0b101, 0b111},
+	'9': {0b111, 0b101, 0b111, 0b001, 0b111},
+	'.': {0b000, 0b000, 0b000, 0b000, 0b010},
+	'G': {0b111, 0b100, 0b101, 0b101, 0b111},
+	'M': {0b101, 0b111, 0b111, 0b101, 0b101},
+	'B': {0b110, 0b101, 0b110, 0b101, 0b110},
+}
+
+// RenderTrafficChart рисует столбчатый график трафика по дням в PNG; последний день выделяется цветом
+func RenderTrafficChart(days []TrafficDay) ([]byte, error) {
+	if len(days) == 0 {
+		return nil, fmt.Errorf("нет данных для графика трафика")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	fillRect(img, 0, 0, chartWidth, chartHeight, chartBackground)
+
+	plotW := chartWidth - chartMarginL - chartMarginR
+	plotH := chartHeight - chartMarginT - chartMarginB
+	bottom := chartMarginT + plotH
+
+	var maxBytes int64
+	for _, day := range days {
+		maxBytes = max(maxBytes, day.Bytes)
+	}
+	scaleMax := chartScaleMax(maxBytes)
+
+	// Сетка и подписи оси трафика
+	for i := 0; i <= chartGridY; i++ {
+		y := bottom - plotH*i/chartGridY
+		fillRect(img, chartMarginL, y, chartMarginL+plotW, y+1, chartGrid)
+		label := chartBytesLabel(scaleMax*int64(i)/chartGridY, scaleMax >= bytesInGB)
+		drawChartText(img, chartMarginL-8-chartTextWidth(label), y-chartScale*5/2, label)
+	}
+
+	// Столбцы по дням
+	slot := plotW / len(days)
+	gap := max(slot/5, 1)
+	for i, day := range days {
+		x := chartMarginL + i*slot
+		if day.Bytes > 0 {
+			height := max(int(day.Bytes*int64(plotH)/scaleMax), 1)
+			barColor := chartBar
+			if i == len(days)-1 {
+				barColor = chartBarToday
+			}
+			fillRect(img, x+gap/2, bottom-height, x+slot-gap/2, bottom, barColor)
+		}
+
+		// Подписываем каждый пятый день и последний
+		if (len(days)-1-i)%5 == 0 {
+			label := strconv.Itoa(day.Date.Day())
+			drawChartText(img, x+slot/2-chartTextWidth(label)/2, bottom+10, label)
+		}
+	}
+
+	fillRect(img, chartMarginL, bottom, chartMarginL+plotW, bottom+2, chartAxis)
+	fillRect(img, chartMarginL-2, chartMarginT, chartMarginL, bottom+2, chartAxis)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("ошибка кодирования графика трафика: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// chartScaleMax округляет максимум оси вверх до шага, кратного числу линий сетки
+func chartScaleMax(maxBytes int64) int64 {
+	step := int64(1024 * 1024) // 1 МБ
+	if maxBytes >= bytesInGB {
+		step = bytesInGB / 4
+	}
+	scale := (maxBytes + step*chartGridY - 1) / (step * chartGridY) * step * chartGridY
+	return max(scale, step*chartGridY)
+}
+
+// chartBytesLabel подпись оси трафика: "1.5GB" или "300MB", единица одна на всю ось
+func chartBytesLabel(value int64, inGB bool) string {
+	if value == 0 {
+		return "0"
+	}
+	if inGB {
+		label := strconv.FormatFloat(float64(value)/float64(bytesInGB), 'f', 2, 64)
+		for label[len(label)-1] == '0' {
+			label = label[:len(label)-1]
+		}
+		if label[len(label)-1] == '.' {
+			label = label[:len(label)-1]
+		}
+		return label + "GB"
+	}
+	return strconv.FormatInt(value/(1024*1024), 10) + "MB"
+}
+
+// chartTextWidth ширина подписи в пикселях
+func chartTextWidth(text string) int {
+	return len(text) * 4 * chartScale
+}
+
+// drawChartText рисует подпись шрифтом chartGlyphs, неизвестные символы пропускаются
+func drawChartText(img *image.RGBA, x, y int, text string) {
+	for _, r := range text {
+		glyph, ok := chartGlyphs[r]
+		if ok {
+			for row, bits := range glyph {
+				for col := 0; col < 3; col++ {
+					if bits&(0b100>>col) != 0 {
+						px, py := x+col*chartScale, y+row*chartScale
+						fillRect(img, px, py, px+chartScale, py+chartScale, chartText)
+					}
+				}
+			}
+		}
+		x += 4 * chartScale
+	}
+}
+
+// fillRect закрашивает прямоугольник [x0, x1) x [y0, y1)
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	rect := image.Rect(x0, y0, x1, y1).Intersect(img.Bounds())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
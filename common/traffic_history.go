@@ -0,0 +1,211 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// TrafficDay трафик пользователя за день
+type TrafficDay struct {
+	Date  time.Time
+	Bytes int64
+}
+
+// TrafficUsageSummary трафик пользователя в текущих окнах и лимиты окон
+type TrafficUsageSummary struct {
+	Used   map[string]int64 // Использовано по окнам (TrafficPeriodDay, TrafficPeriodWeek, TrafficPeriodMonth)
+	Limits map[string]int64 // Лимиты окон с учетом пакетов и израсходованного бонуса, 0 - без лимита
+	Packs  map[string]int64 // Остаток купленных пакетов трафика по окнам
+}
+
+// TrafficTopEntry пользователь в рейтинге потребления трафика
+type TrafficTopEntry struct {
+	TelegramID int64
+	Username   string
+	Bytes      int64
+}
+
+// trafficSnapshot прирост трафика, записанный при проверке
+type trafficSnapshot struct {
+	RecordedAt time.Time
+	Bytes      int64
+}
+
+// GetTrafficUsageSummary возвращает трафик пользователя за сегодня, неделю и месяц
+func GetTrafficUsageSummary(telegramID int64) (*TrafficUsageSummary, error) {
+	now := time.Now()
+	windows, err := getTrafficWindows(telegramID, trafficPeriodLimits(GetTrafficConfig()), now)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &TrafficUsageSummary{Used: make(map[string]int64), Limits: make(map[string]int64), Packs: make(map[string]int64)}
+	for i := range windows {
+		w := &windows[i]
+		summary.Used[w.Period] = w.UsedBytes
+		if w.LimitBytes > 0 {
+			summary.Limits[w.Period] = w.allowance()
+			summary.Packs[w.Period] = trafficPackLeft(w)
+		}
+	}
+	return summary, nil
+}
+
+// GetDailyTraffic возвращает трафик пользователя по дням за последние days дней, включая сегодня
+func GetDailyTraffic(telegramID int64, days int) ([]TrafficDay, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	from := trafficPeriodStart(TrafficPeriodDay, time.Now()).AddDate(0, 0, -(days - 1))
+	rows, err := db.Query(`
+		SELECT recorded_at, bytes FROM traffic_snapshots
+		WHERE telegram_id = $1 AND recorded_at >= $2
+		ORDER BY recorded_at`, telegramID, from)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения истории трафика пользователя %d: %v", telegramID, err)
+	}
+	defer rows.Close()
+
+	var snapshots []trafficSnapshot
+	for rows.Next() {
+		var snapshot trafficSnapshot
+		if err := rows.Scan(&snapshot.RecordedAt, &snapshot.Bytes); err != nil {
+			return nil, fmt.Errorf("ошибка чтения истории трафика: %v", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения истории трафика: %v", err)
+	}
+
+	return bucketTrafficByDay(snapshots, from, days), nil
+}
+
+// bucketTrafficByDay суммирует приросты по дням начиная с from; дни без трафика остаются нулевыми
+func bucketTrafficByDay(snapshots []trafficSnapshot, from time.Time, days int) []TrafficDay {
+	result := make([]TrafficDay, days)
+	for i := range result {
+		result[i].Date = from.AddDate(0, 0, i)
+	}
+
+	for _, snapshot := range snapshots {
+		day := trafficPeriodStart(TrafficPeriodDay, snapshot.RecordedAt.In(from.Location()))
+		if day.Before(from) {
+			continue
+		}
+		// Округление до суток: переход на летнее время не сдвигает дни
+		index := int(day.Sub(from).Hours()+12) / 24
+		if index < days {
+			result[index].Bytes += snapshot.Bytes
+		}
+	}
+	return result
+}
+
+// GetTopTrafficUsers возвращает limit пользователей с наибольшим трафиком в текущем окне period
+func GetTopTrafficUsers(period string, limit int) ([]TrafficTopEntry, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query(`
+		SELECT t.telegram_id, COALESCE(u.username, ''), t.used_bytes
+		FROM traffic_usage t
+		LEFT JOIN users u ON u.telegram_id = t.telegram_id
+		WHERE t.period = $1 AND t.period_start = $2 AND t.used_bytes > 0
+		ORDER BY t.used_bytes DESC
+		LIMIT $3`, period, trafficPeriodStart(period, time.Now()), limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения рейтинга трафика: %v", err)
+	}
+	defer rows.Close()
+
+	var top []TrafficTopEntry
+	for rows.Next() {
+		var entry TrafficTopEntry
+		if err := rows.Scan(&entry.TelegramID, &entry.Username, &entry.Bytes); err != nil {
+			return nil, fmt.Errorf("ошибка чтения рейтинга трафика: %v", err)
+		}
+		top = append(top, entry)
+	}
+	return top, rows.Err()
+}
+
+// trafficPeriodTitles названия окон для отчетов
+var trafficPeriodTitles = map[string]string{
+	TrafficPeriodDay:   "сегодня",
+	TrafficPeriodWeek:  "за неделю",
+	TrafficPeriodMonth: "за месяц",
+}
+
+// trafficUsageLabels подписи окон в описании трафика пользователя
+var trafficUsageLabels = map[string]string{
+	TrafficPeriodDay:   "Сегодня",
+	TrafficPeriodWeek:  "За неделю",
+	TrafficPeriodMonth: "За месяц",
+}
+
+// FormatTrafficUsage формирует описание трафика пользователя по окнам
+func FormatTrafficUsage(summary *TrafficUsageSummary) string {
+	var text strings.Builder
+	for _, period := range []string{TrafficPeriodDay, TrafficPeriodWeek, TrafficPeriodMonth} {
+		fmt.Fprintf(&text, "• %s: %s", trafficUsageLabels[period], FormatTrafficBytes(summary.Used[period]))
+		if limit := summary.Limits[period]; limit > 0 {
+			fmt.Fprintf(&text, " из %s", FormatTrafficBytes(limit))
+		}
+		if pack := summary.Packs[period]; pack > 0 {
+			fmt.Fprintf(&text, " (пакеты: осталось %s)", FormatTrafficBytes(pack))
+		}
+		text.WriteString("\n")
+	}
+	return text.String()
+}
+
+// FormatTrafficTopReport формирует рейтинг потребления трафика для администратора
+func FormatTrafficTopReport(period string, top []TrafficTopEntry) string {
+	if len(top) == 0 {
+		return fmt.Sprintf("📊 Трафик %s пока не учтен", trafficPeriodTitles[period])
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "📊 Топ-%d по трафику %s\n\n", len(top), trafficPeriodTitles[period])
+	for i, entry := range top {
+		name := fmt.Sprintf("%d", entry.TelegramID)
+		if entry.Username != "" {
+			name = fmt.Sprintf("@%s (%d)", entry.Username, entry.TelegramID)
+		}
+		fmt.Fprintf(&text, "%d. %s - %s\n", i+1, name, FormatTrafficBytes(entry.Bytes))
+	}
+	return text.String()
+}
+
+// cleanupTrafficHistory удаляет историю трафика старше TRAFFIC_HISTORY_DAYS дней
+func cleanupTrafficHistory(now time.Time) {
+	if TRAFFIC_HISTORY_DAYS <= 0 {
+		return
+	}
+	db := GetDatabasePG()
+	if db == nil {
+		return
+	}
+
+	before := now.AddDate(0, 0, -TRAFFIC_HISTORY_DAYS)
+	result, err := db.Exec(`DELETE FROM traffic_snapshots WHERE recorded_at < $1`, before)
+	if err != nil {
+		log.Printf("TRAFFIC_HISTORY: Ошибка очистки истории трафика: %v", err)
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted > 0 {
+		log.Printf("TRAFFIC_HISTORY: Удалено записей истории трафика старше %d дней: %d", TRAFFIC_HISTORY_DAYS, deleted)
+	}
+
+	// Окна хранятся дольше истории: месячное окно должно пережить очистку
+	if _, err := db.Exec(`DELETE FROM traffic_usage WHERE period_start < $1`, before.AddDate(0, -1, 0)); err != nil {
+		log.Printf("TRAFFIC_HISTORY: Ошибка очистки окон трафика: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestBucketTrafficByDay(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := []trafficSnapshot{
+		{RecordedAt: from.Add(-time.Hour), Bytes: 999}, // До начала периода
+		{RecordedAt: from.Add(time.Hour), Bytes: 100},
+		{RecordedAt: from.Add(23 * time.Hour), Bytes: 50},
+		{RecordedAt: from.Add(49 * time.Hour), Bytes: 70},
+		{RecordedAt: from.AddDate(0, 0, 7), Bytes: 999}, // После конца периода
+	}
+
+	days := bucketTrafficByDay(snapshots, from, 3)
+	if len(days) != 3 {
+		t.Fatalf("Ожидалось 3 дня, получено %d", len(days))
+	}
+	expected := []int64{150, 0, 70}
+	for i, day := range days {
+		if day.Bytes != expected[i] {
+			t.Errorf("День %d: %d байт, ожидалось %d", i, day.Bytes, expected[i])
+		}
+		if !day.Date.Equal(from.AddDate(0, 0, i)) {
+			t.Errorf("День %d: дата %v", i, day.Date)
+		}
+	}
+}
+
+func TestRenderTrafficChart(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	var days []TrafficDay
+	for i := 0; i < 30; i++ {
+		days = append(days, TrafficDay{Date: from.AddDate(0, 0, i), Bytes: int64(i) * 100 * 1024 * 1024})
+	}
+
+	data, err := RenderTrafficChart(days)
+	if err != nil {
+		t.Fatalf("RenderTrafficChart() вернул ошибку: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("График не является PNG: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != chartWidth || bounds.Dy() != chartHeight {
+		t.Errorf("Размер графика %v", bounds)
+	}
+
+	if _, err := RenderTrafficChart(nil); err == nil {
+		t.Error("RenderTrafficChart() без данных должен вернуть ошибку")
+	}
+}
+
+func TestChartBytesLabel(t *testing.T) {
+	tests := []struct {
+		value int64
+		inGB  bool
+		label string
+	}{
+		{0, true, "0"},
+		{bytesInGB / 2, true, "0.5GB"},
+		{bytesInGB * 3 / 2, true, "1.5GB"},
+		{2 * bytesInGB, true, "2GB"},
+		{300 * 1024 * 1024, false, "300MB"},
+	}
+	for _, test := range tests {
+		if label := chartBytesLabel(test.value, test.inGB); label != test.label {
+			t.Errorf("chartBytesLabel(%d, %v) = %s, ожидалось %s", test.value, test.inGB, label, test.label)
+		}
+	}
+}
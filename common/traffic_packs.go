@@ -0,0 +1,149 @@
+package common
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// TrafficPack пакет дополнительного трафика из каталога TRAFFIC_PACKS
+type TrafficPack struct {
+	GB    int // Объем пакета
+	Price int // Цена в рублях, списывается с баланса
+}
+
+// ErrTrafficPacksUnavailable пакеты трафика не продаются, пока не заданы лимиты трафика
+var ErrTrafficPacksUnavailable = errors.New("лимиты трафика не установлены, пакеты трафика недоступны")
+
+// ErrInsufficientBalance на балансе не хватает средств для покупки
+var ErrInsufficientBalance = errors.New("недостаточно средств на балансе")
+
+// FindTrafficPack возвращает пакет каталога по объему
+func FindTrafficPack(gb int) (TrafficPack, bool) {
+	for _, pack := range TRAFFIC_PACKS {
+		if pack.GB == gb {
+			return pack, true
+		}
+	}
+	return TrafficPack{}, false
+}
+
+// TrafficPacksAvailable проверяет, можно ли сейчас покупать пакеты трафика
+func TrafficPacksAvailable() bool {
+	return len(TRAFFIC_PACKS) > 0 && TrafficQuotasEnabled()
+}
+
+// trafficPackLeft возвращает остаток купленных пакетов окна для экрана трафика.
+// Пакеты и лимит окна сгорают одновременно, поэтому для блокировки порядок расходования не важен.
+func trafficPackLeft(w *trafficWindow) int64 {
+	return max(w.PackBytes-w.UsedBytes, 0)
+}
+
+// PurchaseTrafficPack списывает cost с баланса и увеличивает на объем пакета лимит каждого текущего окна:
+// в каждом окне пакет сгорает при его сбросе, после сброса дня увеличение остается только в неделе и месяце.
+// Лимит клиента в панели не меняется - пакет учитывается только проверкой трафика по базе;
+// отключенный по лимиту пользователь включается, если пакета хватает.
+// consume (может быть nil) выполняется в той же транзакции - например, расходует скидку, учтенную в cost.
+func PurchaseTrafficPack(user *User, pack TrafficPack, cost float64, consume func(tx *sql.Tx) error) error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	now := time.Now()
+	limits := trafficPeriodLimits(GetTrafficConfig())
+	if limits[TrafficPeriodDay] <= 0 && limits[TrafficPeriodWeek] <= 0 && limits[TrafficPeriodMonth] <= 0 {
+		return ErrTrafficPacksUnavailable
+	}
+	packBytes := int64(pack.GB) * bytesInGB
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var balance float64
+	if err := tx.QueryRow("SELECT balance FROM users WHERE telegram_id = $1 FOR UPDATE", user.TelegramID).Scan(&balance); err != nil {
+		return fmt.Errorf("ошибка получения баланса: %v", err)
+	}
+	if balance < cost {
+		return ErrInsufficientBalance
+	}
+
+	for _, period := range []string{TrafficPeriodDay, TrafficPeriodWeek, TrafficPeriodMonth} {
+		if limits[period] <= 0 {
+			continue
+		}
+		_, err := tx.Exec(`
+			INSERT INTO traffic_usage (telegram_id, period, period_start, pack_bytes, updated_at)
+			VALUES ($1, $2, $3, $4, NOW())
+			ON CONFLICT (telegram_id, period, period_start) DO UPDATE SET
+				pack_bytes = traffic_usage.pack_bytes + EXCLUDED.pack_bytes, notified_percent = 0, updated_at = NOW()`,
+			user.TelegramID, period, trafficPeriodStart(period, now), packBytes)
+		if err != nil {
+			return fmt.Errorf("ошибка добавления пакета трафика: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE users SET balance = balance - $1, updated_at = NOW() WHERE telegram_id = $2", cost, user.TelegramID); err != nil {
+		return fmt.Errorf("ошибка списания баланса: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO traffic_pack_purchases (telegram_id, gb, amount) VALUES ($1, $2, $3)", user.TelegramID, pack.GB, cost); err != nil {
+		return fmt.Errorf("ошибка сохранения покупки пакета трафика: %v", err)
+	}
+	if consume != nil {
+		if err := consume(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка сохранения покупки пакета трафика: %v", err)
+	}
+	user.Balance = balance - cost
+	log.Printf("TRAFFIC_PACK: ✅ Пользователь %d купил пакет %d ГБ за %.2f₽", user.TelegramID, pack.GB, cost)
+
+	// Пакет уже оплачен и учтен: ошибка панели только логируется, проверка трафика повторит включение
+	if err := unblockTrafficQuota(user, GetUserBackend(user.TelegramID), limits, now); err != nil {
+		log.Printf("TRAFFIC_PACK: Ошибка включения пользователя %d после покупки пакета: %v", user.TelegramID, err)
+	}
+
+	ForceBalanceRecalculation(user.TelegramID)
+	return nil
+}
+
+// unblockTrafficQuota включает отключенного по лимиту оплаченного пользователя,
+// если после покупки пакета ни одно окно не превышено
+func unblockTrafficQuota(user *User, backend VPNBackend, limits map[string]int64, now time.Time) error {
+	db := GetDatabasePG()
+	var blocked bool
+	err := db.QueryRow("SELECT blocked FROM traffic_quota_state WHERE telegram_id = $1", user.TelegramID).Scan(&blocked)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("ошибка получения состояния трафика: %v", err)
+	}
+	if !blocked || !user.HasActiveConfig || user.ExpiryTime <= now.UnixMilli() {
+		return nil
+	}
+
+	windows, err := getTrafficWindows(user.TelegramID, limits, now)
+	if err != nil {
+		return err
+	}
+	for i := range windows {
+		if windows[i].exceeded() {
+			return nil
+		}
+	}
+
+	if err := backend.Enable(user); err != nil {
+		return err
+	}
+	if _, err := db.Exec("UPDATE traffic_quota_state SET blocked = false, updated_at = NOW() WHERE telegram_id = $1", user.TelegramID); err != nil {
+		return fmt.Errorf("ошибка снятия блокировки по трафику: %v", err)
+	}
+	log.Printf("TRAFFIC_PACK: Пользователь %d включен после покупки пакета трафика", user.TelegramID)
+	return nil
+}
@@ -0,0 +1,39 @@
+package common
+
+import "testing"
+
+func TestTrafficPackWindow(t *testing.T) {
+	w := []trafficWindow{{Period: TrafficPeriodDay, LimitBytes: 100, PackBytes: 50, UsedBytes: 90}}
+
+	// Пакет расходуется первым: бонус не нужен, пока трафик в пределах лимита и пакета
+	if charge := chargeTraffic(w, 40, 100); charge != 0 || w[0].exceeded() {
+		t.Errorf("Трафик в пределах пакета: бонус %d, окно %+v", charge, w[0])
+	}
+	if left := trafficPackLeft(&w[0]); left != 0 {
+		t.Errorf("Остаток пакета после 130 байт = %d, ожидалось 0", left)
+	}
+	if charge := chargeTraffic(w, 30, 100); charge != 10 || w[0].exceeded() {
+		t.Errorf("Трафик сверх лимита и пакета: бонус %d, окно %+v", charge, w[0])
+	}
+
+	fresh := &trafficWindow{Period: TrafficPeriodWeek, LimitBytes: 100, PackBytes: 50, UsedBytes: 20}
+	if left := trafficPackLeft(fresh); left != 30 {
+		t.Errorf("Остаток пакета = %d, ожидалось 30", left)
+	}
+	if percent := trafficQuotaPercent(fresh, 0); percent != 13 {
+		t.Errorf("Процент с учетом пакета = %d, ожидалось 13", percent)
+	}
+}
+
+func TestFindTrafficPack(t *testing.T) {
+	saved := TRAFFIC_PACKS
+	defer func() { TRAFFIC_PACKS = saved }()
+	TRAFFIC_PACKS = []TrafficPack{{GB: 10, Price: 50}, {GB: 50, Price: 200}}
+
+	if pack, ok := FindTrafficPack(50); !ok || pack.Price != 200 {
+		t.Errorf("FindTrafficPack(50) = %+v, %v", pack, ok)
+	}
+	if _, ok := FindTrafficPack(20); ok {
+		t.Error("FindTrafficPack(20) нашел пакет, которого нет в каталоге")
+	}
+}
@@ -25,17 +25,33 @@ func ShowTrafficConfig(bot *tgbotapi.BotAPI, chatID int64) {
 		resetText = "❌ Отключен"
 	}
 
+	config := GetTrafficConfig()
+	quotaText := "❌ Отключены"
+	if config.Enabled {
+		quotaText = fmt.Sprintf("день %s, неделя %s, месяц %s",
+			FormatTrafficLimit(config.DailyLimitGB), FormatTrafficLimit(config.WeeklyLimitGB), FormatTrafficLimit(config.MonthlyLimitGB))
+	}
+
 	text := fmt.Sprintf("📊 Настройки мониторинга трафика\n\n"+
 		"🔍 Интервал проверки: %d минут\n"+
 		"📈 Лимит трафика: %s\n"+
-		"🔄 Интервал сброса: %s\n\n"+
+		"🔄 Интервал сброса: %s\n"+
+		"📅 Лимиты по периодам: %s\n\n"+
 		"💡 Система автоматически отключает конфиги при превышении лимита и включает их обратно при сбросе трафика.",
-		TRAFFIC_CHECK_INTERVAL, trafficLimitText, resetText)
+		TRAFFIC_CHECK_INTERVAL, trafficLimitText, resetText, quotaText)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🔄 Проверить сейчас", "check_traffic_now"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📅 День", "edit_traffic_daily"),
+			tgbotapi.NewInlineKeyboardButtonData("📅 Неделя", "edit_traffic_weekly"),
+			tgbotapi.NewInlineKeyboardButtonData("📅 Месяц", "edit_traffic_monthly"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отключить лимиты", "disable_traffic"),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "main"),
 		),
@@ -0,0 +1,602 @@
+package common
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Окна учета трафика
+const (
+	TrafficPeriodDay   = "day"
+	TrafficPeriodWeek  = "week"
+	TrafficPeriodMonth = "month"
+)
+
+// trafficQuotaThresholds пороги уведомлений пользователя в процентах от доступного трафика
+var trafficQuotaThresholds = []int{80, 100}
+
+const bytesInGB = int64(1024 * 1024 * 1024)
+
+// trafficWindow использование трафика пользователем в текущем окне
+type trafficWindow struct {
+	Period          string
+	Start           time.Time
+	LimitBytes      int64 // 0 - окно без лимита, только учет
+	UsedBytes       int64
+	BonusBytes      int64 // Бонусный трафик, израсходованный сверх лимита в этом окне
+	PackBytes       int64 // Купленные в этом окне пакеты трафика
+	NotifiedPercent int
+}
+
+// allowance возвращает трафик окна: лимит, купленные пакеты и израсходованный бонус
+func (w *trafficWindow) allowance() int64 {
+	return w.LimitBytes + w.PackBytes + w.BonusBytes
+}
+
+// available возвращает трафик окна до отключения с учетом оставшегося бонуса
+func (w *trafficWindow) available(bonusLeft int64) int64 {
+	return w.allowance() + bonusLeft
+}
+
+// exceeded проверяет превышение лимита окна
+func (w *trafficWindow) exceeded() bool {
+	return w.LimitBytes > 0 && w.UsedBytes > w.allowance()
+}
+
+// trafficQuotaState состояние учета трафика пользователя
+type trafficQuotaState struct {
+	TelegramID      int64
+	ServerID        string // Сервер, счетчик которого записан в LastBytes
+	LastBytes       int64  // Последнее значение счетчика панели (отдано + получено)
+	BonusUsedBytes  int64  // Израсходовано бонусного трафика всего
+	Blocked         bool   // Клиент отключен по лимиту трафика
+	HasActiveConfig bool
+	ExpiryTime      int64
+	known           bool // Состояние уже было сохранено
+}
+
+// trafficCounter счетчик трафика клиента на сервере
+type trafficCounter struct {
+	Bytes   int64
+	Enabled bool
+}
+
+// CreateTrafficQuotaTables создает таблицы учета трафика по окнам
+func CreateTrafficQuotaTables() error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	query := `
+	CREATE TABLE IF NOT EXISTS traffic_usage (
+		telegram_id BIGINT NOT NULL,
+		period VARCHAR(10) NOT NULL,
+		period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+		used_bytes BIGINT NOT NULL DEFAULT 0,
+		bonus_bytes BIGINT NOT NULL DEFAULT 0,
+		notified_percent INTEGER NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (telegram_id, period, period_start)
+	);
+
+	ALTER TABLE traffic_usage ADD COLUMN IF NOT EXISTS pack_bytes BIGINT NOT NULL DEFAULT 0;
+
+	CREATE TABLE IF NOT EXISTS traffic_quota_state (
+		telegram_id BIGINT PRIMARY KEY,
+		server_id VARCHAR(64) NOT NULL DEFAULT '',
+		last_bytes BIGINT NOT NULL DEFAULT 0,
+		bonus_used_bytes BIGINT NOT NULL DEFAULT 0,
+		blocked BOOLEAN NOT NULL DEFAULT false,
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS traffic_snapshots (
+		id BIGSERIAL PRIMARY KEY,
+		telegram_id BIGINT NOT NULL,
+		server_id VARCHAR(64) NOT NULL DEFAULT '',
+		recorded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		bytes BIGINT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS traffic_pack_purchases (
+		id BIGSERIAL PRIMARY KEY,
+		telegram_id BIGINT NOT NULL,
+		gb INTEGER NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_traffic_usage_period ON traffic_usage(period, period_start);
+	CREATE INDEX IF NOT EXISTS idx_traffic_snapshots_user ON traffic_snapshots(telegram_id, recorded_at);
+	CREATE INDEX IF NOT EXISTS idx_traffic_pack_purchases_user ON traffic_pack_purchases(telegram_id, created_at);`
+
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("ошибка создания таблиц учета трафика: %v", err)
+	}
+	return nil
+}
+
+// trafficPeriodStart возвращает начало окна: полночь, понедельник или первое число месяца
+func trafficPeriodStart(period string, now time.Time) time.Time {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case TrafficPeriodWeek:
+		weekday := (int(day.Weekday()) + 6) % 7 // Понедельник - 0
+		return day.AddDate(0, 0, -weekday)
+	case TrafficPeriodMonth:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	}
+	return day
+}
+
+// trafficPeriodEnd возвращает момент сброса окна
+func trafficPeriodEnd(period string, start time.Time) time.Time {
+	switch period {
+	case TrafficPeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case TrafficPeriodMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// trafficPeriodLimits лимиты окон из конфигурации трафика в байтах
+func trafficPeriodLimits(config *TrafficConfig) map[string]int64 {
+	limits := map[string]int64{TrafficPeriodDay: 0, TrafficPeriodWeek: 0, TrafficPeriodMonth: 0}
+	if config == nil || !config.Enabled {
+		return limits
+	}
+	limits[TrafficPeriodDay] = int64(config.DailyLimitGB) * bytesInGB
+	limits[TrafficPeriodWeek] = int64(config.WeeklyLimitGB) * bytesInGB
+	limits[TrafficPeriodMonth] = int64(config.MonthlyLimitGB) * bytesInGB
+	return limits
+}
+
+// TrafficQuotasEnabled проверяет, задан ли лимит хотя бы для одного окна
+func TrafficQuotasEnabled() bool {
+	for _, limit := range trafficPeriodLimits(GetTrafficConfig()) {
+		if limit > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// trafficDelta возвращает прирост трафика с прошлой проверки. Первое наблюдение только запоминает счетчик,
+// новый сервер или уменьшившийся счетчик (клиент пересоздан, трафик сброшен в панели) считаются с нуля.
+func trafficDelta(state *trafficQuotaState, serverID string, bytes int64) int64 {
+	if !state.known {
+		return 0
+	}
+	if state.ServerID != serverID || bytes < state.LastBytes {
+		return bytes
+	}
+	return bytes - state.LastBytes
+}
+
+// chargeTraffic добавляет трафик в окна. Трафик сверх лимита и пакетов окна покрывается бонусом, пока он есть;
+// одни и те же байты списывают бонус один раз, даже если превышены несколько окон.
+// Возвращает израсходованный бонус.
+func chargeTraffic(windows []trafficWindow, delta, bonusLeft int64) int64 {
+	var charge int64
+	needs := make([]int64, len(windows))
+	for i := range windows {
+		w := &windows[i]
+		w.UsedBytes += delta
+		if w.LimitBytes <= 0 {
+			continue
+		}
+		if need := w.UsedBytes - w.allowance(); need > 0 {
+			needs[i] = need
+			if need > charge {
+				charge = need
+			}
+		}
+	}
+	if charge > bonusLeft {
+		charge = bonusLeft
+	}
+	if charge <= 0 {
+		return 0
+	}
+
+	for i := range windows {
+		if needs[i] > 0 {
+			windows[i].BonusBytes += min(needs[i], charge)
+		}
+	}
+	return charge
+}
+
+// trafficQuotaPercent возвращает использование окна в процентах от доступного трафика
+func trafficQuotaPercent(w *trafficWindow, bonusLeft int64) int {
+	available := w.available(bonusLeft)
+	if w.LimitBytes <= 0 || available <= 0 {
+		return 0
+	}
+	return int(w.UsedBytes * 100 / available)
+}
+
+// trafficNotifyThreshold возвращает новый достигнутый порог уведомления или 0
+func trafficNotifyThreshold(w *trafficWindow, bonusLeft int64) int {
+	percent := trafficQuotaPercent(w, bonusLeft)
+	threshold := 0
+	for _, t := range trafficQuotaThresholds {
+		if percent >= t && t > w.NotifiedPercent {
+			threshold = t
+		}
+	}
+	return threshold
+}
+
+// getTrafficQuotaStates возвращает пользователей для учета трафика по серверам:
+// с действующей подпиской и отключенных по лимиту
+func getTrafficQuotaStates(now time.Time) (map[string][]*trafficQuotaState, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query(`
+		SELECT u.telegram_id, COALESCE(NULLIF(u.server_id, ''), $1), u.has_active_config, COALESCE(u.expiry_time, 0),
+			q.telegram_id IS NOT NULL, COALESCE(q.server_id, ''), COALESCE(q.last_bytes, 0),
+			COALESCE(q.bonus_used_bytes, 0), COALESCE(q.blocked, false)
+		FROM users u
+		LEFT JOIN traffic_quota_state q ON q.telegram_id = u.telegram_id
+		WHERE (u.has_active_config AND u.expiry_time > $2) OR q.blocked`, DefaultServerID, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения пользователей для учета трафика: %v", err)
+	}
+	defer rows.Close()
+
+	byServer := make(map[string][]*trafficQuotaState)
+	for rows.Next() {
+		var state trafficQuotaState
+		var serverID string
+		if err := rows.Scan(&state.TelegramID, &serverID, &state.HasActiveConfig, &state.ExpiryTime,
+			&state.known, &state.ServerID, &state.LastBytes, &state.BonusUsedBytes, &state.Blocked); err != nil {
+			return nil, fmt.Errorf("ошибка чтения состояния трафика: %v", err)
+		}
+		byServer[serverID] = append(byServer[serverID], &state)
+	}
+	return byServer, rows.Err()
+}
+
+// getTrafficBonuses возвращает бонусный трафик пользователей по промокодам в байтах.
+// Таблица promo_traffic_bonuses принадлежит системе промокодов и может отсутствовать.
+func getTrafficBonuses() map[int64]int64 {
+	bonuses := make(map[int64]int64)
+	db := GetDatabasePG()
+	if db == nil {
+		return bonuses
+	}
+
+	rows, err := db.Query(`SELECT user_id, COALESCE(SUM(traffic_gb), 0) FROM promo_traffic_bonuses GROUP BY user_id`)
+	if err != nil {
+		log.Printf("TRAFFIC_QUOTA: Бонусный трафик недоступен: %v", err)
+		return bonuses
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, gb int64
+		if err := rows.Scan(&userID, &gb); err != nil {
+			log.Printf("TRAFFIC_QUOTA: Ошибка чтения бонусного трафика: %v", err)
+			continue
+		}
+		bonuses[userID] = gb * bytesInGB
+	}
+	return bonuses
+}
+
+// getTrafficWindows возвращает текущие окна пользователя (отсутствующие создаются пустыми)
+func getTrafficWindows(telegramID int64, limits map[string]int64, now time.Time) ([]trafficWindow, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	var windows []trafficWindow
+	for _, period := range []string{TrafficPeriodDay, TrafficPeriodWeek, TrafficPeriodMonth} {
+		w := trafficWindow{Period: period, Start: trafficPeriodStart(period, now), LimitBytes: limits[period]}
+		err := db.QueryRow(`
+			SELECT used_bytes, bonus_bytes, pack_bytes, notified_percent FROM traffic_usage
+			WHERE telegram_id = $1 AND period = $2 AND period_start = $3`,
+			telegramID, period, w.Start).Scan(&w.UsedBytes, &w.BonusBytes, &w.PackBytes, &w.NotifiedPercent)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("ошибка получения трафика пользователя %d за %s: %v", telegramID, period, err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// saveTrafficUsage сохраняет окна, состояние пользователя и прирост трафика в историю.
+// pack_bytes не перезаписывается: пакеты добавляет только PurchaseTrafficPack.
+func saveTrafficUsage(state *trafficQuotaState, windows []trafficWindow, delta int64) error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, w := range windows {
+		_, err := tx.Exec(`
+			INSERT INTO traffic_usage (telegram_id, period, period_start, used_bytes, bonus_bytes, notified_percent, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NOW())
+			ON CONFLICT (telegram_id, period, period_start) DO UPDATE SET
+				used_bytes = EXCLUDED.used_bytes, bonus_bytes = EXCLUDED.bonus_bytes,
+				notified_percent = EXCLUDED.notified_percent, updated_at = NOW()`,
+			state.TelegramID, w.Period, w.Start, w.UsedBytes, w.BonusBytes, w.NotifiedPercent)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения трафика пользователя %d: %v", state.TelegramID, err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO traffic_quota_state (telegram_id, server_id, last_bytes, bonus_used_bytes, blocked, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (telegram_id) DO UPDATE SET
+			server_id = EXCLUDED.server_id, last_bytes = EXCLUDED.last_bytes,
+			bonus_used_bytes = EXCLUDED.bonus_used_bytes, blocked = EXCLUDED.blocked, updated_at = NOW()`,
+		state.TelegramID, state.ServerID, state.LastBytes, state.BonusUsedBytes, state.Blocked)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения состояния трафика пользователя %d: %v", state.TelegramID, err)
+	}
+
+	if delta > 0 {
+		_, err = tx.Exec(`INSERT INTO traffic_snapshots (telegram_id, server_id, bytes) VALUES ($1, $2, $3)`,
+			state.TelegramID, state.ServerID, delta)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения истории трафика пользователя %d: %v", state.TelegramID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка фиксации транзакции: %v", err)
+	}
+	return nil
+}
+
+// collectServerCounters возвращает счетчики трафика пользователей сервера
+func collectServerCounters(server *Server, states []*trafficQuotaState) (map[int64]trafficCounter, error) {
+	counters := make(map[int64]trafficCounter)
+
+	switch server.BackendType() {
+	case BackendXUI:
+		// Трафик всех клиентов приходит одним запросом inbound'а
+		sessionCookie, err := LoginServer(server)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка авторизации в панели: %v", err)
+		}
+		inbound, settings, err := getInboundSettings(sessionCookie)
+		if err != nil {
+			return nil, err
+		}
+		for _, state := range states {
+			client := FindClientByTelegramID(settings.Clients, state.TelegramID)
+			if client == nil {
+				continue
+			}
+			counter := trafficCounter{Enabled: client.Enable}
+			if stats := FindClientStats(inbound, client.Email); stats != nil {
+				counter.Bytes = stats.Up + stats.Down
+			}
+			counters[state.TelegramID] = counter
+		}
+
+	case BackendXray:
+		if err := collectXrayTraffic(server); err != nil {
+			log.Printf("TRAFFIC_QUOTA: %v", err)
+		}
+		for _, state := range states {
+			client, err := GetXrayClient(server.ID, state.TelegramID)
+			if err != nil {
+				return nil, err
+			}
+			if client != nil {
+				counters[state.TelegramID] = trafficCounter{Bytes: client.Upload + client.Download, Enabled: client.Enabled}
+			}
+		}
+
+	default:
+		backend := NewBackend(server)
+		for _, state := range states {
+			usage, err := backend.GetUsage(&User{TelegramID: state.TelegramID})
+			if err != nil {
+				log.Printf("TRAFFIC_QUOTA: Трафик пользователя %d на сервере %s недоступен: %v", state.TelegramID, server.ID, err)
+				continue
+			}
+			counters[state.TelegramID] = trafficCounter{Bytes: usage.Upload + usage.Download, Enabled: usage.Enabled}
+		}
+	}
+	return counters, nil
+}
+
+// CheckAndDisableTrafficLimit переносит трафик клиентов из панелей в окна учета (день, неделя, месяц),
+// отключает клиентов сверх лимита и включает их после сброса окна. Пользователь получает уведомления
+// при использовании 80% и 100% доступного трафика.
+func CheckAndDisableTrafficLimit() error {
+	log.Printf("CHECK_AND_DISABLE_TRAFFIC_LIMIT: Начало проверки трафика")
+
+	now := time.Now()
+	limits := trafficPeriodLimits(GetTrafficConfig())
+
+	byServer, err := getTrafficQuotaStates(now)
+	if err != nil {
+		return err
+	}
+	bonuses := getTrafficBonuses()
+
+	loads, err := GetServerLoads()
+	if err != nil {
+		return err
+	}
+
+	checked, disabled, enabled := 0, 0, 0
+	for _, load := range loads {
+		server := load.Server
+		if server.ID == DefaultServerID {
+			server = DefaultServer()
+		}
+		states := byServer[server.ID]
+		if len(states) == 0 {
+			continue
+		}
+		if IsServerDown(server.ID) {
+			log.Printf("CHECK_AND_DISABLE_TRAFFIC_LIMIT: Сервер %s недоступен, пропускаем", server.ID)
+			continue
+		}
+
+		counters, err := collectServerCounters(server, states)
+		if err != nil {
+			log.Printf("CHECK_AND_DISABLE_TRAFFIC_LIMIT: Ошибка получения трафика сервера %s: %v", server.ID, err)
+			continue
+		}
+
+		for _, state := range states {
+			counter, found := counters[state.TelegramID]
+			if !found {
+				continue
+			}
+			action, err := applyTrafficQuota(server, state, counter, limits, bonuses[state.TelegramID], now)
+			if err != nil {
+				log.Printf("CHECK_AND_DISABLE_TRAFFIC_LIMIT: Ошибка учета трафика пользователя %d: %v", state.TelegramID, err)
+				continue
+			}
+			checked++
+			switch action {
+			case "disabled":
+				disabled++
+			case "enabled":
+				enabled++
+			}
+		}
+	}
+
+	log.Printf("CHECK_AND_DISABLE_TRAFFIC_LIMIT: Проверено клиентов: %d, отключено по лимиту трафика: %d, включено после сброса: %d",
+		checked, disabled, enabled)
+
+	cleanupTrafficHistory(now)
+	return nil
+}
+
+// applyTrafficQuota учитывает трафик пользователя и применяет лимит.
+// Возвращает "disabled", "enabled" или пустую строку.
+func applyTrafficQuota(server *Server, state *trafficQuotaState, counter trafficCounter, limits map[string]int64, bonusTotal int64, now time.Time) (string, error) {
+	windows, err := getTrafficWindows(state.TelegramID, limits, now)
+	if err != nil {
+		return "", err
+	}
+
+	delta := trafficDelta(state, server.ID, counter.Bytes)
+	bonusLeft := max(bonusTotal-state.BonusUsedBytes, 0)
+	charge := chargeTraffic(windows, delta, bonusLeft)
+	state.BonusUsedBytes += charge
+	bonusLeft -= charge
+	state.ServerID = server.ID
+	state.LastBytes = counter.Bytes
+	state.known = true
+
+	var exceeded *trafficWindow
+	for i := range windows {
+		if windows[i].exceeded() {
+			exceeded = &windows[i]
+			break
+		}
+	}
+
+	paid := state.HasActiveConfig && state.ExpiryTime > now.UnixMilli()
+	user := &User{TelegramID: state.TelegramID}
+	action := ""
+
+	switch {
+	case exceeded != nil && counter.Enabled:
+		if err := NewBackend(server).Suspend(user); err != nil {
+			return "", fmt.Errorf("ошибка отключения клиента по лимиту трафика: %v", err)
+		}
+		state.Blocked = true
+		action = "disabled"
+		log.Printf("TRAFFIC_QUOTA: Пользователь %d отключен на сервере %s: лимит за %s исчерпан (%s из %s)",
+			state.TelegramID, server.ID, exceeded.Period, FormatTrafficBytes(exceeded.UsedBytes), FormatTrafficBytes(exceeded.allowance()))
+	case exceeded != nil:
+		state.Blocked = true
+	case state.Blocked:
+		// Окно сброшено или лимит увеличен: включаем только оплаченного пользователя
+		if paid && !counter.Enabled {
+			if err := NewBackend(server).Enable(user); err != nil {
+				return "", fmt.Errorf("ошибка включения клиента после сброса трафика: %v", err)
+			}
+			action = "enabled"
+			log.Printf("TRAFFIC_QUOTA: Пользователь %d включен на сервере %s после сброса лимита трафика", state.TelegramID, server.ID)
+			notifyTrafficQuota(state.TelegramID, "✅ Лимит трафика обновлен, VPN снова работает.")
+		}
+		state.Blocked = false
+	}
+
+	// Уведомляем по самому заполненному окну, порог каждого окна - один раз
+	var notifyWindow *trafficWindow
+	notifyThreshold := 0
+	for i := range windows {
+		if threshold := trafficNotifyThreshold(&windows[i], bonusLeft); threshold > 0 {
+			windows[i].NotifiedPercent = threshold
+			if threshold > notifyThreshold {
+				notifyWindow, notifyThreshold = &windows[i], threshold
+			}
+		}
+	}
+	if notifyWindow != nil && paid {
+		notifyTrafficQuota(state.TelegramID, formatTrafficQuotaNotice(notifyWindow, notifyThreshold, bonusLeft))
+	}
+
+	if err := saveTrafficUsage(state, windows, delta); err != nil {
+		return action, err
+	}
+	return action, nil
+}
+
+// trafficPeriodNames названия окон в родительном падеже для уведомлений
+var trafficPeriodNames = map[string]string{
+	TrafficPeriodDay:   "дневного",
+	TrafficPeriodWeek:  "недельного",
+	TrafficPeriodMonth: "месячного",
+}
+
+// formatTrafficQuotaNotice формирует уведомление о достижении порога
+func formatTrafficQuotaNotice(w *trafficWindow, threshold int, bonusLeft int64) string {
+	reset := trafficPeriodEnd(w.Period, w.Start).Format("02.01.2006 15:04")
+	if threshold >= 100 {
+		return fmt.Sprintf("🚫 Трафик %s лимита исчерпан: %s из %s.\n\nVPN приостановлен до сброса лимита %s.",
+			trafficPeriodNames[w.Period], FormatTrafficBytes(w.UsedBytes), FormatTrafficBytes(w.available(bonusLeft)), reset)
+	}
+	return fmt.Sprintf("⚠️ Использовано %d%% %s лимита трафика: %s из %s.\n\nПосле исчерпания VPN будет приостановлен до сброса лимита %s.",
+		threshold, trafficPeriodNames[w.Period], FormatTrafficBytes(w.UsedBytes), FormatTrafficBytes(w.available(bonusLeft)), reset)
+}
+
+// notifyTrafficQuota отправляет пользователю уведомление о лимите трафика
+func notifyTrafficQuota(telegramID int64, text string) {
+	if GlobalBot == nil {
+		return
+	}
+	if _, err := GlobalBot.Send(tgbotapi.NewMessage(telegramID, text)); err != nil {
+		log.Printf("TRAFFIC_QUOTA: Ошибка отправки уведомления пользователю %d: %v", telegramID, err)
+	}
+}
+
+// FormatTrafficBytes форматирует объем трафика в ГБ или МБ
+func FormatTrafficBytes(bytes int64) string {
+	if bytes >= bytesInGB {
+		return fmt.Sprintf("%.2f ГБ", float64(bytes)/float64(bytesInGB))
+	}
+	return fmt.Sprintf("%.0f МБ", float64(bytes)/float64(1024*1024))
+}
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrafficPeriodStart(t *testing.T) {
+	now := time.Date(2026, 3, 5, 15, 30, 0, 0, time.UTC) // Четверг
+	tests := []struct {
+		period string
+		start  time.Time
+		end    time.Time
+	}{
+		{TrafficPeriodDay, time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)},
+		{TrafficPeriodWeek, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)},
+		{TrafficPeriodMonth, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		start := trafficPeriodStart(test.period, now)
+		if !start.Equal(test.start) {
+			t.Errorf("trafficPeriodStart(%s) = %v, ожидалось %v", test.period, start, test.start)
+		}
+		if end := trafficPeriodEnd(test.period, start); !end.Equal(test.end) {
+			t.Errorf("trafficPeriodEnd(%s) = %v, ожидалось %v", test.period, end, test.end)
+		}
+	}
+
+	// Воскресенье относится к неделе, начавшейся в понедельник
+	sunday := time.Date(2026, 3, 8, 23, 0, 0, 0, time.UTC)
+	if start := trafficPeriodStart(TrafficPeriodWeek, sunday); !start.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Неделя воскресенья начинается %v", start)
+	}
+}
+
+func TestTrafficDelta(t *testing.T) {
+	state := &trafficQuotaState{}
+	if delta := trafficDelta(state, "nl", 500); delta != 0 {
+		t.Errorf("Первое наблюдение должно только запоминать счетчик, прирост %d", delta)
+	}
+
+	state = &trafficQuotaState{ServerID: "nl", LastBytes: 500, known: true}
+	if delta := trafficDelta(state, "nl", 800); delta != 300 {
+		t.Errorf("Прирост счетчика = %d, ожидалось 300", delta)
+	}
+	if delta := trafficDelta(state, "nl", 100); delta != 100 {
+		t.Errorf("После сброса счетчика прирост = %d, ожидалось 100", delta)
+	}
+	if delta := trafficDelta(state, "fi", 700); delta != 700 {
+		t.Errorf("После смены сервера прирост = %d, ожидалось 700", delta)
+	}
+}
+
+func TestChargeTraffic(t *testing.T) {
+	windows := []trafficWindow{
+		{Period: TrafficPeriodDay, LimitBytes: 100, UsedBytes: 90},
+		{Period: TrafficPeriodWeek, LimitBytes: 1000, UsedBytes: 500},
+		{Period: TrafficPeriodMonth, UsedBytes: 2000},
+	}
+
+	// 30 байт: 20 сверх дневного лимита покрываются бонусом
+	if charge := chargeTraffic(windows, 30, 50); charge != 20 {
+		t.Errorf("Израсходовано бонуса %d, ожидалось 20", charge)
+	}
+	if windows[0].UsedBytes != 120 || windows[0].BonusBytes != 20 || windows[0].exceeded() {
+		t.Errorf("Дневное окно после бонуса: %+v", windows[0])
+	}
+	if windows[1].UsedBytes != 530 || windows[1].BonusBytes != 0 || windows[2].UsedBytes != 2030 {
+		t.Errorf("Окна без превышения не должны расходовать бонус: %+v, %+v", windows[1], windows[2])
+	}
+
+	// Оставшихся 30 байт бонуса не хватает на 50
+	if charge := chargeTraffic(windows, 50, 30); charge != 30 {
+		t.Errorf("Израсходовано бонуса %d, ожидалось 30", charge)
+	}
+	if !windows[0].exceeded() || windows[2].exceeded() {
+		t.Errorf("Дневное окно должно быть превышено, месячное без лимита - нет: %+v, %+v", windows[0], windows[2])
+	}
+
+	// Одни и те же байты сверх двух лимитов списывают бонус один раз
+	both := []trafficWindow{
+		{Period: TrafficPeriodDay, LimitBytes: 100, UsedBytes: 100},
+		{Period: TrafficPeriodWeek, LimitBytes: 100, UsedBytes: 100},
+	}
+	if charge := chargeTraffic(both, 10, 100); charge != 10 || both[0].BonusBytes != 10 || both[1].BonusBytes != 10 {
+		t.Errorf("Бонус при двух превышенных окнах: %d, %+v", charge, both)
+	}
+}
+
+func TestTrafficNotifyThreshold(t *testing.T) {
+	w := &trafficWindow{Period: TrafficPeriodDay, LimitBytes: 100, UsedBytes: 85}
+	if threshold := trafficNotifyThreshold(w, 0); threshold != 80 {
+		t.Errorf("Порог при 85%% = %d, ожидалось 80", threshold)
+	}
+
+	// Оставшийся бонус отодвигает порог
+	if threshold := trafficNotifyThreshold(w, 100); threshold != 0 {
+		t.Errorf("Порог при 85 из 200 = %d, ожидалось 0", threshold)
+	}
+
+	w.NotifiedPercent = 80
+	if threshold := trafficNotifyThreshold(w, 0); threshold != 0 {
+		t.Errorf("Повторное уведомление о 80%%: %d", threshold)
+	}
+	w.UsedBytes = 101
+	if threshold := trafficNotifyThreshold(w, 0); threshold != 100 {
+		t.Errorf("Порог при превышении = %d, ожидалось 100", threshold)
+	}
+
+	unlimited := &trafficWindow{Period: TrafficPeriodMonth, UsedBytes: 1000}
+	if threshold := trafficNotifyThreshold(unlimited, 0); threshold != 0 {
+		t.Errorf("Окно без лимита не должно уведомлять: %d", threshold)
+	}
+}
@@ -0,0 +1,698 @@
+package common
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Статусы проверки связанных пробных аккаунтов
+const (
+	TrialAbusePending   = "pending"   // Ожидает решения администратора
+	TrialAbuseBlocked   = "blocked"   // Повторные пробные периоды запрещены
+	TrialAbuseRevoked   = "revoked"   // Пробный период отозван
+	TrialAbuseDismissed = "dismissed" // Не нарушение
+)
+
+// Действия, применяемые к связанным аккаунтам автоматически (TRIAL_ABUSE_AUTO_ACTION)
+const (
+	TrialAbuseActionBlock  = "block"  // Запретить повторные пробные периоды
+	TrialAbuseActionRevoke = "revoke" // Отозвать пробный период
+)
+
+// TrialAbuseCase связанные пробные аккаунты, подключавшиеся с одного IP
+type TrialAbuseCase struct {
+	ID         int64
+	IP         string
+	Accounts   []int64 // Аккаунты по дате регистрации, первый считается основным
+	Status     string
+	Action     string // Примененное автоматически действие
+	CreatedAt  time.Time
+	ResolvedAt *time.Time
+	ResolvedBy int64
+}
+
+// CreateTrialAbuseTables создает таблицы поиска связанных пробных аккаунтов
+func CreateTrialAbuseTables() error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS trial_ip_seen (
+		telegram_id BIGINT NOT NULL,
+		ip VARCHAR(45) NOT NULL,
+		first_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		last_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (telegram_id, ip)
+	);
+	CREATE TABLE IF NOT EXISTS trial_abuse_cases (
+		id SERIAL PRIMARY KEY,
+		ip VARCHAR(45) NOT NULL,
+		accounts TEXT NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		action VARCHAR(20) NOT NULL DEFAULT '',
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		resolved_at TIMESTAMP WITH TIME ZONE,
+		resolved_by BIGINT
+	);
+	CREATE TABLE IF NOT EXISTS trial_blocked_ips (
+		ip VARCHAR(45) PRIMARY KEY,
+		case_id BIGINT NOT NULL,
+		action VARCHAR(20) NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+	CREATE TABLE IF NOT EXISTS trial_abuse_revocations (
+		case_id BIGINT NOT NULL,
+		telegram_id BIGINT NOT NULL,
+		balance DECIMAL(10,2) NOT NULL,
+		expiry_time BIGINT NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (case_id, telegram_id)
+	);
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS trial_blocked BOOLEAN NOT NULL DEFAULT false;`
+
+	indexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_trial_ip_seen_ip ON trial_ip_seen(ip);
+	CREATE INDEX IF NOT EXISTS idx_trial_abuse_cases_ip ON trial_abuse_cases(ip);
+	CREATE INDEX IF NOT EXISTS idx_trial_abuse_cases_status ON trial_abuse_cases(status);
+	CREATE INDEX IF NOT EXISTS idx_trial_blocked_ips_case ON trial_blocked_ips(case_id);`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблиц trial_abuse: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов trial_abuse: %v", err)
+	}
+
+	return nil
+}
+
+// IsTrialBlocked проверяет, запрещен ли пользователю пробный период: самому аккаунту
+// или IP-адресу, с которого он подключался (новые аккаунты с заблокированного IP)
+func IsTrialBlocked(telegramID int64) bool {
+	db := GetDatabasePG()
+	if db == nil || !TRIAL_ABUSE_ENABLED {
+		return false
+	}
+
+	var blocked bool
+	var blockedIP sql.NullString
+	err := db.QueryRow(`
+		SELECT u.trial_blocked,
+		       (SELECT b.ip FROM trial_ip_seen s JOIN trial_blocked_ips b ON b.ip = s.ip
+		        WHERE s.telegram_id = u.telegram_id LIMIT 1)
+		FROM users u WHERE u.telegram_id = $1`, telegramID).Scan(&blocked, &blockedIP)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("TRIAL_ABUSE: Ошибка проверки запрета пробного периода для %d: %v", telegramID, err)
+		}
+		return false
+	}
+
+	if !blocked && blockedIP.Valid {
+		log.Printf("TRIAL_ABUSE: Пользователь %d подключался с заблокированного IP %s, пробный период запрещен", telegramID, blockedIP.String)
+		if err := setTrialBlocked(telegramID, true); err != nil {
+			log.Printf("TRIAL_ABUSE: %v", err)
+		}
+		blocked = true
+	}
+
+	return blocked
+}
+
+// ScanTrialAbuse сопоставляет IP-адреса пробных аккаунтов из лога 3x-ui и заводит проверки на связанные аккаунты
+func ScanTrialAbuse(bot *tgbotapi.BotAPI) error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	// Тот же анализ лога, что и в IP бане: email клиента = Telegram ID
+	stats, err := NewLogAnalyzer(IP_ACCUMULATED_PATH).AnalyzeLog()
+	if err != nil {
+		return fmt.Errorf("ошибка анализа лога подключений: %v", err)
+	}
+
+	// IP записываем для всех неоплативших аккаунтов: новый аккаунт с заблокированного IP не получит пробный период
+	unpaidAccounts, err := unpaidAccounts(db)
+	if err != nil {
+		return err
+	}
+
+	observed := 0
+	for email, emailStats := range stats {
+		telegramID, err := strconv.ParseInt(email, 10, 64)
+		if err != nil || !unpaidAccounts[telegramID] {
+			continue
+		}
+
+		for ip := range emailStats.IPs {
+			_, err := db.Exec(`
+				INSERT INTO trial_ip_seen (telegram_id, ip) VALUES ($1, $2)
+				ON CONFLICT (telegram_id, ip) DO UPDATE SET last_seen = NOW()`,
+				telegramID, ip)
+			if err != nil {
+				return fmt.Errorf("ошибка сохранения IP пробного аккаунта %d: %v", telegramID, err)
+			}
+			observed++
+		}
+	}
+
+	// Связи старше окна не учитываем
+	if _, err := db.Exec("DELETE FROM trial_ip_seen WHERE last_seen < NOW() - make_interval(hours => $1)", TRIAL_ABUSE_WINDOW_HOURS); err != nil {
+		return fmt.Errorf("ошибка очистки IP пробных аккаунтов: %v", err)
+	}
+
+	if err := enforceBlockedIPs(db); err != nil {
+		return err
+	}
+
+	groups, err := linkedTrialAccounts(db)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("TRIAL_ABUSE: Записано IP пробных аккаунтов: %d, IP с несколькими аккаунтами: %d", observed, len(groups))
+
+	for ip, accounts := range groups {
+		if err := openTrialAbuseCase(db, bot, ip, accounts); err != nil {
+			log.Printf("TRIAL_ABUSE: Ошибка проверки IP %s: %v", ip, err)
+		}
+	}
+
+	return nil
+}
+
+// unpaidAccounts возвращает аккаунты, ни разу не платившие
+func unpaidAccounts(db *sql.DB) (map[int64]bool, error) {
+	rows, err := db.Query("SELECT telegram_id FROM users WHERE total_paid = 0")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения неоплативших аккаунтов: %v", err)
+	}
+	defer rows.Close()
+
+	accounts := make(map[int64]bool)
+	for rows.Next() {
+		var telegramID int64
+		if err := rows.Scan(&telegramID); err != nil {
+			return nil, fmt.Errorf("ошибка чтения неоплатившего аккаунта: %v", err)
+		}
+		accounts[telegramID] = true
+	}
+
+	return accounts, rows.Err()
+}
+
+// enforceBlockedIPs применяет действие заблокированного IP к пробным аккаунтам, подключившимся с него позже
+func enforceBlockedIPs(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (s.telegram_id) s.telegram_id, b.case_id, b.action
+		FROM trial_ip_seen s
+		JOIN trial_blocked_ips b ON b.ip = s.ip
+		JOIN users u ON u.telegram_id = s.telegram_id
+		WHERE u.has_used_trial = true AND u.total_paid = 0 AND u.trial_blocked = false
+		ORDER BY s.telegram_id, b.created_at`)
+	if err != nil {
+		return fmt.Errorf("ошибка поиска аккаунтов с заблокированных IP: %v", err)
+	}
+
+	type blockedAccount struct {
+		telegramID int64
+		caseID     int64
+		action     string
+	}
+	var accounts []blockedAccount
+	for rows.Next() {
+		var account blockedAccount
+		if err := rows.Scan(&account.telegramID, &account.caseID, &account.action); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка чтения аккаунта с заблокированного IP: %v", err)
+		}
+		accounts = append(accounts, account)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка поиска аккаунтов с заблокированных IP: %v", err)
+	}
+
+	for _, account := range accounts {
+		log.Printf("TRIAL_ABUSE: Пробный аккаунт %d подключился с IP, заблокированного проверкой #%d", account.telegramID, account.caseID)
+		applyTrialAbuseActionTo(account.caseID, account.action, account.telegramID)
+	}
+
+	return nil
+}
+
+// linkedTrialAccounts возвращает IP, с которых в окне подключались несколько неоплативших пробных аккаунтов
+func linkedTrialAccounts(db *sql.DB) (map[string][]int64, error) {
+	rows, err := db.Query(`
+		SELECT s.ip, string_agg(s.telegram_id::text, ',' ORDER BY u.created_at, s.telegram_id)
+		FROM trial_ip_seen s
+		JOIN users u ON u.telegram_id = s.telegram_id
+		WHERE u.has_used_trial = true AND u.total_paid = 0
+		  AND s.last_seen >= NOW() - make_interval(hours => $1)
+		GROUP BY s.ip
+		HAVING COUNT(*) >= $2`,
+		TRIAL_ABUSE_WINDOW_HOURS, TRIAL_ABUSE_MIN_ACCOUNTS)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска связанных пробных аккаунтов: %v", err)
+	}
+	defer rows.Close()
+
+	groups := make(map[string][]int64)
+	for rows.Next() {
+		var ip, accounts string
+		if err := rows.Scan(&ip, &accounts); err != nil {
+			return nil, fmt.Errorf("ошибка чтения связанных пробных аккаунтов: %v", err)
+		}
+		groups[ip] = parseTrialAccounts(accounts)
+	}
+
+	return groups, rows.Err()
+}
+
+// openTrialAbuseCase заводит проверку по IP или дополняет открытую, если появились новые аккаунты
+func openTrialAbuseCase(db *sql.DB, bot *tgbotapi.BotAPI, ip string, accounts []int64) error {
+	accountsText := formatTrialAccounts(accounts)
+
+	var caseID int64
+	var status, previous string
+	err := db.QueryRow("SELECT id, status, accounts FROM trial_abuse_cases WHERE ip = $1 ORDER BY id DESC LIMIT 1", ip).
+		Scan(&caseID, &status, &previous)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("ошибка получения проверки: %v", err)
+	}
+
+	if err == nil && previous == accountsText {
+		return nil
+	}
+
+	if err == nil && status == TrialAbusePending {
+		if _, err := db.Exec("UPDATE trial_abuse_cases SET accounts = $1 WHERE id = $2", accountsText, caseID); err != nil {
+			return fmt.Errorf("ошибка обновления проверки: %v", err)
+		}
+		log.Printf("TRIAL_ABUSE: Проверка #%d по IP %s дополнена: %s", caseID, ip, accountsText)
+	} else {
+		err := db.QueryRow("INSERT INTO trial_abuse_cases (ip, accounts) VALUES ($1, $2) RETURNING id", ip, accountsText).Scan(&caseID)
+		if err != nil {
+			return fmt.Errorf("ошибка создания проверки: %v", err)
+		}
+		log.Printf("TRIAL_ABUSE: ⚠️ Связанные пробные аккаунты на IP %s (проверка #%d): %s", ip, caseID, accountsText)
+	}
+
+	if TRIAL_ABUSE_AUTO_ACTION != "" {
+		applyTrialAbuseAction(caseID, ip, TRIAL_ABUSE_AUTO_ACTION, accounts)
+		if _, err := db.Exec("UPDATE trial_abuse_cases SET action = $1 WHERE id = $2", TRIAL_ABUSE_AUTO_ACTION, caseID); err != nil {
+			log.Printf("TRIAL_ABUSE: Ошибка сохранения действия по проверке #%d: %v", caseID, err)
+		}
+	}
+
+	abuseCase, err := GetTrialAbuseCase(caseID)
+	if err != nil {
+		return err
+	}
+	sendTrialAbuseNotification(bot, abuseCase)
+
+	return nil
+}
+
+// applyTrialAbuseAction применяет действие ко всем связанным аккаунтам, кроме первого зарегистрированного,
+// и запоминает IP, чтобы новые аккаунты с него не получали пробный период
+func applyTrialAbuseAction(caseID int64, ip, action string, accounts []int64) {
+	if len(accounts) < 2 {
+		return
+	}
+
+	_, err := GetDatabasePG().Exec(`
+		INSERT INTO trial_blocked_ips (ip, case_id, action) VALUES ($1, $2, $3)
+		ON CONFLICT (ip) DO UPDATE SET case_id = EXCLUDED.case_id, action = EXCLUDED.action`,
+		ip, caseID, action)
+	if err != nil {
+		log.Printf("TRIAL_ABUSE: Ошибка блокировки IP %s по проверке #%d: %v", ip, caseID, err)
+	}
+
+	for _, telegramID := range accounts[1:] {
+		applyTrialAbuseActionTo(caseID, action, telegramID)
+	}
+}
+
+// applyTrialAbuseActionTo запрещает пользователю пробный период и при действии revoke отзывает его
+func applyTrialAbuseActionTo(caseID int64, action string, telegramID int64) {
+	if err := setTrialBlocked(telegramID, true); err != nil {
+		log.Printf("TRIAL_ABUSE: %v", err)
+		return
+	}
+
+	if action == TrialAbuseActionRevoke {
+		if err := revokeTrial(caseID, telegramID); err != nil {
+			log.Printf("TRIAL_ABUSE: Ошибка отзыва пробного периода у %d: %v", telegramID, err)
+			return
+		}
+	}
+
+	log.Printf("TRIAL_ABUSE: Пользователь %d: применено действие %s", telegramID, action)
+}
+
+// setTrialBlocked запрещает или разрешает пользователю пробный период
+func setTrialBlocked(telegramID int64, blocked bool) error {
+	_, err := GetDatabasePG().Exec("UPDATE users SET trial_blocked = $1, updated_at = NOW() WHERE telegram_id = $2", blocked, telegramID)
+	if err != nil {
+		return fmt.Errorf("ошибка изменения запрета пробного периода для %d: %v", telegramID, err)
+	}
+	return nil
+}
+
+// revokeTrial списывает пробный баланс и отключает конфиг неоплатившего пользователя.
+// Списанный баланс и срок сохраняются, чтобы вернуть их, если проверку признают не нарушением.
+func revokeTrial(caseID, telegramID int64) error {
+	user, err := GetUserByTelegramID(telegramID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения пользователя: %v", err)
+	}
+	if user == nil {
+		return fmt.Errorf("пользователь не найден")
+	}
+	if user.TotalPaid > 0 {
+		return fmt.Errorf("пользователь уже оплачивал подписку")
+	}
+
+	db := GetDatabasePG()
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Строка блокируется, чтобы сохраненный баланс совпал со списанным
+	var balance float64
+	err = tx.QueryRow("SELECT balance FROM users WHERE telegram_id = $1 AND total_paid = 0 FOR UPDATE", telegramID).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("пользователь уже оплачивал подписку")
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка получения пробного баланса: %v", err)
+	}
+
+	if _, err := tx.Exec("UPDATE users SET balance = 0, updated_at = NOW() WHERE telegram_id = $1", telegramID); err != nil {
+		return fmt.Errorf("ошибка списания пробного баланса: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO trial_abuse_revocations (case_id, telegram_id, balance, expiry_time) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (case_id, telegram_id) DO NOTHING`, caseID, telegramID, balance, user.ExpiryTime)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения отзыва пробного периода: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка списания пробного баланса: %v", err)
+	}
+	user.Balance = 0
+
+	return DisableClientConfig(user)
+}
+
+// GetTrialAbuseCase возвращает проверку связанных аккаунтов по ID
+func GetTrialAbuseCase(id int64) (*TrialAbuseCase, error) {
+	row := GetDatabasePG().QueryRow(`
+		SELECT id, ip, accounts, status, action, created_at, resolved_at, COALESCE(resolved_by, 0)
+		FROM trial_abuse_cases WHERE id = $1`, id)
+
+	abuseCase, err := scanTrialAbuseCase(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("проверка #%d не найдена", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения проверки #%d: %v", id, err)
+	}
+
+	return abuseCase, nil
+}
+
+// GetPendingTrialAbuseCases возвращает проверки, ожидающие решения администратора
+func GetPendingTrialAbuseCases(limit int) ([]*TrialAbuseCase, error) {
+	rows, err := GetDatabasePG().Query(`
+		SELECT id, ip, accounts, status, action, created_at, resolved_at, COALESCE(resolved_by, 0)
+		FROM trial_abuse_cases WHERE status = $1
+		ORDER BY created_at LIMIT $2`, TrialAbusePending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения проверок пробных аккаунтов: %v", err)
+	}
+	defer rows.Close()
+
+	var cases []*TrialAbuseCase
+	for rows.Next() {
+		abuseCase, err := scanTrialAbuseCase(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения проверки пробных аккаунтов: %v", err)
+		}
+		cases = append(cases, abuseCase)
+	}
+
+	return cases, rows.Err()
+}
+
+// ResolveTrialAbuseCase закрывает проверку решением администратора.
+// Блокировка и отзыв применяются ко всем аккаунтам, кроме первого; "не нарушение" снимает запреты.
+func ResolveTrialAbuseCase(id int64, status string, adminID int64) (*TrialAbuseCase, error) {
+	var ip, accounts string
+	err := GetDatabasePG().QueryRow(`
+		UPDATE trial_abuse_cases SET status = $1, resolved_at = NOW(), resolved_by = $2
+		WHERE id = $3 AND status = $4
+		RETURNING ip, accounts`, status, adminID, id, TrialAbusePending).Scan(&ip, &accounts)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("проверка #%d уже рассмотрена или не найдена", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка закрытия проверки #%d: %v", id, err)
+	}
+
+	linked := parseTrialAccounts(accounts)
+	switch status {
+	case TrialAbuseBlocked:
+		applyTrialAbuseAction(id, ip, TrialAbuseActionBlock, linked)
+	case TrialAbuseRevoked:
+		applyTrialAbuseAction(id, ip, TrialAbuseActionRevoke, linked)
+	case TrialAbuseDismissed:
+		dismissTrialAbuseCase(id, linked)
+	}
+
+	log.Printf("TRIAL_ABUSE: Проверка #%d закрыта администратором %d со статусом %s", id, adminID, status)
+	return GetTrialAbuseCase(id)
+}
+
+// dismissTrialAbuseCase снимает запреты проверки и возвращает автоматически отозванные пробные периоды
+func dismissTrialAbuseCase(id int64, accounts []int64) {
+	db := GetDatabasePG()
+	if _, err := db.Exec("DELETE FROM trial_blocked_ips WHERE case_id = $1", id); err != nil {
+		log.Printf("TRIAL_ABUSE: Ошибка снятия блокировки IP по проверке #%d: %v", id, err)
+	}
+
+	for _, telegramID := range accounts {
+		if err := setTrialBlocked(telegramID, false); err != nil {
+			log.Printf("TRIAL_ABUSE: %v", err)
+		}
+	}
+
+	rows, err := db.Query("SELECT telegram_id, balance, expiry_time FROM trial_abuse_revocations WHERE case_id = $1", id)
+	if err != nil {
+		log.Printf("TRIAL_ABUSE: Ошибка получения отозванных пробных периодов по проверке #%d: %v", id, err)
+		return
+	}
+
+	type revocation struct {
+		telegramID int64
+		balance    float64
+		expiryTime int64
+	}
+	var revocations []revocation
+	for rows.Next() {
+		var r revocation
+		if err := rows.Scan(&r.telegramID, &r.balance, &r.expiryTime); err != nil {
+			log.Printf("TRIAL_ABUSE: Ошибка чтения отозванного пробного периода: %v", err)
+			continue
+		}
+		revocations = append(revocations, r)
+	}
+	rows.Close()
+
+	for _, r := range revocations {
+		// Запись удаляется до возврата: повторное закрытие проверки не вернет пробный период дважды
+		result, err := db.Exec("DELETE FROM trial_abuse_revocations WHERE case_id = $1 AND telegram_id = $2", id, r.telegramID)
+		if err != nil {
+			log.Printf("TRIAL_ABUSE: Ошибка удаления отзыва пробного периода %d: %v", r.telegramID, err)
+			continue
+		}
+		if deleted, _ := result.RowsAffected(); deleted == 0 {
+			continue
+		}
+
+		if err := restoreTrial(r.telegramID, r.balance, r.expiryTime); err != nil {
+			log.Printf("TRIAL_ABUSE: ❌ Ошибка возврата пробного периода пользователю %d (баланс %.2f, срок %d): %v",
+				r.telegramID, r.balance, r.expiryTime, err)
+			continue
+		}
+		log.Printf("TRIAL_ABUSE: Пробный период пользователя %d восстановлен по проверке #%d", r.telegramID, id)
+	}
+}
+
+// restoreTrial возвращает отозванный пробный баланс и оставшийся срок конфига
+func restoreTrial(telegramID int64, balance float64, expiryTime int64) error {
+	if balance > 0 {
+		if err := AddBalance(telegramID, balance); err != nil {
+			return fmt.Errorf("ошибка возврата пробного баланса: %v", err)
+		}
+		// В режиме автосписания срок восстановит пересчет баланса
+		if AUTO_BILLING_ENABLED && !TARIFF_MODE_ENABLED {
+			return nil
+		}
+	}
+
+	days := remainingTrialDays(expiryTime, time.Now())
+	if days == 0 {
+		return nil
+	}
+
+	user, err := GetUserByTelegramID(telegramID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения пользователя: %v", err)
+	}
+	if user == nil {
+		return fmt.Errorf("пользователь не найден")
+	}
+
+	if err := GetUserBackend(telegramID).Extend(user, days); err != nil {
+		return fmt.Errorf("ошибка восстановления конфига: %v", err)
+	}
+
+	user.ExpiryTime = expiryTime
+	user.HasActiveConfig = true
+	if err := UpdateUser(user); err != nil {
+		return fmt.Errorf("ошибка обновления пользователя: %v", err)
+	}
+	return nil
+}
+
+// remainingTrialDays возвращает число дней (с округлением вверх), оставшихся до expiryTime в миллисекундах
+func remainingTrialDays(expiryTime int64, now time.Time) int {
+	remaining := time.UnixMilli(expiryTime).Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	return int(math.Ceil(remaining.Hours() / 24))
+}
+
+// trialAbuseScanner общий интерфейс sql.Row и sql.Rows
+type trialAbuseScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTrialAbuseCase читает проверку из строки результата
+func scanTrialAbuseCase(row trialAbuseScanner) (*TrialAbuseCase, error) {
+	var abuseCase TrialAbuseCase
+	var accounts string
+	var resolvedAt sql.NullTime
+
+	err := row.Scan(&abuseCase.ID, &abuseCase.IP, &accounts, &abuseCase.Status, &abuseCase.Action,
+		&abuseCase.CreatedAt, &resolvedAt, &abuseCase.ResolvedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	abuseCase.Accounts = parseTrialAccounts(accounts)
+	if resolvedAt.Valid {
+		abuseCase.ResolvedAt = &resolvedAt.Time
+	}
+
+	return &abuseCase, nil
+}
+
+// parseTrialAccounts разбирает список аккаунтов "id1,id2,..."
+func parseTrialAccounts(text string) []int64 {
+	var accounts []int64
+	for _, part := range strings.Split(text, ",") {
+		if telegramID, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64); err == nil {
+			accounts = append(accounts, telegramID)
+		}
+	}
+	return accounts
+}
+
+// formatTrialAccounts записывает список аккаунтов в виде "id1,id2,..."
+func formatTrialAccounts(accounts []int64) string {
+	parts := make([]string, len(accounts))
+	for i, telegramID := range accounts {
+		parts[i] = strconv.FormatInt(telegramID, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// TrialAbuseCaseText описывает проверку для администратора
+func TrialAbuseCaseText(abuseCase *TrialAbuseCase) string {
+	text := fmt.Sprintf("🕵️ Связанные пробные аккаунты #%d\n\n"+
+		"🌐 IP: %s\n"+
+		"📅 Обнаружено: %s\n"+
+		"👥 Аккаунты (%d):\n",
+		abuseCase.ID, abuseCase.IP, abuseCase.CreatedAt.Format("02.01.2006 15:04"), len(abuseCase.Accounts))
+
+	for i, telegramID := range abuseCase.Accounts {
+		mark := ""
+		if i == 0 {
+			mark = " (первый, не затрагивается)"
+		}
+		text += fmt.Sprintf("• %d%s\n", telegramID, mark)
+	}
+
+	switch abuseCase.Action {
+	case TrialAbuseActionBlock:
+		text += "\n⛔ Автоматически: повторный пробный период запрещен"
+	case TrialAbuseActionRevoke:
+		text += "\n🚫 Автоматически: пробный период отозван"
+	}
+
+	switch abuseCase.Status {
+	case TrialAbuseBlocked:
+		text += "\n\n⛔ Решение: пробный период запрещен"
+	case TrialAbuseRevoked:
+		text += "\n\n🚫 Решение: пробный период отозван"
+	case TrialAbuseDismissed:
+		text += "\n\n✅ Решение: не нарушение, запреты сняты, отозванные пробные периоды возвращены"
+	}
+
+	return text
+}
+
+// TrialAbuseKeyboard клавиатура решения по проверке
+func TrialAbuseKeyboard(id int64) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🚫 Отозвать пробный", fmt.Sprintf("trial_abuse_revoke:%d", id)),
+			tgbotapi.NewInlineKeyboardButtonData("⛔ Запретить пробный", fmt.Sprintf("trial_abuse_block:%d", id)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Не нарушение", fmt.Sprintf("trial_abuse_ok:%d", id)),
+		),
+	)
+}
+
+// sendTrialAbuseNotification отправляет администратору проверку связанных аккаунтов
+func sendTrialAbuseNotification(bot *tgbotapi.BotAPI, abuseCase *TrialAbuseCase) {
+	if bot == nil {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(ADMIN_ID, TrialAbuseCaseText(abuseCase))
+	msg.ReplyMarkup = TrialAbuseKeyboard(abuseCase.ID)
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("TRIAL_ABUSE: Ошибка отправки проверки #%d администратору: %v", abuseCase.ID, err)
+	}
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrialAccountsRoundTrip(t *testing.T) {
+	accounts := []int64{1001, 42, 987654321}
+
+	text := formatTrialAccounts(accounts)
+	if text != "1001,42,987654321" {
+		t.Errorf("formatTrialAccounts = %q", text)
+	}
+	if parsed := parseTrialAccounts(text); !reflect.DeepEqual(parsed, accounts) {
+		t.Errorf("parseTrialAccounts(%q) = %v, ожидалось %v", text, parsed, accounts)
+	}
+
+	// Пробелы и мусор в сохраненном списке пропускаются
+	if parsed := parseTrialAccounts(" 5, x,7,"); !reflect.DeepEqual(parsed, []int64{5, 7}) {
+		t.Errorf("parseTrialAccounts с мусором = %v", parsed)
+	}
+	if parsed := parseTrialAccounts(""); parsed != nil {
+		t.Errorf("parseTrialAccounts пустой строки = %v", parsed)
+	}
+}
+
+func TestRemainingTrialDays(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		expiry   time.Time
+		expected int
+	}{
+		{"истек", now.Add(-time.Hour), 0},
+		{"истекает сейчас", now, 0},
+		{"меньше дня", now.Add(time.Hour), 1},
+		{"ровно три дня", now.AddDate(0, 0, 3), 3},
+		{"три дня с небольшим", now.AddDate(0, 0, 3).Add(time.Minute), 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if days := remainingTrialDays(tt.expiry.UnixMilli(), now); days != tt.expected {
+				t.Errorf("remainingTrialDays = %d, ожидалось %d", days, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTrialAbuseCaseText(t *testing.T) {
+	abuseCase := &TrialAbuseCase{
+		ID:        7,
+		IP:        "10.0.0.1",
+		Accounts:  []int64{100, 200},
+		Status:    TrialAbuseDismissed,
+		Action:    TrialAbuseActionRevoke,
+		CreatedAt: time.Now(),
+	}
+
+	text := TrialAbuseCaseText(abuseCase)
+	for _, expected := range []string{"#7", "10.0.0.1", "• 100 (первый, не затрагивается)", "• 200", "пробный период отозван", "пробные периоды возвращены"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("В описании проверки нет %q:\n%s", expected, text)
+		}
+	}
+}
+
+func TestIsTrialBlockedDisabled(t *testing.T) {
+	saved := TRIAL_ABUSE_ENABLED
+	defer func() { TRIAL_ABUSE_ENABLED = saved }()
+
+	// Без защиты от злоупотреблений пробный период не запрещается
+	TRIAL_ABUSE_ENABLED = false
+	if IsTrialBlocked(1) {
+		t.Error("IsTrialBlocked = true при отключенной защите")
+	}
+	if !NewTrialPeriodManager().CanUseTrial(&User{TelegramID: 1}) {
+		t.Error("CanUseTrial = false для нового пользователя при отключенной защите")
+	}
+}
@@ -19,25 +19,43 @@ func NewTrialPeriodManager() *TrialPeriodManager {
 
 // CanUseTrial проверяет, может ли пользователь использовать пробный период
 func (tm *TrialPeriodManager) CanUseTrial(user *User) bool {
-	return !user.HasUsedTrial
+	return !user.HasUsedTrial && !IsTrialBlocked(user.TelegramID)
 }
 
 // HandleTrialPeriod обрабатывает предложение пробного периода
 func (tm *TrialPeriodManager) HandleTrialPeriod(bot *tgbotapi.BotAPI, user *User, chatID int64) {
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🎁 Активировать пробный период", "activate_trial"),
-		),
-	)
+	if IsTrialBlocked(user.TelegramID) {
+		log.Printf("TRIAL: Пользователю %d запрещен пробный период, предложение не отправляем", user.TelegramID)
+		return
+	}
+
+	policy, _, ok := tm.SelectTrialPolicy(user, "")
+	if !ok {
+		log.Printf("TRIAL: Для пользователя %d нет подходящей политики пробного периода", user.TelegramID)
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if url := channelURL(policy.RequiredChannel); url != "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("📢 Подписаться на канал", url),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🎁 Активировать пробный период", "activate_trial"),
+	))
 
 	text := fmt.Sprintf("🎁 Добро пожаловать, %s!\n\n"+
 		"У вас есть возможность получить пробный период!\n"+
-		"На ваш баланс будет добавлено %d₽ для ознакомления с сервисом.\n\n"+
-		"Нажмите кнопку ниже, чтобы активировать пробный период.",
-		user.FirstName, TRIAL_BALANCE_AMOUNT)
+		"%s\n\n",
+		user.FirstName, policy.Description())
+	if policy.RequiredChannel != "" {
+		text += fmt.Sprintf("📢 Для активации подпишитесь на канал %s.\n\n", policy.RequiredChannel)
+	}
+	text += "Нажмите кнопку ниже, чтобы активировать пробный период."
 
 	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ReplyMarkup = keyboard
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
 	if _, err := bot.Send(msg); err != nil {
 		log.Printf("Ошибка отправки предложения пробного периода: %v", err)
 	}
@@ -55,19 +73,55 @@ func (tm *TrialPeriodManager) CreateTrialConfig(bot *tgbotapi.BotAPI, user *User
 
 // CreateTrialConfigWithReferral создает конфиг для пробного периода с возможным реферальным кодом
 func (tm *TrialPeriodManager) CreateTrialConfigWithReferral(bot *tgbotapi.BotAPI, user *User, chatID int64, referralCode string) error {
-	log.Printf("TRIAL: Активация пробного периода для пользователя %d (добавление %d₽ на баланс)", user.TelegramID, TRIAL_BALANCE_AMOUNT)
+	// Аккаунт связан с другими пробными аккаунтами или подключался с заблокированного IP
+	if IsTrialBlocked(user.TelegramID) {
+		log.Printf("TRIAL: ❌ Пользователю %d запрещен пробный период (связанные аккаунты)", user.TelegramID)
+		return ErrTrialBlocked
+	}
 
 	// Дополнительная проверка на возможность использования пробного периода
-	if !tm.CanUseTrial(user) {
+	if user.HasUsedTrial {
 		log.Printf("TRIAL: ❌ Пользователь %d уже использовал пробный период, отменяем активацию", user.TelegramID)
 		return fmt.Errorf("пробный период уже был использован")
 	}
 
+	// Выбираем политику по источнику пользователя (органика, реферал, кампания)
+	policy, source, ok := tm.SelectTrialPolicy(user, referralCode)
+	if !ok {
+		log.Printf("TRIAL: ❌ Для пользователя %d (источник %s) нет подходящей политики пробного периода", user.TelegramID, source)
+		return fmt.Errorf("пробный период недоступен")
+	}
+	log.Printf("TRIAL: Активация пробного периода для пользователя %d по политике %s (источник %s)", user.TelegramID, policy.ID, source)
+
+	// Проверяем подписку на обязательный канал
+	if policy.RequiredChannel != "" {
+		member, err := IsChannelMember(bot, policy.RequiredChannel, user.TelegramID)
+		if err != nil {
+			log.Printf("TRIAL: %v", err)
+			return fmt.Errorf("ошибка проверки подписки: %v", err)
+		}
+		if !member {
+			log.Printf("TRIAL: Пользователь %d не подписан на канал %s", user.TelegramID, policy.RequiredChannel)
+			return ErrTrialChannelRequired
+		}
+	}
+
+	// Сумма на баланс: для политики с днями деньги нужны только при автосписании
+	trialDays := policy.TrialDays()
+	trialAmount := policy.BalanceAmount
+	if policy.Type == TrialTypeDays {
+		trialAmount = 0
+		if !TARIFF_MODE_ENABLED {
+			trialAmount = policy.Days * PRICE_PER_DAY
+		}
+	}
+
 	// Добавляем пробный баланс пользователю
-	err := AddBalance(user.TelegramID, float64(TRIAL_BALANCE_AMOUNT))
-	if err != nil {
-		log.Printf("TRIAL: Ошибка добавления пробного баланса для пользователя %d: %v", user.TelegramID, err)
-		return fmt.Errorf("ошибка добавления пробного баланса: %v", err)
+	if trialAmount > 0 {
+		if err := AddBalance(user.TelegramID, float64(trialAmount)); err != nil {
+			log.Printf("TRIAL: Ошибка добавления пробного баланса для пользователя %d: %v", user.TelegramID, err)
+			return fmt.Errorf("ошибка добавления пробного баланса: %v", err)
+		}
 	}
 
 	// Получаем актуальные данные пользователя из базы данных
@@ -86,7 +140,7 @@ func (tm *TrialPeriodManager) CreateTrialConfigWithReferral(bot *tgbotapi.BotAPI
 	user.HasUsedTrial = true
 
 	log.Printf("TRIAL: Пробный баланс %d₽ успешно добавлен для пользователя %d, новый баланс: %.2f₽",
-		TRIAL_BALANCE_AMOUNT, user.TelegramID, user.Balance)
+		trialAmount, user.TelegramID, user.Balance)
 
 	// Обрабатываем реферальный код, если он есть
 	if referralCode != "" {
@@ -115,19 +169,10 @@ func (tm *TrialPeriodManager) CreateTrialConfigWithReferral(bot *tgbotapi.BotAPI
 	// При автосписании (TARIFF_MODE_ENABLED = false) деньги списываются постепенно
 	log.Printf("TRIAL: Создание бесплатного конфига для пробного периода пользователя %d", user.TelegramID)
 
-	// Создаем конфиг через панель 3x-ui БЕЗ списания денег
-	sessionCookie, err := Login()
-	if err != nil {
-		log.Printf("TRIAL: Ошибка авторизации в панели для пользователя %d: %v", user.TelegramID, err)
-		return fmt.Errorf("ошибка авторизации в панели: %v", err)
-	}
-
-	// Создаем конфиг для пробного периода БЕЗ установки статуса "исчерпано"
-	// Рассчитываем дни на основе пробного баланса
-	trialDays := TRIAL_BALANCE_AMOUNT / PRICE_PER_DAY
+	// Создаем конфиг в панели сервера пользователя БЕЗ списания денег и без статуса "исчерпано"
+	// Дни и лимит трафика берутся из политики
 	log.Printf("TRIAL: Создание конфига на %d дней для пробного периода пользователя %d", trialDays, user.TelegramID)
-	err = AddTrialClient(sessionCookie, user, trialDays)
-	if err != nil {
+	if err := GetUserBackendForNewClient(user.TelegramID).CreateUser(user, trialDays, policy.TrafficGB); err != nil {
 		log.Printf("TRIAL: Ошибка создания конфига для пользователя %d: %v", user.TelegramID, err)
 		return fmt.Errorf("ошибка создания конфига: %v", err)
 	}
@@ -139,7 +184,9 @@ func (tm *TrialPeriodManager) CreateTrialConfigWithReferral(bot *tgbotapi.BotAPI
 		return fmt.Errorf("ошибка обновления пользователя: %v", err)
 	}
 
-	configURL := fmt.Sprintf("%s%s", CONFIG_BASE_URL, user.SubID)
+	recordTrialActivation(user.TelegramID, policy, source, trialDays)
+
+	configURL := UserSubscriptionURL(user)
 	log.Printf("TRIAL: ✅ Бесплатный конфиг успешно создан для пользователя %d, URL: %s, баланс остался: %.2f₽",
 		user.TelegramID, configURL, user.Balance)
 
@@ -0,0 +1,306 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Типы пробного периода
+const (
+	TrialTypeBalance = "balance" // Пополнение баланса, дни списываются автосписанием
+	TrialTypeDays    = "days"    // Фиксированное количество дней
+)
+
+// Источники пользователя для выбора политики пробного периода
+const (
+	TrialSourceOrganic        = "organic"   // Пришел без ссылки
+	TrialSourceReferral       = "referral"  // Пришел по реферальной ссылке
+	TrialSourceCampaignPrefix = "campaign:" // Привлечен рекламной кампанией (campaign:<ID>)
+)
+
+// DefaultTrialPolicyID ID политики по умолчанию (TRIAL_BALANCE_AMOUNT на баланс)
+const DefaultTrialPolicyID = "default"
+
+// ErrTrialChannelRequired пользователь не подписан на канал, обязательный для пробного периода
+var ErrTrialChannelRequired = errors.New("для пробного периода нужна подписка на канал")
+
+// ErrTrialBlocked пробный период запрещен из-за связанных пробных аккаунтов
+var ErrTrialBlocked = errors.New("пробный период недоступен для этого аккаунта")
+
+// TrialPolicy политика пробного периода
+type TrialPolicy struct {
+	ID              string   // Идентификатор политики (для статистики конверсии)
+	Type            string   // TrialTypeBalance или TrialTypeDays
+	BalanceAmount   int      // Сумма на баланс для TrialTypeBalance (в рублях)
+	Days            int      // Количество дней для TrialTypeDays
+	TrafficGB       int      // Лимит трафика на пробный период (0 - без лимита)
+	RequiredChannel string   // Канал, подписка на который обязательна (@username или ID чата)
+	Sources         []string // Источники: organic, referral, campaign:<ID>, campaign:* (пусто - любой)
+}
+
+// TrialPolicyStats конверсия пробного периода в оплату по политике
+type TrialPolicyStats struct {
+	PolicyID    string
+	Activations int     // Активаций пробного периода
+	Converted   int     // Из них оплатили после активации
+	Revenue     float64 // Сумма оплат после активации
+}
+
+// CreateTrialTables создает таблицу активаций пробного периода
+func CreateTrialTables() error {
+	db := GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS trial_activations (
+		id SERIAL PRIMARY KEY,
+		telegram_id BIGINT NOT NULL,
+		policy_id VARCHAR(64) NOT NULL,
+		trial_type VARCHAR(20) NOT NULL,
+		source VARCHAR(100) NOT NULL,
+		days INTEGER NOT NULL DEFAULT 0,
+		traffic_gb INTEGER NOT NULL DEFAULT 0,
+		activated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);`
+
+	indexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_trial_activations_telegram_id ON trial_activations(telegram_id);
+	CREATE INDEX IF NOT EXISTS idx_trial_activations_policy_id ON trial_activations(policy_id);`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы trial_activations: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов trial_activations: %v", err)
+	}
+
+	return nil
+}
+
+// TrialPolicies возвращает настроенные политики пробного периода.
+// Без настроек используется пополнение баланса на TRIAL_BALANCE_AMOUNT.
+func TrialPolicies() []TrialPolicy {
+	if len(TRIAL_POLICIES) > 0 {
+		return TRIAL_POLICIES
+	}
+	return []TrialPolicy{{ID: DefaultTrialPolicyID, Type: TrialTypeBalance, BalanceAmount: TRIAL_BALANCE_AMOUNT}}
+}
+
+// Matches проверяет, подходит ли политика для источника пользователя
+func (p TrialPolicy) Matches(source string) bool {
+	if len(p.Sources) == 0 {
+		return true
+	}
+
+	for _, allowed := range p.Sources {
+		if allowed == source {
+			return true
+		}
+		if allowed == TrialSourceCampaignPrefix+"*" && strings.HasPrefix(source, TrialSourceCampaignPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TrialDays возвращает количество дней доступа по политике
+func (p TrialPolicy) TrialDays() int {
+	if p.Type == TrialTypeDays {
+		return p.Days
+	}
+	if PRICE_PER_DAY <= 0 {
+		return 0
+	}
+	return p.BalanceAmount / PRICE_PER_DAY
+}
+
+// Description описывает пробный период для пользователя
+func (p TrialPolicy) Description() string {
+	text := fmt.Sprintf("На ваш баланс будет добавлено %d₽ для ознакомления с сервисом.", p.BalanceAmount)
+	if p.Type == TrialTypeDays {
+		text = fmt.Sprintf("Вы получите %d %s бесплатного доступа.", p.Days, GetDaysWord(p.Days))
+	}
+
+	if p.TrafficGB > 0 {
+		text += fmt.Sprintf("\nЛимит трафика на пробный период: %s.", FormatTrafficLimit(p.TrafficGB))
+	}
+
+	return text
+}
+
+// GetTrialSource определяет источник пользователя: реферальная ссылка, кампания или органика
+func (tm *TrialPeriodManager) GetTrialSource(user *User, referralCode string) string {
+	if referralCode != "" || user.ReferredBy != 0 {
+		return TrialSourceReferral
+	}
+
+	db := GetDatabasePG()
+	if db == nil {
+		return TrialSourceOrganic
+	}
+
+	// Первое касание кампании хранится в users.campaign_id (создается при включенных ссылках кампаний)
+	var campaignID string
+	err := db.QueryRow("SELECT COALESCE(campaign_id, '') FROM users WHERE telegram_id = $1", user.TelegramID).Scan(&campaignID)
+	if err != nil {
+		log.Printf("TRIAL: Кампания пользователя %d не определена: %v", user.TelegramID, err)
+		return TrialSourceOrganic
+	}
+	if campaignID != "" {
+		return TrialSourceCampaignPrefix + campaignID
+	}
+
+	return TrialSourceOrganic
+}
+
+// SelectTrialPolicy выбирает первую политику, подходящую под источник пользователя
+func (tm *TrialPeriodManager) SelectTrialPolicy(user *User, referralCode string) (TrialPolicy, string, bool) {
+	source := tm.GetTrialSource(user, referralCode)
+	for _, policy := range TrialPolicies() {
+		if policy.Matches(source) {
+			return policy, source, true
+		}
+	}
+	return TrialPolicy{}, source, false
+}
+
+// IsChannelMember проверяет подписку пользователя на канал через getChatMember
+func IsChannelMember(bot *tgbotapi.BotAPI, channel string, userID int64) (bool, error) {
+	chat := tgbotapi.ChatConfigWithUser{UserID: userID}
+	if strings.HasPrefix(channel, "@") {
+		chat.SuperGroupUsername = channel
+	} else {
+		chatID, err := strconv.ParseInt(channel, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("неверный канал %s: %v", channel, err)
+		}
+		chat.ChatID = chatID
+	}
+
+	member, err := bot.GetChatMember(tgbotapi.GetChatMemberConfig{ChatConfigWithUser: chat})
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки подписки на канал %s: %v", channel, err)
+	}
+
+	switch member.Status {
+	case "creator", "administrator", "member":
+		return true, nil
+	case "restricted":
+		return member.IsMember, nil
+	default:
+		return false, nil
+	}
+}
+
+// channelURL возвращает ссылку на канал, если он задан через @username
+func channelURL(channel string) string {
+	if strings.HasPrefix(channel, "@") {
+		return "https://t.me/" + strings.TrimPrefix(channel, "@")
+	}
+	return ""
+}
+
+// recordTrialActivation записывает активацию пробного периода для подсчета конверсии
+func recordTrialActivation(telegramID int64, policy TrialPolicy, source string, days int) {
+	db := GetDatabasePG()
+	if db == nil {
+		return
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO trial_activations (telegram_id, policy_id, trial_type, source, days, traffic_gb)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		telegramID, policy.ID, policy.Type, source, days, policy.TrafficGB)
+	if err != nil {
+		log.Printf("TRIAL: Ошибка записи активации пробного периода пользователя %d: %v", telegramID, err)
+	}
+}
+
+// GetTrialPolicyStats возвращает конверсию пробного периода в оплату по каждой политике
+func (tm *TrialPeriodManager) GetTrialPolicyStats() ([]TrialPolicyStats, error) {
+	db := GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	// Оплата - зачисление по платежу (kind = 'credit') после активации пробного периода
+	rows, err := db.Query(`
+		SELECT ta.policy_id, COUNT(*), COUNT(*) FILTER (WHERE p.paid > 0), COALESCE(SUM(p.paid), 0)
+		FROM trial_activations ta
+		LEFT JOIN LATERAL (
+			SELECT SUM(cr.amount) AS paid
+			FROM payment_credits cr
+			WHERE cr.user_id = ta.telegram_id AND cr.kind = 'credit' AND cr.created_at >= ta.activated_at
+		) p ON true
+		GROUP BY ta.policy_id
+		ORDER BY ta.policy_id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения конверсии пробного периода: %v", err)
+	}
+	defer rows.Close()
+
+	var stats []TrialPolicyStats
+	for rows.Next() {
+		var item TrialPolicyStats
+		if err := rows.Scan(&item.PolicyID, &item.Activations, &item.Converted, &item.Revenue); err != nil {
+			return nil, fmt.Errorf("ошибка чтения конверсии пробного периода: %v", err)
+		}
+		stats = append(stats, item)
+	}
+
+	return stats, rows.Err()
+}
+
+// GetTrialPolicyReport формирует отчет по политикам пробного периода и их конверсии
+func (tm *TrialPeriodManager) GetTrialPolicyReport() string {
+	text := "📋 Политики пробного периода:\n"
+	for _, policy := range TrialPolicies() {
+		text += fmt.Sprintf("\n• %s: %s", policy.ID, describeTrialPolicy(policy))
+	}
+
+	stats, err := tm.GetTrialPolicyStats()
+	if err != nil {
+		log.Printf("TRIAL: %v", err)
+		return text + "\n\n📈 Конверсия недоступна"
+	}
+
+	text += "\n\n📈 Конверсия в оплату:"
+	if len(stats) == 0 {
+		return text + "\nАктиваций пока нет"
+	}
+
+	for _, item := range stats {
+		text += fmt.Sprintf("\n• %s: %d активаций → %d оплат (%.1f%%), %.2f₽",
+			item.PolicyID, item.Activations, item.Converted,
+			float64(item.Converted)/float64(item.Activations)*100, item.Revenue)
+	}
+
+	return text
+}
+
+// describeTrialPolicy кратко описывает политику для администратора
+func describeTrialPolicy(policy TrialPolicy) string {
+	text := fmt.Sprintf("%d₽ на баланс", policy.BalanceAmount)
+	if policy.Type == TrialTypeDays {
+		text = fmt.Sprintf("%d дн.", policy.Days)
+	}
+	if policy.TrafficGB > 0 {
+		text += fmt.Sprintf(", %d ГБ", policy.TrafficGB)
+	}
+	if policy.RequiredChannel != "" {
+		text += ", подписка на " + policy.RequiredChannel
+	}
+	if len(policy.Sources) > 0 {
+		text += " [" + strings.Join(policy.Sources, ", ") + "]"
+	}
+	return text
+}
@@ -148,3 +148,11 @@ type UsersStatistics struct {
 	NewThisMonth        int     `json:"new_this_month"`
 	ConversionRate      float64 `json:"conversion_rate"`
 }
+
+// ReceiptItemConfig настройки позиции чека для типа покупки (пустые поля - из общих настроек чеков)
+type ReceiptItemConfig struct {
+	Description    string // Наименование позиции
+	VATCode        int    // Код НДС (0 - из YUKASSA_VAT_CODE)
+	PaymentSubject string // Предмет расчета
+	PaymentMode    string // Способ расчета
+}
@@ -0,0 +1,266 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Методы gRPC API Xray-core (app/proxyman/command и app/stats/command)
+const (
+	xrayAlterInboundMethod = "/xray.app.proxyman.command.HandlerService/AlterInbound"
+	xrayQueryStatsMethod   = "/xray.app.stats.command.StatsService/QueryStats"
+	xraySysStatsMethod     = "/xray.app.stats.command.StatsService/GetSysStats"
+)
+
+// Типы сообщений Xray в TypedMessage
+const (
+	xrayAddUserType    = "xray.app.proxyman.command.AddUserOperation"
+	xrayRemoveUserType = "xray.app.proxyman.command.RemoveUserOperation"
+	xrayVLESSAccount   = "xray.proxy.vless.Account"
+)
+
+// XrayTraffic трафик пользователя по счетчикам StatsService
+type XrayTraffic struct {
+	Uplink   int64
+	Downlink int64
+}
+
+// xrayCodec передает сообщения protobuf, закодированные вручную через protowire.
+// Сгенерированный код Xray не подключается - используется несколько простых сообщений.
+type xrayCodec struct{}
+
+func (xrayCodec) Marshal(v interface{}) ([]byte, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("неподдерживаемый тип сообщения %T", v)
+	}
+	return data, nil
+}
+
+func (xrayCodec) Unmarshal(data []byte, v interface{}) error {
+	out, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("неподдерживаемый тип сообщения %T", v)
+	}
+	*out = append([]byte(nil), data...)
+	return nil
+}
+
+// Name совпадает со стандартным кодеком, чтобы Xray принимал запросы как обычные protobuf
+func (xrayCodec) Name() string {
+	return "proto"
+}
+
+// xrayInvoke выполняет вызов gRPC API Xray по адресу host:port
+func xrayInvoke(address, method string, request []byte) ([]byte, error) {
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к API Xray %s: %v", address, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(XRAY_API_TIMEOUT)*time.Second)
+	defer cancel()
+
+	var response []byte
+	if err := conn.Invoke(ctx, method, request, &response, grpc.ForceCodec(xrayCodec{})); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// appendTypedMessage кодирует xray.common.serial.TypedMessage{type = 1, value = 2}
+func appendTypedMessage(b []byte, field protowire.Number, messageType string, value []byte) []byte {
+	var typed []byte
+	typed = protowire.AppendTag(typed, 1, protowire.BytesType)
+	typed = protowire.AppendString(typed, messageType)
+	typed = protowire.AppendTag(typed, 2, protowire.BytesType)
+	typed = protowire.AppendBytes(typed, value)
+
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, typed)
+}
+
+// appendString кодирует строковое поле
+func appendString(b []byte, field protowire.Number, value string) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+// alterInbound вызывает HandlerService.AlterInbound с операцией над inbound'ом tag
+func alterInbound(address, tag, operationType string, operation []byte) error {
+	var request []byte
+	request = appendString(request, 1, tag)
+	request = appendTypedMessage(request, 2, operationType, operation)
+
+	_, err := xrayInvoke(address, xrayAlterInboundMethod, request)
+	return err
+}
+
+// XrayAddUser добавляет пользователя vless в inbound
+func XrayAddUser(address, tag, email, uuid, flow string) error {
+	// xray.proxy.vless.Account{id = 1, flow = 2, encryption = 3}
+	var account []byte
+	account = appendString(account, 1, uuid)
+	if flow != "" {
+		account = appendString(account, 2, flow)
+	}
+	account = appendString(account, 3, "none")
+
+	// xray.common.protocol.User{level = 1, email = 2, account = 3}
+	var user []byte
+	user = appendString(user, 2, email)
+	user = appendTypedMessage(user, 3, xrayVLESSAccount, account)
+
+	// AddUserOperation{user = 1}
+	var operation []byte
+	operation = protowire.AppendTag(operation, 1, protowire.BytesType)
+	operation = protowire.AppendBytes(operation, user)
+
+	if err := alterInbound(address, tag, xrayAddUserType, operation); err != nil {
+		return fmt.Errorf("ошибка добавления пользователя %s в Xray: %v", email, err)
+	}
+	return nil
+}
+
+// XrayRemoveUser удаляет пользователя из inbound'а
+func XrayRemoveUser(address, tag, email string) error {
+	// RemoveUserOperation{email = 1}
+	operation := appendString(nil, 1, email)
+
+	if err := alterInbound(address, tag, xrayRemoveUserType, operation); err != nil {
+		return fmt.Errorf("ошибка удаления пользователя %s из Xray: %v", email, err)
+	}
+	return nil
+}
+
+// IsXrayUserExists проверяет ошибку добавления уже существующего пользователя
+func IsXrayUserExists(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "already exists")
+}
+
+// IsXrayUserNotFound проверяет ошибку удаления отсутствующего пользователя
+func IsXrayUserNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "not found")
+}
+
+// XrayQueryUserTraffic возвращает трафик всех пользователей по счетчикам
+// user>>>email>>>traffic>>>uplink/downlink. С reset счетчики обнуляются.
+func XrayQueryUserTraffic(address string, reset bool) (map[string]XrayTraffic, error) {
+	// QueryStatsRequest{pattern = 1, reset = 2}
+	request := appendString(nil, 1, "user>>>")
+	if reset {
+		request = protowire.AppendTag(request, 2, protowire.VarintType)
+		request = protowire.AppendVarint(request, 1)
+	}
+
+	response, err := xrayInvoke(address, xrayQueryStatsMethod, request)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения статистики Xray: %v", err)
+	}
+
+	traffic := make(map[string]XrayTraffic)
+	err = rangeFields(response, func(field protowire.Number, value []byte, _ uint64) error {
+		// QueryStatsResponse{repeated Stat stat = 1}, Stat{name = 1, value = 2}
+		if field != 1 {
+			return nil
+		}
+		var name string
+		var counter int64
+		err := rangeFields(value, func(field protowire.Number, value []byte, varint uint64) error {
+			switch field {
+			case 1:
+				name = string(value)
+			case 2:
+				counter = int64(varint)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		parts := strings.Split(name, ">>>")
+		if len(parts) != 4 || parts[0] != "user" || parts[2] != "traffic" {
+			return nil
+		}
+		item := traffic[parts[1]]
+		switch parts[3] {
+		case "uplink":
+			item.Uplink += counter
+		case "downlink":
+			item.Downlink += counter
+		}
+		traffic[parts[1]] = item
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора статистики Xray: %v", err)
+	}
+	return traffic, nil
+}
+
+// XrayUptime возвращает время работы Xray (SysStatsResponse.Uptime = 10)
+func XrayUptime(address string) (time.Duration, error) {
+	response, err := xrayInvoke(address, xraySysStatsMethod, nil)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения состояния Xray: %v", err)
+	}
+
+	var uptime uint64
+	err = rangeFields(response, func(field protowire.Number, _ []byte, varint uint64) error {
+		if field == 10 {
+			uptime = varint
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ошибка разбора состояния Xray: %v", err)
+	}
+	return time.Duration(uptime) * time.Second, nil
+}
+
+// rangeFields перебирает поля сообщения protobuf: для bytes передается value, для varint - число
+func rangeFields(b []byte, fn func(field protowire.Number, value []byte, varint uint64) error) error {
+	for len(b) > 0 {
+		field, wireType, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch wireType {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(field, value, 0); err != nil {
+				return err
+			}
+			b = b[n:]
+		case protowire.VarintType:
+			varint, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(field, nil, varint); err != nil {
+				return err
+			}
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(field, wireType, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
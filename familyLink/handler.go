@@ -0,0 +1,398 @@
+package familyLink
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// FamilyHandler обработчик команд и callback'ов семейного тарифа
+type FamilyHandler struct {
+	service *FamilyService
+	bot     *tgbotapi.BotAPI
+}
+
+// NewFamilyHandler создает новый обработчик семейного тарифа
+func NewFamilyHandler(service *FamilyService, bot *tgbotapi.BotAPI) *FamilyHandler {
+	return &FamilyHandler{
+		service: service,
+		bot:     bot,
+	}
+}
+
+// HandleCallback обрабатывает callback'и семейного тарифа
+func (fh *FamilyHandler) HandleCallback(chatID int64, messageID int, user *common.User, data string) {
+	switch {
+	case data == "family":
+		fh.showFamilyMenu(chatID, messageID, user.TelegramID)
+	case data == "family_add":
+		fh.addSeat(chatID, messageID, user.TelegramID)
+	case strings.HasPrefix(data, "family_seat:"):
+		fh.showSeat(chatID, messageID, user.TelegramID, parseSeatID(data))
+	case strings.HasPrefix(data, "family_invite:"):
+		fh.createInvite(chatID, messageID, user.TelegramID, parseSeatID(data))
+	case strings.HasPrefix(data, "family_unassign:"):
+		fh.unassignSeat(chatID, messageID, user, parseSeatID(data))
+	case strings.HasPrefix(data, "family_resume:"):
+		fh.resumeSeat(chatID, messageID, user.TelegramID, parseSeatID(data))
+	case strings.HasPrefix(data, "family_remove:"):
+		fh.confirmRemoveSeat(chatID, messageID, user.TelegramID, parseSeatID(data))
+	case strings.HasPrefix(data, "family_remove_ok:"):
+		fh.removeSeat(chatID, messageID, user, parseSeatID(data))
+	default:
+		log.Printf("FAMILY_HANDLER: ❌ Неизвестный callback: %s", data)
+	}
+}
+
+// IsFamilyCallback проверяет, является ли callback callback'ом семейного тарифа
+func (fh *FamilyHandler) IsFamilyCallback(data string) bool {
+	return data == "family" || strings.HasPrefix(data, "family_")
+}
+
+// parseSeatID извлекает ID места из callback'а вида family_<действие>:<id>
+func parseSeatID(data string) int64 {
+	seatID, _ := strconv.ParseInt(data[strings.Index(data, ":")+1:], 10, 64)
+	return seatID
+}
+
+// showFamilyMenu показывает места владельца и места, выданные пользователю. messageID = 0 - новым сообщением.
+func (fh *FamilyHandler) showFamilyMenu(chatID int64, messageID int, telegramID int64) {
+	seats, err := fh.service.GetOwnerSeats(telegramID)
+	if err != nil {
+		log.Printf("FAMILY_HANDLER: Ошибка получения мест пользователя %d: %v", telegramID, err)
+		fh.reply(chatID, messageID, "❌ Ошибка получения мест", familyBackKeyboard())
+		return
+	}
+	memberSeats, err := fh.service.GetMemberSeats(telegramID)
+	if err != nil {
+		log.Printf("FAMILY_HANDLER: Ошибка получения выданных мест пользователя %d: %v", telegramID, err)
+	}
+
+	text := "👨‍👩‍👧 Семейный тариф\n\n" +
+		"Каждое место - отдельный конфиг со своей ссылкой подписки. " +
+		"Место можно оставить себе как дополнительное устройство или пригласить на него другого человека.\n\n" +
+		fmt.Sprintf("💸 Стоимость места: %.0f₽ в день, списывается с вашего баланса\n", SeatPrice()) +
+		fmt.Sprintf("👥 Мест: %d из %d\n", len(seats), common.FAMILY_MAX_SEATS)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, seat := range seats {
+		text += fmt.Sprintf("\n%s Место #%d - %s", seatStatusIcon(seat.Status), seat.Position, fh.seatHolder(seat))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("Место #%d", seat.Position), fmt.Sprintf("family_seat:%d", seat.ID))))
+	}
+
+	if len(memberSeats) > 0 {
+		text += "\n\n🎟 Вам выданы места:"
+		for _, seat := range memberSeats {
+			text += fmt.Sprintf("\n%s Место #%d от %s", seatStatusIcon(seat.Status), seat.Position, fh.userName(seat.OwnerID))
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("🎟 Место от %s", fh.userName(seat.OwnerID)), fmt.Sprintf("family_seat:%d", seat.ID))))
+		}
+	}
+
+	if len(seats) < common.FAMILY_MAX_SEATS {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("➕ Добавить место (%.0f₽/день)", SeatPrice()), "family_add")))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔐 VPN", "vpn"),
+		tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
+	))
+
+	fh.reply(chatID, messageID, text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// showSeat показывает место: ссылку подписки и действия владельца
+func (fh *FamilyHandler) showSeat(chatID int64, messageID int, telegramID int64, seatID int64) {
+	seat, err := fh.service.GetSeat(seatID)
+	if err != nil || (seat.OwnerID != telegramID && seat.MemberID != telegramID) {
+		fh.reply(chatID, messageID, "❌ Место не найдено", familyBackKeyboard())
+		return
+	}
+
+	text := fmt.Sprintf("%s Место #%d\n\n", seatStatusIcon(seat.Status), seat.Position)
+	if seat.OwnerID == telegramID {
+		text += fmt.Sprintf("👤 Пользователь: %s\n", fh.seatHolder(seat))
+	} else {
+		text += fmt.Sprintf("👤 Оплачивает: %s\n", fh.userName(seat.OwnerID))
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if seat.Status == SeatStatusActive {
+		text += fmt.Sprintf("📅 Оплачено до: %s\n\n🔗 Ссылка на подписку:\n%s",
+			seat.PaidUntil.Format("02.01.2006 15:04"), seat.SubscriptionURL())
+		if seat.OwnerID == telegramID && seat.MemberID != 0 {
+			text += "\n\n💡 Ссылка выдана участнику - используйте ее только на его устройствах"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL(
+			fmt.Sprintf("📱 Подключить (%s)", common.GetAppName()), common.GetRedirectURL()+seat.SubscriptionURL())))
+	} else {
+		text += "⏸ Место приостановлено: на балансе владельца не хватило средств"
+	}
+
+	if seat.OwnerID == telegramID {
+		switch {
+		case seat.Status == SeatStatusSuspended:
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("▶️ Возобновить (%.0f₽)", SeatPrice()), fmt.Sprintf("family_resume:%d", seat.ID))))
+		case seat.MemberID == 0:
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				"✉️ Пригласить", fmt.Sprintf("family_invite:%d", seat.ID))))
+		}
+		if seat.MemberID != 0 {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				"↩️ Отвязать участника", fmt.Sprintf("family_unassign:%d", seat.ID))))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			"🗑 Удалить место", fmt.Sprintf("family_remove:%d", seat.ID))))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("👨‍👩‍👧 Семья", "family"),
+		tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
+	))
+
+	fh.reply(chatID, messageID, text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// addSeat покупает новое место
+func (fh *FamilyHandler) addSeat(chatID int64, messageID int, telegramID int64) {
+	seat, err := fh.service.AddSeat(telegramID)
+	if fh.replyInsufficient(chatID, messageID, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("FAMILY_HANDLER: Ошибка покупки места пользователем %d: %v", telegramID, err)
+		fh.reply(chatID, messageID, fmt.Sprintf("❌ %v", err), familyBackKeyboard())
+		return
+	}
+
+	fh.showSeat(chatID, messageID, telegramID, seat.ID)
+}
+
+// createInvite создает ссылку-приглашение на место
+func (fh *FamilyHandler) createInvite(chatID int64, messageID int, telegramID int64, seatID int64) {
+	seat, err := fh.service.CreateInvite(telegramID, seatID)
+	if err != nil {
+		fh.reply(chatID, messageID, fmt.Sprintf("❌ %v", err), familyBackKeyboard())
+		return
+	}
+
+	text := fmt.Sprintf("✉️ Приглашение на место #%d\n\n"+
+		"Отправьте ссылку человеку, которого хотите подключить:\n%s\n\n"+
+		"После перехода по ссылке он получит свою ссылку подписки, а оплата места останется на вас.",
+		seat.Position, InviteLink(seat.InviteCode))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ К месту", fmt.Sprintf("family_seat:%d", seat.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("👨‍👩‍👧 Семья", "family"),
+		),
+	)
+	fh.reply(chatID, messageID, text, keyboard)
+}
+
+// unassignSeat освобождает место и сообщает бывшему участнику
+func (fh *FamilyHandler) unassignSeat(chatID int64, messageID int, owner *common.User, seatID int64) {
+	seat, memberID, err := fh.service.UnassignSeat(owner.TelegramID, seatID)
+	if err != nil {
+		log.Printf("FAMILY_HANDLER: Ошибка освобождения места %d: %v", seatID, err)
+		fh.reply(chatID, messageID, fmt.Sprintf("❌ %v", err), familyBackKeyboard())
+		return
+	}
+
+	if memberID != 0 {
+		fh.notify(memberID, fmt.Sprintf("ℹ️ %s отключил(а) вас от семейного тарифа. Ссылка подписки места #%d больше не работает.",
+			userDisplayName(owner), seat.Position))
+	}
+
+	fh.showSeat(chatID, messageID, owner.TelegramID, seat.ID)
+}
+
+// resumeSeat возобновляет приостановленное место
+func (fh *FamilyHandler) resumeSeat(chatID int64, messageID int, telegramID int64, seatID int64) {
+	seat, err := fh.service.ResumeSeat(telegramID, seatID)
+	if fh.replyInsufficient(chatID, messageID, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("FAMILY_HANDLER: Ошибка возобновления места %d: %v", seatID, err)
+		fh.reply(chatID, messageID, fmt.Sprintf("❌ %v", err), familyBackKeyboard())
+		return
+	}
+
+	if seat.MemberID != 0 {
+		fh.notify(seat.MemberID, fmt.Sprintf("✅ Место #%d семейного тарифа снова активно.", seat.Position))
+	}
+
+	fh.showSeat(chatID, messageID, telegramID, seat.ID)
+}
+
+// confirmRemoveSeat запрашивает подтверждение удаления места
+func (fh *FamilyHandler) confirmRemoveSeat(chatID int64, messageID int, telegramID int64, seatID int64) {
+	seat, err := fh.service.GetSeat(seatID)
+	if err != nil || seat.OwnerID != telegramID {
+		fh.reply(chatID, messageID, "❌ Место не найдено", familyBackKeyboard())
+		return
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Удалить", fmt.Sprintf("family_remove_ok:%d", seat.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", fmt.Sprintf("family_seat:%d", seat.ID)),
+		),
+	)
+	text := fmt.Sprintf("🗑 Удалить место #%d?\n\nКонфиг места будет удален из панели, оплаченный день не возвращается.", seat.Position)
+	fh.reply(chatID, messageID, text, keyboard)
+}
+
+// removeSeat удаляет место и сообщает участнику
+func (fh *FamilyHandler) removeSeat(chatID int64, messageID int, owner *common.User, seatID int64) {
+	seat, err := fh.service.RemoveSeat(owner.TelegramID, seatID)
+	if err != nil {
+		log.Printf("FAMILY_HANDLER: Ошибка удаления места %d: %v", seatID, err)
+		fh.reply(chatID, messageID, fmt.Sprintf("❌ %v", err), familyBackKeyboard())
+		return
+	}
+
+	if seat.MemberID != 0 {
+		fh.notify(seat.MemberID, fmt.Sprintf("ℹ️ %s удалил(а) место #%d семейного тарифа. Ссылка подписки больше не работает.",
+			userDisplayName(owner), seat.Position))
+	}
+
+	fh.showFamilyMenu(chatID, messageID, owner.TelegramID)
+}
+
+// SendInviteResult сообщает участнику результат перехода по приглашению
+func (fh *FamilyHandler) SendInviteResult(chatID int64, seat *Seat, err error) {
+	if err != nil {
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main")),
+		)
+		fh.reply(chatID, 0, fmt.Sprintf("❌ Приглашение не принято: %v", err), keyboard)
+		return
+	}
+
+	text := fmt.Sprintf("👨‍👩‍👧 Вы подключены к семейному тарифу!\n\n"+
+		"👤 Оплачивает: %s\n\n"+
+		"Нажмите кнопку ниже, чтобы получить ссылку подписки.", fh.userName(seat.OwnerID))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🔗 Мое место", fmt.Sprintf("family_seat:%d", seat.ID))),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main")),
+	)
+	fh.reply(chatID, 0, text, keyboard)
+}
+
+// NotifyOwnerJoined сообщает владельцу, что участник занял место
+func (fh *FamilyHandler) NotifyOwnerJoined(seat *Seat, member *common.User) {
+	fh.notify(seat.OwnerID, fmt.Sprintf("🎉 %s занял(а) место #%d вашего семейного тарифа.", userDisplayName(member), seat.Position))
+}
+
+// NotifySeatSuspended сообщает владельцу и участнику о приостановке места
+func (fh *FamilyHandler) NotifySeatSuspended(seat *Seat) {
+	fh.notify(seat.OwnerID, fmt.Sprintf("⚠️ Место #%d семейного тарифа приостановлено: на балансе не хватает %.0f₽ на следующий день.\n\n"+
+		"Пополните баланс и возобновите место в меню VPN → Семья.", seat.Position, SeatPrice()))
+	if seat.MemberID != 0 {
+		fh.notify(seat.MemberID, fmt.Sprintf("⚠️ Место #%d семейного тарифа приостановлено: владелец не продлил оплату.", seat.Position))
+	}
+}
+
+// replyInsufficient показывает экран пополнения, если на балансе не хватило средств
+func (fh *FamilyHandler) replyInsufficient(chatID int64, messageID int, err error) bool {
+	var insufficient *InsufficientBalanceError
+	if !errors.As(err, &insufficient) {
+		return false
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💳 Пополнить", "topup"),
+			tgbotapi.NewInlineKeyboardButtonData("👨‍👩‍👧 Семья", "family"),
+		),
+	)
+	text := fmt.Sprintf("❌ Недостаточно средств!\n\n"+
+		"💰 Ваш баланс: %.2f₽\n"+
+		"💸 Нужно: %.0f₽\n"+
+		"💎 Не хватает: %.2f₽\n\n"+
+		"Пополните баланс любым способом и вернитесь к семейному тарифу",
+		insufficient.Balance, insufficient.Cost, insufficient.Cost-insufficient.Balance)
+	fh.reply(chatID, messageID, text, keyboard)
+	return true
+}
+
+// seatHolder описывает, кем занято место
+func (fh *FamilyHandler) seatHolder(seat *Seat) string {
+	switch {
+	case seat.MemberID != 0:
+		return fh.userName(seat.MemberID)
+	case seat.InviteCode != "":
+		return "ждет принятия приглашения"
+	default:
+		return "ваше устройство"
+	}
+}
+
+// userName возвращает имя пользователя по Telegram ID
+func (fh *FamilyHandler) userName(telegramID int64) string {
+	user, err := common.GetUserByTelegramID(telegramID)
+	if err != nil || user == nil {
+		return fmt.Sprintf("%d", telegramID)
+	}
+	return userDisplayName(user)
+}
+
+// reply редактирует сообщение или отправляет новое, если messageID = 0
+func (fh *FamilyHandler) reply(chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+	var msg tgbotapi.Chattable
+	if messageID != 0 {
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+		editMsg.ReplyMarkup = &keyboard
+		msg = editMsg
+	} else {
+		newMsg := tgbotapi.NewMessage(chatID, text)
+		newMsg.ReplyMarkup = keyboard
+		msg = newMsg
+	}
+
+	if _, err := fh.bot.Send(msg); err != nil {
+		log.Printf("FAMILY_HANDLER: Ошибка отправки сообщения: %v", err)
+	}
+}
+
+// notify отправляет уведомление пользователю
+func (fh *FamilyHandler) notify(telegramID int64, text string) {
+	if _, err := fh.bot.Send(tgbotapi.NewMessage(telegramID, text)); err != nil {
+		log.Printf("FAMILY_HANDLER: Ошибка уведомления пользователя %d: %v", telegramID, err)
+	}
+}
+
+// familyBackKeyboard клавиатура возврата в меню семейного тарифа
+func familyBackKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👨‍👩‍👧 Семья", "family"),
+			tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
+		),
+	)
+}
+
+// userDisplayName возвращает имя пользователя для уведомлений
+func userDisplayName(user *common.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return user.FirstName
+}
+
+// seatStatusIcon возвращает значок статуса места
+func seatStatusIcon(status string) string {
+	if status == SeatStatusSuspended {
+		return "⏸"
+	}
+	return "✅"
+}
@@ -0,0 +1,114 @@
+package familyLink
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// FamilyManager глобальный менеджер семейных тарифов
+type FamilyManager struct {
+	service *FamilyService
+	handler *FamilyHandler
+}
+
+// GlobalFamilyManager глобальный экземпляр менеджера семейных тарифов
+var GlobalFamilyManager *FamilyManager
+
+// InitFamilySystem инициализирует семейные тарифы
+func InitFamilySystem(db *sql.DB, bot *tgbotapi.BotAPI) error {
+	log.Printf("FAMILY_MANAGER: Инициализация семейных тарифов")
+
+	if !common.FAMILY_PLANS_ENABLED {
+		log.Printf("FAMILY_MANAGER: Семейные тарифы отключены в конфигурации")
+		return nil
+	}
+
+	if err := createFamilyTables(db); err != nil {
+		return err
+	}
+
+	service := NewFamilyService(db)
+
+	GlobalFamilyManager = &FamilyManager{
+		service: service,
+		handler: NewFamilyHandler(service, bot),
+	}
+
+	log.Printf("FAMILY_MANAGER: Семейные тарифы успешно инициализированы")
+	return nil
+}
+
+// IsFamilyStart проверяет, является ли команда /start переходом по приглашению на место
+func (fm *FamilyManager) IsFamilyStart(text string) bool {
+	return fm.ExtractInviteCode(text) != ""
+}
+
+// ExtractInviteCode извлекает код приглашения из команды /start seat_<code>
+func (fm *FamilyManager) ExtractInviteCode(text string) string {
+	parts := strings.Fields(text)
+	if len(parts) >= 2 && parts[0] == "/start" && strings.HasPrefix(parts[1], SeatStartPrefix) {
+		return strings.ToLower(strings.TrimPrefix(parts[1], SeatStartPrefix))
+	}
+	return ""
+}
+
+// HandleStartCommand закрепляет место за пользователем по приглашению и сообщает владельцу
+func (fm *FamilyManager) HandleStartCommand(chatID int64, user *common.User, text string) {
+	code := fm.ExtractInviteCode(text)
+	if code == "" {
+		return
+	}
+
+	seat, err := fm.service.AcceptInvite(code, user.TelegramID)
+	if err != nil {
+		log.Printf("FAMILY_MANAGER: Приглашение %s не принято пользователем %d: %v", code, user.TelegramID, err)
+	} else {
+		fm.handler.NotifyOwnerJoined(seat, user)
+	}
+
+	fm.handler.SendInviteResult(chatID, seat, err)
+}
+
+// ProcessSeatBilling списывает оплату за места и приостанавливает места без средств
+func (fm *FamilyManager) ProcessSeatBilling() {
+	charged, suspended, err := fm.service.ChargeDueSeats()
+	if err != nil {
+		log.Printf("FAMILY_MANAGER: Ошибка оплаты мест: %v", err)
+		return
+	}
+
+	for _, seat := range suspended {
+		fm.handler.NotifySeatSuspended(seat)
+	}
+
+	if len(charged) > 0 || len(suspended) > 0 {
+		log.Printf("FAMILY_MANAGER: Оплата мест завершена. Продлено: %d, приостановлено: %d", len(charged), len(suspended))
+	}
+}
+
+// IsFamilyCommand проверяет, является ли команда командой семейного тарифа
+func (fm *FamilyManager) IsFamilyCommand(command string) bool {
+	return command == "family"
+}
+
+// HandleCommand обрабатывает команду /family - показывает меню мест новым сообщением
+func (fm *FamilyManager) HandleCommand(chatID int64, user *common.User, command string) {
+	if command == "family" {
+		fm.handler.showFamilyMenu(chatID, 0, user.TelegramID)
+	}
+}
+
+// IsFamilyCallback проверяет, является ли callback callback'ом семейного тарифа
+func (fm *FamilyManager) IsFamilyCallback(data string) bool {
+	return fm.handler.IsFamilyCallback(data)
+}
+
+// HandleCallback обрабатывает callback'и семейного тарифа
+func (fm *FamilyManager) HandleCallback(chatID int64, messageID int, user *common.User, data string) {
+	fm.handler.HandleCallback(chatID, messageID, user, data)
+}
@@ -0,0 +1,74 @@
+package familyLink
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"bot/common"
+)
+
+// seatExecer общий интерфейс sql.DB и sql.Tx для сохранения мест
+type seatExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// applySeatClients приводит клиентов мест в панелях серверов владельцев к состоянию в базе:
+// активные места включены до paid_until, приостановленные отключены, удаленные убраны из панели.
+// Токен подписки, выданный панелью, сохраняется через db.
+func applySeatClients(db seatExecer, seats []*Seat) error {
+	// Места группируются по серверу владельца: 3x-ui обновляет их одним запросом
+	servers := make(map[string]*common.Server)
+	groups := make(map[string][]*Seat)
+	for _, seat := range seats {
+		server := common.GetUserServer(seat.OwnerID)
+		servers[server.ID] = server
+		groups[server.ID] = append(groups[server.ID], seat)
+	}
+
+	var failed []string
+	for serverID, group := range groups {
+		if err := applyServerSeatClients(db, servers[serverID], group); err != nil {
+			log.Printf("FAMILY: Ошибка обновления клиентов мест на сервере %s: %v", serverID, err)
+			failed = append(failed, fmt.Sprintf("%s: %v", serverID, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("ошибка обновления клиентов мест в панели: %s", strings.Join(failed, "; "))
+	}
+
+	log.Printf("FAMILY: Клиенты мест обновлены в панели (%d мест)", len(seats))
+	return nil
+}
+
+// applyServerSeatClients применяет места владельцев одного сервера через его панель
+func applyServerSeatClients(db seatExecer, server *common.Server, seats []*Seat) error {
+	clients := make([]*common.BackendClient, len(seats))
+	for i, seat := range seats {
+		clients[i] = &common.BackendClient{
+			Email:      seat.Email,
+			UUID:       seat.ClientID,
+			SubID:      seat.SubID,
+			ExpiryTime: seat.PaidUntil.UnixMilli(),
+			Enabled:    seat.Status == SeatStatusActive,
+			Removed:    seat.Status == SeatStatusRemoved,
+		}
+	}
+
+	if err := common.NewBackend(server).ApplyClients(clients); err != nil {
+		return err
+	}
+
+	// Marzban выдает свой токен подписки - ссылка места должна вести на него
+	for i, seat := range seats {
+		if clients[i].SubID == seat.SubID || seat.Status == SeatStatusRemoved {
+			continue
+		}
+		if _, err := db.Exec("UPDATE family_seats SET sub_id = $1 WHERE id = $2", clients[i].SubID, seat.ID); err != nil {
+			return fmt.Errorf("ошибка сохранения подписки места #%d: %v", seat.Position, err)
+		}
+		seat.SubID = clients[i].SubID
+	}
+	return nil
+}
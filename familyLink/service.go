@@ -0,0 +1,550 @@
+package familyLink
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"bot/common"
+)
+
+// SeatStartPrefix префикс параметра /start для приглашений на место
+const SeatStartPrefix = "seat_"
+
+// seatColumns колонки таблицы family_seats для выборки
+const seatColumns = `id, owner_telegram_id, position, client_id, sub_id, email,
+	COALESCE(member_telegram_id, 0), COALESCE(invite_code, ''), status, paid_until, created_at`
+
+// FamilyService сервис семейных тарифов
+type FamilyService struct {
+	db *sql.DB
+}
+
+// NewFamilyService создает новый сервис семейных тарифов
+func NewFamilyService(db *sql.DB) *FamilyService {
+	return &FamilyService{db: db}
+}
+
+// createFamilyTables создает таблицу мест семейного тарифа
+func createFamilyTables(db *sql.DB) error {
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS family_seats (
+		id SERIAL PRIMARY KEY,
+		owner_telegram_id BIGINT NOT NULL,
+		position INTEGER NOT NULL,
+		client_id VARCHAR(64) NOT NULL,
+		sub_id VARCHAR(32) NOT NULL,
+		email VARCHAR(64) NOT NULL,
+		member_telegram_id BIGINT,
+		invite_code VARCHAR(32) UNIQUE,
+		status VARCHAR(20) NOT NULL DEFAULT 'active',
+		paid_until TIMESTAMP WITH TIME ZONE NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		removed_at TIMESTAMP WITH TIME ZONE
+	);`
+
+	// Номер места и email клиента в панели уникальны среди неудаленных мест
+	indexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_family_seats_owner ON family_seats(owner_telegram_id);
+	CREATE INDEX IF NOT EXISTS idx_family_seats_member ON family_seats(member_telegram_id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_family_seats_owner_position ON family_seats(owner_telegram_id, position) WHERE status <> 'removed';
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_family_seats_email ON family_seats(email) WHERE status <> 'removed';`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы family_seats: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов family_seats: %v", err)
+	}
+
+	return nil
+}
+
+// InviteLink возвращает ссылку на бота для приглашения на место
+func InviteLink(code string) string {
+	return common.FAMILY_INVITE_BASE_URL + code
+}
+
+// SeatPrice возвращает стоимость места в день
+func SeatPrice() float64 {
+	return float64(common.FAMILY_SEAT_PRICE_PER_DAY)
+}
+
+// SubscriptionURL возвращает ссылку на подписку места в панели сервера владельца
+func (s *Seat) SubscriptionURL() string {
+	return common.GetUserBackend(s.OwnerID).SubscriptionURL(&common.User{TelegramID: s.OwnerID, SubID: s.SubID})
+}
+
+// seatEmail формирует email клиента места в панели.
+// Email не начинается с Telegram ID, поэтому не путается с основным конфигом пользователя.
+func seatEmail(ownerID int64, position int) string {
+	return fmt.Sprintf("seat%d-%d", ownerID, position)
+}
+
+// generateInviteCode генерирует случайный код приглашения
+func generateInviteCode() (string, error) {
+	bytes := make([]byte, 6) // 12 символов в hex
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("ошибка генерации случайных байт: %v", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// lockOwnerBalance блокирует строку владельца и возвращает его баланс
+func lockOwnerBalance(tx *sql.Tx, ownerID int64) (float64, error) {
+	var balance float64
+	if err := tx.QueryRow("SELECT balance FROM users WHERE telegram_id = $1 FOR UPDATE", ownerID).Scan(&balance); err != nil {
+		return 0, fmt.Errorf("ошибка получения баланса: %v", err)
+	}
+	return balance, nil
+}
+
+// chargeOwner списывает стоимость дня места с баланса владельца
+func chargeOwner(tx *sql.Tx, ownerID int64, amount float64) error {
+	if _, err := tx.Exec("UPDATE users SET balance = balance - $1, updated_at = NOW() WHERE telegram_id = $2", amount, ownerID); err != nil {
+		return fmt.Errorf("ошибка списания баланса: %v", err)
+	}
+	return nil
+}
+
+// AddSeat покупает новое место: списывает первый день с баланса владельца и создает клиента в панели
+func (fs *FamilyService) AddSeat(ownerID int64) (*Seat, error) {
+	cost := SeatPrice()
+
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	balance, err := lockOwnerBalance(tx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query("SELECT position FROM family_seats WHERE owner_telegram_id = $1 AND status <> $2", ownerID, SeatStatusRemoved)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения мест: %v", err)
+	}
+	taken := make(map[int]bool)
+	for rows.Next() {
+		var position int
+		if err := rows.Scan(&position); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения места: %v", err)
+		}
+		taken[position] = true
+	}
+	rows.Close()
+
+	if len(taken) >= common.FAMILY_MAX_SEATS {
+		return nil, fmt.Errorf("достигнут лимит мест: %d", common.FAMILY_MAX_SEATS)
+	}
+	if balance < cost {
+		return nil, &InsufficientBalanceError{Balance: balance, Cost: cost}
+	}
+
+	// Занимаем первый свободный номер, чтобы после удаления места номера не росли бесконечно
+	position := 1
+	for taken[position] {
+		position++
+	}
+
+	if err := chargeOwner(tx, ownerID, cost); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO family_seats (owner_telegram_id, position, client_id, sub_id, email, paid_until)
+		VALUES ($1, $2, $3, $4, $5, NOW() + INTERVAL '1 day')
+		RETURNING %s`, seatColumns)
+	seat, err := scanSeat(tx.QueryRow(query, ownerID, position, common.GenerateClientID(), common.GenerateSubID(), seatEmail(ownerID, position)))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания места: %v", err)
+	}
+
+	// Клиент создается до фиксации транзакции: при ошибке панели деньги не списываются
+	if err := applySeatClients(tx, []*Seat{seat}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения места: %v", err)
+	}
+
+	common.ForceBalanceRecalculation(ownerID)
+
+	log.Printf("FAMILY: ✅ Пользователь %d купил место #%d (%s) за %.2f₽", ownerID, seat.Position, seat.Email, cost)
+	return seat, nil
+}
+
+// GetSeat возвращает место по ID
+func (fs *FamilyService) GetSeat(seatID int64) (*Seat, error) {
+	query := fmt.Sprintf("SELECT %s FROM family_seats WHERE id = $1 AND status <> $2", seatColumns)
+	seat, err := scanSeat(fs.db.QueryRow(query, seatID, SeatStatusRemoved))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("место не найдено")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения места: %v", err)
+	}
+	return seat, nil
+}
+
+// GetOwnerSeats возвращает места владельца
+func (fs *FamilyService) GetOwnerSeats(ownerID int64) ([]*Seat, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM family_seats
+		WHERE owner_telegram_id = $1 AND status <> $2
+		ORDER BY position`, seatColumns)
+	return fs.querySeats(query, ownerID, SeatStatusRemoved)
+}
+
+// GetMemberSeats возвращает места, выданные пользователю другими владельцами
+func (fs *FamilyService) GetMemberSeats(memberID int64) ([]*Seat, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM family_seats
+		WHERE member_telegram_id = $1 AND status <> $2
+		ORDER BY owner_telegram_id, position`, seatColumns)
+	return fs.querySeats(query, memberID, SeatStatusRemoved)
+}
+
+// CreateInvite создает код приглашения на свободное место владельца
+func (fs *FamilyService) CreateInvite(ownerID, seatID int64) (*Seat, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := generateInviteCode()
+		if err != nil {
+			return nil, err
+		}
+
+		query := fmt.Sprintf(`
+			UPDATE family_seats SET invite_code = $1
+			WHERE id = $2 AND owner_telegram_id = $3 AND status <> $4 AND member_telegram_id IS NULL
+			RETURNING %s`, seatColumns)
+		seat, err := scanSeat(fs.db.QueryRow(query, code, seatID, ownerID, SeatStatusRemoved))
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("место не найдено или уже занято")
+		}
+		if err != nil && strings.Contains(err.Error(), "unique") {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка создания приглашения: %v", err)
+		}
+
+		log.Printf("FAMILY: Пользователь %d создал приглашение %s на место #%d", ownerID, code, seat.Position)
+		return seat, nil
+	}
+
+	return nil, fmt.Errorf("не удалось сгенерировать уникальный код приглашения")
+}
+
+// AcceptInvite закрепляет место за пользователем, открывшим приглашение
+func (fs *FamilyService) AcceptInvite(code string, memberID int64) (*Seat, error) {
+	code = strings.ToLower(code)
+
+	query := fmt.Sprintf(`
+		UPDATE family_seats SET member_telegram_id = $1, invite_code = NULL
+		WHERE invite_code = $2 AND status <> $3 AND member_telegram_id IS NULL AND owner_telegram_id <> $1
+		RETURNING %s`, seatColumns)
+	seat, err := scanSeat(fs.db.QueryRow(query, memberID, code, SeatStatusRemoved))
+	if err == sql.ErrNoRows {
+		var ownerID int64
+		if err := fs.db.QueryRow("SELECT owner_telegram_id FROM family_seats WHERE invite_code = $1", code).Scan(&ownerID); err == nil && ownerID == memberID {
+			return nil, fmt.Errorf("это ваше место - отправьте ссылку тому, кого хотите пригласить")
+		}
+		return nil, fmt.Errorf("приглашение не найдено или уже использовано")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка принятия приглашения: %v", err)
+	}
+
+	log.Printf("FAMILY: ✅ Пользователь %d занял место #%d владельца %d", memberID, seat.Position, seat.OwnerID)
+	return seat, nil
+}
+
+// UnassignSeat освобождает место. Ключ клиента и ссылка подписки меняются,
+// чтобы бывший участник потерял доступ.
+func (fs *FamilyService) UnassignSeat(ownerID, seatID int64) (*Seat, int64, error) {
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var memberID int64
+	err = tx.QueryRow(`
+		SELECT COALESCE(member_telegram_id, 0) FROM family_seats
+		WHERE id = $1 AND owner_telegram_id = $2 AND status <> $3
+		FOR UPDATE`, seatID, ownerID, SeatStatusRemoved).Scan(&memberID)
+	if err == sql.ErrNoRows {
+		return nil, 0, fmt.Errorf("место не найдено")
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка получения места: %v", err)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE family_seats SET member_telegram_id = NULL, invite_code = NULL, client_id = $1, sub_id = $2
+		WHERE id = $3
+		RETURNING %s`, seatColumns)
+	seat, err := scanSeat(tx.QueryRow(query, common.GenerateClientID(), common.GenerateSubID(), seatID))
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка освобождения места: %v", err)
+	}
+
+	if err := applySeatClients(tx, []*Seat{seat}); err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, fmt.Errorf("ошибка сохранения места: %v", err)
+	}
+
+	log.Printf("FAMILY: Пользователь %d освободил место #%d (участник %d)", ownerID, seat.Position, memberID)
+	return seat, memberID, nil
+}
+
+// RemoveSeat удаляет место и клиента в панели. Оплаченный день не возвращается.
+func (fs *FamilyService) RemoveSeat(ownerID, seatID int64) (*Seat, error) {
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		UPDATE family_seats SET status = $1, invite_code = NULL, removed_at = NOW()
+		WHERE id = $2 AND owner_telegram_id = $3 AND status <> $1
+		RETURNING %s`, seatColumns)
+	seat, err := scanSeat(tx.QueryRow(query, SeatStatusRemoved, seatID, ownerID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("место не найдено")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка удаления места: %v", err)
+	}
+
+	if err := applySeatClients(tx, []*Seat{seat}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения места: %v", err)
+	}
+
+	log.Printf("FAMILY: Пользователь %d удалил место #%d (%s)", ownerID, seat.Position, seat.Email)
+	return seat, nil
+}
+
+// ResumeSeat возобновляет приостановленное место, списывая день с баланса владельца
+func (fs *FamilyService) ResumeSeat(ownerID, seatID int64) (*Seat, error) {
+	cost := SeatPrice()
+
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	balance, err := lockOwnerBalance(tx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if balance < cost {
+		return nil, &InsufficientBalanceError{Balance: balance, Cost: cost}
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE family_seats SET status = $1, paid_until = NOW() + INTERVAL '1 day'
+		WHERE id = $2 AND owner_telegram_id = $3 AND status = $4
+		RETURNING %s`, seatColumns)
+	seat, err := scanSeat(tx.QueryRow(query, SeatStatusActive, seatID, ownerID, SeatStatusSuspended))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("место не найдено или уже активно")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка возобновления места: %v", err)
+	}
+
+	if err := chargeOwner(tx, ownerID, cost); err != nil {
+		return nil, err
+	}
+
+	if err := applySeatClients(tx, []*Seat{seat}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения места: %v", err)
+	}
+
+	common.ForceBalanceRecalculation(ownerID)
+
+	log.Printf("FAMILY: ✅ Пользователь %d возобновил место #%d за %.2f₽", ownerID, seat.Position, cost)
+	return seat, nil
+}
+
+// ChargeDueSeats продлевает места, оплаченный день которых заканчивается в ближайший час.
+// Если баланса владельца не хватает, место приостанавливается. Состояние клиентов в панели
+// затем приводится к базе для всех мест.
+func (fs *FamilyService) ChargeDueSeats() (charged []*Seat, suspended []*Seat, err error) {
+	rows, err := fs.db.Query(`
+		SELECT id FROM family_seats
+		WHERE status = $1 AND paid_until <= NOW() + INTERVAL '1 hour'
+		ORDER BY owner_telegram_id, position`, SeatStatusActive)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка получения мест к оплате: %v", err)
+	}
+
+	var seatIDs []int64
+	for rows.Next() {
+		var seatID int64
+		if err := rows.Scan(&seatID); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("ошибка чтения места к оплате: %v", err)
+		}
+		seatIDs = append(seatIDs, seatID)
+	}
+	rows.Close()
+
+	for _, seatID := range seatIDs {
+		seat, paid, err := fs.chargeSeat(seatID)
+		if err != nil {
+			log.Printf("FAMILY: Ошибка оплаты места %d: %v", seatID, err)
+			continue
+		}
+		if seat == nil {
+			continue
+		}
+		if paid {
+			charged = append(charged, seat)
+		} else {
+			suspended = append(suspended, seat)
+		}
+	}
+
+	if err := fs.SyncPanelClients(); err != nil {
+		log.Printf("FAMILY: Ошибка синхронизации мест с панелью: %v", err)
+	}
+
+	return charged, suspended, nil
+}
+
+// chargeSeat списывает день места с баланса владельца или приостанавливает место.
+// Возвращает nil, если место уже оплачено или изменено параллельно.
+func (fs *FamilyService) chargeSeat(seatID int64) (*Seat, bool, error) {
+	cost := SeatPrice()
+
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var ownerID int64
+	err = tx.QueryRow(`
+		SELECT owner_telegram_id FROM family_seats
+		WHERE id = $1 AND status = $2 AND paid_until <= NOW() + INTERVAL '1 hour'
+		FOR UPDATE`, seatID, SeatStatusActive).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("ошибка получения места: %v", err)
+	}
+
+	balance, err := lockOwnerBalance(tx, ownerID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	paid := balance >= cost
+	var seat *Seat
+	if paid {
+		if err := chargeOwner(tx, ownerID, cost); err != nil {
+			return nil, false, err
+		}
+		query := fmt.Sprintf(`
+			UPDATE family_seats SET paid_until = GREATEST(paid_until, NOW()) + INTERVAL '1 day'
+			WHERE id = $1
+			RETURNING %s`, seatColumns)
+		seat, err = scanSeat(tx.QueryRow(query, seatID))
+	} else {
+		query := fmt.Sprintf(`
+			UPDATE family_seats SET status = $1
+			WHERE id = $2
+			RETURNING %s`, seatColumns)
+		seat, err = scanSeat(tx.QueryRow(query, SeatStatusSuspended, seatID))
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("ошибка обновления места: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("ошибка сохранения оплаты места: %v", err)
+	}
+
+	if paid {
+		common.ForceBalanceRecalculation(ownerID)
+		log.Printf("FAMILY: Списано %.2f₽ с пользователя %d за место #%d, оплачено до %s",
+			cost, ownerID, seat.Position, seat.PaidUntil.Format("02.01.2006 15:04"))
+	} else {
+		log.Printf("FAMILY: Место #%d пользователя %d приостановлено (баланс %.2f₽)", seat.Position, ownerID, balance)
+	}
+
+	return seat, paid, nil
+}
+
+// SyncPanelClients приводит клиентов всех мест в панели к состоянию в базе
+func (fs *FamilyService) SyncPanelClients() error {
+	query := fmt.Sprintf("SELECT %s FROM family_seats WHERE status <> $1", seatColumns)
+	seats, err := fs.querySeats(query, SeatStatusRemoved)
+	if err != nil {
+		return err
+	}
+	if len(seats) == 0 {
+		return nil
+	}
+	return applySeatClients(fs.db, seats)
+}
+
+// querySeats выполняет выборку мест
+func (fs *FamilyService) querySeats(query string, args ...interface{}) ([]*Seat, error) {
+	rows, err := fs.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения мест: %v", err)
+	}
+	defer rows.Close()
+
+	var seats []*Seat
+	for rows.Next() {
+		seat, err := scanSeat(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения места: %v", err)
+		}
+		seats = append(seats, seat)
+	}
+
+	return seats, rows.Err()
+}
+
+// seatScanner общий интерфейс sql.Row и sql.Rows
+type seatScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSeat читает место из строки результата
+func scanSeat(row seatScanner) (*Seat, error) {
+	var seat Seat
+	err := row.Scan(&seat.ID, &seat.OwnerID, &seat.Position, &seat.ClientID, &seat.SubID, &seat.Email,
+		&seat.MemberID, &seat.InviteCode, &seat.Status, &seat.PaidUntil, &seat.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &seat, nil
+}
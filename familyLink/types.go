@@ -0,0 +1,35 @@
+package familyLink
+
+import "time"
+
+// Статусы места
+const (
+	SeatStatusActive    = "active"    // Оплачено, конфиг работает
+	SeatStatusSuspended = "suspended" // Не хватило баланса владельца, конфиг отключен
+	SeatStatusRemoved   = "removed"   // Удалено владельцем
+)
+
+// Seat место в семейном тарифе - отдельный клиент в панели со своей ссылкой подписки
+type Seat struct {
+	ID         int64     `json:"id"`
+	OwnerID    int64     `json:"owner_id"` // Владелец, с баланса которого оплачивается место
+	Position   int       `json:"position"` // Номер места у владельца (1..FAMILY_MAX_SEATS)
+	ClientID   string    `json:"client_id"`
+	SubID      string    `json:"sub_id"`
+	Email      string    `json:"email"`
+	MemberID   int64     `json:"member_id"`   // 0 - дополнительное устройство владельца
+	InviteCode string    `json:"invite_code"` // Код приглашения, пока место не занято
+	Status     string    `json:"status"`
+	PaidUntil  time.Time `json:"paid_until"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// InsufficientBalanceError не хватает баланса владельца для оплаты места
+type InsufficientBalanceError struct {
+	Balance float64
+	Cost    float64
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	return "недостаточно средств на балансе"
+}
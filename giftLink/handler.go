@@ -0,0 +1,371 @@
+package giftLink
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	"bot/common"
+	"bot/payments"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// giftHelp справка по команде /gift
+const giftHelp = "🎁 <b>Подарки</b>\n\n" +
+	"<code>/gift</code> - мои подарки\n" +
+	"<code>/gift дни сообщение</code> - купить подарок с сообщением\n" +
+	"<code>/gift msg код сообщение</code> - изменить сообщение к подарку\n\n" +
+	"<b>Пример:</b>\n<code>/gift 30 С днем рождения!</code>"
+
+// GiftHandler обработчик команд и callback'ов подарков
+type GiftHandler struct {
+	service *GiftService
+	bot     *tgbotapi.BotAPI
+}
+
+// NewGiftHandler создает новый обработчик подарков
+func NewGiftHandler(service *GiftService, bot *tgbotapi.BotAPI) *GiftHandler {
+	return &GiftHandler{
+		service: service,
+		bot:     bot,
+	}
+}
+
+// HandleGiftCommand обрабатывает команду /gift
+func (gh *GiftHandler) HandleGiftCommand(chatID int64, user *common.User, args []string) {
+	switch {
+	case len(args) == 0:
+		gh.sendGiftList(chatID, user.TelegramID)
+	case strings.ToLower(args[0]) == "msg":
+		if len(args) < 3 {
+			gh.sendHTML(chatID, giftHelp)
+			return
+		}
+		if err := gh.service.SetGiftMessage(user.TelegramID, args[1], strings.Join(args[2:], " ")); err != nil {
+			gh.sendHTML(chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		gh.sendHTML(chatID, "✅ Сообщение к подарку сохранено")
+	default:
+		days, err := strconv.Atoi(args[0])
+		if err != nil {
+			gh.sendHTML(chatID, giftHelp)
+			return
+		}
+		gh.purchaseGift(chatID, 0, user, days, strings.Join(args[1:], " "))
+	}
+}
+
+// HandleCallback обрабатывает callback'и подарков
+func (gh *GiftHandler) HandleCallback(chatID int64, messageID int, user *common.User, data string) {
+	switch {
+	case data == "gift":
+		gh.editGiftMenu(chatID, messageID)
+	case data == "gift_list":
+		gh.sendGiftList(chatID, user.TelegramID)
+	case strings.HasPrefix(data, "gift_plan:"):
+		days, _ := strconv.Atoi(strings.TrimPrefix(data, "gift_plan:"))
+		gh.editGiftConfirm(chatID, messageID, days)
+	case strings.HasPrefix(data, "gift_buy:"):
+		days, _ := strconv.Atoi(strings.TrimPrefix(data, "gift_buy:"))
+		gh.purchaseGift(chatID, messageID, user, days, "")
+	case strings.HasPrefix(data, "gift_pay:"):
+		days, _ := strconv.Atoi(strings.TrimPrefix(data, "gift_pay:"))
+		gh.payGift(chatID, messageID, user, days)
+	default:
+		log.Printf("GIFT_HANDLER: ❌ Неизвестный callback: %s", data)
+	}
+}
+
+// IsGiftCallback проверяет, является ли callback callback'ом подарков
+func (gh *GiftHandler) IsGiftCallback(data string) bool {
+	return data == "gift" || data == "gift_list" ||
+		strings.HasPrefix(data, "gift_plan:") || strings.HasPrefix(data, "gift_buy:") || strings.HasPrefix(data, "gift_pay:")
+}
+
+// editGiftMenu показывает выбор периода подарка
+func (gh *GiftHandler) editGiftMenu(chatID int64, messageID int) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, days := range common.GIFT_PLANS {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("%d %s (%.0f₽)", days, common.GetDaysWord(days), GiftCost(days)), fmt.Sprintf("gift_plan:%d", days))))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("📋 Мои подарки", "gift_list")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main")),
+	)
+
+	text := "🎁 Подарить VPN\n\n" +
+		"Оплатите подписку для друга или близкого - вы получите ссылку, по которой он активирует подарок.\n\n" +
+		fmt.Sprintf("⏳ Неактивированный за %d дн. подарок возвращается на ваш баланс.\n\n", common.GIFT_EXPIRY_DAYS) +
+		"Выберите период:"
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	editMsg.ReplyMarkup = &keyboard
+	if _, err := gh.bot.Send(editMsg); err != nil {
+		log.Printf("GIFT_HANDLER: Ошибка отправки меню подарков: %v", err)
+	}
+}
+
+// editGiftConfirm показывает подтверждение покупки подарка
+func (gh *GiftHandler) editGiftConfirm(chatID int64, messageID int, days int) {
+	if !isGiftPlan(days) {
+		gh.editGiftMenu(chatID, messageID)
+		return
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ Оплатить с баланса", fmt.Sprintf("gift_buy:%d", days))),
+	}
+	if isProviderPaymentAvailable() {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("💳 Оплатить картой", fmt.Sprintf("gift_pay:%d", days))))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "gift")))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	text := fmt.Sprintf("🎁 Подтверждение подарка\n\n"+
+		"📅 Период: %d %s\n"+
+		"💰 Стоимость: %.0f₽\n\n"+
+		"💬 Чтобы добавить сообщение, купите подарок командой:\n/gift %d ваше сообщение",
+		days, common.GetDaysWord(days), GiftCost(days), days)
+
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	editMsg.ReplyMarkup = &keyboard
+	if _, err := gh.bot.Send(editMsg); err != nil {
+		log.Printf("GIFT_HANDLER: Ошибка отправки подтверждения подарка: %v", err)
+	}
+}
+
+// purchaseGift покупает подарок и отправляет ссылку. messageID = 0 - ответ новым сообщением.
+func (gh *GiftHandler) purchaseGift(chatID int64, messageID int, user *common.User, days int, message string) {
+	gift, err := gh.service.PurchaseGift(user.TelegramID, days, message)
+
+	var insufficient *InsufficientBalanceError
+	if errors.As(err, &insufficient) {
+		var rows [][]tgbotapi.InlineKeyboardButton
+		if isProviderPaymentAvailable() {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("💳 Оплатить картой", fmt.Sprintf("gift_pay:%d", days))))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💳 Пополнить", "topup"),
+			tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
+		))
+		text := fmt.Sprintf("❌ Недостаточно средств!\n\n"+
+			"💰 Ваш баланс: %.2f₽\n"+
+			"💸 Нужно: %.0f₽\n"+
+			"💎 Не хватает: %.2f₽\n\n"+
+			"Оплатите подарок картой или пополните баланс любым способом и вернитесь к подарку",
+			insufficient.Balance, insufficient.Cost, insufficient.Cost-insufficient.Balance)
+		gh.reply(chatID, messageID, text, "", tgbotapi.NewInlineKeyboardMarkup(rows...))
+		return
+	}
+	if err != nil {
+		log.Printf("GIFT_HANDLER: Ошибка покупки подарка пользователем %d: %v", user.TelegramID, err)
+		gh.reply(chatID, messageID, fmt.Sprintf("❌ %v", err), "", giftBackKeyboard())
+		return
+	}
+
+	gh.reply(chatID, messageID, giftPurchasedText(gift), "HTML", giftBackKeyboard())
+}
+
+// payGift создает платеж на стоимость подарка - подарок покупается после зачисления платежа
+func (gh *GiftHandler) payGift(chatID int64, messageID int, user *common.User, days int) {
+	if !isGiftPlan(days) {
+		gh.editGiftMenu(chatID, messageID)
+		return
+	}
+	if !isProviderPaymentAvailable() {
+		gh.reply(chatID, messageID, "❌ Платежи временно отключены\n\nОплатите подарок с баланса или обратитесь в поддержку.", "", giftBackKeyboard())
+		return
+	}
+
+	description := fmt.Sprintf("Подарок VPN на %d %s", days, common.GetDaysWord(days))
+	err := payments.GlobalPaymentManager.ProcessPurchaseRequest(user.TelegramID, GiftCost(days), chatID, description,
+		func(paymentID string) error {
+			return gh.service.CreateGiftOrder(paymentID, user.TelegramID, days, "")
+		})
+	if err != nil {
+		log.Printf("GIFT_HANDLER: Ошибка создания платежа за подарок пользователем %d: %v", user.TelegramID, err)
+		gh.reply(chatID, messageID, fmt.Sprintf("❌ Ошибка создания платежа: %v\n\nПопробуйте еще раз или обратитесь в поддержку.", err), "", giftBackKeyboard())
+		return
+	}
+
+	gh.reply(chatID, messageID, "🎁 Ссылка на подарок придет сюда сразу после оплаты.", "", giftBackKeyboard())
+}
+
+// SendGiftOrderResult сообщает дарителю результат покупки подарка, оплаченного через платежную систему
+func (gh *GiftHandler) SendGiftOrderResult(gifterID int64, gift *Gift, err error) {
+	if err != nil {
+		gh.reply(gifterID, 0, "❌ Не удалось оформить подарок после оплаты.\n\n"+
+			"💰 Оплата зачислена на ваш баланс - подарок можно купить с баланса в меню «🎁 Подарить».", "", giftBackKeyboard())
+		return
+	}
+	gh.reply(gifterID, 0, giftPurchasedText(gift), "HTML", giftBackKeyboard())
+}
+
+// giftPurchasedText описывает оплаченный подарок со ссылкой для получателя
+func giftPurchasedText(gift *Gift) string {
+	text := fmt.Sprintf("🎁 <b>Подарок на %d %s оплачен!</b>\n\n"+
+		"Отправьте получателю ссылку:\n<code>%s</code>\n\n"+
+		"⏳ Активировать до: %s\n",
+		gift.Days, common.GetDaysWord(gift.Days), GiftLink(gift.Code), gift.ExpiresAt.Format("02.01.2006"))
+	if gift.Message != "" {
+		text += fmt.Sprintf("💬 Сообщение: %s\n", html.EscapeString(gift.Message))
+	}
+	text += fmt.Sprintf("\nИзменить сообщение: <code>/gift msg %s текст</code>", gift.Code)
+	return text
+}
+
+// isProviderPaymentAvailable проверяет, можно ли оплатить подарок через платежную систему
+func isProviderPaymentAvailable() bool {
+	return payments.GlobalPaymentManager != nil && payments.GlobalPaymentManager.IsAnyProviderEnabled()
+}
+
+// sendGiftList отправляет список подарков пользователя
+func (gh *GiftHandler) sendGiftList(chatID int64, telegramID int64) {
+	gifts, err := gh.service.GetUserGifts(telegramID, 10)
+	if err != nil {
+		log.Printf("GIFT_HANDLER: Ошибка получения подарков пользователя %d: %v", telegramID, err)
+		gh.bot.Send(tgbotapi.NewMessage(chatID, "❌ Ошибка получения подарков"))
+		return
+	}
+
+	if len(gifts) == 0 {
+		gh.sendHTML(chatID, "🎁 Вы еще не дарили подписку.\n\n"+giftHelp)
+		return
+	}
+
+	text := "🎁 <b>Мои подарки</b>\n"
+	for _, gift := range gifts {
+		text += fmt.Sprintf("\n%s %d %s - %s", giftStatusIcon(gift.Status), gift.Days, common.GetDaysWord(gift.Days), giftStatusText(gift))
+		if gift.Status == GiftStatusActive {
+			text += fmt.Sprintf("\n<code>%s</code>", GiftLink(gift.Code))
+		}
+	}
+
+	gh.sendHTML(chatID, text)
+}
+
+// NotifyGifterRedeemed сообщает дарителю об активации подарка
+func (gh *GiftHandler) NotifyGifterRedeemed(gift *Gift, recipient *common.User) {
+	text := fmt.Sprintf("🎉 Ваш подарок на %d %s активирован пользователем %s!",
+		gift.Days, common.GetDaysWord(gift.Days), userDisplayName(recipient))
+	if _, err := gh.bot.Send(tgbotapi.NewMessage(gift.GifterID, text)); err != nil {
+		log.Printf("GIFT_HANDLER: Ошибка уведомления дарителя %d: %v", gift.GifterID, err)
+	}
+}
+
+// NotifyGifterRefunded сообщает дарителю о возврате денег за неактивированный подарок
+func (gh *GiftHandler) NotifyGifterRefunded(gift *Gift) {
+	text := fmt.Sprintf("↩️ Подарок на %d %s не был активирован вовремя.\n\n💰 На ваш баланс возвращено %.2f₽",
+		gift.Days, common.GetDaysWord(gift.Days), gift.Amount)
+	if _, err := gh.bot.Send(tgbotapi.NewMessage(gift.GifterID, text)); err != nil {
+		log.Printf("GIFT_HANDLER: Ошибка уведомления о возврате дарителю %d: %v", gift.GifterID, err)
+	}
+}
+
+// SendRedeemResult сообщает получателю результат активации подарка
+func (gh *GiftHandler) SendRedeemResult(chatID int64, gift *Gift, err error) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main")),
+	)
+
+	if err != nil {
+		gh.reply(chatID, 0, fmt.Sprintf("❌ Подарок не активирован: %v", err), "", keyboard)
+		return
+	}
+
+	text := fmt.Sprintf("🎁 <b>Вам подарили VPN на %d %s!</b>\n", gift.Days, common.GetDaysWord(gift.Days))
+	if gifter, err := common.GetUserByTelegramID(gift.GifterID); err == nil && gifter != nil {
+		text += fmt.Sprintf("👤 От: %s\n", html.EscapeString(userDisplayName(gifter)))
+	}
+	if gift.Message != "" {
+		text += fmt.Sprintf("\n💬 %s\n", html.EscapeString(gift.Message))
+	}
+	if common.TARIFF_MODE_ENABLED {
+		text += "\n✅ Подписка продлена, подключение доступно в главном меню."
+	} else {
+		text += fmt.Sprintf("\n✅ На баланс зачислено %.0f₽ - это %d %s доступа.", gift.Amount, gift.Days, common.GetDaysWord(gift.Days))
+	}
+
+	gh.reply(chatID, 0, text, "HTML", keyboard)
+}
+
+// reply редактирует сообщение или отправляет новое, если messageID = 0
+func (gh *GiftHandler) reply(chatID int64, messageID int, text, parseMode string, keyboard tgbotapi.InlineKeyboardMarkup) {
+	var msg tgbotapi.Chattable
+	if messageID != 0 {
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+		editMsg.ParseMode = parseMode
+		editMsg.ReplyMarkup = &keyboard
+		msg = editMsg
+	} else {
+		newMsg := tgbotapi.NewMessage(chatID, text)
+		newMsg.ParseMode = parseMode
+		newMsg.ReplyMarkup = keyboard
+		msg = newMsg
+	}
+
+	if _, err := gh.bot.Send(msg); err != nil {
+		log.Printf("GIFT_HANDLER: Ошибка отправки сообщения: %v", err)
+	}
+}
+
+// sendHTML отправляет сообщение с HTML-разметкой
+func (gh *GiftHandler) sendHTML(chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	if _, err := gh.bot.Send(msg); err != nil {
+		log.Printf("GIFT_HANDLER: Ошибка отправки сообщения: %v", err)
+	}
+}
+
+// giftBackKeyboard клавиатура возврата в меню подарков
+func giftBackKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🎁 Подарки", "gift"),
+			tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
+		),
+	)
+}
+
+// recipientName возвращает имя пользователя для уведомлений
+func userDisplayName(user *common.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return user.FirstName
+}
+
+// giftStatusIcon возвращает значок статуса подарка
+func giftStatusIcon(status string) string {
+	switch status {
+	case GiftStatusRedeemed:
+		return "✅"
+	case GiftStatusRefunded:
+		return "↩️"
+	default:
+		return "⏳"
+	}
+}
+
+// giftStatusText описывает статус подарка
+func giftStatusText(gift *Gift) string {
+	switch gift.Status {
+	case GiftStatusRedeemed:
+		if gift.RedeemedAt != nil {
+			return "активирован " + gift.RedeemedAt.Format("02.01.2006")
+		}
+		return "активирован"
+	case GiftStatusRefunded:
+		return fmt.Sprintf("возвращено %.2f₽", gift.Amount)
+	default:
+		return "ждет активации до " + gift.ExpiresAt.Format("02.01.2006")
+	}
+}
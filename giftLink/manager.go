@@ -0,0 +1,126 @@
+package giftLink
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"bot/common"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// GiftManager глобальный менеджер подарочных подписок
+type GiftManager struct {
+	service *GiftService
+	handler *GiftHandler
+}
+
+// GlobalGiftManager глобальный экземпляр менеджера подарков
+var GlobalGiftManager *GiftManager
+
+// InitGiftSystem инициализирует подарочные подписки
+func InitGiftSystem(db *sql.DB, bot *tgbotapi.BotAPI) error {
+	log.Printf("GIFT_MANAGER: Инициализация подарочных подписок")
+
+	if !common.GIFTS_ENABLED {
+		log.Printf("GIFT_MANAGER: Подарки отключены в конфигурации")
+		return nil
+	}
+
+	if err := createGiftTables(db); err != nil {
+		return err
+	}
+
+	service := NewGiftService(db)
+
+	GlobalGiftManager = &GiftManager{
+		service: service,
+		handler: NewGiftHandler(service, bot),
+	}
+
+	// Подарок, оплаченный через платежную систему, покупается после зачисления платежа
+	paymentCommon.RegisterCreditHook(GlobalGiftManager.handlePaymentCredited)
+
+	log.Printf("GIFT_MANAGER: Подарочные подписки успешно инициализированы")
+	return nil
+}
+
+// IsGiftStart проверяет, является ли команда /start переходом по подарочной ссылке
+func (gm *GiftManager) IsGiftStart(text string) bool {
+	return gm.ExtractGiftCode(text) != ""
+}
+
+// ExtractGiftCode извлекает код подарка из команды /start gift_<code>
+func (gm *GiftManager) ExtractGiftCode(text string) string {
+	parts := strings.Fields(text)
+	if len(parts) >= 2 && parts[0] == "/start" && strings.HasPrefix(parts[1], GiftStartPrefix) {
+		return strings.ToLower(strings.TrimPrefix(parts[1], GiftStartPrefix))
+	}
+	return ""
+}
+
+// HandleStartCommand активирует подарок по ссылке и сообщает результат получателю и дарителю
+func (gm *GiftManager) HandleStartCommand(chatID int64, user *common.User, text string) {
+	code := gm.ExtractGiftCode(text)
+	if code == "" {
+		return
+	}
+
+	gift, err := gm.service.RedeemGift(code, user.TelegramID)
+	if err != nil {
+		log.Printf("GIFT_MANAGER: Подарок %s не активирован пользователем %d: %v", code, user.TelegramID, err)
+	} else {
+		gm.handler.NotifyGifterRedeemed(gift, user)
+	}
+
+	gm.handler.SendRedeemResult(chatID, gift, err)
+}
+
+// ProcessExpiredGifts возвращает дарителям деньги за подарки с истекшим сроком активации
+func (gm *GiftManager) ProcessExpiredGifts() {
+	gifts, err := gm.service.RefundExpiredGifts()
+	if err != nil {
+		log.Printf("GIFT_MANAGER: Ошибка возврата за истекшие подарки: %v", err)
+		return
+	}
+
+	for _, gift := range gifts {
+		gm.handler.NotifyGifterRefunded(gift)
+	}
+}
+
+// handlePaymentCredited завершает заказ подарка, связанный с зачисленным платежом
+func (gm *GiftManager) handlePaymentCredited(paymentInfo *paymentCommon.PaymentInfo) {
+	gift, err := gm.service.CompleteGiftOrder(paymentInfo.ID)
+	if err != nil {
+		log.Printf("GIFT_MANAGER: %v", err)
+	}
+	if gift == nil && err == nil {
+		return
+	}
+	gm.handler.SendGiftOrderResult(paymentInfo.UserID, gift, err)
+}
+
+// IsGiftCommand проверяет, является ли команда командой подарков
+func (gm *GiftManager) IsGiftCommand(command string) bool {
+	return command == "gift"
+}
+
+// HandleCommand обрабатывает команды подарков
+func (gm *GiftManager) HandleCommand(chatID int64, user *common.User, command string, args []string) {
+	if command == "gift" {
+		gm.handler.HandleGiftCommand(chatID, user, args)
+	}
+}
+
+// IsGiftCallback проверяет, является ли callback callback'ом подарков
+func (gm *GiftManager) IsGiftCallback(data string) bool {
+	return gm.handler.IsGiftCallback(data)
+}
+
+// HandleCallback обрабатывает callback'и подарков
+func (gm *GiftManager) HandleCallback(chatID int64, messageID int, user *common.User, data string) {
+	gm.handler.HandleCallback(chatID, messageID, user, data)
+}
@@ -0,0 +1,493 @@
+package giftLink
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"bot/common"
+)
+
+// GiftStartPrefix префикс параметра /start для подарочных ссылок
+const GiftStartPrefix = "gift_"
+
+// giftMessageMaxLength максимальная длина сообщения к подарку
+const giftMessageMaxLength = 200
+
+// giftColumns колонки таблицы gifts для выборки
+const giftColumns = `code, gifter_telegram_id, COALESCE(recipient_telegram_id, 0), days, amount,
+	message, status, created_at, expires_at, redeemed_at`
+
+// GiftService сервис подарочных подписок
+type GiftService struct {
+	db *sql.DB
+}
+
+// NewGiftService создает новый сервис подарочных подписок
+func NewGiftService(db *sql.DB) *GiftService {
+	return &GiftService{db: db}
+}
+
+// createGiftTables создает таблицу подарков
+func createGiftTables(db *sql.DB) error {
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS gifts (
+		code VARCHAR(32) PRIMARY KEY,
+		gifter_telegram_id BIGINT NOT NULL,
+		recipient_telegram_id BIGINT,
+		days INTEGER NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		status VARCHAR(20) NOT NULL DEFAULT 'active',
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		redeemed_at TIMESTAMP WITH TIME ZONE,
+		refunded_at TIMESTAMP WITH TIME ZONE
+	);`
+
+	indexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_gifts_gifter ON gifts(gifter_telegram_id);
+	CREATE INDEX IF NOT EXISTS idx_gifts_active_expires ON gifts(expires_at) WHERE status = 'active';`
+
+	// Заказы подарков, оплачиваемых через платежную систему: подарок покупается после зачисления платежа
+	ordersSQL := `
+	CREATE TABLE IF NOT EXISTS gift_orders (
+		payment_id VARCHAR(255) PRIMARY KEY,
+		gifter_telegram_id BIGINT NOT NULL,
+		days INTEGER NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		gift_code VARCHAR(32),
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы gifts: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов gifts: %v", err)
+	}
+
+	if _, err := db.Exec(ordersSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы gift_orders: %v", err)
+	}
+
+	return nil
+}
+
+// GiftLink возвращает ссылку на бота для активации подарка
+func GiftLink(code string) string {
+	return common.GIFT_LINK_BASE_URL + code
+}
+
+// GiftCost возвращает стоимость подарка на указанное количество дней
+func GiftCost(days int) float64 {
+	return float64(days * common.PRICE_PER_DAY)
+}
+
+// isGiftPlan проверяет, есть ли период среди доступных для подарка
+func isGiftPlan(days int) bool {
+	for _, plan := range common.GIFT_PLANS {
+		if plan == days {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeGiftMessage проверяет сообщение к подарку
+func normalizeGiftMessage(message string) (string, error) {
+	message = strings.TrimSpace(message)
+	if len([]rune(message)) > giftMessageMaxLength {
+		return "", fmt.Errorf("сообщение к подарку не должно быть длиннее %d символов", giftMessageMaxLength)
+	}
+	return message, nil
+}
+
+// generateGiftCode генерирует случайный код подарка
+func generateGiftCode() (string, error) {
+	bytes := make([]byte, 6) // 12 символов в hex
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("ошибка генерации случайных байт: %v", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// validateGiftOrder проверяет период и сообщение подарка
+func validateGiftOrder(days int, message string) (string, error) {
+	if !isGiftPlan(days) {
+		return "", fmt.Errorf("период %d дн. недоступен для подарка", days)
+	}
+	return normalizeGiftMessage(message)
+}
+
+// PurchaseGift оплачивает подарок с баланса дарителя и создает код активации
+func (gs *GiftService) PurchaseGift(gifterID int64, days int, message string) (*Gift, error) {
+	message, err := validateGiftOrder(days, message)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := gs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	gift, err := purchaseGiftTx(tx, gifterID, days, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения подарка: %v", err)
+	}
+
+	common.ForceBalanceRecalculation(gifterID)
+
+	log.Printf("GIFT: ✅ Пользователь %d купил подарок %s на %d дн. за %.2f₽", gifterID, gift.Code, days, gift.Amount)
+	return gift, nil
+}
+
+// purchaseGiftTx списывает стоимость подарка с баланса дарителя и создает подарок в транзакции
+func purchaseGiftTx(tx *sql.Tx, gifterID int64, days int, message string) (*Gift, error) {
+	cost := GiftCost(days)
+
+	var balance float64
+	if err := tx.QueryRow("SELECT balance FROM users WHERE telegram_id = $1 FOR UPDATE", gifterID).Scan(&balance); err != nil {
+		return nil, fmt.Errorf("ошибка получения баланса: %v", err)
+	}
+	if balance < cost {
+		return nil, &InsufficientBalanceError{Balance: balance, Cost: cost}
+	}
+
+	if _, err := tx.Exec("UPDATE users SET balance = balance - $1, updated_at = NOW() WHERE telegram_id = $2", cost, gifterID); err != nil {
+		return nil, fmt.Errorf("ошибка списания баланса: %v", err)
+	}
+
+	var gift *Gift
+	for attempt := 0; attempt < 5 && gift == nil; attempt++ {
+		code, err := generateGiftCode()
+		if err != nil {
+			return nil, err
+		}
+
+		query := fmt.Sprintf(`
+			INSERT INTO gifts (code, gifter_telegram_id, days, amount, message, expires_at)
+			VALUES ($1, $2, $3, $4, $5, NOW() + make_interval(days => $6))
+			ON CONFLICT (code) DO NOTHING
+			RETURNING %s`, giftColumns)
+		gift, err = scanGift(tx.QueryRow(query, code, gifterID, days, cost, message, common.GIFT_EXPIRY_DAYS))
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("ошибка создания подарка: %v", err)
+		}
+	}
+	if gift == nil {
+		return nil, fmt.Errorf("не удалось сгенерировать уникальный код подарка")
+	}
+
+	return gift, nil
+}
+
+// CreateGiftOrder привязывает заказ подарка к созданному платежу - подарок будет куплен после его зачисления
+func (gs *GiftService) CreateGiftOrder(paymentID string, gifterID int64, days int, message string) error {
+	message, err := validateGiftOrder(days, message)
+	if err != nil {
+		return err
+	}
+
+	_, err = gs.db.Exec(`
+		INSERT INTO gift_orders (payment_id, gifter_telegram_id, days, message)
+		VALUES ($1, $2, $3, $4)`, paymentID, gifterID, days, message)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения заказа подарка: %v", err)
+	}
+	return nil
+}
+
+// CompleteGiftOrder покупает подарок по зачисленному платежу: оплата уже на балансе дарителя
+// и списывается с него. Возвращает nil без ошибки, если платеж не связан с заказом подарка.
+// Если подарок купить не удалось, заказ отмечается неудачным и деньги остаются на балансе.
+func (gs *GiftService) CompleteGiftOrder(paymentID string) (*Gift, error) {
+	tx, err := gs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var gifterID int64
+	var days int
+	var message string
+	err = tx.QueryRow(`
+		SELECT gifter_telegram_id, days, message FROM gift_orders
+		WHERE payment_id = $1 AND status = $2
+		FOR UPDATE`, paymentID, GiftOrderPending).Scan(&gifterID, &days, &message)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения заказа подарка: %v", err)
+	}
+
+	gift, err := purchaseGiftTx(tx, gifterID, days, message)
+	if err == nil {
+		_, err = tx.Exec("UPDATE gift_orders SET status = $1, gift_code = $2 WHERE payment_id = $3",
+			GiftOrderCompleted, gift.Code, paymentID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		tx.Rollback()
+		if _, markErr := gs.db.Exec("UPDATE gift_orders SET status = $1 WHERE payment_id = $2 AND status = $3",
+			GiftOrderFailed, paymentID, GiftOrderPending); markErr != nil {
+			log.Printf("GIFT: Ошибка отметки заказа подарка по платежу %s: %v", paymentID, markErr)
+		}
+		return nil, fmt.Errorf("ошибка покупки подарка по платежу %s: %v", paymentID, err)
+	}
+
+	common.ForceBalanceRecalculation(gifterID)
+
+	log.Printf("GIFT: ✅ Пользователь %d оплатил подарок %s на %d дн. платежом %s", gifterID, gift.Code, days, paymentID)
+	return gift, nil
+}
+
+// SetGiftMessage меняет сообщение к еще не активированному подарку
+func (gs *GiftService) SetGiftMessage(gifterID int64, code, message string) error {
+	message, err := normalizeGiftMessage(message)
+	if err != nil {
+		return err
+	}
+
+	result, err := gs.db.Exec(`
+		UPDATE gifts SET message = $1
+		WHERE code = $2 AND gifter_telegram_id = $3 AND status = $4`,
+		message, strings.ToLower(code), gifterID, GiftStatusActive)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения сообщения: %v", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("подарок %s не найден или уже активирован", code)
+	}
+
+	return nil
+}
+
+// GetGift возвращает подарок по коду
+func (gs *GiftService) GetGift(code string) (*Gift, error) {
+	query := fmt.Sprintf("SELECT %s FROM gifts WHERE code = $1", giftColumns)
+	gift, err := scanGift(gs.db.QueryRow(query, strings.ToLower(code)))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("подарок не найден")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения подарка: %v", err)
+	}
+	return gift, nil
+}
+
+// RedeemGift активирует подарок: получателю добавляются дни подписки
+func (gs *GiftService) RedeemGift(code string, recipientID int64) (*Gift, error) {
+	code = strings.ToLower(code)
+
+	tx, err := gs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		UPDATE gifts SET status = $1, recipient_telegram_id = $2, redeemed_at = NOW()
+		WHERE code = $3 AND status = $4 AND expires_at > NOW() AND gifter_telegram_id <> $2
+		RETURNING %s`, giftColumns)
+	gift, err := scanGift(tx.QueryRow(query, GiftStatusRedeemed, recipientID, code, GiftStatusActive))
+	if err == sql.ErrNoRows {
+		return nil, gs.redeemError(code, recipientID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка активации подарка: %v", err)
+	}
+
+	// При автосписании на баланс получателя зачисляется стоимость подарка
+	if !common.TARIFF_MODE_ENABLED {
+		balanceQuery := "UPDATE users SET balance = balance + $1, updated_at = NOW() WHERE telegram_id = $2"
+		if _, err := tx.Exec(balanceQuery, gift.Amount, recipientID); err != nil {
+			return nil, fmt.Errorf("ошибка пополнения баланса: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения активации подарка: %v", err)
+	}
+
+	if common.TARIFF_MODE_ENABLED {
+		if err := gs.grantGiftDays(gift, recipientID); err != nil {
+			return nil, err
+		}
+	} else {
+		common.ForceBalanceRecalculation(recipientID)
+	}
+
+	log.Printf("GIFT: ✅ Подарок %s от %d активирован пользователем %d (%d дн.)", gift.Code, gift.GifterID, recipientID, gift.Days)
+	return gift, nil
+}
+
+// redeemError объясняет, почему подарок нельзя активировать
+func (gs *GiftService) redeemError(code string, recipientID int64) error {
+	gift, err := gs.GetGift(code)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case gift.GifterID == recipientID:
+		return fmt.Errorf("нельзя активировать свой подарок - отправьте ссылку получателю")
+	case gift.Status == GiftStatusRedeemed:
+		return fmt.Errorf("подарок уже активирован")
+	default:
+		return fmt.Errorf("срок активации подарка истек")
+	}
+}
+
+// grantGiftDays продлевает подписку получателя в панели после сохранения активации подарка.
+// Если продлить не удалось, активация отменяется и подарок можно активировать повторно.
+func (gs *GiftService) grantGiftDays(gift *Gift, recipientID int64) error {
+	user, err := common.GetUserByTelegramID(recipientID)
+	if err == nil && user == nil {
+		err = fmt.Errorf("пользователь не найден")
+	}
+	if err == nil {
+		if err = common.GetUserBackendForNewClient(user.TelegramID).Extend(user, gift.Days); err != nil {
+			err = fmt.Errorf("ошибка продления подписки: %v", err)
+		}
+	}
+	if err != nil {
+		if revertErr := gs.revertGiftRedemption(gift.Code, recipientID); revertErr != nil {
+			log.Printf("GIFT: Ошибка отмены активации подарка %s пользователем %d: %v", gift.Code, recipientID, revertErr)
+		}
+		return err
+	}
+
+	// Панель уже продлена - ошибку сохранения пользователя исправит синхронизация с панелью
+	if err := common.UpdateUser(user); err != nil {
+		log.Printf("GIFT: Ошибка обновления пользователя %d после активации подарка %s: %v", recipientID, gift.Code, err)
+	}
+
+	return nil
+}
+
+// revertGiftRedemption возвращает подарок, дни по которому не удалось выдать, в статус ожидания активации
+func (gs *GiftService) revertGiftRedemption(code string, recipientID int64) error {
+	_, err := gs.db.Exec(`
+		UPDATE gifts SET status = $1, recipient_telegram_id = NULL, redeemed_at = NULL
+		WHERE code = $2 AND status = $3 AND recipient_telegram_id = $4`,
+		GiftStatusActive, code, GiftStatusRedeemed, recipientID)
+	if err != nil {
+		return fmt.Errorf("ошибка отмены активации подарка: %v", err)
+	}
+	return nil
+}
+
+// GetUserGifts возвращает последние подарки, купленные пользователем
+func (gs *GiftService) GetUserGifts(gifterID int64, limit int) ([]*Gift, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM gifts
+		WHERE gifter_telegram_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, giftColumns)
+	rows, err := gs.db.Query(query, gifterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения подарков: %v", err)
+	}
+	defer rows.Close()
+
+	var gifts []*Gift
+	for rows.Next() {
+		gift, err := scanGift(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения подарка: %v", err)
+		}
+		gifts = append(gifts, gift)
+	}
+
+	return gifts, rows.Err()
+}
+
+// RefundExpiredGifts возвращает на баланс дарителей деньги за подарки, не активированные до истечения срока
+func (gs *GiftService) RefundExpiredGifts() ([]*Gift, error) {
+	tx, err := gs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		UPDATE gifts SET status = $1, refunded_at = NOW()
+		WHERE status = $2 AND expires_at <= NOW()
+		RETURNING %s`, giftColumns)
+	rows, err := tx.Query(query, GiftStatusRefunded, GiftStatusActive)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения истекших подарков: %v", err)
+	}
+
+	var gifts []*Gift
+	for rows.Next() {
+		gift, err := scanGift(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения истекшего подарка: %v", err)
+		}
+		gifts = append(gifts, gift)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения истекших подарков: %v", err)
+	}
+
+	for _, gift := range gifts {
+		balanceQuery := "UPDATE users SET balance = balance + $1, updated_at = NOW() WHERE telegram_id = $2"
+		if _, err := tx.Exec(balanceQuery, gift.Amount, gift.GifterID); err != nil {
+			return nil, fmt.Errorf("ошибка возврата за подарок %s: %v", gift.Code, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения возвратов за подарки: %v", err)
+	}
+
+	for _, gift := range gifts {
+		common.ForceBalanceRecalculation(gift.GifterID)
+		log.Printf("GIFT: Подарок %s не активирован до %s, пользователю %d возвращено %.2f₽",
+			gift.Code, gift.ExpiresAt.Format("02.01.2006"), gift.GifterID, gift.Amount)
+	}
+
+	return gifts, nil
+}
+
+// giftScanner общий интерфейс sql.Row и sql.Rows
+type giftScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanGift читает подарок из строки результата
+func scanGift(row giftScanner) (*Gift, error) {
+	var gift Gift
+	var redeemedAt sql.NullTime
+
+	err := row.Scan(&gift.Code, &gift.GifterID, &gift.RecipientID, &gift.Days, &gift.Amount,
+		&gift.Message, &gift.Status, &gift.CreatedAt, &gift.ExpiresAt, &redeemedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if redeemedAt.Valid {
+		gift.RedeemedAt = &redeemedAt.Time
+	}
+
+	return &gift, nil
+}
@@ -0,0 +1,41 @@
+package giftLink
+
+import "time"
+
+// Статусы подарка
+const (
+	GiftStatusActive   = "active"   // Оплачен и ждет активации
+	GiftStatusRedeemed = "redeemed" // Активирован получателем
+	GiftStatusRefunded = "refunded" // Не активирован вовремя, деньги возвращены дарителю
+)
+
+// Статусы заказа подарка, оплачиваемого через платежную систему
+const (
+	GiftOrderPending   = "pending"   // Платеж создан и ждет зачисления
+	GiftOrderCompleted = "completed" // Платеж зачислен, подарок куплен
+	GiftOrderFailed    = "failed"    // Подарок купить не удалось, оплата осталась на балансе
+)
+
+// Gift представляет подарочную подписку со ссылкой t.me/bot?start=gift_<code>
+type Gift struct {
+	Code        string     `json:"code"`
+	GifterID    int64      `json:"gifter_id"`
+	RecipientID int64      `json:"recipient_id"` // 0, пока подарок не активирован
+	Days        int        `json:"days"`
+	Amount      float64    `json:"amount"` // Списано с баланса дарителя
+	Message     string     `json:"message"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RedeemedAt  *time.Time `json:"redeemed_at"`
+}
+
+// InsufficientBalanceError не хватает баланса для покупки подарка
+type InsufficientBalanceError struct {
+	Balance float64
+	Cost    float64
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	return "недостаточно средств на балансе"
+}
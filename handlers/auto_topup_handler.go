@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"log"
+
+	"bot/common"
+	"bot/menus"
+	"bot/payments"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleAutoTopupCallback обрабатывает кнопки меню автопополнения
+func handleAutoTopupCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *common.User, data string, callback *tgbotapi.CallbackQuery) {
+	if payments.GlobalPaymentManager == nil || !payments.GlobalPaymentManager.IsAutoTopupAvailable() {
+		bot.Request(tgbotapi.NewCallback(callback.ID, "Автопополнение недоступно"))
+		return
+	}
+
+	log.Printf("HANDLE_CALLBACK: Автопополнение '%s' для TelegramID=%d", data, user.TelegramID)
+
+	switch data {
+	case "autotopup_link":
+		if err := payments.GlobalPaymentManager.ProcessCardLinkRequest(user.TelegramID, chatID); err != nil {
+			log.Printf("HANDLE_CALLBACK: Ошибка привязки карты для TelegramID=%d: %v", user.TelegramID, err)
+			bot.Send(tgbotapi.NewMessage(chatID, "❌ Не удалось создать платеж для привязки карты. Попробуйте позже."))
+		}
+		return
+	case "autotopup_toggle":
+		settings, err := paymentCommon.GetAutoTopupSettings(user.TelegramID)
+		if err != nil || !settings.HasCard() {
+			log.Printf("HANDLE_CALLBACK: Ошибка получения автопополнения для TelegramID=%d: %v", user.TelegramID, err)
+			break
+		}
+		if err := paymentCommon.SetAutoTopupEnabled(user.TelegramID, !settings.Enabled); err != nil {
+			log.Printf("HANDLE_CALLBACK: %v", err)
+		}
+	case "autotopup_remove":
+		if err := paymentCommon.RemoveAutoTopupCard(user.TelegramID); err != nil {
+			log.Printf("HANDLE_CALLBACK: %v", err)
+		}
+	}
+
+	settings, err := paymentCommon.GetAutoTopupSettings(user.TelegramID)
+	if err != nil {
+		log.Printf("HANDLE_CALLBACK: Ошибка получения автопополнения для TelegramID=%d: %v", user.TelegramID, err)
+		bot.Request(tgbotapi.NewCallback(callback.ID, "Ошибка получения данных"))
+		return
+	}
+
+	menus.EditAutoTopup(bot, chatID, messageID, settings)
+}
@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"strconv"
 	"strings"
 
+	"bot/campaignLink"
 	"bot/common"
+	"bot/familyLink"
+	"bot/giftLink"
 	"bot/menus"
 	"bot/payments"
 	"bot/payments/promo"
@@ -56,6 +60,27 @@ func HandleCallback(bot *tgbotapi.BotAPI, callback *tgbotapi.CallbackQuery) {
 		return
 	}
 
+	// Проверяем, является ли это callback рекламных кампаний
+	if campaignLink.GlobalCampaignManager != nil && campaignLink.GlobalCampaignManager.IsCampaignCallback(data) {
+		campaignLink.GlobalCampaignManager.HandleCallback(chatID, userID, data)
+		bot.Request(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+
+	// Проверяем, является ли это callback подарков
+	if giftLink.GlobalGiftManager != nil && giftLink.GlobalGiftManager.IsGiftCallback(data) {
+		giftLink.GlobalGiftManager.HandleCallback(chatID, messageID, user, data)
+		bot.Request(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+
+	// Проверяем, является ли это callback семейного тарифа
+	if familyLink.GlobalFamilyManager != nil && familyLink.GlobalFamilyManager.IsFamilyCallback(data) {
+		familyLink.GlobalFamilyManager.HandleCallback(chatID, messageID, user, data)
+		bot.Request(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+
 	switch {
 	case data == "balance":
 		log.Printf("HANDLE_CALLBACK: Вызов editBalance для TelegramID=%d", userID)
@@ -63,6 +88,14 @@ func HandleCallback(bot *tgbotapi.BotAPI, callback *tgbotapi.CallbackQuery) {
 	case data == "vpn":
 		log.Printf("HANDLE_CALLBACK: Вызов editVPN для TelegramID=%d", userID)
 		menus.EditVPN(bot, chatID, messageID, user)
+	case data == "traffic_usage":
+		log.Printf("HANDLE_CALLBACK: Вызов SendTrafficUsage для TelegramID=%d", userID)
+		bot.Request(tgbotapi.NewCallback(callback.ID, ""))
+		menus.SendTrafficUsage(bot, chatID, user)
+	case strings.HasPrefix(data, "traffic_pack:"):
+		handleTrafficPackCallback(bot, chatID, user, data, callback)
+	case strings.HasPrefix(data, "traffic_pack_buy:"):
+		handleTrafficPackBuyCallback(bot, chatID, messageID, user, data, callback)
 	case data == "topup":
 		log.Printf("HANDLE_CALLBACK: Вызов editTopup для TelegramID=%d", userID)
 		menus.EditTopup(bot, chatID, messageID)
@@ -87,12 +120,29 @@ func HandleCallback(bot *tgbotapi.BotAPI, callback *tgbotapi.CallbackQuery) {
 			// В режиме автосписания перенаправляем на пополнение баланса
 			menus.EditTopup(bot, chatID, messageID)
 		}
+	case data == "autotopup" || strings.HasPrefix(data, "autotopup_"):
+		handleAutoTopupCallback(bot, chatID, messageID, user, data, callback)
+	case data == "receipts" || strings.HasPrefix(data, "receipt:") || strings.HasPrefix(data, "receipt_resend:"):
+		handleReceiptsCallback(bot, chatID, messageID, user, data, callback)
 	case strings.HasPrefix(data, "pay:"):
 		handlePayCallback(bot, chatID, messageID, user, data, callback)
 	case strings.HasPrefix(data, "topup:"):
 		handleTopupCallback(bot, chatID, messageID, user, data, callback)
 	case strings.HasPrefix(data, "check_payment:"):
 		handleCheckPaymentCallback(bot, chatID, messageID, user, data, callback)
+	case data == "location":
+		menus.EditLocations(bot, chatID, messageID, user)
+	case strings.HasPrefix(data, "location:"):
+		handleLocationCallback(bot, chatID, messageID, data, user, callback)
+		return
+	case strings.HasPrefix(data, "trial_abuse_"):
+		handleTrialAbuseCallback(bot, chatID, messageID, data, callback)
+	case strings.HasPrefix(data, "recon_fix:"):
+		handleReconcileFixCallback(bot, chatID, data, callback)
+	case strings.HasPrefix(data, "refund_full:"):
+		handleRefundFullCallback(bot, chatID, data, callback)
+	case strings.HasPrefix(data, "refund_confirm:"):
+		handleRefundConfirmCallback(bot, chatID, data, callback)
 	case data == "traffic_config":
 		handleTrafficConfigCallback(bot, chatID, userID, callback)
 	case data == "check_traffic_now":
@@ -108,6 +158,8 @@ func HandleCallback(bot *tgbotapi.BotAPI, callback *tgbotapi.CallbackQuery) {
 	case data == "device_android":
 		log.Printf("HANDLE_CALLBACK: Вызов editAndroidLinks для TelegramID=%d", userID)
 		menus.EditAndroidLinks(bot, chatID, messageID)
+	case data == "edit_traffic_daily" || data == "edit_traffic_weekly" || data == "edit_traffic_monthly":
+		handleEditTrafficCallback(bot, chatID, messageID, userID, data, callback)
 	case strings.HasPrefix(data, "set_daily:"):
 		handleSetDailyTrafficCallback(bot, chatID, messageID, data, callback)
 	case strings.HasPrefix(data, "set_weekly:"):
@@ -227,12 +279,34 @@ func handleCheckTrafficNowCallback(bot *tgbotapi.BotAPI, chatID int64, messageID
 	}
 }
 
+// answerTrialError отвечает на callback ошибкой активации пробного периода
+func answerTrialError(bot *tgbotapi.BotAPI, callback *tgbotapi.CallbackQuery, err error) {
+	if errors.Is(err, common.ErrTrialChannelRequired) {
+		// Показываем всплывающее окно: пользователь должен подписаться и нажать кнопку еще раз
+		alert := tgbotapi.NewCallbackWithAlert(callback.ID, "📢 Подпишитесь на канал и нажмите кнопку активации еще раз")
+		bot.Request(alert)
+		return
+	}
+	if errors.Is(err, common.ErrTrialBlocked) {
+		bot.Request(tgbotapi.NewCallbackWithAlert(callback.ID, "🚫 Пробный период недоступен для этого аккаунта"))
+		return
+	}
+	bot.Request(tgbotapi.NewCallback(callback.ID, "❌ Ошибка активации пробного периода"))
+}
+
 // handleActivateTrialCallback обрабатывает callback для активации пробного периода
 func handleActivateTrialCallback(bot *tgbotapi.BotAPI, chatID int64, user *common.User, callback *tgbotapi.CallbackQuery) {
 	userID := callback.From.ID
 	messageID := callback.Message.MessageID
 	log.Printf("HANDLE_CALLBACK: Активация пробного периода для TelegramID=%d", userID)
 
+	// Пробный период запрещен для связанных аккаунтов и аккаунтов с заблокированных IP
+	if common.IsTrialBlocked(userID) {
+		log.Printf("HANDLE_CALLBACK: Пользователю %d запрещен пробный период", userID)
+		answerTrialError(bot, callback, common.ErrTrialBlocked)
+		return
+	}
+
 	// Проверяем, может ли пользователь использовать пробный период
 	if !common.TrialManager.CanUseTrial(user) {
 		log.Printf("HANDLE_CALLBACK: Пользователь %d уже использовал пробный период", userID)
@@ -249,7 +323,7 @@ func handleActivateTrialCallback(bot *tgbotapi.BotAPI, chatID int64, user *commo
 		log.Printf("HANDLE_CALLBACK: Активация пробного периода с реферальным кодом %s для TelegramID=%d", referralCode, userID)
 		if err := common.TrialManager.CreateTrialConfigWithReferral(bot, user, chatID, referralCode); err != nil {
 			log.Printf("HANDLE_CALLBACK: Ошибка создания пробного конфига с реферальным кодом для TelegramID=%d: %v", userID, err)
-			bot.Request(tgbotapi.NewCallback(callback.ID, "❌ Ошибка активации пробного периода"))
+			answerTrialError(bot, callback, err)
 		} else {
 			bot.Request(tgbotapi.NewCallback(callback.ID, "✅ Пробный период активирован!"))
 			// Переходим на главное меню (редактируем сообщение вместо удаления)
@@ -260,7 +334,7 @@ func handleActivateTrialCallback(bot *tgbotapi.BotAPI, chatID int64, user *commo
 		// Обычная активация без реферального кода
 		if err := common.TrialManager.CreateTrialConfig(bot, user, chatID); err != nil {
 			log.Printf("HANDLE_CALLBACK: Ошибка создания пробного конфига для TelegramID=%d: %v", userID, err)
-			bot.Request(tgbotapi.NewCallback(callback.ID, "❌ Ошибка активации пробного периода"))
+			answerTrialError(bot, callback, err)
 		} else {
 			bot.Request(tgbotapi.NewCallback(callback.ID, "✅ Пробный период активирован!"))
 			// Переходим на главное меню (редактируем сообщение вместо удаления)
@@ -270,6 +344,23 @@ func handleActivateTrialCallback(bot *tgbotapi.BotAPI, chatID int64, user *commo
 	}
 }
 
+// handleEditTrafficCallback открывает выбор лимита трафика за день, неделю или месяц
+func handleEditTrafficCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, userID int64, data string, callback *tgbotapi.CallbackQuery) {
+	if userID != common.ADMIN_ID {
+		bot.Request(tgbotapi.NewCallback(callback.ID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	switch data {
+	case "edit_traffic_daily":
+		common.EditTrafficDaily(bot, chatID, messageID)
+	case "edit_traffic_weekly":
+		common.EditTrafficWeekly(bot, chatID, messageID)
+	case "edit_traffic_monthly":
+		common.EditTrafficMonthly(bot, chatID, messageID)
+	}
+}
+
 // handleSetDailyTrafficCallback обрабатывает callback для установки дневного лимита трафика
 func handleSetDailyTrafficCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, data string, callback *tgbotapi.CallbackQuery) {
 	userID := callback.From.ID
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"bot/common"
+	"bot/menus"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// serversHelp справка по команде /servers
+const serversHelp = "\n\n/servers on <id> - открыть сервер для выбора\n" +
+	"/servers off <id> - закрыть сервер для выбора\n" +
+	"/servers cap <id> <число> - вместимость (0 - без ограничения)"
+
+// handleLocationCallback переносит конфиг пользователя на выбранную локацию
+func handleLocationCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, data string, user *common.User, callback *tgbotapi.CallbackQuery) {
+	serverID := strings.TrimPrefix(data, "location:")
+
+	server, err := common.SwitchUserServer(user, serverID)
+	if err != nil {
+		log.Printf("HANDLE_CALLBACK: Ошибка смены локации пользователя %d на %s: %v", user.TelegramID, serverID, err)
+		bot.Request(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	bot.Request(tgbotapi.NewCallback(callback.ID, "✅ Локация изменена: "+server.Location))
+	menus.EditVPN(bot, chatID, messageID, user)
+}
+
+// handleServersCommand обрабатывает команду /servers - загрузка серверов и управление ими
+func handleServersCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	log.Printf("HANDLE_MESSAGE: Выполнение команды /servers для TelegramID=%d", message.From.ID)
+
+	if message.From.ID != common.ADMIN_ID {
+		log.Printf("HANDLE_MESSAGE: Пользователь TelegramID=%d не является админом для команды /servers", message.From.ID)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	args := strings.Fields(message.Text)[1:] // Убираем команду из аргументов
+
+	var err error
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && args[0] == "on":
+		err = common.SetServerEnabled(args[1], true)
+	case len(args) == 2 && args[0] == "off":
+		err = common.SetServerEnabled(args[1], false)
+	case len(args) == 3 && args[0] == "cap":
+		capacity, convErr := strconv.Atoi(args[2])
+		if convErr != nil || capacity < 0 {
+			err = fmt.Errorf("неверная вместимость: %s", args[2])
+			break
+		}
+		err = common.SetServerCapacity(args[1], capacity)
+	default:
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "ℹ️ Использование:"+serversHelp))
+		return
+	}
+
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, common.GetServersReport()+serversHelp))
+}
@@ -3,9 +3,13 @@ package handlers
 import (
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 
+	"bot/campaignLink"
 	"bot/common"
+	"bot/familyLink"
+	"bot/giftLink"
 	"bot/menus"
 	"bot/payments/promo"
 	"bot/referralLink"
@@ -38,6 +42,26 @@ func HandleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	}
 	log.Printf("HANDLE_MESSAGE: Пользователь получен/создан: TelegramID=%d, Username=%s, FirstName=%s, LastName=%s", user.TelegramID, user.Username, user.FirstName, user.LastName)
 
+	// Учитываем переход по ссылке рекламной кампании (/start c_<кампания>)
+	if message.IsCommand() && message.Command() == "start" && campaignLink.GlobalCampaignManager != nil &&
+		campaignLink.GlobalCampaignManager.IsCampaignStart(message.Text) {
+		campaignLink.GlobalCampaignManager.HandleStartCommand(user, message.Text)
+	}
+
+	// Активируем подарок по ссылке (/start gift_<код>)
+	if message.IsCommand() && message.Command() == "start" && giftLink.GlobalGiftManager != nil &&
+		giftLink.GlobalGiftManager.IsGiftStart(message.Text) {
+		giftLink.GlobalGiftManager.HandleStartCommand(message.Chat.ID, user, message.Text)
+		return
+	}
+
+	// Принимаем приглашение на место семейного тарифа (/start seat_<код>)
+	if message.IsCommand() && message.Command() == "start" && familyLink.GlobalFamilyManager != nil &&
+		familyLink.GlobalFamilyManager.IsFamilyStart(message.Text) {
+		familyLink.GlobalFamilyManager.HandleStartCommand(message.Chat.ID, user, message.Text)
+		return
+	}
+
 	// Проверяем реферальную систему для команды /start
 	var isReferralUser bool
 	if message.IsCommand() && message.Command() == "start" && referralLink.GlobalReferralManager != nil {
@@ -154,8 +178,14 @@ func handleCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, user *common
 		handleBackupCommand(bot, message)
 	case "traffic":
 		handleTrafficCommand(bot, message)
+	case "traffic_top":
+		handleTrafficTopCommand(bot, message)
 	case "trial":
 		handleTrialCommand(bot, message)
+	case "trialabuse":
+		handleTrialAbuseCommand(bot, message)
+	case "servers":
+		handleServersCommand(bot, message)
 	case "reset_trial":
 		handleResetTrialCommand(bot, message)
 	case "users":
@@ -178,8 +208,22 @@ func handleCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, user *common
 		handleSwitchAutoCommand(bot, message)
 	case "billing_status":
 		handleBillingStatusCommand(bot, message)
-	case "ref":
+	case "reconcile":
+		handleReconcileCommand(bot, message)
+	case "panel_reconcile":
+		handlePanelReconcileCommand(bot, message)
+	case "refund":
+		handleRefundCommand(bot, message)
+	case "receipt":
+		handleReceiptCommand(bot, message, user)
+	case "ref", "refreview", "refpayout", "refpayouts":
 		handleRefCommand(bot, message, user)
+	case "campaign":
+		handleCampaignCommand(bot, message)
+	case "gift":
+		handleGiftCommand(bot, message, user)
+	case "family":
+		handleFamilyCommand(bot, message, user)
 	}
 }
 
@@ -192,10 +236,12 @@ func handleDebugCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, user *c
 			"SubID: %s\n"+
 			"ClientID: %s\n"+
 			"Email: %s\n"+
-			"Subscription URL: %s%s\n"+
+			"Server: %s\n"+
+			"Subscription URL: %s\n"+
 			"JSON URL (old): %s%s",
 			user.SubID, user.ClientID, user.Email,
-			common.CONFIG_BASE_URL, user.SubID,
+			common.GetUserServerID(user.TelegramID),
+			common.UserSubscriptionURL(user),
 			common.CONFIG_JSON_URL, user.SubID)
 		msg := tgbotapi.NewMessage(message.Chat.ID, debugText)
 		if _, err := bot.Send(msg); err != nil {
@@ -258,7 +304,7 @@ func handleTrialCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	log.Printf("HANDLE_MESSAGE: Выполнение команды /trial для TelegramID=%d", message.From.ID)
 
 	if message.From.ID == common.ADMIN_ID {
-		text := common.TrialManager.GetTrialPeriodInfo()
+		text := common.TrialManager.GetTrialPeriodInfo() + "\n\n" + common.TrialManager.GetTrialPolicyReport()
 		msg := tgbotapi.NewMessage(message.Chat.ID, text)
 		if _, err := bot.Send(msg); err != nil {
 			log.Printf("HANDLE_MESSAGE: Ошибка отправки информации о пробном периоде для TelegramID=%d: %v", message.From.ID, err)
@@ -503,9 +549,80 @@ func handleRefCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, user *com
 
 	// Используем глобальный менеджер рефералов
 	if referralLink.GlobalReferralManager != nil {
-		referralLink.GlobalReferralManager.HandleCommand(message.Chat.ID, user, "ref")
+		args := strings.Fields(message.Text)[1:] // Убираем команду из аргументов
+		referralLink.GlobalReferralManager.HandleCommand(message.Chat.ID, user, message.Command(), args)
 	} else {
 		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Реферальная система не инициализирована")
 		bot.Send(msg)
 	}
 }
+
+// handleCampaignCommand обрабатывает команду /campaign (рекламные кампании)
+func handleCampaignCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	if campaignLink.GlobalCampaignManager == nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Ссылки кампаний отключены"))
+		return
+	}
+
+	args := strings.Fields(message.Text)[1:] // Убираем команду из аргументов
+	campaignLink.GlobalCampaignManager.HandleCommand(message.Chat.ID, message.From.ID, message.Command(), args)
+}
+
+// handleGiftCommand обрабатывает команду /gift
+func handleGiftCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, user *common.User) {
+	if giftLink.GlobalGiftManager == nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Подарки отключены"))
+		return
+	}
+
+	args := strings.Fields(message.Text)[1:] // Убираем команду из аргументов
+	giftLink.GlobalGiftManager.HandleCommand(message.Chat.ID, user, message.Command(), args)
+}
+
+// handleFamilyCommand обрабатывает команду /family
+func handleFamilyCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, user *common.User) {
+	if familyLink.GlobalFamilyManager == nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Семейные тарифы отключены"))
+		return
+	}
+
+	familyLink.GlobalFamilyManager.HandleCommand(message.Chat.ID, user, message.Command())
+}
+
+// handleTrafficTopCommand обрабатывает команду /traffic_top [N] [day|week|month] - крупнейшие потребители трафика
+func handleTrafficTopCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	log.Printf("HANDLE_MESSAGE: Выполнение команды /traffic_top для TelegramID=%d", message.From.ID)
+
+	if message.From.ID != common.ADMIN_ID {
+		log.Printf("HANDLE_MESSAGE: Пользователь TelegramID=%d не является админом для команды /traffic_top", message.From.ID)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	limit := 10
+	period := common.TrafficPeriodDay
+	for _, arg := range strings.Fields(message.CommandArguments()) {
+		switch arg {
+		case common.TrafficPeriodDay, common.TrafficPeriodWeek, common.TrafficPeriodMonth:
+			period = arg
+		default:
+			n, err := strconv.Atoi(arg)
+			if err != nil || n <= 0 || n > 50 {
+				bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Использование: /traffic_top [1-50] [day|week|month]"))
+				return
+			}
+			limit = n
+		}
+	}
+
+	top, err := common.GetTopTrafficUsers(period, limit)
+	if err != nil {
+		log.Printf("HANDLE_MESSAGE: Ошибка получения рейтинга трафика: %v", err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Ошибка получения рейтинга трафика: %v", err)))
+		return
+	}
+
+	if _, err := bot.Send(tgbotapi.NewMessage(message.Chat.ID, common.FormatTrafficTopReport(period, top))); err != nil {
+		log.Printf("HANDLE_MESSAGE: Ошибка отправки рейтинга трафика: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"bot/common"
 	"bot/payments"
+	"bot/payments/promo"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -29,6 +30,16 @@ func ProcessPaymentCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, u
 
 	cost := float64(days * common.PRICE_PER_DAY)
 
+	// Применяем скидку по промокоду, если она действует для тарифа
+	var discount *promo.PromoDiscount
+	if promo.GlobalPromoManager != nil {
+		discount = promo.GlobalPromoManager.GetCheckoutDiscount(user.TelegramID, promo.PromoCheckout{Plan: promo.PromoPlanForDays(days), Amount: cost})
+		if discount != nil {
+			cost -= discount.Amount
+			log.Printf("PROCESS_PAYMENT_CALLBACK: Скидка по промокоду %s для TelegramID=%d: %.2f₽, к оплате %.2f₽", discount.Code, user.TelegramID, discount.Amount, cost)
+		}
+	}
+
 	// Проверяем баланс
 	if user.Balance < cost {
 		log.Printf("PROCESS_PAYMENT_CALLBACK: Недостаточно средств для TelegramID=%d, Balance=%.2f, Cost=%.2f", user.TelegramID, user.Balance, cost)
@@ -64,7 +75,7 @@ func ProcessPaymentCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, u
 
 	// Обрабатываем платеж
 	log.Printf("PROCESS_PAYMENT_CALLBACK: Вызов ProcessPayment для TelegramID=%d, days=%d", user.TelegramID, days)
-	configURL, err := common.ProcessPayment(user, days)
+	configURL, err := common.ProcessPaymentWithCost(user, days, cost)
 	if err != nil {
 		log.Printf("PROCESS_PAYMENT_CALLBACK: Ошибка обработки платежа для TelegramID=%d: %v", user.TelegramID, err)
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(
@@ -87,6 +98,14 @@ func ProcessPaymentCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, u
 	// Успешная оплата
 	log.Printf("PROCESS_PAYMENT_CALLBACK: Платеж успешен для TelegramID=%d, ConfigURL=%s", user.TelegramID, configURL)
 
+	discountText := ""
+	if discount != nil {
+		if err := promo.GlobalPromoManager.ApplyDiscount(discount); err != nil {
+			log.Printf("PROCESS_PAYMENT_CALLBACK: Ошибка применения скидки для TelegramID=%d: %v", user.TelegramID, err)
+		}
+		discountText = fmt.Sprintf("🎟 Скидка по промокоду: %.2f₽\n", discount.Amount)
+	}
+
 	// Используем HTML редирект страницу
 	redirectURL := common.GetRedirectURL() + configURL
 
@@ -110,12 +129,13 @@ func ProcessPaymentCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, u
 
 	text := fmt.Sprintf("✅ VPN конфиг успешно %s!\n\n"+
 		"📅 Период: %d %s\n"+
-		"💰 Списано: %.0f₽\n"+
+		"💰 Списано: %.2f₽\n"+
+		"%s"+
 		"💳 Остаток: %.2f₽\n"+
 		"⏰ Активен до: %s\n\n"+
 		"🔗 Ссылка на подписку:\n`%s`\n\n"+
 		"💡 Нажмите 'Подключить (%s)' для автоматического импорта",
-		actionText, days, common.GetDaysWord(days), cost, user.Balance, expiryDate, configURL, common.GetAppName())
+		actionText, days, common.GetDaysWord(days), cost, discountText, user.Balance, expiryDate, configURL, common.GetAppName())
 
 	log.Printf("PROCESS_PAYMENT_CALLBACK: Текст успешного платежа для TelegramID=%d: %s", user.TelegramID, text)
 	editMsg = tgbotapi.NewEditMessageText(chatID, messageID, text)
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"bot/common"
+	"bot/menus"
+	"bot/payments"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// receiptsListLimit количество чеков в списке
+const receiptsListLimit = 5
+
+// handleReceiptCommand обрабатывает команду /receipt <email|телефон|off>
+func handleReceiptCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, user *common.User) {
+	log.Printf("HANDLE_MESSAGE: Выполнение команды /receipt для TelegramID=%d", user.TelegramID)
+
+	args := strings.TrimSpace(message.CommandArguments())
+	if args == "" {
+		contact, err := paymentCommon.GetReceiptContact(user.TelegramID)
+		if err != nil {
+			log.Printf("HANDLE_MESSAGE: %v", err)
+		}
+
+		text := "🧾 Контакт для чеков не указан."
+		if !contact.IsEmpty() {
+			text = "🧾 Чеки отправляются на: " + formatReceiptContact(contact)
+		}
+		text += "\n\nУказать: /receipt email@example.com или /receipt +79001234567\nУдалить: /receipt off"
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, text))
+		return
+	}
+
+	if strings.EqualFold(args, "off") {
+		if err := paymentCommon.DeleteReceiptContact(user.TelegramID); err != nil {
+			log.Printf("HANDLE_MESSAGE: %v", err)
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Не удалось удалить контакт, попробуйте позже"))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "✅ Контакт для чеков удален"))
+		return
+	}
+
+	email, phone, err := paymentCommon.ParseReceiptContact(args)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ %s\n\nПример: /receipt email@example.com или /receipt +79001234567", err)))
+		return
+	}
+
+	if err := paymentCommon.SaveReceiptContact(user.TelegramID, email, phone); err != nil {
+		log.Printf("HANDLE_MESSAGE: %v", err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Не удалось сохранить контакт, попробуйте позже"))
+		return
+	}
+
+	contact := &paymentCommon.ReceiptContact{UserID: user.TelegramID, Email: email, Phone: phone}
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, "✅ Чеки будут отправляться на: "+formatReceiptContact(contact)))
+}
+
+// handleReceiptsCallback обрабатывает просмотр и повторную отправку чеков
+func handleReceiptsCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *common.User, data string, callback *tgbotapi.CallbackQuery) {
+	if payments.GlobalPaymentManager == nil {
+		bot.Request(tgbotapi.NewCallback(callback.ID, "Платежная система недоступна"))
+		return
+	}
+
+	switch {
+	case data == "receipts":
+		contact, err := paymentCommon.GetReceiptContact(user.TelegramID)
+		if err != nil {
+			log.Printf("HANDLE_CALLBACK: %v", err)
+		}
+		receipts, err := payments.GlobalPaymentManager.GetUserReceipts(user.TelegramID, receiptsListLimit)
+		if err != nil {
+			log.Printf("HANDLE_CALLBACK: Ошибка получения чеков для TelegramID=%d: %v", user.TelegramID, err)
+			bot.Request(tgbotapi.NewCallback(callback.ID, "Ошибка получения чеков"))
+			return
+		}
+		menus.EditReceipts(bot, chatID, messageID, contact, receipts)
+
+	case strings.HasPrefix(data, "receipt:"):
+		paymentID := strings.TrimPrefix(data, "receipt:")
+		receipt, err := paymentCommon.GetPaymentReceipt(paymentID)
+		if err != nil || receipt == nil || receipt.UserID != user.TelegramID {
+			log.Printf("HANDLE_CALLBACK: Чек %s не найден для TelegramID=%d: %v", paymentID, user.TelegramID, err)
+			bot.Request(tgbotapi.NewCallback(callback.ID, "Чек не найден"))
+			return
+		}
+		if err := payments.GlobalPaymentManager.RefreshReceiptStatus(receipt); err != nil {
+			log.Printf("HANDLE_CALLBACK: Не удалось обновить статус чека %s: %v", paymentID, err)
+		}
+		menus.EditReceiptDetails(bot, chatID, messageID, receipt)
+
+	case strings.HasPrefix(data, "receipt_resend:"):
+		paymentID := strings.TrimPrefix(data, "receipt_resend:")
+		receipt, err := payments.GlobalPaymentManager.ResendReceipt(user.TelegramID, paymentID)
+		if err != nil {
+			log.Printf("HANDLE_CALLBACK: Ошибка повторной отправки чека %s для TelegramID=%d: %v", paymentID, user.TelegramID, err)
+			bot.Send(tgbotapi.NewMessage(chatID, "❌ Не удалось отправить чек повторно, попробуйте позже"))
+			return
+		}
+
+		// Отправляем чек отдельным сообщением, чтобы он остался в истории чата
+		msg := tgbotapi.NewMessage(chatID, menus.FormatReceipt(receipt))
+		msg.ParseMode = tgbotapi.ModeHTML
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("HANDLE_CALLBACK: Ошибка отправки чека для TelegramID=%d: %v", user.TelegramID, err)
+		}
+	}
+}
+
+// formatReceiptContact форматирует контакт для чеков
+func formatReceiptContact(contact *paymentCommon.ReceiptContact) string {
+	if contact.Email != "" {
+		return contact.Email
+	}
+	return "+" + contact.Phone
+}
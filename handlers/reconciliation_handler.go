@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"bot/common"
+	"bot/payments"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleReconcileCommand обрабатывает команду /reconcile [дней]
+func handleReconcileCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	log.Printf("HANDLE_MESSAGE: Выполнение команды /reconcile для TelegramID=%d", message.From.ID)
+
+	if message.From.ID != common.ADMIN_ID {
+		log.Printf("HANDLE_MESSAGE: Пользователь TelegramID=%d не является админом для команды /reconcile", message.From.ID)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "🚫 Доступ запрещён")
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("HANDLE_MESSAGE: Ошибка отправки сообщения о запрете для TelegramID=%d: %v", message.From.ID, err)
+		}
+		return
+	}
+
+	if payments.GlobalPaymentManager == nil || payments.GlobalPaymentManager.GetReconciliationService() == nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Платежная система не инициализирована"))
+		return
+	}
+
+	days := common.PAYMENT_RECONCILIATION_DAYS
+	if args := strings.TrimSpace(message.CommandArguments()); args != "" {
+		parsed, err := strconv.Atoi(args)
+		if err != nil || parsed <= 0 || parsed > 90 {
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Укажите количество дней от 1 до 90\n\nПример: /reconcile 7"))
+			return
+		}
+		days = parsed
+	}
+
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("⏳ Сверка платежей за %d дн...", days)))
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -days)
+
+	reconciliation := payments.GlobalPaymentManager.GetReconciliationService()
+	report, err := reconciliation.Reconcile(from, to)
+	if err != nil {
+		log.Printf("HANDLE_MESSAGE: Ошибка сверки платежей: %v", err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Ошибка сверки платежей: %v", err)))
+		return
+	}
+
+	if err := reconciliation.SendReportToAdmin(report); err != nil {
+		log.Printf("HANDLE_MESSAGE: %v", err)
+	}
+}
+
+// handleReconcileFixCallback обрабатывает кнопку исправления расхождения
+func handleReconcileFixCallback(bot *tgbotapi.BotAPI, chatID int64, data string, callback *tgbotapi.CallbackQuery) {
+	if callback.From.ID != common.ADMIN_ID {
+		bot.Request(tgbotapi.NewCallback(callback.ID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	if payments.GlobalPaymentManager == nil || payments.GlobalPaymentManager.GetReconciliationService() == nil {
+		bot.Send(tgbotapi.NewMessage(chatID, "❌ Платежная система не инициализирована"))
+		return
+	}
+
+	paymentID := strings.TrimPrefix(data, "recon_fix:")
+	log.Printf("HANDLE_CALLBACK: Исправление расхождения по платежу %s", paymentID)
+
+	result, err := payments.GlobalPaymentManager.GetReconciliationService().FixDiscrepancy(paymentID)
+	if err != nil {
+		log.Printf("HANDLE_CALLBACK: Ошибка исправления расхождения по платежу %s: %v", paymentID, err)
+		result = fmt.Sprintf("❌ Ошибка исправления: %v", err)
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🆔 %s\n\n%s", paymentID, result))
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("HANDLE_CALLBACK: Ошибка отправки результата исправления: %v", err)
+	}
+}
+
+// handlePanelReconcileCommand обрабатывает команду /panel_reconcile [apply] - сверка базы с клиентами панелей
+func handlePanelReconcileCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	log.Printf("HANDLE_MESSAGE: Выполнение команды /panel_reconcile для TelegramID=%d", message.From.ID)
+
+	if message.From.ID != common.ADMIN_ID {
+		log.Printf("HANDLE_MESSAGE: Пользователь TelegramID=%d не является админом для команды /panel_reconcile", message.From.ID)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	apply := false
+	switch strings.TrimSpace(message.CommandArguments()) {
+	case "":
+	case "apply":
+		apply = true
+	default:
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Использование: /panel_reconcile - отчет, /panel_reconcile apply - исправить расхождения"))
+		return
+	}
+
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, "⏳ Сверка базы с панелями..."))
+
+	report, err := common.ReconcilePanels(apply)
+	if err != nil {
+		log.Printf("HANDLE_MESSAGE: Ошибка сверки с панелями: %v", err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Ошибка сверки с панелями: %v", err)))
+		return
+	}
+
+	if _, err := bot.Send(tgbotapi.NewMessage(message.Chat.ID, common.FormatPanelReconcileReport(report))); err != nil {
+		log.Printf("HANDLE_MESSAGE: Ошибка отправки отчета сверки с панелями: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"bot/common"
+	"bot/payments"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const refundUsage = "Использование:\n" +
+	"/refund <telegram_id> - платежи пользователя\n" +
+	"/refund <payment_id> [сумма] [причина] - возврат (без суммы - полный)"
+
+// handleRefundCommand обрабатывает команду /refund
+func handleRefundCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	log.Printf("HANDLE_MESSAGE: Выполнение команды /refund для TelegramID=%d", message.From.ID)
+
+	if message.From.ID != common.ADMIN_ID {
+		log.Printf("HANDLE_MESSAGE: Пользователь TelegramID=%d не является админом для команды /refund", message.From.ID)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "🚫 Доступ запрещён")
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("HANDLE_MESSAGE: Ошибка отправки сообщения о запрете для TelegramID=%d: %v", message.From.ID, err)
+		}
+		return
+	}
+
+	if payments.GlobalPaymentManager == nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Платежная система не инициализирована"))
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, refundUsage))
+		return
+	}
+
+	// Числовой аргумент - TelegramID пользователя
+	if telegramID, err := strconv.ParseInt(args[0], 10, 64); err == nil && len(args) == 1 {
+		sendUserPaymentsForRefund(bot, message.Chat.ID, telegramID)
+		return
+	}
+
+	paymentID := args[0]
+	amount := 0.0
+	reason := "Возврат по решению администратора"
+
+	if len(args) > 1 {
+		parsed, err := strconv.ParseFloat(strings.Replace(args[1], ",", ".", 1), 64)
+		if err != nil || parsed <= 0 {
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Некорректная сумма возврата\n\n"+refundUsage))
+			return
+		}
+		amount = parsed
+	}
+
+	if len(args) > 2 {
+		reason = strings.Join(args[2:], " ")
+	}
+
+	executeRefund(bot, message.Chat.ID, message.From.ID, paymentID, amount, reason)
+}
+
+// sendUserPaymentsForRefund отправляет список платежей пользователя с кнопками возврата
+func sendUserPaymentsForRefund(bot *tgbotapi.BotAPI, chatID int64, telegramID int64) {
+	credits, err := paymentCommon.GetUserPaymentCredits(telegramID, 10)
+	if err != nil {
+		log.Printf("HANDLE_MESSAGE: Ошибка получения платежей пользователя %d: %v", telegramID, err)
+		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ Ошибка получения платежей: %v", err)))
+		return
+	}
+
+	if len(credits) == 0 {
+		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("ℹ️ У пользователя %d нет платежей", telegramID)))
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("💳 <b>Платежи пользователя %d</b>\n\n", telegramID))
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, credit := range credits {
+		refunded, err := paymentCommon.GetRefundedAmount(credit.PaymentID)
+		if err != nil {
+			log.Printf("HANDLE_MESSAGE: %v", err)
+		}
+
+		text.WriteString(fmt.Sprintf("%d. %.2f₽ • %s • %s\n   🆔 <code>%s</code>\n",
+			i+1, credit.Amount, credit.Method, credit.CreatedAt.Format("02.01.2006 15:04"), credit.PaymentID))
+		if refunded > 0 {
+			text.WriteString(fmt.Sprintf("   ↩️ Возвращено: %.2f₽\n", refunded))
+		}
+
+		if credit.Amount-refunded > 0 {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(
+					fmt.Sprintf("↩️ %d. Вернуть %.2f₽", i+1, credit.Amount-refunded),
+					"refund_full:"+credit.PaymentID),
+			))
+		}
+	}
+
+	text.WriteString("\nДля частичного возврата: /refund <payment_id> <сумма> [причина]")
+
+	msg := tgbotapi.NewMessage(chatID, text.String())
+	msg.ParseMode = tgbotapi.ModeHTML
+	if len(rows) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("HANDLE_MESSAGE: Ошибка отправки списка платежей: %v", err)
+	}
+}
+
+// handleRefundFullCallback запрашивает подтверждение полного возврата
+func handleRefundFullCallback(bot *tgbotapi.BotAPI, chatID int64, data string, callback *tgbotapi.CallbackQuery) {
+	if callback.From.ID != common.ADMIN_ID {
+		bot.Request(tgbotapi.NewCallback(callback.ID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	if payments.GlobalPaymentManager == nil {
+		bot.Send(tgbotapi.NewMessage(chatID, "❌ Платежная система не инициализирована"))
+		return
+	}
+
+	paymentID := strings.TrimPrefix(data, "refund_full:")
+	credit, available, err := payments.GlobalPaymentManager.GetRefundableAmount(paymentID)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	text := fmt.Sprintf("❓ Вернуть %.2f₽ пользователю %d?\n\n🆔 %s\nСумма будет списана с баланса пользователя.",
+		available, credit.UserID, paymentID)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", "refund_confirm:"+paymentID),
+		),
+	)
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("HANDLE_CALLBACK: Ошибка отправки подтверждения возврата: %v", err)
+	}
+}
+
+// handleRefundConfirmCallback выполняет полный возврат после подтверждения
+func handleRefundConfirmCallback(bot *tgbotapi.BotAPI, chatID int64, data string, callback *tgbotapi.CallbackQuery) {
+	if callback.From.ID != common.ADMIN_ID {
+		bot.Request(tgbotapi.NewCallback(callback.ID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	if payments.GlobalPaymentManager == nil {
+		bot.Send(tgbotapi.NewMessage(chatID, "❌ Платежная система не инициализирована"))
+		return
+	}
+
+	paymentID := strings.TrimPrefix(data, "refund_confirm:")
+	executeRefund(bot, chatID, callback.From.ID, paymentID, 0, "Возврат по решению администратора")
+}
+
+// executeRefund выполняет возврат и отправляет результат администратору
+func executeRefund(bot *tgbotapi.BotAPI, chatID int64, adminID int64, paymentID string, amount float64, reason string) {
+	log.Printf("HANDLE_REFUND: Возврат платежа %s, сумма %.2f (0 - полный)", paymentID, amount)
+
+	result, err := payments.GlobalPaymentManager.RefundPayment(adminID, paymentID, amount, reason)
+	if err != nil {
+		log.Printf("HANDLE_REFUND: Ошибка возврата платежа %s: %v", paymentID, err)
+		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ Ошибка возврата: %v", err)))
+		return
+	}
+
+	text := fmt.Sprintf("✅ Возврат создан\n\n🆔 Платеж: %s\n↩️ Возврат: %s\n💸 Сумма: %.2f₽\n📊 Статус: %s",
+		paymentID, result.Refund.ID, result.Refund.Amount, result.Refund.Status)
+
+	if result.Refund.Status != "canceled" {
+		text += fmt.Sprintf("\n💰 Баланс пользователя: %.2f₽", result.NewBalance)
+	}
+	if result.ConfigDisabled {
+		text += "\n⚠️ Баланс отрицательный - конфиг пользователя отключен"
+	}
+
+	if _, err := bot.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+		log.Printf("HANDLE_REFUND: Ошибка отправки результата возврата: %v", err)
+	}
+}
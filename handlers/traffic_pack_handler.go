@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"bot/common"
+	"bot/payments/promo"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// trafficPackFromCallback возвращает пакет каталога из callback вида traffic_pack:<гб> или traffic_pack_buy:<гб>
+func trafficPackFromCallback(data, prefix string) (common.TrafficPack, bool) {
+	gb, err := strconv.Atoi(strings.TrimPrefix(data, prefix))
+	if err != nil {
+		return common.TrafficPack{}, false
+	}
+	return common.FindTrafficPack(gb)
+}
+
+// trafficPackCost возвращает цену пакета с учетом скидки по промокоду
+func trafficPackCost(user *common.User, pack common.TrafficPack) (float64, *promo.PromoDiscount) {
+	cost := float64(pack.Price)
+	if promo.GlobalPromoManager == nil {
+		return cost, nil
+	}
+
+	discount := promo.GlobalPromoManager.GetCheckoutDiscount(user.TelegramID, promo.PromoCheckout{Plan: promo.PromoPlanForTrafficPack(pack.GB), Amount: cost})
+	if discount != nil {
+		cost -= discount.Amount
+	}
+	return cost, discount
+}
+
+// handleTrafficPackCallback показывает подтверждение покупки пакета трафика.
+// Экран трафика может быть фото, поэтому подтверждение отправляется новым сообщением.
+func handleTrafficPackCallback(bot *tgbotapi.BotAPI, chatID int64, user *common.User, data string, callback *tgbotapi.CallbackQuery) {
+	pack, ok := trafficPackFromCallback(data, "traffic_pack:")
+	if !ok || !common.TrafficPacksAvailable() {
+		bot.Request(tgbotapi.NewCallback(callback.ID, "Пакет трафика недоступен"))
+		return
+	}
+	log.Printf("HANDLE_CALLBACK: Пакет трафика %d ГБ для TelegramID=%d", pack.GB, user.TelegramID)
+
+	cost, discount := trafficPackCost(user, pack)
+	text := fmt.Sprintf("➕ Пакет трафика %d ГБ\n\n"+
+		"Объем пакета добавляется к лимиту каждого текущего периода (день, неделя, месяц). "+
+		"В каждом периоде пакет действует до его сброса: после полуночи остается прибавка только к недельному и месячному лимиту.\n\n", pack.GB)
+	if discount != nil {
+		text += fmt.Sprintf("🎟 Скидка по промокоду: %.2f₽\n", discount.Amount)
+	}
+	text += fmt.Sprintf("💸 Стоимость: %.2f₽\n💰 Ваш баланс: %.2f₽", cost, user.Balance)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("✅ Купить за %.0f₽", cost), fmt.Sprintf("traffic_pack_buy:%d", pack.GB)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
+		),
+	)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("HANDLE_CALLBACK: Ошибка отправки подтверждения пакета трафика для TelegramID=%d: %v", user.TelegramID, err)
+	}
+}
+
+// handleTrafficPackBuyCallback покупает пакет трафика с баланса
+func handleTrafficPackBuyCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *common.User, data string, callback *tgbotapi.CallbackQuery) {
+	pack, ok := trafficPackFromCallback(data, "traffic_pack_buy:")
+	if !ok {
+		bot.Request(tgbotapi.NewCallback(callback.ID, "Пакет трафика недоступен"))
+		return
+	}
+
+	// Баланс мог измениться после показа подтверждения
+	if updatedUser, err := common.GetUserByTelegramID(user.TelegramID); err == nil {
+		user = updatedUser
+	}
+
+	cost, discount := trafficPackCost(user, pack)
+
+	// Скидка расходуется в транзакции покупки: повторное нажатие не применит одноразовую скидку дважды
+	var consumeDiscount func(tx *sql.Tx) error
+	if discount != nil {
+		consumeDiscount = func(tx *sql.Tx) error {
+			return promo.GlobalPromoManager.ApplyDiscountTx(tx, discount)
+		}
+	}
+
+	err := common.PurchaseTrafficPack(user, pack, cost, consumeDiscount)
+	switch {
+	case errors.Is(err, common.ErrInsufficientBalance):
+		log.Printf("HANDLE_CALLBACK: Недостаточно средств на пакет трафика для TelegramID=%d, Balance=%.2f, Cost=%.2f", user.TelegramID, user.Balance, cost)
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("💳 Пополнить", "topup"),
+				tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
+			),
+		)
+		text := fmt.Sprintf("❌ Недостаточно средств!\n\n"+
+			"💰 Ваш баланс: %.2f₽\n"+
+			"💸 Нужно: %.0f₽\n"+
+			"💎 Не хватает: %.2f₽\n\n"+
+			"Пополните баланс для продолжения",
+			user.Balance, cost, cost-user.Balance)
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+		editMsg.ReplyMarkup = &keyboard
+		bot.Send(editMsg)
+		return
+	case errors.Is(err, common.ErrTrafficPacksUnavailable):
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "❌ Пакеты трафика сейчас недоступны"))
+		return
+	case err != nil:
+		log.Printf("HANDLE_CALLBACK: Ошибка покупки пакета трафика для TelegramID=%d: %v", user.TelegramID, err)
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "❌ Не удалось купить пакет трафика, попробуйте позже"))
+		return
+	}
+
+	discountText := ""
+	if discount != nil {
+		log.Printf("HANDLE_CALLBACK: Скидка по промокоду %s применена к пакету трафика для TelegramID=%d: %.2f₽", discount.Code, user.TelegramID, discount.Amount)
+		discountText = fmt.Sprintf("🎟 Скидка по промокоду: %.2f₽\n", discount.Amount)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📊 Трафик", "traffic_usage"),
+			tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
+		),
+	)
+	text := fmt.Sprintf("✅ Пакет трафика %d ГБ добавлен!\n\n%s💸 Списано: %.2f₽\n💰 Баланс: %.2f₽",
+		pack.GB, discountText, cost, user.Balance)
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	editMsg.ReplyMarkup = &keyboard
+	if _, err := bot.Send(editMsg); err != nil {
+		log.Printf("HANDLE_CALLBACK: Ошибка отправки сообщения о покупке пакета для TelegramID=%d: %v", user.TelegramID, err)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleTrialAbuseCommand обрабатывает команду /trialabuse - список связанных пробных аккаунтов на проверке
+func handleTrialAbuseCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	log.Printf("HANDLE_MESSAGE: Выполнение команды /trialabuse для TelegramID=%d", message.From.ID)
+
+	if message.From.ID != common.ADMIN_ID {
+		log.Printf("HANDLE_MESSAGE: Пользователь TelegramID=%d не является админом для команды /trialabuse", message.From.ID)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	if !common.TRIAL_ABUSE_ENABLED {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "ℹ️ Поиск связанных пробных аккаунтов отключен (TRIAL_ABUSE_ENABLED)"))
+		return
+	}
+
+	cases, err := common.GetPendingTrialAbuseCases(20)
+	if err != nil {
+		log.Printf("HANDLE_MESSAGE: Ошибка получения проверок пробных аккаунтов: %v", err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "❌ Ошибка получения проверок"))
+		return
+	}
+
+	if len(cases) == 0 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "✅ Связанных пробных аккаунтов на проверке нет"))
+		return
+	}
+
+	for _, abuseCase := range cases {
+		msg := tgbotapi.NewMessage(message.Chat.ID, common.TrialAbuseCaseText(abuseCase))
+		msg.ReplyMarkup = common.TrialAbuseKeyboard(abuseCase.ID)
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("HANDLE_MESSAGE: Ошибка отправки проверки #%d: %v", abuseCase.ID, err)
+		}
+	}
+}
+
+// handleTrialAbuseCallback обрабатывает решение администратора по связанным пробным аккаунтам
+func handleTrialAbuseCallback(bot *tgbotapi.BotAPI, chatID int64, messageID int, data string, callback *tgbotapi.CallbackQuery) {
+	if callback.From.ID != common.ADMIN_ID {
+		bot.Request(tgbotapi.NewCallback(callback.ID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	var status, idText string
+	switch {
+	case strings.HasPrefix(data, "trial_abuse_revoke:"):
+		status, idText = common.TrialAbuseRevoked, strings.TrimPrefix(data, "trial_abuse_revoke:")
+	case strings.HasPrefix(data, "trial_abuse_block:"):
+		status, idText = common.TrialAbuseBlocked, strings.TrimPrefix(data, "trial_abuse_block:")
+	default:
+		status, idText = common.TrialAbuseDismissed, strings.TrimPrefix(data, "trial_abuse_ok:")
+	}
+
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil {
+		bot.Request(tgbotapi.NewCallback(callback.ID, "❌ Неверная проверка"))
+		return
+	}
+
+	abuseCase, err := common.ResolveTrialAbuseCase(id, status, callback.From.ID)
+	if err != nil {
+		log.Printf("HANDLE_CALLBACK: Ошибка решения по проверке #%d: %v", id, err)
+		bot.Request(tgbotapi.NewCallback(callback.ID, ""))
+		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	bot.Request(tgbotapi.NewCallback(callback.ID, "✅ Решение сохранено"))
+	if _, err := bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, common.TrialAbuseCaseText(abuseCase))); err != nil {
+		log.Printf("HANDLE_CALLBACK: Ошибка обновления проверки #%d: %v", id, err)
+	}
+}
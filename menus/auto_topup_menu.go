@@ -0,0 +1,68 @@
+package menus
+
+import (
+	"fmt"
+	"log"
+
+	"bot/common"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// EditAutoTopup отображает настройки автопополнения и управление картой
+func EditAutoTopup(bot *tgbotapi.BotAPI, chatID int64, messageID int, settings *paymentCommon.AutoTopupSettings) {
+	log.Printf("EDIT_AUTO_TOPUP: Отображение автопополнения для ChatID=%d, MessageID=%d", chatID, messageID)
+
+	text := fmt.Sprintf("🔄 <b>Автопополнение</b>\n\n"+
+		"Когда баланс опустится ниже %.0f₽, мы автоматически спишем %d₽ с привязанной карты, "+
+		"и доступ к VPN не прервется.\n\n", common.AUTO_TOPUP_THRESHOLD, common.AUTO_TOPUP_AMOUNT)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	if !settings.HasCard() {
+		text += "💳 Карта не привязана.\n\n" +
+			fmt.Sprintf("Для привязки оплатите %d₽ - сумма поступит на баланс, а карта сохранится для автопополнения.",
+				common.AUTO_TOPUP_AMOUNT)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("💳 Привязать карту (%d₽)", common.AUTO_TOPUP_AMOUNT), "autotopup_link"),
+		))
+	} else {
+		status := "✅ включено"
+		toggleText := "⏸ Выключить"
+		if !settings.Enabled {
+			status = "⏸ выключено"
+			toggleText = "▶️ Включить"
+		}
+
+		text += fmt.Sprintf("💳 Карта: %s\n📊 Статус: %s", settings.CardTitle, status)
+		if settings.FailedAttempts > 0 && settings.Enabled {
+			text += fmt.Sprintf("\n⚠️ Неудачных попыток: %d", settings.FailedAttempts)
+			if settings.NextAttemptAt != nil {
+				text += fmt.Sprintf("\n🕐 Следующая попытка: %s", settings.NextAttemptAt.Format("02.01.2006 15:04"))
+			}
+		}
+
+		rows = append(rows,
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(toggleText, "autotopup_toggle"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🔁 Сменить карту", "autotopup_link"),
+				tgbotapi.NewInlineKeyboardButtonData("🗑 Отвязать карту", "autotopup_remove"),
+			),
+		)
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "balance"),
+	))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	editMsg.ParseMode = tgbotapi.ModeHTML
+	editMsg.ReplyMarkup = &keyboard
+	if _, err := bot.Send(editMsg); err != nil {
+		log.Printf("EDIT_AUTO_TOPUP: Ошибка редактирования сообщения для ChatID=%d: %v", chatID, err)
+	}
+}
@@ -41,6 +41,20 @@ func EditBalance(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *common
 			tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
 		),
 	)
+	if common.YUKASSA_RECEIPT_ENABLED {
+		keyboard.InlineKeyboard = append([][]tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🧾 Чеки", "receipts"),
+			),
+		}, keyboard.InlineKeyboard...)
+	}
+	if common.AUTO_TOPUP_ENABLED {
+		keyboard.InlineKeyboard = append([][]tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🔄 Автопополнение", "autotopup"),
+			),
+		}, keyboard.InlineKeyboard...)
+	}
 
 	// Рассчитываем потраченные деньги как разность между пополнениями и текущим балансом
 	spent := user.TotalPaid - user.Balance
@@ -0,0 +1,99 @@
+package menus
+
+import (
+	"fmt"
+	"log"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// EditLocations показывает выбор локации (сервера) пользователя
+func EditLocations(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *common.User) {
+	loads, err := common.GetServerLoads()
+	if err != nil {
+		log.Printf("EDIT_LOCATIONS: Ошибка получения серверов для TelegramID=%d: %v", user.TelegramID, err)
+		loads = nil
+	}
+
+	currentID := common.GetUserServerID(user.TelegramID)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	currentLocation := common.DEFAULT_SERVER_LOCATION
+	for _, load := range loads {
+		if load.Server.ID == currentID {
+			currentLocation = load.Server.Location
+		}
+		if !load.Server.Enabled {
+			continue
+		}
+
+		label := load.Server.Location
+		switch {
+		case load.Server.ID == currentID:
+			label = "✅ " + label
+		case load.IsFull():
+			label += " (нет мест)"
+		case common.IsServerDown(load.Server.ID):
+			label += " (недоступна)"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, "location:"+load.Server.ID)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔐 VPN", "vpn"),
+		tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
+	))
+
+	text := fmt.Sprintf("🌍 Выбор локации\n\n"+
+		"📍 Текущая локация: %s\n\n"+
+		"При смене локации конфиг переносится на другой сервер, оставшийся срок сохраняется.", currentLocation)
+	if common.IsConfigActive(user) && common.SUBSCRIPTION_ENABLED {
+		text += "\n\n⚠️ Ссылка подписки не изменится, но после смены обновите подписку в приложении."
+	} else if common.IsConfigActive(user) {
+		text += "\n\n⚠️ После смены ссылка подписки изменится - обновите подписку в приложении."
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	editMsg.ReplyMarkup = &keyboard
+	if _, err := bot.Send(editMsg); err != nil {
+		log.Printf("EDIT_LOCATIONS: Ошибка редактирования сообщения для TelegramID=%d, MessageID=%d: %v", user.TelegramID, messageID, err)
+	}
+}
+
+// withLocationButton добавляет кнопку выбора локации перед кнопкой поддержки, если доступно больше одной локации
+func withLocationButton(keyboard tgbotapi.InlineKeyboardMarkup, user *common.User) tgbotapi.InlineKeyboardMarkup {
+	if len(keyboard.InlineKeyboard) == 0 {
+		return keyboard
+	}
+
+	loads, err := common.GetServerLoads()
+	if err != nil {
+		log.Printf("EDIT_VPN: Ошибка получения серверов: %v", err)
+		return keyboard
+	}
+
+	enabled := 0
+	location := common.DEFAULT_SERVER_LOCATION
+	currentID := common.GetUserServerID(user.TelegramID)
+	for _, load := range loads {
+		if load.Server.Enabled {
+			enabled++
+		}
+		if load.Server.ID == currentID {
+			location = load.Server.Location
+		}
+	}
+	if enabled < 2 {
+		return keyboard
+	}
+
+	last := len(keyboard.InlineKeyboard) - 1
+	rows := append([][]tgbotapi.InlineKeyboardButton{}, keyboard.InlineKeyboard[:last]...)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🌍 Локация: "+location, "location")))
+	rows = append(rows, keyboard.InlineKeyboard[last])
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
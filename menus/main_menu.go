@@ -17,7 +17,7 @@ func SendMainMenu(bot *tgbotapi.BotAPI, chatID int64, user *common.User) {
 
 	if common.IsConfigActive(user) {
 		// Используем HTML редирект страницу
-		subscriptionURL := common.CONFIG_BASE_URL + user.SubID
+		subscriptionURL := common.UserSubscriptionURL(user)
 		redirectURL := common.GetRedirectURL() + subscriptionURL
 
 		if common.TARIFF_MODE_ENABLED {
@@ -179,6 +179,7 @@ func SendMainMenu(bot *tgbotapi.BotAPI, chatID int64, user *common.User) {
 
 	log.Printf("SEND_MAIN_MENU: Текст меню для TelegramID=%d: %s", user.TelegramID, text)
 
+	keyboard = withGiftButton(keyboard)
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ReplyMarkup = &keyboard
 	if _, err := bot.Send(msg); err != nil {
@@ -194,7 +195,7 @@ func EditMainMenu(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *commo
 
 	if common.IsConfigActive(user) {
 		// Используем HTML редирект страницу
-		subscriptionURL := common.CONFIG_BASE_URL + user.SubID
+		subscriptionURL := common.UserSubscriptionURL(user)
 		redirectURL := common.GetRedirectURL() + subscriptionURL
 
 		if common.TARIFF_MODE_ENABLED {
@@ -356,9 +357,24 @@ func EditMainMenu(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *commo
 
 	log.Printf("EDIT_MAIN_MENU: Текст меню для TelegramID=%d: %s", user.TelegramID, text)
 
+	keyboard = withGiftButton(keyboard)
 	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
 	editMsg.ReplyMarkup = &keyboard
 	if _, err := bot.Send(editMsg); err != nil {
 		log.Printf("EDIT_MAIN_MENU: Ошибка редактирования сообщения для TelegramID=%d, MessageID=%d: %v", user.TelegramID, messageID, err)
 	}
 }
+
+// withGiftButton добавляет кнопку "🎁 Подарить" перед кнопкой поддержки
+func withGiftButton(keyboard tgbotapi.InlineKeyboardMarkup) tgbotapi.InlineKeyboardMarkup {
+	if !common.GIFTS_ENABLED || len(keyboard.InlineKeyboard) == 0 {
+		return keyboard
+	}
+
+	last := len(keyboard.InlineKeyboard) - 1
+	rows := append([][]tgbotapi.InlineKeyboardButton{}, keyboard.InlineKeyboard[:last]...)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🎁 Подарить", "gift")))
+	rows = append(rows, keyboard.InlineKeyboard[last])
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
@@ -0,0 +1,108 @@
+package menus
+
+import (
+	"fmt"
+	"log"
+
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// EditReceipts отображает контакт для чеков и последние чеки пользователя
+func EditReceipts(bot *tgbotapi.BotAPI, chatID int64, messageID int, contact *paymentCommon.ReceiptContact, receipts []*paymentCommon.PaymentReceipt) {
+	log.Printf("EDIT_RECEIPTS: Отображение чеков для ChatID=%d, MessageID=%d", chatID, messageID)
+
+	text := "🧾 <b>Чеки</b>\n\n"
+	if contact.IsEmpty() {
+		text += "📭 Контакт для чеков не указан.\n"
+	} else {
+		if contact.Email != "" {
+			text += fmt.Sprintf("📧 Email: %s\n", contact.Email)
+		}
+		if contact.Phone != "" {
+			text += fmt.Sprintf("📱 Телефон: +%s\n", contact.Phone)
+		}
+	}
+	text += "\nЧтобы получать чеки на почту или по SMS, отправьте:\n" +
+		"<code>/receipt email@example.com</code> или <code>/receipt +79001234567</code>\n" +
+		"Удалить контакт: <code>/receipt off</code>\n\n"
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(receipts) == 0 {
+		text += "Чеков пока нет."
+	} else {
+		text += "Последние чеки:"
+		for _, receipt := range receipts {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(
+					fmt.Sprintf("%s • %.2f₽ • %s", receipt.CreatedAt.Format("02.01.2006"), receipt.Amount,
+						paymentCommon.GetReceiptStatusDescription(receipt.Status)),
+					"receipt:"+receipt.PaymentID),
+			))
+		}
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "balance"),
+	))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	editMsg.ParseMode = tgbotapi.ModeHTML
+	editMsg.ReplyMarkup = &keyboard
+	if _, err := bot.Send(editMsg); err != nil {
+		log.Printf("EDIT_RECEIPTS: Ошибка редактирования сообщения для ChatID=%d: %v", chatID, err)
+	}
+}
+
+// EditReceiptDetails отображает подробности чека
+func EditReceiptDetails(bot *tgbotapi.BotAPI, chatID int64, messageID int, receipt *paymentCommon.PaymentReceipt) {
+	log.Printf("EDIT_RECEIPTS: Отображение чека %s для ChatID=%d", receipt.PaymentID, chatID)
+
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, FormatReceipt(receipt))
+	editMsg.ParseMode = tgbotapi.ModeHTML
+	keyboard := receiptDetailsKeyboard(receipt)
+	editMsg.ReplyMarkup = &keyboard
+	if _, err := bot.Send(editMsg); err != nil {
+		log.Printf("EDIT_RECEIPTS: Ошибка редактирования сообщения для ChatID=%d: %v", chatID, err)
+	}
+}
+
+// FormatReceipt форматирует чек для отправки пользователю
+func FormatReceipt(receipt *paymentCommon.PaymentReceipt) string {
+	text := fmt.Sprintf("🧾 <b>Кассовый чек</b>\n\n"+
+		"📅 Дата: %s\n"+
+		"📦 %s\n"+
+		"💰 Сумма: %.2f₽\n"+
+		"🏷 НДС: %s\n"+
+		"📊 Статус: %s\n",
+		receipt.CreatedAt.Format("02.01.2006 15:04"),
+		receipt.Description,
+		receipt.Amount,
+		paymentCommon.GetVATDescription(receipt.VATCode),
+		paymentCommon.GetReceiptStatusDescription(receipt.Status))
+
+	if receipt.Email != "" {
+		text += fmt.Sprintf("📧 Отправлен на: %s\n", receipt.Email)
+	} else if receipt.Phone != "" {
+		text += fmt.Sprintf("📱 Отправлен на: +%s\n", receipt.Phone)
+	}
+	if receipt.FiscalInfo != "" {
+		text += fmt.Sprintf("\n🔐 %s\n", receipt.FiscalInfo)
+	}
+
+	return text + fmt.Sprintf("\n🆔 <code>%s</code>", receipt.PaymentID)
+}
+
+// receiptDetailsKeyboard создает клавиатуру для просмотра чека
+func receiptDetailsKeyboard(receipt *paymentCommon.PaymentReceipt) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📨 Отправить повторно", "receipt_resend:"+receipt.PaymentID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ К чекам", "receipts"),
+		),
+	)
+}
@@ -0,0 +1,106 @@
+package menus
+
+import (
+	"fmt"
+	"log"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// usageChartDays за сколько дней показывать график трафика
+const usageChartDays = 30
+
+// SendTrafficUsage отправляет трафик пользователя за сегодня, неделю и месяц с графиком по дням.
+// Фото нельзя получить редактированием текстового сообщения, поэтому экран отправляется новым сообщением.
+func SendTrafficUsage(bot *tgbotapi.BotAPI, chatID int64, user *common.User) {
+	log.Printf("SEND_TRAFFIC_USAGE: Отображение трафика для TelegramID=%d", user.TelegramID)
+
+	packRows := trafficPackRows()
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(append(packRows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔐 Конфиг", "vpn"),
+			tgbotapi.NewInlineKeyboardButtonData("🏠 Главная", "main"),
+		),
+	)...)
+
+	summary, err := common.GetTrafficUsageSummary(user.TelegramID)
+	if err != nil {
+		log.Printf("SEND_TRAFFIC_USAGE: Ошибка получения трафика для TelegramID=%d: %v", user.TelegramID, err)
+		msg := tgbotapi.NewMessage(chatID, "❌ Не удалось получить статистику трафика, попробуйте позже")
+		msg.ReplyMarkup = keyboard
+		bot.Send(msg)
+		return
+	}
+
+	text := "📊 Ваш трафик\n\n" + common.FormatTrafficUsage(summary)
+
+	days, err := common.GetDailyTraffic(user.TelegramID, usageChartDays)
+	if err != nil {
+		log.Printf("SEND_TRAFFIC_USAGE: Ошибка получения истории трафика для TelegramID=%d: %v", user.TelegramID, err)
+	}
+
+	var total int64
+	for _, day := range days {
+		total += day.Bytes
+	}
+	if total == 0 {
+		// Без истории график пустой - отправляем только текст
+		msg := tgbotapi.NewMessage(chatID, text+"\nИстория появится после первого использования VPN.")
+		msg.ReplyMarkup = keyboard
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("SEND_TRAFFIC_USAGE: Ошибка отправки сообщения для TelegramID=%d: %v", user.TelegramID, err)
+		}
+		return
+	}
+
+	chart, err := common.RenderTrafficChart(days)
+	if err != nil {
+		log.Printf("SEND_TRAFFIC_USAGE: Ошибка построения графика для TelegramID=%d: %v", user.TelegramID, err)
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ReplyMarkup = keyboard
+		bot.Send(msg)
+		return
+	}
+
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: "traffic.png", Bytes: chart})
+	// Без кнопок меню: меню редактируют текстовые сообщения, а это фото.
+	// Кнопки пакетов трафика отправляют подтверждение новым сообщением.
+	photo.Caption = text + fmt.Sprintf("\n📈 По дням за %d дней: %s", usageChartDays, common.FormatTrafficBytes(total))
+	if len(packRows) > 0 {
+		photo.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(packRows...)
+	}
+	if _, err := bot.Send(photo); err != nil {
+		log.Printf("SEND_TRAFFIC_USAGE: Ошибка отправки графика для TelegramID=%d: %v", user.TelegramID, err)
+	}
+}
+
+// trafficPackRows возвращает кнопки покупки пакетов трафика или nil, если пакеты не продаются
+func trafficPackRows() [][]tgbotapi.InlineKeyboardButton {
+	if !common.TrafficPacksAvailable() {
+		return nil
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, pack := range common.TRAFFIC_PACKS {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("➕ %d ГБ — %d₽", pack.GB, pack.Price), fmt.Sprintf("traffic_pack:%d", pack.GB)),
+		))
+	}
+	return rows
+}
+
+// withUsageButton добавляет кнопку статистики трафика перед последней строкой клавиатуры
+func withUsageButton(keyboard tgbotapi.InlineKeyboardMarkup) tgbotapi.InlineKeyboardMarkup {
+	if len(keyboard.InlineKeyboard) == 0 {
+		return keyboard
+	}
+
+	last := len(keyboard.InlineKeyboard) - 1
+	rows := append([][]tgbotapi.InlineKeyboardButton{}, keyboard.InlineKeyboard[:last]...)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("📊 Трафик", "traffic_usage")))
+	rows = append(rows, keyboard.InlineKeyboard[last])
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"bot/common"
+	"bot/payments/promo"
+	"bot/subscription"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -17,7 +19,7 @@ func EditVPN(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *common.Use
 	if common.IsConfigActive(user) {
 		log.Printf("EDIT_VPN: Конфиг активен для TelegramID=%d, ExpiryTime=%s", user.TelegramID, time.UnixMilli(user.ExpiryTime).Format("02.01.2006 15:04"))
 
-		subscriptionURL := common.CONFIG_BASE_URL + user.SubID
+		subscriptionURL := common.UserSubscriptionURL(user)
 		redirectURL := common.GetRedirectURL() + subscriptionURL
 
 		var keyboard tgbotapi.InlineKeyboardMarkup
@@ -48,6 +50,8 @@ func EditVPN(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *common.Use
 			)
 		}
 
+		keyboard = withLocationButton(withFamilyButton(withUsageButton(keyboard)), user)
+
 		expiryDate := common.FormatRussianDateTimeFromUnix(user.ExpiryTime)
 
 		// Получаем информацию о лимитах трафика
@@ -57,6 +61,7 @@ func EditVPN(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *common.Use
 			"📅 Активен до: %s\n"+
 			"📊 Лимиты трафика: %s\n"+
 			"🔗 Ссылка на подписку:\n`%s`\n\n"+
+			"%s"+
 			"💡 Нажмите 'Подключить (%s)' для автоматического импорта\n\n"+
 			"📱 Приложения для самостоятельного импорта:\n"+
 			"• Android: v2rayng, Hiddify, v2box\n"+
@@ -66,7 +71,7 @@ func EditVPN(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *common.Use
 			"• Роутеры: xkeen (Keenetic), OpenWrt\n"+
 			"• ТВ: v2raytun, Happ\n\n"+
 			"Если у вас возникли вопросы, вы можете обратиться за помощью к нашей поддержке.",
-			expiryDate, trafficInfo, subscriptionURL, common.GetAppName())
+			expiryDate, trafficInfo, subscriptionURL, subscriptionFormatsText(subscriptionURL), common.GetAppName())
 
 		log.Printf("EDIT_VPN: Текст для активного конфига для TelegramID=%d: %s", user.TelegramID, text)
 		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
@@ -123,6 +128,8 @@ func EditVPN(bot *tgbotapi.BotAPI, chatID int64, messageID int, user *common.Use
 				user.Balance, common.PRICE_PER_DAY, int(user.Balance/float64(common.PRICE_PER_DAY)))
 		}
 
+		keyboard = withLocationButton(withFamilyButton(keyboard), user)
+
 		log.Printf("EDIT_VPN: Текст для неактивного конфига для TelegramID=%d: %s", user.TelegramID, text)
 		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
 		editMsg.ReplyMarkup = &keyboard
@@ -181,11 +188,21 @@ func EditPayment(bot *tgbotapi.BotAPI, chatID int64, messageID int, days int) {
 	trafficLimit := common.CalculateTrafficLimit(days)
 	trafficInfo := common.FormatTrafficLimit(trafficLimit)
 
+	// Показываем цену со скидкой по активированному промокоду (в личном чате chatID совпадает с TelegramID)
+	discountText := ""
+	if promo.GlobalPromoManager != nil {
+		discount := promo.GlobalPromoManager.GetCheckoutDiscount(chatID, promo.PromoCheckout{Plan: promo.PromoPlanForDays(days), Amount: cost})
+		if discount != nil {
+			discountText = fmt.Sprintf("🎟 Со скидкой %.0f%%: %.2f₽\n", discount.Percent, cost-discount.Amount)
+		}
+	}
+
 	text := fmt.Sprintf("💳 Подтверждение оплаты\n\n"+
 		"📅 Период: %d %s\n"+
 		"💰 Стоимость: %.0f₽\n"+
+		"%s"+
 		"📊 Лимит трафика: %s\n\n"+
-		"Подтвердите оплату:", days, common.GetDaysWord(days), cost, trafficInfo)
+		"Подтвердите оплату:", days, common.GetDaysWord(days), cost, discountText, trafficInfo)
 
 	log.Printf("EDIT_PAYMENT: Текст для оплаты ChatID=%d: %s", chatID, text)
 	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
@@ -194,3 +211,32 @@ func EditPayment(bot *tgbotapi.BotAPI, chatID int64, messageID int, days int) {
 		log.Printf("EDIT_PAYMENT: Ошибка редактирования сообщения для ChatID=%d, MessageID=%d: %v", chatID, messageID, err)
 	}
 }
+
+// withFamilyButton добавляет кнопку "👨‍👩‍👧 Семья" перед кнопкой поддержки
+func withFamilyButton(keyboard tgbotapi.InlineKeyboardMarkup) tgbotapi.InlineKeyboardMarkup {
+	if !common.FAMILY_PLANS_ENABLED || len(keyboard.InlineKeyboard) == 0 {
+		return keyboard
+	}
+
+	last := len(keyboard.InlineKeyboard) - 1
+	rows := append([][]tgbotapi.InlineKeyboardButton{}, keyboard.InlineKeyboard[:last]...)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("👨‍👩‍👧 Семья", "family")))
+	rows = append(rows, keyboard.InlineKeyboard[last])
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// subscriptionFormatsText возвращает ссылки на подписку в форматах Clash, sing-box и Xray,
+// если бот сам отдает подписку
+func subscriptionFormatsText(subscriptionURL string) string {
+	if !common.SUBSCRIPTION_ENABLED {
+		return ""
+	}
+	return fmt.Sprintf("🧩 Для других приложений:\n"+
+		"• Clash Meta, Mihomo: `%s`\n"+
+		"• sing-box: `%s`\n"+
+		"• Xray JSON: `%s`\n\n",
+		subscription.FormatURL(subscriptionURL, subscription.FormatClash),
+		subscription.FormatURL(subscriptionURL, subscription.FormatSingBox),
+		subscription.FormatURL(subscriptionURL, subscription.FormatXray))
+}
@@ -0,0 +1,206 @@
+package payments
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"bot/common"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// autoTopupPendingDelay время ожидания подтверждения автоплатежа, находящегося в обработке
+const autoTopupPendingDelay = 30 * time.Minute
+
+// autoTopupMaxRetryDelay максимальная задержка повтора после неудачных автоплатежей
+const autoTopupMaxRetryDelay = 7 * 24 * time.Hour
+
+// IsAutoTopupAvailable проверяет, доступно ли автопополнение (нужен прямой API ЮКассы)
+func (pm *PaymentManager) IsAutoTopupAvailable() bool {
+	return common.AUTO_TOPUP_ENABLED && pm.yookassaProvider != nil && pm.yookassaProvider.IsEnabled()
+}
+
+// ProcessCardLinkRequest создает платеж на сумму автопополнения с сохранением карты
+func (pm *PaymentManager) ProcessCardLinkRequest(userID int64, chatID int64) error {
+	if !pm.IsAutoTopupAvailable() {
+		return fmt.Errorf("автопополнение недоступно")
+	}
+
+	user, err := common.GetUserByTelegramID(userID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения пользователя: %v", err)
+	}
+
+	amount := float64(common.AUTO_TOPUP_AMOUNT)
+	description := fmt.Sprintf("Пополнение баланса на %.2f₽ с привязкой карты", amount)
+
+	paymentInfo, err := pm.yookassaProvider.CreatePaymentWithCardSaving(userID, amount, description)
+	if err != nil {
+		return fmt.Errorf("ошибка создания платежа: %v", err)
+	}
+
+	if paymentInfo.PaymentURL == "" {
+		return fmt.Errorf("URL для оплаты не получен")
+	}
+
+	if err := pm.sendYooKassaPaymentLink(chatID, paymentInfo, user); err != nil {
+		return fmt.Errorf("ошибка отправки ссылки на оплату: %v", err)
+	}
+
+	if pm.onDemandService != nil {
+		pm.onDemandService.StartPaymentMonitoring(paymentInfo.ID, paymentInfo.UserID, paymentInfo.Amount)
+	}
+
+	log.Printf("AUTO_TOPUP: Создан платеж %s с привязкой карты для пользователя %d", paymentInfo.ID, userID)
+	return nil
+}
+
+// ChargeAutoTopup списывает сумму автопополнения с сохраненной карты пользователя.
+// Возвращает true, если баланс пополнен.
+func (pm *PaymentManager) ChargeAutoTopup(userID int64) (bool, error) {
+	if !pm.IsAutoTopupAvailable() {
+		return false, nil
+	}
+
+	// Сервис автопополнения и автосписание могут списывать одновременно - списывает только захвативший
+	settings, err := paymentCommon.ClaimAutoTopup(userID)
+	if err != nil {
+		return false, err
+	}
+	if settings == nil {
+		return false, nil
+	}
+	keepClaim := false
+	defer func() {
+		if keepClaim {
+			return
+		}
+		if err := paymentCommon.ReleaseAutoTopup(userID); err != nil {
+			log.Printf("AUTO_TOPUP: %v", err)
+		}
+	}()
+
+	amount := float64(common.AUTO_TOPUP_AMOUNT)
+	description := fmt.Sprintf("Автопополнение баланса на %.2f₽", amount)
+
+	paymentInfo, err := pm.yookassaProvider.ChargeSavedPaymentMethod(userID, settings.PaymentMethodID, amount, description, settings.Attempt)
+	if err != nil {
+		pm.handleAutoTopupFailure(settings, err.Error(), "")
+		return false, err
+	}
+
+	switch paymentInfo.Status {
+	case paymentCommon.PaymentStatusSucceeded:
+		if _, err := paymentCommon.CreditPayment(paymentInfo, "auto_topup"); err != nil {
+			// Деньги с карты уже списаны: захват не освобождается, чтобы повтор использовал тот же
+			// номер списания и ключ идемпотентности - провайдер вернет этот же платеж, и он будет зачислен
+			keepClaim = true
+			if postponeErr := paymentCommon.PostponeAutoTopup(userID, time.Now().Add(autoTopupPendingDelay)); postponeErr != nil {
+				log.Printf("AUTO_TOPUP: %v", postponeErr)
+			}
+			log.Printf("AUTO_TOPUP: Автоплатеж %s пользователя %d списан, но не зачислен: %v", paymentInfo.ID, userID, err)
+			return false, err
+		}
+		if err := paymentCommon.RecordAutoTopupSuccess(userID); err != nil {
+			log.Printf("AUTO_TOPUP: %v", err)
+		}
+		pm.notifyAutoTopupSuccess(userID, paymentInfo.Amount, settings.CardTitle)
+		log.Printf("AUTO_TOPUP: Баланс пользователя %d автоматически пополнен на %.2f₽", userID, paymentInfo.Amount)
+		return true, nil
+
+	case paymentCommon.PaymentStatusPending:
+		// Платеж в обработке - зачисление придет через webhook, повторно не списываем
+		if err := paymentCommon.PostponeAutoTopup(userID, time.Now().Add(autoTopupPendingDelay)); err != nil {
+			log.Printf("AUTO_TOPUP: %v", err)
+		}
+		log.Printf("AUTO_TOPUP: Автоплатеж %s пользователя %d в обработке", paymentInfo.ID, userID)
+		return false, nil
+
+	default:
+		reason, _ := paymentInfo.Metadata[paymentCommon.MetadataCancellationReason].(string)
+		pm.handleAutoTopupFailure(settings, fmt.Sprintf("платеж отклонен (%s)", reason), reason)
+		return false, fmt.Errorf("автоплатеж %s отклонен: %s", paymentInfo.ID, reason)
+	}
+}
+
+// handleAutoTopupFailure фиксирует неудачу, назначает повтор с экспоненциальной задержкой и уведомляет пользователя
+func (pm *PaymentManager) handleAutoTopupFailure(settings *paymentCommon.AutoTopupSettings, lastError, cancellationReason string) {
+	userID := settings.UserID
+	failedAttempts := settings.FailedAttempts + 1
+
+	// Пользователь отозвал разрешение на автоплатежи - карту использовать больше нельзя
+	if cancellationReason == "permission_revoked" {
+		if err := paymentCommon.RemoveAutoTopupCard(userID); err != nil {
+			log.Printf("AUTO_TOPUP: %v", err)
+		}
+		pm.notifyAutoTopup(userID, "⚠️ <b>Автопополнение отключено</b>\n\n"+
+			"Разрешение на списания с карты отозвано, карта отвязана.\n"+
+			"Привязать карту заново можно в разделе «Баланс».")
+		return
+	}
+
+	disable := failedAttempts >= common.AUTO_TOPUP_MAX_ATTEMPTS
+	nextAttemptAt := time.Now().Add(autoTopupRetryDelay(failedAttempts))
+
+	if err := paymentCommon.RecordAutoTopupFailure(userID, failedAttempts, nextAttemptAt, lastError, disable); err != nil {
+		log.Printf("AUTO_TOPUP: %v", err)
+	}
+
+	log.Printf("AUTO_TOPUP: Неудачное автопополнение для пользователя %d (попытка %d/%d): %s",
+		userID, failedAttempts, common.AUTO_TOPUP_MAX_ATTEMPTS, lastError)
+
+	if disable {
+		pm.notifyAutoTopup(userID, fmt.Sprintf("⚠️ <b>Автопополнение отключено</b>\n\n"+
+			"Не удалось списать %d₽ с карты %s после %d попыток.\n"+
+			"Проверьте карту и включите автопополнение снова в разделе «Баланс» или пополните баланс вручную.",
+			common.AUTO_TOPUP_AMOUNT, settings.CardTitle, failedAttempts))
+		return
+	}
+
+	pm.notifyAutoTopup(userID, fmt.Sprintf("⚠️ <b>Не удалось выполнить автопополнение</b>\n\n"+
+		"Списание %d₽ с карты %s не прошло.\n"+
+		"Следующая попытка: %s.\n\n"+
+		"Чтобы не потерять доступ к VPN, можно пополнить баланс вручную.",
+		common.AUTO_TOPUP_AMOUNT, settings.CardTitle, nextAttemptAt.Format("02.01.2006 15:04")))
+}
+
+// autoTopupRetryDelay возвращает задержку повтора после failedAttempts неудач подряд:
+// базовая задержка удваивается с каждой неудачей, но не превышает autoTopupMaxRetryDelay
+func autoTopupRetryDelay(failedAttempts int) time.Duration {
+	delay := time.Duration(common.AUTO_TOPUP_RETRY_BASE_MINUTES) * time.Minute
+	for i := 1; i < failedAttempts && delay < autoTopupMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > autoTopupMaxRetryDelay {
+		delay = autoTopupMaxRetryDelay
+	}
+	return delay
+}
+
+// notifyAutoTopupSuccess уведомляет пользователя об успешном автопополнении
+func (pm *PaymentManager) notifyAutoTopupSuccess(userID int64, amount float64, cardTitle string) {
+	text := fmt.Sprintf("✅ <b>Баланс автоматически пополнен</b>\n\n"+
+		"💰 Сумма: %.2f₽\n"+
+		"💳 Карта: %s", amount, cardTitle)
+
+	if user, err := common.GetUserByTelegramID(userID); err == nil {
+		text += fmt.Sprintf("\n💼 Баланс: %.2f₽", user.Balance)
+	}
+
+	pm.notifyAutoTopup(userID, text)
+}
+
+// notifyAutoTopup отправляет пользователю уведомление об автопополнении
+func (pm *PaymentManager) notifyAutoTopup(userID int64, text string) {
+	if common.GlobalBot == nil {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(userID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		log.Printf("AUTO_TOPUP: Ошибка отправки уведомления пользователю %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,32 @@
+package payments
+
+import (
+	"testing"
+	"time"
+
+	"bot/common"
+)
+
+func TestAutoTopupRetryDelay(t *testing.T) {
+	original := common.AUTO_TOPUP_RETRY_BASE_MINUTES
+	common.AUTO_TOPUP_RETRY_BASE_MINUTES = 60
+	defer func() { common.AUTO_TOPUP_RETRY_BASE_MINUTES = original }()
+
+	tests := []struct {
+		failedAttempts int
+		expected       time.Duration
+	}{
+		{1, time.Hour},
+		{2, 2 * time.Hour},
+		{4, 8 * time.Hour},
+		// Задержка ограничена и не переполняется при большом числе неудач
+		{10, autoTopupMaxRetryDelay},
+		{100, autoTopupMaxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		if delay := autoTopupRetryDelay(tt.failedAttempts); delay != tt.expected {
+			t.Errorf("autoTopupRetryDelay(%d) = %v, ожидалось %v", tt.failedAttempts, delay, tt.expected)
+		}
+	}
+}
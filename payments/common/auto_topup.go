@@ -0,0 +1,378 @@
+package common
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Ключи метаданных платежа с информацией о сохраненном способе оплаты
+const (
+	MetadataSavedPaymentMethodID = "saved_payment_method_id"
+	MetadataPaymentMethodTitle   = "payment_method_title"
+	MetadataCancellationReason   = "cancellation_reason"
+	MetadataCardLink             = "card_link" // Платеж создан для привязки карты
+)
+
+// Состояния автопополнения
+const (
+	AutoTopupStateIdle     = "idle"
+	AutoTopupStateCharging = "charging" // Идет списание с карты
+)
+
+// autoTopupChargingTimeout через сколько зависшее списание можно повторить с тем же ключом идемпотентности
+const autoTopupChargingTimeout = "15 minutes"
+
+// AutoTopupSettings настройки автопополнения пользователя
+type AutoTopupSettings struct {
+	UserID          int64
+	PaymentMethodID string
+	CardTitle       string
+	Enabled         bool
+	FailedAttempts  int
+	NextAttemptAt   *time.Time
+	LastError       string
+	UpdatedAt       time.Time
+	Attempt         int64 // Номер списания, заполняется ClaimAutoTopup
+}
+
+// HasCard проверяет, привязана ли карта
+func (s *AutoTopupSettings) HasCard() bool {
+	return s != nil && s.PaymentMethodID != ""
+}
+
+// IsDue проверяет, можно ли выполнять автопополнение сейчас (с учетом задержки после неудач)
+func (s *AutoTopupSettings) IsDue(now time.Time) bool {
+	if !s.Enabled || !s.HasCard() {
+		return false
+	}
+	return s.NextAttemptAt == nil || !s.NextAttemptAt.After(now)
+}
+
+// InitAutoTopup создает таблицу настроек автопополнения, если ее нет
+func InitAutoTopup() error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS auto_topup (
+		user_id BIGINT PRIMARY KEY,
+		payment_method_id VARCHAR(255),
+		card_title VARCHAR(100),
+		enabled BOOLEAN NOT NULL DEFAULT false,
+		failed_attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP WITH TIME ZONE,
+		last_error TEXT,
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);`
+
+	// Колонки добавлены позже - для существующих таблиц
+	alterSQL := `
+	ALTER TABLE auto_topup ADD COLUMN IF NOT EXISTS state VARCHAR(20) NOT NULL DEFAULT 'idle';
+	ALTER TABLE auto_topup ADD COLUMN IF NOT EXISTS state_changed_at TIMESTAMP WITH TIME ZONE;
+	ALTER TABLE auto_topup ADD COLUMN IF NOT EXISTS attempt BIGINT NOT NULL DEFAULT 0;`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы auto_topup: %v", err)
+	}
+
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("ошибка обновления таблицы auto_topup: %v", err)
+	}
+
+	return nil
+}
+
+// ClaimAutoTopup переводит автопополнение пользователя в состояние списания и возвращает его настройки.
+// Возвращает nil, если списание сейчас не нужно или его уже выполняет другой процесс.
+// Зависшее списание забирается с тем же номером попытки, чтобы провайдер не списал деньги второй раз.
+func ClaimAutoTopup(userID int64) (*AutoTopupSettings, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	var settings AutoTopupSettings
+	var cardTitle, lastError sql.NullString
+	var nextAttemptAt sql.NullTime
+	err := db.QueryRow(`
+		UPDATE auto_topup SET
+			attempt = CASE WHEN state = $2 THEN attempt + 1 ELSE attempt END,
+			state = $3,
+			state_changed_at = NOW()
+		WHERE user_id = $1 AND enabled = true AND payment_method_id IS NOT NULL
+			AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+			AND (state = $2 OR state_changed_at < NOW() - INTERVAL '`+autoTopupChargingTimeout+`')
+		RETURNING user_id, payment_method_id, card_title, enabled, failed_attempts, next_attempt_at, last_error, updated_at, attempt`,
+		userID, AutoTopupStateIdle, AutoTopupStateCharging).Scan(&settings.UserID, &settings.PaymentMethodID, &cardTitle, &settings.Enabled,
+		&settings.FailedAttempts, &nextAttemptAt, &lastError, &settings.UpdatedAt, &settings.Attempt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка захвата автопополнения: %v", err)
+	}
+
+	settings.CardTitle = cardTitle.String
+	settings.LastError = lastError.String
+	if nextAttemptAt.Valid {
+		settings.NextAttemptAt = &nextAttemptAt.Time
+	}
+	return &settings, nil
+}
+
+// ReleaseAutoTopup возвращает автопополнение в ожидание после списания
+func ReleaseAutoTopup(userID int64) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec(`UPDATE auto_topup SET state = $2, state_changed_at = NOW() WHERE user_id = $1`,
+		userID, AutoTopupStateIdle)
+	if err != nil {
+		return fmt.Errorf("ошибка освобождения автопополнения: %v", err)
+	}
+
+	return nil
+}
+
+// GetAutoTopupSettings возвращает настройки автопополнения пользователя (nil, если карта не привязывалась)
+func GetAutoTopupSettings(userID int64) (*AutoTopupSettings, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	row := db.QueryRow(`
+		SELECT user_id, payment_method_id, card_title, enabled, failed_attempts, next_attempt_at, last_error, updated_at
+		FROM auto_topup WHERE user_id = $1`, userID)
+
+	settings, err := scanAutoTopupSettings(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения настроек автопополнения: %v", err)
+	}
+
+	return settings, nil
+}
+
+// GetEnabledAutoTopups возвращает все включенные автопополнения с привязанной картой
+func GetEnabledAutoTopups() ([]*AutoTopupSettings, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query(`
+		SELECT user_id, payment_method_id, card_title, enabled, failed_attempts, next_attempt_at, last_error, updated_at
+		FROM auto_topup
+		WHERE enabled = true AND payment_method_id IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения автопополнений: %v", err)
+	}
+	defer rows.Close()
+
+	var result []*AutoTopupSettings
+	for rows.Next() {
+		settings, err := scanAutoTopupSettings(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения автопополнения: %v", err)
+		}
+		result = append(result, settings)
+	}
+
+	return result, rows.Err()
+}
+
+// SaveAutoTopupCard привязывает сохраненный способ оплаты и включает автопополнение
+func SaveAutoTopupCard(userID int64, paymentMethodID, cardTitle string) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO auto_topup (user_id, payment_method_id, card_title, enabled, failed_attempts, next_attempt_at, last_error, updated_at)
+		VALUES ($1, $2, $3, true, 0, NULL, NULL, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			payment_method_id = EXCLUDED.payment_method_id,
+			card_title = EXCLUDED.card_title,
+			enabled = true,
+			failed_attempts = 0,
+			next_attempt_at = NULL,
+			last_error = NULL,
+			updated_at = NOW()`,
+		userID, paymentMethodID, cardTitle)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения карты для автопополнения: %v", err)
+	}
+
+	return nil
+}
+
+// SetAutoTopupEnabled включает или выключает автопополнение (счетчик неудач сбрасывается)
+func SetAutoTopupEnabled(userID int64, enabled bool) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec(`
+		UPDATE auto_topup SET enabled = $2, failed_attempts = 0, next_attempt_at = NULL, updated_at = NOW()
+		WHERE user_id = $1`, userID, enabled)
+	if err != nil {
+		return fmt.Errorf("ошибка изменения автопополнения: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveAutoTopupCard отвязывает карту и выключает автопополнение
+func RemoveAutoTopupCard(userID int64) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	if _, err := db.Exec(`DELETE FROM auto_topup WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("ошибка удаления карты: %v", err)
+	}
+
+	return nil
+}
+
+// RecordAutoTopupSuccess сбрасывает счетчик неудач после успешного списания
+func RecordAutoTopupSuccess(userID int64) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec(`
+		UPDATE auto_topup SET failed_attempts = 0, next_attempt_at = NULL, last_error = NULL, updated_at = NOW()
+		WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления автопополнения: %v", err)
+	}
+
+	return nil
+}
+
+// RecordAutoTopupFailure фиксирует неудачное списание и время следующей попытки.
+// При disable=true автопополнение выключается.
+func RecordAutoTopupFailure(userID int64, failedAttempts int, nextAttemptAt time.Time, lastError string, disable bool) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec(`
+		UPDATE auto_topup SET
+			failed_attempts = $2,
+			next_attempt_at = $3,
+			last_error = $4,
+			enabled = enabled AND NOT $5,
+			updated_at = NOW()
+		WHERE user_id = $1`, userID, failedAttempts, nextAttemptAt, lastError, disable)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления автопополнения: %v", err)
+	}
+
+	return nil
+}
+
+// PostponeAutoTopup откладывает следующую попытку (например, пока платеж в обработке)
+func PostponeAutoTopup(userID int64, nextAttemptAt time.Time) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec(`UPDATE auto_topup SET next_attempt_at = $2, updated_at = NOW() WHERE user_id = $1`,
+		userID, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления автопополнения: %v", err)
+	}
+
+	return nil
+}
+
+// saveCardFromPayment привязывает карту, сохраненную при платеже привязки, и уведомляет пользователя.
+// Автоплатежи тоже несут ID сохраненной карты, но привязку не меняют.
+func saveCardFromPayment(paymentInfo *PaymentInfo) {
+	methodID, _ := paymentInfo.Metadata[MetadataSavedPaymentMethodID].(string)
+	if methodID == "" || !metadataFlag(paymentInfo.Metadata[MetadataCardLink]) {
+		return
+	}
+	title, _ := paymentInfo.Metadata[MetadataPaymentMethodTitle].(string)
+
+	if err := SaveAutoTopupCard(paymentInfo.UserID, methodID, title); err != nil {
+		log.Printf("AUTO_TOPUP: Ошибка привязки карты для пользователя %d: %v", paymentInfo.UserID, err)
+		return
+	}
+
+	log.Printf("AUTO_TOPUP: Карта %s привязана к пользователю %d", title, paymentInfo.UserID)
+
+	if common.GlobalBot == nil {
+		return
+	}
+
+	text := fmt.Sprintf("✅ <b>Карта привязана</b>\n\n"+
+		"💳 %s\n\n"+
+		"Автопополнение включено: когда баланс опустится ниже %.0f₽, "+
+		"мы спишем %d₽ с этой карты. Отключить его можно в разделе «Баланс».",
+		title, common.AUTO_TOPUP_THRESHOLD, common.AUTO_TOPUP_AMOUNT)
+
+	msg := tgbotapi.NewMessage(paymentInfo.UserID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		log.Printf("AUTO_TOPUP: Ошибка отправки уведомления о привязке карты пользователю %d: %v", paymentInfo.UserID, err)
+	}
+}
+
+// metadataFlag читает логический флаг метаданных: ЮКасса возвращает значения метаданных строками
+func metadataFlag(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// rowScanner общий интерфейс для sql.Row и sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAutoTopupSettings читает настройки автопополнения из строки результата
+func scanAutoTopupSettings(row rowScanner) (*AutoTopupSettings, error) {
+	var settings AutoTopupSettings
+	var methodID, cardTitle, lastError sql.NullString
+	var nextAttemptAt sql.NullTime
+
+	if err := row.Scan(&settings.UserID, &methodID, &cardTitle, &settings.Enabled,
+		&settings.FailedAttempts, &nextAttemptAt, &lastError, &settings.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	settings.PaymentMethodID = methodID.String
+	settings.CardTitle = cardTitle.String
+	settings.LastError = lastError.String
+	if nextAttemptAt.Valid {
+		settings.NextAttemptAt = &nextAttemptAt.Time
+	}
+
+	return &settings, nil
+}
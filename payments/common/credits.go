@@ -0,0 +1,357 @@
+package common
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"bot/common"
+)
+
+// Типы записей о зачислении
+const (
+	CreditKindPayment    = "credit"           // Зачисление по платежу
+	CreditKindAdjustment = "adjustment"       // Корректировка по итогам сверки
+	CreditKindDuplicate  = "credit_duplicate" // Повторное зачисление, сделанное до уникального индекса
+
+	CreditKindReferralTransfer = "referral_transfer" // Перевод реферального вознаграждения на баланс
+	CreditKindReferralPayout   = "referral_payout"   // Выплата реферального вознаграждения
+)
+
+// LedgerMethodReferral метод для записей реферального кошелька (не платежная система)
+const LedgerMethodReferral PaymentMethod = "referral"
+
+// PaymentCredit запись о зачислении средств на баланс по платежу
+type PaymentCredit struct {
+	ID        int64         `json:"id"`
+	PaymentID string        `json:"payment_id"`
+	Method    PaymentMethod `json:"method"`
+	UserID    int64         `json:"user_id"`
+	Amount    float64       `json:"amount"`
+	Kind      string        `json:"kind"`
+	Source    string        `json:"source"`
+	// ExternalID ID списания у платежной системы (для Telegram - provider_payment_charge_id)
+	ExternalID string    `json:"external_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreditHook обработчик, вызываемый после зачисления платежа
+type CreditHook func(paymentInfo *PaymentInfo)
+
+// creditHooks обработчики зачислений (например, применение скидки по промокоду)
+var creditHooks []CreditHook
+
+// RegisterCreditHook регистрирует обработчик, вызываемый после успешного зачисления платежа
+func RegisterCreditHook(hook CreditHook) {
+	creditHooks = append(creditHooks, hook)
+}
+
+// InitPaymentCredits создает таблицу зачислений по платежам, если ее нет
+func InitPaymentCredits() error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS payment_credits (
+		id SERIAL PRIMARY KEY,
+		payment_id VARCHAR(255) NOT NULL,
+		method VARCHAR(20) NOT NULL,
+		user_id BIGINT NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		kind VARCHAR(20) NOT NULL DEFAULT 'credit',
+		source VARCHAR(50) NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);`
+
+	// Колонка добавлена позже - для существующих таблиц
+	alterSQL := `ALTER TABLE payment_credits ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);`
+
+	// Повторные зачисления, сделанные до уникального индекса, остаются в истории для сверки
+	duplicatesSQL := `
+	UPDATE payment_credits SET kind = '` + CreditKindDuplicate + `'
+	WHERE kind = '` + CreditKindPayment + `' AND id NOT IN (
+		SELECT MIN(id) FROM payment_credits WHERE kind = '` + CreditKindPayment + `' GROUP BY payment_id
+	);`
+
+	indexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_payment_credits_payment_id ON payment_credits(payment_id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_credits_payment_credit ON payment_credits(payment_id) WHERE kind = 'credit';
+	CREATE INDEX IF NOT EXISTS idx_payment_credits_user_id ON payment_credits(user_id);
+	CREATE INDEX IF NOT EXISTS idx_payment_credits_created_at ON payment_credits(created_at);`
+
+	// Начало учета зачислений: платежи до него зачислялись без записи в payment_credits
+	ledgerSQL := `
+	CREATE TABLE IF NOT EXISTS payment_credits_ledger (
+		id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+		started_at TIMESTAMP WITH TIME ZONE NOT NULL
+	);
+
+	INSERT INTO payment_credits_ledger (started_at)
+	SELECT COALESCE(MIN(created_at), NOW()) FROM payment_credits
+	ON CONFLICT (id) DO NOTHING;`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы payment_credits: %v", err)
+	}
+
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("ошибка обновления таблицы payment_credits: %v", err)
+	}
+
+	if _, err := db.Exec(duplicatesSQL); err != nil {
+		return fmt.Errorf("ошибка разметки повторных зачислений: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов payment_credits: %v", err)
+	}
+
+	if _, err := db.Exec(ledgerSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы payment_credits_ledger: %v", err)
+	}
+
+	return nil
+}
+
+// GetCreditLedgerStart возвращает момент начала учета зачислений в payment_credits
+func GetCreditLedgerStart() (time.Time, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return time.Time{}, fmt.Errorf("база данных не инициализирована")
+	}
+
+	var startedAt time.Time
+	if err := db.QueryRow(`SELECT started_at FROM payment_credits_ledger`).Scan(&startedAt); err != nil {
+		return time.Time{}, fmt.Errorf("ошибка получения начала учета зачислений: %v", err)
+	}
+	return startedAt, nil
+}
+
+// CreditPayment зачисляет средства по успешному платежу ровно один раз.
+// Возвращает true, если зачисление выполнено, и false, если платеж уже был зачислен ранее.
+func CreditPayment(paymentInfo *PaymentInfo, source string) (bool, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return false, fmt.Errorf("база данных не инициализирована")
+	}
+
+	if paymentInfo.UserID == 0 {
+		return false, fmt.Errorf("не указан пользователь для платежа %s", paymentInfo.ID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Запись и пополнение в одной транзакции: вебхук, проверка по запросу и мониторинг
+	// могут зачислять один платеж одновременно, уникальный индекс пропускает только первое зачисление
+	externalID, _ := paymentInfo.Metadata["provider_payment_charge_id"].(string)
+	var creditID int64
+	err = tx.QueryRow(`
+		INSERT INTO payment_credits (payment_id, method, user_id, amount, kind, source, external_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (payment_id) WHERE kind = 'credit' DO NOTHING
+		RETURNING id`,
+		paymentInfo.ID, string(paymentInfo.Method), paymentInfo.UserID, paymentInfo.Amount, CreditKindPayment, source, nullIfEmpty(externalID)).Scan(&creditID)
+	if err == sql.ErrNoRows {
+		LogPaymentEvent("INFO", paymentInfo.Method,
+			"Платеж %s уже зачислен ранее, повторное зачисление пропущено (источник: %s)", paymentInfo.ID, source)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка записи зачисления: %v", err)
+	}
+
+	if err := common.AddBalanceTx(tx, paymentInfo.UserID, paymentInfo.Amount); err != nil {
+		return false, fmt.Errorf("ошибка пополнения баланса: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("ошибка сохранения зачисления: %v", err)
+	}
+	common.AfterBalanceTopup(paymentInfo.UserID, paymentInfo.Amount)
+
+	LogPaymentEvent("INFO", paymentInfo.Method,
+		"Платеж %s зачислен: UserID=%d, Amount=%.2f, источник: %s", paymentInfo.ID, paymentInfo.UserID, paymentInfo.Amount, source)
+
+	// Если при оплате была сохранена карта - привязываем ее для автопополнения
+	saveCardFromPayment(paymentInfo)
+
+	for _, hook := range creditHooks {
+		hook(paymentInfo)
+	}
+
+	return true, nil
+}
+
+// AdjustPaymentCredit корректирует зачисление по платежу на указанную разницу (может быть отрицательной)
+func AdjustPaymentCredit(paymentID string, method PaymentMethod, userID int64, delta float64, source string) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := insertPaymentCredit(tx, paymentID, method, userID, delta, CreditKindAdjustment, source, ""); err != nil {
+		return err
+	}
+
+	if err := common.AddBalanceTx(tx, userID, delta); err != nil {
+		return fmt.Errorf("ошибка корректировки баланса: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка сохранения корректировки: %v", err)
+	}
+	common.AfterBalanceTopup(userID, delta)
+
+	LogPaymentEvent("INFO", method,
+		"Корректировка по платежу %s: UserID=%d, Delta=%.2f, источник: %s", paymentID, userID, delta, source)
+
+	return nil
+}
+
+// RecordLedgerEntry записывает движение средств, не связанное с платежом (баланс не изменяется)
+func RecordLedgerEntry(entryID string, method PaymentMethod, userID int64, amount float64, kind, source string) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	if _, err := insertPaymentCredit(db, entryID, method, userID, amount, kind, source, ""); err != nil {
+		return err
+	}
+
+	LogPaymentEvent("INFO", method,
+		"Запись %s (%s): UserID=%d, Amount=%.2f, источник: %s", entryID, kind, userID, amount, source)
+
+	return nil
+}
+
+// RecordLedgerEntryTx записывает движение средств в транзакции вызывающего вместе с изменением, которое оно описывает
+func RecordLedgerEntryTx(tx *sql.Tx, entryID string, method PaymentMethod, userID int64, amount float64, kind, source string) error {
+	if _, err := insertPaymentCredit(tx, entryID, method, userID, amount, kind, source, ""); err != nil {
+		return err
+	}
+
+	LogPaymentEvent("INFO", method,
+		"Запись %s (%s): UserID=%d, Amount=%.2f, источник: %s", entryID, kind, userID, amount, source)
+
+	return nil
+}
+
+// GetPaymentCredits возвращает все записи о зачислении по платежу
+func GetPaymentCredits(paymentID string) ([]PaymentCredit, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query(`
+		SELECT id, payment_id, method, user_id, amount, kind, source, external_id, created_at
+		FROM payment_credits WHERE payment_id = $1 ORDER BY created_at`, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения зачислений: %v", err)
+	}
+	defer rows.Close()
+
+	return scanPaymentCredits(rows)
+}
+
+// GetUserPaymentCredits возвращает последние зачисления по платежам пользователя
+func GetUserPaymentCredits(userID int64, limit int) ([]PaymentCredit, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query(`
+		SELECT id, payment_id, method, user_id, amount, kind, source, external_id, created_at
+		FROM payment_credits
+		WHERE user_id = $1 AND kind = $2
+		ORDER BY created_at DESC LIMIT $3`, userID, CreditKindPayment, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения зачислений пользователя: %v", err)
+	}
+	defer rows.Close()
+
+	return scanPaymentCredits(rows)
+}
+
+// GetPaymentCreditsInRange возвращает записи о зачислении за период
+func GetPaymentCreditsInRange(method PaymentMethod, from, to time.Time) ([]PaymentCredit, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query(`
+		SELECT id, payment_id, method, user_id, amount, kind, source, external_id, created_at
+		FROM payment_credits
+		WHERE method = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at`, string(method), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения зачислений: %v", err)
+	}
+	defer rows.Close()
+
+	return scanPaymentCredits(rows)
+}
+
+// rowQuerier *sql.DB или *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// insertPaymentCredit добавляет запись о зачислении и возвращает ее ID
+func insertPaymentCredit(db rowQuerier, paymentID string, method PaymentMethod, userID int64, amount float64, kind, source, externalID string) (int64, error) {
+	var id int64
+	err := db.QueryRow(`
+		INSERT INTO payment_credits (payment_id, method, user_id, amount, kind, source, external_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		paymentID, string(method), userID, amount, kind, source, nullIfEmpty(externalID)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка записи зачисления: %v", err)
+	}
+	return id, nil
+}
+
+// scanPaymentCredits читает записи о зачислении из результата запроса
+func scanPaymentCredits(rows *sql.Rows) ([]PaymentCredit, error) {
+	var credits []PaymentCredit
+	for rows.Next() {
+		var credit PaymentCredit
+		var method string
+		var externalID sql.NullString
+		if err := rows.Scan(&credit.ID, &credit.PaymentID, &method, &credit.UserID,
+			&credit.Amount, &credit.Kind, &credit.Source, &externalID, &credit.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения зачисления: %v", err)
+		}
+		credit.Method = PaymentMethod(method)
+		credit.ExternalID = externalID.String
+		credits = append(credits, credit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка обработки зачислений: %v", err)
+	}
+
+	return credits, nil
+}
+
+// nullIfEmpty возвращает nil для пустой строки
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
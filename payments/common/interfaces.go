@@ -37,6 +37,17 @@ type PaymentInfo struct {
 	Metadata    map[string]interface{} `json:"metadata"`    // Дополнительные данные
 }
 
+// RefundInfo содержит информацию о возврате платежа
+type RefundInfo struct {
+	ID        string  `json:"id"`         // ID возврата у провайдера
+	PaymentID string  `json:"payment_id"` // ID исходного платежа
+	UserID    int64   `json:"user_id"`    // ID пользователя Telegram
+	Amount    float64 `json:"amount"`     // Сумма возврата в рублях
+	Status    string  `json:"status"`     // Статус возврата (pending, succeeded, canceled)
+	Reason    string  `json:"reason"`     // Причина возврата
+	CreatedAt string  `json:"created_at"` // Время создания
+}
+
 // PaymentProvider интерфейс для провайдеров платежей
 type PaymentProvider interface {
 	// Создать платеж
@@ -48,6 +59,9 @@ type PaymentProvider interface {
 	// Обработать уведомление о платеже
 	ProcessWebhook(data []byte) (*PaymentInfo, error)
 
+	// Вернуть платеж полностью или частично; sequence - номер возврата по платежу для ключа идемпотентности
+	Refund(paymentID string, amount float64, reason string, sequence int) (*RefundInfo, error)
+
 	// Проверить, поддерживается ли данный метод
 	IsEnabled() bool
 
@@ -117,6 +131,16 @@ func (pm *PaymentManager) ProcessWebhook(method PaymentMethod, data []byte) (*Pa
 	return provider.ProcessWebhook(data)
 }
 
+// Refund выполняет возврат платежа через провайдера
+func (pm *PaymentManager) Refund(method PaymentMethod, paymentID string, amount float64, reason string, sequence int) (*RefundInfo, error) {
+	provider, exists := pm.providers[method]
+	if !exists {
+		return nil, errors.New("платежный провайдер не найден")
+	}
+
+	return provider.Refund(paymentID, amount, reason, sequence)
+}
+
 // GetPreferredMethod возвращает предпочтительный метод оплаты
 func (pm *PaymentManager) GetPreferredMethod() (PaymentMethod, error) {
 	available := pm.GetAvailableProviders()
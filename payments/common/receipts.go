@@ -0,0 +1,372 @@
+package common
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"bot/common"
+)
+
+// Типы покупок для настроек позиции чека (ключи YUKASSA_RECEIPT_ITEMS)
+const (
+	ReceiptPlanTopup     = "topup"      // Пополнение баланса
+	ReceiptPlanAutoTopup = "auto_topup" // Автопополнение с сохраненной карты
+	ReceiptPlanCardLink  = "card_link"  // Пополнение с привязкой карты
+)
+
+// Статусы чеков
+const (
+	ReceiptStatusPending   = "pending"   // Чек передан в ЮКассу, ожидает регистрации
+	ReceiptStatusSucceeded = "succeeded" // Чек зарегистрирован
+	ReceiptStatusCanceled  = "canceled"  // Регистрация чека не удалась
+	ReceiptStatusNotSent   = "not_sent"  // Чек не формировался (чеки отключены)
+)
+
+var (
+	receiptEmailRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	receiptPhoneRegexp = regexp.MustCompile(`^7\d{10}$`)
+)
+
+// ReceiptContact контакт пользователя для отправки чеков (54-ФЗ)
+type ReceiptContact struct {
+	UserID int64
+	Email  string
+	Phone  string
+}
+
+// IsEmpty проверяет, указан ли хотя бы один контакт
+func (c *ReceiptContact) IsEmpty() bool {
+	return c == nil || (c.Email == "" && c.Phone == "")
+}
+
+// ReceiptItemSettings итоговые настройки позиции чека
+type ReceiptItemSettings struct {
+	Description    string
+	VATCode        int
+	PaymentSubject string
+	PaymentMode    string
+}
+
+// PaymentReceipt чек, отправленный вместе с платежом
+type PaymentReceipt struct {
+	PaymentID   string
+	UserID      int64
+	Method      PaymentMethod
+	Amount      float64
+	Email       string
+	Phone       string
+	Description string
+	VATCode     int
+	ReceiptID   string
+	Status      string
+	FiscalInfo  string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// InitReceipts создает таблицы контактов и чеков, если их нет
+func InitReceipts() error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	contactsSQL := `
+	CREATE TABLE IF NOT EXISTS receipt_contacts (
+		user_id BIGINT PRIMARY KEY,
+		email VARCHAR(255),
+		phone VARCHAR(20),
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);`
+
+	receiptsSQL := `
+	CREATE TABLE IF NOT EXISTS payment_receipts (
+		payment_id VARCHAR(255) PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		method VARCHAR(20) NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		email VARCHAR(255),
+		phone VARCHAR(20),
+		description TEXT NOT NULL,
+		vat_code INTEGER NOT NULL,
+		receipt_id VARCHAR(255),
+		status VARCHAR(20) NOT NULL,
+		fiscal_info TEXT,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS idx_payment_receipts_user_id ON payment_receipts(user_id);`
+
+	if _, err := db.Exec(contactsSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы receipt_contacts: %v", err)
+	}
+
+	if _, err := db.Exec(receiptsSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы payment_receipts: %v", err)
+	}
+
+	return nil
+}
+
+// ParseReceiptContact разбирает email или телефон, введенный пользователем.
+// Телефон приводится к формату 7XXXXXXXXXX.
+func ParseReceiptContact(value string) (email, phone string, err error) {
+	value = strings.TrimSpace(value)
+
+	if strings.Contains(value, "@") {
+		if !receiptEmailRegexp.MatchString(value) {
+			return "", "", fmt.Errorf("некорректный email")
+		}
+		return strings.ToLower(value), "", nil
+	}
+
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+	if len(digits) == 11 && digits[0] == '8' {
+		digits = "7" + digits[1:]
+	}
+	if len(digits) == 10 {
+		digits = "7" + digits
+	}
+	if !receiptPhoneRegexp.MatchString(digits) {
+		return "", "", fmt.Errorf("некорректный номер телефона")
+	}
+
+	return "", digits, nil
+}
+
+// GetReceiptContact возвращает контакт пользователя для чеков (nil, если не указан)
+func GetReceiptContact(userID int64) (*ReceiptContact, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	var email, phone sql.NullString
+	err := db.QueryRow(`SELECT email, phone FROM receipt_contacts WHERE user_id = $1`, userID).Scan(&email, &phone)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения контакта для чеков: %v", err)
+	}
+
+	return &ReceiptContact{UserID: userID, Email: email.String, Phone: phone.String}, nil
+}
+
+// SaveReceiptContact сохраняет контакт пользователя для чеков
+func SaveReceiptContact(userID int64, email, phone string) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO receipt_contacts (user_id, email, phone, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET email = EXCLUDED.email, phone = EXCLUDED.phone, updated_at = NOW()`,
+		userID, nullIfEmpty(email), nullIfEmpty(phone))
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения контакта для чеков: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteReceiptContact удаляет контакт пользователя для чеков
+func DeleteReceiptContact(userID int64) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	if _, err := db.Exec(`DELETE FROM receipt_contacts WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("ошибка удаления контакта для чеков: %v", err)
+	}
+
+	return nil
+}
+
+// GetReceiptItemSettings возвращает настройки позиции чека для типа покупки
+func GetReceiptItemSettings(plan, defaultDescription string) ReceiptItemSettings {
+	settings := ReceiptItemSettings{
+		Description:    defaultDescription,
+		VATCode:        common.YUKASSA_VAT_CODE,
+		PaymentSubject: common.YUKASSA_PAYMENT_SUBJECT,
+		PaymentMode:    common.YUKASSA_PAYMENT_MODE,
+	}
+
+	item, exists := common.YUKASSA_RECEIPT_ITEMS[plan]
+	if !exists {
+		return settings
+	}
+
+	if item.Description != "" {
+		settings.Description = item.Description
+	}
+	if item.VATCode != 0 {
+		settings.VATCode = item.VATCode
+	}
+	if item.PaymentSubject != "" {
+		settings.PaymentSubject = item.PaymentSubject
+	}
+	if item.PaymentMode != "" {
+		settings.PaymentMode = item.PaymentMode
+	}
+
+	return settings
+}
+
+// SavePaymentReceipt сохраняет чек, отправленный вместе с платежом
+func SavePaymentReceipt(receipt *PaymentReceipt) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO payment_receipts (payment_id, user_id, method, amount, email, phone, description, vat_code, receipt_id, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (payment_id) DO NOTHING`,
+		receipt.PaymentID, receipt.UserID, string(receipt.Method), receipt.Amount,
+		nullIfEmpty(receipt.Email), nullIfEmpty(receipt.Phone), receipt.Description, receipt.VATCode,
+		nullIfEmpty(receipt.ReceiptID), receipt.Status)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения чека: %v", err)
+	}
+
+	return nil
+}
+
+// UpdatePaymentReceiptStatus обновляет статус чека и фискальные данные
+func UpdatePaymentReceiptStatus(paymentID, receiptID, status, fiscalInfo string) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	_, err := db.Exec(`
+		UPDATE payment_receipts SET
+			receipt_id = COALESCE($2, receipt_id),
+			status = $3,
+			fiscal_info = COALESCE($4, fiscal_info),
+			updated_at = NOW()
+		WHERE payment_id = $1`,
+		paymentID, nullIfEmpty(receiptID), status, nullIfEmpty(fiscalInfo))
+	if err != nil {
+		return fmt.Errorf("ошибка обновления статуса чека: %v", err)
+	}
+
+	return nil
+}
+
+// GetPaymentReceipt возвращает чек по ID платежа (nil, если чека нет)
+func GetPaymentReceipt(paymentID string) (*PaymentReceipt, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query(`
+		SELECT payment_id, user_id, method, amount, email, phone, description, vat_code, receipt_id, status, fiscal_info, created_at, updated_at
+		FROM payment_receipts WHERE payment_id = $1`, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения чека: %v", err)
+	}
+	defer rows.Close()
+
+	receipts, err := scanPaymentReceipts(rows)
+	if err != nil || len(receipts) == 0 {
+		return nil, err
+	}
+
+	return receipts[0], nil
+}
+
+// GetUserPaymentReceipts возвращает последние чеки пользователя
+func GetUserPaymentReceipts(userID int64, limit int) ([]*PaymentReceipt, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	rows, err := db.Query(`
+		SELECT payment_id, user_id, method, amount, email, phone, description, vat_code, receipt_id, status, fiscal_info, created_at, updated_at
+		FROM payment_receipts
+		WHERE user_id = $1 AND status <> $2
+		ORDER BY created_at DESC LIMIT $3`, userID, ReceiptStatusNotSent, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения чеков пользователя: %v", err)
+	}
+	defer rows.Close()
+
+	return scanPaymentReceipts(rows)
+}
+
+// GetReceiptStatusDescription возвращает описание статуса чека для пользователя
+func GetReceiptStatusDescription(status string) string {
+	switch status {
+	case ReceiptStatusPending:
+		return "⏳ Регистрируется"
+	case ReceiptStatusSucceeded:
+		return "✅ Зарегистрирован"
+	case ReceiptStatusCanceled:
+		return "❌ Ошибка регистрации"
+	default:
+		return "—"
+	}
+}
+
+// GetVATDescription возвращает описание кода НДС
+func GetVATDescription(vatCode int) string {
+	switch vatCode {
+	case 1:
+		return "без НДС"
+	case 2:
+		return "0%"
+	case 3:
+		return "10%"
+	case 4:
+		return "20%"
+	case 5:
+		return "10/110"
+	case 6:
+		return "20/120"
+	default:
+		return fmt.Sprintf("код %d", vatCode)
+	}
+}
+
+// scanPaymentReceipts читает чеки из результата запроса
+func scanPaymentReceipts(rows *sql.Rows) ([]*PaymentReceipt, error) {
+	var receipts []*PaymentReceipt
+	for rows.Next() {
+		var receipt PaymentReceipt
+		var method string
+		var email, phone, receiptID, fiscalInfo sql.NullString
+		if err := rows.Scan(&receipt.PaymentID, &receipt.UserID, &method, &receipt.Amount, &email, &phone,
+			&receipt.Description, &receipt.VATCode, &receiptID, &receipt.Status, &fiscalInfo,
+			&receipt.CreatedAt, &receipt.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения чека: %v", err)
+		}
+		receipt.Method = PaymentMethod(method)
+		receipt.Email = email.String
+		receipt.Phone = phone.String
+		receipt.ReceiptID = receiptID.String
+		receipt.FiscalInfo = fiscalInfo.String
+		receipts = append(receipts, &receipt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка обработки чеков: %v", err)
+	}
+
+	return receipts, nil
+}
@@ -0,0 +1,207 @@
+package common
+
+import (
+	"database/sql"
+	"fmt"
+
+	"bot/common"
+)
+
+// Статусы записи возврата до ответа провайдера
+const (
+	RefundStatusReserved = "reserved" // Сумма зарезервирована, запрос к провайдеру выполняется
+	RefundStatusUnknown  = "unknown"  // Провайдер не ответил успехом: нужна сверка, повтор той же суммы использует тот же ключ
+)
+
+// RefundReservation зарезервированный возврат: сумма уже учтена в GetRefundedAmount
+type RefundReservation struct {
+	ID       int64
+	Sequence int // Номер возврата по платежу, из него строится ключ идемпотентности
+	Amount   float64
+}
+
+// InitPaymentRefunds создает таблицу возвратов платежей, если ее нет
+func InitPaymentRefunds() error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS payment_refunds (
+		id SERIAL PRIMARY KEY,
+		refund_id VARCHAR(255) NOT NULL,
+		payment_id VARCHAR(255) NOT NULL,
+		method VARCHAR(20) NOT NULL,
+		user_id BIGINT NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		reason TEXT,
+		created_by BIGINT NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);`
+
+	// Колонка добавлена позже - для существующих таблиц
+	alterSQL := `ALTER TABLE payment_refunds ADD COLUMN IF NOT EXISTS sequence INTEGER NOT NULL DEFAULT 0;`
+
+	indexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_payment_refunds_payment_id ON payment_refunds(payment_id);
+	CREATE INDEX IF NOT EXISTS idx_payment_refunds_user_id ON payment_refunds(user_id);`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы payment_refunds: %v", err)
+	}
+
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("ошибка обновления таблицы payment_refunds: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов payment_refunds: %v", err)
+	}
+
+	return nil
+}
+
+// ReservePaymentRefund резервирует возврат по зачислению до запроса к провайдеру (amount <= 0 - весь остаток).
+// Параллельные возвраты одного платежа выполняются по очереди, поэтому вернуть больше зачисленного нельзя.
+// Незавершенный возврат той же суммы используется повторно, чтобы провайдер получил тот же ключ идемпотентности.
+func ReservePaymentRefund(credit *PaymentCredit, amount float64, reason string, createdBy int64) (*RefundReservation, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, credit.PaymentID); err != nil {
+		return nil, fmt.Errorf("ошибка блокировки возвратов платежа: %v", err)
+	}
+
+	reservation := &RefundReservation{}
+	err = tx.QueryRow(`
+		UPDATE payment_refunds SET status = $3
+		WHERE id = (
+			SELECT id FROM payment_refunds
+			WHERE payment_id = $1 AND status = $4 AND ($2::numeric <= 0 OR amount = $2::numeric)
+			ORDER BY id LIMIT 1
+		)
+		RETURNING id, sequence, amount`,
+		credit.PaymentID, amount, RefundStatusReserved, RefundStatusUnknown).Scan(&reservation.ID, &reservation.Sequence, &reservation.Amount)
+	if err == nil {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("ошибка резервирования возврата: %v", err)
+		}
+		return reservation, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("ошибка поиска незавершенного возврата: %v", err)
+	}
+
+	var refunded float64
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0), COALESCE(MAX(sequence), 0) FROM payment_refunds
+		WHERE payment_id = $1 AND status <> 'canceled'`, credit.PaymentID).Scan(&refunded, &reservation.Sequence)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения суммы возвратов: %v", err)
+	}
+
+	available := credit.Amount - refunded
+	if available <= 0.001 {
+		return nil, fmt.Errorf("платеж %s уже полностью возвращен", credit.PaymentID)
+	}
+	if amount <= 0 {
+		amount = available
+	}
+	if amount > available+0.001 {
+		return nil, fmt.Errorf("сумма возврата %.2f₽ превышает доступную %.2f₽", amount, available)
+	}
+
+	reservation.Sequence++
+	reservation.Amount = amount
+	err = tx.QueryRow(`
+		INSERT INTO payment_refunds (refund_id, payment_id, method, user_id, amount, status, reason, created_by, sequence)
+		VALUES ('', $1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		credit.PaymentID, string(credit.Method), credit.UserID, amount, RefundStatusReserved, reason, createdBy, reservation.Sequence).Scan(&reservation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка резервирования возврата: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка резервирования возврата: %v", err)
+	}
+	return reservation, nil
+}
+
+// CompletePaymentRefund сохраняет ответ провайдера по зарезервированному возврату и в той же транзакции
+// списывает сумму возврата с баланса пользователя. Возвращает новый баланс (для отмененного возврата - 0).
+func CompletePaymentRefund(reservationID int64, refund *RefundInfo) (float64, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return 0, fmt.Errorf("база данных не инициализирована")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE payment_refunds SET refund_id = $2, amount = $3, status = $4, reason = $5
+		WHERE id = $1`,
+		reservationID, refund.ID, refund.Amount, refund.Status, refund.Reason)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения возврата: %v", err)
+	}
+
+	var balance float64
+	if refund.Status != "canceled" {
+		if balance, err = common.DeductBalanceTx(tx, refund.UserID, refund.Amount); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка сохранения возврата: %v", err)
+	}
+
+	return balance, nil
+}
+
+// MarkPaymentRefundUnknown отмечает возврат без ответа провайдера для сверки.
+// Сумма остается зарезервированной, пока возврат не будет повторен или проверен вручную.
+func MarkPaymentRefundUnknown(reservationID int64) error {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	if _, err := db.Exec(`UPDATE payment_refunds SET status = $2 WHERE id = $1`, reservationID, RefundStatusUnknown); err != nil {
+		return fmt.Errorf("ошибка сохранения статуса возврата: %v", err)
+	}
+
+	return nil
+}
+
+// GetRefundedAmount возвращает сумму возвратов по платежу (без отмененных)
+func GetRefundedAmount(paymentID string) (float64, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return 0, fmt.Errorf("база данных не инициализирована")
+	}
+
+	var amount float64
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0) FROM payment_refunds
+		WHERE payment_id = $1 AND status <> 'canceled'`, paymentID).Scan(&amount)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения суммы возвратов: %v", err)
+	}
+
+	return amount, nil
+}
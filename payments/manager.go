@@ -6,6 +6,7 @@ import (
 
 	"bot/common"
 	paymentCommon "bot/payments/common"
+	"bot/payments/promo"
 	"bot/payments/sitePayment"
 	"bot/payments/telegramPayment"
 
@@ -21,6 +22,7 @@ type PaymentManager struct {
 	telegramProvider *telegramPayment.TelegramPaymentProvider
 	yookassaProvider *sitePayment.YooKassaPaymentProvider
 	onDemandService  *OnDemandPaymentService
+	reconciliation   *ReconciliationService
 }
 
 // InitializePaymentManager инициализирует глобальный менеджер платежей
@@ -35,6 +37,26 @@ func InitializePaymentManager(bot *tgbotapi.BotAPI) error {
 		PaymentManager: baseManager,
 	}
 
+	// Создаем таблицу зачислений по платежам
+	if err := paymentCommon.InitPaymentCredits(); err != nil {
+		return fmt.Errorf("ошибка инициализации учета зачислений: %v", err)
+	}
+
+	// Создаем таблицу возвратов платежей
+	if err := paymentCommon.InitPaymentRefunds(); err != nil {
+		return fmt.Errorf("ошибка инициализации учета возвратов: %v", err)
+	}
+
+	// Создаем таблицу настроек автопополнения
+	if err := paymentCommon.InitAutoTopup(); err != nil {
+		return fmt.Errorf("ошибка инициализации автопополнения: %v", err)
+	}
+
+	// Создаем таблицы контактов и чеков
+	if err := paymentCommon.InitReceipts(); err != nil {
+		return fmt.Errorf("ошибка инициализации чеков: %v", err)
+	}
+
 	// Инициализируем провайдеры
 	if err := manager.initializeProviders(bot); err != nil {
 		return fmt.Errorf("ошибка инициализации провайдеров: %v", err)
@@ -46,6 +68,9 @@ func InitializePaymentManager(bot *tgbotapi.BotAPI) error {
 	// Инициализируем сервис обработки платежей по требованию
 	manager.onDemandService = NewOnDemandPaymentService(manager)
 
+	// Инициализируем сервис сверки платежей с ЮКассой
+	manager.reconciliation = NewReconciliationService(manager)
+
 	log.Printf("PAYMENT_MANAGER: Менеджер платежей успешно инициализирован")
 	return nil
 }
@@ -187,20 +212,76 @@ func (pm *PaymentManager) ProcessTopupRequest(userID int64, amount float64, chat
 
 	description := fmt.Sprintf("Пополнение баланса на %.2f₽", amount)
 
+	// Применяем скидку по промокоду: платим меньше, на баланс поступает полная сумма
+	amountToPay := amount
+	var discount *promo.PromoDiscount
+	if promo.GlobalPromoManager != nil {
+		discount = promo.GlobalPromoManager.GetCheckoutDiscount(userID, promo.PromoCheckout{Plan: promo.PromoPlanTopup, Amount: amount})
+		if discount != nil {
+			amountToPay = amount - discount.Amount
+			description = fmt.Sprintf("Пополнение баланса на %.2f₽ (скидка %.0f%% по промокоду)", amount, discount.Percent)
+		}
+	}
+
 	// Создаем платеж с предпочтительным методом
-	paymentInfo, method, err := pm.CreatePaymentWithPreferredMethod(userID, amount, description)
+	paymentInfo, method, err := pm.CreatePaymentWithPreferredMethod(userID, amountToPay, description)
 	if err != nil {
 		return fmt.Errorf("ошибка создания платежа: %v", err)
 	}
 
 	log.Printf("PAYMENT_MANAGER: Платеж создан (ID=%s, Method=%s)", paymentInfo.ID, method)
 
+	if discount != nil {
+		if err := promo.GlobalPromoManager.ReserveDiscount(discount, paymentInfo.ID); err != nil {
+			log.Printf("PAYMENT_MANAGER: Ошибка резервирования скидки для платежа %s: %v", paymentInfo.ID, err)
+		} else {
+			text := fmt.Sprintf("🎟 Промокод <code>%s</code>: скидка %.0f%%\n\n"+
+				"💳 К оплате: %s\n"+
+				"💰 На баланс поступит: %s",
+				discount.Code, discount.Percent,
+				paymentCommon.FormatAmount(amountToPay), paymentCommon.FormatAmount(amount))
+			msg := tgbotapi.NewMessage(chatID, text)
+			msg.ParseMode = "HTML"
+			if _, err := common.GlobalBot.Send(msg); err != nil {
+				log.Printf("PAYMENT_MANAGER: Ошибка отправки сообщения о скидке: %v", err)
+			}
+		}
+	}
+
+	return pm.sendPayment(chatID, paymentInfo, method, user)
+}
+
+// ProcessPurchaseRequest создает платеж за покупку: оплаченная сумма зачисляется на баланс,
+// а reserve привязывает покупку к платежу до отправки ссылки, чтобы обработчик зачисления ее завершил
+func (pm *PaymentManager) ProcessPurchaseRequest(userID int64, amount float64, chatID int64, description string, reserve func(paymentID string) error) error {
+	log.Printf("PAYMENT_MANAGER: Обработка запроса покупки для пользователя %d на сумму %.2f", userID, amount)
+
+	user, err := common.GetUserByTelegramID(userID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения пользователя: %v", err)
+	}
+
+	paymentInfo, method, err := pm.CreatePaymentWithPreferredMethod(userID, amount, description)
+	if err != nil {
+		return fmt.Errorf("ошибка создания платежа: %v", err)
+	}
+
+	log.Printf("PAYMENT_MANAGER: Платеж за покупку создан (ID=%s, Method=%s)", paymentInfo.ID, method)
+
+	if err := reserve(paymentInfo.ID); err != nil {
+		return fmt.Errorf("ошибка привязки покупки к платежу: %v", err)
+	}
+
+	return pm.sendPayment(chatID, paymentInfo, method, user)
+}
+
+// sendPayment отправляет пользователю инвойс или ссылку на оплату созданного платежа
+func (pm *PaymentManager) sendPayment(chatID int64, paymentInfo *paymentCommon.PaymentInfo, method paymentCommon.PaymentMethod, user *common.User) error {
 	// Обрабатываем в зависимости от метода
 	switch method {
 	case paymentCommon.PaymentMethodTelegram:
 		// Отправляем инвойс через Telegram
-		err = pm.SendTelegramInvoice(chatID, paymentInfo)
-		if err != nil {
+		if err := pm.SendTelegramInvoice(chatID, paymentInfo); err != nil {
 			return fmt.Errorf("ошибка отправки Telegram инвойса: %v", err)
 		}
 		log.Printf("PAYMENT_MANAGER: Telegram инвойс отправлен для платежа %s", paymentInfo.ID)
@@ -212,8 +293,7 @@ func (pm *PaymentManager) ProcessTopupRequest(userID int64, amount float64, chat
 		}
 
 		// Отправляем сообщение со ссылкой на оплату
-		err = pm.sendYooKassaPaymentLink(chatID, paymentInfo, user)
-		if err != nil {
+		if err := pm.sendYooKassaPaymentLink(chatID, paymentInfo, user); err != nil {
 			return fmt.Errorf("ошибка отправки ссылки на оплату: %v", err)
 		}
 		log.Printf("PAYMENT_MANAGER: Ссылка на оплату ЮКасса отправлена для платежа %s", paymentInfo.ID)
@@ -273,3 +353,8 @@ func (pm *PaymentManager) CheckPaymentStatus(method paymentCommon.PaymentMethod,
 
 	return paymentInfo, nil
 }
+
+// GetReconciliationService возвращает сервис сверки платежей
+func (pm *PaymentManager) GetReconciliationService() *ReconciliationService {
+	return pm.reconciliation
+}
@@ -95,13 +95,23 @@ func (odps *OnDemandPaymentService) checkAndProcessPayment(paymentID string, use
 		log.Printf("PAYMENT_ON_DEMAND: Платеж %s успешен, зачисляем средства", paymentID)
 
 		// Зачисляем средства
-		err = common.AddBalance(userID, paymentInfo.Amount)
+		if paymentInfo.UserID == 0 {
+			paymentInfo.UserID = userID
+		}
+		credited, err := paymentCommon.CreditPayment(paymentInfo, "on_demand")
 		if err != nil {
 			log.Printf("PAYMENT_ON_DEMAND: Ошибка зачисления средств для платежа %s: %v", paymentID, err)
 			odps.paymentLogger.UpdatePaymentStatus(paymentID, "error_balance", false)
 			return false
 		}
 
+		// Платеж уже зачислен другим путем (webhook или ручная проверка) - уведомление не дублируем
+		if !credited {
+			log.Printf("PAYMENT_ON_DEMAND: Платеж %s уже был зачислен ранее", paymentID)
+			odps.paymentLogger.UpdatePaymentStatus(paymentID, "succeeded", true)
+			return true
+		}
+
 		// Получаем обновленные данные пользователя
 		user, err := common.GetUserByTelegramID(userID)
 		if err != nil {
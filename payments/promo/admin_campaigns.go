@@ -0,0 +1,282 @@
+package promo
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// promoCampaignHelp справка по созданию кампаний командой /promocampaign
+const promoCampaignHelp = "📣 <b>Кампании промокодов</b>\n\n" +
+	"Пачка случайных кодов:\n" +
+	"<code>/promocampaign кампания batch количество тип значение [условия]</code>\n\n" +
+	"Именной код:\n" +
+	"<code>/promocampaign кампания code КОД тип значение [условия]</code>\n\n" +
+	"<b>Дополнительные условия:</b>\n" +
+	"• <code>uses=100</code> - максимум использований одного кода\n" +
+	"• <code>valid=30</code> - срок действия в днях\n" +
+	"• <code>new</code>, <code>min=500</code>, <code>plans=topup</code> - как в /promoset\n\n" +
+	"<b>Примеры:</b>\n" +
+	"<code>/promocampaign blogger batch 50 balance 100</code>\n" +
+	"<code>/promocampaign spring code SPRING25 percent 25 uses=500 valid=30</code>"
+
+// HandlePromoCampaignCommand обрабатывает команду /promocampaign
+func (h *AdminPromoHandler) HandlePromoCampaignCommand(chatID int64, userID int64, args []string) error {
+	// Проверяем, что пользователь - админ
+	if !IsAdmin(userID) {
+		return h.sendMessage(chatID, "❌ У вас нет прав для выполнения этой команды.")
+	}
+
+	if len(args) < 3 {
+		return h.sendMessage(chatID, promoCampaignHelp)
+	}
+
+	campaignName, mode := args[0], strings.ToLower(args[1])
+
+	var template *PromoCode
+	var count int
+	var err error
+
+	switch mode {
+	case "batch":
+		count, err = strconv.Atoi(args[2])
+		if err != nil || count <= 0 || count > MaxCampaignBatchSize {
+			return h.sendMessage(chatID, fmt.Sprintf("❌ Количество промокодов должно быть от 1 до %d", MaxCampaignBatchSize))
+		}
+		template, err = ParsePromoSpec(args[3:])
+	case "code":
+		template, err = ParsePromoSpec(args[3:])
+		if err == nil {
+			template.Code = args[2]
+			err = validatePromoTemplate(template)
+		}
+		count = 1
+	default:
+		return h.sendMessage(chatID, promoCampaignHelp)
+	}
+
+	if err != nil {
+		return h.sendMessage(chatID, fmt.Sprintf("❌ %v\n\n%s", err, promoCampaignHelp))
+	}
+
+	campaign, err := h.service.GetOrCreateCampaign(campaignName, userID)
+	if err != nil {
+		log.Printf("PROMO_ADMIN: Ошибка получения кампании %s: %v", campaignName, err)
+		return h.sendMessage(chatID, fmt.Sprintf("❌ %v", err))
+	}
+
+	codes, err := h.service.CreateCampaignCodes(campaign, template, count, userID)
+	if err != nil {
+		log.Printf("PROMO_ADMIN: Ошибка создания промокодов кампании %s: %v", campaign.ID, err)
+		if len(codes) == 0 {
+			return h.sendMessage(chatID, fmt.Sprintf("❌ Ошибка создания промокодов: %v", err))
+		}
+	}
+
+	text := fmt.Sprintf("✅ <b>Промокоды созданы</b>\n\n"+
+		"📣 <b>Кампания:</b> %s\n"+
+		"🎁 <b>Бонус:</b> %s\n"+
+		"🔢 <b>Создано кодов:</b> %d\n"+
+		"👥 <b>Использований на код:</b> %d\n"+
+		"⏰ <b>Действуют до:</b> %s\n",
+		campaign.Name,
+		DescribePromoValue(codes[0]),
+		len(codes),
+		codes[0].MaxUses,
+		codes[0].ExpiresAt.Format("02.01.2006 15:04"))
+
+	if rules := DescribePromoRules(codes[0]); rules != "" {
+		text += "\n📋 <b>Условия:</b>\n" + rules + "\n"
+	}
+
+	if len(codes) < count {
+		text += fmt.Sprintf("\n⚠️ Создано %d из %d: %v\n", len(codes), count, err)
+	}
+
+	if len(codes) == 1 {
+		text += fmt.Sprintf("\n<code>/promo %s</code>", codes[0].Code)
+	} else {
+		text += "\nСписок кодов - в CSV-выгрузке кампании."
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = h.campaignKeyboard(campaign)
+
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки результата: %v", err)
+	}
+
+	return nil
+}
+
+// HandleCampaignsCallback показывает список кампаний
+func (h *AdminPromoHandler) HandleCampaignsCallback(chatID int64, userID int64) error {
+	// Проверяем, что пользователь - админ
+	if !IsAdmin(userID) {
+		return h.sendMessage(chatID, "❌ У вас нет прав для выполнения этой команды.")
+	}
+
+	campaigns, err := h.service.GetCampaigns(20)
+	if err != nil {
+		log.Printf("PROMO_ADMIN: Ошибка получения кампаний: %v", err)
+		return h.sendMessage(chatID, "❌ Ошибка получения кампаний. Попробуйте позже.")
+	}
+
+	if len(campaigns) == 0 {
+		return h.sendMessage(chatID, "📣 Кампаний пока нет.\n\n"+promoCampaignHelp)
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, campaign := range campaigns {
+		status := "🟢"
+		if !campaign.IsActive {
+			status = "⚪"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("%s %s", status, campaign.Name), "promo_campaign:"+campaign.ID)))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "📣 <b>Кампании промокодов</b>\n\nВыберите кампанию для просмотра отчета:")
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки списка кампаний: %v", err)
+	}
+
+	return nil
+}
+
+// HandleCampaignReportCallback показывает отчет по кампании
+func (h *AdminPromoHandler) HandleCampaignReportCallback(chatID int64, userID int64, callbackData string) error {
+	// Проверяем, что пользователь - админ
+	if !IsAdmin(userID) {
+		return h.sendMessage(chatID, "❌ У вас нет прав для выполнения этой команды.")
+	}
+
+	campaignID := strings.TrimPrefix(callbackData, "promo_campaign:")
+
+	report, err := h.service.GetCampaignReport(campaignID)
+	if err != nil {
+		log.Printf("PROMO_ADMIN: Ошибка получения отчета кампании %s: %v", campaignID, err)
+		return h.sendMessage(chatID, "❌ Ошибка получения отчета кампании. Попробуйте позже.")
+	}
+
+	status := "🟢 Активна"
+	if !report.Campaign.IsActive {
+		status = "⚪ Отключена"
+	}
+
+	revenue := fmt.Sprintf("%.2f₽ (платящих: %d)", report.Revenue, report.PayingUsers)
+	if report.RevenueFailed {
+		revenue = "недоступна"
+	}
+
+	var conversion float64
+	if report.UniqueUsers > 0 {
+		conversion = float64(report.PayingUsers) / float64(report.UniqueUsers) * 100
+	}
+
+	text := fmt.Sprintf("📣 <b>Кампания %s</b>\n\n"+
+		"📌 <b>Статус:</b> %s\n"+
+		"📅 <b>Создана:</b> %s\n\n"+
+		"🎁 <b>Кодов:</b> %d (доступно: %d)\n"+
+		"✅ <b>Активаций:</b> %d\n"+
+		"👥 <b>Участников:</b> %d\n"+
+		"💸 <b>Выдано бонусов:</b> %.2f₽\n\n"+
+		"💰 <b>Выручка от участников:</b> %s\n"+
+		"📈 <b>Конверсия в оплату:</b> %.1f%%",
+		report.Campaign.Name,
+		status,
+		report.Campaign.CreatedAt.Format("02.01.2006"),
+		report.TotalCodes, report.ActiveCodes,
+		report.Redemptions,
+		report.UniqueUsers,
+		report.BonusAmount,
+		revenue,
+		conversion)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = h.campaignKeyboard(&report.Campaign)
+
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки отчета кампании: %v", err)
+	}
+
+	return nil
+}
+
+// HandleCampaignExportCallback отправляет CSV-выгрузку промокодов кампании
+func (h *AdminPromoHandler) HandleCampaignExportCallback(chatID int64, userID int64, callbackData string) error {
+	// Проверяем, что пользователь - админ
+	if !IsAdmin(userID) {
+		return h.sendMessage(chatID, "❌ У вас нет прав для выполнения этой команды.")
+	}
+
+	campaignID := strings.TrimPrefix(callbackData, "promo_campaign_csv:")
+
+	data, err := h.service.ExportCampaignCSV(campaignID)
+	if err != nil {
+		log.Printf("PROMO_ADMIN: Ошибка выгрузки кампании %s: %v", campaignID, err)
+		return h.sendMessage(chatID, "❌ Ошибка выгрузки промокодов. Попробуйте позже.")
+	}
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("promo_%s.csv", campaignID),
+		Bytes: data,
+	})
+	doc.Caption = fmt.Sprintf("📥 Промокоды кампании %s", campaignID)
+
+	if _, err := common.GlobalBot.Send(doc); err != nil {
+		return fmt.Errorf("ошибка отправки выгрузки: %v", err)
+	}
+
+	return nil
+}
+
+// HandleCampaignDeactivateCallback отключает кампанию и все ее промокоды
+func (h *AdminPromoHandler) HandleCampaignDeactivateCallback(chatID int64, userID int64, callbackData string) error {
+	// Проверяем, что пользователь - админ
+	if !IsAdmin(userID) {
+		return h.sendMessage(chatID, "❌ У вас нет прав для выполнения этой команды.")
+	}
+
+	campaignID := strings.TrimPrefix(callbackData, "promo_campaign_off:")
+
+	deactivated, err := h.service.DeactivateCampaign(campaignID)
+	if err != nil {
+		log.Printf("PROMO_ADMIN: Ошибка отключения кампании %s: %v", campaignID, err)
+		return h.sendMessage(chatID, "❌ Ошибка отключения кампании. Попробуйте позже.")
+	}
+
+	return h.sendMessage(chatID, fmt.Sprintf("⛔ Кампания <b>%s</b> отключена\n\nДеактивировано промокодов: %d", campaignID, deactivated))
+}
+
+// campaignKeyboard создает клавиатуру действий с кампанией
+func (h *AdminPromoHandler) campaignKeyboard(campaign *PromoCampaign) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📊 Отчет", "promo_campaign:"+campaign.ID),
+			tgbotapi.NewInlineKeyboardButtonData("📥 CSV", "promo_campaign_csv:"+campaign.ID),
+		),
+	}
+
+	if campaign.IsActive {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⛔ Отключить кампанию", "promo_campaign_off:"+campaign.ID),
+		))
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📣 Все кампании", "promo_campaigns"),
+	))
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
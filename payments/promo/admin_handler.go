@@ -78,19 +78,115 @@ func (h *AdminPromoHandler) HandlePromoSetCallback(chatID int64, userID int64, c
 		return h.sendMessage(chatID, "❌ Ошибка создания промокода. Попробуйте позже.")
 	}
 
-	// Отправляем результат
+	return h.sendPromoCreated(chatID, promo)
+}
+
+// HandlePromoCreateCommand обрабатывает команду /promoset с параметрами:
+// /promoset <balance|percent|days|traffic> <значение> [new] [min=<сумма>] [plans=<тариф,тариф>]
+func (h *AdminPromoHandler) HandlePromoCreateCommand(chatID int64, userID int64, args []string) error {
+	// Проверяем, что пользователь - админ
+	if !IsAdmin(userID) {
+		return h.sendMessage(chatID, "❌ У вас нет прав для выполнения этой команды.")
+	}
+
+	template, err := ParsePromoSpec(args)
+	if err != nil {
+		return h.sendMessage(chatID, fmt.Sprintf("❌ %v\n\n%s", err, promoSpecHelp))
+	}
+
+	promo, err := h.service.CreateTypedPromoCode(template, userID)
+	if err != nil {
+		log.Printf("PROMO_ADMIN: Ошибка создания промокода: %v", err)
+		return h.sendMessage(chatID, "❌ Ошибка создания промокода. Попробуйте позже.")
+	}
+
+	return h.sendPromoCreated(chatID, promo)
+}
+
+// HandlePromoTypeCallback показывает варианты значений для выбранного типа промокода
+func (h *AdminPromoHandler) HandlePromoTypeCallback(chatID int64, userID int64, callbackData string) error {
+	// Проверяем, что пользователь - админ
+	if !IsAdmin(userID) {
+		return h.sendMessage(chatID, "❌ У вас нет прав для выполнения этой команды.")
+	}
+
+	promoType := PromoType(strings.TrimPrefix(callbackData, "promo_type:"))
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var title string
+
+	switch promoType {
+	case PromoTypePercent:
+		title = "Выберите размер скидки на следующее пополнение или покупку тарифа:"
+		for _, percent := range PredefinedPercents {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("📉 %.0f%%", percent), fmt.Sprintf("promo_value:%s:%.0f", promoType, percent))))
+		}
+	case PromoTypeDays:
+		title = "Выберите количество бесплатных дней:"
+		for _, days := range PredefinedDays {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("📅 %d дн.", days), fmt.Sprintf("promo_value:%s:%d", promoType, days))))
+		}
+	case PromoTypeTraffic:
+		title = "Выберите объем бонусного трафика:"
+		for _, gb := range PredefinedTrafficGB {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("📶 %d ГБ", gb), fmt.Sprintf("promo_value:%s:%d", promoType, gb))))
+		}
+	default:
+		return h.sendMessage(chatID, "❌ Неизвестный тип промокода.")
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔧 С условиями", "promo_custom"),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, "🎁 <b>Создание промокода</b>\n\n"+title)
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки сообщения: %v", err)
+	}
+
+	return nil
+}
+
+// HandlePromoValueCallback создает промокод выбранного типа и значения
+func (h *AdminPromoHandler) HandlePromoValueCallback(chatID int64, userID int64, callbackData string) error {
+	// Проверяем, что пользователь - админ
+	if !IsAdmin(userID) {
+		return h.sendMessage(chatID, "❌ У вас нет прав для выполнения этой команды.")
+	}
+
+	// Формат: promo_value:<тип>:<значение>
+	parts := strings.Split(callbackData, ":")
+	if len(parts) != 3 || parts[0] != "promo_value" {
+		return h.sendMessage(chatID, "❌ Неверный формат данных.")
+	}
+
+	return h.HandlePromoCreateCommand(chatID, userID, parts[1:])
+}
+
+// sendPromoCreated отправляет админу информацию о созданном промокоде
+func (h *AdminPromoHandler) sendPromoCreated(chatID int64, promo *PromoCode) error {
 	text := fmt.Sprintf("✅ <b>Промокод создан!</b>\n\n"+
 		"🎁 <b>Код:</b> <code>%s</code>\n"+
-		"💰 <b>Сумма:</b> %.2f₽\n"+
+		"💰 <b>Бонус:</b> %s\n"+
 		"⏰ <b>Действует до:</b> %s\n"+
-		"👥 <b>Максимум использований:</b> %d\n\n"+
-		"Пользователь может активировать промокод командой:\n"+
-		"<code>/promo %s</code>",
+		"👥 <b>Максимум использований:</b> %d\n",
 		promo.Code,
-		promo.Amount,
+		DescribePromoValue(promo),
 		promo.ExpiresAt.Format("02.01.2006 15:04"),
-		promo.MaxUses,
-		promo.Code)
+		promo.MaxUses)
+
+	if rules := DescribePromoRules(promo); rules != "" {
+		text += "\n📋 <b>Условия:</b>\n" + rules + "\n"
+	}
+
+	text += fmt.Sprintf("\nПользователь может активировать промокод командой:\n"+
+		"<code>/promo %s</code>", promo.Code)
 
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
@@ -106,7 +202,7 @@ func (h *AdminPromoHandler) HandlePromoSetCallback(chatID int64, userID int64, c
 	)
 	msg.ReplyMarkup = keyboard
 
-	_, err = common.GlobalBot.Send(msg)
+	_, err := common.GlobalBot.Send(msg)
 	if err != nil {
 		return fmt.Errorf("ошибка отправки результата: %v", err)
 	}
@@ -147,6 +243,9 @@ func (h *AdminPromoHandler) HandlePromoStatsCallback(chatID int64, userID int64)
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🎁 Создать новый промокод", "create_promo"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📣 Кампании", "promo_campaigns"),
+		),
 	)
 	msg.ReplyMarkup = keyboard
 
@@ -200,6 +299,13 @@ func (h *AdminPromoHandler) createAmountKeyboard() tgbotapi.InlineKeyboardMarkup
 		rows = append(rows, []tgbotapi.InlineKeyboardButton{button})
 	}
 
+	// Добавляем кнопки для других типов промокодов
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📉 Скидка", "promo_type:percent"),
+		tgbotapi.NewInlineKeyboardButtonData("📅 Дни", "promo_type:days"),
+		tgbotapi.NewInlineKeyboardButtonData("📶 Трафик", "promo_type:traffic"),
+	))
+
 	// Добавляем кнопку для произвольной суммы
 	customButton := tgbotapi.NewInlineKeyboardButtonData(
 		"🔧 Произвольная сумма",
@@ -207,6 +313,11 @@ func (h *AdminPromoHandler) createAmountKeyboard() tgbotapi.InlineKeyboardMarkup
 	)
 	rows = append(rows, []tgbotapi.InlineKeyboardButton{customButton})
 
+	// Добавляем кнопку кампаний
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📣 Кампании", "promo_campaigns"),
+	))
+
 	return tgbotapi.NewInlineKeyboardMarkup(rows...)
 }
 
@@ -217,8 +328,7 @@ func (h *AdminPromoHandler) HandleCustomAmountCallback(chatID int64, userID int6
 		return h.sendMessage(chatID, "❌ У вас нет прав для выполнения этой команды.")
 	}
 
-	text := "🔧 <b>Произвольная сумма</b>\n\n" +
-		"Введите сумму для промокода в рублях (например: 1500):"
+	text := "🔧 <b>Произвольный промокод</b>\n\n" + promoSpecHelp
 
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
@@ -228,12 +338,25 @@ func (h *AdminPromoHandler) HandleCustomAmountCallback(chatID int64, userID int6
 		return fmt.Errorf("ошибка отправки сообщения: %v", err)
 	}
 
-	// Здесь можно добавить логику для ожидания следующего сообщения от пользователя
-	// и обработки произвольной суммы
-
 	return nil
 }
 
+// promoSpecHelp справка по созданию промокода командой /promoset
+const promoSpecHelp = "Создайте промокод командой:\n" +
+	"<code>/promoset тип значение [new] [min=сумма] [plans=тарифы]</code>\n\n" +
+	"<b>Типы:</b>\n" +
+	"• <code>balance 1500</code> - пополнение баланса на 1500₽\n" +
+	"• <code>percent 20</code> - скидка 20% на следующую оплату\n" +
+	"• <code>days 7</code> - 7 бесплатных дней подписки\n" +
+	"• <code>traffic 50</code> - 50 ГБ бонусного трафика\n\n" +
+	"<b>Условия:</b>\n" +
+	"• <code>new</code> - только для новых пользователей\n" +
+	"• <code>min=500</code> - минимальная сумма оплаты (для скидки) или пополнений\n" +
+	"• <code>plans=topup,days_30,traffic_50</code> - тарифы для скидки\n" +
+	"• <code>uses=100</code> - максимум использований\n" +
+	"• <code>valid=30</code> - срок действия в днях\n\n" +
+	"<b>Пример:</b> <code>/promoset percent 15 new min=300 plans=topup</code>"
+
 // sendMessage отправляет текстовое сообщение
 func (h *AdminPromoHandler) sendMessage(chatID int64, text string) error {
 	msg := tgbotapi.NewMessage(chatID, text)
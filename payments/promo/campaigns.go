@@ -0,0 +1,305 @@
+package promo
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// createCampaignTables создает таблицу кампаний промокодов
+func createCampaignTables(db *sql.DB) error {
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS promo_campaigns (
+		id VARCHAR(64) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		created_by BIGINT NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		is_active BOOLEAN NOT NULL DEFAULT true
+	);`
+
+	indexSQL := `CREATE INDEX IF NOT EXISTS idx_promo_codes_campaign_id ON promo_codes(campaign_id);`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы promo_campaigns: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов кампаний: %v", err)
+	}
+
+	return nil
+}
+
+// campaignIDFromName формирует ID кампании из названия (строчные латинские буквы, цифры, _ и -)
+func campaignIDFromName(name string) (string, error) {
+	var id strings.Builder
+	for _, char := range strings.ToLower(name) {
+		if (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') || char == '_' || char == '-' {
+			id.WriteRune(char)
+		}
+	}
+
+	if id.Len() == 0 || id.Len() > 32 {
+		return "", fmt.Errorf("название кампании должно содержать от 1 до 32 латинских букв, цифр, _ или -")
+	}
+
+	return id.String(), nil
+}
+
+// GetOrCreateCampaign возвращает кампанию по названию, создавая ее при необходимости
+func (ps *PromoService) GetOrCreateCampaign(name string, createdBy int64) (*PromoCampaign, error) {
+	campaignID, err := campaignIDFromName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ps.db.Exec(`
+		INSERT INTO promo_campaigns (id, name, created_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO NOTHING`, campaignID, name, createdBy)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания кампании: %v", err)
+	}
+
+	return ps.GetCampaign(campaignID)
+}
+
+// GetCampaign возвращает кампанию по ID
+func (ps *PromoService) GetCampaign(campaignID string) (*PromoCampaign, error) {
+	var campaign PromoCampaign
+	err := ps.db.QueryRow(`
+		SELECT id, name, created_by, created_at, is_active
+		FROM promo_campaigns WHERE id = $1`, campaignID).Scan(
+		&campaign.ID, &campaign.Name, &campaign.CreatedBy, &campaign.CreatedAt, &campaign.IsActive)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("кампания %s не найдена", campaignID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения кампании: %v", err)
+	}
+
+	return &campaign, nil
+}
+
+// GetCampaigns возвращает последние кампании
+func (ps *PromoService) GetCampaigns(limit int) ([]PromoCampaign, error) {
+	rows, err := ps.db.Query(`
+		SELECT id, name, created_by, created_at, is_active
+		FROM promo_campaigns
+		ORDER BY created_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения кампаний: %v", err)
+	}
+	defer rows.Close()
+
+	var campaigns []PromoCampaign
+	for rows.Next() {
+		var campaign PromoCampaign
+		if err := rows.Scan(&campaign.ID, &campaign.Name, &campaign.CreatedBy, &campaign.CreatedAt, &campaign.IsActive); err != nil {
+			return nil, fmt.Errorf("ошибка чтения кампании: %v", err)
+		}
+		campaigns = append(campaigns, campaign)
+	}
+
+	return campaigns, rows.Err()
+}
+
+// CreateCampaignCodes создает пачку промокодов по шаблону в рамках кампании.
+// Если в шаблоне задан именной код, создается ровно один промокод.
+func (ps *PromoService) CreateCampaignCodes(campaign *PromoCampaign, template *PromoCode, count int, createdBy int64) ([]*PromoCode, error) {
+	if !campaign.IsActive {
+		return nil, fmt.Errorf("кампания %s отключена", campaign.Name)
+	}
+
+	if template.Code != "" {
+		count = 1
+	}
+
+	if count <= 0 || count > MaxCampaignBatchSize {
+		return nil, fmt.Errorf("количество промокодов должно быть от 1 до %d", MaxCampaignBatchSize)
+	}
+
+	template.CampaignID = campaign.ID
+
+	var created []*PromoCode
+	for i := 0; i < count; i++ {
+		promo, err := ps.CreateTypedPromoCode(template, createdBy)
+		if err != nil {
+			if len(created) > 0 {
+				log.Printf("PROMO: Создание пачки промокодов кампании %s прервано после %d из %d: %v",
+					campaign.ID, len(created), count, err)
+			}
+			return created, err
+		}
+		created = append(created, promo)
+	}
+
+	log.Printf("PROMO: В кампании %s создано промокодов: %d", campaign.ID, len(created))
+
+	return created, nil
+}
+
+// DeactivateCampaign отключает кампанию и все ее промокоды. Возвращает количество отключенных промокодов.
+func (ps *PromoService) DeactivateCampaign(campaignID string) (int64, error) {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE promo_campaigns SET is_active = false WHERE id = $1", campaignID); err != nil {
+		return 0, fmt.Errorf("ошибка отключения кампании: %v", err)
+	}
+
+	result, err := tx.Exec("UPDATE promo_codes SET is_active = false WHERE campaign_id = $1 AND is_active = true", campaignID)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка отключения промокодов кампании: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения количества обновленных строк: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка коммита транзакции: %v", err)
+	}
+
+	log.Printf("PROMO: Кампания %s отключена, деактивировано промокодов: %d", campaignID, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// GetCampaignCodes возвращает все промокоды кампании
+func (ps *PromoService) GetCampaignCodes(campaignID string) ([]*PromoCode, error) {
+	query := fmt.Sprintf("SELECT %s FROM promo_codes WHERE campaign_id = $1 ORDER BY created_at, code", promoCodeColumns)
+	rows, err := ps.db.Query(query, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения промокодов кампании: %v", err)
+	}
+	defer rows.Close()
+
+	var codes []*PromoCode
+	for rows.Next() {
+		promo, err := scanPromoCode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения промокода: %v", err)
+		}
+		codes = append(codes, promo)
+	}
+
+	return codes, rows.Err()
+}
+
+// GetCampaignReport формирует отчет по активациям и выручке кампании
+func (ps *PromoService) GetCampaignReport(campaignID string) (*PromoCampaignReport, error) {
+	campaign, err := ps.GetCampaign(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PromoCampaignReport{Campaign: *campaign}
+
+	err = ps.db.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE is_active AND expires_at > NOW() AND usage_count < max_uses)
+		FROM promo_codes WHERE campaign_id = $1`, campaignID).Scan(&report.TotalCodes, &report.ActiveCodes)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета промокодов кампании: %v", err)
+	}
+
+	err = ps.db.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT pu.user_id), COALESCE(SUM(pu.amount), 0)
+		FROM promo_usage pu
+		JOIN promo_codes pc ON pu.promo_id = pc.id
+		WHERE pc.campaign_id = $1`, campaignID).Scan(&report.Redemptions, &report.UniqueUsers, &report.BonusAmount)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета активаций кампании: %v", err)
+	}
+
+	// Выручка - пополнения участников после первой активации, включая оплату со скидкой кампании
+	err = ps.db.QueryRow(`
+		WITH redeemers AS (
+			SELECT pu.user_id, MIN(pu.used_at) AS first_used
+			FROM promo_usage pu
+			JOIN promo_codes pc ON pu.promo_id = pc.id
+			WHERE pc.campaign_id = $1
+			GROUP BY pu.user_id
+		)
+		SELECT COALESCE(SUM(cr.amount), 0), COUNT(DISTINCT cr.user_id)
+		FROM payment_credits cr
+		JOIN redeemers r ON cr.user_id = r.user_id
+		WHERE cr.kind = 'credit' AND (cr.created_at >= r.first_used OR cr.payment_id IN (
+			SELECT pd.payment_id FROM promo_discounts pd
+			JOIN promo_codes pc ON pd.promo_id = pc.id
+			WHERE pc.campaign_id = $1 AND pd.payment_id IS NOT NULL
+		))`, campaignID).Scan(&report.Revenue, &report.PayingUsers)
+	if err != nil {
+		// Таблица зачислений создается платежной системой и может отсутствовать
+		log.Printf("PROMO: Ошибка подсчета выручки кампании %s: %v", campaignID, err)
+		report.RevenueFailed = true
+	}
+
+	return report, nil
+}
+
+// ExportCampaignCSV выгружает промокоды кампании в CSV
+func (ps *PromoService) ExportCampaignCSV(campaignID string) ([]byte, error) {
+	codes, err := ps.GetCampaignCodes(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	header := []string{"code", "type", "value", "max_uses", "usage_count", "new_users_only", "min_topup", "plans", "expires_at", "is_active", "created_at"}
+	if err := writer.Write(header); err != nil {
+		return nil, fmt.Errorf("ошибка записи CSV: %v", err)
+	}
+
+	for _, promo := range codes {
+		record := []string{
+			promo.Code,
+			string(promo.Type),
+			promoValueString(promo),
+			strconv.Itoa(promo.MaxUses),
+			strconv.Itoa(promo.UsageCount),
+			strconv.FormatBool(promo.NewUsersOnly),
+			strconv.FormatFloat(promo.MinTopup, 'f', 2, 64),
+			strings.Join(promo.Plans, ","),
+			promo.ExpiresAt.Format(time.RFC3339),
+			strconv.FormatBool(promo.IsActive),
+			promo.CreatedAt.Format(time.RFC3339),
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, fmt.Errorf("ошибка записи CSV: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("ошибка записи CSV: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// promoValueString возвращает значение промокода в зависимости от типа (для выгрузки)
+func promoValueString(promo *PromoCode) string {
+	switch promo.Type {
+	case PromoTypePercent:
+		return strconv.FormatFloat(promo.Percent, 'f', -1, 64)
+	case PromoTypeDays:
+		return strconv.Itoa(promo.Days)
+	case PromoTypeTraffic:
+		return strconv.Itoa(promo.TrafficGB)
+	default:
+		return strconv.FormatFloat(promo.Amount, 'f', 2, 64)
+	}
+}
@@ -0,0 +1,171 @@
+package promo
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func TestCampaignIDFromName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string // Пустая строка - ожидается ошибка
+	}{
+		{"Spring-2026", "spring-2026"},
+		{"blogger_ivan", "blogger_ivan"},
+		{"Весна 25", "25"},
+		{"Весна", ""},
+		{strings.Repeat("a", 33), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := campaignIDFromName(tt.name)
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("Ожидалась ошибка, получен ID %s", id)
+				}
+				return
+			}
+			if err != nil || id != tt.expected {
+				t.Errorf("Получено %q (%v), ожидалось %q", id, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCreateCampaignCodesValidation(t *testing.T) {
+	// Проверки выполняются до обращения к базе
+	ps := &PromoService{}
+	template := &PromoCode{Type: PromoTypeBalance, Amount: 100}
+
+	if _, err := ps.CreateCampaignCodes(&PromoCampaign{ID: "off", Name: "off"}, template, 1, 1); err == nil {
+		t.Error("Ожидалась ошибка для отключенной кампании")
+	}
+
+	active := &PromoCampaign{ID: "spring", Name: "spring", IsActive: true}
+	for _, count := range []int{0, -1, MaxCampaignBatchSize + 1} {
+		if _, err := ps.CreateCampaignCodes(active, template, count, 1); err == nil {
+			t.Errorf("Ожидалась ошибка для количества %d", count)
+		}
+	}
+}
+
+// newTestPromoService создает сервис промокодов в отдельной схеме тестовой базы PROMO_TEST_DATABASE_URL
+func newTestPromoService(t *testing.T) *PromoService {
+	dsn := os.Getenv("PROMO_TEST_DATABASE_URL")
+	if testing.Short() || dsn == "" {
+		t.Skip("Пропуск интеграционного теста: не задана переменная PROMO_TEST_DATABASE_URL")
+	}
+
+	schema := fmt.Sprintf("promo_test_%d", time.Now().UnixNano())
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Ошибка подключения к базе: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Ошибка создания схемы: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	separator := " "
+	if strings.Contains(dsn, "://") {
+		separator = "&"
+		if !strings.Contains(dsn, "?") {
+			separator = "?"
+		}
+	}
+	db, err := sql.Open("postgres", dsn+separator+"search_path="+schema)
+	if err != nil {
+		t.Fatalf("Ошибка подключения к схеме: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := createTables(db); err != nil {
+		t.Fatalf("Ошибка создания таблиц: %v", err)
+	}
+	return &PromoService{db: db}
+}
+
+func TestCreateTypedPromoCodeUniqueIntegration(t *testing.T) {
+	ps := newTestPromoService(t)
+
+	if _, err := ps.CreateTypedPromoCode(&PromoCode{Type: PromoTypeTraffic, TrafficGB: 5, Code: "Spring25"}, 1); err != nil {
+		t.Fatalf("Ошибка создания промокода: %v", err)
+	}
+
+	// Параллельное создание кода, отличающегося только регистром, должно завершиться ошибкой у всех
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for _, code := range []string{"SPRING25", "spring25", "sPrInG25"} {
+		wg.Add(1)
+		go func(code string) {
+			defer wg.Done()
+			if _, err := ps.CreateTypedPromoCode(&PromoCode{Type: PromoTypeTraffic, TrafficGB: 5, Code: code}, 1); err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(code)
+	}
+	wg.Wait()
+	if created != 0 {
+		t.Errorf("Создано %d дублей промокода", created)
+	}
+
+	campaign := &PromoCampaign{ID: "batch", Name: "batch", IsActive: true}
+	codes, err := ps.CreateCampaignCodes(campaign, &PromoCode{Type: PromoTypeTraffic, TrafficGB: 1}, 20, 1)
+	if err != nil || len(codes) != 20 {
+		t.Fatalf("Создано %d промокодов кампании (%v), ожидалось 20", len(codes), err)
+	}
+	for _, promo := range codes {
+		if promo.CampaignID != campaign.ID {
+			t.Errorf("Промокод %s без кампании", promo.Code)
+		}
+	}
+}
+
+func TestUsePromoCodeOncePerUserIntegration(t *testing.T) {
+	ps := newTestPromoService(t)
+
+	promo, err := ps.CreateTypedPromoCode(&PromoCode{Type: PromoTypeTraffic, TrafficGB: 5, MaxUses: 10}, 1)
+	if err != nil {
+		t.Fatalf("Ошибка создания промокода: %v", err)
+	}
+
+	if _, status, err := ps.ValidatePromoCode(strings.ToUpper(promo.Code), 42, nil); err != nil || status != PromoCodeActive {
+		t.Fatalf("Статус промокода %s (%v), ожидался активный", status.String(), err)
+	}
+
+	// Одновременные активации одним пользователем: засчитывается только одна
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	used := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ps.UsePromoCode(promo.Code, 42); err == nil {
+				mu.Lock()
+				used++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if used != 1 {
+		t.Errorf("Промокод активирован %d раз, ожидалась одна активация", used)
+	}
+
+	if _, status, err := ps.ValidatePromoCode(promo.Code, 42, nil); err != nil || status != PromoCodeAlreadyUsedByUser {
+		t.Errorf("Статус после активации %s (%v), ожидалось повторное использование", status.String(), err)
+	}
+}
@@ -0,0 +1,290 @@
+package promo
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+
+	"bot/common"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// createDiscountTables создает таблицы скидок и бонусного трафика по промокодам
+func createDiscountTables(db *sql.DB) error {
+	discountsTableSQL := `
+	CREATE TABLE IF NOT EXISTS promo_discounts (
+		id SERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		promo_id VARCHAR(255) NOT NULL REFERENCES promo_codes(id) ON DELETE CASCADE,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		payment_id VARCHAR(255),
+		amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		applied_at TIMESTAMP WITH TIME ZONE
+	);`
+
+	trafficTableSQL := `
+	CREATE TABLE IF NOT EXISTS promo_traffic_bonuses (
+		id SERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		promo_id VARCHAR(255) NOT NULL REFERENCES promo_codes(id) ON DELETE CASCADE,
+		traffic_gb INTEGER NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);`
+
+	indexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_promo_discounts_user_id ON promo_discounts(user_id);
+	CREATE INDEX IF NOT EXISTS idx_promo_discounts_payment_id ON promo_discounts(payment_id);
+	CREATE INDEX IF NOT EXISTS idx_promo_traffic_bonuses_user_id ON promo_traffic_bonuses(user_id);`
+
+	if _, err := db.Exec(discountsTableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы promo_discounts: %v", err)
+	}
+
+	if _, err := db.Exec(trafficTableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы promo_traffic_bonuses: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов скидок: %v", err)
+	}
+
+	return nil
+}
+
+// attachDiscount сохраняет активированную скидку до следующей оплаты (заменяет предыдущую неиспользованную).
+// Неиспользованная скидка занимает одно использование промокода, пока не будет применена или заменена.
+func (ps *PromoService) attachDiscount(promo *PromoCode, userID int64) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Блокируем промокод: параллельные активации считают занятые использования по очереди
+	var usageCount, maxUses, attached int
+	err = tx.QueryRow(`SELECT usage_count, max_uses FROM promo_codes WHERE id = $1 AND is_active = true FOR UPDATE`,
+		promo.ID).Scan(&usageCount, &maxUses)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("промокод не может быть использован: %s", PromoCodeNotFound.String())
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка получения промокода: %v", err)
+	}
+
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM promo_discounts
+		WHERE promo_id = $1 AND user_id <> $2 AND status IN ($3, $4)`,
+		promo.ID, userID, PromoDiscountPending, PromoDiscountReserved).Scan(&attached)
+	if err != nil {
+		return fmt.Errorf("ошибка подсчета активированных скидок: %v", err)
+	}
+	if usageCount+attached >= maxUses {
+		return fmt.Errorf("промокод не может быть использован: %s", PromoCodeMaxUsesReached.String())
+	}
+
+	_, err = tx.Exec(`DELETE FROM promo_discounts WHERE user_id = $1 AND status IN ($2, $3)`,
+		userID, PromoDiscountPending, PromoDiscountReserved)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления предыдущей скидки: %v", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO promo_discounts (user_id, promo_id, status) VALUES ($1, $2, $3)`,
+		userID, promo.ID, PromoDiscountPending)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения скидки: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка коммита транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// GetPendingDiscount возвращает неиспользованную скидку пользователя или nil
+func (ps *PromoService) GetPendingDiscount(userID int64) (*PromoDiscount, error) {
+	query := `
+		SELECT pd.id, pd.user_id, pd.promo_id, pc.code, pc.percent, pd.status, pd.payment_id, pd.amount, pd.created_at
+		FROM promo_discounts pd
+		JOIN promo_codes pc ON pd.promo_id = pc.id
+		WHERE pd.user_id = $1 AND pd.status IN ($2, $3)
+		ORDER BY pd.created_at DESC
+		LIMIT 1`
+
+	discount, err := scanPromoDiscount(ps.db.QueryRow(query, userID, PromoDiscountPending, PromoDiscountReserved))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения скидки: %v", err)
+	}
+
+	return discount, nil
+}
+
+// GetCheckoutDiscount рассчитывает скидку пользователя для оплаты.
+// Возвращает nil, если скидки нет; статус показывает, почему скидка не применяется.
+func (ps *PromoService) GetCheckoutDiscount(userID int64, checkout PromoCheckout) (*PromoDiscount, PromoCodeStatus, error) {
+	discount, err := ps.GetPendingDiscount(userID)
+	if err != nil || discount == nil {
+		return nil, PromoCodeNotFound, err
+	}
+
+	promo, status, err := ps.ValidatePromoCode(discount.Code, userID, &checkout)
+	if err != nil {
+		return nil, status, err
+	}
+	if status != PromoCodeActive {
+		return nil, status, nil
+	}
+
+	discount.Percent = promo.Percent
+	discount.Amount = math.Round(checkout.Amount*promo.Percent) / 100
+
+	return discount, PromoCodeActive, nil
+}
+
+// ReserveDiscount привязывает скидку к созданному платежу - она будет применена после его зачисления
+func (ps *PromoService) ReserveDiscount(discount *PromoDiscount, paymentID string) error {
+	_, err := ps.db.Exec(`
+		UPDATE promo_discounts SET status = $1, payment_id = $2, amount = $3
+		WHERE id = $4`, PromoDiscountReserved, paymentID, discount.Amount, discount.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка резервирования скидки: %v", err)
+	}
+
+	discount.Status = PromoDiscountReserved
+	discount.PaymentID = sql.NullString{String: paymentID, Valid: true}
+	return nil
+}
+
+// ApplyDiscount отмечает промокод использованным.
+// creditBonus - зачислить сумму скидки на баланс (при пополнении пользователь платит меньше, а получает полную сумму).
+func (ps *PromoService) ApplyDiscount(discount *PromoDiscount, creditBonus bool) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := applyDiscountTx(tx, discount, creditBonus); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка коммита транзакции: %v", err)
+	}
+
+	discount.Status = PromoDiscountApplied
+
+	if creditBonus {
+		common.ForceBalanceRecalculation(discount.UserID)
+	}
+
+	log.Printf("PROMO: Скидка по промокоду %s применена для пользователя %d: %.2f₽",
+		discount.Code, discount.UserID, discount.Amount)
+
+	return nil
+}
+
+// applyDiscountTx отмечает скидку и промокод использованными в рамках транзакции.
+// Возвращает ошибку, если скидка уже применена или лимит использований промокода исчерпан.
+func applyDiscountTx(tx *sql.Tx, discount *PromoDiscount, creditBonus bool) error {
+	result, err := tx.Exec(`
+		UPDATE promo_discounts SET status = $1, amount = $2, applied_at = NOW()
+		WHERE id = $3 AND status IN ($4, $5)`,
+		PromoDiscountApplied, discount.Amount, discount.ID, PromoDiscountPending, PromoDiscountReserved)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления скидки: %v", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("ошибка получения количества обновленных строк: %v", err)
+	} else if rows == 0 {
+		return fmt.Errorf("скидка по промокоду %s уже использована", discount.Code)
+	}
+
+	result, err = tx.Exec(`
+		UPDATE promo_codes
+		SET used_by = $1, used_at = NOW(), usage_count = usage_count + 1
+		WHERE id = $2 AND usage_count < max_uses`, discount.UserID, discount.PromoID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления промокода: %v", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("ошибка получения количества обновленных строк: %v", err)
+	} else if rows == 0 {
+		return fmt.Errorf("лимит использований промокода %s исчерпан", discount.Code)
+	}
+
+	result, err = tx.Exec(`
+		INSERT INTO promo_usage (promo_id, user_id, amount, used_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT DO NOTHING`, discount.PromoID, discount.UserID, discount.Amount)
+	if err != nil {
+		return fmt.Errorf("ошибка записи использования промокода: %v", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("ошибка получения количества вставленных строк: %v", err)
+	} else if rows == 0 {
+		return fmt.Errorf("промокод %s уже использован пользователем %d", discount.Code, discount.UserID)
+	}
+
+	if creditBonus {
+		balanceQuery := "UPDATE users SET balance = balance + $1, updated_at = NOW() WHERE telegram_id = $2"
+		if _, err := tx.Exec(balanceQuery, discount.Amount, discount.UserID); err != nil {
+			return fmt.Errorf("ошибка пополнения баланса: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// applyPaymentDiscount применяет зарезервированную скидку после зачисления платежа
+func (ps *PromoService) applyPaymentDiscount(paymentInfo *paymentCommon.PaymentInfo) {
+	query := `
+		SELECT pd.id, pd.user_id, pd.promo_id, pc.code, pc.percent, pd.status, pd.payment_id, pd.amount, pd.created_at
+		FROM promo_discounts pd
+		JOIN promo_codes pc ON pd.promo_id = pc.id
+		WHERE pd.payment_id = $1 AND pd.status = $2`
+
+	discount, err := scanPromoDiscount(ps.db.QueryRow(query, paymentInfo.ID, PromoDiscountReserved))
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("PROMO: Ошибка получения скидки для платежа %s: %v", paymentInfo.ID, err)
+		return
+	}
+
+	if err := ps.ApplyDiscount(discount, true); err != nil {
+		log.Printf("PROMO: Ошибка применения скидки для платежа %s: %v", paymentInfo.ID, err)
+		return
+	}
+
+	if common.GlobalBot != nil {
+		text := fmt.Sprintf("🎁 <b>Скидка по промокоду применена!</b>\n\n"+
+			"🎟 <b>Код:</b> <code>%s</code>\n"+
+			"💰 <b>Дополнительно зачислено:</b> %.2f₽",
+			discount.Code, discount.Amount)
+		msg := tgbotapi.NewMessage(discount.UserID, text)
+		msg.ParseMode = "HTML"
+		if _, err := common.GlobalBot.Send(msg); err != nil {
+			log.Printf("PROMO: Ошибка отправки уведомления о скидке пользователю %d: %v", discount.UserID, err)
+		}
+	}
+}
+
+// scanPromoDiscount читает скидку из строки результата запроса
+func scanPromoDiscount(row *sql.Row) (*PromoDiscount, error) {
+	var discount PromoDiscount
+	err := row.Scan(&discount.ID, &discount.UserID, &discount.PromoID, &discount.Code, &discount.Percent,
+		&discount.Status, &discount.PaymentID, &discount.Amount, &discount.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &discount, nil
+}
@@ -1,12 +1,14 @@
 package promo
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"strings"
 	"time"
 
 	"bot/common"
+	paymentCommon "bot/payments/common"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -52,6 +54,9 @@ func InitializePromoManager() error {
 	// Устанавливаем глобальный экземпляр
 	GlobalPromoManager = manager
 
+	// Скидки на пополнение применяются после зачисления платежа
+	paymentCommon.RegisterCreditHook(service.applyPaymentDiscount)
+
 	// Запускаем очистку истекших промокодов
 	go manager.startCleanupRoutine()
 
@@ -63,7 +68,12 @@ func InitializePromoManager() error {
 func (pm *PromoManager) HandleCommand(chatID int64, userID int64, command string, args []string) error {
 	switch command {
 	case "promoset":
+		if len(args) > 0 {
+			return pm.adminHandler.HandlePromoCreateCommand(chatID, userID, args)
+		}
 		return pm.adminHandler.HandlePromoSetCommand(chatID, userID)
+	case "promocampaign":
+		return pm.adminHandler.HandlePromoCampaignCommand(chatID, userID, args)
 	case "promo":
 		return pm.userHandler.HandlePromoCommand(chatID, userID, args)
 	case "promohistory":
@@ -79,6 +89,14 @@ func (pm *PromoManager) HandleCallback(chatID int64, userID int64, callbackData
 		return pm.adminHandler.HandlePromoSetCallback(chatID, userID, callbackData)
 	}
 
+	if strings.HasPrefix(callbackData, "promo_type:") {
+		return pm.adminHandler.HandlePromoTypeCallback(chatID, userID, callbackData)
+	}
+
+	if strings.HasPrefix(callbackData, "promo_value:") {
+		return pm.adminHandler.HandlePromoValueCallback(chatID, userID, callbackData)
+	}
+
 	switch callbackData {
 	case "promo_stats":
 		return pm.adminHandler.HandlePromoStatsCallback(chatID, userID)
@@ -86,6 +104,20 @@ func (pm *PromoManager) HandleCallback(chatID int64, userID int64, callbackData
 		return pm.adminHandler.HandlePromoSetCommand(chatID, userID)
 	case "promo_custom":
 		return pm.adminHandler.HandleCustomAmountCallback(chatID, userID)
+	case "promo_campaigns":
+		return pm.adminHandler.HandleCampaignsCallback(chatID, userID)
+	}
+
+	if strings.HasPrefix(callbackData, "promo_campaign:") {
+		return pm.adminHandler.HandleCampaignReportCallback(chatID, userID, callbackData)
+	}
+
+	if strings.HasPrefix(callbackData, "promo_campaign_csv:") {
+		return pm.adminHandler.HandleCampaignExportCallback(chatID, userID, callbackData)
+	}
+
+	if strings.HasPrefix(callbackData, "promo_campaign_off:") {
+		return pm.adminHandler.HandleCampaignDeactivateCallback(chatID, userID, callbackData)
 	}
 
 	if strings.HasPrefix(callbackData, "copy_promo:") {
@@ -97,7 +129,7 @@ func (pm *PromoManager) HandleCallback(chatID int64, userID int64, callbackData
 
 // IsPromoCommand проверяет, является ли команда командой промокодов
 func (pm *PromoManager) IsPromoCommand(command string) bool {
-	promoCommands := []string{"promoset", "promo", "promohistory"}
+	promoCommands := []string{"promoset", "promocampaign", "promo", "promohistory"}
 
 	for _, promoCmd := range promoCommands {
 		if command == promoCmd {
@@ -112,9 +144,12 @@ func (pm *PromoManager) IsPromoCommand(command string) bool {
 func (pm *PromoManager) IsPromoCallback(callbackData string) bool {
 	promoCallbacks := []string{
 		"promo_amount:",
+		"promo_type:",
+		"promo_value:",
 		"promo_stats",
 		"create_promo",
 		"promo_custom",
+		"promo_campaign",
 		"copy_promo:",
 	}
 
@@ -157,11 +192,11 @@ func (pm *PromoManager) startCleanupRoutine() {
 // SendPromoNotification отправляет уведомление о создании промокода (опционально)
 func (pm *PromoManager) SendPromoNotification(chatID int64, promo *PromoCode) error {
 	text := fmt.Sprintf("🎁 <b>Новый промокод!</b>\n\n"+
-		"💰 <b>Сумма:</b> %.2f₽\n"+
+		"💰 <b>Бонус:</b> %s\n"+
 		"⏰ <b>Действует до:</b> %s\n\n"+
 		"Для активации используйте команду:\n"+
 		"<code>/promo %s</code>",
-		promo.Amount,
+		DescribePromoValue(promo),
 		promo.ExpiresAt.Format("02.01.2006 15:04"),
 		promo.Code)
 
@@ -174,7 +209,43 @@ func (pm *PromoManager) SendPromoNotification(chatID int64, promo *PromoCode) er
 
 // ValidatePromoCode проверяет валидность промокода без его использования
 func (pm *PromoManager) ValidatePromoCode(code string, userID int64) (*PromoCode, PromoCodeStatus, error) {
-	return pm.service.ValidatePromoCode(code, userID)
+	return pm.service.ValidatePromoCode(code, userID, nil)
+}
+
+// GetCheckoutDiscount возвращает скидку пользователя для оплаты или nil, если скидка не применяется
+func (pm *PromoManager) GetCheckoutDiscount(userID int64, checkout PromoCheckout) *PromoDiscount {
+	discount, status, err := pm.service.GetCheckoutDiscount(userID, checkout)
+	if err != nil {
+		log.Printf("PROMO_MANAGER: Ошибка расчета скидки для пользователя %d: %v", userID, err)
+		return nil
+	}
+
+	if discount == nil && status != PromoCodeNotFound {
+		log.Printf("PROMO_MANAGER: Скидка пользователя %d не применена к %s (%.2f₽): %s",
+			userID, checkout.Plan, checkout.Amount, status.String())
+	}
+
+	return discount
+}
+
+// ReserveDiscount привязывает скидку к созданному платежу
+func (pm *PromoManager) ReserveDiscount(discount *PromoDiscount, paymentID string) error {
+	return pm.service.ReserveDiscount(discount, paymentID)
+}
+
+// ApplyDiscount отмечает скидку использованной при оплате с баланса
+func (pm *PromoManager) ApplyDiscount(discount *PromoDiscount) error {
+	return pm.service.ApplyDiscount(discount, false)
+}
+
+// ApplyDiscountTx отмечает скидку использованной в транзакции покупки с баланса:
+// повторная покупка со скидкой, уже примененной другой транзакцией, завершится ошибкой
+func (pm *PromoManager) ApplyDiscountTx(tx *sql.Tx, discount *PromoDiscount) error {
+	if err := applyDiscountTx(tx, discount, false); err != nil {
+		return err
+	}
+	discount.Status = PromoDiscountApplied
+	return nil
 }
 
 // GetService возвращает сервис промокодов (для внутреннего использования)
@@ -0,0 +1,240 @@
+package promo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validatePromoTemplate проверяет значение и условия промокода перед созданием
+func validatePromoTemplate(template *PromoCode) error {
+	if template.Type == "" {
+		template.Type = PromoTypeBalance
+	}
+
+	switch template.Type {
+	case PromoTypeBalance:
+		if template.Amount <= 0 {
+			return fmt.Errorf("сумма промокода должна быть больше нуля")
+		}
+	case PromoTypePercent:
+		if template.Percent <= 0 || template.Percent > MaxPromoPercent {
+			return fmt.Errorf("процент скидки должен быть от 1 до %d", MaxPromoPercent)
+		}
+	case PromoTypeDays:
+		if template.Days <= 0 {
+			return fmt.Errorf("количество дней должно быть больше нуля")
+		}
+	case PromoTypeTraffic:
+		if template.TrafficGB <= 0 {
+			return fmt.Errorf("объем трафика должен быть больше нуля")
+		}
+	default:
+		return fmt.Errorf("неизвестный тип промокода: %s", template.Type)
+	}
+
+	if template.Code != "" {
+		if err := ValidatePromoCodeFormat(template.Code); err != nil {
+			return err
+		}
+	}
+
+	if template.MaxUses < 0 {
+		return fmt.Errorf("лимит использований не может быть отрицательным")
+	}
+
+	if template.MinTopup < 0 {
+		return fmt.Errorf("минимальная сумма не может быть отрицательной")
+	}
+
+	for _, plan := range template.Plans {
+		if plan != PromoPlanTopup && !strings.HasPrefix(plan, promoPlanDaysPrefix) && !strings.HasPrefix(plan, promoPlanTrafficPrefix) {
+			return fmt.Errorf("неизвестный тариф: %s", plan)
+		}
+	}
+
+	return nil
+}
+
+// AppliesToPlan проверяет, действует ли промокод для указанного тарифа
+func (p *PromoCode) AppliesToPlan(plan string) bool {
+	if len(p.Plans) == 0 {
+		return true
+	}
+
+	for _, allowed := range p.Plans {
+		if allowed == plan {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitPlans разбирает список тарифов, сохраненный через запятую
+func splitPlans(plans string) []string {
+	var result []string
+	for _, plan := range strings.Split(plans, ",") {
+		if plan = strings.TrimSpace(plan); plan != "" {
+			result = append(result, plan)
+		}
+	}
+	return result
+}
+
+// ParsePromoSpec разбирает аргументы команды /promoset:
+// <тип> <значение> [new] [min=<сумма>] [plans=<тариф,тариф>] [uses=<количество>] [valid=<дней>]
+func ParsePromoSpec(args []string) (*PromoCode, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("укажите тип и значение промокода")
+	}
+
+	template := &PromoCode{Type: PromoType(strings.ToLower(args[0]))}
+
+	switch template.Type {
+	case PromoTypeBalance, PromoTypePercent:
+		value, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("неверное значение: %s", args[1])
+		}
+		if template.Type == PromoTypeBalance {
+			template.Amount = value
+		} else {
+			template.Percent = value
+		}
+	case PromoTypeDays, PromoTypeTraffic:
+		value, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("неверное значение: %s", args[1])
+		}
+		if template.Type == PromoTypeDays {
+			template.Days = value
+		} else {
+			template.TrafficGB = value
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный тип промокода: %s", args[0])
+	}
+
+	for _, arg := range args[2:] {
+		switch {
+		case arg == "new":
+			template.NewUsersOnly = true
+		case strings.HasPrefix(arg, "min="):
+			minTopup, err := strconv.ParseFloat(strings.TrimPrefix(arg, "min="), 64)
+			if err != nil {
+				return nil, fmt.Errorf("неверная минимальная сумма: %s", arg)
+			}
+			template.MinTopup = minTopup
+		case strings.HasPrefix(arg, "plans="):
+			template.Plans = splitPlans(strings.TrimPrefix(arg, "plans="))
+		case strings.HasPrefix(arg, "uses="):
+			maxUses, err := strconv.Atoi(strings.TrimPrefix(arg, "uses="))
+			if err != nil || maxUses <= 0 {
+				return nil, fmt.Errorf("неверный лимит использований: %s", arg)
+			}
+			template.MaxUses = maxUses
+		case strings.HasPrefix(arg, "valid="):
+			validDays, err := strconv.Atoi(strings.TrimPrefix(arg, "valid="))
+			if err != nil || validDays <= 0 {
+				return nil, fmt.Errorf("неверный срок действия: %s", arg)
+			}
+			template.ExpiresAt = time.Now().AddDate(0, 0, validDays)
+		default:
+			return nil, fmt.Errorf("неизвестный параметр: %s", arg)
+		}
+	}
+
+	if err := validatePromoTemplate(template); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// DescribePromoValue возвращает краткое описание бонуса по промокоду
+func DescribePromoValue(p *PromoCode) string {
+	return describeReward(p.Type, p.Amount, p.Percent, p.Days, p.TrafficGB)
+}
+
+// describeUsage возвращает описание полученного по промокоду бонуса
+func describeUsage(u *PromoUsage) string {
+	if u.Type == PromoTypePercent {
+		return fmt.Sprintf("скидка %.0f%% (%.2f₽)", u.Percent, u.Amount)
+	}
+	return describeReward(u.Type, u.Amount, u.Percent, u.Days, u.TrafficGB)
+}
+
+// describeReward форматирует бонус по типу промокода
+func describeReward(promoType PromoType, amount, percent float64, days, trafficGB int) string {
+	switch promoType {
+	case PromoTypePercent:
+		return fmt.Sprintf("скидка %.0f%%", percent)
+	case PromoTypeDays:
+		return fmt.Sprintf("%d бесплатных дн.", days)
+	case PromoTypeTraffic:
+		return fmt.Sprintf("+%d ГБ трафика", trafficGB)
+	default:
+		return fmt.Sprintf("%.2f₽ на баланс", amount)
+	}
+}
+
+// DescribePromoRules возвращает описание условий применения промокода (пустая строка - без условий)
+func DescribePromoRules(p *PromoCode) string {
+	var rules []string
+
+	if p.NewUsersOnly {
+		rules = append(rules, "• Только для новых пользователей")
+	}
+
+	if p.MinTopup > 0 {
+		if p.Type == PromoTypePercent {
+			rules = append(rules, fmt.Sprintf("• Минимальная сумма оплаты: %.0f₽", p.MinTopup))
+		} else {
+			rules = append(rules, fmt.Sprintf("• Минимальная сумма пополнений: %.0f₽", p.MinTopup))
+		}
+	}
+
+	if p.Type == PromoTypePercent && len(p.Plans) > 0 {
+		var names []string
+		for _, plan := range p.Plans {
+			names = append(names, describePlan(plan))
+		}
+		rules = append(rules, "• Тарифы: "+strings.Join(names, ", "))
+	}
+
+	return strings.Join(rules, "\n")
+}
+
+// describePlan возвращает название тарифа для пользователя
+func describePlan(plan string) string {
+	if plan == PromoPlanTopup {
+		return "пополнение баланса"
+	}
+
+	if days, err := strconv.Atoi(strings.TrimPrefix(plan, promoPlanDaysPrefix)); err == nil {
+		return fmt.Sprintf("%d дн.", days)
+	}
+
+	if gb, err := strconv.Atoi(strings.TrimPrefix(plan, promoPlanTrafficPrefix)); err == nil {
+		return fmt.Sprintf("пакет %d ГБ", gb)
+	}
+
+	return plan
+}
+
+// ValidatePromoCodeFormat проверяет формат промокода: от 4 до 32 латинских букв и цифр
+func ValidatePromoCodeFormat(code string) error {
+	if len(code) < MinPromoCodeLength || len(code) > MaxPromoCodeLength {
+		return fmt.Errorf("промокод должен содержать от %d до %d символов", MinPromoCodeLength, MaxPromoCodeLength)
+	}
+
+	for _, char := range code {
+		if !((char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')) {
+			return fmt.Errorf("промокод может содержать только латинские буквы и цифры")
+		}
+	}
+
+	return nil
+}
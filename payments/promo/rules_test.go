@@ -0,0 +1,101 @@
+package promo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePromoSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected *PromoCode // nil - ожидается ошибка
+	}{
+		{"баланс", []string{"balance", "150"}, &PromoCode{Type: PromoTypeBalance, Amount: 150}},
+		{"скидка с условиями", []string{"PERCENT", "20", "new", "min=300", "plans=topup,days_30,traffic_50", "uses=100"},
+			&PromoCode{Type: PromoTypePercent, Percent: 20, NewUsersOnly: true, MinTopup: 300,
+				Plans: []string{PromoPlanTopup, "days_30", "traffic_50"}, MaxUses: 100}},
+		{"дни", []string{"days", "7"}, &PromoCode{Type: PromoTypeDays, Days: 7}},
+		{"трафик", []string{"traffic", "10"}, &PromoCode{Type: PromoTypeTraffic, TrafficGB: 10}},
+		{"без значения", []string{"balance"}, nil},
+		{"неизвестный тип", []string{"gift", "1"}, nil},
+		{"дробные дни", []string{"days", "1.5"}, nil},
+		{"неизвестный параметр", []string{"balance", "100", "foo"}, nil},
+		{"нулевой лимит", []string{"balance", "100", "uses=0"}, nil},
+		{"неверный срок", []string{"balance", "100", "valid=-1"}, nil},
+		{"скидка больше максимума", []string{"percent", "95"}, nil},
+		{"неизвестный тариф", []string{"percent", "10", "plans=year"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := ParsePromoSpec(tt.args)
+			if tt.expected == nil {
+				if err == nil {
+					t.Errorf("Ожидалась ошибка для %v, получено %+v", tt.args, template)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Неожиданная ошибка: %v", err)
+			}
+			if !reflect.DeepEqual(template, tt.expected) {
+				t.Errorf("Получено %+v, ожидалось %+v", template, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParsePromoSpecValidDays(t *testing.T) {
+	template, err := ParsePromoSpec([]string{"balance", "100", "valid=10"})
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+
+	expected := time.Now().AddDate(0, 0, 10)
+	if diff := template.ExpiresAt.Sub(expected); diff < -time.Minute || diff > time.Minute {
+		t.Errorf("Срок действия %v, ожидалось около %v", template.ExpiresAt, expected)
+	}
+}
+
+func TestValidatePromoTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template PromoCode
+		valid    bool
+	}{
+		{"баланс по умолчанию", PromoCode{Amount: 100}, true},
+		{"нулевая сумма", PromoCode{Type: PromoTypeBalance}, false},
+		{"скидка", PromoCode{Type: PromoTypePercent, Percent: MaxPromoPercent}, true},
+		{"нулевая скидка", PromoCode{Type: PromoTypePercent}, false},
+		{"нулевые дни", PromoCode{Type: PromoTypeDays}, false},
+		{"нулевой трафик", PromoCode{Type: PromoTypeTraffic}, false},
+		{"неизвестный тип", PromoCode{Type: "gift", Amount: 100}, false},
+		{"именной код", PromoCode{Amount: 100, Code: "Summer2026"}, true},
+		{"короткий код", PromoCode{Amount: 100, Code: "abc"}, false},
+		{"код с пробелом", PromoCode{Amount: 100, Code: "sum mer"}, false},
+		{"отрицательный лимит", PromoCode{Amount: 100, MaxUses: -1}, false},
+		{"отрицательная минимальная сумма", PromoCode{Amount: 100, MinTopup: -1}, false},
+		{"известные тарифы", PromoCode{Type: PromoTypePercent, Percent: 10, Plans: []string{PromoPlanTopup, PromoPlanForDays(30), PromoPlanForTrafficPack(50)}}, true},
+		{"неизвестный тариф", PromoCode{Type: PromoTypePercent, Percent: 10, Plans: []string{"year"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := tt.template
+			err := validatePromoTemplate(&template)
+			if tt.valid && err != nil {
+				t.Errorf("Неожиданная ошибка: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Ожидалась ошибка для %+v", tt.template)
+			}
+		})
+	}
+
+	template := PromoCode{Amount: 100}
+	if err := validatePromoTemplate(&template); err == nil && template.Type != PromoTypeBalance {
+		t.Errorf("Тип по умолчанию %s, ожидалось %s", template.Type, PromoTypeBalance)
+	}
+}
@@ -63,6 +63,17 @@ func createTables(db *sql.DB) error {
 		FOREIGN KEY (promo_id) REFERENCES promo_codes(id) ON DELETE CASCADE
 	);`
 
+	// Колонки типов промокодов и условий применения добавлены позже - для существующих таблиц
+	alterSQL := `
+	ALTER TABLE promo_codes ADD COLUMN IF NOT EXISTS type VARCHAR(20) NOT NULL DEFAULT 'balance';
+	ALTER TABLE promo_codes ADD COLUMN IF NOT EXISTS percent DECIMAL(5,2) NOT NULL DEFAULT 0;
+	ALTER TABLE promo_codes ADD COLUMN IF NOT EXISTS bonus_days INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE promo_codes ADD COLUMN IF NOT EXISTS traffic_gb INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE promo_codes ADD COLUMN IF NOT EXISTS new_users_only BOOLEAN NOT NULL DEFAULT false;
+	ALTER TABLE promo_codes ADD COLUMN IF NOT EXISTS min_topup DECIMAL(10,2) NOT NULL DEFAULT 0;
+	ALTER TABLE promo_codes ADD COLUMN IF NOT EXISTS plans TEXT NOT NULL DEFAULT '';
+	ALTER TABLE promo_codes ADD COLUMN IF NOT EXISTS campaign_id VARCHAR(64);`
+
 	// Индексы для оптимизации
 	indexSQL := `
 	CREATE INDEX IF NOT EXISTS idx_promo_codes_code ON promo_codes(code);
@@ -72,6 +83,14 @@ func createTables(db *sql.DB) error {
 	CREATE INDEX IF NOT EXISTS idx_promo_usage_promo_id ON promo_usage(promo_id);
 	CREATE INDEX IF NOT EXISTS idx_promo_usage_used_at ON promo_usage(used_at);`
 
+	// Уникальность проверяется базой: параллельные создание и активация не проходят проверку одновременно
+	uniqueIndexes := []struct {
+		name, sql string
+	}{
+		{"idx_promo_codes_code_lower", `CREATE UNIQUE INDEX IF NOT EXISTS idx_promo_codes_code_lower ON promo_codes(LOWER(code))`},
+		{"idx_promo_usage_promo_user", `CREATE UNIQUE INDEX IF NOT EXISTS idx_promo_usage_promo_user ON promo_usage(promo_id, user_id)`},
+	}
+
 	if _, err := db.Exec(promoTableSQL); err != nil {
 		return fmt.Errorf("ошибка создания таблицы promo_codes: %v", err)
 	}
@@ -80,13 +99,63 @@ func createTables(db *sql.DB) error {
 		return fmt.Errorf("ошибка создания таблицы promo_usage: %v", err)
 	}
 
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("ошибка обновления таблицы promo_codes: %v", err)
+	}
+
 	if _, err := db.Exec(indexSQL); err != nil {
 		return fmt.Errorf("ошибка создания индексов: %v", err)
 	}
 
+	// Старые данные могут содержать дубли - промокоды продолжают работать, дубли нужно убрать вручную
+	for _, index := range uniqueIndexes {
+		if _, err := db.Exec(index.sql); err != nil {
+			log.Printf("PROMO: ⚠️ Не удалось создать уникальный индекс %s (есть дубли?): %v", index.name, err)
+		}
+	}
+
+	if err := createDiscountTables(db); err != nil {
+		return err
+	}
+
+	if err := createCampaignTables(db); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// promoCodeColumns список колонок промокода в порядке сканирования scanPromoCode
+const promoCodeColumns = `id, code, amount, created_by, created_at, expires_at, is_active,
+	used_by, used_at, usage_count, max_uses,
+	type, percent, bonus_days, traffic_gb, new_users_only, min_topup, plans, campaign_id`
+
+// rowScanner общий интерфейс для sql.Row и sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPromoCode читает промокод из строки результата запроса
+func scanPromoCode(row rowScanner) (*PromoCode, error) {
+	var promo PromoCode
+	var promoType, plans string
+	var campaignID sql.NullString
+	err := row.Scan(
+		&promo.ID, &promo.Code, &promo.Amount, &promo.CreatedBy,
+		&promo.CreatedAt, &promo.ExpiresAt, &promo.IsActive,
+		&promo.UsedBy, &promo.UsedAt, &promo.UsageCount, &promo.MaxUses,
+		&promoType, &promo.Percent, &promo.Days, &promo.TrafficGB,
+		&promo.NewUsersOnly, &promo.MinTopup, &plans, &campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	promo.CampaignID = campaignID.String
+	promo.Type = PromoType(promoType)
+	promo.Plans = splitPlans(plans)
+	return &promo, nil
+}
+
 // generatePromoCode генерирует уникальный промокод
 func (ps *PromoService) generatePromoCode() (string, error) {
 	const maxAttempts = 10
@@ -103,7 +172,7 @@ func (ps *PromoService) generatePromoCode() (string, error) {
 
 		// Проверяем уникальность
 		var exists bool
-		query := "SELECT EXISTS(SELECT 1 FROM promo_codes WHERE code = $1)"
+		query := "SELECT EXISTS(SELECT 1 FROM promo_codes WHERE LOWER(code) = LOWER($1))"
 		err := ps.db.QueryRow(query, code).Scan(&exists)
 		if err != nil {
 			return "", fmt.Errorf("ошибка проверки уникальности кода: %v", err)
@@ -117,64 +186,90 @@ func (ps *PromoService) generatePromoCode() (string, error) {
 	return "", fmt.Errorf("не удалось сгенерировать уникальный промокод за %d попыток", maxAttempts)
 }
 
-// CreatePromoCode создает новый промокод
+// CreatePromoCode создает новый промокод на пополнение баланса
 func (ps *PromoService) CreatePromoCode(amount float64, createdBy int64) (*PromoCode, error) {
-	// Генерируем уникальный код
-	code, err := ps.generatePromoCode()
-	if err != nil {
-		return nil, fmt.Errorf("ошибка генерации промокода: %v", err)
-	}
+	return ps.CreateTypedPromoCode(&PromoCode{Type: PromoTypeBalance, Amount: amount}, createdBy)
+}
 
-	// Создаем ID для промокода
-	promoID := fmt.Sprintf("promo_%d_%s", time.Now().Unix(), code)
+// CreateTypedPromoCode создает промокод по шаблону: тип, значение и условия применения
+func (ps *PromoService) CreateTypedPromoCode(template *PromoCode, createdBy int64) (*PromoCode, error) {
+	if err := validatePromoTemplate(template); err != nil {
+		return nil, err
+	}
 
-	// Вычисляем время истечения
-	expiresAt := time.Now().AddDate(0, 0, PromoCodeExpirationDays)
+	// Вычисляем время истечения (если не задано в шаблоне)
+	expiresAt := template.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().AddDate(0, 0, PromoCodeExpirationDays)
+	}
 
 	// Создаем промокод
-	promo := &PromoCode{
-		ID:        promoID,
-		Code:      code,
-		Amount:    amount,
-		CreatedBy: createdBy,
-		CreatedAt: time.Now(),
-		ExpiresAt: expiresAt,
-		IsActive:  true,
-		MaxUses:   1,
-	}
-
-	// Сохраняем в базу данных
+	promo := *template
+	promo.CreatedBy = createdBy
+	promo.CreatedAt = time.Now()
+	promo.ExpiresAt = expiresAt
+	promo.IsActive = true
+	if promo.MaxUses <= 0 {
+		promo.MaxUses = 1
+	}
+
+	// Уникальность кода без учета регистра обеспечивает индекс: при конфликте строка не вставляется
 	query := `
-		INSERT INTO promo_codes (id, code, amount, created_by, created_at, expires_at, is_active, max_uses)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+		INSERT INTO promo_codes (id, code, amount, created_by, created_at, expires_at, is_active, max_uses,
+			type, percent, bonus_days, traffic_gb, new_users_only, min_topup, plans, campaign_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT DO NOTHING`
 
-	_, err = ps.db.Exec(query, promo.ID, promo.Code, promo.Amount, promo.CreatedBy,
-		promo.CreatedAt, promo.ExpiresAt, promo.IsActive, promo.MaxUses)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка сохранения промокода: %v", err)
+	const maxAttempts = 10
+	for attempt := 1; ; attempt++ {
+		// Именной код задается админом, иначе генерируем случайный
+		promo.Code = template.Code
+		if promo.Code == "" {
+			code, err := ps.generatePromoCode()
+			if err != nil {
+				return nil, fmt.Errorf("ошибка генерации промокода: %v", err)
+			}
+			promo.Code = code
+		}
+		promo.ID = fmt.Sprintf("promo_%d_%s", time.Now().Unix(), promo.Code)
+
+		result, err := ps.db.Exec(query, promo.ID, promo.Code, promo.Amount, promo.CreatedBy,
+			promo.CreatedAt, promo.ExpiresAt, promo.IsActive, promo.MaxUses,
+			string(promo.Type), promo.Percent, promo.Days, promo.TrafficGB,
+			promo.NewUsersOnly, promo.MinTopup, strings.Join(promo.Plans, ","), nullIfEmpty(promo.CampaignID))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сохранения промокода: %v", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения количества вставленных строк: %v", err)
+		}
+		if rowsAffected > 0 {
+			break
+		}
+
+		if template.Code != "" {
+			return nil, fmt.Errorf("промокод %s уже существует", template.Code)
+		}
+		if attempt >= maxAttempts {
+			return nil, fmt.Errorf("не удалось сохранить уникальный промокод за %d попыток", maxAttempts)
+		}
 	}
 
-	log.Printf("PROMO: Создан промокод %s на сумму %.2f₽ (создатель: %d)",
-		promo.Code, promo.Amount, promo.CreatedBy)
+	log.Printf("PROMO: Создан промокод %s: %s (создатель: %d)",
+		promo.Code, DescribePromoValue(&promo), promo.CreatedBy)
 
-	return promo, nil
+	return &promo, nil
 }
 
-// ValidatePromoCode проверяет валидность промокода для пользователя
-func (ps *PromoService) ValidatePromoCode(code string, userID int64) (*PromoCode, PromoCodeStatus, error) {
+// ValidatePromoCode проверяет валидность промокода для пользователя.
+// checkout - параметры оплаты, к которой применяется скидка; nil при активации промокода командой /promo.
+func (ps *PromoService) ValidatePromoCode(code string, userID int64, checkout *PromoCheckout) (*PromoCode, PromoCodeStatus, error) {
 	// Ищем промокод
-	query := `
-		SELECT id, code, amount, created_by, created_at, expires_at, is_active, 
-		       used_by, used_at, usage_count, max_uses
-		FROM promo_codes 
-		WHERE code = $1 AND is_active = true`
-
-	var promo PromoCode
-	err := ps.db.QueryRow(query, code).Scan(
-		&promo.ID, &promo.Code, &promo.Amount, &promo.CreatedBy,
-		&promo.CreatedAt, &promo.ExpiresAt, &promo.IsActive,
-		&promo.UsedBy, &promo.UsedAt, &promo.UsageCount, &promo.MaxUses)
+	query := fmt.Sprintf("SELECT %s FROM promo_codes WHERE LOWER(code) = LOWER($1) AND is_active = true", promoCodeColumns)
 
+	promo, err := scanPromoCode(ps.db.QueryRow(query, code))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, PromoCodeNotFound, nil
@@ -184,17 +279,44 @@ func (ps *PromoService) ValidatePromoCode(code string, userID int64) (*PromoCode
 
 	// Проверяем срок действия
 	if time.Now().After(promo.ExpiresAt) {
-		return &promo, PromoCodeExpired, nil
+		return promo, PromoCodeExpired, nil
 	}
 
 	// Проверяем лимит использований
 	if promo.UsageCount >= promo.MaxUses {
-		return &promo, PromoCodeMaxUsesReached, nil
+		return promo, PromoCodeMaxUsesReached, nil
 	}
 
 	// Проверяем, использовал ли уже этот пользователь промокод
 	if promo.UsedBy.Valid && promo.UsedBy.Int64 == userID {
-		return &promo, PromoCodeAlreadyUsedByUser, nil
+		return promo, PromoCodeAlreadyUsedByUser, nil
+	}
+
+	// Многоразовый промокод один пользователь может использовать только один раз
+	if promo.MaxUses > 1 {
+		var usedByUser bool
+		err := ps.db.QueryRow("SELECT EXISTS(SELECT 1 FROM promo_usage WHERE promo_id = $1 AND user_id = $2)",
+			promo.ID, userID).Scan(&usedByUser)
+		if err != nil {
+			return promo, PromoCodeNotFound, fmt.Errorf("ошибка проверки использования промокода: %v", err)
+		}
+		if usedByUser {
+			return promo, PromoCodeAlreadyUsedByUser, nil
+		}
+	}
+
+	// Проверяем условия применения
+	status, err := ps.checkEligibility(promo, userID, checkout)
+	if err != nil {
+		return promo, status, err
+	}
+	if status != PromoCodeActive {
+		return promo, status, nil
+	}
+
+	// Кулдаун проверяется только при активации - при оплате промокод уже принят
+	if checkout != nil {
+		return promo, PromoCodeActive, nil
 	}
 
 	// Проверяем кулдаун пользователя (24 часа между использованиями)
@@ -210,16 +332,57 @@ func (ps *PromoService) ValidatePromoCode(code string, userID int64) (*PromoCode
 		log.Printf("PROMO: Ошибка проверки кулдауна для пользователя %d: %v", userID, cooldownErr)
 		// Продолжаем выполнение, не блокируем из-за ошибки кулдауна
 	} else if hasCooldown {
-		return &promo, PromoCodeAlreadyUsedByUser, nil
+		return promo, PromoCodeAlreadyUsedByUser, nil
+	}
+
+	return promo, PromoCodeActive, nil
+}
+
+// checkEligibility проверяет условия применения промокода для пользователя
+func (ps *PromoService) checkEligibility(promo *PromoCode, userID int64, checkout *PromoCheckout) (PromoCodeStatus, error) {
+	// Бонусный трафик учитывается только проверкой квот: без лимитов промокод не расходуется впустую
+	if promo.Type == PromoTypeTraffic && !common.TrafficQuotasEnabled() {
+		return PromoCodeTrafficUnavailable, nil
+	}
+
+	if promo.NewUsersOnly || (checkout == nil && promo.Type != PromoTypePercent && promo.MinTopup > 0) {
+		user, err := common.GetUserByTelegramID(userID)
+		if err != nil || user == nil {
+			return PromoCodeNotFound, fmt.Errorf("ошибка получения пользователя: %v", err)
+		}
+
+		// Новый пользователь - еще ни разу не пополнял баланс
+		if promo.NewUsersOnly && user.TotalPaid > 0 {
+			return PromoCodeNewUsersOnly, nil
+		}
+
+		// Для промокодов без оплаты минимальная сумма - это сумма всех пополнений пользователя
+		if checkout == nil && promo.Type != PromoTypePercent && user.TotalPaid < promo.MinTopup {
+			return PromoCodeMinTopupNotReached, nil
+		}
 	}
 
-	return &promo, PromoCodeActive, nil
+	// Тариф и сумма скидки проверяются при оплате
+	if checkout == nil {
+		return PromoCodeActive, nil
+	}
+
+	if !promo.AppliesToPlan(checkout.Plan) {
+		return PromoCodePlanNotEligible, nil
+	}
+
+	if checkout.Amount < promo.MinTopup {
+		return PromoCodeMinTopupNotReached, nil
+	}
+
+	return PromoCodeActive, nil
 }
 
-// UsePromoCode активирует промокод для пользователя
+// UsePromoCode активирует промокод для пользователя.
+// Промокод со скидкой не используется сразу, а ждет следующей оплаты.
 func (ps *PromoService) UsePromoCode(code string, userID int64) (*PromoCode, error) {
 	// Проверяем валидность промокода
-	promo, status, err := ps.ValidatePromoCode(code, userID)
+	promo, status, err := ps.ValidatePromoCode(code, userID, nil)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка валидации промокода: %v", err)
 	}
@@ -228,6 +391,15 @@ func (ps *PromoService) UsePromoCode(code string, userID int64) (*PromoCode, err
 		return nil, fmt.Errorf("промокод не может быть использован: %s", status.String())
 	}
 
+	if promo.Type == PromoTypePercent {
+		if err := ps.attachDiscount(promo, userID); err != nil {
+			return nil, err
+		}
+		log.Printf("PROMO: Промокод %s (скидка %.0f%%) активирован пользователем %d, ожидает оплаты",
+			promo.Code, promo.Percent, userID)
+		return promo, nil
+	}
+
 	// Начинаем транзакцию
 	tx, err := ps.db.Begin()
 	if err != nil {
@@ -258,18 +430,24 @@ func (ps *PromoService) UsePromoCode(code string, userID int64) (*PromoCode, err
 	// Записываем использование
 	usageQuery := `
 		INSERT INTO promo_usage (promo_id, user_id, amount, used_at)
-		VALUES ($1, $2, $3, NOW())`
-
-	_, err = tx.Exec(usageQuery, promo.ID, userID, promo.Amount)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT DO NOTHING
+		RETURNING id`
+
+	var usageID int64
+	err = tx.QueryRow(usageQuery, promo.ID, userID, promo.Amount).Scan(&usageID)
+	if err == sql.ErrNoRows {
+		// Параллельная активация того же промокода этим пользователем уже записана
+		return nil, fmt.Errorf("промокод не может быть использован: %s", PromoCodeAlreadyUsedByUser.String())
+	}
 	if err != nil {
 		return nil, fmt.Errorf("ошибка записи использования промокода: %v", err)
 	}
 
-	// Пополняем баланс пользователя
-	balanceQuery := "UPDATE users SET balance = balance + $1, updated_at = NOW() WHERE telegram_id = $2"
-	_, err = tx.Exec(balanceQuery, promo.Amount, userID)
+	// Выдаем бонус в зависимости от типа промокода
+	recalculate, err := ps.grantReward(tx, promo, userID)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка пополнения баланса: %v", err)
+		return nil, err
 	}
 
 	// Коммитим транзакцию
@@ -277,21 +455,128 @@ func (ps *PromoService) UsePromoCode(code string, userID int64) (*PromoCode, err
 		return nil, fmt.Errorf("ошибка коммита транзакции: %v", err)
 	}
 
+	if recalculate {
+		common.ForceBalanceRecalculation(userID)
+	}
+
+	// Подписка продлевается в панели только после коммита: при ошибке использование отменяется
+	if promo.Type == PromoTypeDays && common.TARIFF_MODE_ENABLED {
+		if err := ps.grantDays(promo, userID, usageID); err != nil {
+			return nil, err
+		}
+	}
+
 	// Обновляем данные промокода
 	promo.UsedBy = sql.NullInt64{Int64: userID, Valid: true}
 	promo.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
 	promo.UsageCount++
 
-	log.Printf("PROMO: Промокод %s использован пользователем %d на сумму %.2f₽",
-		promo.Code, userID, promo.Amount)
+	log.Printf("PROMO: Промокод %s использован пользователем %d: %s",
+		promo.Code, userID, DescribePromoValue(promo))
 
 	return promo, nil
 }
 
+// grantReward выдает бонус по промокоду в рамках транзакции.
+// Возвращает true, если изменился баланс и нужен пересчет подписки.
+func (ps *PromoService) grantReward(tx *sql.Tx, promo *PromoCode, userID int64) (bool, error) {
+	switch promo.Type {
+	case PromoTypeDays:
+		// В режиме тарифов дни добавляются в панели после коммита (grantDays),
+		// при автосписании на баланс зачисляется стоимость дней
+		if common.TARIFF_MODE_ENABLED {
+			return false, nil
+		}
+		amount := float64(promo.Days * common.PRICE_PER_DAY)
+		balanceQuery := "UPDATE users SET balance = balance + $1, updated_at = NOW() WHERE telegram_id = $2"
+		if _, err := tx.Exec(balanceQuery, amount, userID); err != nil {
+			return false, fmt.Errorf("ошибка пополнения баланса: %v", err)
+		}
+		return true, nil
+
+	case PromoTypeTraffic:
+		_, err := tx.Exec(`
+			INSERT INTO promo_traffic_bonuses (user_id, promo_id, traffic_gb)
+			VALUES ($1, $2, $3)`, userID, promo.ID, promo.TrafficGB)
+		if err != nil {
+			return false, fmt.Errorf("ошибка начисления бонусного трафика: %v", err)
+		}
+		return false, nil
+
+	default:
+		// Пополняем баланс пользователя
+		balanceQuery := "UPDATE users SET balance = balance + $1, updated_at = NOW() WHERE telegram_id = $2"
+		if _, err := tx.Exec(balanceQuery, promo.Amount, userID); err != nil {
+			return false, fmt.Errorf("ошибка пополнения баланса: %v", err)
+		}
+		return true, nil
+	}
+}
+
+// grantDays продлевает подписку в панели на бесплатные дни после записи использования промокода.
+// Если продлить не удалось, использование отменяется и промокод можно активировать повторно.
+func (ps *PromoService) grantDays(promo *PromoCode, userID int64, usageID int64) error {
+	user, err := common.GetUserByTelegramID(userID)
+	if err == nil && user == nil {
+		err = fmt.Errorf("пользователь не найден")
+	}
+	if err == nil {
+		if err = common.GetUserBackendForNewClient(user.TelegramID).Extend(user, promo.Days); err != nil {
+			err = fmt.Errorf("ошибка продления подписки: %v", err)
+		}
+	}
+	if err != nil {
+		if revertErr := ps.revertPromoUsage(promo.ID, userID, usageID); revertErr != nil {
+			log.Printf("PROMO: Ошибка отмены использования промокода %s пользователем %d: %v", promo.Code, userID, revertErr)
+		}
+		return err
+	}
+
+	// Панель уже продлена - ошибку сохранения пользователя исправит синхронизация с панелью
+	if err := common.UpdateUser(user); err != nil {
+		log.Printf("PROMO: Ошибка обновления пользователя %d после продления по промокоду %s: %v", userID, promo.Code, err)
+	}
+
+	return nil
+}
+
+// revertPromoUsage отменяет использование промокода, бонус по которому не удалось выдать
+func (ps *PromoService) revertPromoUsage(promoID string, userID int64, usageID int64) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM promo_usage WHERE id = $1`, usageID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления использования промокода: %v", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE promo_codes SET usage_count = GREATEST(usage_count - 1, 0),
+			used_by = CASE WHEN used_by = $2 THEN NULL ELSE used_by END,
+			used_at = CASE WHEN used_by = $2 THEN NULL ELSE used_at END
+		WHERE id = $1`, promoID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления промокода: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка коммита транзакции: %v", err)
+	}
+
+	return nil
+}
+
 // GetUserPromoHistory возвращает историю использования промокодов пользователем
 func (ps *PromoService) GetUserPromoHistory(userID int64, limit int) ([]PromoUsage, error) {
 	query := `
-		SELECT pu.id, pu.promo_id, pu.user_id, pu.amount, pu.used_at
+		SELECT pu.id, pu.promo_id, pu.user_id, pu.amount, pu.used_at,
+		       pc.type, pc.percent, pc.bonus_days, pc.traffic_gb
 		FROM promo_usage pu
 		JOIN promo_codes pc ON pu.promo_id = pc.id
 		WHERE pu.user_id = $1
@@ -307,10 +592,13 @@ func (ps *PromoService) GetUserPromoHistory(userID int64, limit int) ([]PromoUsa
 	var history []PromoUsage
 	for rows.Next() {
 		var usage PromoUsage
-		err := rows.Scan(&usage.ID, &usage.PromoID, &usage.UserID, &usage.Amount, &usage.UsedAt)
+		var promoType string
+		err := rows.Scan(&usage.ID, &usage.PromoID, &usage.UserID, &usage.Amount, &usage.UsedAt,
+			&promoType, &usage.Percent, &usage.Days, &usage.TrafficGB)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка сканирования истории: %v", err)
 		}
+		usage.Type = PromoType(promoType)
 		history = append(history, usage)
 	}
 
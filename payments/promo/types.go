@@ -2,6 +2,7 @@ package promo
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 )
 
@@ -18,6 +19,40 @@ type PromoCode struct {
 	UsedAt     sql.NullTime  `json:"used_at,omitempty" db:"used_at"`
 	UsageCount int           `json:"usage_count" db:"usage_count"`
 	MaxUses    int           `json:"max_uses" db:"max_uses"` // Максимальное количество использований (по умолчанию 1)
+
+	Type      PromoType `json:"type" db:"type"`             // Тип промокода (по умолчанию - пополнение баланса)
+	Percent   float64   `json:"percent" db:"percent"`       // Процент скидки (для PromoTypePercent)
+	Days      int       `json:"days" db:"bonus_days"`       // Количество бесплатных дней (для PromoTypeDays)
+	TrafficGB int       `json:"traffic_gb" db:"traffic_gb"` // Бонусный трафик в ГБ (для PromoTypeTraffic)
+
+	// Условия применения
+	NewUsersOnly bool     `json:"new_users_only" db:"new_users_only"` // Только для пользователей без пополнений
+	MinTopup     float64  `json:"min_topup" db:"min_topup"`           // Минимальная сумма пополнения
+	Plans        []string `json:"plans,omitempty" db:"plans"`         // Тарифы, к которым применяется скидка (пусто - любые)
+
+	CampaignID string `json:"campaign_id,omitempty" db:"campaign_id"` // Кампания, в рамках которой создан промокод
+}
+
+// PromoCampaign кампания - группа промокодов, созданных пачкой или именным кодом
+type PromoCampaign struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedBy int64     `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	IsActive  bool      `json:"is_active" db:"is_active"`
+}
+
+// PromoCampaignReport отчет по активациям и выручке кампании
+type PromoCampaignReport struct {
+	Campaign      PromoCampaign
+	TotalCodes    int
+	ActiveCodes   int
+	Redemptions   int     // Количество активаций промокодов
+	UniqueUsers   int     // Количество пользователей, активировавших промокоды
+	BonusAmount   float64 // Сумма, выданная на баланс и скидками
+	Revenue       float64 // Пополнения участников после активации промокода
+	PayingUsers   int     // Количество участников, пополнивших баланс
+	RevenueFailed bool    // Выручку не удалось посчитать (платежная система не инициализирована)
 }
 
 // PromoUsage представляет использование промокода пользователем
@@ -27,8 +62,67 @@ type PromoUsage struct {
 	UserID  int64     `json:"user_id" db:"user_id"`
 	Amount  float64   `json:"amount" db:"amount"`
 	UsedAt  time.Time `json:"used_at" db:"used_at"`
+
+	// Параметры промокода на момент использования
+	Type      PromoType `json:"type" db:"type"`
+	Percent   float64   `json:"percent" db:"percent"`
+	Days      int       `json:"days" db:"bonus_days"`
+	TrafficGB int       `json:"traffic_gb" db:"traffic_gb"`
+}
+
+// PromoType тип промокода
+type PromoType string
+
+const (
+	PromoTypeBalance PromoType = "balance" // Пополнение баланса на фиксированную сумму
+	PromoTypePercent PromoType = "percent" // Скидка в процентах на следующее пополнение или покупку тарифа
+	PromoTypeDays    PromoType = "days"    // Бесплатные дни подписки
+	PromoTypeTraffic PromoType = "traffic" // Бонусный трафик
+)
+
+// Тарифы для условий применения промокодов
+const (
+	PromoPlanTopup         = "topup"    // Пополнение баланса
+	promoPlanDaysPrefix    = "days_"    // Покупка тарифа на N дней (days_30)
+	promoPlanTrafficPrefix = "traffic_" // Покупка пакета трафика на N ГБ (traffic_50)
+)
+
+// PromoPlanForDays возвращает идентификатор тарифа на указанное количество дней
+func PromoPlanForDays(days int) string {
+	return fmt.Sprintf("%s%d", promoPlanDaysPrefix, days)
 }
 
+// PromoPlanForTrafficPack возвращает идентификатор пакета трафика на указанное количество ГБ
+func PromoPlanForTrafficPack(gb int) string {
+	return fmt.Sprintf("%s%d", promoPlanTrafficPrefix, gb)
+}
+
+// PromoCheckout параметры оформления платежа, к которому применяется промокод
+type PromoCheckout struct {
+	Plan   string  // Идентификатор тарифа (PromoPlanTopup или PromoPlanForDays)
+	Amount float64 // Сумма платежа до скидки
+}
+
+// PromoDiscount скидка по промокоду, ожидающая применения при оплате
+type PromoDiscount struct {
+	ID        int64          `json:"id" db:"id"`
+	UserID    int64          `json:"user_id" db:"user_id"`
+	PromoID   string         `json:"promo_id" db:"promo_id"`
+	Code      string         `json:"code" db:"code"`
+	Percent   float64        `json:"percent" db:"percent"`
+	Status    string         `json:"status" db:"status"`
+	PaymentID sql.NullString `json:"payment_id,omitempty" db:"payment_id"`
+	Amount    float64        `json:"amount" db:"amount"` // Сумма скидки, рассчитанная при оформлении платежа
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+}
+
+// Статусы скидок по промокодам
+const (
+	PromoDiscountPending  = "pending"  // Промокод активирован, скидка ждет оплаты
+	PromoDiscountReserved = "reserved" // Скидка учтена в созданном платеже
+	PromoDiscountApplied  = "applied"  // Платеж прошел, промокод использован
+)
+
 // PromoCodeStatus статус промокода
 type PromoCodeStatus int
 
@@ -39,6 +133,10 @@ const (
 	PromoCodeNotFound
 	PromoCodeAlreadyUsedByUser
 	PromoCodeMaxUsesReached
+	PromoCodeNewUsersOnly
+	PromoCodeMinTopupNotReached
+	PromoCodePlanNotEligible
+	PromoCodeTrafficUnavailable
 )
 
 // String возвращает текстовое представление статуса
@@ -56,6 +154,14 @@ func (s PromoCodeStatus) String() string {
 		return "Уже использован этим пользователем"
 	case PromoCodeMaxUsesReached:
 		return "Достигнут лимит использований"
+	case PromoCodeNewUsersOnly:
+		return "Только для новых пользователей"
+	case PromoCodeMinTopupNotReached:
+		return "Сумма меньше минимальной"
+	case PromoCodePlanNotEligible:
+		return "Не действует для выбранного тарифа"
+	case PromoCodeTrafficUnavailable:
+		return "Бонусный трафик недоступен: лимиты трафика не установлены"
 	default:
 		return "Неизвестный статус"
 	}
@@ -69,3 +175,24 @@ const PromoCodeExpirationDays = 14
 
 // UserPromoCooldownHours количество часов между использованием промокодов одним пользователем
 const UserPromoCooldownHours = 24
+
+// PredefinedPercents предопределенные проценты для промокодов со скидкой
+var PredefinedPercents = []float64{10, 20, 30, 50}
+
+// PredefinedDays предопределенное количество бесплатных дней
+var PredefinedDays = []int{3, 7, 14, 30}
+
+// PredefinedTrafficGB предопределенный объем бонусного трафика
+var PredefinedTrafficGB = []int{10, 50, 100}
+
+// MaxPromoPercent максимальный процент скидки
+const MaxPromoPercent = 90
+
+// MaxCampaignBatchSize максимальное количество промокодов, создаваемых одной командой
+const MaxCampaignBatchSize = 500
+
+// Допустимая длина промокода (случайные коды - 8 символов, именные - до 32)
+const (
+	MinPromoCodeLength = 4
+	MaxPromoCodeLength = 32
+)
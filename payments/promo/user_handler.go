@@ -35,17 +35,17 @@ func (h *UserPromoHandler) HandlePromoCommand(chatID int64, userID int64, args [
 
 	// Проверяем наличие промокода в аргументах
 	if len(args) == 0 {
-		return h.sendPromoUsageHelp(chatID)
+		return h.sendPromoUsageHelp(chatID, userID)
 	}
 
 	promoCode := strings.TrimSpace(args[0])
 	if promoCode == "" {
-		return h.sendPromoUsageHelp(chatID)
+		return h.sendPromoUsageHelp(chatID, userID)
 	}
 
-	// Проверяем формат промокода (должен быть 8 символов)
-	if len(promoCode) != 8 {
-		return h.sendMessage(chatID, "❌ Неверный формат промокода. Промокод должен содержать 8 символов.")
+	// Проверяем формат промокода
+	if err := ValidatePromoCodeFormat(promoCode); err != nil {
+		return h.sendMessage(chatID, fmt.Sprintf("❌ Неверный формат промокода: %v.", err))
 	}
 
 	// Используем промокод
@@ -68,11 +68,29 @@ func (h *UserPromoHandler) HandlePromoCommand(chatID int64, userID int64, args [
 
 	// Отправляем сообщение об успешном использовании
 	text := fmt.Sprintf("✅ <b>Промокод успешно активирован!</b>\n\n"+
-		"🎁 <b>Код:</b> <code>%s</code>\n"+
-		"💰 <b>Получено:</b> %.2f₽\n",
-		promo.Code, promo.Amount)
+		"🎁 <b>Код:</b> <code>%s</code>\n", promo.Code)
+
+	switch promo.Type {
+	case PromoTypePercent:
+		text += fmt.Sprintf("📉 <b>Скидка:</b> %.0f%%\n\n"+
+			"Скидка будет применена к следующему пополнению или покупке тарифа.\n", promo.Percent)
+		if rules := DescribePromoRules(promo); rules != "" {
+			text += "\n📋 <b>Условия:</b>\n" + rules + "\n"
+		}
+	case PromoTypeDays:
+		if common.TARIFF_MODE_ENABLED {
+			text += fmt.Sprintf("📅 <b>Подписка продлена на:</b> %d %s\n", promo.Days, common.GetDaysWord(promo.Days))
+		} else {
+			text += fmt.Sprintf("📅 <b>Получено:</b> %d %s подписки (%.2f₽ на баланс)\n",
+				promo.Days, common.GetDaysWord(promo.Days), float64(promo.Days*common.PRICE_PER_DAY))
+		}
+	case PromoTypeTraffic:
+		text += fmt.Sprintf("📶 <b>Бонусный трафик:</b> +%d ГБ\n", promo.TrafficGB)
+	default:
+		text += fmt.Sprintf("💰 <b>Получено:</b> %.2f₽\n", promo.Amount)
+	}
 
-	if updatedUser != nil {
+	if updatedUser != nil && promo.Type != PromoTypePercent {
 		text += fmt.Sprintf("💳 <b>Текущий баланс:</b> %.2f₽", updatedUser.Balance)
 	}
 
@@ -85,8 +103,8 @@ func (h *UserPromoHandler) HandlePromoCommand(chatID int64, userID int64, args [
 	}
 
 	// Логируем успешное использование
-	log.Printf("PROMO_USER: Промокод %s успешно использован пользователем %d (%.2f₽)",
-		promo.Code, userID, promo.Amount)
+	log.Printf("PROMO_USER: Промокод %s успешно использован пользователем %d (%s)",
+		promo.Code, userID, DescribePromoValue(promo))
 
 	return nil
 }
@@ -110,9 +128,9 @@ func (h *UserPromoHandler) HandlePromoHistoryCommand(chatID int64, userID int64)
 
 	var totalAmount float64
 	for i, usage := range history {
-		text += fmt.Sprintf("%d. %.2f₽ - %s\n",
+		text += fmt.Sprintf("%d. %s - %s\n",
 			i+1,
-			usage.Amount,
+			describeUsage(&usage),
 			usage.UsedAt.Format("02.01.2006 15:04"))
 		totalAmount += usage.Amount
 	}
@@ -131,20 +149,28 @@ func (h *UserPromoHandler) HandlePromoHistoryCommand(chatID int64, userID int64)
 }
 
 // sendPromoUsageHelp отправляет справку по использованию промокодов
-func (h *UserPromoHandler) sendPromoUsageHelp(chatID int64) error {
+func (h *UserPromoHandler) sendPromoUsageHelp(chatID int64, userID int64) error {
 	text := "🎁 <b>Использование промокодов</b>\n\n" +
 		"Для активации промокода используйте команду:\n" +
 		"<code>/promo КОД_ПРОМОКОДА</code>\n\n" +
 		"<b>Пример:</b>\n" +
 		"<code>/promo 245nmao1</code>\n\n" +
 		"📋 <b>Правила использования:</b>\n" +
-		"• Один промокод можно использовать только один раз\n" +
+		"• Каждый промокод можно использовать только один раз\n" +
 		"• Один пользователь может активировать промокод раз в 24 часа\n" +
-		"• Промокод действует 14 дней с момента создания\n" +
-		"• Деньги зачисляются на ваш баланс мгновенно\n\n" +
+		"• Промокод действует 14 дней с момента создания, если не указан другой срок\n" +
+		"• Деньги, дни и трафик зачисляются мгновенно\n" +
+		"• Скидка применяется к следующему пополнению или покупке тарифа\n\n" +
 		"Для просмотра истории использования:\n" +
 		"<code>/promohistory</code>"
 
+	// Показываем активированную, но еще не использованную скидку
+	if discount, err := h.service.GetPendingDiscount(userID); err != nil {
+		log.Printf("PROMO_USER: Ошибка получения скидки пользователя %d: %v", userID, err)
+	} else if discount != nil {
+		text += fmt.Sprintf("\n\n🎟 <b>Ваша скидка:</b> %.0f%% (промокод <code>%s</code>)", discount.Percent, discount.Code)
+	}
+
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
 
@@ -159,7 +185,7 @@ func (h *UserPromoHandler) getErrorMessage(err error) string {
 	switch {
 	case strings.Contains(errorStr, "не может быть использован"):
 		if strings.Contains(errorStr, "Истек") {
-			return "❌ Промокод истек. Срок действия промокода составляет 14 дней."
+			return "❌ Срок действия промокода истек."
 		}
 		if strings.Contains(errorStr, "Уже использован") {
 			return "❌ Вы уже использовали этот промокод или активировали другой промокод в последние 24 часа."
@@ -170,6 +196,12 @@ func (h *UserPromoHandler) getErrorMessage(err error) string {
 		if strings.Contains(errorStr, "Достигнут лимит") {
 			return "❌ Промокод исчерпал лимит использований."
 		}
+		if strings.Contains(errorStr, "Только для новых") {
+			return "❌ Промокод доступен только новым пользователям."
+		}
+		if strings.Contains(errorStr, "меньше минимальной") {
+			return "❌ Сумма ваших пополнений меньше минимальной для этого промокода."
+		}
 		return "❌ Промокод не может быть использован."
 
 	case strings.Contains(errorStr, "ошибка валидации"):
@@ -178,6 +210,9 @@ func (h *UserPromoHandler) getErrorMessage(err error) string {
 	case strings.Contains(errorStr, "ошибка пополнения баланса"):
 		return "❌ Ошибка пополнения баланса. Обратитесь в поддержку."
 
+	case strings.Contains(errorStr, "ошибка продления подписки"), strings.Contains(errorStr, "ошибка авторизации в панели"):
+		return "❌ Ошибка продления подписки. Попробуйте позже."
+
 	case strings.Contains(errorStr, "ошибка транзакции"):
 		return "❌ Ошибка обработки промокода. Попробуйте позже."
 
@@ -194,20 +229,3 @@ func (h *UserPromoHandler) sendMessage(chatID int64, text string) error {
 	_, err := common.GlobalBot.Send(msg)
 	return err
 }
-
-// ValidatePromoCodeFormat проверяет формат промокода
-func (h *UserPromoHandler) ValidatePromoCodeFormat(code string) error {
-	// Промокод должен содержать ровно 8 символов
-	if len(code) != 8 {
-		return fmt.Errorf("промокод должен содержать 8 символов")
-	}
-
-	// Проверяем, что все символы являются буквами и цифрами
-	for _, char := range code {
-		if !((char >= 'a' && char <= 'z') || (char >= '0' && char <= '9')) {
-			return fmt.Errorf("промокод может содержать только строчные буквы и цифры")
-		}
-	}
-
-	return nil
-}
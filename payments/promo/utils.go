@@ -6,3 +6,11 @@ import "bot/common"
 func IsAdmin(userID int64) bool {
 	return userID == common.ADMIN_ID
 }
+
+// nullIfEmpty возвращает nil для пустой строки
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
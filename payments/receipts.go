@@ -0,0 +1,123 @@
+package payments
+
+import (
+	"fmt"
+	"log"
+
+	paymentCommon "bot/payments/common"
+	"bot/payments/sitePayment"
+)
+
+// receiptProvider возвращает провайдер ЮКассы для работы с чеками (чеки доступны при наличии ключей API)
+func (pm *PaymentManager) receiptProvider() *sitePayment.YooKassaPaymentProvider {
+	if pm.yookassaProvider != nil {
+		return pm.yookassaProvider
+	}
+	return sitePayment.NewYooKassaPaymentProvider()
+}
+
+// yooKassaPaymentID возвращает ID платежа в ЮКассе (для Telegram - provider_payment_charge_id)
+func (pm *PaymentManager) yooKassaPaymentID(receipt *paymentCommon.PaymentReceipt) (string, error) {
+	if receipt.Method != paymentCommon.PaymentMethodTelegram {
+		return receipt.PaymentID, nil
+	}
+
+	credits, err := paymentCommon.GetPaymentCredits(receipt.PaymentID)
+	if err != nil {
+		return "", err
+	}
+	for _, credit := range credits {
+		if credit.ExternalID != "" {
+			return credit.ExternalID, nil
+		}
+	}
+
+	return "", fmt.Errorf("платеж %s еще не оплачен", receipt.PaymentID)
+}
+
+// RefreshReceiptStatus обновляет статус чека из ЮКассы
+func (pm *PaymentManager) RefreshReceiptStatus(receipt *paymentCommon.PaymentReceipt) error {
+	if receipt.Status == paymentCommon.ReceiptStatusSucceeded || receipt.Status == paymentCommon.ReceiptStatusNotSent {
+		return nil
+	}
+
+	provider := pm.receiptProvider()
+	yooKassaID, err := pm.yooKassaPaymentID(receipt)
+	if err != nil {
+		return err
+	}
+
+	receiptResponse, err := provider.GetPaymentReceipt(yooKassaID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения чека: %v", err)
+	}
+	if receiptResponse == nil {
+		return nil
+	}
+
+	receipt.ReceiptID = receiptResponse.ID
+	receipt.Status = receiptResponse.Status
+	if fiscalInfo := receiptResponse.FiscalInfo(); fiscalInfo != "" {
+		receipt.FiscalInfo = fiscalInfo
+	}
+
+	return paymentCommon.UpdatePaymentReceiptStatus(receipt.PaymentID, receiptResponse.ID, receiptResponse.Status, receipt.FiscalInfo)
+}
+
+// GetUserReceipts возвращает последние чеки пользователя с актуальными статусами
+func (pm *PaymentManager) GetUserReceipts(userID int64, limit int) ([]*paymentCommon.PaymentReceipt, error) {
+	receipts, err := paymentCommon.GetUserPaymentReceipts(userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, receipt := range receipts {
+		if err := pm.RefreshReceiptStatus(receipt); err != nil {
+			log.Printf("PAYMENT_RECEIPTS: Не удалось обновить статус чека %s: %v", receipt.PaymentID, err)
+		}
+	}
+
+	return receipts, nil
+}
+
+// ResendReceipt повторно регистрирует чек, если предыдущая регистрация не удалась.
+// Возвращает актуальный чек пользователя.
+func (pm *PaymentManager) ResendReceipt(userID int64, paymentID string) (*paymentCommon.PaymentReceipt, error) {
+	receipt, err := paymentCommon.GetPaymentReceipt(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if receipt == nil || receipt.UserID != userID {
+		return nil, fmt.Errorf("чек не найден")
+	}
+
+	if err := pm.RefreshReceiptStatus(receipt); err != nil {
+		log.Printf("PAYMENT_RECEIPTS: Не удалось обновить статус чека %s: %v", paymentID, err)
+	}
+
+	if receipt.Status != paymentCommon.ReceiptStatusCanceled {
+		return receipt, nil
+	}
+
+	yooKassaID, err := pm.yooKassaPaymentID(receipt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Повторяем ту же позицию чека, контакт берем актуальный
+	item := paymentCommon.GetReceiptItemSettings("", receipt.Description)
+	item.VATCode = receipt.VATCode
+	receiptResponse, err := pm.receiptProvider().CreatePaymentReceipt(yooKassaID, userID, receipt.Amount, item)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка повторной регистрации чека: %v", err)
+	}
+
+	receipt.ReceiptID = receiptResponse.ID
+	receipt.Status = receiptResponse.Status
+	if err := paymentCommon.UpdatePaymentReceiptStatus(paymentID, receiptResponse.ID, receiptResponse.Status, receiptResponse.FiscalInfo()); err != nil {
+		log.Printf("PAYMENT_RECEIPTS: %v", err)
+	}
+
+	log.Printf("PAYMENT_RECEIPTS: Чек по платежу %s повторно отправлен на регистрацию", paymentID)
+	return receipt, nil
+}
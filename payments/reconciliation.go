@@ -0,0 +1,351 @@
+package payments
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"bot/common"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DiscrepancyType тип расхождения между ЮКассой и зачислениями
+type DiscrepancyType string
+
+const (
+	DiscrepancyMissingCredit  DiscrepancyType = "missing_credit"  // Успешный платеж не зачислен
+	DiscrepancyDoubleCredit   DiscrepancyType = "double_credit"   // Платеж зачислен несколько раз
+	DiscrepancyAmountMismatch DiscrepancyType = "amount_mismatch" // Зачисленная сумма не совпадает с суммой платежа
+	DiscrepancyOrphanCredit   DiscrepancyType = "orphan_credit"   // Зачисление без успешного платежа у провайдера
+)
+
+// Discrepancy расхождение по одному платежу
+type Discrepancy struct {
+	Type           DiscrepancyType
+	PaymentID      string
+	UserID         int64
+	ProviderAmount float64
+	CreditedAmount float64
+	CreditsCount   int
+}
+
+// ReconciliationReport результат сверки за период
+type ReconciliationReport struct {
+	From              time.Time
+	To                time.Time
+	ProviderPayments  int
+	SucceededPayments int
+	Discrepancies     []Discrepancy
+}
+
+// ReconciliationService сверяет платежи ЮКассы с зачислениями на баланс
+type ReconciliationService struct {
+	paymentManager *PaymentManager
+}
+
+// NewReconciliationService создает новый сервис сверки платежей
+func NewReconciliationService(paymentManager *PaymentManager) *ReconciliationService {
+	return &ReconciliationService{
+		paymentManager: paymentManager,
+	}
+}
+
+// Reconcile выполняет сверку платежей ЮКассы за период
+func (rs *ReconciliationService) Reconcile(from, to time.Time) (*ReconciliationReport, error) {
+	provider := rs.paymentManager.yookassaProvider
+	if provider == nil || !provider.IsEnabled() {
+		return nil, fmt.Errorf("ЮКасса API провайдер не инициализирован")
+	}
+
+	log.Printf("PAYMENT_RECONCILIATION: Сверка платежей за период %s - %s", from.Format("02.01.2006 15:04"), to.Format("02.01.2006 15:04"))
+
+	providerPayments, err := provider.ListPayments(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения платежей ЮКассы: %v", err)
+	}
+
+	ledgerStart, err := paymentCommon.GetCreditLedgerStart()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconciliationReport{
+		From:             from,
+		To:               to,
+		ProviderPayments: len(providerPayments),
+	}
+
+	known := make(map[string]bool, len(providerPayments))
+	for _, payment := range providerPayments {
+		known[payment.ID] = true
+		if payment.Status == paymentCommon.PaymentStatusSucceeded {
+			report.SucceededPayments++
+		}
+
+		credits, err := paymentCommon.GetPaymentCredits(payment.ID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения зачислений по платежу %s: %v", payment.ID, err)
+		}
+
+		if discrepancy := comparePaymentWithCredits(payment, credits, ledgerStart); discrepancy != nil {
+			report.Discrepancies = append(report.Discrepancies, *discrepancy)
+		}
+	}
+
+	// Ищем зачисления за период, для которых у ЮКассы нет платежа в этом же периоде
+	periodCredits, err := paymentCommon.GetPaymentCreditsInRange(paymentCommon.PaymentMethodAPI, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения зачислений за период: %v", err)
+	}
+
+	for _, paymentID := range uniqueCreditPaymentIDs(periodCredits) {
+		if known[paymentID] {
+			continue
+		}
+		known[paymentID] = true
+
+		credits, err := paymentCommon.GetPaymentCredits(paymentID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения зачислений по платежу %s: %v", paymentID, err)
+		}
+
+		// Платеж мог быть создан до начала периода - запрашиваем его напрямую
+		payment, err := provider.GetPayment(paymentID)
+		if err != nil {
+			log.Printf("PAYMENT_RECONCILIATION: Платеж %s не найден у провайдера: %v", paymentID, err)
+			payment = nil
+		}
+
+		if discrepancy := comparePaymentWithCredits(payment, credits, ledgerStart); discrepancy != nil {
+			if payment == nil {
+				discrepancy.PaymentID = paymentID
+			}
+			report.Discrepancies = append(report.Discrepancies, *discrepancy)
+		}
+	}
+
+	log.Printf("PAYMENT_RECONCILIATION: Сверка завершена: платежей %d, успешных %d, расхождений %d",
+		report.ProviderPayments, report.SucceededPayments, len(report.Discrepancies))
+
+	return report, nil
+}
+
+// comparePaymentWithCredits сравнивает платеж провайдера с записями о зачислении.
+// payment может быть nil, если провайдер не знает о платеже.
+// Платежи, созданные до ledgerStart, зачислялись без записи в payment_credits и не считаются незачисленными.
+func comparePaymentWithCredits(payment *paymentCommon.PaymentInfo, credits []paymentCommon.PaymentCredit, ledgerStart time.Time) *Discrepancy {
+	creditedAmount := 0.0
+	creditsCount := 0
+	var userID int64
+	for _, credit := range credits {
+		creditedAmount += credit.Amount
+		if credit.Kind == paymentCommon.CreditKindPayment || credit.Kind == paymentCommon.CreditKindDuplicate {
+			creditsCount++
+		}
+		if userID == 0 {
+			userID = credit.UserID
+		}
+	}
+
+	discrepancy := &Discrepancy{
+		UserID:         userID,
+		CreditedAmount: creditedAmount,
+		CreditsCount:   creditsCount,
+	}
+
+	if payment == nil || payment.Status != paymentCommon.PaymentStatusSucceeded {
+		if creditsCount == 0 && amountsEqual(creditedAmount, 0) {
+			return nil
+		}
+		if payment != nil {
+			discrepancy.PaymentID = payment.ID
+			discrepancy.ProviderAmount = payment.Amount
+		}
+		discrepancy.Type = DiscrepancyOrphanCredit
+		return discrepancy
+	}
+
+	discrepancy.PaymentID = payment.ID
+	discrepancy.ProviderAmount = payment.Amount
+	if payment.UserID != 0 {
+		discrepancy.UserID = payment.UserID
+	}
+
+	switch {
+	case creditsCount == 0 && createdBeforeLedger(payment, ledgerStart):
+		return nil
+	case creditsCount == 0:
+		discrepancy.Type = DiscrepancyMissingCredit
+	case amountsEqual(creditedAmount, payment.Amount):
+		// Корректировки уже выровняли сумму - расхождения нет
+		return nil
+	case creditsCount > 1:
+		discrepancy.Type = DiscrepancyDoubleCredit
+	default:
+		discrepancy.Type = DiscrepancyAmountMismatch
+	}
+
+	return discrepancy
+}
+
+// createdBeforeLedger проверяет, создан ли платеж до начала учета зачислений.
+// Платеж с неизвестным временем создания считается созданным после.
+func createdBeforeLedger(payment *paymentCommon.PaymentInfo, ledgerStart time.Time) bool {
+	createdAt, err := time.Parse(time.RFC3339Nano, payment.CreatedAt)
+	return err == nil && createdAt.Before(ledgerStart)
+}
+
+// FixDiscrepancy исправляет расхождение по платежу через штатный путь зачисления
+func (rs *ReconciliationService) FixDiscrepancy(paymentID string) (string, error) {
+	provider := rs.paymentManager.yookassaProvider
+	if provider == nil {
+		return "", fmt.Errorf("ЮКасса API провайдер не инициализирован")
+	}
+
+	payment, err := provider.GetPayment(paymentID)
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения платежа: %v", err)
+	}
+
+	credits, err := paymentCommon.GetPaymentCredits(paymentID)
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения зачислений: %v", err)
+	}
+
+	ledgerStart, err := paymentCommon.GetCreditLedgerStart()
+	if err != nil {
+		return "", err
+	}
+
+	// Пересчитываем расхождение заново, чтобы повторное нажатие кнопки ничего не сломало
+	discrepancy := comparePaymentWithCredits(payment, credits, ledgerStart)
+	if discrepancy == nil {
+		return "✅ Расхождений по платежу больше нет", nil
+	}
+
+	if discrepancy.UserID == 0 {
+		return "", fmt.Errorf("не удалось определить пользователя платежа")
+	}
+
+	switch discrepancy.Type {
+	case DiscrepancyMissingCredit:
+		payment.UserID = discrepancy.UserID
+		if _, err := paymentCommon.CreditPayment(payment, "reconciliation"); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("✅ Платеж зачислен: +%s пользователю %d", paymentCommon.FormatAmount(payment.Amount), discrepancy.UserID), nil
+
+	case DiscrepancyDoubleCredit, DiscrepancyAmountMismatch:
+		delta := math.Round((discrepancy.ProviderAmount-discrepancy.CreditedAmount)*100) / 100
+		if err := paymentCommon.AdjustPaymentCredit(paymentID, paymentCommon.PaymentMethodAPI, discrepancy.UserID, delta, "reconciliation"); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("✅ Баланс пользователя %d скорректирован на %+.2f₽", discrepancy.UserID, delta), nil
+
+	default:
+		return "", fmt.Errorf("расхождение типа %s требует ручной проверки", discrepancy.Type)
+	}
+}
+
+// SendReportToAdmin отправляет отчет о сверке администратору
+func (rs *ReconciliationService) SendReportToAdmin(report *ReconciliationReport) error {
+	if common.GlobalBot == nil {
+		return fmt.Errorf("бот не инициализирован")
+	}
+
+	msg := tgbotapi.NewMessage(common.ADMIN_ID, FormatReconciliationReport(report))
+	msg.ParseMode = "HTML"
+
+	if keyboard := reconciliationKeyboard(report); keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки отчета о сверке: %v", err)
+	}
+
+	return nil
+}
+
+// FormatReconciliationReport формирует текст отчета о сверке
+func FormatReconciliationReport(report *ReconciliationReport) string {
+	var sb strings.Builder
+
+	sb.WriteString("🧾 <b>Сверка платежей ЮКассы</b>\n\n")
+	sb.WriteString(fmt.Sprintf("📅 Период: %s — %s\n", report.From.Format("02.01.2006 15:04"), report.To.Format("02.01.2006 15:04")))
+	sb.WriteString(fmt.Sprintf("💳 Платежей у провайдера: %d (успешных: %d)\n", report.ProviderPayments, report.SucceededPayments))
+	sb.WriteString(fmt.Sprintf("⚠️ Расхождений: %d\n", len(report.Discrepancies)))
+
+	if len(report.Discrepancies) == 0 {
+		sb.WriteString("\n✅ Все успешные платежи зачислены ровно один раз")
+		return sb.String()
+	}
+
+	sb.WriteString("\n")
+	for i, d := range report.Discrepancies {
+		sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, getDiscrepancyDescription(d.Type)))
+		sb.WriteString(fmt.Sprintf("   🆔 <code>%s</code>\n", d.PaymentID))
+		sb.WriteString(fmt.Sprintf("   👤 %d | ЮКасса: %s | зачислено: %s (%d раз)\n",
+			d.UserID, paymentCommon.FormatAmount(d.ProviderAmount), paymentCommon.FormatAmount(d.CreditedAmount), d.CreditsCount))
+	}
+
+	return sb.String()
+}
+
+// reconciliationKeyboard создает кнопки исправления для расхождений, которые можно исправить автоматически
+func reconciliationKeyboard(report *ReconciliationReport) *tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, d := range report.Discrepancies {
+		if d.Type == DiscrepancyOrphanCredit || d.PaymentID == "" {
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🔧 Исправить #%d", i+1), "recon_fix:"+d.PaymentID),
+		))
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &keyboard
+}
+
+// getDiscrepancyDescription возвращает описание типа расхождения на русском
+func getDiscrepancyDescription(t DiscrepancyType) string {
+	switch t {
+	case DiscrepancyMissingCredit:
+		return "❌ Платеж не зачислен"
+	case DiscrepancyDoubleCredit:
+		return "♻️ Двойное зачисление"
+	case DiscrepancyAmountMismatch:
+		return "⚖️ Несовпадение суммы"
+	case DiscrepancyOrphanCredit:
+		return "❓ Зачисление без платежа"
+	default:
+		return "Неизвестное расхождение"
+	}
+}
+
+// uniqueCreditPaymentIDs возвращает уникальные ID платежей из списка зачислений
+func uniqueCreditPaymentIDs(credits []paymentCommon.PaymentCredit) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, credit := range credits {
+		if !seen[credit.PaymentID] {
+			seen[credit.PaymentID] = true
+			ids = append(ids, credit.PaymentID)
+		}
+	}
+	return ids
+}
+
+// amountsEqual сравнивает суммы с точностью до копейки
+func amountsEqual(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
@@ -0,0 +1,57 @@
+package payments
+
+import (
+	"testing"
+	"time"
+
+	paymentCommon "bot/payments/common"
+)
+
+func TestComparePaymentWithCredits(t *testing.T) {
+	ledgerStart := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	succeeded := func(id, createdAt string) *paymentCommon.PaymentInfo {
+		return &paymentCommon.PaymentInfo{ID: id, UserID: 7, Amount: 100, Status: paymentCommon.PaymentStatusSucceeded, CreatedAt: createdAt}
+	}
+	credit := func(kind string, amount float64) paymentCommon.PaymentCredit {
+		return paymentCommon.PaymentCredit{PaymentID: "p", UserID: 7, Amount: amount, Kind: kind}
+	}
+
+	tests := []struct {
+		name     string
+		payment  *paymentCommon.PaymentInfo
+		credits  []paymentCommon.PaymentCredit
+		expected DiscrepancyType // Пустой тип - расхождения нет
+	}{
+		{"зачислен один раз", succeeded("p", "2026-05-02T10:00:00.000Z"),
+			[]paymentCommon.PaymentCredit{credit(paymentCommon.CreditKindPayment, 100)}, ""},
+		{"не зачислен", succeeded("p", "2026-05-02T10:00:00.000Z"), nil, DiscrepancyMissingCredit},
+		{"не зачислен, время неизвестно", succeeded("p", ""), nil, DiscrepancyMissingCredit},
+		{"создан до начала учета", succeeded("p", "2026-04-30T23:59:59.000Z"), nil, ""},
+		{"зачислен дважды", succeeded("p", "2026-05-02T10:00:00.000Z"),
+			[]paymentCommon.PaymentCredit{credit(paymentCommon.CreditKindPayment, 100), credit(paymentCommon.CreditKindPayment, 100)}, DiscrepancyDoubleCredit},
+		{"повтор до уникального индекса", succeeded("p", "2026-05-02T10:00:00.000Z"),
+			[]paymentCommon.PaymentCredit{credit(paymentCommon.CreditKindPayment, 100), credit(paymentCommon.CreditKindDuplicate, 100)}, DiscrepancyDoubleCredit},
+		{"повтор скорректирован", succeeded("p", "2026-05-02T10:00:00.000Z"),
+			[]paymentCommon.PaymentCredit{credit(paymentCommon.CreditKindPayment, 100), credit(paymentCommon.CreditKindPayment, 100),
+				credit(paymentCommon.CreditKindAdjustment, -100)}, ""},
+		{"другая сумма", succeeded("p", "2026-05-02T10:00:00.000Z"),
+			[]paymentCommon.PaymentCredit{credit(paymentCommon.CreditKindPayment, 90)}, DiscrepancyAmountMismatch},
+		{"зачисление без платежа", nil, []paymentCommon.PaymentCredit{credit(paymentCommon.CreditKindPayment, 100)}, DiscrepancyOrphanCredit},
+		{"неуспешный платеж без зачислений",
+			&paymentCommon.PaymentInfo{ID: "p", Amount: 100, Status: paymentCommon.PaymentStatusCanceled}, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discrepancy := comparePaymentWithCredits(tt.payment, tt.credits, ledgerStart)
+			switch {
+			case tt.expected == "" && discrepancy != nil:
+				t.Errorf("Ожидалось отсутствие расхождения, получено %+v", discrepancy)
+			case tt.expected != "" && discrepancy == nil:
+				t.Errorf("Ожидалось расхождение %s, получено nil", tt.expected)
+			case discrepancy != nil && discrepancy.Type != tt.expected:
+				t.Errorf("Тип расхождения %s, ожидалось %s", discrepancy.Type, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package payments
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	"bot/common"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// RefundResult результат возврата платежа
+type RefundResult struct {
+	Refund         *paymentCommon.RefundInfo
+	NewBalance     float64
+	ConfigDisabled bool
+}
+
+// GetRefundableAmount возвращает сумму, доступную для возврата по платежу
+func (pm *PaymentManager) GetRefundableAmount(paymentID string) (*paymentCommon.PaymentCredit, float64, error) {
+	credits, err := paymentCommon.GetPaymentCredits(paymentID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var credit *paymentCommon.PaymentCredit
+	for i := range credits {
+		if credits[i].Kind == paymentCommon.CreditKindPayment {
+			credit = &credits[i]
+			break
+		}
+	}
+
+	if credit == nil {
+		return nil, 0, fmt.Errorf("зачисление по платежу %s не найдено", paymentID)
+	}
+
+	refunded, err := paymentCommon.GetRefundedAmount(paymentID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	available := credit.Amount - refunded
+	if available < 0 {
+		available = 0
+	}
+
+	return credit, available, nil
+}
+
+// RefundPayment возвращает платеж полностью (amount <= 0) или частично,
+// списывает сумму возврата с баланса и уведомляет пользователя
+func (pm *PaymentManager) RefundPayment(adminID int64, paymentID string, amount float64, reason string) (*RefundResult, error) {
+	credit, _, err := pm.GetRefundableAmount(paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сумма резервируется до запроса к провайдеру: повторное нажатие не вернет платеж дважды
+	reservation, err := paymentCommon.ReservePaymentRefund(credit, amount, reason, adminID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("PAYMENT_REFUND: Возврат #%d платежа %s (метод: %s) пользователю %d на сумму %.2f₽, инициатор: %d",
+		reservation.Sequence, paymentID, credit.Method, credit.UserID, reservation.Amount, adminID)
+
+	refund, err := pm.Refund(credit.Method, paymentID, reservation.Amount, reason, reservation.Sequence)
+	if err != nil {
+		if markErr := paymentCommon.MarkPaymentRefundUnknown(reservation.ID); markErr != nil {
+			log.Printf("PAYMENT_REFUND: %v", markErr)
+		}
+		return nil, fmt.Errorf("ошибка возврата у провайдера: %v\n\nВозврат отмечен для сверки, повтор той же суммы безопасен", err)
+	}
+	refund.UserID = credit.UserID
+	if refund.Reason == "" {
+		refund.Reason = reason
+	}
+
+	// Возврат и списание с баланса сохраняются вместе: при ошибке возврат остается зарезервированным
+	// для сверки, и повтор той же суммы безопасен
+	newBalance, err := paymentCommon.CompletePaymentRefund(reservation.ID, refund)
+	if err != nil {
+		if markErr := paymentCommon.MarkPaymentRefundUnknown(reservation.ID); markErr != nil {
+			log.Printf("PAYMENT_REFUND: %v", markErr)
+		}
+		return nil, fmt.Errorf("возврат %s создан у провайдера, но не сохранен: %v\n\nВозврат отмечен для сверки, повтор той же суммы безопасен", refund.ID, err)
+	}
+
+	result := &RefundResult{Refund: refund}
+
+	if refund.Status == "canceled" {
+		log.Printf("PAYMENT_REFUND: Возврат %s по платежу %s отменен провайдером", refund.ID, paymentID)
+		return result, nil
+	}
+	result.NewBalance = newBalance
+
+	if newBalance < 0 {
+		user, err := common.GetUserByTelegramID(credit.UserID)
+		if err != nil {
+			log.Printf("PAYMENT_REFUND: Ошибка получения пользователя %d: %v", credit.UserID, err)
+		} else if user.HasActiveConfig {
+			if err := common.DisableClientConfig(user); err != nil {
+				log.Printf("PAYMENT_REFUND: Ошибка отключения конфига пользователя %d: %v", credit.UserID, err)
+			} else {
+				result.ConfigDisabled = true
+			}
+		}
+	} else {
+		// Пересчитываем срок подписки по новому балансу
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			common.ForceBalanceRecalculation(credit.UserID)
+		}()
+	}
+
+	pm.notifyUserAboutRefund(credit.UserID, result)
+
+	log.Printf("PAYMENT_REFUND: Возврат %s выполнен, новый баланс пользователя %d: %.2f₽",
+		refund.ID, credit.UserID, newBalance)
+
+	return result, nil
+}
+
+// notifyUserAboutRefund отправляет пользователю уведомление о возврате
+func (pm *PaymentManager) notifyUserAboutRefund(userID int64, result *RefundResult) {
+	if common.GlobalBot == nil {
+		return
+	}
+
+	text := fmt.Sprintf("💸 <b>Возврат платежа</b>\n\n"+
+		"Сумма возврата: %.2f₽\n"+
+		"💰 Текущий баланс: %.2f₽", result.Refund.Amount, result.NewBalance)
+
+	if result.Refund.Reason != "" {
+		text += fmt.Sprintf("\n📝 Причина: %s", html.EscapeString(result.Refund.Reason))
+	}
+
+	if result.ConfigDisabled {
+		text += "\n\n⚠️ Баланс стал отрицательным, доступ к VPN приостановлен.\n" +
+			"Пополните баланс для возобновления доступа."
+	}
+
+	text += "\n\nДеньги вернутся тем же способом, которым был оплачен платеж, в течение нескольких дней."
+
+	msg := tgbotapi.NewMessage(userID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		log.Printf("PAYMENT_REFUND: Ошибка отправки уведомления о возврате пользователю %d: %v", userID, err)
+	}
+}
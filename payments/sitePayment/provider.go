@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -31,10 +32,14 @@ type YooKassaPaymentRequest struct {
 	Amount       Amount                 `json:"amount"`
 	Currency     string                 `json:"currency"`
 	Description  string                 `json:"description"`
-	Confirmation Confirmation           `json:"confirmation"`
+	Confirmation *Confirmation          `json:"confirmation,omitempty"`
 	Capture      bool                   `json:"capture"`
 	Receipt      *Receipt               `json:"receipt,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+
+	// Сохранение способа оплаты и автоплатежи
+	SavePaymentMethod bool   `json:"save_payment_method,omitempty"`
+	PaymentMethodID   string `json:"payment_method_id,omitempty"`
 }
 
 // Receipt структура чека для 54-ФЗ
@@ -45,7 +50,7 @@ type Receipt struct {
 
 // Customer структура покупателя
 type Customer struct {
-	Email string `json:"email"`
+	Email string `json:"email,omitempty"`
 	Phone string `json:"phone,omitempty"`
 }
 
@@ -88,6 +93,33 @@ type YooKassaPaymentResponse struct {
 	CreatedAt    string                 `json:"created_at"`
 	Metadata     map[string]interface{} `json:"metadata"`
 	Test         bool                   `json:"test"`
+
+	PaymentMethod       *PaymentMethodResponse `json:"payment_method,omitempty"`
+	CancellationDetails *CancellationDetails   `json:"cancellation_details,omitempty"`
+}
+
+// PaymentMethodResponse способ оплаты в ответе ЮКассы
+type PaymentMethodResponse struct {
+	Type  string        `json:"type"`
+	ID    string        `json:"id"`
+	Saved bool          `json:"saved"`
+	Title string        `json:"title"`
+	Card  *CardResponse `json:"card,omitempty"`
+}
+
+// CardResponse данные банковской карты
+type CardResponse struct {
+	First6      string `json:"first6"`
+	Last4       string `json:"last4"`
+	ExpiryMonth string `json:"expiry_month"`
+	ExpiryYear  string `json:"expiry_year"`
+	CardType    string `json:"card_type"`
+}
+
+// CancellationDetails причина отмены платежа
+type CancellationDetails struct {
+	Party  string `json:"party"`
+	Reason string `json:"reason"`
 }
 
 // ConfirmationResponse структура подтверждения в ответе
@@ -96,6 +128,76 @@ type ConfirmationResponse struct {
 	ConfirmationURL string `json:"confirmation_url,omitempty"`
 }
 
+// YooKassaPaymentList структура ответа со списком платежей
+type YooKassaPaymentList struct {
+	Type       string                    `json:"type"`
+	Items      []YooKassaPaymentResponse `json:"items"`
+	NextCursor string                    `json:"next_cursor"`
+}
+
+// YooKassaRefundRequest структура запроса возврата
+type YooKassaRefundRequest struct {
+	PaymentID   string `json:"payment_id"`
+	Amount      Amount `json:"amount"`
+	Description string `json:"description,omitempty"`
+}
+
+// YooKassaRefundResponse структура ответа на запрос возврата
+type YooKassaRefundResponse struct {
+	ID          string `json:"id"`
+	PaymentID   string `json:"payment_id"`
+	Status      string `json:"status"`
+	Amount      Amount `json:"amount"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// YooKassaReceiptRequest структура запроса на создание чека
+type YooKassaReceiptRequest struct {
+	Type        string       `json:"type"`
+	PaymentID   string       `json:"payment_id"`
+	Customer    Customer     `json:"customer"`
+	Items       []Item       `json:"items"`
+	Settlements []Settlement `json:"settlements"`
+	Send        bool         `json:"send"`
+}
+
+// Settlement расчет по чеку
+type Settlement struct {
+	Type   string `json:"type"`
+	Amount Amount `json:"amount"`
+}
+
+// YooKassaReceiptResponse структура чека в ответе ЮКассы
+type YooKassaReceiptResponse struct {
+	ID                   string `json:"id"`
+	Type                 string `json:"type"`
+	PaymentID            string `json:"payment_id"`
+	Status               string `json:"status"`
+	FiscalDocumentNumber string `json:"fiscal_document_number"`
+	FiscalStorageNumber  string `json:"fiscal_storage_number"`
+	FiscalAttribute      string `json:"fiscal_attribute"`
+	RegisteredAt         string `json:"registered_at"`
+}
+
+// YooKassaReceiptList структура ответа со списком чеков
+type YooKassaReceiptList struct {
+	Type  string                    `json:"type"`
+	Items []YooKassaReceiptResponse `json:"items"`
+}
+
+// FiscalInfo возвращает фискальные реквизиты чека в читаемом виде
+func (r *YooKassaReceiptResponse) FiscalInfo() string {
+	if r.FiscalDocumentNumber == "" {
+		return ""
+	}
+	info := fmt.Sprintf("ФН: %s, ФД: %s, ФП: %s", r.FiscalStorageNumber, r.FiscalDocumentNumber, r.FiscalAttribute)
+	if registeredAt, err := time.Parse(time.RFC3339, r.RegisteredAt); err == nil {
+		info += ", " + registeredAt.Local().Format("02.01.2006 15:04")
+	}
+	return info
+}
+
 // WebhookNotification структура уведомления от ЮКассы
 type WebhookNotification struct {
 	Type   string                  `json:"type"`
@@ -128,8 +230,18 @@ func (y *YooKassaPaymentProvider) GetMethod() paymentCommon.PaymentMethod {
 
 // CreatePayment создает платеж через API ЮКассы
 func (y *YooKassaPaymentProvider) CreatePayment(userID int64, amount float64, description string) (*paymentCommon.PaymentInfo, error) {
+	return y.createPayment(userID, amount, description, paymentCommon.ReceiptPlanTopup, false)
+}
+
+// CreatePaymentWithCardSaving создает платеж с сохранением карты для автопополнения
+func (y *YooKassaPaymentProvider) CreatePaymentWithCardSaving(userID int64, amount float64, description string) (*paymentCommon.PaymentInfo, error) {
+	return y.createPayment(userID, amount, description, paymentCommon.ReceiptPlanCardLink, true)
+}
+
+// createPayment создает платеж через API ЮКассы с подтверждением пользователем
+func (y *YooKassaPaymentProvider) createPayment(userID int64, amount float64, description, receiptPlan string, savePaymentMethod bool) (*paymentCommon.PaymentInfo, error) {
 	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
-		"Создание платежа для пользователя %d на сумму %.2f", userID, amount)
+		"Создание платежа для пользователя %d на сумму %.2f (сохранение карты: %v)", userID, amount, savePaymentMethod)
 
 	// Валидация суммы
 	if err := paymentCommon.ValidateAmount(amount); err != nil {
@@ -147,15 +259,14 @@ func (y *YooKassaPaymentProvider) CreatePayment(userID int64, amount float64, de
 		},
 		Currency:    "RUB",
 		Description: paymentCommon.SanitizeDescription(description),
-		Confirmation: Confirmation{
+		Confirmation: &Confirmation{
 			Type:      "redirect",
 			ReturnURL: fmt.Sprintf("https://t.me/%s", strings.TrimPrefix(common.BOT_TOKEN, "")), // Возврат в бота
 		},
 		Capture: true,
-		Receipt: y.createReceipt(userID, amount, description),
-		Metadata: paymentCommon.CreatePaymentMetadata(userID, map[string]interface{}{
-			"idempotency_key": idempotencyKey,
-		}),
+		Receipt: BuildReceipt(userID, amount, description, receiptPlan),
+		Metadata:          paymentCommon.CreatePaymentMetadata(userID, createPaymentExtra(idempotencyKey, savePaymentMethod)),
+		SavePaymentMethod: savePaymentMethod,
 	}
 
 	// Отправляем запрос
@@ -189,6 +300,8 @@ func (y *YooKassaPaymentProvider) CreatePayment(userID int64, amount float64, de
 		Metadata:    paymentResponse.Metadata,
 	}
 
+	SaveReceiptRecord(paymentInfo.ID, userID, paymentCommon.PaymentMethodAPI, amount, request.Receipt)
+
 	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
 		"Платеж создан: ID=%s, UserID=%d, Amount=%.2f, URL=%s",
 		paymentResponse.ID, userID, amount, paymentResponse.Confirmation.ConfirmationURL)
@@ -196,6 +309,71 @@ func (y *YooKassaPaymentProvider) CreatePayment(userID int64, amount float64, de
 	return paymentInfo, nil
 }
 
+// createPaymentExtra возвращает метаданные платежа; платеж с сохранением карты отмечается как привязка карты
+func createPaymentExtra(idempotencyKey string, savePaymentMethod bool) map[string]interface{} {
+	extra := map[string]interface{}{
+		"idempotency_key": idempotencyKey,
+	}
+	if savePaymentMethod {
+		extra[paymentCommon.MetadataCardLink] = "true"
+	}
+	return extra
+}
+
+// ChargeSavedPaymentMethod списывает средства с сохраненной карты без участия пользователя.
+// attempt - номер списания автопополнения: повтор с тем же номером не создает второй платеж.
+func (y *YooKassaPaymentProvider) ChargeSavedPaymentMethod(userID int64, paymentMethodID string, amount float64, description string, attempt int64) (*paymentCommon.PaymentInfo, error) {
+	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
+		"Автоплатеж #%d для пользователя %d на сумму %.2f", attempt, userID, amount)
+
+	if err := paymentCommon.ValidateAmount(amount); err != nil {
+		return nil, err
+	}
+
+	idempotencyKey := generateAutoTopupIdempotencyKey(userID, amount, attempt)
+
+	request := YooKassaPaymentRequest{
+		Amount: Amount{
+			Value:    fmt.Sprintf("%.2f", amount),
+			Currency: "RUB",
+		},
+		Currency:        "RUB",
+		Description:     paymentCommon.SanitizeDescription(description),
+		Capture:         true,
+		Receipt:         BuildReceipt(userID, amount, description, paymentCommon.ReceiptPlanAutoTopup),
+		PaymentMethodID: paymentMethodID,
+		Metadata: paymentCommon.CreatePaymentMetadata(userID, map[string]interface{}{
+			"idempotency_key": idempotencyKey,
+			"auto_topup":      true,
+		}),
+	}
+
+	response, err := y.sendAPIRequest("POST", "/payments", request, idempotencyKey)
+	if err != nil {
+		paymentCommon.LogPaymentEvent("ERROR", paymentCommon.PaymentMethodAPI,
+			"Ошибка автоплатежа для пользователя %d: %v", userID, err)
+		return nil, err
+	}
+
+	var paymentResponse YooKassaPaymentResponse
+	if err := json.Unmarshal(response, &paymentResponse); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга ответа ЮКассы: %v", err)
+	}
+
+	paymentInfo := y.convertPaymentResponse(paymentResponse)
+	if paymentInfo.UserID == 0 {
+		paymentInfo.UserID = userID
+	}
+
+	SaveReceiptRecord(paymentInfo.ID, userID, paymentCommon.PaymentMethodAPI, amount, request.Receipt)
+
+	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
+		"Автоплатеж создан: ID=%s, UserID=%d, Amount=%.2f, Status=%s",
+		paymentInfo.ID, userID, paymentInfo.Amount, paymentInfo.Status)
+
+	return paymentInfo, nil
+}
+
 // GetPayment получает информацию о платеже
 func (y *YooKassaPaymentProvider) GetPayment(paymentID string) (*paymentCommon.PaymentInfo, error) {
 	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
@@ -239,10 +417,119 @@ func (y *YooKassaPaymentProvider) GetPayment(paymentID string) (*paymentCommon.P
 		PaymentURL:  paymentResponse.Confirmation.ConfirmationURL,
 		Metadata:    paymentResponse.Metadata,
 	}
+	y.attachPaymentMethodInfo(paymentInfo, paymentResponse)
 
 	return paymentInfo, nil
 }
 
+// ListPayments получает все платежи, созданные в указанном периоде, постранично
+func (y *YooKassaPaymentProvider) ListPayments(from, to time.Time) ([]*paymentCommon.PaymentInfo, error) {
+	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
+		"Получение списка платежей за период %s - %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+
+	var result []*paymentCommon.PaymentInfo
+	cursor := ""
+
+	for {
+		params := url.Values{}
+		params.Set("created_at.gte", from.UTC().Format(time.RFC3339))
+		params.Set("created_at.lt", to.UTC().Format(time.RFC3339))
+		params.Set("limit", "100")
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+
+		response, err := y.sendAPIRequest("GET", "/payments?"+params.Encode(), nil, "")
+		if err != nil {
+			return nil, err
+		}
+
+		var page YooKassaPaymentList
+		if err := json.Unmarshal(response, &page); err != nil {
+			return nil, fmt.Errorf("ошибка парсинга списка платежей ЮКассы: %v", err)
+		}
+
+		for _, payment := range page.Items {
+			result = append(result, y.convertPaymentResponse(payment))
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
+		"Получено %d платежей за период", len(result))
+
+	return result, nil
+}
+
+// convertPaymentResponse конвертирует ответ ЮКассы в информацию о платеже
+func (y *YooKassaPaymentProvider) convertPaymentResponse(payment YooKassaPaymentResponse) *paymentCommon.PaymentInfo {
+	// Извлекаем userID из метаданных
+	var userID int64
+	switch v := payment.Metadata["user_id"].(type) {
+	case float64:
+		userID = int64(v)
+	case string:
+		fmt.Sscanf(v, "%d", &userID)
+	}
+
+	amount := 0.0
+	if amountValue := payment.Amount.Value; amountValue != "" {
+		fmt.Sscanf(amountValue, "%f", &amount)
+	}
+
+	paymentInfo := &paymentCommon.PaymentInfo{
+		ID:          payment.ID,
+		UserID:      userID,
+		Amount:      amount,
+		Currency:    payment.Amount.Currency,
+		Status:      y.convertYooKassaStatus(payment.Status),
+		Method:      paymentCommon.PaymentMethodAPI,
+		Description: payment.Description,
+		CreatedAt:   payment.CreatedAt,
+		UpdatedAt:   paymentCommon.GetCurrentTimestamp(),
+		PaymentURL:  payment.Confirmation.ConfirmationURL,
+		Metadata:    payment.Metadata,
+	}
+	y.attachPaymentMethodInfo(paymentInfo, payment)
+
+	return paymentInfo
+}
+
+// attachPaymentMethodInfo добавляет в метаданные сохраненный способ оплаты и причину отмены
+func (y *YooKassaPaymentProvider) attachPaymentMethodInfo(paymentInfo *paymentCommon.PaymentInfo, payment YooKassaPaymentResponse) {
+	if paymentInfo.Metadata == nil {
+		paymentInfo.Metadata = make(map[string]interface{})
+	}
+
+	if method := payment.PaymentMethod; method != nil && method.Saved && method.ID != "" {
+		paymentInfo.Metadata[paymentCommon.MetadataSavedPaymentMethodID] = method.ID
+		paymentInfo.Metadata[paymentCommon.MetadataPaymentMethodTitle] = paymentMethodTitle(method)
+	}
+
+	if payment.CancellationDetails != nil {
+		paymentInfo.Metadata[paymentCommon.MetadataCancellationReason] = payment.CancellationDetails.Reason
+	}
+}
+
+// paymentMethodTitle возвращает название способа оплаты для показа пользователю
+func paymentMethodTitle(method *PaymentMethodResponse) string {
+	if method.Card != nil && method.Card.Last4 != "" {
+		cardType := method.Card.CardType
+		if cardType == "" {
+			cardType = "Карта"
+		}
+		return fmt.Sprintf("%s •••• %s", cardType, method.Card.Last4)
+	}
+	if method.Title != "" {
+		return method.Title
+	}
+	return method.Type
+}
+
 // ProcessWebhook обрабатывает уведомления от ЮКассы
 func (y *YooKassaPaymentProvider) ProcessWebhook(data []byte) (*paymentCommon.PaymentInfo, error) {
 	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
@@ -291,26 +578,79 @@ func (y *YooKassaPaymentProvider) ProcessWebhook(data []byte) (*paymentCommon.Pa
 		UpdatedAt:   paymentCommon.GetCurrentTimestamp(),
 		Metadata:    payment.Metadata,
 	}
+	y.attachPaymentMethodInfo(paymentInfo, payment)
 
-	// Если платеж успешен, пополняем баланс
+	// Если платеж успешен, пополняем баланс (повторные уведомления не зачисляются)
 	if status == paymentCommon.PaymentStatusSucceeded && userID > 0 {
-		err := common.AddBalance(userID, amount)
+		credited, err := paymentCommon.CreditPayment(paymentInfo, "webhook")
 		if err != nil {
 			paymentCommon.LogPaymentEvent("ERROR", paymentCommon.PaymentMethodAPI,
 				"Ошибка пополнения баланса для пользователя %d: %v", userID, err)
 			return paymentInfo, fmt.Errorf("ошибка пополнения баланса: %v", err)
 		}
 
-		paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
-			"Баланс пользователя %d пополнен на %.2f₽", userID, amount)
+		if credited {
+			paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
+				"Баланс пользователя %d пополнен на %.2f₽", userID, amount)
+		}
 	}
 
 	return paymentInfo, nil
 }
 
+// Refund выполняет полный или частичный возврат платежа через API ЮКассы
+func (y *YooKassaPaymentProvider) Refund(paymentID string, amount float64, reason string, sequence int) (*paymentCommon.RefundInfo, error) {
+	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
+		"Возврат платежа %s на сумму %.2f (причина: %s)", paymentID, amount, reason)
+
+	if amount <= 0 {
+		return nil, paymentCommon.ErrInvalidAmount
+	}
+
+	request := YooKassaRefundRequest{
+		PaymentID: paymentID,
+		Amount: Amount{
+			Value:    fmt.Sprintf("%.2f", amount),
+			Currency: "RUB",
+		},
+		Description: paymentCommon.SanitizeDescription(reason),
+	}
+
+	idempotencyKey := generateRefundIdempotencyKey(paymentID, amount, sequence)
+	response, err := y.sendAPIRequest("POST", "/refunds", request, idempotencyKey)
+	if err != nil {
+		paymentCommon.LogPaymentEvent("ERROR", paymentCommon.PaymentMethodAPI,
+			"Ошибка возврата платежа %s: %v", paymentID, err)
+		return nil, err
+	}
+
+	var refundResponse YooKassaRefundResponse
+	if err := json.Unmarshal(response, &refundResponse); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга ответа ЮКассы: %v", err)
+	}
+
+	refundAmount := amount
+	if refundResponse.Amount.Value != "" {
+		fmt.Sscanf(refundResponse.Amount.Value, "%f", &refundAmount)
+	}
+
+	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
+		"Возврат создан: ID=%s, PaymentID=%s, Status=%s, Amount=%.2f",
+		refundResponse.ID, paymentID, refundResponse.Status, refundAmount)
+
+	return &paymentCommon.RefundInfo{
+		ID:        refundResponse.ID,
+		PaymentID: paymentID,
+		Amount:    refundAmount,
+		Status:    refundResponse.Status,
+		Reason:    reason,
+		CreatedAt: refundResponse.CreatedAt,
+	}, nil
+}
+
 // sendAPIRequest отправляет запрос к API ЮКассы
 func (y *YooKassaPaymentProvider) sendAPIRequest(method, endpoint string, body interface{}, idempotencyKey string) ([]byte, error) {
-	url := YooKassaAPIURL + endpoint
+	requestURL := YooKassaAPIURL + endpoint
 
 	var requestBody []byte
 	var err error
@@ -322,7 +662,7 @@ func (y *YooKassaPaymentProvider) sendAPIRequest(method, endpoint string, body i
 		}
 	}
 
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequest(method, requestURL, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, fmt.Errorf("ошибка создания запроса: %v", err)
 	}
@@ -363,33 +703,154 @@ func (y *YooKassaPaymentProvider) generateIdempotencyKey(userID int64, amount fl
 	return hex.EncodeToString(hash[:16])
 }
 
-// createReceipt создает чек для платежа
-func (y *YooKassaPaymentProvider) createReceipt(userID int64, amount float64, description string) *Receipt {
+// generateAutoTopupIdempotencyKey генерирует идемпотентный ключ автоплатежа по номеру списания
+func generateAutoTopupIdempotencyKey(userID int64, amount float64, attempt int64) string {
+	source := fmt.Sprintf("auto_topup_%d_%.2f_%d", userID, amount, attempt)
+
+	hash := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(hash[:16])
+}
+
+// generateRefundIdempotencyKey генерирует идемпотентный ключ для возврата.
+// Ключ зависит только от платежа, суммы и номера возврата: повтор запроса не создает второй возврат.
+func generateRefundIdempotencyKey(paymentID string, amount float64, sequence int) string {
+	source := fmt.Sprintf("refund_%s_%.2f_%d", paymentID, amount, sequence)
+
+	hash := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(hash[:16])
+}
+
+// BuildReceipt создает чек для платежа с контактом пользователя и настройками позиции для типа покупки
+func BuildReceipt(userID int64, amount float64, description, plan string) *Receipt {
 	// Если отправка чеков отключена, возвращаем nil
 	if !common.YUKASSA_RECEIPT_ENABLED {
 		return nil
 	}
 
+	return buildReceiptWithItem(userID, amount, paymentCommon.GetReceiptItemSettings(plan, description))
+}
+
+// buildReceiptWithItem создает чек с одной позицией и контактом пользователя
+func buildReceiptWithItem(userID int64, amount float64, item paymentCommon.ReceiptItemSettings) *Receipt {
+	customer := Customer{
+		Email: fmt.Sprintf("user_%d@vpnbot.local", userID), // Временный email, если пользователь не указал контакт
+	}
+	contact, err := paymentCommon.GetReceiptContact(userID)
+	if err != nil {
+		paymentCommon.LogPaymentEvent("ERROR", paymentCommon.PaymentMethodAPI,
+			"Ошибка получения контакта для чека пользователя %d: %v", userID, err)
+	} else if !contact.IsEmpty() {
+		customer = Customer{Email: contact.Email, Phone: contact.Phone}
+	}
+
 	return &Receipt{
-		Customer: Customer{
-			Email: fmt.Sprintf("user_%d@vpnbot.local", userID), // Временный email для чека
-		},
+		Customer: customer,
 		Items: []Item{
 			{
-				Description: paymentCommon.SanitizeDescription(description),
+				Description: paymentCommon.SanitizeDescription(item.Description),
 				Amount: Amount{
 					Value:    fmt.Sprintf("%.2f", amount),
 					Currency: "RUB",
 				},
-				VATCode:        common.YUKASSA_VAT_CODE,        // НДС из конфигурации
-				PaymentSubject: common.YUKASSA_PAYMENT_SUBJECT, // Предмет расчета из конфигурации
-				PaymentMode:    common.YUKASSA_PAYMENT_MODE,    // Способ расчета из конфигурации
+				VATCode:        item.VATCode,
+				PaymentSubject: item.PaymentSubject,
+				PaymentMode:    item.PaymentMode,
 				Quantity:       "1",
 			},
 		},
 	}
 }
 
+// SaveReceiptRecord сохраняет чек, отправленный вместе с платежом
+func SaveReceiptRecord(paymentID string, userID int64, method paymentCommon.PaymentMethod, amount float64, receipt *Receipt) {
+	record := &paymentCommon.PaymentReceipt{
+		PaymentID: paymentID,
+		UserID:    userID,
+		Method:    method,
+		Amount:    amount,
+		Status:    paymentCommon.ReceiptStatusNotSent,
+	}
+
+	if receipt != nil && len(receipt.Items) > 0 {
+		record.Email = receipt.Customer.Email
+		record.Phone = receipt.Customer.Phone
+		record.Description = receipt.Items[0].Description
+		record.VATCode = receipt.Items[0].VATCode
+		record.Status = paymentCommon.ReceiptStatusPending
+	}
+
+	if err := paymentCommon.SavePaymentReceipt(record); err != nil {
+		paymentCommon.LogPaymentEvent("ERROR", method, "Ошибка сохранения чека платежа %s: %v", paymentID, err)
+	}
+}
+
+// GetPaymentReceipt получает чек прихода по платежу ЮКассы (nil, если чек еще не создан)
+func (y *YooKassaPaymentProvider) GetPaymentReceipt(paymentID string) (*YooKassaReceiptResponse, error) {
+	params := url.Values{}
+	params.Set("payment_id", paymentID)
+
+	response, err := y.sendAPIRequest("GET", "/receipts?"+params.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var list YooKassaReceiptList
+	if err := json.Unmarshal(response, &list); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга списка чеков ЮКассы: %v", err)
+	}
+
+	for i := range list.Items {
+		if list.Items[i].Type == "payment" {
+			return &list.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// CreatePaymentReceipt повторно регистрирует чек прихода по платежу ЮКассы
+func (y *YooKassaPaymentProvider) CreatePaymentReceipt(paymentID string, userID int64, amount float64, item paymentCommon.ReceiptItemSettings) (*YooKassaReceiptResponse, error) {
+	if !common.YUKASSA_RECEIPT_ENABLED {
+		return nil, fmt.Errorf("отправка чеков отключена")
+	}
+	receipt := buildReceiptWithItem(userID, amount, item)
+
+	request := YooKassaReceiptRequest{
+		Type:      "payment",
+		PaymentID: paymentID,
+		Customer:  receipt.Customer,
+		Items:     receipt.Items,
+		Settlements: []Settlement{
+			{
+				Type: "cashless",
+				Amount: Amount{
+					Value:    fmt.Sprintf("%.2f", amount),
+					Currency: "RUB",
+				},
+			},
+		},
+		Send: true,
+	}
+
+	source := fmt.Sprintf("receipt_%s_%d", paymentID, time.Now().UnixNano())
+	hash := sha256.Sum256([]byte(source))
+
+	response, err := y.sendAPIRequest("POST", "/receipts", request, hex.EncodeToString(hash[:16]))
+	if err != nil {
+		return nil, err
+	}
+
+	var receiptResponse YooKassaReceiptResponse
+	if err := json.Unmarshal(response, &receiptResponse); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга ответа ЮКассы: %v", err)
+	}
+
+	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodAPI,
+		"Чек по платежу %s создан повторно: ID=%s, Status=%s", paymentID, receiptResponse.ID, receiptResponse.Status)
+
+	return &receiptResponse, nil
+}
+
 // convertYooKassaStatus конвертирует статус ЮКассы в наш формат
 func (y *YooKassaPaymentProvider) convertYooKassaStatus(status string) paymentCommon.PaymentStatus {
 	switch status {
@@ -1,12 +1,14 @@
 package telegramPayment
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"bot/common"
 	paymentCommon "bot/payments/common"
+	"bot/payments/sitePayment"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -111,6 +113,16 @@ func (t *TelegramPaymentProvider) SendInvoice(chatID int64, paymentInfo *payment
 		SuggestedTipAmounts:       []int{},
 	}
 
+	// Чек передаем провайдеру, только если пользователь указал email или телефон
+	receipt := t.buildProviderReceipt(paymentInfo)
+	if receipt != nil {
+		providerData, err := json.Marshal(map[string]interface{}{"receipt": receipt})
+		if err != nil {
+			return fmt.Errorf("ошибка сериализации данных чека: %v", err)
+		}
+		invoice.ProviderData = string(providerData)
+	}
+
 	// Отправляем инвойс
 	msg, err := t.bot.Send(invoice)
 	if err != nil {
@@ -119,12 +131,29 @@ func (t *TelegramPaymentProvider) SendInvoice(chatID int64, paymentInfo *payment
 		return fmt.Errorf("ошибка отправки инвойса: %v", err)
 	}
 
+	sitePayment.SaveReceiptRecord(paymentInfo.ID, paymentInfo.UserID, paymentCommon.PaymentMethodTelegram, paymentInfo.Amount, receipt)
+
 	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodTelegram,
 		"Инвойс успешно отправлен для платежа %s, MessageID=%d", paymentInfo.ID, msg.MessageID)
 
 	return nil
 }
 
+// buildProviderReceipt создает чек для передачи ЮКассе через provider_data
+func (t *TelegramPaymentProvider) buildProviderReceipt(paymentInfo *paymentCommon.PaymentInfo) *sitePayment.Receipt {
+	contact, err := paymentCommon.GetReceiptContact(paymentInfo.UserID)
+	if err != nil {
+		paymentCommon.LogPaymentEvent("ERROR", paymentCommon.PaymentMethodTelegram,
+			"Ошибка получения контакта для чека пользователя %d: %v", paymentInfo.UserID, err)
+		return nil
+	}
+	if contact.IsEmpty() {
+		return nil
+	}
+
+	return sitePayment.BuildReceipt(paymentInfo.UserID, paymentInfo.Amount, paymentInfo.Description, paymentCommon.ReceiptPlanTopup)
+}
+
 // GetPayment получает информацию о платеже (заглушка для Telegram API)
 func (t *TelegramPaymentProvider) GetPayment(paymentID string) (*paymentCommon.PaymentInfo, error) {
 	// Telegram Bot API не предоставляет метод для получения информации о платеже по ID
@@ -139,6 +168,44 @@ func (t *TelegramPaymentProvider) ProcessWebhook(data []byte) (*paymentCommon.Pa
 	return nil, fmt.Errorf("webhook обработка не используется для Telegram Bot API")
 }
 
+// Refund выполняет возврат платежа, оплаченного через Telegram.
+// Telegram Bot API не умеет возвращать платежи провайдеров, поэтому возврат
+// выполняется через API ЮКассы по provider_payment_charge_id.
+func (t *TelegramPaymentProvider) Refund(paymentID string, amount float64, reason string, sequence int) (*paymentCommon.RefundInfo, error) {
+	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodTelegram,
+		"Возврат платежа %s на сумму %.2f (причина: %s)", paymentID, amount, reason)
+
+	if common.YUKASSA_SHOP_ID == "" || common.YUKASSA_SECRET_KEY == "" {
+		return nil, fmt.Errorf("для возврата Telegram-платежей необходимо указать YUKASSA_SHOP_ID и YUKASSA_SECRET_KEY")
+	}
+
+	credits, err := paymentCommon.GetPaymentCredits(paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var chargeID string
+	for _, credit := range credits {
+		if credit.ExternalID != "" {
+			chargeID = credit.ExternalID
+			break
+		}
+	}
+
+	if chargeID == "" {
+		return nil, fmt.Errorf("не найден provider_payment_charge_id для платежа %s", paymentID)
+	}
+
+	refund, err := sitePayment.NewYooKassaPaymentProvider().Refund(chargeID, amount, reason, sequence)
+	if err != nil {
+		return nil, err
+	}
+
+	// Возвращаем наш ID платежа, а не ID списания у провайдера
+	refund.PaymentID = paymentID
+	return refund, nil
+}
+
 // ProcessSuccessfulPayment обрабатывает успешный платеж от Telegram
 func (t *TelegramPaymentProvider) ProcessSuccessfulPayment(payment *tgbotapi.SuccessfulPayment, userID int64) (*paymentCommon.PaymentInfo, error) {
 	paymentCommon.LogPaymentEvent("INFO", paymentCommon.PaymentMethodTelegram,
@@ -157,7 +224,8 @@ func (t *TelegramPaymentProvider) ProcessSuccessfulPayment(payment *tgbotapi.Suc
 	amountStr := parts[2]
 	var paymentID string
 	if len(parts) >= 4 {
-		paymentID = parts[3]
+		// ID платежа сам содержит "_" (payment_xxx), поэтому собираем остаток целиком
+		paymentID = strings.Join(parts[3:], "_")
 	} else {
 		paymentID = paymentCommon.GeneratePaymentID()
 	}
@@ -205,7 +273,7 @@ func (t *TelegramPaymentProvider) ProcessSuccessfulPayment(payment *tgbotapi.Suc
 		"Платеж успешно обработан: ID=%s, UserID=%d, Amount=%.2f", paymentID, userID, amount)
 
 	// Пополняем баланс пользователя
-	err = common.AddBalance(userID, amount)
+	_, err = paymentCommon.CreditPayment(paymentInfo, "telegram")
 	if err != nil {
 		paymentCommon.LogPaymentEvent("ERROR", paymentCommon.PaymentMethodTelegram,
 			"Ошибка пополнения баланса для пользователя %d: %v", userID, err)
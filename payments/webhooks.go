@@ -291,8 +291,9 @@ func (wh *WebhookHandlers) HandleCheckPayment(paymentID string, chatID int64, me
 				log.Printf("WEBHOOK_CHECK: Ошибка получения пользователя %d: %v", userID, err)
 				text = fmt.Sprintf("❌ <b>Ошибка обработки платежа</b>\n\n🆔 ID: %s\n\nОшибка получения данных пользователя.", paymentID)
 			} else {
-				// Зачисляем средства
-				err = common.AddBalance(userID, paymentInfo.Amount)
+				// Зачисляем средства (если платеж уже зачислен, повторно не начисляем)
+				paymentInfo.UserID = userID
+				_, err = paymentCommon.CreditPayment(paymentInfo, "check_payment")
 				if err != nil {
 					log.Printf("WEBHOOK_CHECK: Ошибка зачисления средств для платежа %s: %v", paymentID, err)
 					text = fmt.Sprintf("❌ <b>Ошибка зачисления средств</b>\n\n🆔 ID: %s\n\nОшибка зачисления на баланс.", paymentID)
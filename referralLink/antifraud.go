@@ -0,0 +1,489 @@
+package referralLink
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"bot/common"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Веса признаков накрутки при оценке реферала
+const (
+	fraudScoreNewAccount = 25 // Недавно созданный аккаунт Telegram (по диапазону ID)
+	fraudScoreNoUsername = 15 // Нет username
+	fraudScoreBurst      = 35 // Всплеск регистраций по одной ссылке
+	fraudScoreSharedIP   = 50 // Общие IP с пригласившим в логе 3x-ui
+)
+
+// holdColumns колонки таблицы referral_holds для выборки
+const holdColumns = `id, referrer_telegram_id, referred_telegram_id, referral_code, referrer_amount,
+	welcome_amount, welcome_paid, status, score, signals, created_at`
+
+// createHoldTables создает таблицу удержанных реферальных бонусов
+func createHoldTables(db *sql.DB) error {
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS referral_holds (
+		id SERIAL PRIMARY KEY,
+		referrer_telegram_id BIGINT NOT NULL,
+		referred_telegram_id BIGINT NOT NULL UNIQUE,
+		referral_code VARCHAR(50),
+		referrer_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+		welcome_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+		welcome_paid BOOLEAN NOT NULL DEFAULT false,
+		status VARCHAR(20) NOT NULL DEFAULT 'held',
+		score INTEGER NOT NULL DEFAULT 0,
+		signals TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		resolved_at TIMESTAMP WITH TIME ZONE,
+		resolved_by BIGINT
+	);`
+
+	indexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_referral_holds_status ON referral_holds(status);
+	CREATE INDEX IF NOT EXISTS idx_referral_holds_referrer ON referral_holds(referrer_telegram_id);`
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы referral_holds: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов referral_holds: %v", err)
+	}
+
+	return nil
+}
+
+// scoreReferral оценивает подозрительность реферала и возвращает сработавшие признаки
+func (rs *ReferralService) scoreReferral(referrerID, referredID int64) (int, []string) {
+	var score int
+	var signals []string
+
+	if common.REFERRAL_NEW_ACCOUNT_MIN_ID > 0 && referredID >= common.REFERRAL_NEW_ACCOUNT_MIN_ID {
+		score += fraudScoreNewAccount
+		signals = append(signals, "недавно созданный аккаунт Telegram")
+	}
+
+	referred, err := common.GetUserByTelegramID(referredID)
+	if err != nil {
+		log.Printf("REFERRAL_FRAUD: Ошибка получения приглашенного %d: %v", referredID, err)
+	} else if referred.Username == "" {
+		score += fraudScoreNoUsername
+		signals = append(signals, "нет username")
+	}
+
+	if common.REFERRAL_BURST_WINDOW_MINUTES > 0 && common.REFERRAL_BURST_MAX_SIGNUPS > 0 {
+		var recent int
+		err := rs.db.QueryRow(`
+			SELECT COUNT(*) FROM referral_transitions
+			WHERE referrer_telegram_id = $1 AND transition_date > NOW() - make_interval(mins => $2)`,
+			referrerID, common.REFERRAL_BURST_WINDOW_MINUTES).Scan(&recent)
+		if err != nil {
+			log.Printf("REFERRAL_FRAUD: Ошибка подсчета регистраций по ссылке %d: %v", referrerID, err)
+		} else if recent > common.REFERRAL_BURST_MAX_SIGNUPS {
+			score += fraudScoreBurst
+			signals = append(signals, fmt.Sprintf("%d регистраций по ссылке за %d мин.", recent, common.REFERRAL_BURST_WINDOW_MINUTES))
+		}
+	}
+
+	if shared := rs.sharedIPs(referrerID, referredID); len(shared) > 0 {
+		score += fraudScoreSharedIP
+		signals = append(signals, "общие IP с пригласившим: "+strings.Join(shared, ", "))
+	}
+
+	return score, signals
+}
+
+// sharedIPs возвращает IP-адреса, с которых в логе 3x-ui подключались и пригласивший, и приглашенный
+func (rs *ReferralService) sharedIPs(referrerID, referredID int64) []string {
+	referrer, err := common.GetUserByTelegramID(referrerID)
+	if err != nil || referrer.Email == "" {
+		return nil
+	}
+	referred, err := common.GetUserByTelegramID(referredID)
+	if err != nil || referred.Email == "" {
+		return nil
+	}
+
+	// Разбор лога кэшируется: оценка выполняется при каждой регистрации по ссылке
+	stats, err := common.GetCachedIPStats()
+	if err != nil {
+		log.Printf("REFERRAL_FRAUD: Ошибка анализа лога подключений: %v", err)
+		return nil
+	}
+
+	referrerStats, referredStats := stats[referrer.Email], stats[referred.Email]
+	if referrerStats == nil || referredStats == nil {
+		return nil
+	}
+
+	var shared []string
+	for ip := range referredStats.IPs {
+		if _, ok := referrerStats.IPs[ip]; ok {
+			shared = append(shared, ip)
+		}
+	}
+	sort.Strings(shared)
+
+	return shared
+}
+
+// holdReferralBonuses оценивает реферала и удерживает бонус пригласившему до подтверждения.
+// Подозрительные рефералы (вместе с приветственным бонусом) уходят на проверку администратору.
+func (rs *ReferralService) holdReferralBonuses(referrerID, referredID int64, referralCode string) error {
+	hold := &ReferralHold{
+		ReferrerID:    referrerID,
+		ReferredID:    referredID,
+		ReferralCode:  referralCode,
+		WelcomeAmount: common.REFERRAL_WELCOME_BONUS,
+		Status:        ReferralHoldHeld,
+	}
+	if !commissionEnabled() {
+		hold.ReferrerAmount = common.REFERRAL_BONUS_AMOUNT
+	}
+
+	score, signals := rs.scoreReferral(referrerID, referredID)
+	hold.Score = score
+	hold.Signals = strings.Join(signals, "; ")
+
+	// Приветственный бонус и удержание фиксируются вместе: иначе сбой между ними выплатит бонус повторно
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	welcomeToBalance := false
+	if score >= common.REFERRAL_FRAUD_SCORE_THRESHOLD {
+		hold.Status = ReferralHoldReview
+		log.Printf("REFERRAL_FRAUD: ⚠️ Реферал %d -> %d отправлен на проверку (оценка %d: %s)",
+			referrerID, referredID, score, hold.Signals)
+	} else if hold.WelcomeAmount > 0 {
+		// Приветственный бонус нужен другу, чтобы начать пользоваться сервисом - выплачиваем сразу
+		welcomeToBalance, err = awardBonusTx(tx, referredID, "referred", hold.WelcomeAmount, referralCode, referrerID, "Приветственный бонус за регистрацию по реферальной ссылке")
+		if err != nil {
+			return err
+		}
+		hold.WelcomePaid = true
+	}
+
+	// В режиме комиссии удержание хранится всегда: пока оно не завершено, комиссия с платежей друга не выплачивается
+	if hold.Status == ReferralHoldHeld && hold.ReferrerAmount <= 0 && !commissionEnabled() {
+		log.Printf("REFERRAL_FRAUD: Реферал %d -> %d: удерживать нечего", referrerID, referredID)
+	} else {
+		err = tx.QueryRow(`
+			INSERT INTO referral_holds (referrer_telegram_id, referred_telegram_id, referral_code, referrer_amount,
+				welcome_amount, welcome_paid, status, score, signals)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id, created_at`,
+			hold.ReferrerID, hold.ReferredID, hold.ReferralCode, hold.ReferrerAmount,
+			hold.WelcomeAmount, hold.WelcomePaid, hold.Status, hold.Score, hold.Signals).Scan(&hold.ID, &hold.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения удержанного бонуса: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка фиксации удержания бонуса: %v", err)
+	}
+
+	if welcomeToBalance {
+		common.AfterBalanceTopup(referredID, hold.WelcomeAmount)
+	}
+	if hold.ID == 0 {
+		return nil
+	}
+
+	log.Printf("REFERRAL_FRAUD: Бонус по рефералу %d -> %d удержан (ID=%d, статус %s, оценка %d)",
+		referrerID, referredID, hold.ID, hold.Status, hold.Score)
+
+	if hold.Status == ReferralHoldReview {
+		rs.sendReviewNotification(hold)
+	}
+
+	return nil
+}
+
+// GetHoldByReferred возвращает удержанный бонус по приглашенному пользователю или nil
+func (rs *ReferralService) GetHoldByReferred(referredID int64) (*ReferralHold, error) {
+	query := fmt.Sprintf("SELECT %s FROM referral_holds WHERE referred_telegram_id = $1", holdColumns)
+	hold, err := scanReferralHold(rs.db.QueryRow(query, referredID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения удержанного бонуса: %v", err)
+	}
+	return hold, nil
+}
+
+// GetReviewQueue возвращает рефералы, ожидающие проверки администратором
+func (rs *ReferralService) GetReviewQueue(limit int) ([]*ReferralHold, error) {
+	query := fmt.Sprintf("SELECT %s FROM referral_holds WHERE status = $1 ORDER BY created_at LIMIT $2", holdColumns)
+	return rs.queryHolds(query, ReferralHoldReview, limit)
+}
+
+// ProcessDueHolds выплачивает бонусы по рефералам, остающимся активными REFERRAL_HOLD_ACTIVE_DAYS дней
+func (rs *ReferralService) ProcessDueHolds() {
+	if common.REFERRAL_HOLD_ACTIVE_DAYS <= 0 {
+		return
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM referral_holds h
+		WHERE h.status = $1 AND h.created_at <= NOW() - make_interval(days => $2)
+		  AND EXISTS(SELECT 1 FROM users u WHERE u.telegram_id = h.referred_telegram_id AND u.has_active_config = true)
+		ORDER BY h.created_at`, holdColumns)
+
+	holds, err := rs.queryHolds(query, ReferralHoldHeld, common.REFERRAL_HOLD_ACTIVE_DAYS)
+	if err != nil {
+		log.Printf("REFERRAL_FRAUD: Ошибка получения удержанных бонусов: %v", err)
+		return
+	}
+
+	for _, hold := range holds {
+		rs.confirmHold(hold, fmt.Sprintf("друг активен %d дн.", common.REFERRAL_HOLD_ACTIVE_DAYS))
+	}
+}
+
+// releaseHoldOnPayment выплачивает удержанный бонус после первого зачисленного платежа друга
+func (rs *ReferralService) releaseHoldOnPayment(paymentInfo *paymentCommon.PaymentInfo) {
+	hold, err := rs.GetHoldByReferred(paymentInfo.UserID)
+	if err != nil {
+		log.Printf("REFERRAL_FRAUD: Ошибка получения удержанного бонуса для пользователя %d: %v", paymentInfo.UserID, err)
+		return
+	}
+	if hold == nil || hold.Status != ReferralHoldHeld {
+		return
+	}
+
+	rs.confirmHold(hold, fmt.Sprintf("оплата %.2f₽", paymentInfo.Amount))
+}
+
+// confirmHold повторно оценивает реферал (к этому времени могли появиться общие IP) и выплачивает бонус
+// либо отправляет реферал на проверку администратору
+func (rs *ReferralService) confirmHold(hold *ReferralHold, reason string) {
+	score, signals := rs.scoreReferral(hold.ReferrerID, hold.ReferredID)
+	if score >= common.REFERRAL_FRAUD_SCORE_THRESHOLD {
+		_, err := rs.db.Exec(`UPDATE referral_holds SET status = $1, score = $2, signals = $3 WHERE id = $4 AND status = $5`,
+			ReferralHoldReview, score, strings.Join(signals, "; "), hold.ID, ReferralHoldHeld)
+		if err != nil {
+			log.Printf("REFERRAL_FRAUD: Ошибка отправки реферала %d на проверку: %v", hold.ID, err)
+			return
+		}
+
+		hold.Status, hold.Score, hold.Signals = ReferralHoldReview, score, strings.Join(signals, "; ")
+		log.Printf("REFERRAL_FRAUD: ⚠️ Реферал %d отправлен на проверку при подтверждении (%s, оценка %d)", hold.ID, reason, score)
+		rs.sendReviewNotification(hold)
+		return
+	}
+
+	if err := rs.ResolveHold(hold.ID, ReferralHoldReleased, 0); err != nil {
+		log.Printf("REFERRAL_FRAUD: ❌ Ошибка выплаты удержанного бонуса %d: %v", hold.ID, err)
+		return
+	}
+
+	log.Printf("REFERRAL_FRAUD: ✅ Удержанный бонус %d выплачен (%s)", hold.ID, reason)
+}
+
+// ResolveHold завершает удержание: released/approved - выплачивает бонусы и удержанные комиссии,
+// rejected - отменяет их. resolvedBy - ID администратора (0 для автоматической выплаты).
+func (rs *ReferralService) ResolveHold(holdID int, status string, resolvedBy int64) error {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Переводим удержание в итоговый статус атомарно, чтобы бонус не был выплачен дважды
+	query := fmt.Sprintf(`
+		UPDATE referral_holds SET status = $1, resolved_at = NOW(), resolved_by = NULLIF($2::BIGINT, 0)
+		WHERE id = $3 AND status IN ($4, $5)
+		RETURNING %s`, holdColumns)
+
+	hold, err := scanReferralHold(tx.QueryRow(query, status, resolvedBy, holdID, ReferralHoldHeld, ReferralHoldReview))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("удержание %d не найдено или уже обработано", holdID)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка обновления удержания: %v", err)
+	}
+
+	if status == ReferralHoldRejected {
+		if err := cancelHeldCommissionsTx(tx, hold.ReferredID); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("ошибка фиксации отклонения реферала: %v", err)
+		}
+		log.Printf("REFERRAL_FRAUD: Реферал %d -> %d отклонен администратором %d", hold.ReferrerID, hold.ReferredID, resolvedBy)
+		return nil
+	}
+
+	welcomePaid, welcomeToBalance := false, false
+	if !hold.WelcomePaid && hold.WelcomeAmount > 0 {
+		welcomeToBalance, err = awardBonusTx(tx, hold.ReferredID, "referred", hold.WelcomeAmount, hold.ReferralCode, hold.ReferrerID, "Приветственный бонус за регистрацию по реферальной ссылке")
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE referral_holds SET welcome_paid = true WHERE id = $1", hold.ID); err != nil {
+			return fmt.Errorf("ошибка отметки выплаты приветственного бонуса: %v", err)
+		}
+		welcomePaid = true
+	}
+
+	referrerToBalance := false
+	if hold.ReferrerAmount > 0 {
+		referrerToBalance, err = awardBonusTx(tx, hold.ReferrerID, "referrer", hold.ReferrerAmount, hold.ReferralCode, hold.ReferredID, "Реферальный бонус за приглашение друга")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE referral_transitions SET bonus_paid = true, bonus_amount = $1
+		WHERE referrer_telegram_id = $2 AND referred_telegram_id = $3`, hold.ReferrerAmount, hold.ReferrerID, hold.ReferredID)
+	if err != nil {
+		return fmt.Errorf("ошибка отметки выплаты в referral_transitions: %v", err)
+	}
+
+	commissions, err := releaseHeldCommissionsTx(tx, hold.ReferredID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка фиксации выплаты удержанного бонуса: %v", err)
+	}
+
+	if welcomePaid {
+		if welcomeToBalance {
+			common.AfterBalanceTopup(hold.ReferredID, hold.WelcomeAmount)
+		}
+		rs.notifyUser(hold.ReferredID, fmt.Sprintf("🎁 На ваш баланс начислен приветственный бонус: <b>%.0f₽</b>", hold.WelcomeAmount))
+	}
+
+	if hold.ReferrerAmount > 0 {
+		if referrerToBalance {
+			common.AfterBalanceTopup(hold.ReferrerID, hold.ReferrerAmount)
+		}
+		rs.notifyUser(hold.ReferrerID, fmt.Sprintf("🎉 Приглашение подтверждено!\n💰 Вам начислен реферальный бонус: <b>%.0f₽</b>", hold.ReferrerAmount))
+	}
+
+	for _, commission := range commissions {
+		if !walletEnabled() {
+			common.ForceBalanceRecalculation(commission.UserID)
+		}
+		log.Printf("REFERRAL_FRAUD: Удержанная комиссия уровня %d %.2f выплачена пользователю %d (реферал %d)",
+			commission.Level, commission.Amount, commission.UserID, hold.ReferredID)
+		rs.notifyUser(commission.UserID, fmt.Sprintf("💸 Приглашение подтверждено!\n💰 Вам начислена удержанная реферальная комиссия: <b>%.2f₽</b>", commission.Amount))
+	}
+
+	return nil
+}
+
+// sendReviewNotification отправляет администратору реферал на проверку с кнопками решения
+func (rs *ReferralService) sendReviewNotification(hold *ReferralHold) {
+	if common.GlobalBot == nil {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(common.ADMIN_ID, "⚠️ <b>Подозрительный реферал</b>\n\n"+describeHold(hold))
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = holdReviewKeyboard(hold)
+
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		log.Printf("REFERRAL_FRAUD: Ошибка отправки реферала %d на проверку: %v", hold.ID, err)
+	}
+}
+
+// notifyUser отправляет пользователю уведомление о реферальном бонусе
+func (rs *ReferralService) notifyUser(telegramID int64, text string) {
+	if common.GlobalBot == nil {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(telegramID, text)
+	msg.ParseMode = "HTML"
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		log.Printf("REFERRAL_FRAUD: Ошибка отправки уведомления пользователю %d: %v", telegramID, err)
+	}
+}
+
+// queryHolds выполняет выборку удержанных бонусов
+func (rs *ReferralService) queryHolds(query string, args ...interface{}) ([]*ReferralHold, error) {
+	rows, err := rs.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения удержанных бонусов: %v", err)
+	}
+	defer rows.Close()
+
+	var holds []*ReferralHold
+	for rows.Next() {
+		hold, err := scanReferralHold(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения удержанного бонуса: %v", err)
+		}
+		holds = append(holds, hold)
+	}
+
+	return holds, rows.Err()
+}
+
+// holdScanner общий интерфейс для sql.Row и sql.Rows
+type holdScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanReferralHold читает удержанный бонус из строки результата запроса
+func scanReferralHold(row holdScanner) (*ReferralHold, error) {
+	var hold ReferralHold
+	var referralCode sql.NullString
+	err := row.Scan(&hold.ID, &hold.ReferrerID, &hold.ReferredID, &referralCode, &hold.ReferrerAmount,
+		&hold.WelcomeAmount, &hold.WelcomePaid, &hold.Status, &hold.Score, &hold.Signals, &hold.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	hold.ReferralCode = referralCode.String
+	return &hold, nil
+}
+
+// describeHold формирует описание удержанного реферала для администратора
+func describeHold(hold *ReferralHold) string {
+	text := fmt.Sprintf("🆔 <b>Заявка:</b> #%d\n", hold.ID)
+	text += fmt.Sprintf("👤 <b>Пригласивший:</b> %d\n", hold.ReferrerID)
+	text += fmt.Sprintf("👤 <b>Приглашенный:</b> %d\n", hold.ReferredID)
+	text += fmt.Sprintf("📅 <b>Дата:</b> %s\n", hold.CreatedAt.Format("02.01.2006 15:04"))
+	text += fmt.Sprintf("💰 <b>Бонусы:</b> пригласившему %.0f₽, другу %.0f₽", hold.ReferrerAmount, hold.WelcomeAmount)
+	if hold.WelcomePaid {
+		text += " (выплачен)"
+	}
+	text += fmt.Sprintf("\n🚩 <b>Оценка:</b> %d (порог %d)\n", hold.Score, common.REFERRAL_FRAUD_SCORE_THRESHOLD)
+	if hold.Signals != "" {
+		text += "• " + strings.ReplaceAll(hold.Signals, "; ", "\n• ") + "\n"
+	}
+	return text
+}
+
+// holdReviewKeyboard создает клавиатуру решения по удержанному рефералу
+func holdReviewKeyboard(hold *ReferralHold) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Одобрить", fmt.Sprintf("ref_approve:%d", hold.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отклонить", fmt.Sprintf("ref_reject:%d", hold.ID)),
+		),
+	)
+}
+
+// holdReleaseText описывает пользователю, когда будет выплачен удержанный бонус
+func holdReleaseText() string {
+	if common.REFERRAL_HOLD_ACTIVE_DAYS > 0 {
+		return fmt.Sprintf("после первой оплаты друга или через %d дн. его активности", common.REFERRAL_HOLD_ACTIVE_DAYS)
+	}
+	return "после первой оплаты друга"
+}
@@ -0,0 +1,351 @@
+package referralLink
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"bot/common"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// BonusTypeCommission тип бонуса - комиссия с пополнения приглашенного
+const BonusTypeCommission = "commission"
+
+// BonusTypeCommissionRejected тип удержанной комиссии, отмененной вместе с рефералом
+const BonusTypeCommissionRejected = "commission_rejected"
+
+// Результат записи комиссии
+const (
+	commissionAwarded   = "awarded"   // Комиссия зачислена
+	commissionHeld      = "held"      // Комиссия удержана до подтверждения реферала
+	commissionDuplicate = "duplicate" // Комиссия по платежу уже записана
+	commissionRejected  = "rejected"  // Реферал отклонен, комиссия не начисляется
+)
+
+// heldCommission удержанная комиссия, выплаченная после подтверждения реферала
+type heldCommission struct {
+	UserID int64
+	Level  int
+	Amount float64
+}
+
+// createCommissionSchema добавляет в историю бонусов привязку к платежу
+func createCommissionSchema(db *sql.DB) error {
+	alterSQL := `
+	ALTER TABLE referral_bonuses ADD COLUMN IF NOT EXISTS payment_id VARCHAR(255);
+	ALTER TABLE referral_bonuses ADD COLUMN IF NOT EXISTS level INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE referral_bonuses ADD COLUMN IF NOT EXISTS held BOOLEAN NOT NULL DEFAULT false;`
+
+	// Комиссия по одному платежу начисляется каждому получателю не более одного раза
+	indexSQL := `
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_referral_bonuses_payment_user
+		ON referral_bonuses(payment_id, user_telegram_id) WHERE payment_id IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_referral_bonuses_related_user ON referral_bonuses(related_user_id);`
+
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("ошибка обновления таблицы referral_bonuses: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов referral_bonuses: %v", err)
+	}
+
+	return nil
+}
+
+// commissionEnabled проверяет, работает ли реферальная программа в режиме комиссии
+func commissionEnabled() bool {
+	return common.REFERRAL_COMMISSION_ENABLED && len(levelPercents()) > 0
+}
+
+// referrerRewardText описывает вознаграждение пригласившего в зависимости от режима программы
+func referrerRewardText() string {
+	if !commissionEnabled() {
+		return fmt.Sprintf("%.0f₽", common.REFERRAL_BONUS_AMOUNT)
+	}
+
+	percents := levelPercents()
+	text := fmt.Sprintf("%.0f%% с каждого пополнения друга", percents[0])
+	if len(percents) > 1 {
+		var upline []string
+		for _, percent := range percents[1:] {
+			upline = append(upline, fmt.Sprintf("%.0f%%", percent))
+		}
+		text += fmt.Sprintf(", %s со 2-%d уровня", strings.Join(upline, " / "), len(percents))
+	}
+	if common.REFERRAL_COMMISSION_LIFETIME_DAYS > 0 {
+		text += fmt.Sprintf(" (%d дн.)", common.REFERRAL_COMMISSION_LIFETIME_DAYS)
+	}
+	return text
+}
+
+// awardPaymentCommission начисляет комиссию с зачисленного платежа всем пригласившим вверх по цепочке
+func (rs *ReferralService) awardPaymentCommission(paymentInfo *paymentCommon.PaymentInfo) {
+	if !common.REFERRAL_SYSTEM_ENABLED || !commissionEnabled() || paymentInfo.Amount <= 0 {
+		return
+	}
+
+	var referredAt time.Time
+	var firstName sql.NullString
+	err := rs.db.QueryRow(`
+		SELECT COALESCE(rt.transition_date, u.created_at), u.first_name
+		FROM users u
+		LEFT JOIN referral_transitions rt ON rt.referred_telegram_id = u.telegram_id
+		WHERE u.telegram_id = $1 AND u.referred_by IS NOT NULL`, paymentInfo.UserID).Scan(&referredAt, &firstName)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("REFERRAL_SERVICE: Ошибка получения пригласившего для пользователя %d: %v", paymentInfo.UserID, err)
+		}
+		return
+	}
+
+	// Срок отсчитывается от приглашения плательщика и действует для всех уровней
+	if common.REFERRAL_COMMISSION_LIFETIME_DAYS > 0 &&
+		time.Since(referredAt) > time.Duration(common.REFERRAL_COMMISSION_LIFETIME_DAYS)*24*time.Hour {
+		log.Printf("REFERRAL_SERVICE: Срок начисления комиссии за пользователя %d истек (приглашен %s)",
+			paymentInfo.UserID, referredAt.Format("02.01.2006"))
+		return
+	}
+
+	friendName := firstName.String
+	if friendName == "" {
+		friendName = fmt.Sprintf("ID %d", paymentInfo.UserID)
+	}
+
+	percents := levelPercents()
+	chain, err := rs.getReferralChain(paymentInfo.UserID, len(percents))
+	if err != nil {
+		log.Printf("REFERRAL_SERVICE: ❌ Ошибка получения цепочки приглашений пользователя %d: %v", paymentInfo.UserID, err)
+		return
+	}
+
+	for i, referrerID := range chain {
+		level := i + 1
+		percent := percents[i]
+
+		amount := math.Round(paymentInfo.Amount*percent) / 100
+		if amount <= 0 {
+			continue
+		}
+
+		description := fmt.Sprintf("Комиссия %.0f%% с пополнения %.2f₽ (друг: %s)", percent, paymentInfo.Amount, friendName)
+		if level > 1 {
+			description = fmt.Sprintf("Комиссия %.0f%% уровня %d с пополнения %.2f₽ (участник: %s)",
+				percent, level, paymentInfo.Amount, friendName)
+		}
+
+		result, err := rs.recordCommission(referrerID, paymentInfo.UserID, paymentInfo.ID, level, amount, description)
+		if err != nil {
+			log.Printf("REFERRAL_SERVICE: ❌ Ошибка начисления комиссии уровня %d по платежу %s: %v", level, paymentInfo.ID, err)
+			continue
+		}
+		switch result {
+		case commissionDuplicate:
+			log.Printf("REFERRAL_SERVICE: Комиссия уровня %d по платежу %s уже начислена ранее", level, paymentInfo.ID)
+			continue
+		case commissionRejected:
+			log.Printf("REFERRAL_SERVICE: Реферал пользователя %d отклонен, комиссия по платежу %s не начисляется", paymentInfo.UserID, paymentInfo.ID)
+			return
+		case commissionHeld:
+			log.Printf("REFERRAL_SERVICE: Комиссия уровня %d %.2f пользователю %d по платежу %s удержана до подтверждения реферала",
+				level, amount, referrerID, paymentInfo.ID)
+			continue
+		}
+
+		log.Printf("REFERRAL_SERVICE: ✅ Начислена комиссия уровня %d %.2f пользователю %d за платеж %s пользователя %d",
+			level, amount, referrerID, paymentInfo.ID, paymentInfo.UserID)
+
+		rs.sendCommissionNotification(referrerID, level, friendName, paymentInfo.Amount, amount)
+	}
+}
+
+// sendCommissionNotification уведомляет пригласившего о начисленной комиссии
+func (rs *ReferralService) sendCommissionNotification(referrerID int64, level int, friendName string, paymentAmount, amount float64) {
+	if common.GlobalBot == nil {
+		return
+	}
+
+	text := fmt.Sprintf("💸 <b>Реферальная комиссия</b>\n\n"+
+		"Ваш друг %s пополнил баланс на %.2f₽\n"+
+		"💰 Вам начислено: <b>%.2f₽</b>",
+		friendName, paymentAmount, amount)
+	if level > 1 {
+		text = fmt.Sprintf("💸 <b>Реферальная комиссия (уровень %d)</b>\n\n"+
+			"Участник вашей сети %s пополнил баланс на %.2f₽\n"+
+			"💰 Вам начислено: <b>%.2f₽</b>",
+			level, friendName, paymentAmount, amount)
+	}
+
+	msg := tgbotapi.NewMessage(referrerID, text)
+	msg.ParseMode = "HTML"
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		log.Printf("REFERRAL_SERVICE: Ошибка отправки уведомления о комиссии пользователю %d: %v", referrerID, err)
+	}
+}
+
+// recordCommission записывает комиссию в историю и зачисляет ее на баланс или в реферальный кошелек.
+// Пока реферал плательщика не подтвержден, комиссия только записывается с отметкой held.
+func (rs *ReferralService) recordCommission(userID, relatedUserID int64, paymentID string, level int, amount float64, description string) (string, error) {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Блокируем удержание, чтобы его одновременное завершение не пропустило эту комиссию
+	var holdStatus string
+	err = tx.QueryRow(`SELECT status FROM referral_holds WHERE referred_telegram_id = $1 FOR UPDATE`, relatedUserID).Scan(&holdStatus)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("ошибка получения удержания реферала: %v", err)
+	}
+	if holdStatus == ReferralHoldRejected {
+		return commissionRejected, nil
+	}
+	held := holdStatus == ReferralHoldHeld || holdStatus == ReferralHoldReview
+
+	result, err := tx.Exec(`
+		INSERT INTO referral_bonuses (user_telegram_id, bonus_type, amount, related_user_id, description, payment_id, level, held)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (payment_id, user_telegram_id) WHERE payment_id IS NOT NULL DO NOTHING`,
+		userID, BonusTypeCommission, amount, relatedUserID, description, paymentID, level, held)
+	if err != nil {
+		return "", fmt.Errorf("ошибка записи в историю бонусов: %v", err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения количества добавленных строк: %v", err)
+	}
+	if inserted == 0 {
+		return commissionDuplicate, nil
+	}
+
+	if held {
+		if err = tx.Commit(); err != nil {
+			return "", fmt.Errorf("ошибка коммита транзакции: %v", err)
+		}
+		return commissionHeld, nil
+	}
+
+	if err := creditCommissionTx(tx, userID, amount); err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("ошибка коммита транзакции: %v", err)
+	}
+
+	if !walletEnabled() {
+		common.ForceBalanceRecalculation(userID)
+	}
+
+	return commissionAwarded, nil
+}
+
+// creditCommissionTx зачисляет комиссию на баланс или в реферальный кошелек
+func creditCommissionTx(tx *sql.Tx, userID int64, amount float64) error {
+	// Комиссия - не оплата, поэтому total_paid не увеличиваем
+	column := earningsColumn()
+	_, err := tx.Exec(fmt.Sprintf(`
+		UPDATE users
+		SET %[1]s = %[1]s + $2, referral_earnings = referral_earnings + $2, updated_at = NOW()
+		WHERE telegram_id = $1`, column), userID, amount)
+	if err != nil {
+		return fmt.Errorf("ошибка пополнения баланса: %v", err)
+	}
+	return nil
+}
+
+// releaseHeldCommissionsTx зачисляет комиссии, удержанные до подтверждения реферала referredID
+func releaseHeldCommissionsTx(tx *sql.Tx, referredID int64) ([]heldCommission, error) {
+	rows, err := tx.Query(`
+		UPDATE referral_bonuses SET held = false
+		WHERE related_user_id = $1 AND bonus_type = $2 AND held = true
+		RETURNING user_telegram_id, level, amount`, referredID, BonusTypeCommission)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения удержанных комиссий: %v", err)
+	}
+
+	var released []heldCommission
+	for rows.Next() {
+		var commission heldCommission
+		if err := rows.Scan(&commission.UserID, &commission.Level, &commission.Amount); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка сканирования удержанной комиссии: %v", err)
+		}
+		released = append(released, commission)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка получения удержанных комиссий: %v", err)
+	}
+
+	for _, commission := range released {
+		if err := creditCommissionTx(tx, commission.UserID, commission.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	return released, nil
+}
+
+// cancelHeldCommissionsTx отменяет комиссии, удержанные по отклоненному рефералу referredID
+func cancelHeldCommissionsTx(tx *sql.Tx, referredID int64) error {
+	_, err := tx.Exec(`
+		UPDATE referral_bonuses SET bonus_type = $3
+		WHERE related_user_id = $1 AND bonus_type = $2 AND held = true`,
+		referredID, BonusTypeCommission, BonusTypeCommissionRejected)
+	if err != nil {
+		return fmt.Errorf("ошибка отмены удержанных комиссий: %v", err)
+	}
+	return nil
+}
+
+// GetFriendEarnings возвращает заработок пользователя в разрезе приглашенных друзей (первый уровень)
+func (rs *ReferralService) GetFriendEarnings(telegramID int64, limit int) ([]ReferralFriendEarnings, error) {
+	query := `
+		SELECT rb.related_user_id, COALESCE(u.username, ''), COALESCE(u.first_name, ''),
+		       SUM(rb.amount), COUNT(rb.payment_id)
+		FROM referral_bonuses rb
+		LEFT JOIN users u ON u.telegram_id = rb.related_user_id
+		WHERE rb.user_telegram_id = $1 AND rb.bonus_type IN ('referrer', $2) AND rb.related_user_id IS NOT NULL
+		  AND rb.level = 1 AND NOT rb.held
+		GROUP BY rb.related_user_id, u.username, u.first_name
+		ORDER BY SUM(rb.amount) DESC
+		LIMIT $3`
+
+	rows, err := rs.db.Query(query, telegramID, BonusTypeCommission, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения заработка по друзьям: %v", err)
+	}
+	defer rows.Close()
+
+	var friends []ReferralFriendEarnings
+	for rows.Next() {
+		var friend ReferralFriendEarnings
+		if err := rows.Scan(&friend.FriendID, &friend.Username, &friend.FirstName, &friend.Amount, &friend.Payments); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования заработка по друзьям: %v", err)
+		}
+		friends = append(friends, friend)
+	}
+
+	return friends, rows.Err()
+}
+
+// DisplayName возвращает имя друга для отображения
+func (f *ReferralFriendEarnings) DisplayName() string {
+	switch {
+	case f.FirstName != "":
+		return f.FirstName
+	case f.Username != "":
+		return "@" + f.Username
+	default:
+		return fmt.Sprintf("ID %d", f.FriendID)
+	}
+}
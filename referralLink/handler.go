@@ -3,6 +3,7 @@ package referralLink
 import (
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 
 	"bot/common"
@@ -53,7 +54,7 @@ func (rh *ReferralHandler) HandleRefCommand(chatID int64, user *common.User) {
 
 	// Формируем сообщение
 	text := fmt.Sprintf("🎯 <b>Реферальная система</b>\n\n")
-	text += "💰 <b>Ваш бонус за приглашение:</b> " + fmt.Sprintf("%.0f", common.REFERRAL_BONUS_AMOUNT) + "₽\n"
+	text += "💰 <b>Ваш бонус за приглашение:</b> " + referrerRewardText() + "\n"
 	text += "🎁 <b>Бонус для друга:</b> " + fmt.Sprintf("%.0f", common.REFERRAL_WELCOME_BONUS) + "₽\n\n"
 
 	text += "📊 <b>Ваша статистика:</b>\n"
@@ -68,20 +69,7 @@ func (rh *ReferralHandler) HandleRefCommand(chatID int64, user *common.User) {
 	text += "3️⃣ Вы оба получаете бонусы!\n\n"
 
 	// Создаем клавиатуру
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📊 Статистика", "ref_stats"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📋 История бонусов", "ref_history"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔗 Поделиться ссылкой", "ref_share"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "main_menu"),
-		),
-	)
+	keyboard := referralMenuKeyboard(false)
 
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
@@ -96,6 +84,16 @@ func (rh *ReferralHandler) HandleRefCommand(chatID int64, user *common.User) {
 func (rh *ReferralHandler) HandleRefCallback(chatID int64, userID int64, data string) {
 	log.Printf("REFERRAL_HANDLER: Обработка callback %s для пользователя %d", data, userID)
 
+	if strings.HasPrefix(data, "ref_approve:") || strings.HasPrefix(data, "ref_reject:") {
+		rh.handleReviewDecisionCallback(chatID, userID, data)
+		return
+	}
+
+	if strings.HasPrefix(data, "ref_payout_ok:") || strings.HasPrefix(data, "ref_payout_no:") {
+		rh.handlePayoutDecisionCallback(chatID, userID, data)
+		return
+	}
+
 	user, err := common.GetUserByTelegramID(userID)
 	if err != nil {
 		log.Printf("REFERRAL_HANDLER: Ошибка получения пользователя %d: %v", userID, err)
@@ -109,6 +107,18 @@ func (rh *ReferralHandler) HandleRefCallback(chatID int64, userID int64, data st
 	case "ref_history":
 		log.Printf("REFERRAL_HANDLER: Обработка callback ref_history")
 		rh.handleHistoryCallback(chatID, user)
+	case "ref_tree":
+		log.Printf("REFERRAL_HANDLER: Обработка callback ref_tree")
+		rh.handleTreeCallback(chatID, user)
+	case "ref_wallet":
+		log.Printf("REFERRAL_HANDLER: Обработка callback ref_wallet")
+		rh.handleWalletCallback(chatID, user)
+	case "ref_wallet_days":
+		log.Printf("REFERRAL_HANDLER: Обработка callback ref_wallet_days")
+		rh.handleWalletDaysCallback(chatID, user)
+	case "ref_payout":
+		log.Printf("REFERRAL_HANDLER: Обработка callback ref_payout")
+		rh.handlePayoutCallback(chatID)
 	case "ref_share":
 		log.Printf("REFERRAL_HANDLER: Обработка callback ref_share")
 		rh.handleShareCallback(chatID, user)
@@ -133,14 +143,12 @@ func (rh *ReferralHandler) handleStatsCallback(chatID int64, user *common.User)
 		return
 	}
 
-	text := "📊 <b>Статистика рефералов</b>\n\n"
-	text += "👥 <b>Всего приглашено:</b> " + fmt.Sprintf("%d", stats.TotalReferrals) + "\n"
-	text += "✅ <b>Успешных приглашений:</b> " + fmt.Sprintf("%d", stats.SuccessfulReferrals) + "\n"
-	text += "⏳ <b>Ожидающих:</b> " + fmt.Sprintf("%d", stats.PendingReferrals) + "\n"
+	friends, err := rh.service.GetFriendEarnings(user.TelegramID, 10)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка получения заработка по друзьям: %v", err)
+	}
 
-	text += "💰 <b>Бонусы:</b>\n"
-	text += "• За приглашение: " + fmt.Sprintf("%.0f", common.REFERRAL_BONUS_AMOUNT) + "₽\n"
-	text += "• Другу за регистрацию: " + fmt.Sprintf("%.0f", common.REFERRAL_WELCOME_BONUS) + "₽\n"
+	text := referralStatsText(stats, friends)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
@@ -165,16 +173,29 @@ func (rh *ReferralHandler) handleHistoryCallback(chatID int64, user *common.User
 		return
 	}
 
-	text := "📋 <b>История реферальных бонусов</b>\n\n"
+	text := referralHistoryText(bonuses)
 
-	if len(bonuses) == 0 {
-		text += "📭 Пока нет бонусов\n"
-		text += "Пригласите друзей, чтобы начать зарабатывать!"
-	} else {
-		for i, bonus := range bonuses {
-			text += fmt.Sprintf("%d. %s: <b>+%.2f₽</b>\n", i+1, bonus.Description, bonus.Amount)
-			text += "   📅 " + bonus.CreatedAt.Format("02.01.2006 15:04") + "\n\n"
-		}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "ref_menu"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = &keyboard
+
+	rh.bot.Send(msg)
+}
+
+// handleTreeCallback обрабатывает callback дерева рефералов
+func (rh *ReferralHandler) handleTreeCallback(chatID int64, user *common.User) {
+	levels, err := rh.service.GetReferralTree(user.TelegramID)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка получения дерева рефералов: %v", err)
+		msg := tgbotapi.NewMessage(chatID, "❌ Ошибка получения дерева рефералов")
+		rh.bot.Send(msg)
+		return
 	}
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
@@ -183,7 +204,7 @@ func (rh *ReferralHandler) handleHistoryCallback(chatID int64, user *common.User
 		),
 	)
 
-	msg := tgbotapi.NewMessage(chatID, text)
+	msg := tgbotapi.NewMessage(chatID, referralTreeText(levels))
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = &keyboard
 
@@ -240,7 +261,7 @@ func (rh *ReferralHandler) handleMenuCallback(chatID int64, user *common.User) {
 
 	// Формируем текст меню
 	text := fmt.Sprintf("🎯 <b>Реферальная система</b>\n\n")
-	text += "💰 <b>Ваш бонус за приглашение:</b> " + fmt.Sprintf("%.0f", common.REFERRAL_BONUS_AMOUNT) + "₽\n"
+	text += "💰 <b>Ваш бонус за приглашение:</b> " + referrerRewardText() + "\n"
 	text += "🎁 <b>Бонус для друга:</b> " + fmt.Sprintf("%.0f", common.REFERRAL_WELCOME_BONUS) + "₽\n\n"
 
 	text += "📊 <b>Ваша статистика:</b>\n"
@@ -255,23 +276,7 @@ func (rh *ReferralHandler) handleMenuCallback(chatID int64, user *common.User) {
 	text += "3️⃣ Вы оба получаете бонусы!\n\n"
 
 	// Создаем клавиатуру
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📊 Статистика", "ref_stats"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📋 История бонусов", "ref_history"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔗 Поделиться ссылкой", "ref_share"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔄 Обновить", "ref_refresh"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "main_menu"),
-		),
-	)
+	keyboard := referralMenuKeyboard(true)
 
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
@@ -325,10 +330,20 @@ func (rh *ReferralHandler) ProcessReferralStart(chatID int64, user *common.User,
 		return
 	}
 
+	// Удержанный до подтверждения бонус (защита от накрутки)
+	hold, err := rh.service.GetHoldByReferred(user.TelegramID)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка получения удержанного бонуса: %v", err)
+	}
+
 	// Отправляем уведомление приглашенному
 	text := fmt.Sprintf("🎉 <b>Добро пожаловать!</b>\n\n")
 	text += fmt.Sprintf("Вы зарегистрировались по реферальной ссылке от %s!\n", referrer.FirstName)
-	text += fmt.Sprintf("🎁 На ваш баланс начислен приветственный бонус: <b>%.0f₽</b>\n\n", common.REFERRAL_WELCOME_BONUS)
+	if hold != nil && hold.Status == ReferralHoldReview {
+		text += "🎁 Приветственный бонус будет начислен после проверки\n\n"
+	} else {
+		text += fmt.Sprintf("🎁 На ваш баланс начислен приветственный бонус: <b>%.0f₽</b>\n\n", common.REFERRAL_WELCOME_BONUS)
+	}
 	text += "Спасибо, что присоединились к нашему сервису!"
 
 	msg := tgbotapi.NewMessage(chatID, text)
@@ -338,7 +353,13 @@ func (rh *ReferralHandler) ProcessReferralStart(chatID int64, user *common.User,
 	// Отправляем уведомление пригласившему
 	referrerText := fmt.Sprintf("🎉 <b>Новый реферал!</b>\n\n")
 	referrerText += fmt.Sprintf("Пользователь %s зарегистрировался по вашей ссылке!\n", user.FirstName)
-	referrerText += fmt.Sprintf("💰 Вам начислен бонус: <b>%.0f₽</b>\n\n", common.REFERRAL_BONUS_AMOUNT)
+	if commissionEnabled() {
+		referrerText += fmt.Sprintf("💰 Вы будете получать: <b>%s</b>\n\n", referrerRewardText())
+	} else if hold != nil {
+		referrerText += fmt.Sprintf("💰 Бонус <b>%.0f₽</b> будет начислен %s\n\n", common.REFERRAL_BONUS_AMOUNT, holdReleaseText())
+	} else {
+		referrerText += fmt.Sprintf("💰 Вам начислен бонус: <b>%.0f₽</b>\n\n", common.REFERRAL_BONUS_AMOUNT)
+	}
 	referrerText += "Продолжайте приглашать друзей и зарабатывайте больше!"
 
 	referrerMsg := tgbotapi.NewMessage(referrer.TelegramID, referrerText)
@@ -351,7 +372,8 @@ func (rh *ReferralHandler) ProcessReferralStart(chatID int64, user *common.User,
 // IsReferralCallback проверяет, является ли callback реферальным
 func (rh *ReferralHandler) IsReferralCallback(data string) bool {
 	referralCallbacks := []string{
-		"ref_stats", "ref_history", "ref_share", "ref_menu", "ref_refresh",
+		"ref_stats", "ref_history", "ref_tree", "ref_share", "ref_menu", "ref_refresh",
+		"ref_wallet", "ref_wallet_days", "ref_payout",
 	}
 
 	for _, callback := range referralCallbacks {
@@ -360,12 +382,17 @@ func (rh *ReferralHandler) IsReferralCallback(data string) bool {
 		}
 	}
 
-	return false
+	return strings.HasPrefix(data, "ref_approve:") || strings.HasPrefix(data, "ref_reject:") ||
+		strings.HasPrefix(data, "ref_payout_ok:") || strings.HasPrefix(data, "ref_payout_no:")
 }
 
 // IsReferralCommand проверяет, является ли команда реферальной
 func (rh *ReferralHandler) IsReferralCommand(command string) bool {
-	return command == "ref"
+	switch command {
+	case "ref", "refreview", "refpayout", "refpayouts":
+		return true
+	}
+	return false
 }
 
 // IsReferralStart проверяет, является ли команда /start с реферальным кодом
@@ -381,3 +408,251 @@ func (rh *ReferralHandler) ExtractReferralCode(text string) string {
 	}
 	return ""
 }
+
+// HandleReviewCommand показывает администратору очередь рефералов на проверку
+func (rh *ReferralHandler) HandleReviewCommand(chatID int64, userID int64) {
+	if userID != common.ADMIN_ID {
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	holds, err := rh.service.GetReviewQueue(10)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка получения очереди проверки: %v", err)
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "❌ Ошибка получения очереди проверки"))
+		return
+	}
+
+	if len(holds) == 0 {
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "✅ Очередь проверки рефералов пуста"))
+		return
+	}
+
+	for _, hold := range holds {
+		msg := tgbotapi.NewMessage(chatID, "🔍 <b>Реферал на проверке</b>\n\n"+describeHold(hold))
+		msg.ParseMode = "HTML"
+		msg.ReplyMarkup = holdReviewKeyboard(hold)
+		if _, err := rh.bot.Send(msg); err != nil {
+			log.Printf("REFERRAL_HANDLER: Ошибка отправки заявки %d: %v", hold.ID, err)
+		}
+	}
+}
+
+// handleReviewDecisionCallback обрабатывает решение администратора по подозрительному рефералу
+func (rh *ReferralHandler) handleReviewDecisionCallback(chatID int64, userID int64, data string) {
+	if userID != common.ADMIN_ID {
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	status, idText := ReferralHoldApproved, strings.TrimPrefix(data, "ref_approve:")
+	if strings.HasPrefix(data, "ref_reject:") {
+		status, idText = ReferralHoldRejected, strings.TrimPrefix(data, "ref_reject:")
+	}
+
+	holdID, err := strconv.Atoi(idText)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Неверный ID заявки в callback %s", data)
+		return
+	}
+
+	if err := rh.service.ResolveHold(holdID, status, userID); err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка обработки заявки %d: %v", holdID, err)
+		rh.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	text := fmt.Sprintf("✅ Реферал #%d одобрен, бонусы начислены", holdID)
+	if status == ReferralHoldRejected {
+		text = fmt.Sprintf("❌ Реферал #%d отклонен, бонусы не начисляются", holdID)
+	}
+	rh.bot.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+// handleWalletCallback показывает реферальный кошелек и заявки на вывод
+func (rh *ReferralHandler) handleWalletCallback(chatID int64, user *common.User) {
+	if !walletEnabled() {
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "❌ Реферальный кошелек отключен"))
+		return
+	}
+
+	balance, err := rh.service.GetWalletBalance(user.TelegramID)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка получения кошелька: %v", err)
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "❌ Ошибка получения реферального кошелька"))
+		return
+	}
+
+	payouts, err := rh.service.GetUserPayouts(user.TelegramID, 5)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка получения заявок на вывод: %v", err)
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if common.PRICE_PER_DAY > 0 && int(balance) >= common.PRICE_PER_DAY {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗓 Обменять на дни", "ref_wallet_days"),
+		))
+	}
+	if len(common.REFERRAL_PAYOUT_METHODS) > 0 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💸 Вывести", "ref_payout"),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "ref_menu"),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, referralWalletText(balance, payouts))
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	rh.bot.Send(msg)
+}
+
+// handleWalletDaysCallback обменивает реферальный кошелек на дни подписки
+func (rh *ReferralHandler) handleWalletDaysCallback(chatID int64, user *common.User) {
+	if !walletEnabled() {
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "❌ Реферальный кошелек отключен"))
+		return
+	}
+
+	days, amount, err := rh.service.ConvertWalletToDays(user.TelegramID)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка обмена кошелька пользователя %d на дни: %v", user.TelegramID, err)
+		rh.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	text := fmt.Sprintf("✅ <b>Обмен выполнен</b>\n\n💰 Списано из кошелька: <b>%.2f₽</b>\n", amount)
+	if common.TARIFF_MODE_ENABLED {
+		text += fmt.Sprintf("🗓 Подписка продлена на <b>%d дн.</b>", days)
+	} else {
+		text += fmt.Sprintf("🗓 Сумма зачислена на баланс - это <b>%d дн.</b> подписки", days)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👛 Кошелек", "ref_wallet"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = &keyboard
+
+	rh.bot.Send(msg)
+}
+
+// handlePayoutCallback показывает инструкцию по созданию заявки на вывод
+func (rh *ReferralHandler) handlePayoutCallback(chatID int64) {
+	if !walletEnabled() || len(common.REFERRAL_PAYOUT_METHODS) == 0 {
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "❌ Вывод реферального вознаграждения недоступен"))
+		return
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "ref_wallet"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, payoutHelpText())
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = &keyboard
+
+	rh.bot.Send(msg)
+}
+
+// HandlePayoutCommand создает заявку на вывод по команде /refpayout способ реквизиты
+func (rh *ReferralHandler) HandlePayoutCommand(chatID int64, user *common.User, args []string) {
+	if !walletEnabled() || len(common.REFERRAL_PAYOUT_METHODS) == 0 {
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "❌ Вывод реферального вознаграждения недоступен"))
+		return
+	}
+
+	if len(args) < 2 {
+		msg := tgbotapi.NewMessage(chatID, payoutHelpText())
+		msg.ParseMode = "HTML"
+		rh.bot.Send(msg)
+		return
+	}
+
+	payout, err := rh.service.CreatePayoutRequest(user.TelegramID, args[0], strings.Join(args[1:], " "))
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка создания заявки на вывод для %d: %v", user.TelegramID, err)
+		rh.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	text := fmt.Sprintf("✅ <b>Заявка на вывод #%d создана</b>\n\n"+
+		"💰 Сумма: <b>%.2f₽</b>\n"+
+		"🏦 Способ: %s\n\n"+
+		"Мы сообщим, когда выплата будет выполнена.",
+		payout.ID, payout.Amount, payoutMethodName(payout.Method))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	rh.bot.Send(msg)
+}
+
+// HandlePayoutsCommand показывает администратору заявки на вывод, ожидающие решения
+func (rh *ReferralHandler) HandlePayoutsCommand(chatID int64, userID int64) {
+	if userID != common.ADMIN_ID {
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	payouts, err := rh.service.GetPendingPayouts(10)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка получения заявок на вывод: %v", err)
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "❌ Ошибка получения заявок на вывод"))
+		return
+	}
+
+	if len(payouts) == 0 {
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "✅ Заявок на вывод нет"))
+		return
+	}
+
+	for _, payout := range payouts {
+		msg := tgbotapi.NewMessage(chatID, "💸 <b>Заявка на вывод</b>\n\n"+describePayout(payout))
+		msg.ParseMode = "HTML"
+		msg.ReplyMarkup = payoutReviewKeyboard(payout)
+		if _, err := rh.bot.Send(msg); err != nil {
+			log.Printf("REFERRAL_HANDLER: Ошибка отправки заявки на вывод %d: %v", payout.ID, err)
+		}
+	}
+}
+
+// handlePayoutDecisionCallback обрабатывает решение администратора по заявке на вывод
+func (rh *ReferralHandler) handlePayoutDecisionCallback(chatID int64, userID int64, data string) {
+	if userID != common.ADMIN_ID {
+		rh.bot.Send(tgbotapi.NewMessage(chatID, "🚫 Доступ запрещён"))
+		return
+	}
+
+	approve, idText := true, strings.TrimPrefix(data, "ref_payout_ok:")
+	if strings.HasPrefix(data, "ref_payout_no:") {
+		approve, idText = false, strings.TrimPrefix(data, "ref_payout_no:")
+	}
+
+	payoutID, err := strconv.Atoi(idText)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Неверный ID заявки на вывод в callback %s", data)
+		return
+	}
+
+	payout, err := rh.service.ResolvePayout(payoutID, approve, userID)
+	if err != nil {
+		log.Printf("REFERRAL_HANDLER: Ошибка обработки заявки на вывод %d: %v", payoutID, err)
+		rh.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	text := fmt.Sprintf("✅ Заявка #%d отмечена выплаченной (%.2f₽)", payout.ID, payout.Amount)
+	if !approve {
+		text = fmt.Sprintf("❌ Заявка #%d отклонена, %.2f₽ возвращены в кошелек пользователя", payout.ID, payout.Amount)
+	}
+	rh.bot.Send(tgbotapi.NewMessage(chatID, text))
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 
 	"bot/common"
+	paymentCommon "bot/payments/common"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -34,6 +35,27 @@ func InitReferralSystem(db *sql.DB, bot *tgbotapi.BotAPI) error {
 	// Создаем сервис
 	service := NewReferralService(db)
 
+	// Привязка бонусов к платежам для режима комиссии
+	if err := createCommissionSchema(db); err != nil {
+		return err
+	}
+
+	// Удержанные до подтверждения бонусы
+	if err := createHoldTables(db); err != nil {
+		return err
+	}
+
+	// Реферальный кошелек и заявки на вывод
+	if err := createWalletTables(db); err != nil {
+		return err
+	}
+
+	// Комиссия начисляется после каждого зачисленного пополнения
+	paymentCommon.RegisterCreditHook(service.awardPaymentCommission)
+
+	// Первая оплата друга подтверждает реферала и освобождает удержанный бонус
+	paymentCommon.RegisterCreditHook(service.releaseHoldOnPayment)
+
 	// Создаем обработчик
 	handler := NewReferralHandler(service, bot)
 
@@ -56,16 +78,31 @@ func InitReferralSystem(db *sql.DB, bot *tgbotapi.BotAPI) error {
 }
 
 // HandleCommand обрабатывает команды реферальной системы
-func (rm *ReferralManager) HandleCommand(chatID int64, user *common.User, command string) {
+func (rm *ReferralManager) HandleCommand(chatID int64, user *common.User, command string, args []string) {
 	if !common.REFERRAL_SYSTEM_ENABLED {
 		return
 	}
 
-	if rm.handler.IsReferralCommand(command) {
+	switch {
+	case command == "refreview":
+		rm.handler.HandleReviewCommand(chatID, user.TelegramID)
+	case command == "refpayout":
+		rm.handler.HandlePayoutCommand(chatID, user, args)
+	case command == "refpayouts":
+		rm.handler.HandlePayoutsCommand(chatID, user.TelegramID)
+	case rm.handler.IsReferralCommand(command):
 		rm.handler.HandleRefCommand(chatID, user)
 	}
 }
 
+// ProcessDueHolds выплачивает удержанные бонусы, период активности по которым истек
+func (rm *ReferralManager) ProcessDueHolds() {
+	if !common.REFERRAL_SYSTEM_ENABLED || !common.REFERRAL_HOLD_ENABLED {
+		return
+	}
+	rm.service.ProcessDueHolds()
+}
+
 // HandleCallback обрабатывает callback'и реферальной системы
 func (rm *ReferralManager) HandleCallback(chatID int64, userID int64, data string) {
 	log.Printf("REFERRAL_MANAGER: ===== ОБРАБОТКА CALLBACK =====")
@@ -45,7 +45,7 @@ func (rm *ReferralMenu) SendReferralMenu(chatID int64, user *common.User) {
 
 	// Формируем текст меню
 	text := fmt.Sprintf("🎯 <b>Реферальная система</b>\n\n")
-	text += "💰 <b>Ваш бонус за приглашение:</b> " + fmt.Sprintf("%.0f", common.REFERRAL_BONUS_AMOUNT) + "₽\n"
+	text += "💰 <b>Ваш бонус за приглашение:</b> " + referrerRewardText() + "\n"
 	text += "🎁 <b>Бонус для друга:</b> " + fmt.Sprintf("%.0f", common.REFERRAL_WELCOME_BONUS) + "₽\n\n"
 
 	text += "📊 <b>Ваша статистика:</b>\n"
@@ -60,23 +60,7 @@ func (rm *ReferralMenu) SendReferralMenu(chatID int64, user *common.User) {
 	text += "3️⃣ Вы оба получаете бонусы!\n\n"
 
 	// Создаем клавиатуру
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📊 Статистика", "ref_stats"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📋 История бонусов", "ref_history"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔗 Поделиться ссылкой", "ref_share"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔄 Обновить", "ref_refresh"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "main_menu"),
-		),
-	)
+	keyboard := referralMenuKeyboard(true)
 
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
@@ -107,7 +91,7 @@ func (rm *ReferralMenu) EditReferralMenu(chatID int64, messageID int, user *comm
 
 	// Формируем текст меню
 	text := fmt.Sprintf("🎯 <b>Реферальная система</b>\n\n")
-	text += "💰 <b>Ваш бонус за приглашение:</b> " + fmt.Sprintf("%.0f", common.REFERRAL_BONUS_AMOUNT) + "₽\n"
+	text += "💰 <b>Ваш бонус за приглашение:</b> " + referrerRewardText() + "\n"
 	text += "🎁 <b>Бонус для друга:</b> " + fmt.Sprintf("%.0f", common.REFERRAL_WELCOME_BONUS) + "₽\n\n"
 
 	text += "📊 <b>Ваша статистика:</b>\n"
@@ -122,23 +106,7 @@ func (rm *ReferralMenu) EditReferralMenu(chatID int64, messageID int, user *comm
 	text += "3️⃣ Вы оба получаете бонусы!\n\n"
 
 	// Создаем клавиатуру
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📊 Статистика", "ref_stats"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📋 История бонусов", "ref_history"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔗 Поделиться ссылкой", "ref_share"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔄 Обновить", "ref_refresh"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "main_menu"),
-		),
-	)
+	keyboard := referralMenuKeyboard(true)
 
 	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
 	editMsg.ParseMode = "HTML"
@@ -159,14 +127,12 @@ func (rm *ReferralMenu) SendReferralStats(chatID int64, user *common.User) {
 		return
 	}
 
-	text := "📊 <b>Статистика рефералов</b>\n\n"
-	text += "👥 <b>Всего приглашено:</b> " + fmt.Sprintf("%d", stats.TotalReferrals) + "\n"
-	text += "✅ <b>Успешных приглашений:</b> " + fmt.Sprintf("%d", stats.SuccessfulReferrals) + "\n"
-	text += "⏳ <b>Ожидающих:</b> " + fmt.Sprintf("%d", stats.PendingReferrals) + "\n"
+	friends, err := rm.service.GetFriendEarnings(user.TelegramID, 10)
+	if err != nil {
+		log.Printf("REFERRAL_MENU: Ошибка получения заработка по друзьям: %v", err)
+	}
 
-	text += "💰 <b>Бонусы:</b>\n"
-	text += "• За приглашение: " + fmt.Sprintf("%.0f", common.REFERRAL_BONUS_AMOUNT) + "₽\n"
-	text += "• Другу за регистрацию: " + fmt.Sprintf("%.0f", common.REFERRAL_WELCOME_BONUS) + "₽\n"
+	text := referralStatsText(stats, friends)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
@@ -191,16 +157,113 @@ func (rm *ReferralMenu) SendReferralHistory(chatID int64, user *common.User) {
 		return
 	}
 
+	text := referralHistoryText(bonuses)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "ref_menu"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = &keyboard
+
+	rm.bot.Send(msg)
+}
+
+// referralMenuKeyboard создает клавиатуру главного реферального меню
+func referralMenuKeyboard(refresh bool) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📊 Статистика", "ref_stats"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📋 История бонусов", "ref_history"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🌳 Дерево рефералов", "ref_tree"),
+		),
+	}
+
+	if walletEnabled() {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👛 Кошелек", "ref_wallet"),
+		))
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔗 Поделиться ссылкой", "ref_share"),
+	))
+
+	if refresh {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Обновить", "ref_refresh"),
+		))
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "main_menu"),
+	))
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// referralStatsText формирует текст статистики рефералов с заработком по друзьям
+func referralStatsText(stats *ReferralStats, friends []ReferralFriendEarnings) string {
+	text := "📊 <b>Статистика рефералов</b>\n\n"
+	text += "👥 <b>Всего приглашено:</b> " + fmt.Sprintf("%d", stats.TotalReferrals) + "\n"
+	text += "✅ <b>Успешных приглашений:</b> " + fmt.Sprintf("%d", stats.SuccessfulReferrals) + "\n"
+	text += "⏳ <b>Ожидающих:</b> " + fmt.Sprintf("%d", stats.PendingReferrals) + "\n"
+	text += "💵 <b>Заработано всего:</b> " + fmt.Sprintf("%.2f", stats.TotalEarnings) + "₽\n\n"
+
+	text += "💰 <b>Бонусы:</b>\n"
+	text += "• За приглашение: " + referrerRewardText() + "\n"
+	text += "• Другу за регистрацию: " + fmt.Sprintf("%.0f", common.REFERRAL_WELCOME_BONUS) + "₽\n"
+
+	if len(friends) > 0 {
+		text += "\n👥 <b>Заработок по друзьям:</b>\n"
+		for _, friend := range friends {
+			text += fmt.Sprintf("• %s: <b>%.2f₽</b>", friend.DisplayName(), friend.Amount)
+			if friend.Payments > 0 {
+				text += fmt.Sprintf(" (пополнений: %d)", friend.Payments)
+			}
+			text += "\n"
+		}
+	}
+
+	return text
+}
+
+// referralHistoryText формирует текст истории реферальных бонусов
+func referralHistoryText(bonuses []ReferralBonus) string {
 	text := "📋 <b>История реферальных бонусов</b>\n\n"
 
 	if len(bonuses) == 0 {
 		text += "📭 Пока нет бонусов\n"
 		text += "Пригласите друзей, чтобы начать зарабатывать!"
-	} else {
-		for i, bonus := range bonuses {
-			text += fmt.Sprintf("%d. %s: <b>+%.2f₽</b>\n", i+1, bonus.Description, bonus.Amount)
-			text += "   📅 " + bonus.CreatedAt.Format("02.01.2006 15:04") + "\n\n"
+		return text
+	}
+
+	for i, bonus := range bonuses {
+		text += fmt.Sprintf("%d. %s: <b>+%.2f₽</b>\n", i+1, bonus.Description, bonus.Amount)
+		if bonus.PaymentID != "" {
+			text += "   💳 Платеж: <code>" + bonus.PaymentID + "</code>\n"
 		}
+		text += "   📅 " + bonus.CreatedAt.Format("02.01.2006 15:04") + "\n\n"
+	}
+
+	return text
+}
+
+// SendReferralTree отправляет дерево рефералов по уровням
+func (rm *ReferralMenu) SendReferralTree(chatID int64, user *common.User) {
+	levels, err := rm.service.GetReferralTree(user.TelegramID)
+	if err != nil {
+		log.Printf("REFERRAL_MENU: Ошибка получения дерева рефералов: %v", err)
+		msg := tgbotapi.NewMessage(chatID, "❌ Ошибка получения дерева рефералов")
+		rm.bot.Send(msg)
+		return
 	}
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
@@ -209,7 +272,7 @@ func (rm *ReferralMenu) SendReferralHistory(chatID int64, user *common.User) {
 		),
 	)
 
-	msg := tgbotapi.NewMessage(chatID, text)
+	msg := tgbotapi.NewMessage(chatID, referralTreeText(levels))
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = &keyboard
 
@@ -25,15 +25,21 @@ CREATE TABLE IF NOT EXISTS referral_transitions (
 CREATE TABLE IF NOT EXISTS referral_bonuses (
     id SERIAL PRIMARY KEY,
     user_telegram_id BIGINT NOT NULL,
-    bonus_type VARCHAR(20) NOT NULL, -- 'referrer' или 'referred'
+    bonus_type VARCHAR(20) NOT NULL, -- 'referrer', 'referred' или 'commission'
     amount DECIMAL(10,2) NOT NULL,
     referral_code VARCHAR(50),
     related_user_id BIGINT, -- ID пользователя, связанного с бонусом
     description TEXT,
+    payment_id VARCHAR(255), -- Платеж, с которого начислена комиссия
+    level INTEGER NOT NULL DEFAULT 1, -- Уровень в цепочке приглашений (1 - прямой друг)
     created_at TIMESTAMP DEFAULT NOW(),
     FOREIGN KEY (user_telegram_id) REFERENCES users(telegram_id) ON DELETE CASCADE
 );
 
+-- Колонка добавлена позже - для существующих таблиц
+ALTER TABLE referral_bonuses ADD COLUMN IF NOT EXISTS payment_id VARCHAR(255);
+ALTER TABLE referral_bonuses ADD COLUMN IF NOT EXISTS level INTEGER NOT NULL DEFAULT 1;
+
 -- Создаем индексы для производительности
 CREATE INDEX IF NOT EXISTS idx_users_referral_code ON users(referral_code);
 CREATE INDEX IF NOT EXISTS idx_users_referred_by ON users(referred_by);
@@ -43,6 +49,9 @@ CREATE INDEX IF NOT EXISTS idx_referral_transitions_code ON referral_transitions
 CREATE INDEX IF NOT EXISTS idx_referral_bonuses_user ON referral_bonuses(user_telegram_id);
 CREATE INDEX IF NOT EXISTS idx_referral_bonuses_type ON referral_bonuses(bonus_type);
 CREATE INDEX IF NOT EXISTS idx_referral_bonuses_created_at ON referral_bonuses(created_at);
+CREATE INDEX IF NOT EXISTS idx_referral_bonuses_related_user ON referral_bonuses(related_user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_referral_bonuses_payment_user
+    ON referral_bonuses(payment_id, user_telegram_id) WHERE payment_id IS NOT NULL;
 
 -- Добавляем комментарии к таблицам
 COMMENT ON COLUMN users.referral_code IS 'Уникальный реферальный код пользователя';
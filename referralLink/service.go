@@ -151,6 +151,17 @@ func (rs *ReferralService) ProcessReferralTransition(referrerID, referredID int6
 	}
 	log.Printf("REFERRAL_SERVICE: ✅ Баланс достаточен")
 
+	// Защита от самоприглашения и циклов в цепочке приглашений
+	cycle, err := rs.wouldCreateCycle(referrerID, referredID)
+	if err != nil {
+		log.Printf("REFERRAL_SERVICE: ❌ Ошибка проверки цепочки приглашений: %v", err)
+		return err
+	}
+	if cycle {
+		log.Printf("REFERRAL_SERVICE: ❌ Приглашение %d -> %d замкнет цепочку приглашений", referrerID, referredID)
+		return fmt.Errorf("пользователь уже входит в цепочку приглашений пригласившего")
+	}
+
 	// Используем функцию из БД для обработки перехода
 	log.Printf("REFERRAL_SERVICE: Вызов функции БД process_referral_transition")
 	query := "SELECT process_referral_transition($1, $2, $3)"
@@ -176,8 +187,20 @@ func (rs *ReferralService) AwardReferralBonuses(referrerID, referredID int64, re
 	log.Printf("REFERRAL_SERVICE: ReferrerID=%d, ReferredID=%d, Code='%s'", referrerID, referredID, referralCode)
 	log.Printf("REFERRAL_SERVICE: ReferrerBonus=%.2f, WelcomeBonus=%.2f", common.REFERRAL_BONUS_AMOUNT, common.REFERRAL_WELCOME_BONUS)
 
-	// Начисляем бонус пригласившему
-	if common.REFERRAL_BONUS_AMOUNT > 0 {
+	// С защитой от накрутки бонус пригласившему удерживается до подтверждения реферала
+	if common.REFERRAL_HOLD_ENABLED {
+		if err := rs.holdReferralBonuses(referrerID, referredID, referralCode); err != nil {
+			log.Printf("REFERRAL_SERVICE: ❌ Ошибка удержания реферальных бонусов: %v", err)
+			return err
+		}
+		rs.sendAdminNotification(referrerID, referredID, referralCode)
+		return nil
+	}
+
+	// Начисляем бонус пригласившему (в режиме комиссии он получает процент с пополнений друга)
+	if commissionEnabled() {
+		log.Printf("REFERRAL_SERVICE: ⏭️ Режим комиссии: разовый бонус пригласившему не начисляется (%.0f%% с пополнений)", common.REFERRAL_COMMISSION_PERCENT)
+	} else if common.REFERRAL_BONUS_AMOUNT > 0 {
 		log.Printf("REFERRAL_SERVICE: Начисление бонуса пригласившему %d: %.2f", referrerID, common.REFERRAL_BONUS_AMOUNT)
 		err := rs.awardBonus(referrerID, "referrer", common.REFERRAL_BONUS_AMOUNT, referralCode, referredID, "Реферальный бонус за приглашение друга")
 		if err != nil {
@@ -212,51 +235,77 @@ func (rs *ReferralService) AwardReferralBonuses(referrerID, referredID int64, re
 
 // awardBonus начисляет бонус пользователю
 func (rs *ReferralService) awardBonus(userID int64, bonusType string, amount float64, referralCode string, relatedUserID int64, description string) error {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	toBalance, err := awardBonusTx(tx, userID, bonusType, amount, referralCode, relatedUserID, description)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("REFERRAL_SERVICE: ❌ Ошибка фиксации начисления бонуса пользователю %d: %v", userID, err)
+		return fmt.Errorf("ошибка фиксации начисления бонуса: %v", err)
+	}
+
+	if toBalance {
+		common.AfterBalanceTopup(userID, amount)
+	}
+
+	log.Printf("REFERRAL_SERVICE: ✅ Бонус успешно начислен пользователю %d", userID)
+	return nil
+}
+
+// awardBonusTx начисляет бонус в транзакции вместе с записью в историю и статистикой.
+// Возвращает true, если бонус зачислен на баланс: после фиксации нужно вызвать common.AfterBalanceTopup.
+func awardBonusTx(tx *sql.Tx, userID int64, bonusType string, amount float64, referralCode string, relatedUserID int64, description string) (bool, error) {
 	log.Printf("REFERRAL_SERVICE: ===== НАЧИСЛЕНИЕ БОНУСА =====")
 	log.Printf("REFERRAL_SERVICE: UserID=%d, Type='%s', Amount=%.2f, Code='%s', RelatedUserID=%d", userID, bonusType, amount, referralCode, relatedUserID)
 
-	// Используем AddBalance для начисления бонуса
-	log.Printf("REFERRAL_SERVICE: Начисление баланса через AddBalance")
-	err := common.AddBalance(userID, amount)
-	if err != nil {
-		log.Printf("REFERRAL_SERVICE: ❌ Ошибка начисления бонуса через AddBalance: %v", err)
-		return fmt.Errorf("ошибка начисления бонуса через AddBalance: %v", err)
+	toBalance := !(bonusType == "referrer" && walletEnabled())
+	if !toBalance {
+		// Заработок пригласившего копится в реферальном кошельке, а не на балансе
+		log.Printf("REFERRAL_SERVICE: Зачисление бонуса в реферальный кошелек")
+		_, err := tx.Exec("UPDATE users SET referral_wallet = referral_wallet + $2, updated_at = NOW() WHERE telegram_id = $1", userID, amount)
+		if err != nil {
+			log.Printf("REFERRAL_SERVICE: ❌ Ошибка зачисления бонуса в реферальный кошелек: %v", err)
+			return false, fmt.Errorf("ошибка зачисления бонуса в реферальный кошелек: %v", err)
+		}
+	} else {
+		log.Printf("REFERRAL_SERVICE: Начисление бонуса на баланс")
+		if err := common.AddBalanceTx(tx, userID, amount); err != nil {
+			log.Printf("REFERRAL_SERVICE: ❌ Ошибка начисления бонуса на баланс: %v", err)
+			return false, fmt.Errorf("ошибка начисления бонуса на баланс: %v", err)
+		}
 	}
-	log.Printf("REFERRAL_SERVICE: ✅ Баланс успешно начислен")
 
-	// Записываем в историю бонусов
-	log.Printf("REFERRAL_SERVICE: Запись в историю бонусов")
+	// Запись в историю и статистика фиксируются вместе с начислением
 	query := `
 		INSERT INTO referral_bonuses (user_telegram_id, bonus_type, amount, referral_code, related_user_id, description)
 		VALUES ($1, $2, $3, $4, $5, $6)`
 
-	_, err = rs.db.Exec(query, userID, bonusType, amount, referralCode, relatedUserID, description)
-	if err != nil {
+	if _, err := tx.Exec(query, userID, bonusType, amount, referralCode, relatedUserID, description); err != nil {
 		log.Printf("REFERRAL_SERVICE: ❌ Ошибка записи в историю бонусов для пользователя %d: %v", userID, err)
-		// Не возвращаем ошибку, так как бонус уже начислен
-	} else {
-		log.Printf("REFERRAL_SERVICE: ✅ Запись в историю бонусов успешна")
+		return false, fmt.Errorf("ошибка записи в историю бонусов: %v", err)
 	}
 
 	// Если это бонус пригласившему, обновляем общую сумму реферальных заработков
 	if bonusType == "referrer" {
-		log.Printf("REFERRAL_SERVICE: Обновление реферальной статистики для пригласившего")
 		updateQuery := `
 			UPDATE users 
 			SET referral_earnings = referral_earnings + $2, referral_count = referral_count + 1
 			WHERE telegram_id = $1`
 
-		_, err = rs.db.Exec(updateQuery, userID, amount)
-		if err != nil {
+		if _, err := tx.Exec(updateQuery, userID, amount); err != nil {
 			log.Printf("REFERRAL_SERVICE: ❌ Ошибка обновления реферальной статистики для пользователя %d: %v", userID, err)
-			// Не возвращаем ошибку, так как бонус уже начислен
-		} else {
-			log.Printf("REFERRAL_SERVICE: ✅ Реферальная статистика обновлена")
+			return false, fmt.Errorf("ошибка обновления реферальной статистики: %v", err)
 		}
 	}
 
-	log.Printf("REFERRAL_SERVICE: ✅ Бонус успешно начислен пользователю %d", userID)
-	return nil
+	return toBalance, nil
 }
 
 // GetReferralStats получает статистику рефералов пользователя
@@ -294,9 +343,9 @@ func (rs *ReferralService) GetReferralStats(telegramID int64) (*ReferralStats, e
 func (rs *ReferralService) GetReferralHistory(telegramID int64, limit int) ([]ReferralBonus, error) {
 	query := `
 		SELECT id, user_telegram_id, bonus_type, amount, referral_code, 
-		       related_user_id, description, created_at
+		       related_user_id, description, payment_id, created_at
 		FROM referral_bonuses 
-		WHERE user_telegram_id = $1 
+		WHERE user_telegram_id = $1 AND NOT held
 		ORDER BY created_at DESC 
 		LIMIT $2`
 
@@ -309,12 +358,12 @@ func (rs *ReferralService) GetReferralHistory(telegramID int64, limit int) ([]Re
 	var bonuses []ReferralBonus
 	for rows.Next() {
 		var bonus ReferralBonus
-		var referralCode, description sql.NullString
+		var referralCode, description, paymentID sql.NullString
 		var relatedUserID sql.NullInt64
 
 		err := rows.Scan(
 			&bonus.ID, &bonus.UserTelegramID, &bonus.BonusType, &bonus.Amount,
-			&referralCode, &relatedUserID, &description, &bonus.CreatedAt,
+			&referralCode, &relatedUserID, &description, &paymentID, &bonus.CreatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка сканирования истории бонусов: %v", err)
@@ -330,6 +379,9 @@ func (rs *ReferralService) GetReferralHistory(telegramID int64, limit int) ([]Re
 		if description.Valid {
 			bonus.Description = description.String
 		}
+		if paymentID.Valid {
+			bonus.PaymentID = paymentID.String
+		}
 
 		bonuses = append(bonuses, bonus)
 	}
@@ -451,7 +503,7 @@ func (rs *ReferralService) sendAdminNotification(referrerID, referredID int64, r
 
 	text += fmt.Sprintf("🔗 <b>Реферальный код:</b> %s\n", referralCode)
 	text += fmt.Sprintf("💰 <b>Бонусы:</b>\n")
-	text += fmt.Sprintf("• Пригласившему: %.0f₽\n", common.REFERRAL_BONUS_AMOUNT)
+	text += fmt.Sprintf("• Пригласившему: %s\n", referrerRewardText())
 	text += fmt.Sprintf("• Приглашенному: %.0f₽\n", common.REFERRAL_WELCOME_BONUS)
 
 	// Отправляем уведомление администратору
@@ -0,0 +1,188 @@
+package referralLink
+
+import (
+	"database/sql"
+	"fmt"
+
+	"bot/common"
+)
+
+// MaxReferralLevels максимальная глубина цепочки приглашений для начисления комиссии
+const MaxReferralLevels = 10
+
+// levelPercents возвращает проценты комиссии по уровням цепочки приглашений
+func levelPercents() []float64 {
+	percents := common.REFERRAL_LEVEL_PERCENTS
+	if len(percents) == 0 {
+		if common.REFERRAL_COMMISSION_PERCENT <= 0 {
+			return nil
+		}
+		percents = []float64{common.REFERRAL_COMMISSION_PERCENT}
+	}
+
+	if len(percents) > MaxReferralLevels {
+		percents = percents[:MaxReferralLevels]
+	}
+
+	// Уровни после первого нулевого процента не учитываются
+	for i, percent := range percents {
+		if percent <= 0 {
+			return percents[:i]
+		}
+	}
+
+	return percents
+}
+
+// treeDepth возвращает количество уровней, отображаемых в дереве рефералов
+func treeDepth() int {
+	if depth := len(levelPercents()); depth > 0 {
+		return depth
+	}
+	return 1
+}
+
+// getReferralChain возвращает пригласивших пользователя вверх по цепочке (не более maxLevels).
+// Цепочка обрывается на самоприглашении и при повторе пользователя (цикл).
+func (rs *ReferralService) getReferralChain(telegramID int64, maxLevels int) ([]int64, error) {
+	var chain []int64
+	visited := map[int64]bool{telegramID: true}
+
+	current := telegramID
+	for len(chain) < maxLevels {
+		var referrerID sql.NullInt64
+		err := rs.db.QueryRow("SELECT referred_by FROM users WHERE telegram_id = $1", current).Scan(&referrerID)
+		if err == sql.ErrNoRows || (err == nil && !referrerID.Valid) {
+			break
+		}
+		if err != nil {
+			return chain, fmt.Errorf("ошибка получения пригласившего пользователя %d: %v", current, err)
+		}
+
+		if visited[referrerID.Int64] {
+			return chain, fmt.Errorf("обнаружен цикл в цепочке приглашений на пользователе %d", referrerID.Int64)
+		}
+		visited[referrerID.Int64] = true
+
+		chain = append(chain, referrerID.Int64)
+		current = referrerID.Int64
+	}
+
+	return chain, nil
+}
+
+// wouldCreateCycle проверяет, замкнет ли приглашение referredID пользователем referrerID цепочку в цикл
+func (rs *ReferralService) wouldCreateCycle(referrerID, referredID int64) (bool, error) {
+	if referrerID == referredID {
+		return true, nil
+	}
+
+	var exists bool
+	err := rs.db.QueryRow(`
+		WITH RECURSIVE upline AS (
+			SELECT referred_by AS telegram_id, 1 AS depth, ARRAY[telegram_id] AS path
+			FROM users WHERE telegram_id = $1 AND referred_by IS NOT NULL
+			UNION ALL
+			SELECT u.referred_by, up.depth + 1, up.path || u.telegram_id
+			FROM users u
+			JOIN upline up ON u.telegram_id = up.telegram_id
+			WHERE u.referred_by IS NOT NULL AND NOT u.telegram_id = ANY(up.path) AND up.depth < $3
+		)
+		SELECT EXISTS(SELECT 1 FROM upline WHERE telegram_id = $2)`,
+		referrerID, referredID, MaxReferralLevels*10).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки цепочки приглашений: %v", err)
+	}
+
+	return exists, nil
+}
+
+// GetReferralTree возвращает количество участников и заработок по уровням сети пользователя
+func (rs *ReferralService) GetReferralTree(telegramID int64) ([]ReferralLevelStats, error) {
+	depth := treeDepth()
+	levels := make([]ReferralLevelStats, depth)
+	for i := range levels {
+		levels[i].Level = i + 1
+	}
+
+	rows, err := rs.db.Query(`
+		WITH RECURSIVE tree AS (
+			SELECT telegram_id, 1 AS level, ARRAY[$1::BIGINT, telegram_id] AS path
+			FROM users WHERE referred_by = $1 AND telegram_id <> $1
+			UNION ALL
+			SELECT u.telegram_id, t.level + 1, t.path || u.telegram_id
+			FROM users u
+			JOIN tree t ON u.referred_by = t.telegram_id
+			WHERE t.level < $2 AND NOT u.telegram_id = ANY(t.path)
+		)
+		SELECT level, COUNT(DISTINCT telegram_id) FROM tree GROUP BY level`, telegramID, depth)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения дерева рефералов: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var level, count int
+		if err := rows.Scan(&level, &count); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования дерева рефералов: %v", err)
+		}
+		if level >= 1 && level <= depth {
+			levels[level-1].Count = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения дерева рефералов: %v", err)
+	}
+
+	earningsRows, err := rs.db.Query(`
+		SELECT level, COALESCE(SUM(amount), 0)
+		FROM referral_bonuses
+		WHERE user_telegram_id = $1 AND bonus_type IN ('referrer', $2) AND NOT held
+		GROUP BY level`, telegramID, BonusTypeCommission)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения заработка по уровням: %v", err)
+	}
+	defer earningsRows.Close()
+
+	for earningsRows.Next() {
+		var level int
+		var amount float64
+		if err := earningsRows.Scan(&level, &amount); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования заработка по уровням: %v", err)
+		}
+		if level >= 1 && level <= depth {
+			levels[level-1].Earnings = amount
+		}
+	}
+
+	return levels, earningsRows.Err()
+}
+
+// referralTreeText формирует текст дерева рефералов по уровням
+func referralTreeText(levels []ReferralLevelStats) string {
+	text := "🌳 <b>Дерево рефералов</b>\n\n"
+
+	percents := levelPercents()
+	var totalCount int
+	var totalEarnings float64
+
+	for _, level := range levels {
+		text += fmt.Sprintf("<b>Уровень %d</b>", level.Level)
+		if commissionEnabled() && level.Level <= len(percents) {
+			text += fmt.Sprintf(" (%.0f%%)", percents[level.Level-1])
+		}
+		text += fmt.Sprintf("\n👥 Участников: %d\n💰 Заработано: %.2f₽\n\n", level.Count, level.Earnings)
+
+		totalCount += level.Count
+		totalEarnings += level.Earnings
+	}
+
+	text += fmt.Sprintf("📊 <b>Всего в сети:</b> %d\n", totalCount)
+	text += fmt.Sprintf("💵 <b>Заработано всего:</b> %.2f₽", totalEarnings)
+
+	if len(levels) == 1 {
+		text += "\n\n💡 <i>Начисления идут только с пополнений приглашенных вами друзей</i>"
+	}
+
+	return text
+}
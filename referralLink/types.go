@@ -18,14 +18,24 @@ type ReferralTransition struct {
 type ReferralBonus struct {
 	ID             int       `db:"id" json:"id"`
 	UserTelegramID int64     `db:"user_telegram_id" json:"user_telegram_id"`
-	BonusType      string    `db:"bonus_type" json:"bonus_type"` // "referrer" или "referred"
+	BonusType      string    `db:"bonus_type" json:"bonus_type"` // "referrer", "referred" или "commission"
 	Amount         float64   `db:"amount" json:"amount"`
 	ReferralCode   string    `db:"referral_code" json:"referral_code"`
 	RelatedUserID  int64     `db:"related_user_id" json:"related_user_id"`
 	Description    string    `db:"description" json:"description"`
+	PaymentID      string    `db:"payment_id" json:"payment_id"` // Платеж, с которого начислена комиссия
 	CreatedAt      time.Time `db:"created_at" json:"created_at"`
 }
 
+// ReferralFriendEarnings представляет заработок пригласившего на одном друге
+type ReferralFriendEarnings struct {
+	FriendID  int64   `json:"friend_id"`
+	Username  string  `json:"username"`
+	FirstName string  `json:"first_name"`
+	Amount    float64 `json:"amount"`
+	Payments  int     `json:"payments"` // Количество пополнений, с которых начислена комиссия
+}
+
 // ReferralStats представляет статистику рефералов
 type ReferralStats struct {
 	TotalReferrals      int     `json:"total_referrals"`
@@ -44,3 +54,54 @@ type ReferralLinkInfo struct {
 	Earnings      float64 `json:"earnings"`
 	ReferralCount int     `json:"referral_count"`
 }
+
+// ReferralLevelStats представляет статистику одного уровня реферальной сети
+type ReferralLevelStats struct {
+	Level    int     `json:"level"`
+	Count    int     `json:"count"`    // Количество участников на уровне
+	Earnings float64 `json:"earnings"` // Заработано с участников уровня
+}
+
+// Статусы удержанного реферального бонуса
+const (
+	ReferralHoldHeld     = "held"     // Ожидает оплаты или периода активности друга
+	ReferralHoldReview   = "review"   // Отправлен на проверку администратору
+	ReferralHoldReleased = "released" // Выплачен автоматически
+	ReferralHoldApproved = "approved" // Одобрен администратором
+	ReferralHoldRejected = "rejected" // Отклонен администратором
+)
+
+// ReferralHold представляет удержанный до подтверждения реферальный бонус
+type ReferralHold struct {
+	ID             int       `json:"id"`
+	ReferrerID     int64     `json:"referrer_id"`
+	ReferredID     int64     `json:"referred_id"`
+	ReferralCode   string    `json:"referral_code"`
+	ReferrerAmount float64   `json:"referrer_amount"` // Бонус пригласившему (0 в режиме комиссии)
+	WelcomeAmount  float64   `json:"welcome_amount"`  // Приветственный бонус другу
+	WelcomePaid    bool      `json:"welcome_paid"`
+	Status         string    `json:"status"`
+	Score          int       `json:"score"`   // Оценка подозрительности
+	Signals        string    `json:"signals"` // Сработавшие признаки накрутки
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Статусы заявки на вывод реферального вознаграждения
+const (
+	ReferralPayoutPending  = "pending"  // Ожидает решения администратора
+	ReferralPayoutPaid     = "paid"     // Выплачена
+	ReferralPayoutRejected = "rejected" // Отклонена, сумма возвращена в кошелек
+)
+
+// ReferralPayout представляет заявку на вывод средств из реферального кошелька
+type ReferralPayout struct {
+	ID         int        `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Amount     float64    `json:"amount"`
+	Method     string     `json:"method"`  // Способ вывода (sbp, card)
+	Details    string     `json:"details"` // Реквизиты для выплаты
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	ResolvedBy int64      `json:"resolved_by"`
+}
@@ -0,0 +1,465 @@
+package referralLink
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"bot/common"
+	paymentCommon "bot/payments/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// payoutMethodNames названия способов вывода для отображения
+var payoutMethodNames = map[string]string{
+	"sbp":  "СБП",
+	"card": "Банковская карта",
+}
+
+// payoutColumns колонки заявки на вывод в порядке scanReferralPayout
+const payoutColumns = "id, user_telegram_id, amount, method, details, status, created_at, resolved_at, COALESCE(resolved_by, 0)"
+
+// createWalletTables создает реферальный кошелек и таблицу заявок на вывод
+func createWalletTables(db *sql.DB) error {
+	alterSQL := `ALTER TABLE users ADD COLUMN IF NOT EXISTS referral_wallet DECIMAL(10,2) NOT NULL DEFAULT 0;`
+
+	tableSQL := `
+	CREATE TABLE IF NOT EXISTS referral_payouts (
+		id SERIAL PRIMARY KEY,
+		user_telegram_id BIGINT NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		method VARCHAR(20) NOT NULL,
+		details VARCHAR(255) NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		resolved_at TIMESTAMP WITH TIME ZONE,
+		resolved_by BIGINT
+	);`
+
+	indexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_referral_payouts_user ON referral_payouts(user_telegram_id);
+	CREATE INDEX IF NOT EXISTS idx_referral_payouts_status ON referral_payouts(status);`
+
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("ошибка добавления реферального кошелька: %v", err)
+	}
+
+	if _, err := db.Exec(tableSQL); err != nil {
+		return fmt.Errorf("ошибка создания таблицы referral_payouts: %v", err)
+	}
+
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("ошибка создания индексов referral_payouts: %v", err)
+	}
+
+	return nil
+}
+
+// walletEnabled проверяет, копится ли заработок пригласившего в отдельном кошельке
+func walletEnabled() bool {
+	return common.REFERRAL_WALLET_ENABLED
+}
+
+// earningsColumn возвращает колонку users, в которую зачисляется заработок пригласившего
+func earningsColumn() string {
+	if walletEnabled() {
+		return "referral_wallet"
+	}
+	return "balance"
+}
+
+// payoutMethodName возвращает название способа вывода
+func payoutMethodName(method string) string {
+	if name, ok := payoutMethodNames[method]; ok {
+		return name
+	}
+	return method
+}
+
+// isPayoutMethodAllowed проверяет, разрешен ли способ вывода в конфигурации
+func isPayoutMethodAllowed(method string) bool {
+	for _, allowed := range common.REFERRAL_PAYOUT_METHODS {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWalletBalance возвращает баланс реферального кошелька пользователя
+func (rs *ReferralService) GetWalletBalance(telegramID int64) (float64, error) {
+	var balance float64
+	err := rs.db.QueryRow("SELECT referral_wallet FROM users WHERE telegram_id = $1", telegramID).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения реферального кошелька: %v", err)
+	}
+	return balance, nil
+}
+
+// ConvertWalletToDays обменивает кошелек на целое число дней подписки по PRICE_PER_DAY.
+// Остаток меньше стоимости дня остается в кошельке.
+func (rs *ReferralService) ConvertWalletToDays(telegramID int64) (int, float64, error) {
+	if common.PRICE_PER_DAY <= 0 {
+		return 0, 0, fmt.Errorf("стоимость дня подписки не задана")
+	}
+
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var wallet float64
+	err = tx.QueryRow("SELECT referral_wallet FROM users WHERE telegram_id = $1 FOR UPDATE", telegramID).Scan(&wallet)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка получения реферального кошелька: %v", err)
+	}
+
+	days := int(wallet) / common.PRICE_PER_DAY
+	if days < 1 {
+		return 0, 0, fmt.Errorf("недостаточно средств: для обмена нужно не менее %d₽", common.PRICE_PER_DAY)
+	}
+	amount := float64(days * common.PRICE_PER_DAY)
+
+	_, err = tx.Exec("UPDATE users SET referral_wallet = referral_wallet - $2, updated_at = NOW() WHERE telegram_id = $1", telegramID, amount)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка списания из реферального кошелька: %v", err)
+	}
+
+	// Без тарифов подписка оплачивается с баланса по дням - переводим сумму на баланс
+	if !common.TARIFF_MODE_ENABLED {
+		_, err = tx.Exec("UPDATE users SET balance = balance + $2 WHERE telegram_id = $1", telegramID, amount)
+		if err != nil {
+			return 0, 0, fmt.Errorf("ошибка пополнения баланса: %v", err)
+		}
+	}
+
+	entryID := fmt.Sprintf("ref_days_%d_%d", telegramID, time.Now().UnixNano())
+	if err := paymentCommon.RecordLedgerEntryTx(tx, entryID, paymentCommon.LedgerMethodReferral, telegramID, amount,
+		paymentCommon.CreditKindReferralTransfer, fmt.Sprintf("referral_days:%d", days)); err != nil {
+		return 0, 0, fmt.Errorf("ошибка записи обмена в журнал: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("ошибка коммита транзакции: %v", err)
+	}
+
+	if common.TARIFF_MODE_ENABLED {
+		if err := rs.extendSubscription(telegramID, days); err != nil {
+			// Возвращаем списанную сумму, чтобы пользователь не потерял заработок
+			if refundErr := rs.refundWalletConversion(entryID, telegramID, amount, days); refundErr != nil {
+				log.Printf("REFERRAL_WALLET: ❌ Ошибка возврата %.2f в кошелек пользователя %d: %v", amount, telegramID, refundErr)
+			}
+			return 0, 0, err
+		}
+	} else {
+		common.ForceBalanceRecalculation(telegramID)
+	}
+
+	log.Printf("REFERRAL_WALLET: ✅ Пользователь %d обменял %.2f₽ на %d дн.", telegramID, amount, days)
+
+	return days, amount, nil
+}
+
+// refundWalletConversion возвращает в кошелек сумму обмена, дни по которому не удалось выдать
+func (rs *ReferralService) refundWalletConversion(entryID string, telegramID int64, amount float64, days int) error {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET referral_wallet = referral_wallet + $2, updated_at = NOW() WHERE telegram_id = $1", telegramID, amount); err != nil {
+		return fmt.Errorf("ошибка возврата в реферальный кошелек: %v", err)
+	}
+
+	if err := paymentCommon.RecordLedgerEntryTx(tx, entryID+"_refund", paymentCommon.LedgerMethodReferral, telegramID, -amount,
+		paymentCommon.CreditKindReferralTransfer, fmt.Sprintf("referral_days_refund:%d", days)); err != nil {
+		return fmt.Errorf("ошибка записи возврата в журнал: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка коммита транзакции: %v", err)
+	}
+	return nil
+}
+
+// extendSubscription продлевает подписку в панели на указанное количество дней
+func (rs *ReferralService) extendSubscription(telegramID int64, days int) error {
+	user, err := common.GetUserByTelegramID(telegramID)
+	if err != nil || user == nil {
+		return fmt.Errorf("ошибка получения пользователя: %v", err)
+	}
+
+	if err := common.GetUserBackendForNewClient(user.TelegramID).Extend(user, days); err != nil {
+		return fmt.Errorf("ошибка продления подписки: %v", err)
+	}
+
+	// Панель уже продлена - ошибку сохранения пользователя исправит синхронизация с панелью
+	if err := common.UpdateUser(user); err != nil {
+		log.Printf("REFERRAL_WALLET: Ошибка обновления пользователя %d после продления на %d дн.: %v", telegramID, days, err)
+	}
+
+	return nil
+}
+
+// CreatePayoutRequest создает заявку на вывод всего баланса реферального кошелька
+func (rs *ReferralService) CreatePayoutRequest(telegramID int64, method, details string) (*ReferralPayout, error) {
+	method = strings.ToLower(method)
+	if !isPayoutMethodAllowed(method) {
+		return nil, fmt.Errorf("способ вывода %s недоступен", method)
+	}
+
+	details = strings.TrimSpace(details)
+	if details == "" || len([]rune(details)) > 255 {
+		return nil, fmt.Errorf("укажите реквизиты для выплаты (не более 255 символов)")
+	}
+
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var wallet float64
+	err = tx.QueryRow("SELECT referral_wallet FROM users WHERE telegram_id = $1 FOR UPDATE", telegramID).Scan(&wallet)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения реферального кошелька: %v", err)
+	}
+
+	if wallet <= 0 || wallet < common.REFERRAL_PAYOUT_MIN_AMOUNT {
+		return nil, fmt.Errorf("минимальная сумма вывода %.0f₽, в кошельке %.2f₽", common.REFERRAL_PAYOUT_MIN_AMOUNT, wallet)
+	}
+
+	// Сумма заявки резервируется: списывается из кошелька и возвращается при отклонении
+	_, err = tx.Exec("UPDATE users SET referral_wallet = 0, updated_at = NOW() WHERE telegram_id = $1", telegramID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка списания из реферального кошелька: %v", err)
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO referral_payouts (user_telegram_id, amount, method, details)
+		VALUES ($1, $2, $3, $4)
+		RETURNING %s`, payoutColumns)
+
+	payout, err := scanReferralPayout(tx.QueryRow(query, telegramID, wallet, method, details))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания заявки на вывод: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %v", err)
+	}
+
+	log.Printf("REFERRAL_WALLET: Создана заявка на вывод %d: UserID=%d, Amount=%.2f, Method=%s", payout.ID, telegramID, payout.Amount, method)
+
+	rs.sendPayoutNotification(payout)
+
+	return payout, nil
+}
+
+// ResolvePayout завершает заявку на вывод: approve - выплачена, иначе отклонена с возвратом в кошелек
+func (rs *ReferralService) ResolvePayout(payoutID int, approve bool, resolvedBy int64) (*ReferralPayout, error) {
+	status := ReferralPayoutPaid
+	if !approve {
+		status = ReferralPayoutRejected
+	}
+
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Статус меняется атомарно, чтобы заявку нельзя было обработать дважды
+	query := fmt.Sprintf(`
+		UPDATE referral_payouts SET status = $1, resolved_at = NOW(), resolved_by = $2
+		WHERE id = $3 AND status = $4
+		RETURNING %s`, payoutColumns)
+
+	payout, err := scanReferralPayout(tx.QueryRow(query, status, resolvedBy, payoutID, ReferralPayoutPending))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("заявка %d не найдена или уже обработана", payoutID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления заявки на вывод: %v", err)
+	}
+
+	if approve {
+		// Выплата попадает в журнал вместе со сменой статуса: без записи заявка остается в ожидании
+		entryID := fmt.Sprintf("ref_payout_%d", payout.ID)
+		if err := paymentCommon.RecordLedgerEntryTx(tx, entryID, paymentCommon.LedgerMethodReferral, payout.UserID, -payout.Amount,
+			paymentCommon.CreditKindReferralPayout, "referral_payout:"+payout.Method); err != nil {
+			return nil, fmt.Errorf("ошибка записи выплаты в журнал: %v", err)
+		}
+	} else {
+		_, err = tx.Exec("UPDATE users SET referral_wallet = referral_wallet + $2, updated_at = NOW() WHERE telegram_id = $1", payout.UserID, payout.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка возврата суммы в кошелек: %v", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %v", err)
+	}
+
+	if approve {
+		rs.notifyUser(payout.UserID, fmt.Sprintf("✅ Заявка на вывод #%d выплачена\n💸 Сумма: <b>%.2f₽</b> (%s)",
+			payout.ID, payout.Amount, payoutMethodName(payout.Method)))
+	} else {
+		rs.notifyUser(payout.UserID, fmt.Sprintf("❌ Заявка на вывод #%d отклонена\n💰 Сумма <b>%.2f₽</b> возвращена в реферальный кошелек",
+			payout.ID, payout.Amount))
+	}
+
+	log.Printf("REFERRAL_WALLET: Заявка на вывод %d переведена в статус %s администратором %d", payout.ID, status, resolvedBy)
+
+	return payout, nil
+}
+
+// GetUserPayouts возвращает последние заявки пользователя на вывод
+func (rs *ReferralService) GetUserPayouts(telegramID int64, limit int) ([]*ReferralPayout, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM referral_payouts
+		WHERE user_telegram_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, payoutColumns)
+	return rs.queryPayouts(query, telegramID, limit)
+}
+
+// GetPendingPayouts возвращает заявки на вывод, ожидающие решения администратора
+func (rs *ReferralService) GetPendingPayouts(limit int) ([]*ReferralPayout, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM referral_payouts
+		WHERE status = $1
+		ORDER BY created_at
+		LIMIT $2`, payoutColumns)
+	return rs.queryPayouts(query, ReferralPayoutPending, limit)
+}
+
+// sendPayoutNotification отправляет администратору заявку на вывод с кнопками решения
+func (rs *ReferralService) sendPayoutNotification(payout *ReferralPayout) {
+	if common.GlobalBot == nil {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(common.ADMIN_ID, "💸 <b>Новая заявка на вывод</b>\n\n"+describePayout(payout))
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = payoutReviewKeyboard(payout)
+
+	if _, err := common.GlobalBot.Send(msg); err != nil {
+		log.Printf("REFERRAL_WALLET: Ошибка отправки заявки %d администратору: %v", payout.ID, err)
+	}
+}
+
+// queryPayouts выполняет выборку заявок на вывод
+func (rs *ReferralService) queryPayouts(query string, args ...interface{}) ([]*ReferralPayout, error) {
+	rows, err := rs.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения заявок на вывод: %v", err)
+	}
+	defer rows.Close()
+
+	var payouts []*ReferralPayout
+	for rows.Next() {
+		payout, err := scanReferralPayout(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования заявки на вывод: %v", err)
+		}
+		payouts = append(payouts, payout)
+	}
+
+	return payouts, rows.Err()
+}
+
+// scanReferralPayout читает заявку на вывод из строки результата
+func scanReferralPayout(row holdScanner) (*ReferralPayout, error) {
+	var payout ReferralPayout
+	var resolvedAt sql.NullTime
+	err := row.Scan(&payout.ID, &payout.UserID, &payout.Amount, &payout.Method, &payout.Details,
+		&payout.Status, &payout.CreatedAt, &resolvedAt, &payout.ResolvedBy)
+	if err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		payout.ResolvedAt = &resolvedAt.Time
+	}
+	return &payout, nil
+}
+
+// describePayout формирует описание заявки на вывод для администратора
+func describePayout(payout *ReferralPayout) string {
+	return fmt.Sprintf("🆔 Заявка: #%d\n"+
+		"👤 Пользователь: <code>%d</code>\n"+
+		"💰 Сумма: <b>%.2f₽</b>\n"+
+		"🏦 Способ: %s\n"+
+		"📝 Реквизиты: <code>%s</code>\n"+
+		"📅 Создана: %s",
+		payout.ID, payout.UserID, payout.Amount, payoutMethodName(payout.Method),
+		html.EscapeString(payout.Details), payout.CreatedAt.Format("02.01.2006 15:04"))
+}
+
+// payoutReviewKeyboard создает клавиатуру решения по заявке на вывод
+func payoutReviewKeyboard(payout *ReferralPayout) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Выплачено", fmt.Sprintf("ref_payout_ok:%d", payout.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отклонить", fmt.Sprintf("ref_payout_no:%d", payout.ID)),
+		),
+	)
+}
+
+// payoutStatusText возвращает статус заявки на вывод для отображения
+func payoutStatusText(status string) string {
+	switch status {
+	case ReferralPayoutPaid:
+		return "✅ выплачена"
+	case ReferralPayoutRejected:
+		return "❌ отклонена"
+	default:
+		return "⏳ на рассмотрении"
+	}
+}
+
+// payoutHelpText описывает формат команды заявки на вывод
+func payoutHelpText() string {
+	var methods []string
+	for _, method := range common.REFERRAL_PAYOUT_METHODS {
+		methods = append(methods, fmt.Sprintf("<code>%s</code> - %s", method, payoutMethodName(method)))
+	}
+
+	return "💸 <b>Вывод реферального вознаграждения</b>\n\n" +
+		fmt.Sprintf("Минимальная сумма: <b>%.0f₽</b>\n", common.REFERRAL_PAYOUT_MIN_AMOUNT) +
+		"Выводится весь баланс кошелька.\n\n" +
+		"Отправьте команду:\n<code>/refpayout способ реквизиты</code>\n\n" +
+		"<b>Способы:</b>\n" + strings.Join(methods, "\n") + "\n\n" +
+		"<b>Пример:</b>\n<code>/refpayout sbp +79001234567 Сбербанк</code>"
+}
+
+// referralWalletText формирует текст реферального кошелька
+func referralWalletText(balance float64, payouts []*ReferralPayout) string {
+	text := "👛 <b>Реферальный кошелек</b>\n\n"
+	text += fmt.Sprintf("💰 <b>Баланс:</b> %.2f₽\n", balance)
+
+	if common.PRICE_PER_DAY > 0 {
+		text += fmt.Sprintf("🗓 <b>Можно обменять на:</b> %d дн. (%d₽/день)\n", int(balance)/common.PRICE_PER_DAY, common.PRICE_PER_DAY)
+	}
+	if len(common.REFERRAL_PAYOUT_METHODS) > 0 {
+		text += fmt.Sprintf("💸 <b>Вывод:</b> от %.0f₽\n", common.REFERRAL_PAYOUT_MIN_AMOUNT)
+	}
+
+	if len(payouts) > 0 {
+		text += "\n📋 <b>Заявки на вывод:</b>\n"
+		for _, payout := range payouts {
+			text += fmt.Sprintf("• #%d %s: <b>%.2f₽</b> (%s) - %s\n",
+				payout.ID, payout.CreatedAt.Format("02.01.2006"), payout.Amount, payoutMethodName(payout.Method), payoutStatusText(payout.Status))
+		}
+	}
+
+	text += "\n💡 <i>Заработок за приглашения копится в кошельке и не тратится на подписку автоматически</i>"
+
+	return text
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"bot/common"
+	"bot/payments"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -141,6 +142,18 @@ func (abs *AutoBillingService) processDailyBilling() {
 			log.Printf("AUTO_BILLING: Списано %d₽ с пользователя %d, остаток: %.2f₽",
 				common.PRICE_PER_DAY, user.TelegramID, user.Balance-float64(common.PRICE_PER_DAY))
 		} else {
+			// Перед отключением пробуем автопополнение с привязанной карты
+			if abs.tryAutoTopup(&user) {
+				if err := abs.chargeDailyFee(&user); err != nil {
+					log.Printf("AUTO_BILLING: Ошибка списания для пользователя %d: %v", user.TelegramID, err)
+					continue
+				}
+				billedCount++
+				log.Printf("AUTO_BILLING: Списано %d₽ с пользователя %d после автопополнения, остаток: %.2f₽",
+					common.PRICE_PER_DAY, user.TelegramID, user.Balance)
+				continue
+			}
+
 			// Недостаточно средств - отключаем конфиг
 			err := abs.disableUserConfig(&user)
 			if err != nil {
@@ -165,15 +178,35 @@ func (abs *AutoBillingService) chargeDailyFee(user *common.User) error {
 	return common.UpdateUser(user)
 }
 
-// disableUserConfig отключает конфиг пользователя
-func (abs *AutoBillingService) disableUserConfig(user *common.User) error {
-	// Устанавливаем время истечения на текущее время
-	user.ExpiryTime = time.Now().UnixMilli()
-	user.HasActiveConfig = false
+// tryAutoTopup пытается пополнить баланс с привязанной карты.
+// При успехе обновляет данные пользователя и возвращает true, если средств теперь хватает.
+func (abs *AutoBillingService) tryAutoTopup(user *common.User) bool {
+	if !common.AUTO_TOPUP_ENABLED || payments.GlobalPaymentManager == nil {
+		return false
+	}
 
-	// Обновляем пользователя в базе
-	err := common.UpdateUser(user)
+	credited, err := payments.GlobalPaymentManager.ChargeAutoTopup(user.TelegramID)
 	if err != nil {
+		log.Printf("AUTO_BILLING: Ошибка автопополнения для пользователя %d: %v", user.TelegramID, err)
+		return false
+	}
+	if !credited {
+		return false
+	}
+
+	updated, err := common.GetUserByTelegramID(user.TelegramID)
+	if err != nil || updated == nil {
+		log.Printf("AUTO_BILLING: Ошибка получения пользователя %d после автопополнения: %v", user.TelegramID, err)
+		return false
+	}
+	*user = *updated
+
+	return user.Balance >= float64(common.PRICE_PER_DAY)
+}
+
+// disableUserConfig отключает конфиг пользователя и уведомляет о нехватке средств
+func (abs *AutoBillingService) disableUserConfig(user *common.User) error {
+	if err := common.DisableClientConfig(user); err != nil {
 		return err
 	}
 
@@ -383,8 +416,15 @@ func (abs *AutoBillingService) createConfigFromBalance(user *common.User, days i
 
 // updateConfigExpiry принудительно устанавливает время истечения конфига на основе баланса
 func (abs *AutoBillingService) updateConfigExpiry(user *common.User, days int) error {
+	// Точная установка срока поддерживается только панелью 3x-ui
+	if server := common.GetUserServer(user.TelegramID); server.BackendType() != common.BackendXUI {
+		log.Printf("AUTO_BILLING: Сервер %s пользователя %d с панелью %s, принудительное обновление срока пропущено",
+			server.ID, user.TelegramID, server.BackendType())
+		return nil
+	}
+
 	// Авторизуемся в панели
-	sessionCookie, err := common.Login()
+	sessionCookie, err := common.LoginForUser(user.TelegramID)
 	if err != nil {
 		log.Printf("AUTO_BILLING: Ошибка авторизации в панели для пользователя %d: %v", user.TelegramID, err)
 		return err
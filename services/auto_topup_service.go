@@ -0,0 +1,72 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"bot/common"
+	"bot/payments"
+	paymentCommon "bot/payments/common"
+)
+
+// StartAutoTopupService запускает периодическую проверку балансов для автопополнения
+func StartAutoTopupService(paymentManager *payments.PaymentManager) {
+	if paymentManager == nil || !paymentManager.IsAutoTopupAvailable() {
+		log.Printf("AUTO_TOPUP: Автопополнение недоступно (требуется AUTO_TOPUP_ENABLED и прямое API ЮКассы)")
+		return
+	}
+
+	interval := time.Duration(common.AUTO_TOPUP_CHECK_INTERVAL) * time.Minute
+	if interval <= 0 {
+		interval = 30 * time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			processAutoTopups(paymentManager)
+		}
+	}()
+	log.Printf("AUTO_TOPUP: Запущена проверка автопополнений (каждые %v)", interval)
+}
+
+// processAutoTopups пополняет балансы пользователей, опустившиеся ниже порога
+func processAutoTopups(paymentManager *payments.PaymentManager) {
+	settingsList, err := paymentCommon.GetEnabledAutoTopups()
+	if err != nil {
+		log.Printf("AUTO_TOPUP: Ошибка получения автопополнений: %v", err)
+		return
+	}
+
+	now := time.Now()
+	charged := 0
+	for _, settings := range settingsList {
+		if !settings.IsDue(now) {
+			continue
+		}
+
+		user, err := common.GetUserByTelegramID(settings.UserID)
+		if err != nil || user == nil {
+			log.Printf("AUTO_TOPUP: Пользователь %d не найден: %v", settings.UserID, err)
+			continue
+		}
+
+		if user.Balance >= common.AUTO_TOPUP_THRESHOLD {
+			continue
+		}
+
+		credited, err := paymentManager.ChargeAutoTopup(user.TelegramID)
+		if err != nil {
+			log.Printf("AUTO_TOPUP: Ошибка автопополнения для пользователя %d: %v", user.TelegramID, err)
+			continue
+		}
+		if credited {
+			charged++
+		}
+	}
+
+	if charged > 0 {
+		log.Printf("AUTO_TOPUP: Выполнено автопополнений: %d", charged)
+	}
+}
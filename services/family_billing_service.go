@@ -0,0 +1,27 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"bot/familyLink"
+)
+
+// StartFamilyBillingService запускает периодическую оплату мест семейного тарифа с баланса владельцев
+func StartFamilyBillingService(familyManager *familyLink.FamilyManager) {
+	if familyManager == nil {
+		log.Printf("FAMILY: Семейные тарифы не инициализированы, оплата мест отключена")
+		return
+	}
+
+	// Места оплачиваются за час до окончания оплаченного дня, поэтому проверка каждый час
+	ticker := time.NewTicker(1 * time.Hour)
+	go func() {
+		defer ticker.Stop()
+		familyManager.ProcessSeatBilling()
+		for range ticker.C {
+			familyManager.ProcessSeatBilling()
+		}
+	}()
+	log.Printf("FAMILY: Запущена оплата мест семейного тарифа (каждый час)")
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"bot/giftLink"
+)
+
+// StartGiftExpiryService запускает периодический возврат денег за неактивированные подарки
+func StartGiftExpiryService(giftManager *giftLink.GiftManager) {
+	if giftManager == nil {
+		log.Printf("GIFT: Подарки не инициализированы, возврат за истекшие подарки отключен")
+		return
+	}
+
+	ticker := time.NewTicker(1 * time.Hour)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			giftManager.ProcessExpiredGifts()
+		}
+	}()
+	log.Printf("GIFT: Запущен возврат за истекшие подарки (каждый час)")
+}
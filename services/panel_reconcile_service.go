@@ -0,0 +1,42 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// StartPanelReconcileService запускает периодическую сверку базы с клиентами панелей
+func StartPanelReconcileService(bot *tgbotapi.BotAPI) {
+	if common.PANEL_RECONCILE_INTERVAL <= 0 {
+		log.Printf("PANEL_RECONCILE: Интервал сверки не задан, периодическая сверка отключена")
+		return
+	}
+
+	interval := time.Duration(common.PANEL_RECONCILE_INTERVAL) * time.Hour
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			report, err := common.ReconcilePanels(common.PANEL_RECONCILE_AUTO_APPLY)
+			if err != nil {
+				log.Printf("PANEL_RECONCILE: Ошибка периодической сверки: %v", err)
+				continue
+			}
+
+			// Администратора беспокоим только при наличии расхождений
+			if len(report.Drifts) == 0 && len(report.Errors) == 0 {
+				continue
+			}
+
+			if _, err := bot.Send(tgbotapi.NewMessage(common.ADMIN_ID, common.FormatPanelReconcileReport(report))); err != nil {
+				log.Printf("PANEL_RECONCILE: Ошибка отправки отчета администратору: %v", err)
+			}
+		}
+	}()
+	log.Printf("PANEL_RECONCILE: Запущена периодическая сверка с панелями (каждые %v, исправление: %v)",
+		interval, common.PANEL_RECONCILE_AUTO_APPLY)
+}
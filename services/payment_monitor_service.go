@@ -84,12 +84,20 @@ func (pms *PaymentMonitorService) ProcessPaymentIfSucceeded(paymentID string, us
 		log.Printf("PAYMENT_MONITOR: Платеж %s успешен, зачисляем средства", paymentID)
 
 		// Зачисляем средства
-		err = common.AddBalance(userID, paymentInfo.Amount)
+		if paymentInfo.UserID == 0 {
+			paymentInfo.UserID = userID
+		}
+		credited, err := paymentCommon.CreditPayment(paymentInfo, "payment_monitor")
 		if err != nil {
 			log.Printf("PAYMENT_MONITOR: Ошибка зачисления средств для платежа %s: %v", paymentID, err)
 			return err
 		}
 
+		if !credited {
+			log.Printf("PAYMENT_MONITOR: Платеж %s уже был зачислен ранее", paymentID)
+			return nil
+		}
+
 		// Получаем обновленные данные пользователя
 		user, err := common.GetUserByTelegramID(userID)
 		if err != nil {
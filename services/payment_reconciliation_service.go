@@ -0,0 +1,48 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"bot/common"
+	"bot/payments"
+)
+
+// StartPeriodicReconciliation запускает периодическую сверку платежей с ЮКассой
+func StartPeriodicReconciliation(paymentManager *payments.PaymentManager) {
+	if paymentManager == nil || paymentManager.GetReconciliationService() == nil {
+		log.Printf("PAYMENT_RECONCILIATION: Платежная система не инициализирована, сверка отключена")
+		return
+	}
+
+	interval := time.Duration(common.PAYMENT_RECONCILIATION_INTERVAL) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	reconciliation := paymentManager.GetReconciliationService()
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			to := time.Now()
+			from := to.AddDate(0, 0, -common.PAYMENT_RECONCILIATION_DAYS)
+
+			report, err := reconciliation.Reconcile(from, to)
+			if err != nil {
+				log.Printf("PAYMENT_RECONCILIATION: Ошибка периодической сверки: %v", err)
+				continue
+			}
+
+			// Администратора беспокоим только при наличии расхождений
+			if len(report.Discrepancies) == 0 {
+				continue
+			}
+
+			if err := reconciliation.SendReportToAdmin(report); err != nil {
+				log.Printf("PAYMENT_RECONCILIATION: %v", err)
+			}
+		}
+	}()
+	log.Printf("PAYMENT_RECONCILIATION: Запущена периодическая сверка платежей (каждые %v)", interval)
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"bot/referralLink"
+)
+
+// StartReferralHoldService запускает периодическую выплату удержанных реферальных бонусов
+func StartReferralHoldService(referralManager *referralLink.ReferralManager) {
+	if referralManager == nil {
+		log.Printf("REFERRAL_FRAUD: Реферальная система не инициализирована, выплата удержанных бонусов отключена")
+		return
+	}
+
+	ticker := time.NewTicker(1 * time.Hour)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			referralManager.ProcessDueHolds()
+		}
+	}()
+	log.Printf("REFERRAL_FRAUD: Запущена выплата удержанных реферальных бонусов (каждый час)")
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// StartServerHealthService запускает периодическую проверку панелей и inbound'ов всех серверов
+func StartServerHealthService(bot *tgbotapi.BotAPI) {
+	if common.HEALTH_CHECK_INTERVAL <= 0 {
+		log.Printf("SERVER_HEALTH: Интервал проверки не задан, проверка серверов отключена")
+		return
+	}
+
+	interval := time.Duration(common.HEALTH_CHECK_INTERVAL) * time.Minute
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		if err := common.CheckServersHealth(bot); err != nil {
+			log.Printf("SERVER_HEALTH: Ошибка проверки серверов: %v", err)
+		}
+		for range ticker.C {
+			if err := common.CheckServersHealth(bot); err != nil {
+				log.Printf("SERVER_HEALTH: Ошибка проверки серверов: %v", err)
+			}
+		}
+	}()
+	log.Printf("SERVER_HEALTH: Запущена проверка серверов (каждые %v)", interval)
+}
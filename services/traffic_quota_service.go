@@ -0,0 +1,28 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"bot/common"
+)
+
+// StartTrafficQuotaService запускает периодический учет трафика пользователей и проверку лимитов
+func StartTrafficQuotaService() {
+	if common.TRAFFIC_CHECK_INTERVAL <= 0 {
+		log.Printf("TRAFFIC_QUOTA: Интервал проверки не задан, учет трафика отключен")
+		return
+	}
+
+	interval := time.Duration(common.TRAFFIC_CHECK_INTERVAL) * time.Minute
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := common.CheckAndDisableTrafficLimit(); err != nil {
+				log.Printf("TRAFFIC_QUOTA: Ошибка проверки трафика: %v", err)
+			}
+		}
+	}()
+	log.Printf("TRAFFIC_QUOTA: Запущен учет трафика и проверка лимитов (каждые %v)", interval)
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"bot/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// StartTrialAbuseService запускает периодический поиск связанных пробных аккаунтов по общим IP
+func StartTrialAbuseService(bot *tgbotapi.BotAPI) {
+	if common.TRIAL_ABUSE_CHECK_INTERVAL <= 0 {
+		log.Printf("TRIAL_ABUSE: Интервал проверки не задан, поиск связанных пробных аккаунтов отключен")
+		return
+	}
+
+	interval := time.Duration(common.TRIAL_ABUSE_CHECK_INTERVAL) * time.Minute
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := common.ScanTrialAbuse(bot); err != nil {
+				log.Printf("TRIAL_ABUSE: Ошибка поиска связанных пробных аккаунтов: %v", err)
+			}
+		}
+	}()
+	log.Printf("TRIAL_ABUSE: Запущен поиск связанных пробных аккаунтов (каждые %v)", interval)
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"bot/common"
+)
+
+// StartXraySyncService запускает периодическую синхронизацию серверов Xray без панели:
+// сбор трафика, восстановление клиентов после перезапуска Xray и удаление истекших
+func StartXraySyncService() {
+	if common.XRAY_SYNC_INTERVAL <= 0 {
+		log.Printf("XRAY_SYNC: Интервал синхронизации не задан, синхронизация Xray отключена")
+		return
+	}
+
+	interval := time.Duration(common.XRAY_SYNC_INTERVAL) * time.Minute
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		if err := common.SyncXrayServers(); err != nil {
+			log.Printf("XRAY_SYNC: Ошибка синхронизации серверов Xray: %v", err)
+		}
+		for range ticker.C {
+			if err := common.SyncXrayServers(); err != nil {
+				log.Printf("XRAY_SYNC: Ошибка синхронизации серверов Xray: %v", err)
+			}
+		}
+	}()
+	log.Printf("XRAY_SYNC: Запущена синхронизация серверов Xray (каждые %v)", interval)
+}
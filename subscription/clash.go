@@ -0,0 +1,144 @@
+package subscription
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Группы прокси в конфиге Clash Meta
+const (
+	clashSelectGroup = "PROXY"
+	clashAutoGroup   = "AUTO"
+)
+
+// RenderClash формирует конфиг Clash Meta (Mihomo) в YAML.
+// Точки подключения с транспортом, который Mihomo не поддерживает, пропускаются.
+func RenderClash(endpoints []Endpoint) string {
+	var b strings.Builder
+	b.WriteString("mixed-port: 7890\n")
+	b.WriteString("allow-lan: false\n")
+	b.WriteString("mode: rule\n")
+	b.WriteString("log-level: info\n")
+	b.WriteString("ipv6: true\n\n")
+
+	var names []string
+	var proxies strings.Builder
+	tags := endpointTags(endpoints)
+	for i, endpoint := range endpoints {
+		if !clashSupports(endpoint) {
+			continue
+		}
+		writeClashProxy(&proxies, tags[i], endpoint)
+		names = append(names, tags[i])
+	}
+	if len(names) == 0 {
+		b.WriteString("proxies: []\n\n")
+	} else {
+		b.WriteString("proxies:\n")
+		b.WriteString(proxies.String())
+		b.WriteString("\n")
+	}
+
+	b.WriteString("proxy-groups:\n")
+	if len(names) == 0 {
+		fmt.Fprintf(&b, "  - name: %s\n    type: select\n    proxies:\n      - DIRECT\n", yamlQuote(clashSelectGroup))
+	} else {
+		fmt.Fprintf(&b, "  - name: %s\n    type: select\n    proxies:\n", yamlQuote(clashSelectGroup))
+		fmt.Fprintf(&b, "      - %s\n", yamlQuote(clashAutoGroup))
+		for _, name := range names {
+			fmt.Fprintf(&b, "      - %s\n", yamlQuote(name))
+		}
+		fmt.Fprintf(&b, "  - name: %s\n    type: url-test\n    url: %s\n    interval: 300\n    proxies:\n",
+			yamlQuote(clashAutoGroup), yamlQuote("https://www.gstatic.com/generate_204"))
+		for _, name := range names {
+			fmt.Fprintf(&b, "      - %s\n", yamlQuote(name))
+		}
+	}
+	b.WriteString("\n")
+
+	b.WriteString("rules:\n")
+	fmt.Fprintf(&b, "  - MATCH,%s\n", clashSelectGroup)
+
+	return b.String()
+}
+
+// clashSupports проверяет, поддерживает ли Mihomo транспорт точки подключения
+func clashSupports(endpoint Endpoint) bool {
+	switch endpoint.Network {
+	case "tcp":
+		return endpoint.HeaderType == "" || endpoint.HeaderType == "none"
+	case "ws", "grpc", "httpupgrade":
+		return true
+	}
+	return false
+}
+
+// writeClashProxy добавляет прокси vless в список proxies
+func writeClashProxy(b *strings.Builder, name string, endpoint Endpoint) {
+	fmt.Fprintf(b, "  - name: %s\n", yamlQuote(name))
+	b.WriteString("    type: vless\n")
+	fmt.Fprintf(b, "    server: %s\n", yamlQuote(endpoint.Address))
+	fmt.Fprintf(b, "    port: %d\n", endpoint.Port)
+	fmt.Fprintf(b, "    uuid: %s\n", yamlQuote(endpoint.UUID))
+	b.WriteString("    udp: true\n")
+
+	network := endpoint.Network
+	if network == "httpupgrade" {
+		network = "ws"
+	}
+	fmt.Fprintf(b, "    network: %s\n", network)
+
+	if endpoint.Flow != "" {
+		fmt.Fprintf(b, "    flow: %s\n", yamlQuote(endpoint.Flow))
+	}
+
+	if endpoint.Security == "tls" || endpoint.Security == "reality" {
+		b.WriteString("    tls: true\n")
+		if endpoint.SNI != "" {
+			fmt.Fprintf(b, "    servername: %s\n", yamlQuote(endpoint.SNI))
+		}
+		if endpoint.Fingerprint != "" {
+			fmt.Fprintf(b, "    client-fingerprint: %s\n", yamlQuote(endpoint.Fingerprint))
+		}
+		if len(endpoint.ALPN) > 0 {
+			b.WriteString("    alpn:\n")
+			for _, alpn := range endpoint.ALPN {
+				fmt.Fprintf(b, "      - %s\n", yamlQuote(alpn))
+			}
+		}
+	}
+
+	if endpoint.Security == "reality" {
+		b.WriteString("    reality-opts:\n")
+		fmt.Fprintf(b, "      public-key: %s\n", yamlQuote(endpoint.PublicKey))
+		if endpoint.ShortID != "" {
+			fmt.Fprintf(b, "      short-id: %s\n", yamlQuote(endpoint.ShortID))
+		}
+	}
+
+	switch endpoint.Network {
+	case "ws", "httpupgrade":
+		b.WriteString("    ws-opts:\n")
+		path := endpoint.Path
+		if path == "" {
+			path = "/"
+		}
+		fmt.Fprintf(b, "      path: %s\n", yamlQuote(path))
+		if endpoint.Host != "" {
+			b.WriteString("      headers:\n")
+			fmt.Fprintf(b, "        Host: %s\n", yamlQuote(endpoint.Host))
+		}
+		if endpoint.Network == "httpupgrade" {
+			b.WriteString("      v2ray-http-upgrade: true\n")
+		}
+	case "grpc":
+		b.WriteString("    grpc-opts:\n")
+		fmt.Fprintf(b, "      grpc-service-name: %s\n", yamlQuote(endpoint.Service))
+	}
+}
+
+// yamlQuote экранирует строку для YAML: строка в двойных кавычках совместима с YAML
+func yamlQuote(value string) string {
+	return strconv.Quote(value)
+}
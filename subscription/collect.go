@@ -0,0 +1,169 @@
+package subscription
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"bot/common"
+)
+
+// Usage трафик и лимит пользователя по всем серверам, байты
+type Usage struct {
+	Upload   int64
+	Download int64
+	Total    int64 // 0 - без ограничения
+}
+
+// GetUserBySubID находит пользователя по ID подписки
+func GetUserBySubID(subID string) (*common.User, error) {
+	db := common.GetDatabasePG()
+	if db == nil {
+		return nil, fmt.Errorf("база данных не инициализирована")
+	}
+
+	var telegramID int64
+	err := db.QueryRow("SELECT telegram_id FROM users WHERE sub_id = $1", subID).Scan(&telegramID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("подписка %s не найдена", subID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска подписки %s: %v", subID, err)
+	}
+
+	return common.GetUserByTelegramID(telegramID)
+}
+
+// userServers возвращает серверы, на которых может находиться клиент пользователя.
+// Основной сервер всегда берется из конфигурации.
+func userServers(user *common.User) []*common.Server {
+	servers := []*common.Server{common.DefaultServer()}
+
+	loads, err := common.GetServerLoads()
+	if err != nil {
+		log.Printf("SUBSCRIPTION: %v, используем сервер пользователя %d", err, user.TelegramID)
+		if server := common.GetUserServer(user.TelegramID); server.ID != common.DefaultServerID {
+			servers = append(servers, server)
+		}
+		return servers
+	}
+
+	for _, load := range loads {
+		if load.Server.ID != common.DefaultServerID {
+			servers = append(servers, load.Server)
+		}
+	}
+
+	// Недоступные серверы пропускаем, чтобы не ждать таймаута панели при каждом обновлении подписки
+	available := servers[:0]
+	for _, server := range servers {
+		// Клиентов Marzban общая подписка не собирает - у панели своя подписка
+		if server.BackendType() == common.BackendMarzban {
+			continue
+		}
+		if common.IsServerDown(server.ID) {
+			log.Printf("SUBSCRIPTION: Сервер %s недоступен по результатам проверок, пропускаем", server.ID)
+			continue
+		}
+		available = append(available, server)
+	}
+	return available
+}
+
+// CollectEndpoints собирает клиентов пользователя со всех серверов и суммирует трафик
+func CollectEndpoints(user *common.User) ([]Endpoint, Usage, error) {
+	var endpoints []Endpoint
+	var usage Usage
+	unlimited := false
+	var lastErr error
+
+	for _, server := range userServers(user) {
+		if server.BackendType() == common.BackendXray {
+			client, err := common.GetXrayClient(server.ID, user.TelegramID)
+			if err != nil {
+				log.Printf("SUBSCRIPTION: Ошибка получения клиента сервера %s: %v", server.ID, err)
+				lastErr = err
+				continue
+			}
+			if client == nil {
+				continue
+			}
+
+			inbound := server.XrayInbound()
+			endpoint, err := newEndpoint(server.Location, inbound.Listen, inbound, client.PanelClient())
+			if err != nil {
+				log.Printf("SUBSCRIPTION: Пропускаем inbound %s сервера %s: %v", inbound.Tag, server.ID, err)
+				continue
+			}
+			endpoints = append(endpoints, endpoint)
+
+			if client.TrafficLimit == 0 {
+				unlimited = true
+			}
+			usage.Total += client.TrafficLimit
+			usage.Upload += client.Upload
+			usage.Download += client.Download
+			continue
+		}
+
+		sessionCookie, err := common.LoginServer(server)
+		if err != nil {
+			log.Printf("SUBSCRIPTION: Сервер %s недоступен: %v", server.ID, err)
+			lastErr = err
+			continue
+		}
+
+		for _, inboundID := range server.InboundIDs {
+			inbound, err := common.GetInboundByID(sessionCookie, inboundID)
+			if err != nil {
+				log.Printf("SUBSCRIPTION: Ошибка получения inbound %d сервера %s: %v", inboundID, server.ID, err)
+				lastErr = err
+				continue
+			}
+
+			var settings common.Settings
+			if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+				log.Printf("SUBSCRIPTION: Ошибка десериализации настроек inbound %d сервера %s: %v", inboundID, server.ID, err)
+				continue
+			}
+
+			client := common.FindClientByTelegramID(settings.Clients, user.TelegramID)
+			if client == nil {
+				continue
+			}
+
+			name := server.Location
+			if len(server.InboundIDs) > 1 && inbound.Remark != "" {
+				name += " - " + inbound.Remark
+			}
+
+			endpoint, err := newEndpoint(name, server.InboundAddress(inbound), inbound, *client)
+			if err != nil {
+				log.Printf("SUBSCRIPTION: Пропускаем inbound %d сервера %s: %v", inboundID, server.ID, err)
+				continue
+			}
+			endpoints = append(endpoints, endpoint)
+
+			if client.TotalGB == 0 {
+				unlimited = true
+			}
+			usage.Total += int64(client.TotalGB)
+
+			if stats := common.FindClientStats(inbound, client.Email); stats != nil {
+				usage.Upload += stats.Up
+				usage.Download += stats.Down
+			}
+		}
+	}
+
+	if unlimited {
+		usage.Total = 0
+	}
+
+	if len(endpoints) == 0 && lastErr != nil {
+		return nil, usage, fmt.Errorf("ошибка получения клиентов пользователя %d: %v", user.TelegramID, lastErr)
+	}
+
+	return endpoints, usage, nil
+}
@@ -0,0 +1,162 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"bot/common"
+)
+
+// Endpoint точка подключения VLESS: клиент пользователя в inbound одного из серверов
+type Endpoint struct {
+	Name    string // Название в клиентском приложении (локация)
+	Address string
+	Port    int
+	UUID    string
+	Flow    string
+
+	Network    string // tcp, ws, grpc, httpupgrade, xhttp
+	HeaderType string // Тип заголовка tcp (none, http)
+	Path       string // Путь ws/httpupgrade/xhttp
+	Host       string // Host ws/httpupgrade/xhttp
+	Service    string // serviceName grpc
+	Mode       string // Режим xhttp
+
+	Security    string // none, tls, reality
+	SNI         string
+	Fingerprint string
+	ALPN        []string
+	PublicKey   string // Reality
+	ShortID     string // Reality
+	SpiderX     string // Reality
+}
+
+// streamSettings поля streamSettings inbound'а 3x-ui, нужные для подключения
+type streamSettings struct {
+	Network  string `json:"network"`
+	Security string `json:"security"`
+
+	RealitySettings struct {
+		ServerNames []string `json:"serverNames"`
+		ShortIDs    []string `json:"shortIds"`
+		Settings    struct {
+			PublicKey   string `json:"publicKey"`
+			Fingerprint string `json:"fingerprint"`
+			ServerName  string `json:"serverName"`
+			SpiderX     string `json:"spiderX"`
+		} `json:"settings"`
+	} `json:"realitySettings"`
+
+	TLSSettings struct {
+		ServerName string   `json:"serverName"`
+		ALPN       []string `json:"alpn"`
+		Settings   struct {
+			Fingerprint string `json:"fingerprint"`
+		} `json:"settings"`
+	} `json:"tlsSettings"`
+
+	TCPSettings struct {
+		Header struct {
+			Type string `json:"type"`
+		} `json:"header"`
+	} `json:"tcpSettings"`
+
+	WSSettings struct {
+		Path    string            `json:"path"`
+		Host    string            `json:"host"`
+		Headers map[string]string `json:"headers"`
+	} `json:"wsSettings"`
+
+	GRPCSettings struct {
+		ServiceName string `json:"serviceName"`
+	} `json:"grpcSettings"`
+
+	HTTPUpgradeSettings struct {
+		Path string `json:"path"`
+		Host string `json:"host"`
+	} `json:"httpupgradeSettings"`
+
+	XHTTPSettings struct {
+		Path string `json:"path"`
+		Host string `json:"host"`
+		Mode string `json:"mode"`
+	} `json:"xhttpSettings"`
+}
+
+// newEndpoint собирает точку подключения из inbound'а и клиента
+func newEndpoint(name, address string, inbound *common.Inbound, client common.Client) (Endpoint, error) {
+	if inbound.Protocol != "vless" {
+		return Endpoint{}, fmt.Errorf("протокол %s inbound %d не поддерживается", inbound.Protocol, inbound.ID)
+	}
+
+	var stream streamSettings
+	if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+		return Endpoint{}, fmt.Errorf("ошибка десериализации streamSettings inbound %d: %v", inbound.ID, err)
+	}
+
+	endpoint := Endpoint{
+		Name:     name,
+		Address:  address,
+		Port:     inbound.Port,
+		UUID:     client.ID,
+		Flow:     client.Flow,
+		Network:  stream.Network,
+		Security: stream.Security,
+	}
+	if endpoint.Network == "" {
+		endpoint.Network = "tcp"
+	}
+	if endpoint.Security == "" {
+		endpoint.Security = "none"
+	}
+
+	switch endpoint.Network {
+	case "tcp":
+		endpoint.HeaderType = stream.TCPSettings.Header.Type
+	case "ws":
+		endpoint.Path = stream.WSSettings.Path
+		endpoint.Host = stream.WSSettings.Host
+		if endpoint.Host == "" {
+			endpoint.Host = stream.WSSettings.Headers["Host"]
+		}
+	case "grpc":
+		endpoint.Service = stream.GRPCSettings.ServiceName
+	case "httpupgrade":
+		endpoint.Path = stream.HTTPUpgradeSettings.Path
+		endpoint.Host = stream.HTTPUpgradeSettings.Host
+	case "xhttp":
+		endpoint.Path = stream.XHTTPSettings.Path
+		endpoint.Host = stream.XHTTPSettings.Host
+		endpoint.Mode = stream.XHTTPSettings.Mode
+	}
+
+	switch endpoint.Security {
+	case "reality":
+		reality := stream.RealitySettings
+		endpoint.PublicKey = reality.Settings.PublicKey
+		endpoint.Fingerprint = reality.Settings.Fingerprint
+		endpoint.SpiderX = reality.Settings.SpiderX
+		endpoint.SNI = reality.Settings.ServerName
+		if endpoint.SNI == "" && len(reality.ServerNames) > 0 {
+			endpoint.SNI = reality.ServerNames[0]
+		}
+		if len(reality.ShortIDs) > 0 {
+			endpoint.ShortID = reality.ShortIDs[0]
+		}
+		if endpoint.Fingerprint == "" {
+			// Reality работает только с uTLS, в 3x-ui по умолчанию chrome
+			endpoint.Fingerprint = "chrome"
+		}
+	case "tls":
+		endpoint.SNI = stream.TLSSettings.ServerName
+		endpoint.Fingerprint = stream.TLSSettings.Settings.Fingerprint
+		endpoint.ALPN = stream.TLSSettings.ALPN
+	}
+
+	// Flow xtls-rprx-vision работает только поверх tcp с tls/reality
+	if endpoint.Network != "tcp" || endpoint.Security == "none" {
+		endpoint.Flow = ""
+	}
+
+	return endpoint, nil
+}
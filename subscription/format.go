@@ -0,0 +1,110 @@
+package subscription
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Format формат подписки для клиентского приложения
+type Format string
+
+const (
+	FormatBase64  Format = "base64"  // Ссылки vless:// в base64 (v2rayNG, v2raytun, Hiddify, Happ)
+	FormatPlain   Format = "plain"   // Ссылки vless:// текстом
+	FormatClash   Format = "clash"   // YAML для Clash Meta / Mihomo
+	FormatSingBox Format = "singbox" // JSON для sing-box
+	FormatXray    Format = "xray"    // JSON Xray: массив конфигов, по одному на сервер
+)
+
+// FormatParam параметр запроса для явного выбора формата: /sub/<SubID>?format=clash
+const FormatParam = "format"
+
+// formatAliases названия форматов в параметре запроса
+var formatAliases = map[string]Format{
+	"base64":   FormatBase64,
+	"plain":    FormatPlain,
+	"links":    FormatPlain,
+	"clash":    FormatClash,
+	"mihomo":   FormatClash,
+	"meta":     FormatClash,
+	"singbox":  FormatSingBox,
+	"sing-box": FormatSingBox,
+	"xray":     FormatXray,
+	"json":     FormatXray,
+}
+
+// userAgentFormats подстроки User-Agent приложений, которым нужен свой формат.
+// Проверяются по порядку: Hiddify и v2rayN присылают User-Agent с упоминанием ядер.
+var userAgentFormats = []struct {
+	substring string
+	format    Format
+}{
+	{"hiddify", FormatBase64},
+	{"v2rayn", FormatBase64},
+	{"clash", FormatClash},
+	{"mihomo", FormatClash},
+	{"stash", FormatClash},
+	{"sing-box", FormatSingBox},
+	{"singbox", FormatSingBox},
+	{"sfa/", FormatSingBox},
+	{"sfi/", FormatSingBox},
+	{"sfm/", FormatSingBox},
+}
+
+// DetectFormat выбирает формат по параметру format, затем по User-Agent. По умолчанию base64.
+func DetectFormat(r *http.Request) Format {
+	if value := strings.ToLower(strings.TrimSpace(r.URL.Query().Get(FormatParam))); value != "" {
+		if format, ok := formatAliases[value]; ok {
+			return format
+		}
+	}
+
+	userAgent := strings.ToLower(r.UserAgent())
+	for _, candidate := range userAgentFormats {
+		if strings.Contains(userAgent, candidate.substring) {
+			return candidate.format
+		}
+	}
+
+	return FormatBase64
+}
+
+// Render формирует подписку в выбранном формате и возвращает тело и Content-Type
+func Render(format Format, endpoints []Endpoint) (string, string, error) {
+	switch format {
+	case FormatPlain:
+		return RenderPlain(endpoints), "text/plain; charset=utf-8", nil
+	case FormatClash:
+		return RenderClash(endpoints), "text/yaml; charset=utf-8", nil
+	case FormatSingBox:
+		body, err := RenderSingBox(endpoints)
+		return body, "application/json; charset=utf-8", err
+	case FormatXray:
+		body, err := RenderXray(endpoints)
+		return body, "application/json; charset=utf-8", err
+	case FormatBase64:
+		return RenderBase64(endpoints), "text/plain; charset=utf-8", nil
+	}
+	return "", "", fmt.Errorf("неизвестный формат подписки %s", format)
+}
+
+// FormatURL возвращает ссылку на подписку в указанном формате
+func FormatURL(subscriptionURL string, format Format) string {
+	return subscriptionURL + "?" + FormatParam + "=" + string(format)
+}
+
+// endpointTags возвращает уникальные названия точек подключения: одинаковые локации нумеруются
+func endpointTags(endpoints []Endpoint) []string {
+	tags := make([]string, 0, len(endpoints))
+	seen := make(map[string]int)
+	for _, endpoint := range endpoints {
+		tag := endpoint.Name
+		seen[tag]++
+		if seen[tag] > 1 {
+			tag = fmt.Sprintf("%s %d", tag, seen[tag])
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
@@ -0,0 +1,67 @@
+package subscription
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"bot/common"
+)
+
+// PathPrefix путь подписки на HTTP сервере: /sub/<SubID>
+const PathPrefix = "/sub/"
+
+// HandleSubscription отдает подписку пользователя по его SubID.
+// Активность и срок берутся из базы бота, а не из панелей.
+func HandleSubscription(w http.ResponseWriter, r *http.Request) {
+	subID := strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+	if subID == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := GetUserBySubID(subID)
+	if err != nil {
+		log.Printf("SUBSCRIPTION: %v", err)
+		http.NotFound(w, r)
+		return
+	}
+
+	var endpoints []Endpoint
+	var usage Usage
+	if common.IsConfigActive(user) {
+		endpoints, usage, err = CollectEndpoints(user)
+		if err != nil {
+			log.Printf("SUBSCRIPTION: %v", err)
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	format := DetectFormat(r)
+	body, contentType, err := Render(format, endpoints)
+	if err != nil {
+		log.Printf("SUBSCRIPTION: Ошибка формирования подписки %s пользователя %d: %v", format, user.TelegramID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("SUBSCRIPTION: Подписка %s пользователя %d: %d серверов", format, user.TelegramID, len(endpoints))
+
+	writeHeaders(w, user, usage)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, body)
+}
+
+// writeHeaders выставляет заголовки подписки: трафик, срок, название профиля
+func writeHeaders(w http.ResponseWriter, user *common.User, usage Usage) {
+	header := w.Header()
+	header.Set("Subscription-Userinfo", fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d",
+		usage.Upload, usage.Download, usage.Total, user.ExpiryTime/1000))
+	header.Set("Profile-Title", "base64:"+base64.StdEncoding.EncodeToString([]byte(common.SUBSCRIPTION_PROFILE_TITLE)))
+	header.Set("Profile-Update-Interval", fmt.Sprintf("%d", common.SUBSCRIPTION_UPDATE_INTERVAL))
+	header.Set("Support-Url", common.SUPPORT_LINK)
+}
@@ -0,0 +1,182 @@
+package subscription
+
+import (
+	"flag"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bot/common"
+)
+
+// Обновить эталоны: go test ./subscription/ -update
+var update = flag.Bool("update", false, "перезаписать эталонные файлы в testdata")
+
+// testEndpoints точки подключения из типичных inbound'ов 3x-ui
+func testEndpoints(t *testing.T) []Endpoint {
+	t.Helper()
+
+	server := &common.Server{Location: "🇩🇪 Германия", PanelURL: "https://de.example.com:4803/path/"}
+	inbounds := []struct {
+		inbound common.Inbound
+		client  common.Client
+		name    string
+	}{
+		{
+			name: "🇩🇪 Германия",
+			inbound: common.Inbound{
+				ID: 1, Port: 443, Protocol: "vless",
+				StreamSettings: `{"network":"tcp","security":"reality",
+					"realitySettings":{"serverNames":["www.google.com","google.com"],"shortIds":["6ba85179e30d4fc2",""],
+						"settings":{"publicKey":"Z84J2IelR9ch3k8VtlVhhs5ycBUlXA7wHBWcBrjqnAw","fingerprint":"chrome","spiderX":"/"}},
+					"tcpSettings":{"header":{"type":"none"}}}`,
+			},
+			client: common.Client{ID: "b831381d-6324-4d53-ad4f-8cda48b30811", Flow: "xtls-rprx-vision", Email: "123456789"},
+		},
+		{
+			name: "🇳🇱 Нидерланды",
+			inbound: common.Inbound{
+				ID: 2, Port: 8443, Protocol: "vless", Listen: "nl.example.com",
+				StreamSettings: `{"network":"ws","security":"tls",
+					"tlsSettings":{"serverName":"cdn.example.com","alpn":["h2","http/1.1"],"settings":{"fingerprint":"firefox"}},
+					"wsSettings":{"path":"/ws","headers":{"Host":"cdn.example.com"}}}`,
+			},
+			// Flow не применим к ws и должен быть отброшен
+			client: common.Client{ID: "4c1c5a6e-7f3b-4f0b-9d4e-2a0f5d8c9b11", Flow: "xtls-rprx-vision", Email: "123456789_nl"},
+		},
+		{
+			name: "🇫🇮 Финляндия",
+			inbound: common.Inbound{
+				ID: 3, Port: 2053, Protocol: "vless", Listen: "0.0.0.0",
+				StreamSettings: `{"network":"grpc","security":"reality",
+					"realitySettings":{"serverNames":["www.microsoft.com"],"shortIds":["a1"],
+						"settings":{"publicKey":"pUbKeY","fingerprint":""}},
+					"grpcSettings":{"serviceName":"grpc-svc"}}`,
+			},
+			client: common.Client{ID: "e2c7a0a4-5b1d-4bd4-8f0c-7a3c1c2d9e55", Email: "123456789 fi"},
+		},
+		{
+			name: "🇫🇮 Финляндия",
+			inbound: common.Inbound{
+				ID: 4, Port: 443, Protocol: "vless", Listen: "fi.example.com",
+				StreamSettings: `{"network":"xhttp","security":"tls",
+					"tlsSettings":{"serverName":"fi.example.com","settings":{"fingerprint":"chrome"}},
+					"xhttpSettings":{"path":"/xh","host":"fi.example.com","mode":"auto"}}`,
+			},
+			client: common.Client{ID: "0f6d1e2a-9c3b-4e7d-a1b2-c3d4e5f60718", Email: "123456789 fi2"},
+		},
+	}
+
+	var endpoints []Endpoint
+	for _, item := range inbounds {
+		endpoint, err := newEndpoint(item.name, server.InboundAddress(&item.inbound), &item.inbound, item.client)
+		if err != nil {
+			t.Fatalf("newEndpoint(%d): %v", item.inbound.ID, err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// checkGolden сравнивает результат с эталоном из testdata
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("Ошибка записи эталона %s: %v", path, err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Ошибка чтения эталона %s: %v", path, err)
+	}
+	if got != string(want) {
+		t.Errorf("%s не совпадает с эталоном.\nПолучено:\n%s\nОжидалось:\n%s", name, got, want)
+	}
+}
+
+// TestRender_Golden проверяет все форматы подписки по эталонным файлам
+func TestRender_Golden(t *testing.T) {
+	endpoints := testEndpoints(t)
+
+	tests := []struct {
+		format Format
+		golden string
+	}{
+		{FormatPlain, "plain.golden"},
+		{FormatBase64, "base64.golden"},
+		{FormatClash, "clash.yaml.golden"},
+		{FormatSingBox, "singbox.json.golden"},
+		{FormatXray, "xray.json.golden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			body, _, err := Render(tt.format, endpoints)
+			if err != nil {
+				t.Fatalf("Render(%s): %v", tt.format, err)
+			}
+			checkGolden(t, tt.golden, body)
+		})
+	}
+}
+
+// TestRender_NoEndpoints проверяет подписку без конфигов (неактивный пользователь)
+func TestRender_NoEndpoints(t *testing.T) {
+	tests := []struct {
+		format Format
+		golden string
+	}{
+		{FormatClash, "clash_empty.yaml.golden"},
+		{FormatSingBox, "singbox_empty.json.golden"},
+		{FormatXray, "xray_empty.json.golden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			body, _, err := Render(tt.format, nil)
+			if err != nil {
+				t.Fatalf("Render(%s): %v", tt.format, err)
+			}
+			checkGolden(t, tt.golden, body)
+		})
+	}
+
+	if body := RenderBase64(nil); body != "" {
+		t.Errorf("Пустая подписка base64 = %q, ожидалась пустая строка", body)
+	}
+}
+
+// TestDetectFormat проверяет выбор формата по параметру и User-Agent
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		url       string
+		userAgent string
+		expected  Format
+	}{
+		{"/sub/abc", "", FormatBase64},
+		{"/sub/abc", "v2rayNG/1.8.5", FormatBase64},
+		{"/sub/abc", "clash-verge/v1.3.8", FormatClash},
+		{"/sub/abc", "mihomo/1.18.1", FormatClash},
+		{"/sub/abc", "ClashMetaForAndroid/2.10.1.Meta", FormatClash},
+		{"/sub/abc", "SFA/1.9.3 (sing-box 1.9.3)", FormatSingBox},
+		{"/sub/abc", "HiddifyNext/2.0.5 (android) like ClashMeta v2ray sing-box", FormatBase64},
+		{"/sub/abc", "v2rayN/6.42 (Xray-core)", FormatBase64},
+		{"/sub/abc?format=xray", "v2rayNG/1.8.5", FormatXray},
+		{"/sub/abc?format=sing-box", "", FormatSingBox},
+		{"/sub/abc?format=plain", "clash-verge/v1.3.8", FormatPlain},
+		{"/sub/abc?format=unknown", "mihomo/1.18.1", FormatClash},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		r.Header.Set("User-Agent", tt.userAgent)
+		if got := DetectFormat(r); got != tt.expected {
+			t.Errorf("DetectFormat(%s, %q) = %s, ожидалось %s", tt.url, tt.userAgent, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Теги служебных outbound'ов sing-box
+const (
+	singBoxSelectTag = "proxy"
+	singBoxAutoTag   = "auto"
+	singBoxDirectTag = "direct"
+)
+
+type singBoxConfig struct {
+	Log       singBoxLog        `json:"log"`
+	Inbounds  []singBoxInbound  `json:"inbounds"`
+	Outbounds []singBoxOutbound `json:"outbounds"`
+	Route     singBoxRoute      `json:"route"`
+}
+
+type singBoxLog struct {
+	Level string `json:"level"`
+}
+
+type singBoxInbound struct {
+	Type        string   `json:"type"`
+	Tag         string   `json:"tag"`
+	Address     []string `json:"address,omitempty"`
+	AutoRoute   bool     `json:"auto_route,omitempty"`
+	StrictRoute bool     `json:"strict_route,omitempty"`
+	Listen      string   `json:"listen,omitempty"`
+	ListenPort  int      `json:"listen_port,omitempty"`
+}
+
+type singBoxOutbound struct {
+	Type      string   `json:"type"`
+	Tag       string   `json:"tag"`
+	Outbounds []string `json:"outbounds,omitempty"`
+	Default   string   `json:"default,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Interval  string   `json:"interval,omitempty"`
+
+	Server         string            `json:"server,omitempty"`
+	ServerPort     int               `json:"server_port,omitempty"`
+	UUID           string            `json:"uuid,omitempty"`
+	Flow           string            `json:"flow,omitempty"`
+	PacketEncoding string            `json:"packet_encoding,omitempty"`
+	TLS            *singBoxTLS       `json:"tls,omitempty"`
+	Transport      *singBoxTransport `json:"transport,omitempty"`
+}
+
+type singBoxTLS struct {
+	Enabled    bool            `json:"enabled"`
+	ServerName string          `json:"server_name,omitempty"`
+	ALPN       []string        `json:"alpn,omitempty"`
+	UTLS       *singBoxUTLS    `json:"utls,omitempty"`
+	Reality    *singBoxReality `json:"reality,omitempty"`
+}
+
+type singBoxUTLS struct {
+	Enabled     bool   `json:"enabled"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+type singBoxReality struct {
+	Enabled   bool   `json:"enabled"`
+	PublicKey string `json:"public_key"`
+	ShortID   string `json:"short_id,omitempty"`
+}
+
+type singBoxTransport struct {
+	Type        string            `json:"type"`
+	Path        string            `json:"path,omitempty"`
+	Host        string            `json:"host,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ServiceName string            `json:"service_name,omitempty"`
+}
+
+type singBoxRoute struct {
+	AutoDetectInterface bool   `json:"auto_detect_interface"`
+	Final               string `json:"final"`
+}
+
+// RenderSingBox формирует конфиг sing-box в JSON.
+// Точки подключения с транспортом, который sing-box не поддерживает, пропускаются.
+func RenderSingBox(endpoints []Endpoint) (string, error) {
+	var proxies []singBoxOutbound
+	var tags []string
+	for i, tag := range endpointTags(endpoints) {
+		outbound, ok := singBoxVLESS(tag, endpoints[i])
+		if !ok {
+			continue
+		}
+		proxies = append(proxies, outbound)
+		tags = append(tags, tag)
+	}
+
+	selector := singBoxOutbound{Type: "selector", Tag: singBoxSelectTag}
+	outbounds := []singBoxOutbound{}
+	if len(tags) == 0 {
+		selector.Outbounds = []string{singBoxDirectTag}
+		outbounds = append(outbounds, selector)
+	} else {
+		selector.Outbounds = append([]string{singBoxAutoTag}, tags...)
+		selector.Default = singBoxAutoTag
+		outbounds = append(outbounds, selector, singBoxOutbound{
+			Type:      "urltest",
+			Tag:       singBoxAutoTag,
+			Outbounds: tags,
+			URL:       "https://www.gstatic.com/generate_204",
+			Interval:  "5m",
+		})
+	}
+	outbounds = append(outbounds, proxies...)
+	outbounds = append(outbounds, singBoxOutbound{Type: "direct", Tag: singBoxDirectTag})
+
+	config := singBoxConfig{
+		Log: singBoxLog{Level: "warn"},
+		Inbounds: []singBoxInbound{
+			{Type: "tun", Tag: "tun-in", Address: []string{"172.19.0.1/30"}, AutoRoute: true, StrictRoute: true},
+			{Type: "mixed", Tag: "mixed-in", Listen: "127.0.0.1", ListenPort: 2080},
+		},
+		Outbounds: outbounds,
+		Route:     singBoxRoute{AutoDetectInterface: true, Final: singBoxSelectTag},
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("ошибка сериализации конфига sing-box: %v", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// singBoxVLESS собирает outbound vless для точки подключения
+func singBoxVLESS(tag string, endpoint Endpoint) (singBoxOutbound, bool) {
+	outbound := singBoxOutbound{
+		Type:           "vless",
+		Tag:            tag,
+		Server:         endpoint.Address,
+		ServerPort:     endpoint.Port,
+		UUID:           endpoint.UUID,
+		Flow:           endpoint.Flow,
+		PacketEncoding: "xudp",
+	}
+
+	switch endpoint.Network {
+	case "tcp":
+		if endpoint.HeaderType != "" && endpoint.HeaderType != "none" {
+			return outbound, false
+		}
+	case "ws":
+		outbound.Transport = &singBoxTransport{Type: "ws", Path: endpoint.Path}
+		if endpoint.Host != "" {
+			outbound.Transport.Headers = map[string]string{"Host": endpoint.Host}
+		}
+	case "httpupgrade":
+		outbound.Transport = &singBoxTransport{Type: "httpupgrade", Path: endpoint.Path, Host: endpoint.Host}
+	case "grpc":
+		outbound.Transport = &singBoxTransport{Type: "grpc", ServiceName: endpoint.Service}
+	default:
+		return outbound, false
+	}
+
+	if endpoint.Security == "tls" || endpoint.Security == "reality" {
+		outbound.TLS = &singBoxTLS{Enabled: true, ServerName: endpoint.SNI, ALPN: endpoint.ALPN}
+
+		if endpoint.Fingerprint != "" {
+			outbound.TLS.UTLS = &singBoxUTLS{Enabled: true, Fingerprint: endpoint.Fingerprint}
+		}
+
+		if endpoint.Security == "reality" {
+			outbound.TLS.Reality = &singBoxReality{Enabled: true, PublicKey: endpoint.PublicKey, ShortID: endpoint.ShortID}
+		}
+	}
+
+	return outbound, true
+}
@@ -0,0 +1,79 @@
+package subscription
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// VLESSLink формирует ссылку vless:// для точки подключения
+func VLESSLink(endpoint Endpoint) string {
+	query := url.Values{}
+	query.Set("type", endpoint.Network)
+	query.Set("security", endpoint.Security)
+	query.Set("encryption", "none")
+
+	if endpoint.Flow != "" {
+		query.Set("flow", endpoint.Flow)
+	}
+
+	switch endpoint.Network {
+	case "tcp":
+		if endpoint.HeaderType != "" && endpoint.HeaderType != "none" {
+			query.Set("headerType", endpoint.HeaderType)
+		}
+	case "grpc":
+		if endpoint.Service != "" {
+			query.Set("serviceName", endpoint.Service)
+		}
+	default:
+		if endpoint.Path != "" {
+			query.Set("path", endpoint.Path)
+		}
+		if endpoint.Host != "" {
+			query.Set("host", endpoint.Host)
+		}
+		if endpoint.Mode != "" {
+			query.Set("mode", endpoint.Mode)
+		}
+	}
+
+	if endpoint.SNI != "" {
+		query.Set("sni", endpoint.SNI)
+	}
+	if endpoint.Fingerprint != "" {
+		query.Set("fp", endpoint.Fingerprint)
+	}
+	if len(endpoint.ALPN) > 0 {
+		query.Set("alpn", strings.Join(endpoint.ALPN, ","))
+	}
+	if endpoint.Security == "reality" {
+		query.Set("pbk", endpoint.PublicKey)
+		if endpoint.ShortID != "" {
+			query.Set("sid", endpoint.ShortID)
+		}
+		if endpoint.SpiderX != "" {
+			query.Set("spx", endpoint.SpiderX)
+		}
+	}
+
+	hostPort := net.JoinHostPort(endpoint.Address, strconv.Itoa(endpoint.Port))
+	return fmt.Sprintf("vless://%s@%s?%s#%s", endpoint.UUID, hostPort, query.Encode(), url.PathEscape(endpoint.Name))
+}
+
+// RenderPlain формирует подписку со списком ссылок vless://, по одной на строку
+func RenderPlain(endpoints []Endpoint) string {
+	links := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		links = append(links, VLESSLink(endpoint))
+	}
+	return strings.Join(links, "\n")
+}
+
+// RenderBase64 формирует подписку в формате base64 со списком ссылок vless://
+func RenderBase64(endpoints []Endpoint) string {
+	return base64.StdEncoding.EncodeToString([]byte(RenderPlain(endpoints)))
+}
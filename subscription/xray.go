@@ -0,0 +1,188 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type xrayConfig struct {
+	Remarks   string         `json:"remarks"`
+	Log       xrayLog        `json:"log"`
+	Inbounds  []xrayInbound  `json:"inbounds"`
+	Outbounds []xrayOutbound `json:"outbounds"`
+	Routing   xrayRouting    `json:"routing"`
+}
+
+type xrayLog struct {
+	LogLevel string `json:"loglevel"`
+}
+
+type xrayInbound struct {
+	Tag      string        `json:"tag"`
+	Listen   string        `json:"listen"`
+	Port     int           `json:"port"`
+	Protocol string        `json:"protocol"`
+	Settings interface{}   `json:"settings,omitempty"`
+	Sniffing *xraySniffing `json:"sniffing,omitempty"`
+}
+
+type xraySniffing struct {
+	Enabled      bool     `json:"enabled"`
+	DestOverride []string `json:"destOverride"`
+}
+
+type xrayOutbound struct {
+	Tag            string              `json:"tag"`
+	Protocol       string              `json:"protocol"`
+	Settings       interface{}         `json:"settings,omitempty"`
+	StreamSettings *xrayStreamSettings `json:"streamSettings,omitempty"`
+}
+
+type xrayVNext struct {
+	VNext []xrayServer `json:"vnext"`
+}
+
+type xrayServer struct {
+	Address string     `json:"address"`
+	Port    int        `json:"port"`
+	Users   []xrayUser `json:"users"`
+}
+
+type xrayUser struct {
+	ID         string `json:"id"`
+	Encryption string `json:"encryption"`
+	Flow       string `json:"flow,omitempty"`
+}
+
+type xrayStreamSettings struct {
+	Network             string        `json:"network"`
+	Security            string        `json:"security"`
+	RealitySettings     *xrayReality  `json:"realitySettings,omitempty"`
+	TLSSettings         *xrayTLS      `json:"tlsSettings,omitempty"`
+	TCPSettings         *xrayTCP      `json:"tcpSettings,omitempty"`
+	WSSettings          *xrayPathHost `json:"wsSettings,omitempty"`
+	HTTPUpgradeSettings *xrayPathHost `json:"httpupgradeSettings,omitempty"`
+	XHTTPSettings       *xrayXHTTP    `json:"xhttpSettings,omitempty"`
+	GRPCSettings        *xrayGRPC     `json:"grpcSettings,omitempty"`
+}
+
+type xrayReality struct {
+	ServerName  string `json:"serverName"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"publicKey"`
+	ShortID     string `json:"shortId"`
+	SpiderX     string `json:"spiderX,omitempty"`
+}
+
+type xrayTLS struct {
+	ServerName  string   `json:"serverName,omitempty"`
+	Fingerprint string   `json:"fingerprint,omitempty"`
+	ALPN        []string `json:"alpn,omitempty"`
+}
+
+type xrayTCP struct {
+	Header struct {
+		Type string `json:"type"`
+	} `json:"header"`
+}
+
+type xrayPathHost struct {
+	Path string `json:"path"`
+	Host string `json:"host,omitempty"`
+}
+
+type xrayXHTTP struct {
+	Path string `json:"path"`
+	Host string `json:"host,omitempty"`
+	Mode string `json:"mode,omitempty"`
+}
+
+type xrayGRPC struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type xrayRouting struct {
+	DomainStrategy string        `json:"domainStrategy"`
+	Rules          []interface{} `json:"rules"`
+}
+
+// RenderXray формирует подписку Xray JSON: массив полных конфигов, по одному на точку подключения.
+// Такой формат понимают v2rayN, v2rayNG и Happ.
+func RenderXray(endpoints []Endpoint) (string, error) {
+	configs := make([]xrayConfig, 0, len(endpoints))
+	tags := endpointTags(endpoints)
+	for i, endpoint := range endpoints {
+		configs = append(configs, xrayConfig{
+			Remarks: tags[i],
+			Log:     xrayLog{LogLevel: "warning"},
+			Inbounds: []xrayInbound{
+				{
+					Tag:      "socks",
+					Listen:   "127.0.0.1",
+					Port:     10808,
+					Protocol: "socks",
+					Settings: map[string]interface{}{"udp": true},
+					Sniffing: &xraySniffing{Enabled: true, DestOverride: []string{"http", "tls"}},
+				},
+				{Tag: "http", Listen: "127.0.0.1", Port: 10809, Protocol: "http"},
+			},
+			Outbounds: []xrayOutbound{
+				xrayVLESS(endpoint),
+				{Tag: "direct", Protocol: "freedom"},
+				{Tag: "block", Protocol: "blackhole"},
+			},
+			Routing: xrayRouting{DomainStrategy: "AsIs", Rules: []interface{}{}},
+		})
+	}
+
+	data, err := json.MarshalIndent(configs, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("ошибка сериализации конфига Xray: %v", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// xrayVLESS собирает outbound vless для точки подключения
+func xrayVLESS(endpoint Endpoint) xrayOutbound {
+	stream := &xrayStreamSettings{Network: endpoint.Network, Security: endpoint.Security}
+
+	switch endpoint.Security {
+	case "reality":
+		stream.RealitySettings = &xrayReality{
+			ServerName:  endpoint.SNI,
+			Fingerprint: endpoint.Fingerprint,
+			PublicKey:   endpoint.PublicKey,
+			ShortID:     endpoint.ShortID,
+			SpiderX:     endpoint.SpiderX,
+		}
+	case "tls":
+		stream.TLSSettings = &xrayTLS{ServerName: endpoint.SNI, Fingerprint: endpoint.Fingerprint, ALPN: endpoint.ALPN}
+	}
+
+	switch endpoint.Network {
+	case "tcp":
+		if endpoint.HeaderType != "" && endpoint.HeaderType != "none" {
+			stream.TCPSettings = &xrayTCP{}
+			stream.TCPSettings.Header.Type = endpoint.HeaderType
+		}
+	case "ws":
+		stream.WSSettings = &xrayPathHost{Path: endpoint.Path, Host: endpoint.Host}
+	case "httpupgrade":
+		stream.HTTPUpgradeSettings = &xrayPathHost{Path: endpoint.Path, Host: endpoint.Host}
+	case "xhttp":
+		stream.XHTTPSettings = &xrayXHTTP{Path: endpoint.Path, Host: endpoint.Host, Mode: endpoint.Mode}
+	case "grpc":
+		stream.GRPCSettings = &xrayGRPC{ServiceName: endpoint.Service}
+	}
+
+	return xrayOutbound{
+		Tag:      "proxy",
+		Protocol: "vless",
+		Settings: xrayVNext{VNext: []xrayServer{{
+			Address: endpoint.Address,
+			Port:    endpoint.Port,
+			Users:   []xrayUser{{ID: endpoint.UUID, Encryption: "none", Flow: endpoint.Flow}},
+		}}},
+		StreamSettings: stream,
+	}
+}